@@ -200,6 +200,7 @@ func (ep *Entrypoint) wire(mux *mux.Router, grpc *grpc.Server) {
 
 	ep.integrations.WireAPI(mux)
 	ep.lokiLogs.WireAPI(mux)
+	ep.tempoTraces.WireAPI(mux)
 
 	mux.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -226,9 +227,19 @@ func (ep *Entrypoint) wire(mux *mux.Router, grpc *grpc.Server) {
 			bb, err := yaml.Marshal(cfg)
 			if err != nil {
 				http.Error(rw, fmt.Sprintf("failed to marshal config: %s", err), http.StatusInternalServerError)
-			} else {
-				_, _ = rw.Write(bb)
+				return
 			}
+			// The collector configs generated from the traces configs are
+			// appended in their own section.
+			if generated := ep.tempoTraces.GeneratedConfigs(); len(generated) > 0 {
+				gb, err := yaml.Marshal(map[string]interface{}{"traces_generated": generated})
+				if err != nil {
+					http.Error(rw, fmt.Sprintf("failed to marshal generated traces config: %s", err), http.StatusInternalServerError)
+					return
+				}
+				bb = append(bb, gb...)
+			}
+			_, _ = rw.Write(bb)
 		} else {
 			rw.WriteHeader(http.StatusNotFound)
 			_, _ = rw.Write([]byte("404 - config endpoint is disabled"))
@@ -85,7 +85,7 @@ func (b *batch) add(entry loki.Entry) error {
 // addFromWAL adds an entry to the batch, tracking that the data being added comes from segment segmentNum read from the
 // WAL.
 func (b *batch) addFromWAL(lbs model.LabelSet, entry logproto.Entry, segmentNum int) error {
-	b.totalBytes += len(entry.Line)
+	b.totalBytes += entrySize(entry)
 
 	// Append the entry to an already existing stream (if any)
 	labels := labelsMapToString(lbs, ReservedLabelTenantID)
@@ -202,10 +202,30 @@ func (b *batch) reportAsSentData(h SentDataMarkerHandler) {
 	}
 }
 
+// entrySize returns the size of an entry, including its structured metadata.
 func entrySize(entry logproto.Entry) int {
-	structuredMetadataSize := 0
+	return len(entry.Line) + structuredMetadataSize(entry)
+}
+
+func structuredMetadataSize(entry logproto.Entry) int {
+	size := 0
 	for _, label := range entry.StructuredMetadata {
-		structuredMetadataSize += label.Size()
+		size += label.Size()
+	}
+	return size
+}
+
+// truncateLine truncates the line of entry so that the entry, including its
+// structured metadata, is at most maxSize bytes. It returns false if the
+// structured metadata alone is larger than maxSize, in which case the entry
+// can't be truncated.
+func truncateLine(entry *logproto.Entry, maxSize int) bool {
+	keep := maxSize - structuredMetadataSize(*entry)
+	if keep < 0 {
+		return false
+	}
+	if len(entry.Line) > keep {
+		entry.Line = entry.Line[:keep]
 	}
-	return len(entry.Line) + structuredMetadataSize
+	return true
 }
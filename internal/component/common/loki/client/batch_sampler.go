@@ -0,0 +1,112 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// MaxSampledBatches is the maximum number of batches sampled at once.
+	MaxSampledBatches = 100
+	// maxSampledStreams is the maximum number of streams reported per sampled
+	// batch. The largest streams are kept.
+	maxSampledStreams = 50
+)
+
+// BatchSample describes the contents of a batch sent by a client. Only the
+// labels of the streams are recorded, never the log lines.
+type BatchSample struct {
+	Tenant    string
+	SentAt    time.Time
+	Entries   int
+	Bytes     int
+	Streams   []StreamSample // Largest streams first.
+	Truncated int            // Number of streams not reported in Streams.
+}
+
+// StreamSample describes the entries of a stream in a sampled batch.
+type StreamSample struct {
+	Labels  string
+	Entries int
+	Bytes   int
+}
+
+// batchSampler records the contents of the next batches sent by a client
+// once started. Observing a batch only reads an atomic counter while the
+// sampler isn't started.
+type batchSampler struct {
+	remaining atomic.Int64 // Batches left to sample.
+
+	mut     sync.Mutex
+	samples []BatchSample
+}
+
+// start discards the previous samples and samples the next n batches, at
+// most MaxSampledBatches. A zero n stops sampling.
+func (s *batchSampler) start(n int) {
+	if n > MaxSampledBatches {
+		n = MaxSampledBatches
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.samples = nil
+	s.remaining.Store(int64(n))
+}
+
+// observe samples b if the sampler is started.
+func (s *batchSampler) observe(tenantID string, b *batch) {
+	if s.remaining.Load() <= 0 {
+		return
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	// Batches may be sent concurrently, so check again now that no other
+	// batch is being observed.
+	if s.remaining.Load() <= 0 {
+		return
+	}
+	s.remaining.Add(-1)
+	s.samples = append(s.samples, newBatchSample(tenantID, b))
+}
+
+// state returns the batches sampled so far, and the number of batches left
+// to sample.
+func (s *batchSampler) state() ([]BatchSample, int) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return append([]BatchSample(nil), s.samples...), int(s.remaining.Load())
+}
+
+func newBatchSample(tenantID string, b *batch) BatchSample {
+	sample := BatchSample{
+		Tenant: tenantID,
+		SentAt: time.Now(),
+		Bytes:  b.sizeBytes(),
+	}
+
+	streams := make([]StreamSample, 0, len(b.streams))
+	for _, stream := range b.streams {
+		ss := StreamSample{Labels: stream.Labels, Entries: len(stream.Entries)}
+		for _, entry := range stream.Entries {
+			ss.Bytes += entrySize(entry)
+		}
+		sample.Entries += ss.Entries
+		streams = append(streams, ss)
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		if streams[i].Bytes != streams[j].Bytes {
+			return streams[i].Bytes > streams[j].Bytes
+		}
+		return streams[i].Labels < streams[j].Labels
+	})
+	if len(streams) > maxSampledStreams {
+		sample.Truncated = len(streams) - maxSampledStreams
+		streams = streams[:maxSampledStreams]
+	}
+	sample.Streams = streams
+	return sample
+}
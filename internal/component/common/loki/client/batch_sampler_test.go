@@ -0,0 +1,91 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/agent/internal/component/common/loki"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+func TestBatchSampler(t *testing.T) {
+	newEntry := func(app, line string) loki.Entry {
+		return loki.Entry{
+			Labels: model.LabelSet{"app": model.LabelValue(app)},
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: line},
+		}
+	}
+	b := newBatch(0,
+		newEntry("small", "a"),
+		newEntry("large", strings.Repeat("b", 100)),
+		newEntry("large", strings.Repeat("c", 50)),
+		newEntry("small", "d"),
+	)
+
+	var s batchSampler
+
+	// Batches aren't sampled until the sampler is started.
+	s.observe("", b)
+	samples, pending := s.state()
+	require.Empty(t, samples)
+	require.Zero(t, pending)
+
+	s.start(2)
+	for i := 0; i < 3; i++ {
+		s.observe("tenant-1", b)
+	}
+	samples, pending = s.state()
+	require.Zero(t, pending)
+	require.Len(t, samples, 2)
+	for _, sample := range samples {
+		require.Equal(t, "tenant-1", sample.Tenant)
+		require.Equal(t, 4, sample.Entries)
+		require.Equal(t, 152, sample.Bytes)
+		require.Zero(t, sample.Truncated)
+		// The largest streams come first.
+		require.Equal(t, []StreamSample{
+			{Labels: `{app="large"}`, Entries: 2, Bytes: 150},
+			{Labels: `{app="small"}`, Entries: 2, Bytes: 2},
+		}, sample.Streams)
+	}
+
+	// Starting again discards the previous samples, and the number of
+	// sampled batches is bounded.
+	s.start(MaxSampledBatches + 1)
+	samples, pending = s.state()
+	require.Empty(t, samples)
+	require.Equal(t, MaxSampledBatches, pending)
+
+	s.start(0)
+	s.observe("", b)
+	samples, pending = s.state()
+	require.Empty(t, samples)
+	require.Zero(t, pending)
+}
+
+func TestBatchSampler_TruncatedStreams(t *testing.T) {
+	var entries []loki.Entry
+	for i := 0; i < maxSampledStreams+5; i++ {
+		entries = append(entries, loki.Entry{
+			Labels: model.LabelSet{"app": model.LabelValue(strings.Repeat("x", i+1))},
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: strings.Repeat("l", i+1)},
+		})
+	}
+
+	var s batchSampler
+	s.start(1)
+	s.observe("", newBatch(0, entries...))
+
+	samples, _ := s.state()
+	require.Len(t, samples, 1)
+	require.Len(t, samples[0].Streams, maxSampledStreams)
+	require.Equal(t, 5, samples[0].Truncated)
+	require.Equal(t, maxSampledStreams+5, samples[0].Entries)
+	// The smallest streams are the ones left out.
+	require.Equal(t, maxSampledStreams+5, samples[0].Streams[0].Bytes)
+	require.Equal(t, 6, samples[0].Streams[maxSampledStreams-1].Bytes)
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/grafana/agent/internal/component/common/loki"
 	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/push"
 )
 
 func TestBatch_MaxStreams(t *testing.T) {
@@ -87,6 +88,64 @@ func TestBatch_add(t *testing.T) {
 	}
 }
 
+func TestBatch_addFromWAL(t *testing.T) {
+	b := newBatch(0)
+	require.NoError(t, b.addFromWAL(model.LabelSet{}, logEntries[0].Entry, 1))
+	require.NoError(t, b.addFromWAL(model.LabelSet{}, logEntries[7].Entry, 1))
+
+	// The structured metadata of the entries read from the WAL counts towards
+	// the size of the batch, like the one of the entries added directly.
+	assert.Equal(t, entrySize(logEntries[0].Entry)+entrySize(logEntries[7].Entry), b.sizeBytes())
+	assert.Greater(t, b.sizeBytes(), len(logEntries[0].Line)+len(logEntries[7].Line))
+}
+
+func TestTruncateLine(t *testing.T) {
+	traceID := push.LabelsAdapter{{Name: "trace_id", Value: "12345"}} // 17 bytes once encoded
+
+	tests := map[string]struct {
+		entry        logproto.Entry
+		maxSize      int
+		expectedLine string
+		expectedOK   bool
+	}{
+		"line without structured metadata": {
+			entry:        logproto.Entry{Line: "line0123456789"},
+			maxSize:      10,
+			expectedLine: "line012345",
+			expectedOK:   true,
+		},
+		"line with structured metadata": {
+			entry:        logproto.Entry{Line: "line0123456789", StructuredMetadata: traceID},
+			maxSize:      20,
+			expectedLine: "lin",
+			expectedOK:   true,
+		},
+		"structured metadata filling the max size": {
+			entry:        logproto.Entry{Line: "line", StructuredMetadata: traceID},
+			maxSize:      17,
+			expectedLine: "",
+			expectedOK:   true,
+		},
+		"structured metadata larger than the max size": {
+			entry:        logproto.Entry{Line: "line", StructuredMetadata: traceID},
+			maxSize:      16,
+			expectedLine: "line",
+			expectedOK:   false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			entry := tc.entry
+			require.Equal(t, tc.expectedOK, truncateLine(&entry, tc.maxSize))
+			require.Equal(t, tc.expectedLine, entry.Line)
+			if tc.expectedOK {
+				require.LessOrEqual(t, entrySize(entry), tc.maxSize)
+			}
+		})
+	}
+}
+
 func TestBatch_encode(t *testing.T) {
 	t.Parallel()
 
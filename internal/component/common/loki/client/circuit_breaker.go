@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/logging/level"
+)
+
+// CircuitBreakerState is the state of the circuit breaker of a client.
+type CircuitBreakerState int
+
+const (
+	// CircuitBreakerClosed lets requests through, counting consecutive
+	// failures.
+	CircuitBreakerClosed CircuitBreakerState = iota
+	// CircuitBreakerOpen pauses requests until the open duration elapsed.
+	CircuitBreakerOpen
+	// CircuitBreakerHalfOpen lets a single probe request through, which
+	// decides whether the breaker closes or opens again.
+	CircuitBreakerHalfOpen
+)
+
+func (s CircuitBreakerState) String() string {
+	switch s {
+	case CircuitBreakerClosed:
+		return "closed"
+	case CircuitBreakerOpen:
+		return "open"
+	case CircuitBreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker pauses the requests of a client to an endpoint which failed
+// too many times in a row, so that a failing endpoint isn't retried forever.
+// A circuitBreaker with a zero failure threshold never opens.
+type circuitBreaker struct {
+	threshold     int
+	openDuration  time.Duration
+	onStateChange func(CircuitBreakerState)
+
+	mut      sync.Mutex
+	state    CircuitBreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	// changed is closed and replaced whenever the state changes, to wake up
+	// waiting requests.
+	changed chan struct{}
+}
+
+func newCircuitBreaker(cfg CircuitBreakerConfig, onStateChange func(CircuitBreakerState)) *circuitBreaker {
+	openDuration := cfg.OpenDuration
+	if openDuration <= 0 {
+		openDuration = CircuitBreakerOpenDuration
+	}
+	if onStateChange == nil {
+		onStateChange = func(CircuitBreakerState) {}
+	}
+	return &circuitBreaker{
+		threshold:     cfg.FailureThreshold,
+		openDuration:  openDuration,
+		onStateChange: onStateChange,
+		changed:       make(chan struct{}),
+	}
+}
+
+// newClientCircuitBreaker creates the circuit breaker of a client, which
+// reports its state through metrics and logs its transitions.
+func newClientCircuitBreaker(cfg Config, metrics *Metrics, logger log.Logger) *circuitBreaker {
+	host := cfg.URL.Host
+	if cfg.CircuitBreaker.FailureThreshold > 0 {
+		metrics.circuitBreakerState.WithLabelValues(host).Set(float64(CircuitBreakerClosed))
+	}
+	return newCircuitBreaker(cfg.CircuitBreaker, func(state CircuitBreakerState) {
+		metrics.circuitBreakerState.WithLabelValues(host).Set(float64(state))
+		metrics.circuitBreakerTransitions.WithLabelValues(host, state.String()).Inc()
+		level.Warn(logger).Log("msg", "circuit breaker changed state", "state", state)
+	})
+}
+
+// acquire blocks until a request may be sent or ctx is done. Callers must
+// report the outcome of the request with record.
+func (b *circuitBreaker) acquire(ctx context.Context) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	for {
+		b.mut.Lock()
+		var wait <-chan time.Time
+		switch b.state {
+		case CircuitBreakerClosed:
+			b.mut.Unlock()
+			return nil
+		case CircuitBreakerOpen:
+			remaining := b.openDuration - time.Since(b.openedAt)
+			if remaining <= 0 {
+				b.setState(CircuitBreakerHalfOpen)
+				b.probing = true
+				b.mut.Unlock()
+				return nil
+			}
+			wait = time.After(remaining)
+		case CircuitBreakerHalfOpen:
+			if !b.probing {
+				b.probing = true
+				b.mut.Unlock()
+				return nil
+			}
+		}
+		changed := b.changed
+		b.mut.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-wait:
+		case <-changed:
+		}
+	}
+}
+
+// record reports the outcome of a request let through by acquire.
+func (b *circuitBreaker) record(failed bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	switch b.state {
+	case CircuitBreakerClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open()
+		}
+	case CircuitBreakerHalfOpen:
+		b.probing = false
+		if failed {
+			b.open()
+			return
+		}
+		b.failures = 0
+		b.setState(CircuitBreakerClosed)
+	}
+}
+
+// open must be called with mut held.
+func (b *circuitBreaker) open() {
+	b.openedAt = time.Now()
+	b.setState(CircuitBreakerOpen)
+}
+
+// setState must be called with mut held.
+func (b *circuitBreaker) setState(state CircuitBreakerState) {
+	b.state = state
+	close(b.changed)
+	b.changed = make(chan struct{})
+	b.onStateChange(state)
+}
+
+// isOpen returns whether requests are currently paused.
+func (b *circuitBreaker) isOpen() bool {
+	return b.currentState() == CircuitBreakerOpen
+}
+
+func (b *circuitBreaker) currentState() CircuitBreakerState {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.state
+}
+
+// requestFailed returns whether the outcome of a request counts as a failure
+// of the endpoint: server errors and connection-level errors. Rate limiting
+// and other client errors don't open the circuit breaker.
+func requestFailed(status int, err error) bool {
+	return err != nil && (status <= 0 || status/100 == 5)
+}
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/agent/internal/component/common/loki"
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		mut         sync.Mutex
+		transitions []CircuitBreakerState
+	)
+	b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, OpenDuration: 50 * time.Millisecond}, func(state CircuitBreakerState) {
+		mut.Lock()
+		defer mut.Unlock()
+		transitions = append(transitions, state)
+	})
+
+	// A success resets the count of consecutive failures.
+	for _, failed := range []bool{true, false, true} {
+		require.NoError(t, b.acquire(context.Background()))
+		b.record(failed)
+	}
+	require.Equal(t, CircuitBreakerClosed, b.currentState())
+
+	// The second consecutive failure opens the breaker, which pauses
+	// requests.
+	require.NoError(t, b.acquire(context.Background()))
+	b.record(true)
+	require.Equal(t, CircuitBreakerOpen, b.currentState())
+	requirePaused(t, b)
+
+	// Once the open duration elapsed, a single probe is let through.
+	waitProbe := func() {
+		start := time.Now()
+		require.NoError(t, b.acquire(context.Background()))
+		require.Equal(t, CircuitBreakerHalfOpen, b.currentState())
+		require.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond)
+		requirePaused(t, b)
+	}
+	waitProbe()
+
+	// A failed probe opens the breaker again.
+	b.record(true)
+	require.Equal(t, CircuitBreakerOpen, b.currentState())
+	requirePaused(t, b)
+
+	// A successful probe closes it.
+	waitProbe()
+	b.record(false)
+	require.Equal(t, CircuitBreakerClosed, b.currentState())
+	require.NoError(t, b.acquire(context.Background()))
+
+	mut.Lock()
+	defer mut.Unlock()
+	require.Equal(t, []CircuitBreakerState{
+		CircuitBreakerOpen,
+		CircuitBreakerHalfOpen,
+		CircuitBreakerOpen,
+		CircuitBreakerHalfOpen,
+		CircuitBreakerClosed,
+	}, transitions)
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	b := newCircuitBreaker(CircuitBreakerConfig{}, nil)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.acquire(context.Background()))
+		b.record(true)
+	}
+	require.Equal(t, CircuitBreakerClosed, b.currentState())
+}
+
+func TestCircuitBreaker_ProbeUnblocksWaitingRequests(t *testing.T) {
+	b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenDuration: time.Millisecond}, nil)
+	require.NoError(t, b.acquire(context.Background()))
+	b.record(true)
+
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, b.acquire(context.Background()))
+
+	acquired := make(chan error)
+	go func() { acquired <- b.acquire(context.Background()) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("request let through while probing")
+	case <-time.After(20 * time.Millisecond):
+	}
+	b.record(false)
+	require.NoError(t, <-acquired)
+}
+
+// requirePaused asserts that requests are paused by b.
+func requirePaused(t *testing.T, b *circuitBreaker) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.True(t, errors.Is(b.acquire(ctx), context.DeadlineExceeded))
+}
+
+func TestRequestFailed(t *testing.T) {
+	err := errors.New("failed")
+	require.False(t, requestFailed(200, nil))
+	require.True(t, requestFailed(-1, err))
+	require.True(t, requestFailed(500, err))
+	require.True(t, requestFailed(503, err))
+	require.False(t, requestFailed(429, err))
+	require.False(t, requestFailed(400, err))
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	var (
+		mut      sync.Mutex
+		requests []time.Time
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mut.Lock()
+		defer mut.Unlock()
+		requests = append(requests, time.Now())
+		// The first two requests fail, which opens the circuit breaker.
+		if len(requests) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	cfg := Config{
+		URL:           serverURL,
+		BatchWait:     10 * time.Millisecond,
+		BatchSize:     1024,
+		Client:        config.HTTPClientConfig{},
+		BackoffConfig: backoff.Config{MinBackoff: 1 * time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxRetries: 5},
+		Timeout:       1 * time.Second,
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold: 2,
+			OpenDuration:     100 * time.Millisecond,
+		},
+	}
+
+	c, err := New(NewMetrics(reg), cfg, 0, 0, false, log.NewNopLogger())
+	require.NoError(t, err)
+
+	c.Chan() <- loki.Entry{Labels: model.LabelSet{"app": "foo"}, Entry: logproto.Entry{Timestamp: time.Unix(1, 0).UTC(), Line: "line"}}
+	c.Stop()
+
+	mut.Lock()
+	defer mut.Unlock()
+	require.Len(t, requests, 3)
+	// The probe is only sent once the open duration elapsed.
+	require.GreaterOrEqual(t, requests[2].Sub(requests[1]), 90*time.Millisecond)
+
+	expectedMetrics := strings.Replace(`
+		# HELP loki_write_circuit_breaker_state State of the circuit breaker of the client: 0 for closed, 1 for open and 2 for half-open.
+		# TYPE loki_write_circuit_breaker_state gauge
+		loki_write_circuit_breaker_state{host="__HOST__"} 0
+		# HELP loki_write_circuit_breaker_transitions_total Number of times the circuit breaker of the client changed state, by new state.
+		# TYPE loki_write_circuit_breaker_transitions_total counter
+		loki_write_circuit_breaker_transitions_total{host="__HOST__",state="closed"} 1
+		loki_write_circuit_breaker_transitions_total{host="__HOST__",state="half-open"} 1
+		loki_write_circuit_breaker_transitions_total{host="__HOST__",state="open"} 1
+		# HELP loki_write_sent_entries_total Number of log entries sent to the ingester.
+		# TYPE loki_write_sent_entries_total counter
+		loki_write_sent_entries_total{host="__HOST__"} 1
+	`, "__HOST__", serverURL.Host, -1)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expectedMetrics),
+		"loki_write_circuit_breaker_state", "loki_write_circuit_breaker_transitions_total", "loki_write_sent_entries_total"))
+}
@@ -17,7 +17,6 @@ import (
 	"github.com/grafana/agent/internal/useragent"
 	"github.com/grafana/dskit/backoff"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 
 	"github.com/grafana/agent/internal/component/common/loki"
@@ -33,19 +32,31 @@ const (
 	// pipeline stages
 	ReservedLabelTenantID = "__tenant_id__"
 
-	LatencyLabel = "filename"
-	HostLabel    = "host"
-	ClientLabel  = "client"
-	TenantLabel  = "tenant"
-	ReasonLabel  = "reason"
+	LatencyLabel  = "filename"
+	HostLabel     = "host"
+	ClientLabel   = "client"
+	TenantLabel   = "tenant"
+	ReasonLabel   = "reason"
+	ProtocolLabel = "protocol"
 
 	ReasonGeneric       = "ingester_error"
 	ReasonRateLimited   = "rate_limited"
 	ReasonStreamLimited = "stream_limited"
 	ReasonLineTooLong   = "line_too_long"
+	// ReasonRequestTooLarge is the reason of entries which didn't fit in a
+	// push request of at most max_request_bytes on their own.
+	ReasonRequestTooLarge = "request_too_large"
+	// Reasons of entries whose labels violate the label limits of the client.
+	ReasonTooManyLabels     = "too_many_labels"
+	ReasonInvalidLabelName  = "invalid_label_name"
+	ReasonLabelNameTooLong  = "label_name_too_long"
+	ReasonLabelValueTooLong = "label_value_too_long"
 )
 
-var Reasons = []string{ReasonGeneric, ReasonRateLimited, ReasonStreamLimited, ReasonLineTooLong}
+var Reasons = []string{
+	ReasonGeneric, ReasonRateLimited, ReasonStreamLimited, ReasonLineTooLong, ReasonRequestTooLarge,
+	ReasonTooManyLabels, ReasonInvalidLabelName, ReasonLabelNameTooLong, ReasonLabelValueTooLong,
+}
 
 var userAgent = useragent.Get()
 
@@ -58,7 +69,15 @@ type Metrics struct {
 	mutatedEntries               *prometheus.CounterVec
 	mutatedBytes                 *prometheus.CounterVec
 	requestDuration              *prometheus.HistogramVec
+	requests                     *prometheus.CounterVec
 	batchRetries                 *prometheus.CounterVec
+	externalLabelsConflicts      *prometheus.CounterVec
+	rejectedEntries              *prometheus.CounterVec
+	dedupedEntries               *prometheus.CounterVec
+	circuitBreakerState          *prometheus.GaugeVec
+	circuitBreakerTransitions    *prometheus.CounterVec
+	lastSuccessfulPush           *prometheus.GaugeVec
+	lastPushError                *prometheus.GaugeVec
 	countersWithHost             []*prometheus.CounterVec
 	countersWithHostTenant       []*prometheus.CounterVec
 	countersWithHostTenantReason []*prometheus.CounterVec
@@ -99,13 +118,45 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 		Name: "loki_write_request_duration_seconds",
 		Help: "Duration of send requests.",
 	}, []string{"status_code", HostLabel})
+	m.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_write_requests_total",
+		Help: "Number of send requests, by push protocol.",
+	}, []string{"status_code", HostLabel, ProtocolLabel})
 	m.batchRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "loki_write_batch_retries_total",
 		Help: "Number of times batches has had to be retried.",
 	}, []string{HostLabel, TenantLabel})
+	m.externalLabelsConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_write_external_labels_conflicts_total",
+		Help: "Number of log entries which set a label from external_labels to a different value. The entry's value is kept.",
+	}, []string{HostLabel})
+	m.rejectedEntries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_write_rejected_entries_total",
+		Help: "Number of log entries a client didn't accept before the deadline of a synchronous append.",
+	}, []string{HostLabel})
+	m.dedupedEntries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_write_deduplicated_entries_total",
+		Help: "Number of log entries not sent to a client because they duplicate an entry received within the deduplication window.",
+	}, []string{"client"})
+	m.circuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "loki_write_circuit_breaker_state",
+		Help: "State of the circuit breaker of the client: 0 for closed, 1 for open and 2 for half-open.",
+	}, []string{HostLabel})
+	m.circuitBreakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "loki_write_circuit_breaker_transitions_total",
+		Help: "Number of times the circuit breaker of the client changed state, by new state.",
+	}, []string{HostLabel, "state"})
+	m.lastSuccessfulPush = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "loki_write_last_successful_push_timestamp_seconds",
+		Help: "Unix timestamp of the last push request accepted by the endpoint, or 0 if none was.",
+	}, []string{HostLabel})
+	m.lastPushError = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "loki_write_last_push_error_timestamp_seconds",
+		Help: "Unix timestamp of the last push request which failed, including retried requests, or 0 if none did.",
+	}, []string{HostLabel})
 
 	m.countersWithHost = []*prometheus.CounterVec{
-		m.encodedBytes, m.sentBytes, m.sentEntries,
+		m.encodedBytes, m.sentBytes, m.sentEntries, m.externalLabelsConflicts,
 	}
 
 	m.countersWithHostTenant = []*prometheus.CounterVec{
@@ -125,12 +176,33 @@ func NewMetrics(reg prometheus.Registerer) *Metrics {
 		m.mutatedEntries = util.MustRegisterOrGet(reg, m.mutatedEntries).(*prometheus.CounterVec)
 		m.mutatedBytes = util.MustRegisterOrGet(reg, m.mutatedBytes).(*prometheus.CounterVec)
 		m.requestDuration = util.MustRegisterOrGet(reg, m.requestDuration).(*prometheus.HistogramVec)
+		m.requests = util.MustRegisterOrGet(reg, m.requests).(*prometheus.CounterVec)
 		m.batchRetries = util.MustRegisterOrGet(reg, m.batchRetries).(*prometheus.CounterVec)
+		m.externalLabelsConflicts = util.MustRegisterOrGet(reg, m.externalLabelsConflicts).(*prometheus.CounterVec)
+		m.rejectedEntries = util.MustRegisterOrGet(reg, m.rejectedEntries).(*prometheus.CounterVec)
+		m.dedupedEntries = util.MustRegisterOrGet(reg, m.dedupedEntries).(*prometheus.CounterVec)
+		m.circuitBreakerState = util.MustRegisterOrGet(reg, m.circuitBreakerState).(*prometheus.GaugeVec)
+		m.circuitBreakerTransitions = util.MustRegisterOrGet(reg, m.circuitBreakerTransitions).(*prometheus.CounterVec)
+		m.lastSuccessfulPush = util.MustRegisterOrGet(reg, m.lastSuccessfulPush).(*prometheus.GaugeVec)
+		m.lastPushError = util.MustRegisterOrGet(reg, m.lastPushError).(*prometheus.GaugeVec)
 	}
 
 	return &m
 }
 
+// observeOversized counts the entries truncated or dropped because they
+// didn't fit in a push request on their own.
+func (m *Metrics) observeOversized(host, tenant string, oversized oversizedEntries) {
+	if oversized.truncatedEntries > 0 {
+		m.mutatedEntries.WithLabelValues(host, tenant, ReasonRequestTooLarge).Add(float64(oversized.truncatedEntries))
+		m.mutatedBytes.WithLabelValues(host, tenant, ReasonRequestTooLarge).Add(float64(oversized.truncatedBytes))
+	}
+	if oversized.droppedEntries > 0 {
+		m.droppedEntries.WithLabelValues(host, tenant, ReasonRequestTooLarge).Add(float64(oversized.droppedEntries))
+		m.droppedBytes.WithLabelValues(host, tenant, ReasonRequestTooLarge).Add(float64(oversized.droppedBytes))
+	}
+}
+
 // Client pushes entries to Loki and can be stopped
 type Client interface {
 	loki.EntryHandler
@@ -152,6 +224,12 @@ type client struct {
 	wg   sync.WaitGroup
 
 	externalLabels model.LabelSet
+	protocol       string
+	tenants        *tenantLabels
+	breaker        *circuitBreaker
+	sampler        batchSampler
+	drops          dropSampler
+	pushes         *pushRecorder
 
 	// ctx is used in any upstream calls from the `client`.
 	ctx                 context.Context
@@ -177,6 +255,11 @@ func newClient(metrics *Metrics, cfg Config, maxStreams, maxLineSize int, maxLin
 		return nil, errors.New("metrics must be instantiated")
 	}
 
+	protocol, err := protocolOf(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	c := &client{
@@ -187,6 +270,8 @@ func newClient(metrics *Metrics, cfg Config, maxStreams, maxLineSize int, maxLin
 		name:    GetClientName(cfg),
 
 		externalLabels:      cfg.ExternalLabels.LabelSet,
+		protocol:            protocol,
+		tenants:             newTenantLabels(cfg.MaxTenants),
 		ctx:                 ctx,
 		cancel:              cancel,
 		maxStreams:          maxStreams,
@@ -196,24 +281,24 @@ func newClient(metrics *Metrics, cfg Config, maxStreams, maxLineSize int, maxLin
 	if cfg.Name != "" {
 		c.name = cfg.Name
 	}
+	c.breaker = newClientCircuitBreaker(cfg, metrics, c.logger)
 
-	err := cfg.Client.Validate()
+	err = cfg.Client.Validate()
 	if err != nil {
 		return nil, err
 	}
 
-	c.client, err = config.NewClientFromConfig(cfg.Client, "GrafanaAgent", config.WithHTTP2Disabled())
+	c.client, err = newHTTPClient(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	c.client.Timeout = cfg.Timeout
-
 	// Initialize counters to 0 so the metrics are exported before the first
 	// occurrence of incrementing to avoid missing metrics.
 	for _, counter := range c.metrics.countersWithHost {
 		counter.WithLabelValues(c.cfg.URL.Host).Add(0)
 	}
+	c.pushes = newPushRecorder(c.cfg.URL.Host, c.metrics)
 
 	c.wg.Add(1)
 	go c.run()
@@ -239,12 +324,12 @@ func (c *client) initBatchMetrics(tenantID string) {
 	// occurrence of incrementing to avoid missing metrics.
 	for _, counter := range c.metrics.countersWithHostTenantReason {
 		for _, reason := range Reasons {
-			counter.WithLabelValues(c.cfg.URL.Host, tenantID, reason).Add(0)
+			counter.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), reason).Add(0)
 		}
 	}
 
 	for _, counter := range c.metrics.countersWithHostTenant {
-		counter.WithLabelValues(c.cfg.URL.Host, tenantID).Add(0)
+		counter.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID)).Add(0)
 	}
 }
 
@@ -283,18 +368,26 @@ func (c *client) run() {
 			}
 
 			e, tenantID := c.processEntry(e)
+			if c.cfg.StripStructuredMetadata {
+				e.StructuredMetadata = nil
+			}
+
+			if e.Labels, ok = applyLabelLimits(c.cfg, c.metrics, c.tenants, &c.drops, tenantID, e.Labels, entrySize(e.Entry)); !ok {
+				break
+			}
 
-			// Either drop or mutate the log entry because its length is greater than maxLineSize. maxLineSize == 0 means disabled.
-			if c.maxLineSize != 0 && len(e.Line) > c.maxLineSize {
-				if !c.maxLineSizeTruncate {
-					c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonLineTooLong).Inc()
-					c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonLineTooLong).Add(float64(len(e.Line)))
+			// Either drop or mutate the log entry because its size, structured metadata included, is greater than
+			// maxLineSize. maxLineSize == 0 means disabled.
+			if size := entrySize(e.Entry); c.maxLineSize != 0 && size > c.maxLineSize {
+				if !c.maxLineSizeTruncate || !truncateLine(&e.Entry, c.maxLineSize) {
+					c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonLineTooLong).Inc()
+					c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonLineTooLong).Add(float64(size))
+					c.drops.observe(ReasonLineTooLong, labelsMapToString(e.Labels, ReservedLabelTenantID), 1)
 					break
 				}
 
-				c.metrics.mutatedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonLineTooLong).Inc()
-				c.metrics.mutatedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonLineTooLong).Add(float64(len(e.Line) - c.maxLineSize))
-				e.Line = e.Line[:c.maxLineSize]
+				c.metrics.mutatedEntries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonLineTooLong).Inc()
+				c.metrics.mutatedBytes.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonLineTooLong).Add(float64(size - c.maxLineSize))
 			}
 
 			batch, ok := batches[tenantID]
@@ -323,8 +416,9 @@ func (c *client) run() {
 				if err.Error() == errMaxStreamsLimitExceeded {
 					reason = ReasonStreamLimited
 				}
-				c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, reason).Add(float64(len(e.Line)))
-				c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, reason).Inc()
+				c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), reason).Add(float64(entrySize(e.Entry)))
+				c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), reason).Inc()
+				c.drops.observe(reason, labelsMapToString(e.Labels, ReservedLabelTenantID), 1)
 				return
 			}
 		case <-maxWaitCheck.C:
@@ -350,28 +444,53 @@ func batchIsRateLimited(status int) bool {
 }
 
 func (c *client) sendBatch(tenantID string, batch *batch) {
-	buf, entriesCount, err := batch.encode()
+	c.sampler.observe(tenantID, batch)
+
+	requests, oversized, err := encodeRequests(c.protocol, batch, c.cfg.MaxRequestBytes, c.maxLineSizeTruncate)
 	if err != nil {
 		level.Error(c.logger).Log("msg", "error encoding batch", "error", err)
 		return
 	}
+	c.metrics.observeOversized(c.cfg.URL.Host, c.tenants.label(tenantID), oversized)
+	c.drops.observeOversized(oversized)
+
+	for _, req := range requests {
+		c.sendRequest(tenantID, req)
+	}
+}
+
+// sendRequest sends an encoded push request, retrying on failures.
+func (c *client) sendRequest(tenantID string, req encodedRequest) {
+	buf, entriesCount := req.buf, req.entries
 	bufBytes := float64(len(buf))
 	c.metrics.encodedBytes.WithLabelValues(c.cfg.URL.Host).Add(bufBytes)
 
 	backoff := backoff.New(c.ctx, c.cfg.BackoffConfig)
-	var status int
+	var (
+		status int
+		err    error
+	)
 	for {
+		// Wait while the circuit breaker is open, without counting retries.
+		if err = c.breaker.acquire(c.ctx); err != nil {
+			break
+		}
+
 		start := time.Now()
 		// send uses `timeout` internally, so `context.Background` is good enough.
 		status, err = c.send(context.Background(), tenantID, buf)
+		c.breaker.record(requestFailed(status, err))
+		c.pushes.record(time.Now(), err)
 
 		c.metrics.requestDuration.WithLabelValues(strconv.Itoa(status), c.cfg.URL.Host).Observe(time.Since(start).Seconds())
+		c.metrics.requests.WithLabelValues(strconv.Itoa(status), c.cfg.URL.Host, c.protocol).Inc()
 
 		// Immediately drop rate limited batches to avoid HOL blocking for other tenants not experiencing throttling
 		if c.cfg.DropRateLimitedBatches && batchIsRateLimited(status) {
 			level.Warn(c.logger).Log("msg", "dropping batch due to rate limiting applied at ingester")
-			c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonRateLimited).Add(bufBytes)
-			c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonRateLimited).Add(float64(entriesCount))
+			c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonRateLimited).Add(bufBytes)
+			c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonRateLimited).Add(float64(entriesCount))
+			c.drops.observeRequest(ReasonRateLimited, req)
 			return
 		}
 
@@ -388,7 +507,7 @@ func (c *client) sendBatch(tenantID string, batch *batch) {
 		}
 
 		level.Warn(c.logger).Log("msg", "error sending batch, will retry", "status", status, "tenant", tenantID, "error", err)
-		c.metrics.batchRetries.WithLabelValues(c.cfg.URL.Host, tenantID).Inc()
+		c.metrics.batchRetries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID)).Inc()
 		backoff.Wait()
 
 		// Make sure it sends at least once before checking for retry.
@@ -405,8 +524,9 @@ func (c *client) sendBatch(tenantID string, batch *batch) {
 		if batchIsRateLimited(status) {
 			dropReason = ReasonRateLimited
 		}
-		c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, dropReason).Add(bufBytes)
-		c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, dropReason).Add(float64(entriesCount))
+		c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), dropReason).Add(bufBytes)
+		c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), dropReason).Add(float64(entriesCount))
+		c.drops.observeRequest(dropReason, req)
 	}
 }
 
@@ -454,6 +574,18 @@ func (c *client) send(ctx context.Context, tenantID string, buf []byte) (int, er
 	return resp.StatusCode, err
 }
 
+// probe implements probingClient.
+func (c *client) probe(ctx context.Context, timeout time.Duration) error {
+	buf, _, err := encodeBatch(c.protocol, newBatch(0))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, err = c.send(ctx, c.cfg.TenantID, buf)
+	return err
+}
+
 func (c *client) getTenantID(labels model.LabelSet) string {
 	// Check if it has been overridden while processing the pipeline stages
 	if value, ok := labels[ReservedLabelTenantID]; ok {
@@ -484,13 +616,54 @@ func (c *client) StopNow() {
 }
 
 func (c *client) processEntry(e loki.Entry) (loki.Entry, string) {
-	if len(c.externalLabels) > 0 {
-		e.Labels = c.externalLabels.Merge(e.Labels)
+	var conflict bool
+	e.Labels, conflict = mergeExternalLabels(c.externalLabels, e.Labels)
+	if conflict {
+		c.metrics.externalLabelsConflicts.WithLabelValues(c.cfg.URL.Host).Inc()
 	}
 	tenantID := c.getTenantID(e.Labels)
 	return e, tenantID
 }
 
+// mergeExternalLabels adds external labels to lbs. Labels already set on lbs
+// take precedence; conflict reports whether any external label was
+// overridden this way.
+//
+// External labels are applied when sending rather than when writing to the
+// WAL, so changing them never requires the WAL to be replayed.
+func mergeExternalLabels(external, lbs model.LabelSet) (merged model.LabelSet, conflict bool) {
+	if len(external) == 0 {
+		return lbs, false
+	}
+	for name, value := range external {
+		if v, ok := lbs[name]; ok && v != value {
+			conflict = true
+			break
+		}
+	}
+	return external.Merge(lbs), conflict
+}
+
 func (c *client) Name() string {
 	return c.name
 }
+
+func (c *client) circuitBreakerState() CircuitBreakerState {
+	return c.breaker.currentState()
+}
+
+func (c *client) sampleBatches(n int) {
+	c.sampler.start(n)
+}
+
+func (c *client) batchSamples() ([]BatchSample, int) {
+	return c.sampler.state()
+}
+
+func (c *client) takeDropSamples() []DropSample {
+	return c.drops.take()
+}
+
+func (c *client) pushTimes() PushTimes {
+	return c.pushes.get()
+}
@@ -3,7 +3,9 @@ package client
 import (
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
@@ -20,6 +22,7 @@ import (
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 
 	"github.com/grafana/agent/internal/component/common/loki"
 	"github.com/grafana/loki/clients/pkg/promtail/utils"
@@ -88,18 +91,21 @@ func TestClient_Handle(t *testing.T) {
                                loki_write_dropped_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                                loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                                loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                               loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                                loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                                # HELP loki_write_mutated_entries_total The total number of log entries that have been mutated.
                                # TYPE loki_write_mutated_entries_total counter
                                loki_write_mutated_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                                loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                                loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                               loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                                loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                                # HELP loki_write_mutated_bytes_total The total number of bytes that have been mutated.
                                # TYPE loki_write_mutated_bytes_total counter
                                loki_write_mutated_bytes_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                                loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                                loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                               loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                                loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                        `,
 		},
@@ -126,18 +132,21 @@ func TestClient_Handle(t *testing.T) {
                                loki_write_dropped_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                                loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 1
                                loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                               loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                                loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                                # HELP loki_write_mutated_entries_total The total number of log entries that have been mutated.
                                # TYPE loki_write_mutated_entries_total counter
                                loki_write_mutated_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                                loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                                loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                               loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                                loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_bytes_total The total number of bytes that have been mutated.
                               # TYPE loki_write_mutated_bytes_total counter
                               loki_write_mutated_bytes_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                        `,
 		},
@@ -171,18 +180,21 @@ func TestClient_Handle(t *testing.T) {
                                loki_write_dropped_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                                loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                                loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                               loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                                loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                                # HELP loki_write_mutated_entries_total The total number of log entries that have been mutated.
                                # TYPE loki_write_mutated_entries_total counter
                                loki_write_mutated_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                                loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 1
                                loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                               loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                                loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_bytes_total The total number of bytes that have been mutated.
                               # TYPE loki_write_mutated_bytes_total counter
                               loki_write_mutated_bytes_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant=""} 4
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                        `,
 		},
@@ -213,18 +225,21 @@ func TestClient_Handle(t *testing.T) {
                               loki_write_dropped_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_entries_total The total number of log entries that have been mutated.
                               # TYPE loki_write_mutated_entries_total counter
                               loki_write_mutated_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_bytes_total The total number of bytes that have been mutated.
                               # TYPE loki_write_mutated_bytes_total counter
                               loki_write_mutated_bytes_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                        `,
 		},
@@ -254,18 +269,21 @@ func TestClient_Handle(t *testing.T) {
                               loki_write_dropped_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 1
                               loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_entries_total The total number of log entries that have been mutated.
                               # TYPE loki_write_mutated_entries_total counter
                               loki_write_mutated_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_bytes_total The total number of bytes that have been mutated.
                               # TYPE loki_write_mutated_bytes_total counter
                               loki_write_mutated_bytes_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_sent_entries_total Number of log entries sent to the ingester.
                               # TYPE loki_write_sent_entries_total counter
@@ -290,18 +308,21 @@ func TestClient_Handle(t *testing.T) {
                               loki_write_dropped_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 1
                               loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_entries_total The total number of log entries that have been mutated.
                               # TYPE loki_write_mutated_entries_total counter
                               loki_write_mutated_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_bytes_total The total number of bytes that have been mutated.
                               # TYPE loki_write_mutated_bytes_total counter
                               loki_write_mutated_bytes_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_sent_entries_total Number of log entries sent to the ingester.
                               # TYPE loki_write_sent_entries_total counter
@@ -334,18 +355,21 @@ func TestClient_Handle(t *testing.T) {
                               loki_write_dropped_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 1
+                              loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_entries_total The total number of log entries that have been mutated.
                               # TYPE loki_write_mutated_entries_total counter
                               loki_write_mutated_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_bytes_total The total number of bytes that have been mutated.
                               # TYPE loki_write_mutated_bytes_total counter
                               loki_write_mutated_bytes_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_sent_entries_total Number of log entries sent to the ingester.
                               # TYPE loki_write_sent_entries_total counter
@@ -371,18 +395,21 @@ func TestClient_Handle(t *testing.T) {
                               loki_write_dropped_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 1
+                              loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_entries_total The total number of log entries that have been mutated.
                               # TYPE loki_write_mutated_entries_total counter
                               loki_write_mutated_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_mutated_bytes_total The total number of bytes that have been mutated.
                               # TYPE loki_write_mutated_bytes_total counter
                               loki_write_mutated_bytes_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_sent_entries_total Number of log entries sent to the ingester.
                               # TYPE loki_write_sent_entries_total counter
@@ -411,18 +438,21 @@ func TestClient_Handle(t *testing.T) {
                               loki_write_dropped_entries_total{host="__HOST__", reason="ingester_error", tenant="tenant-default"} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant="tenant-default"} 0
                               loki_write_dropped_entries_total{host="__HOST__", reason="rate_limited", tenant="tenant-default"} 0
+                              loki_write_dropped_entries_total{host="__HOST__", reason="request_too_large", tenant="tenant-default"} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant="tenant-default"} 0
                               # HELP loki_write_mutated_entries_total The total number of log entries that have been mutated.
                               # TYPE loki_write_mutated_entries_total counter
                               loki_write_mutated_entries_total{host="__HOST__",reason="ingester_error",tenant="tenant-default"} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant="tenant-default"} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant="tenant-default"} 0
+                              loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant="tenant-default"} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant="tenant-default"} 0
                               # HELP loki_write_mutated_bytes_total The total number of bytes that have been mutated.
                               # TYPE loki_write_mutated_bytes_total counter
                               loki_write_mutated_bytes_total{host="__HOST__",reason="ingester_error",tenant="tenant-default"} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant="tenant-default"} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant="tenant-default"} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant="tenant-default"} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant="tenant-default"} 0
                        `,
 		},
@@ -460,8 +490,11 @@ func TestClient_Handle(t *testing.T) {
                               loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant="tenant-2"} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant="tenant-default"} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant="tenant-1"} 0
+                              loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant="tenant-1"} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant="tenant-2"} 0
+                              loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant="tenant-2"} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant="tenant-default"} 0
+                              loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant="tenant-default"} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant="tenant-1"} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant="tenant-2"} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant="tenant-default"} 0
@@ -474,8 +507,11 @@ func TestClient_Handle(t *testing.T) {
                               loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant="tenant-2"} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="line_too_long",tenant="tenant-default"} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant="tenant-1"} 0
+                              loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant="tenant-1"} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant="tenant-2"} 0
+                              loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant="tenant-2"} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="rate_limited",tenant="tenant-default"} 0
+                              loki_write_mutated_entries_total{host="__HOST__",reason="request_too_large",tenant="tenant-default"} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant="tenant-1"} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant="tenant-2"} 0
                               loki_write_mutated_entries_total{host="__HOST__",reason="stream_limited",tenant="tenant-default"} 0
@@ -488,8 +524,11 @@ func TestClient_Handle(t *testing.T) {
                               loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant="tenant-2"} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="line_too_long",tenant="tenant-default"} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant="tenant-1"} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant="tenant-1"} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant="tenant-2"} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant="tenant-2"} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="rate_limited",tenant="tenant-default"} 0
+                              loki_write_mutated_bytes_total{host="__HOST__",reason="request_too_large",tenant="tenant-default"} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant="tenant-1"} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant="tenant-2"} 0
                               loki_write_mutated_bytes_total{host="__HOST__",reason="stream_limited",tenant="tenant-default"} 0
@@ -609,6 +648,7 @@ func TestClient_StopNow(t *testing.T) {
                               loki_write_dropped_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 0
+                              loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                        `,
 		},
@@ -631,6 +671,7 @@ func TestClient_StopNow(t *testing.T) {
                               loki_write_dropped_entries_total{host="__HOST__",reason="ingester_error",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="line_too_long",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="rate_limited",tenant=""} 1
+                              loki_write_dropped_entries_total{host="__HOST__",reason="request_too_large",tenant=""} 0
                               loki_write_dropped_entries_total{host="__HOST__",reason="stream_limited",tenant=""} 0
                               # HELP loki_write_sent_entries_total Number of log entries sent to the ingester.
                               # TYPE loki_write_sent_entries_total counter
@@ -715,6 +756,367 @@ func TestClient_StopNow(t *testing.T) {
 	}
 }
 
+func TestClient_ExternalLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	receivedReqsChan := make(chan utils.RemoteWriteRequest, 10)
+	server := utils.NewRemoteWriteServer(receivedReqsChan, 200)
+	require.NotNil(t, server)
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	cfg := Config{
+		URL:           serverURL,
+		BatchWait:     100 * time.Millisecond,
+		BatchSize:     1024,
+		Client:        config.HTTPClientConfig{},
+		BackoffConfig: backoff.Config{MinBackoff: 1 * time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxRetries: 1},
+		ExternalLabels: lokiflag.LabelSet{LabelSet: model.LabelSet{
+			"cluster": "prod",
+			"region":  "eu",
+		}},
+		Timeout: 1 * time.Second,
+	}
+
+	c, err := New(NewMetrics(reg), cfg, 0, 0, false, log.NewNopLogger())
+	require.NoError(t, err)
+
+	entry := logproto.Entry{Timestamp: time.Unix(1, 0).UTC(), Line: "line"}
+	c.Chan() <- loki.Entry{Labels: model.LabelSet{"app": "foo"}, Entry: entry}
+	c.Chan() <- loki.Entry{Labels: model.LabelSet{"app": "bar", "cluster": "dev"}, Entry: entry}
+	c.Stop()
+	close(receivedReqsChan)
+
+	var streams []string
+	for req := range receivedReqsChan {
+		for _, s := range req.Request.Streams {
+			streams = append(streams, s.Labels)
+		}
+	}
+	require.ElementsMatch(t, []string{
+		`{app="foo", cluster="prod", region="eu"}`,
+		`{app="bar", cluster="dev", region="eu"}`,
+	}, streams)
+
+	expectedMetrics := strings.Replace(`
+		# HELP loki_write_external_labels_conflicts_total Number of log entries which set a label from external_labels to a different value. The entry's value is kept.
+		# TYPE loki_write_external_labels_conflicts_total counter
+		loki_write_external_labels_conflicts_total{host="__HOST__"} 1
+	`, "__HOST__", serverURL.Host, -1)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expectedMetrics), "loki_write_external_labels_conflicts_total"))
+}
+
+func TestClient_StructuredMetadata(t *testing.T) {
+	traceID := push.LabelsAdapter{{Name: "trace_id", Value: "12345"}} // 17 bytes once encoded
+
+	tests := map[string]struct {
+		strip           bool
+		maxLineSize     int
+		input           logproto.Entry
+		expected        []logproto.Entry
+		expectedMutated float64
+		expectedDropped float64
+	}{
+		"structured metadata is sent": {
+			input:    logproto.Entry{Timestamp: time.Unix(1, 0).UTC(), Line: "line", StructuredMetadata: traceID},
+			expected: []logproto.Entry{{Timestamp: time.Unix(1, 0).UTC(), Line: "line", StructuredMetadata: traceID}},
+		},
+		"structured metadata is stripped": {
+			strip:    true,
+			input:    logproto.Entry{Timestamp: time.Unix(1, 0).UTC(), Line: "line", StructuredMetadata: traceID},
+			expected: []logproto.Entry{{Timestamp: time.Unix(1, 0).UTC(), Line: "line"}},
+		},
+		"structured metadata counts towards the max line size": {
+			maxLineSize:     20,
+			input:           logproto.Entry{Timestamp: time.Unix(1, 0).UTC(), Line: "line0123456789", StructuredMetadata: traceID},
+			expected:        []logproto.Entry{{Timestamp: time.Unix(1, 0).UTC(), Line: "lin", StructuredMetadata: traceID}},
+			expectedMutated: 11,
+		},
+		"entries whose structured metadata exceeds the max line size are dropped": {
+			maxLineSize:     10,
+			input:           logproto.Entry{Timestamp: time.Unix(1, 0).UTC(), Line: "line", StructuredMetadata: traceID},
+			expectedDropped: 21,
+		},
+		"stripped structured metadata doesn't count towards the max line size": {
+			strip:       true,
+			maxLineSize: 10,
+			input:       logproto.Entry{Timestamp: time.Unix(1, 0).UTC(), Line: "line", StructuredMetadata: traceID},
+			expected:    []logproto.Entry{{Timestamp: time.Unix(1, 0).UTC(), Line: "line"}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			receivedReqsChan := make(chan utils.RemoteWriteRequest, 10)
+			server := utils.NewRemoteWriteServer(receivedReqsChan, 200)
+			require.NotNil(t, server)
+			defer server.Close()
+
+			serverURL := flagext.URLValue{}
+			require.NoError(t, serverURL.Set(server.URL))
+
+			cfg := Config{
+				URL:                     serverURL,
+				BatchWait:               100 * time.Millisecond,
+				BatchSize:               1024,
+				Client:                  config.HTTPClientConfig{},
+				BackoffConfig:           backoff.Config{MinBackoff: 1 * time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxRetries: 1},
+				Timeout:                 1 * time.Second,
+				StripStructuredMetadata: tc.strip,
+			}
+
+			c, err := New(NewMetrics(prometheus.NewRegistry()), cfg, 0, tc.maxLineSize, true, log.NewNopLogger())
+			require.NoError(t, err)
+
+			c.Chan() <- loki.Entry{Labels: model.LabelSet{"app": "foo"}, Entry: tc.input}
+			c.Stop()
+			close(receivedReqsChan)
+
+			var received []logproto.Entry
+			for req := range receivedReqsChan {
+				for _, s := range req.Request.Streams {
+					received = append(received, s.Entries...)
+				}
+			}
+			require.Equal(t, tc.expected, received)
+
+			metrics := c.(*client).metrics
+			require.Equal(t, tc.expectedMutated, testutil.ToFloat64(metrics.mutatedBytes.WithLabelValues(serverURL.Host, "", ReasonLineTooLong)))
+			require.Equal(t, tc.expectedDropped, testutil.ToFloat64(metrics.droppedBytes.WithLabelValues(serverURL.Host, "", ReasonLineTooLong)))
+		})
+	}
+}
+
+func TestClient_InterleavedTenants(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	receivedReqsChan := make(chan utils.RemoteWriteRequest, 10)
+	server := utils.NewRemoteWriteServer(receivedReqsChan, 200)
+	require.NotNil(t, server)
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	cfg := Config{
+		URL:           serverURL,
+		BatchWait:     100 * time.Millisecond,
+		BatchSize:     1024,
+		Client:        config.HTTPClientConfig{},
+		BackoffConfig: backoff.Config{MinBackoff: 1 * time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxRetries: 1},
+		Timeout:       1 * time.Second,
+		TenantID:      "default",
+		MaxTenants:    2,
+	}
+
+	c, err := New(NewMetrics(reg), cfg, 0, 0, false, log.NewNopLogger())
+	require.NoError(t, err)
+
+	for i, tenant := range []model.LabelValue{"", "tenant-1", "", "tenant-2", "tenant-1", "tenant-3"} {
+		lbs := model.LabelSet{"app": "foo"}
+		if tenant != "" {
+			lbs[ReservedLabelTenantID] = tenant
+		}
+		c.Chan() <- loki.Entry{Labels: lbs, Entry: logproto.Entry{Timestamp: time.Unix(int64(i), 0).UTC(), Line: fmt.Sprintf("line%d", i)}}
+	}
+	c.Stop()
+	close(receivedReqsChan)
+
+	linesByTenant := map[string][]string{}
+	for req := range receivedReqsChan {
+		for _, s := range req.Request.Streams {
+			require.Equal(t, `{app="foo"}`, s.Labels)
+			for _, e := range s.Entries {
+				linesByTenant[req.TenantID] = append(linesByTenant[req.TenantID], e.Line)
+			}
+		}
+	}
+	require.Equal(t, map[string][]string{
+		"default":  {"line0", "line2"},
+		"tenant-1": {"line1", "line4"},
+		"tenant-2": {"line3"},
+		"tenant-3": {"line5"},
+	}, linesByTenant)
+
+	// Only the first two tenants get their own series, the others are
+	// reported as overflow.
+	expectedMetrics := strings.Replace(`
+		# HELP loki_write_batch_retries_total Number of times batches has had to be retried.
+		# TYPE loki_write_batch_retries_total counter
+		loki_write_batch_retries_total{host="__HOST__",tenant="default"} 0
+		loki_write_batch_retries_total{host="__HOST__",tenant="tenant-1"} 0
+		loki_write_batch_retries_total{host="__HOST__",tenant="__overflow__"} 0
+	`, "__HOST__", serverURL.Host, -1)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expectedMetrics), "loki_write_batch_retries_total"))
+}
+
+func TestClient_MaxRequestBytes(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	receivedReqsChan := make(chan utils.RemoteWriteRequest, 10)
+	server := utils.NewRemoteWriteServer(receivedReqsChan, 200)
+	require.NotNil(t, server)
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	cfg := Config{
+		URL:             serverURL,
+		BatchWait:       100 * time.Millisecond,
+		BatchSize:       10 * 1024,
+		MaxRequestBytes: 1000,
+		Client:          config.HTTPClientConfig{},
+		BackoffConfig:   backoff.Config{MinBackoff: 1 * time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxRetries: 1},
+		Timeout:         1 * time.Second,
+	}
+
+	c, err := New(NewMetrics(reg), cfg, 0, 0, false, log.NewNopLogger())
+	require.NoError(t, err)
+
+	// Both entries fit in the batch, but not in a single request.
+	rnd := rand.New(rand.NewSource(1))
+	lines := []string{randomLine(rnd, 600), randomLine(rnd, 600)}
+	for i, line := range lines {
+		c.Chan() <- loki.Entry{
+			Labels: model.LabelSet{"app": model.LabelValue(fmt.Sprintf("app-%d", i))},
+			Entry:  logproto.Entry{Timestamp: time.Unix(int64(i), 0).UTC(), Line: line},
+		}
+	}
+	c.Stop()
+	close(receivedReqsChan)
+
+	var (
+		requests int
+		received []string
+	)
+	for req := range receivedReqsChan {
+		requests++
+		for _, s := range req.Request.Streams {
+			for _, e := range s.Entries {
+				received = append(received, e.Line)
+			}
+		}
+	}
+	require.Equal(t, 2, requests)
+	require.ElementsMatch(t, lines, received)
+	require.Equal(t, 2.0, testutil.ToFloat64(c.(*client).metrics.sentEntries.WithLabelValues(serverURL.Host)))
+}
+
+func TestClient_PushTimes(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// The first request fails and is retried.
+		if requests.Inc() == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	cfg := Config{
+		URL:           serverURL,
+		BatchWait:     10 * time.Millisecond,
+		BatchSize:     1024,
+		Client:        config.HTTPClientConfig{},
+		BackoffConfig: backoff.Config{MinBackoff: 1 * time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxRetries: 2},
+		Timeout:       1 * time.Second,
+	}
+
+	start := time.Now()
+	c, err := newClient(NewMetrics(reg), cfg, 0, 0, false, log.NewNopLogger())
+	require.NoError(t, err)
+
+	// Clients which never pushed export their series as 0.
+	expectedMetrics := strings.Replace(`
+		# HELP loki_write_last_push_error_timestamp_seconds Unix timestamp of the last push request which failed, including retried requests, or 0 if none did.
+		# TYPE loki_write_last_push_error_timestamp_seconds gauge
+		loki_write_last_push_error_timestamp_seconds{host="__HOST__"} 0
+		# HELP loki_write_last_successful_push_timestamp_seconds Unix timestamp of the last push request accepted by the endpoint, or 0 if none was.
+		# TYPE loki_write_last_successful_push_timestamp_seconds gauge
+		loki_write_last_successful_push_timestamp_seconds{host="__HOST__"} 0
+	`, "__HOST__", serverURL.Host, -1)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expectedMetrics),
+		"loki_write_last_push_error_timestamp_seconds", "loki_write_last_successful_push_timestamp_seconds"))
+	require.Equal(t, PushTimes{}, c.pushTimes())
+
+	c.Chan() <- loki.Entry{Labels: model.LabelSet{"app": "foo"}, Entry: logproto.Entry{Timestamp: time.Now(), Line: "line"}}
+	c.Stop()
+	require.Equal(t, int64(2), requests.Load())
+
+	times := c.pushTimes()
+	require.False(t, times.LastError.Before(start))
+	require.True(t, times.LastSuccess.After(times.LastError))
+
+	metrics := c.metrics
+	require.Equal(t, float64(times.LastError.UnixNano())/1e9, testutil.ToFloat64(metrics.lastPushError.WithLabelValues(serverURL.Host)))
+	require.Equal(t, float64(times.LastSuccess.UnixNano())/1e9, testutil.ToFloat64(metrics.lastSuccessfulPush.WithLabelValues(serverURL.Host)))
+
+	// Clients rebuilt on reload keep the times of the previous client.
+	c, err = newClient(metrics, cfg, 0, 0, false, log.NewNopLogger())
+	require.NoError(t, err)
+	defer c.Stop()
+	require.WithinDuration(t, times.LastSuccess, c.pushTimes().LastSuccess, time.Microsecond)
+	require.WithinDuration(t, times.LastError, c.pushTimes().LastError, time.Microsecond)
+	require.Equal(t, float64(times.LastSuccess.UnixNano())/1e9, testutil.ToFloat64(metrics.lastSuccessfulPush.WithLabelValues(serverURL.Host)))
+}
+
+func TestTenantLabels(t *testing.T) {
+	tl := newTenantLabels(2)
+	require.Equal(t, "a", tl.label("a"))
+	require.Equal(t, "b", tl.label("b"))
+	require.Equal(t, TenantOverflowLabelValue, tl.label("c"))
+	require.Equal(t, "a", tl.label("a"))
+
+	require.Equal(t, MaxTenants, newTenantLabels(0).max)
+}
+
+func TestMergeExternalLabels(t *testing.T) {
+	tests := map[string]struct {
+		external         model.LabelSet
+		labels           model.LabelSet
+		expected         model.LabelSet
+		expectedConflict bool
+	}{
+		"no external labels": {
+			labels:   model.LabelSet{"app": "foo"},
+			expected: model.LabelSet{"app": "foo"},
+		},
+		"external labels added": {
+			external: model.LabelSet{"cluster": "prod"},
+			labels:   model.LabelSet{"app": "foo"},
+			expected: model.LabelSet{"app": "foo", "cluster": "prod"},
+		},
+		"same value is not a conflict": {
+			external: model.LabelSet{"cluster": "prod"},
+			labels:   model.LabelSet{"app": "foo", "cluster": "prod"},
+			expected: model.LabelSet{"app": "foo", "cluster": "prod"},
+		},
+		"entry label wins on conflict": {
+			external:         model.LabelSet{"cluster": "prod", "region": "eu"},
+			labels:           model.LabelSet{"app": "foo", "cluster": "dev"},
+			expected:         model.LabelSet{"app": "foo", "cluster": "dev", "region": "eu"},
+			expectedConflict: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			merged, conflict := mergeExternalLabels(tc.external, tc.labels)
+			require.Equal(t, tc.expected, merged)
+			require.Equal(t, tc.expectedConflict, conflict)
+		})
+	}
+}
+
 type RoundTripperFunc func(*http.Request) (*http.Response, error)
 
 func (r RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
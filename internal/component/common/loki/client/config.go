@@ -19,6 +19,15 @@ const (
 	MaxBackoff     = 5 * time.Minute
 	MaxRetries int = 10
 	Timeout        = 10 * time.Second
+	MaxTenants int = 100
+
+	// Label limits applied by Loki by default.
+	MaxLabelNamesPerSeries int = 15
+	MaxLabelNameLength     int = 1024
+	MaxLabelValueLength    int = 2048
+
+	CircuitBreakerOpenDuration = 30 * time.Second
+	ProbeTimeout               = 5 * time.Second
 )
 
 // Config describes configuration for an HTTP pusher client.
@@ -28,6 +37,11 @@ type Config struct {
 	BatchWait time.Duration `yaml:"batchwait"`
 	BatchSize int           `yaml:"batchsize"`
 
+	// MaxRequestBytes is the maximum size of the encoded body of a push
+	// request. Larger batches are split into several requests. Zero means no
+	// limit.
+	MaxRequestBytes int `yaml:"max_request_bytes,omitempty"`
+
 	Client  config.HTTPClientConfig `yaml:",inline"`
 	Headers map[string]string       `yaml:"headers,omitempty"`
 
@@ -36,19 +50,62 @@ type Config struct {
 	ExternalLabels lokiflag.LabelSet `yaml:"external_labels,omitempty"`
 	Timeout        time.Duration     `yaml:"timeout"`
 
+	// DialTimeout, TLSHandshakeTimeout and ResponseHeaderTimeout bound the
+	// corresponding phase of each push request, which is bounded as a whole by
+	// Timeout. Zero means the phase is only bounded by Timeout, except for the
+	// TLS handshake which is always bounded to 10s by the transport.
+	DialTimeout           time.Duration `yaml:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout,omitempty"`
+
+	// Protocol used to push batches, either ProtocolLoki or
+	// ProtocolOTLPHTTP. Empty means ProtocolLoki.
+	Protocol string `yaml:"protocol,omitempty"`
+
 	// The tenant ID to use when pushing logs to Loki (empty string means
 	// single tenant mode)
 	TenantID string `yaml:"tenant_id"`
 
+	// MaxTenants is the number of distinct tenants reported in the tenant
+	// label of the client metrics. Entries of additional tenants are still
+	// sent, but are reported with the tenant label set to
+	// TenantOverflowLabelValue. Zero means MaxTenants.
+	MaxTenants int `yaml:"max_tenants,omitempty"`
+
 	// When enabled, Promtail will not retry batches that get a
 	// 429 'Too Many Requests' response from the distributor. Helps
 	// prevent HOL blocking in multitenant deployments.
 	DropRateLimitedBatches bool `yaml:"drop_rate_limited_batches"`
 
+	// StripStructuredMetadata removes the structured metadata of the entries
+	// before they're sent, for endpoints which don't support it.
+	StripStructuredMetadata bool `yaml:"strip_structured_metadata,omitempty"`
+
+	// LabelLimits validates the labels of each entry before it's sent.
+	LabelLimits LabelLimitsConfig `yaml:"label_limits,omitempty"`
+
+	// CircuitBreaker pauses sending to the endpoint after consecutive
+	// failures.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+
+	// Probe pushes a request without any entry to the endpoint when the
+	// client is created.
+	Probe ProbeConfig `yaml:"probe,omitempty"`
+
 	// Queue controls configuration parameters specific to the queue client
 	Queue QueueConfig
 }
 
+// CircuitBreakerConfig configures the circuit breaker of a client. Once
+// FailureThreshold consecutive requests failed with a server or connection
+// error, sends are paused for OpenDuration, after which a single probe request
+// decides whether sends resume or stay paused. Zero FailureThreshold disables
+// the circuit breaker.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold,omitempty"`
+	OpenDuration     time.Duration `yaml:"open_duration,omitempty"`
+}
+
 // QueueConfig holds configurations for the queue-based remote-write client.
 type QueueConfig struct {
 	// Capacity is the worst case size in bytes desired for the send queue. This value is used to calculate the size of
@@ -100,9 +157,10 @@ func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
 				MaxRetries: MaxRetries,
 				MinBackoff: MinBackoff,
 			},
-			BatchSize: BatchSize,
-			BatchWait: BatchWait,
-			Timeout:   Timeout,
+			BatchSize:   BatchSize,
+			BatchWait:   BatchWait,
+			Timeout:     Timeout,
+			LabelLimits: DefaultLabelLimitsConfig(),
 		}
 	}
 
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/grafana/agent/internal/component/common/loki"
+)
+
+// dedupKeySize approximates the memory held for each entry remembered by a
+// deduplicator, including the overhead of the map and the queue.
+const dedupKeySize = 64
+
+// DedupConfig configures the deduplication of the entries sent to the clients
+// of a Manager. Entries with the same labels, timestamp and line as an entry
+// received less than Window ago are suppressed.
+type DedupConfig struct {
+	Enabled bool
+	Window  time.Duration
+	// MaxSize bounds the approximate memory used to remember entries, in
+	// bytes. Once it's reached, the oldest entries are forgotten before the
+	// end of the window.
+	MaxSize int64
+}
+
+// dedupKey identifies an entry by the hash of its labels, its timestamp and
+// the hash of its line.
+type dedupKey struct {
+	labels    uint64
+	timestamp int64
+	line      uint64
+}
+
+type dedupEntry struct {
+	key    dedupKey
+	seenAt time.Time
+}
+
+// deduplicator remembers the entries received within a sliding window to
+// report duplicates.
+type deduplicator struct {
+	window  time.Duration
+	maxKeys int
+
+	mut  sync.Mutex
+	seen map[dedupKey]struct{}
+	// order holds the remembered entries from the oldest to the newest,
+	// starting at head.
+	order []dedupEntry
+	head  int
+}
+
+func newDeduplicator(cfg DedupConfig) *deduplicator {
+	return &deduplicator{
+		window:  cfg.Window,
+		maxKeys: max(int(cfg.MaxSize/dedupKeySize), 1),
+		seen:    make(map[dedupKey]struct{}),
+	}
+}
+
+// duplicate reports whether e was already received within the window at now.
+// Otherwise, e is remembered until the window elapses.
+func (d *deduplicator) duplicate(e loki.Entry, now time.Time) bool {
+	key := dedupKey{
+		labels:    uint64(e.Labels.FastFingerprint()),
+		timestamp: e.Timestamp.UnixNano(),
+		line:      xxhash.Sum64String(e.Line),
+	}
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	d.expire(now)
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	if len(d.seen) >= d.maxKeys {
+		d.forgetOldest()
+	}
+	d.seen[key] = struct{}{}
+	d.order = append(d.order, dedupEntry{key: key, seenAt: now})
+	return false
+}
+
+// expire forgets the entries received before the window at now. d.mut must
+// be held.
+func (d *deduplicator) expire(now time.Time) {
+	for d.head < len(d.order) && now.Sub(d.order[d.head].seenAt) >= d.window {
+		d.forgetOldest()
+	}
+}
+
+// forgetOldest forgets the oldest remembered entry. d.mut must be held.
+func (d *deduplicator) forgetOldest() {
+	delete(d.seen, d.order[d.head].key)
+	d.order[d.head] = dedupEntry{}
+	d.head++
+
+	// Reclaim the space of the forgotten entries once they make up most of
+	// the queue.
+	if d.head > len(d.order)/2 {
+		d.order = append(d.order[:0], d.order[d.head:]...)
+		d.head = 0
+	}
+}
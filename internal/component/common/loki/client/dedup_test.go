@@ -0,0 +1,58 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/agent/internal/component/common/loki"
+)
+
+func TestDeduplicator(t *testing.T) {
+	now := time.Now()
+	newEntry := func(labels model.LabelSet, ts time.Time, line string) loki.Entry {
+		return loki.Entry{Labels: labels, Entry: logproto.Entry{Timestamp: ts, Line: line}}
+	}
+	journal := model.LabelSet{"job": "journal"}
+	file := model.LabelSet{"job": "file"}
+
+	t.Run("duplicates inside the window", func(t *testing.T) {
+		d := newDeduplicator(DedupConfig{Enabled: true, Window: 10 * time.Second, MaxSize: 1024})
+
+		require.False(t, d.duplicate(newEntry(journal, now, "line"), now))
+		require.True(t, d.duplicate(newEntry(journal, now, "line"), now.Add(time.Second)))
+		require.True(t, d.duplicate(newEntry(journal, now, "line"), now.Add(9*time.Second)))
+
+		// Entries differing by their labels, timestamp or line aren't duplicates.
+		require.False(t, d.duplicate(newEntry(file, now, "line"), now.Add(time.Second)))
+		require.False(t, d.duplicate(newEntry(journal, now.Add(time.Nanosecond), "line"), now.Add(time.Second)))
+		require.False(t, d.duplicate(newEntry(journal, now, "other line"), now.Add(time.Second)))
+	})
+
+	t.Run("duplicates outside the window", func(t *testing.T) {
+		d := newDeduplicator(DedupConfig{Enabled: true, Window: 10 * time.Second, MaxSize: 1024})
+
+		require.False(t, d.duplicate(newEntry(journal, now, "line"), now))
+		require.False(t, d.duplicate(newEntry(journal, now, "line"), now.Add(10*time.Second)))
+		// The entry is remembered again from its last occurrence.
+		require.True(t, d.duplicate(newEntry(journal, now, "line"), now.Add(15*time.Second)))
+		require.Len(t, d.seen, 1)
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		// Only two entries fit.
+		d := newDeduplicator(DedupConfig{Enabled: true, Window: time.Minute, MaxSize: 2 * dedupKeySize})
+
+		require.False(t, d.duplicate(newEntry(journal, now, "line 1"), now))
+		require.False(t, d.duplicate(newEntry(journal, now, "line 2"), now))
+		require.False(t, d.duplicate(newEntry(journal, now, "line 3"), now))
+		require.Len(t, d.seen, 2)
+
+		// The oldest entry was forgotten before the end of the window.
+		require.True(t, d.duplicate(newEntry(journal, now, "line 3"), now))
+		require.False(t, d.duplicate(newEntry(journal, now, "line 1"), now))
+	})
+}
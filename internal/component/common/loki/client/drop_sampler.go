@@ -0,0 +1,123 @@
+package client
+
+import (
+	"sort"
+	"sync"
+)
+
+// maxSampledDropStreams is the maximum number of streams whose dropped
+// entries are reported per drop reason. Entries of other streams are only
+// counted.
+const maxSampledDropStreams = 20
+
+// DropSample describes the entries dropped by a client for a reason.
+type DropSample struct {
+	Reason    string
+	Entries   int             // Total number of entries dropped for Reason.
+	Streams   []DroppedStream // Streams with most dropped entries first.
+	Unsampled int             // Dropped entries of streams not reported in Streams.
+}
+
+// DroppedStream describes the entries of a stream dropped for a reason.
+type DroppedStream struct {
+	Labels  string
+	Entries int
+}
+
+// dropSampler records which streams entries are dropped from. Nothing is
+// recorded until entries are dropped.
+type dropSampler struct {
+	mut     sync.Mutex
+	reasons map[string]*droppedStreams
+}
+
+type droppedStreams struct {
+	entries   int
+	streams   map[string]int // Labels -> dropped entries
+	unsampled int
+}
+
+// observe records that entries entries of the stream with the given labels
+// were dropped for reason.
+func (s *dropSampler) observe(reason, labels string, entries int) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.observeLocked(reason, labels, entries)
+}
+
+// observeRequest records that the entries of req were dropped for reason.
+func (s *dropSampler) observeRequest(reason string, req encodedRequest) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if req.batch != nil {
+		for _, stream := range req.batch.streams {
+			s.observeLocked(reason, stream.Labels, len(stream.Entries))
+		}
+		return
+	}
+	for _, stream := range req.streams {
+		s.observeLocked(reason, stream.Labels, len(stream.Entries))
+	}
+}
+
+// observeOversized records the entries of oversized which were dropped.
+func (s *dropSampler) observeOversized(oversized oversizedEntries) {
+	if len(oversized.droppedLabels) == 0 {
+		return
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for _, labels := range oversized.droppedLabels {
+		s.observeLocked(ReasonRequestTooLarge, labels, 1)
+	}
+}
+
+func (s *dropSampler) observeLocked(reason, labels string, entries int) {
+	if s.reasons == nil {
+		s.reasons = make(map[string]*droppedStreams)
+	}
+	ds, ok := s.reasons[reason]
+	if !ok {
+		ds = &droppedStreams{streams: make(map[string]int)}
+		s.reasons[reason] = ds
+	}
+
+	ds.entries += entries
+	if _, ok := ds.streams[labels]; ok || len(ds.streams) < maxSampledDropStreams {
+		ds.streams[labels] += entries
+		return
+	}
+	ds.unsampled += entries
+}
+
+// take returns the entries dropped since the previous call, sorted by
+// reason, and resets them.
+func (s *dropSampler) take() []DropSample {
+	s.mut.Lock()
+	reasons := s.reasons
+	s.reasons = nil
+	s.mut.Unlock()
+
+	res := make([]DropSample, 0, len(reasons))
+	for reason, ds := range reasons {
+		sample := DropSample{
+			Reason:    reason,
+			Entries:   ds.entries,
+			Streams:   make([]DroppedStream, 0, len(ds.streams)),
+			Unsampled: ds.unsampled,
+		}
+		for labels, entries := range ds.streams {
+			sample.Streams = append(sample.Streams, DroppedStream{Labels: labels, Entries: entries})
+		}
+		sort.Slice(sample.Streams, func(i, j int) bool {
+			if sample.Streams[i].Entries != sample.Streams[j].Entries {
+				return sample.Streams[i].Entries > sample.Streams[j].Entries
+			}
+			return sample.Streams[i].Labels < sample.Streams[j].Labels
+		})
+		res = append(res, sample)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Reason < res[j].Reason })
+	return res
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDropSampler(t *testing.T) {
+	var s dropSampler
+
+	// Nothing is reported before entries are dropped.
+	require.Empty(t, s.take())
+
+	s.observe(ReasonLineTooLong, `{app="a"}`, 1)
+	s.observe(ReasonLineTooLong, `{app="b"}`, 1)
+	s.observe(ReasonLineTooLong, `{app="a"}`, 1)
+	s.observeOversized(oversizedEntries{droppedLabels: []string{`{app="c"}`}})
+	require.Equal(t, []DropSample{
+		{
+			Reason:  ReasonLineTooLong,
+			Entries: 3,
+			Streams: []DroppedStream{{Labels: `{app="a"}`, Entries: 2}, {Labels: `{app="b"}`, Entries: 1}},
+		},
+		{
+			Reason:  ReasonRequestTooLarge,
+			Entries: 1,
+			Streams: []DroppedStream{{Labels: `{app="c"}`, Entries: 1}},
+		},
+	}, s.take())
+
+	// Drops are reset once taken.
+	require.Empty(t, s.take())
+
+	// Entries of streams beyond the limit are only counted.
+	for i := 0; i < maxSampledDropStreams+5; i++ {
+		s.observe(ReasonRateLimited, fmt.Sprintf(`{app="%d"}`, i), 2)
+	}
+	samples := s.take()
+	require.Len(t, samples, 1)
+	require.Equal(t, 2*(maxSampledDropStreams+5), samples[0].Entries)
+	require.Len(t, samples[0].Streams, maxSampledDropStreams)
+	require.Equal(t, 10, samples[0].Unsampled)
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/config"
+)
+
+var (
+	errTLSHandshakeTimeout   = errors.New("TLS handshake timeout")
+	errResponseHeaderTimeout = errors.New("timeout awaiting response headers")
+)
+
+// newHTTPClient creates the HTTP client used to push batches. Timeout bounds
+// each request as a whole, while DialTimeout, TLSHandshakeTimeout and
+// ResponseHeaderTimeout, when set, bound the corresponding phase of it.
+func newHTTPClient(cfg Config) (*http.Client, error) {
+	opts := []config.HTTPClientOption{config.WithHTTP2Disabled()}
+	if cfg.DialTimeout > 0 {
+		dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}
+		opts = append(opts, config.WithDialContextFunc(dialer.DialContext))
+	}
+
+	client, err := config.NewClientFromConfig(cfg.Client, "GrafanaAgent", opts...)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = cfg.Timeout
+
+	if cfg.TLSHandshakeTimeout > 0 || cfg.ResponseHeaderTimeout > 0 {
+		client.Transport = &phaseTimeoutRoundTripper{
+			next:                  client.Transport,
+			tlsHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+			responseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		}
+	}
+	return client, nil
+}
+
+// phaseTimeoutRoundTripper cancels requests whose TLS handshake or wait for
+// response headers take longer than the configured timeouts. The transport
+// created by config.NewClientFromConfig doesn't allow configuring them.
+type phaseTimeoutRoundTripper struct {
+	next                  http.RoundTripper
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *phaseTimeoutRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+
+	var (
+		mut   sync.Mutex
+		timer *time.Timer
+	)
+	startTimer := func(timeout time.Duration, cause error) {
+		if timeout <= 0 {
+			return
+		}
+		mut.Lock()
+		defer mut.Unlock()
+		timer = time.AfterFunc(timeout, func() { cancel(cause) })
+	}
+	stopTimer := func() {
+		mut.Lock()
+		defer mut.Unlock()
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+	}
+
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeStart: func() { startTimer(rt.tlsHandshakeTimeout, errTLSHandshakeTimeout) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { stopTimer() },
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			startTimer(rt.responseHeaderTimeout, errResponseHeaderTimeout)
+		},
+		GotFirstResponseByte: stopTimer,
+	})
+
+	resp, err := rt.next.RoundTrip(req.WithContext(ctx))
+	stopTimer()
+	if err != nil {
+		cause := context.Cause(ctx)
+		cancel(nil)
+		if errors.Is(cause, errTLSHandshakeTimeout) || errors.Is(cause, errResponseHeaderTimeout) {
+			return nil, fmt.Errorf("%w: %w", cause, err)
+		}
+		return nil, err
+	}
+
+	// The request context must outlive RoundTrip, until the body is read.
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: func() { cancel(nil) }}
+	return resp, nil
+}
+
+// cancelOnCloseBody cancels the context of a request when its response body
+// is closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/flagext"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClient_ResponseHeaderTimeout(t *testing.T) {
+	// The server accepts requests and stalls before sending headers, until
+	// the request is cancelled.
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(stalled)
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	newRequest := func() *http.Request {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, nil)
+		require.NoError(t, err)
+		return req
+	}
+
+	t.Run("header timeout fires", func(t *testing.T) {
+		c, err := newHTTPClient(Config{URL: serverURL, Timeout: 10 * time.Second, ResponseHeaderTimeout: 100 * time.Millisecond})
+		require.NoError(t, err)
+
+		start := time.Now()
+		resp, err := c.Do(newRequest())
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		require.ErrorIs(t, err, errResponseHeaderTimeout)
+		require.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("overall timeout fires by default", func(t *testing.T) {
+		c, err := newHTTPClient(Config{URL: serverURL, Timeout: 200 * time.Millisecond})
+		require.NoError(t, err)
+
+		resp, err := c.Do(newRequest())
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		require.Error(t, err)
+		require.NotErrorIs(t, err, errResponseHeaderTimeout)
+	})
+}
+
+func TestNewHTTPClient_ResponseHeaderTimeoutNotFired(t *testing.T) {
+	// The server sends headers in time, and then takes longer than the
+	// header timeout to send the body.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	c, err := newHTTPClient(Config{URL: serverURL, Timeout: 10 * time.Second, ResponseHeaderTimeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+}
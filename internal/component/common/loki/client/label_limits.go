@@ -0,0 +1,140 @@
+package client
+
+import (
+	"sort"
+
+	"github.com/prometheus/common/model"
+)
+
+// LabelLimitsConfig configures the validation of the labels of each entry
+// before it's sent, mirroring the validation Loki applies when receiving a
+// push request. Zero limits are disabled.
+type LabelLimitsConfig struct {
+	MaxLabelNamesPerSeries int `yaml:"max_label_names_per_series,omitempty"`
+	MaxLabelNameLength     int `yaml:"max_label_name_length,omitempty"`
+	MaxLabelValueLength    int `yaml:"max_label_value_length,omitempty"`
+
+	// When DropInvalidLabels is enabled, only the labels violating the limits
+	// are removed from an entry rather than dropping the whole entry. Labels
+	// exceeding MaxLabelNamesPerSeries are removed in label name order.
+	DropInvalidLabels bool `yaml:"drop_invalid_labels,omitempty"`
+}
+
+// DefaultLabelLimitsConfig returns the label limits Loki applies by default.
+func DefaultLabelLimitsConfig() LabelLimitsConfig {
+	return LabelLimitsConfig{
+		MaxLabelNamesPerSeries: MaxLabelNamesPerSeries,
+		MaxLabelNameLength:     MaxLabelNameLength,
+		MaxLabelValueLength:    MaxLabelValueLength,
+	}
+}
+
+// labelViolations describes the labels of an entry which violate the label
+// limits.
+type labelViolations struct {
+	reasons []string       // Reasons of the violations, in the order they were found.
+	bytes   map[string]int // Size of the names and values of the removed labels, by reason.
+	labels  model.LabelSet // Labels left once the offending labels are removed.
+	kept    int            // Number of labels left, ignoring ReservedLabelTenantID.
+}
+
+// valid reports whether lbs doesn't violate any limit. It's checked for every
+// entry, so unlike check it doesn't allocate nor sort the label names.
+// ReservedLabelTenantID is never sent, so it is ignored.
+func (l LabelLimitsConfig) valid(lbs model.LabelSet) bool {
+	count := 0
+	for name, value := range lbs {
+		if name == ReservedLabelTenantID {
+			continue
+		}
+		if !name.IsValid() ||
+			(l.MaxLabelNameLength > 0 && len(name) > l.MaxLabelNameLength) ||
+			(l.MaxLabelValueLength > 0 && len(value) > l.MaxLabelValueLength) {
+			return false
+		}
+		count++
+	}
+	return l.MaxLabelNamesPerSeries <= 0 || count <= l.MaxLabelNamesPerSeries
+}
+
+// check returns the violations of the limits by lbs, or nil if lbs is valid.
+// ReservedLabelTenantID is never sent, so it is ignored.
+func (l LabelLimitsConfig) check(lbs model.LabelSet) *labelViolations {
+	if l.valid(lbs) {
+		return nil
+	}
+
+	var v *labelViolations
+	remove := func(reason string, name model.LabelName) {
+		if v == nil {
+			v = &labelViolations{bytes: make(map[string]int), labels: lbs.Clone()}
+		}
+		if _, ok := v.bytes[reason]; !ok {
+			v.reasons = append(v.reasons, reason)
+		}
+		v.bytes[reason] += len(name) + len(v.labels[name])
+		delete(v.labels, name)
+	}
+
+	names := make([]model.LabelName, 0, len(lbs))
+	for name := range lbs {
+		if name != ReservedLabelTenantID {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	valid := names[:0]
+	for _, name := range names {
+		switch {
+		case !name.IsValid():
+			remove(ReasonInvalidLabelName, name)
+		case l.MaxLabelNameLength > 0 && len(name) > l.MaxLabelNameLength:
+			remove(ReasonLabelNameTooLong, name)
+		case l.MaxLabelValueLength > 0 && len(lbs[name]) > l.MaxLabelValueLength:
+			remove(ReasonLabelValueTooLong, name)
+		default:
+			valid = append(valid, name)
+		}
+	}
+	if l.MaxLabelNamesPerSeries > 0 && len(valid) > l.MaxLabelNamesPerSeries {
+		for _, name := range valid[l.MaxLabelNamesPerSeries:] {
+			remove(ReasonTooManyLabels, name)
+		}
+		valid = valid[:l.MaxLabelNamesPerSeries]
+	}
+	if v != nil {
+		v.kept = len(valid)
+	}
+	return v
+}
+
+// applyLabelLimits validates the labels of an entry of tenantID against the
+// label limits of the client and records the violations in the metrics and
+// drops of the client. size is the size of the entry, reported as dropped if
+// the entry is. It returns the labels to send the entry with, and false if the
+// entry must be dropped instead.
+func applyLabelLimits(cfg Config, metrics *Metrics, tenants *tenantLabels, drops *dropSampler, tenantID string, lbs model.LabelSet, size int) (model.LabelSet, bool) {
+	v := cfg.LabelLimits.check(lbs)
+	if v == nil {
+		return lbs, true
+	}
+
+	host, tenant := cfg.URL.Host, tenants.label(tenantID)
+
+	// An entry without any label left is rejected by Loki, so it's dropped
+	// even when only the offending labels should be.
+	if !cfg.LabelLimits.DropInvalidLabels || v.kept == 0 {
+		reason := v.reasons[0]
+		metrics.droppedEntries.WithLabelValues(host, tenant, reason).Inc()
+		metrics.droppedBytes.WithLabelValues(host, tenant, reason).Add(float64(size))
+		drops.observe(reason, labelsMapToString(lbs, ReservedLabelTenantID), 1)
+		return nil, false
+	}
+
+	for _, reason := range v.reasons {
+		metrics.mutatedEntries.WithLabelValues(host, tenant, reason).Inc()
+		metrics.mutatedBytes.WithLabelValues(host, tenant, reason).Add(float64(v.bytes[reason]))
+	}
+	return v.labels, true
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyLabelLimits(t *testing.T) {
+	limits := LabelLimitsConfig{
+		MaxLabelNamesPerSeries: 3,
+		MaxLabelNameLength:     10,
+		MaxLabelValueLength:    10,
+	}
+
+	tests := []struct {
+		name   string
+		labels model.LabelSet
+		reason string         // Expected reason, empty if the labels are valid.
+		kept   model.LabelSet // Expected labels when dropping invalid labels, nil if the entry is dropped.
+	}{
+		{
+			name:   "valid",
+			labels: model.LabelSet{"app": "foo", "env": "prod", "team": "a", ReservedLabelTenantID: "tenant"},
+		},
+		{
+			name:   "too many labels",
+			labels: model.LabelSet{"a": "1", "b": "2", "c": "3", "d": "4"},
+			reason: ReasonTooManyLabels,
+			kept:   model.LabelSet{"a": "1", "b": "2", "c": "3"},
+		},
+		{
+			name:   "invalid label name",
+			labels: model.LabelSet{"app": "foo", "1nvalid": "bar"},
+			reason: ReasonInvalidLabelName,
+			kept:   model.LabelSet{"app": "foo"},
+		},
+		{
+			name:   "label name too long",
+			labels: model.LabelSet{"app": "foo", "very_long_name": "bar"},
+			reason: ReasonLabelNameTooLong,
+			kept:   model.LabelSet{"app": "foo"},
+		},
+		{
+			name:   "label value too long",
+			labels: model.LabelSet{"app": "foo", "path": "/a/very/long/path"},
+			reason: ReasonLabelValueTooLong,
+			kept:   model.LabelSet{"app": "foo"},
+		},
+		{
+			name:   "no label left",
+			labels: model.LabelSet{"path": "/a/very/long/path", ReservedLabelTenantID: "tenant"},
+			reason: ReasonLabelValueTooLong,
+		},
+	}
+
+	for _, tc := range tests {
+		for _, dropLabels := range []bool{false, true} {
+			name := tc.name
+			if dropLabels {
+				name += " dropping labels"
+			}
+			t.Run(name, func(t *testing.T) {
+				cfg := Config{
+					URL:         flagext.URLValue{URL: &url.URL{Host: "loki"}},
+					LabelLimits: limits,
+				}
+				cfg.LabelLimits.DropInvalidLabels = dropLabels
+
+				var (
+					metrics = NewMetrics(prometheus.NewRegistry())
+					drops   dropSampler
+				)
+				lbs, ok := applyLabelLimits(cfg, metrics, newTenantLabels(0), &drops, "", tc.labels, len("line"))
+
+				if tc.reason == "" {
+					require.True(t, ok)
+					require.Equal(t, tc.labels, lbs)
+					require.Empty(t, drops.take())
+					return
+				}
+
+				if !dropLabels || tc.kept == nil {
+					require.False(t, ok)
+					require.Equal(t, 1.0, testutil.ToFloat64(metrics.droppedEntries.WithLabelValues("loki", "", tc.reason)))
+					require.Equal(t, 4.0, testutil.ToFloat64(metrics.droppedBytes.WithLabelValues("loki", "", tc.reason)))
+
+					samples := drops.take()
+					require.Len(t, samples, 1)
+					require.Equal(t, tc.reason, samples[0].Reason)
+					return
+				}
+
+				require.True(t, ok)
+				require.Equal(t, tc.kept, lbs)
+				require.Equal(t, 1.0, testutil.ToFloat64(metrics.mutatedEntries.WithLabelValues("loki", "", tc.reason)))
+				require.Equal(t, 0.0, testutil.ToFloat64(metrics.droppedEntries.WithLabelValues("loki", "", tc.reason)))
+				require.Empty(t, drops.take())
+			})
+		}
+	}
+}
+
+func TestApplyLabelLimits_Disabled(t *testing.T) {
+	cfg := Config{URL: flagext.URLValue{URL: &url.URL{Host: "loki"}}}
+	lbs := model.LabelSet{"path": model.LabelValue(strings.Repeat("a", 10*MaxLabelValueLength))}
+
+	res, ok := applyLabelLimits(cfg, NewMetrics(nil), newTenantLabels(0), &dropSampler{}, "", lbs, len("line"))
+	require.True(t, ok)
+	require.Equal(t, lbs, res)
+}
+
+func TestLabelLimitsCheck_ValidDoesNotAllocate(t *testing.T) {
+	limits := DefaultLabelLimitsConfig()
+	lbs := model.LabelSet{"app": "foo", "env": "prod", "team": "a", ReservedLabelTenantID: "tenant"}
+
+	var v *labelViolations
+	allocs := testing.AllocsPerRun(100, func() {
+		v = limits.check(lbs)
+	})
+	require.Nil(t, v)
+	require.Zero(t, allocs)
+}
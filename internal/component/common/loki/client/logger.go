@@ -40,7 +40,7 @@ type logger struct {
 // NewLogger creates a new client logger that logs entries instead of sending them.
 func NewLogger(metrics *Metrics, log log.Logger, cfgs ...Config) (Client, error) {
 	// make sure the clients config is valid
-	c, err := NewManager(metrics, log, limit.Config{}, prometheus.NewRegistry(), wal.Config{}, NilNotifier, cfgs...)
+	c, err := NewManager(metrics, log, limit.Config{}, prometheus.NewRegistry(), wal.Config{}, DedupConfig{}, NilNotifier, cfgs...)
 	if err != nil {
 		return nil, err
 	}
@@ -1,10 +1,14 @@
 package client
 
 import (
+	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/component/common/loki/client/internal"
@@ -17,10 +21,10 @@ import (
 )
 
 // WriterEventsNotifier implements a notifier that's received by the Manager, to which wal.Watcher can subscribe for
-// writer events.
+// writer events of the WAL of a client.
 type WriterEventsNotifier interface {
-	SubscribeCleanup(subscriber wal.CleanupEventSubscriber)
-	SubscribeWrite(subscriber wal.WriteEventSubscriber)
+	SubscribeCleanup(clientName string, subscriber wal.CleanupEventSubscriber)
+	SubscribeWrite(clientName string, subscriber wal.WriteEventSubscriber)
 }
 
 var (
@@ -31,9 +35,9 @@ var (
 // nilNotifier implements WriterEventsNotifier with no-ops callbacks.
 type nilNotifier struct{}
 
-func (n nilNotifier) SubscribeCleanup(_ wal.CleanupEventSubscriber) {}
+func (n nilNotifier) SubscribeCleanup(_ string, _ wal.CleanupEventSubscriber) {}
 
-func (n nilNotifier) SubscribeWrite(_ wal.WriteEventSubscriber) {}
+func (n nilNotifier) SubscribeWrite(_ string, _ wal.WriteEventSubscriber) {}
 
 type StoppableWatcher interface {
 	Stop()
@@ -47,8 +51,10 @@ type StoppableClient interface {
 
 // watcherClientPair represents a pair of watcher and client, which are coupled together, or just a single client.
 type watcherClientPair struct {
+	name    string
 	watcher StoppableWatcher
 	client  StoppableClient
+	prober  *prober // Nil if the endpoint isn't probed.
 }
 
 // Stop will proceed to stop, in order, the possibly-nil watcher and the client.
@@ -73,19 +79,77 @@ func (p watcherClientPair) Stop(drain bool) {
 // work, tracked in https://github.com/grafana/loki/issues/8197, this Manager will be responsible for instantiating all client
 // types: Logger, Multi and WAL.
 type Manager struct {
-	name string
+	name       string
+	metrics    *Metrics
+	walEnabled bool
 
 	clients []Client
 	pairs   []watcherClientPair
 
+	dedup *deduplicator // Nil if deduplication is disabled.
+
 	entries chan loki.Entry
 	once    sync.Once
 
+	// hosts holds the host of the endpoint of each client, by client name.
+	hosts map[string]string
+
+	// quit is closed when the manager stops. appendMut is held for reading by
+	// calls to Append in progress, so that clients aren't stopped while
+	// entries are being sent to them, and for writing when setting stopped.
+	quit      chan struct{}
+	appendMut sync.RWMutex
+	stopped   bool
+
 	wg sync.WaitGroup
+
+	// probeCancel stops the probes of the endpoints in progress.
+	probeCancel context.CancelFunc
+	probeWG     sync.WaitGroup
 }
 
-// NewManager creates a new Manager
-func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg prometheus.Registerer, walCfg wal.Config, notifier WriterEventsNotifier, clientCfgs ...Config) (*Manager, error) {
+var (
+	errManagerStopped = errors.New("client manager is stopped")
+	errAppendWithWAL  = errors.New("synchronous append is not supported when the WAL is enabled")
+)
+
+// AppendError is returned by Manager.Append when some of the clients didn't
+// accept an entry. The entry was enqueued to all the other clients.
+type AppendError struct {
+	// Rejected holds why each client rejecting the entry did so, by client
+	// name.
+	Rejected map[string]error
+}
+
+func (e *AppendError) Error() string {
+	names := make([]string, 0, len(e.Rejected))
+	for name := range e.Rejected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reasons := make([]string, 0, len(names))
+	for _, name := range names {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", name, e.Rejected[name]))
+	}
+	return "entry rejected by clients: " + strings.Join(reasons, ", ")
+}
+
+// Unwrap returns the errors of the clients which rejected the entry, so that
+// errors.Is can match context.DeadlineExceeded for example.
+func (e *AppendError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Rejected))
+	for _, err := range e.Rejected {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// NewManager creates a new Manager. When dedupCfg is enabled, duplicate
+// entries are suppressed before they're sent to the clients; with the WAL
+// enabled, callers must check entries with Duplicate before writing them to
+// the WAL.
+func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg prometheus.Registerer, walCfg wal.Config, dedupCfg DedupConfig, notifier WriterEventsNotifier, clientCfgs ...Config) (*Manager, error) {
 	var fake struct{}
 
 	walWatcherMetrics := wal.NewWatcherMetrics(reg)
@@ -97,9 +161,11 @@ func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg pr
 	}
 
 	clientsCheck := make(map[string]struct{})
+	hosts := make(map[string]string, len(clientCfgs))
 	clients := make([]Client, 0, len(clientCfgs))
 	pairs := make([]watcherClientPair, 0, len(clientCfgs))
-	for _, cfg := range clientCfgs {
+	walNames := GetClientWALNames(clientCfgs...)
+	for i, cfg := range clientCfgs {
 		// Don't allow duplicate clients, we have client specific metrics that need at least one unique label value (name).
 		clientName := GetClientName(cfg)
 		if _, ok := clientsCheck[clientName]; ok {
@@ -107,12 +173,15 @@ func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg pr
 		}
 
 		clientsCheck[clientName] = fake
+		hosts[clientName] = cfg.URL.Host
 
 		if walCfg.Enabled {
 			// add some context information for the logger the watcher uses
 			wlog := log.With(logger, "client", clientName)
+			walName := walNames[i]
+			walDir := wal.ClientDir(walCfg.Dir, walName)
 
-			markerFileHandler, err := internal.NewMarkerFileHandler(logger, walCfg.Dir)
+			markerFileHandler, err := internal.NewMarkerFileHandler(logger, walDir)
 			if err != nil {
 				return nil, err
 			}
@@ -125,16 +194,17 @@ func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg pr
 
 			// subscribe watcher's wal.WriteTo to writer events. This will make the writer trigger the cleanup of the wal.WriteTo
 			// series cache whenever a segment is deleted.
-			notifier.SubscribeCleanup(queue)
+			notifier.SubscribeCleanup(walName, queue)
 
-			watcher := wal.NewWatcher(walCfg.Dir, clientName, walWatcherMetrics, queue, wlog, walCfg.WatchConfig, markerHandler)
+			watcher := wal.NewWatcher(walDir, clientName, walWatcherMetrics, queue, wlog, walCfg.WatchConfig, markerHandler)
 			// subscribe watcher to wal write events
-			notifier.SubscribeWrite(watcher)
+			notifier.SubscribeWrite(walName, watcher)
 
 			level.Debug(logger).Log("msg", "starting WAL watcher for client", "client", clientName)
 			watcher.Start()
 
 			pairs = append(pairs, watcherClientPair{
+				name:    clientName,
 				watcher: watcher,
 				client:  queue,
 			})
@@ -147,15 +217,24 @@ func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg pr
 			clients = append(clients, client)
 
 			pairs = append(pairs, watcherClientPair{
+				name:   clientName,
 				client: client,
 			})
 		}
 	}
 	manager := &Manager{
-		clients: clients,
-		pairs:   pairs,
-		entries: make(chan loki.Entry),
+		metrics:    metrics,
+		walEnabled: walCfg.Enabled,
+		clients:    clients,
+		hosts:      hosts,
+		pairs:      pairs,
+		entries:    make(chan loki.Entry),
+		quit:       make(chan struct{}),
+	}
+	if dedupCfg.Enabled {
+		manager.dedup = newDeduplicator(dedupCfg)
 	}
+	manager.startProbes(logger, clientCfgs)
 	if walCfg.Enabled {
 		manager.name = buildManagerName("wal", clientCfgs...)
 		manager.startWithConsume()
@@ -166,6 +245,40 @@ func NewManager(metrics *Metrics, logger log.Logger, limits limit.Config, reg pr
 	return manager, nil
 }
 
+// startProbes probes in the background the endpoints of the clients whose
+// config enables it, without blocking the creation of the manager.
+func (m *Manager) startProbes(logger log.Logger, clientCfgs []Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.probeCancel = cancel
+
+	for i, cfg := range clientCfgs {
+		c, ok := m.pairs[i].client.(probingClient)
+		if !cfg.Probe.Enabled || !ok {
+			continue
+		}
+		p := &prober{result: ProbeResult{State: ProbePending}}
+		m.pairs[i].prober = p
+
+		m.probeWG.Add(1)
+		go func(cfg Config) {
+			defer m.probeWG.Done()
+			p.run(ctx, c, cfg, logger)
+		}(cfg)
+	}
+}
+
+// FailedProbes returns the error of the last probe of the clients whose
+// endpoint probe failed so far, by client name.
+func (m *Manager) FailedProbes() map[string]error {
+	res := make(map[string]error)
+	for _, pair := range m.pairs {
+		if probe := pair.prober.get(); probe.State == ProbeFailed {
+			res[pair.name] = probe.Err
+		}
+	}
+	return res
+}
+
 // startWithConsume starts the main manager routine, which reads and discards entries from the exposed channel.
 // This is necessary since to treat the WAL-enabled manager the same way as the WAL-disabled one, the processing pipeline
 // send entries both to the WAL writer, and the channel exposed by the manager. In the case the WAL is enabled, these entries
@@ -189,6 +302,9 @@ func (m *Manager) startWithForward() {
 	go func() {
 		defer m.wg.Done()
 		for e := range m.entries {
+			if m.Duplicate(e) {
+				continue
+			}
 			for _, c := range m.clients {
 				c.Chan() <- e
 			}
@@ -196,6 +312,23 @@ func (m *Manager) startWithForward() {
 	}()
 }
 
+// Duplicate reports whether entry duplicates an entry received within the
+// deduplication window, in which case it's counted as suppressed for every
+// client. It always returns false if deduplication is disabled.
+//
+// Entries sent through Chan or appended to all the clients are checked by the
+// manager. When the WAL is enabled, entries must be checked before they're
+// written to the WAL instead.
+func (m *Manager) Duplicate(entry loki.Entry) bool {
+	if m.dedup == nil || !m.dedup.duplicate(entry, time.Now()) {
+		return false
+	}
+	for _, pair := range m.pairs {
+		m.metrics.dedupedEntries.WithLabelValues(pair.name).Inc()
+	}
+	return true
+}
+
 func (m *Manager) StopNow() {
 	for _, pair := range m.pairs {
 		pair.client.StopNow()
@@ -210,6 +343,148 @@ func (m *Manager) Chan() chan<- loki.Entry {
 	return m.entries
 }
 
+// Append enqueues entry to the clients with the given names, or to all the
+// clients if no name is given. It blocks until every client accepted the
+// entry, or until ctx is done or the manager is stopped. Unlike entries sent
+// through Chan, callers learn which clients didn't accept the entry from the
+// returned *AppendError.
+//
+// Append isn't supported when the WAL is enabled, since clients then read
+// entries from the WAL instead.
+func (m *Manager) Append(ctx context.Context, entry loki.Entry, clientNames ...string) error {
+	if m.walEnabled {
+		return errAppendWithWAL
+	}
+
+	m.appendMut.RLock()
+	defer m.appendMut.RUnlock()
+
+	if m.stopped {
+		return errManagerStopped
+	}
+
+	targets, err := m.selectClients(clientNames)
+	if err != nil {
+		return err
+	}
+	// Entries appended to some of the clients only aren't deduplicated, since
+	// they would be suppressed for the other clients.
+	if len(clientNames) == 0 && m.Duplicate(entry) {
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mut      sync.Mutex
+		rejected = make(map[string]error)
+	)
+	for _, c := range targets {
+		wg.Add(1)
+		go func(c Client) {
+			defer wg.Done()
+
+			var err error
+			select {
+			case c.Chan() <- entry:
+				return
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-m.quit:
+				err = errManagerStopped
+			}
+
+			mut.Lock()
+			rejected[c.Name()] = err
+			mut.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	if len(rejected) == 0 {
+		return nil
+	}
+	for name := range rejected {
+		m.metrics.rejectedEntries.WithLabelValues(m.hosts[name]).Inc()
+	}
+	return &AppendError{Rejected: rejected}
+}
+
+// selectClients returns the clients with the given names, or all the clients
+// if no name is given.
+func (m *Manager) selectClients(names []string) ([]Client, error) {
+	if len(names) == 0 {
+		return m.clients, nil
+	}
+
+	selected := make([]Client, 0, len(names))
+	for _, name := range names {
+		var found bool
+		for _, c := range m.clients {
+			if c.Name() == name {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown client %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// batchSamplingClient is implemented by the clients which can sample the
+// contents of the batches they send.
+type batchSamplingClient interface {
+	sampleBatches(n int)
+	batchSamples() ([]BatchSample, int)
+}
+
+// SampleBatches records the contents of the next n batches sent by each
+// client, at most MaxSampledBatches, discarding the batches sampled before.
+// A zero n stops sampling. The sampled batches are returned by DebugInfo.
+func (m *Manager) SampleBatches(n int) {
+	for _, pair := range m.pairs {
+		if c, ok := pair.client.(batchSamplingClient); ok {
+			c.sampleBatches(n)
+		}
+	}
+}
+
+// ClientDebugInfo describes the state of a client of a Manager.
+type ClientDebugInfo struct {
+	Name                string
+	CircuitBreakerState CircuitBreakerState
+	SampledBatches      []BatchSample // Batches sampled since SampleBatches was called.
+	PendingSamples      int           // Batches left to sample.
+	Drops               []DropSample  // Entries dropped since the previous call to DebugInfo, by reason.
+	Probe               ProbeResult   // Result of the probe of the endpoint.
+	Pushes              PushTimes     // Times of the last push requests.
+}
+
+// DebugInfo returns the state of each client, in the order of their configs.
+// The dropped entries reported for each client are reset on every call.
+func (m *Manager) DebugInfo() []ClientDebugInfo {
+	res := make([]ClientDebugInfo, 0, len(m.pairs))
+	for _, pair := range m.pairs {
+		info := ClientDebugInfo{Name: pair.name, Probe: pair.prober.get()}
+		if c, ok := pair.client.(interface{ circuitBreakerState() CircuitBreakerState }); ok {
+			info.CircuitBreakerState = c.circuitBreakerState()
+		}
+		if c, ok := pair.client.(batchSamplingClient); ok {
+			info.SampledBatches, info.PendingSamples = c.batchSamples()
+		}
+		if c, ok := pair.client.(interface{ takeDropSamples() []DropSample }); ok {
+			info.Drops = c.takeDropSamples()
+		}
+		if c, ok := pair.client.(interface{ pushTimes() PushTimes }); ok {
+			info.Pushes = c.pushTimes()
+		}
+		res = append(res, info)
+	}
+	return res
+}
+
 // Stop the manager, not draining the Write-Ahead Log, if that mode is enabled.
 func (m *Manager) Stop() {
 	m.StopWithDrain(false)
@@ -220,9 +495,18 @@ func (m *Manager) Stop() {
 // The shutdown procedure first stops the Watchers, allowing them to flush as much data into the clients as possible. Then
 // the clients are shut down accordingly.
 func (m *Manager) StopWithDrain(drain bool) {
-	// first stop the receiving channel
-	m.once.Do(func() { close(m.entries) })
+	// first stop the receiving channel, and wait for the calls to Append in
+	// progress to return
+	m.once.Do(func() {
+		close(m.quit)
+		close(m.entries)
+	})
+	m.appendMut.Lock()
+	m.stopped = true
+	m.appendMut.Unlock()
 	m.wg.Wait()
+	m.probeCancel()
+	m.probeWG.Wait()
 
 	var stopWG sync.WaitGroup
 
@@ -250,6 +534,29 @@ func GetClientName(cfg Config) string {
 	return asSha256(cfg)
 }
 
+// GetClientWALNames computes the name of the WAL of each client config, which the WAL writer and the manager must
+// agree on. Clients with a configured Name use it, like GetClientName. The WAL of other clients is named after their
+// URL rather than their whole config, so that the entries they haven't sent yet are kept when the rest of their config
+// changes. Clients without a name sharing their URL fall back to GetClientName, since they can't be told apart by URL.
+func GetClientWALNames(cfgs ...Config) []string {
+	urls := make(map[string]int, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg.Name == "" {
+			urls[cfg.URL.String()]++
+		}
+	}
+
+	names := make([]string, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg.Name != "" || urls[cfg.URL.String()] > 1 {
+			names = append(names, GetClientName(cfg))
+			continue
+		}
+		names = append(names, "url-"+asSha256(cfg.URL.String()))
+	}
+	return names
+}
+
 func asSha256(o interface{}) string {
 	h := sha256.New()
 	h.Write([]byte(fmt.Sprintf("%v", o)))
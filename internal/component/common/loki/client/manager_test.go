@@ -13,6 +13,7 @@ import (
 	"github.com/grafana/dskit/backoff"
 	"github.com/grafana/dskit/flagext"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 
@@ -50,7 +51,7 @@ func TestManager_NoDuplicateMetricsPanic(t *testing.T) {
 		for i := 0; i < 2; i++ {
 			_, err := NewManager(metrics, log.NewLogfmtLogger(os.Stdout), testLimitsConfig, reg, wal.Config{
 				WatchConfig: wal.DefaultWatchConfig,
-			}, NilNotifier, Config{
+			}, DedupConfig{}, NilNotifier, Config{
 				URL: flagext.URLValue{URL: host},
 			})
 			require.NoError(t, err)
@@ -66,7 +67,7 @@ func TestManager_ErrorCreatingWhenNoClientConfigsProvided(t *testing.T) {
 				Dir:         walDir,
 				Enabled:     walEnabled,
 				WatchConfig: wal.DefaultWatchConfig,
-			}, NilNotifier)
+			}, DedupConfig{}, NilNotifier)
 			require.Error(t, err)
 		})
 	}
@@ -88,12 +89,33 @@ func TestManager_ErrorCreatingWhenRepeatedConfigs(t *testing.T) {
 				Dir:         walDir,
 				Enabled:     walEnabled,
 				WatchConfig: wal.DefaultWatchConfig,
-			}, NilNotifier, config1, config1Copy)
+			}, DedupConfig{}, NilNotifier, config1, config1Copy)
 			require.Error(t, err)
 		})
 	}
 }
 
+func TestGetClientWALNames(t *testing.T) {
+	host1, _ := url.Parse("http://localhost:3100")
+	host2, _ := url.Parse("http://localhost:3101")
+	unnamed := Config{BatchWait: time.Second, URL: flagext.URLValue{URL: host1}}
+	updated := unnamed
+	updated.BatchWait = 2 * time.Second
+	named := Config{Name: "named", URL: flagext.URLValue{URL: host1}}
+	otherHost := Config{URL: flagext.URLValue{URL: host2}}
+
+	// The WAL of an unnamed client is kept when the rest of its config changes.
+	require.NotEqual(t, GetClientName(unnamed), GetClientName(updated))
+	require.Equal(t, GetClientWALNames(unnamed), GetClientWALNames(updated))
+
+	names := GetClientWALNames(unnamed, named, otherHost)
+	require.Equal(t, "named", names[1])
+	require.NotEqual(t, names[0], names[2])
+
+	// Unnamed clients sharing their URL can't be told apart by it.
+	require.Equal(t, []string{GetClientName(unnamed), GetClientName(updated)}, GetClientWALNames(unnamed, updated))
+}
+
 type closer interface {
 	Close()
 }
@@ -146,9 +168,9 @@ func TestManager_WALEnabled(t *testing.T) {
 	clientMetrics := NewMetrics(reg)
 
 	// start writer and manager
-	writer, err := wal.NewWriter(walConfig, logger, reg)
+	writer, err := wal.NewWriter(walConfig, logger, reg, GetClientName(testClientConfig))
 	require.NoError(t, err)
-	manager, err := NewManager(clientMetrics, logger, testLimitsConfig, prometheus.NewRegistry(), walConfig, writer, testClientConfig)
+	manager, err := NewManager(clientMetrics, logger, testLimitsConfig, prometheus.NewRegistry(), walConfig, DedupConfig{}, writer, testClientConfig)
 	require.NoError(t, err)
 	require.Equal(t, "wal:test-client", manager.Name())
 
@@ -204,7 +226,7 @@ func TestManager_WALDisabled(t *testing.T) {
 	clientMetrics := NewMetrics(reg)
 
 	// start writer and manager
-	manager, err := NewManager(clientMetrics, logger, testLimitsConfig, prometheus.NewRegistry(), walConfig, NilNotifier, testClientConfig)
+	manager, err := NewManager(clientMetrics, logger, testLimitsConfig, prometheus.NewRegistry(), walConfig, DedupConfig{}, NilNotifier, testClientConfig)
 	require.NoError(t, err)
 	require.Equal(t, "multi:test-client", manager.Name())
 
@@ -250,6 +272,139 @@ func TestManager_WALDisabled(t *testing.T) {
 	require.Len(t, seenEntries, totalLines)
 }
 
+func TestManager_SampleBatches(t *testing.T) {
+	logger := log.NewLogfmtLogger(os.Stdout)
+	testClientConfig, rwReceivedReqs, closeServer := newServerAndClientConfig(t)
+
+	manager, err := NewManager(NewMetrics(prometheus.NewRegistry()), logger, testLimitsConfig, prometheus.NewRegistry(), wal.Config{}, DedupConfig{}, NilNotifier, testClientConfig)
+	require.NoError(t, err)
+
+	receivedRequests := utils.NewSyncSlice[utils.RemoteWriteRequest]()
+	go func() {
+		for req := range rwReceivedReqs {
+			receivedRequests.Append(req)
+		}
+	}()
+
+	defer func() {
+		manager.Stop()
+		closeServer.Close()
+	}()
+
+	send := func(lines int) {
+		for i := 0; i < lines; i++ {
+			manager.Chan() <- loki.Entry{
+				Labels: model.LabelSet{"app": "checkout"},
+				Entry: logproto.Entry{
+					Timestamp: time.Now(),
+					Line:      fmt.Sprintf("line%d", i),
+				},
+			}
+		}
+	}
+
+	// Nothing is sampled before SampleBatches is called.
+	send(2)
+	require.Eventually(t, func() bool {
+		return receivedRequests.Length() == 2
+	}, 5*time.Second, 10*time.Millisecond, "timed out waiting for requests to be received")
+	info := manager.DebugInfo()
+	require.Len(t, info, 1)
+	require.Equal(t, "test-client", info[0].Name)
+	require.Empty(t, info[0].SampledBatches)
+
+	// Each entry is sent in its own batch, since the batch size is 1 byte.
+	manager.SampleBatches(3)
+	require.Equal(t, 3, manager.DebugInfo()[0].PendingSamples)
+	send(5)
+	require.Eventually(t, func() bool {
+		return receivedRequests.Length() == 7
+	}, 5*time.Second, 10*time.Millisecond, "timed out waiting for requests to be received")
+
+	info = manager.DebugInfo()
+	require.Zero(t, info[0].PendingSamples)
+	require.Len(t, info[0].SampledBatches, 3)
+	for i, sample := range info[0].SampledBatches {
+		require.Equal(t, 1, sample.Entries)
+		require.Equal(t, len(fmt.Sprintf("line%d", i)), sample.Bytes)
+		require.Equal(t, []StreamSample{{Labels: `{app="checkout"}`, Entries: 1, Bytes: sample.Bytes}}, sample.Streams)
+	}
+
+	// Sampling can be stopped before all the batches are sampled.
+	manager.SampleBatches(10)
+	manager.SampleBatches(0)
+	info = manager.DebugInfo()
+	require.Zero(t, info[0].PendingSamples)
+	require.Empty(t, info[0].SampledBatches)
+}
+
+func TestManager_DropSamples(t *testing.T) {
+	logger := log.NewLogfmtLogger(os.Stdout)
+
+	// Every request is rate limited, and rate limited batches are dropped.
+	receivedReqs := make(chan utils.RemoteWriteRequest, 10)
+	server := utils.NewRemoteWriteServer(receivedReqs, http.StatusTooManyRequests)
+	go func() {
+		//nolint:revive
+		for range receivedReqs {
+		}
+	}()
+	serverURL, _ := url.Parse(server.URL)
+	cfg := Config{
+		Name:                   "test-client",
+		URL:                    flagext.URLValue{URL: serverURL},
+		Timeout:                time.Second * 2,
+		BatchSize:              1,
+		BackoffConfig:          backoff.Config{MaxRetries: 0},
+		DropRateLimitedBatches: true,
+	}
+	limits := limit.Config{MaxLineSize: 16}
+
+	manager, err := NewManager(NewMetrics(prometheus.NewRegistry()), logger, limits, prometheus.NewRegistry(), wal.Config{}, DedupConfig{}, NilNotifier, cfg)
+	require.NoError(t, err)
+	defer func() {
+		manager.Stop()
+		server.Close()
+		close(receivedReqs)
+	}()
+
+	send := func(app, line string) {
+		manager.Chan() <- loki.Entry{
+			Labels: model.LabelSet{"app": model.LabelValue(app)},
+			Entry:  logproto.Entry{Timestamp: time.Now(), Line: line},
+		}
+	}
+	for i := 0; i < 3; i++ {
+		send("checkout", "short line")
+	}
+	send("cart", "short line")
+	send("search", "a line longer than the limit")
+
+	// Drops are reset on every call to DebugInfo, so accumulate them until
+	// all the entries were dropped.
+	drops := make(map[string]map[string]int)
+	require.Eventually(t, func() bool {
+		info := manager.DebugInfo()
+		require.Len(t, info, 1)
+		for _, d := range info[0].Drops {
+			if drops[d.Reason] == nil {
+				drops[d.Reason] = make(map[string]int)
+			}
+			require.Zero(t, d.Unsampled)
+			for _, s := range d.Streams {
+				drops[d.Reason][s.Labels] += s.Entries
+			}
+		}
+		return len(drops[ReasonRateLimited]) == 2 && drops[ReasonRateLimited][`{app="checkout"}`] == 3
+	}, 5*time.Second, 10*time.Millisecond, "timed out waiting for entries to be dropped")
+
+	require.Equal(t, map[string]map[string]int{
+		ReasonRateLimited: {`{app="checkout"}`: 3, `{app="cart"}`: 1},
+		ReasonLineTooLong: {`{app="search"}`: 1},
+	}, drops)
+	require.Empty(t, manager.DebugInfo()[0].Drops)
+}
+
 func TestManager_WALDisabled_MultipleConfigs(t *testing.T) {
 	walConfig := wal.Config{}
 	// start all necessary resources
@@ -273,7 +428,7 @@ func TestManager_WALDisabled_MultipleConfigs(t *testing.T) {
 	clientMetrics := NewMetrics(reg)
 
 	// start writer and manager
-	manager, err := NewManager(clientMetrics, logger, testLimitsConfig, prometheus.NewRegistry(), walConfig, NilNotifier, testClientConfig, testClientConfig2)
+	manager, err := NewManager(clientMetrics, logger, testLimitsConfig, prometheus.NewRegistry(), walConfig, DedupConfig{}, NilNotifier, testClientConfig, testClientConfig2)
 	require.NoError(t, err)
 	require.Equal(t, "multi:test-client,test-client-2", manager.Name())
 
@@ -329,3 +484,174 @@ func TestManager_WALDisabled_MultipleConfigs(t *testing.T) {
 	}
 	require.Len(t, seenEntries, expectedTotalLines)
 }
+
+// stubClient is a Client which only accepts entries when the test reads them
+// from its channel.
+type stubClient struct {
+	name    string
+	entries chan loki.Entry
+}
+
+func newStubClient(name string) *stubClient {
+	return &stubClient{name: name, entries: make(chan loki.Entry)}
+}
+
+func (c *stubClient) Chan() chan<- loki.Entry { return c.entries }
+func (c *stubClient) Stop()                   {}
+func (c *stubClient) StopNow()                {}
+func (c *stubClient) Name() string            { return c.name }
+
+func newStubManager(clients ...Client) *Manager {
+	m := &Manager{
+		metrics: NewMetrics(prometheus.NewRegistry()),
+		hosts:   make(map[string]string),
+		entries: make(chan loki.Entry),
+		quit:    make(chan struct{}),
+	}
+	for _, c := range clients {
+		m.clients = append(m.clients, c)
+		m.hosts[c.Name()] = c.Name() + ".example.com"
+		m.pairs = append(m.pairs, watcherClientPair{client: c})
+	}
+	m.startWithForward()
+	return m
+}
+
+func TestManager_Append(t *testing.T) {
+	entry := loki.Entry{
+		Labels: model.LabelSet{"pizza-flavour": "fugazzeta"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "line"},
+	}
+
+	t.Run("all clients accept the entry", func(t *testing.T) {
+		a, b := newStubClient("a"), newStubClient("b")
+		m := newStubManager(a, b)
+		defer m.Stop()
+
+		go func() { <-a.entries }()
+		go func() { <-b.entries }()
+		require.NoError(t, m.Append(context.Background(), entry))
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		a := newStubClient("a")
+		m := newStubManager(a)
+		defer m.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := m.Append(ctx, entry)
+		var appendErr *AppendError
+		require.ErrorAs(t, err, &appendErr)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, map[string]error{"a": context.DeadlineExceeded}, appendErr.Rejected)
+		require.Equal(t, 1.0, testutil.ToFloat64(m.metrics.rejectedEntries.WithLabelValues("a.example.com")))
+	})
+
+	t.Run("partial client failure", func(t *testing.T) {
+		accepting, stalled := newStubClient("accepting"), newStubClient("stalled")
+		m := newStubManager(accepting, stalled)
+		defer m.Stop()
+
+		received := make(chan loki.Entry, 1)
+		go func() { received <- <-accepting.entries }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := m.Append(ctx, entry)
+		require.EqualError(t, err, "entry rejected by clients: stalled: context deadline exceeded")
+		require.Equal(t, entry, <-received)
+		require.Equal(t, 0.0, testutil.ToFloat64(m.metrics.rejectedEntries.WithLabelValues("accepting.example.com")))
+		require.Equal(t, 1.0, testutil.ToFloat64(m.metrics.rejectedEntries.WithLabelValues("stalled.example.com")))
+	})
+
+	t.Run("selected clients only", func(t *testing.T) {
+		a, b := newStubClient("a"), newStubClient("b")
+		m := newStubManager(a, b)
+		defer m.Stop()
+
+		go func() { <-b.entries }()
+		require.NoError(t, m.Append(context.Background(), entry, "b"))
+		require.EqualError(t, m.Append(context.Background(), entry, "c"), `unknown client "c"`)
+	})
+
+	t.Run("manager stopped while appending", func(t *testing.T) {
+		a := newStubClient("a")
+		m := newStubManager(a)
+
+		errc := make(chan error, 1)
+		go func() { errc <- m.Append(context.Background(), entry) }()
+
+		time.Sleep(50 * time.Millisecond)
+		m.Stop()
+		require.ErrorIs(t, <-errc, errManagerStopped)
+		require.ErrorIs(t, m.Append(context.Background(), entry), errManagerStopped)
+	})
+
+	t.Run("WAL enabled", func(t *testing.T) {
+		m := newStubManager(newStubClient("a"))
+		defer m.Stop()
+		m.walEnabled = true
+
+		require.ErrorIs(t, m.Append(context.Background(), entry), errAppendWithWAL)
+	})
+}
+
+func TestManager_Dedup(t *testing.T) {
+	a, b := newStubClient("a"), newStubClient("b")
+	m := &Manager{
+		metrics: NewMetrics(prometheus.NewRegistry()),
+		entries: make(chan loki.Entry),
+		quit:    make(chan struct{}),
+		dedup:   newDeduplicator(DedupConfig{Enabled: true, Window: time.Minute, MaxSize: 1024}),
+	}
+	for _, c := range []*stubClient{a, b} {
+		m.clients = append(m.clients, c)
+		m.pairs = append(m.pairs, watcherClientPair{name: c.name, client: c})
+	}
+	m.startWithForward()
+	defer m.Stop()
+
+	entry := loki.Entry{
+		Labels: model.LabelSet{"pizza-flavour": "fugazzeta"},
+		Entry:  logproto.Entry{Timestamp: time.Now(), Line: "line"},
+	}
+	other := loki.Entry{
+		Labels: model.LabelSet{"pizza-flavour": "fugazzeta"},
+		Entry:  logproto.Entry{Timestamp: entry.Timestamp, Line: "other line"},
+	}
+
+	received := make(chan loki.Entry, 10)
+	for _, c := range []*stubClient{a, b} {
+		go func(c *stubClient) {
+			for e := range c.entries {
+				received <- e
+			}
+		}(c)
+	}
+
+	// The duplicate sent through the channel is suppressed for both clients.
+	m.Chan() <- entry
+	m.Chan() <- entry
+	m.Chan() <- other
+	// Entries appended to all the clients are deduplicated too.
+	require.NoError(t, m.Append(context.Background(), entry))
+
+	var lines []string
+	for i := 0; i < 4; i++ {
+		lines = append(lines, (<-received).Line)
+	}
+	require.ElementsMatch(t, []string{"line", "line", "other line", "other line"}, lines)
+	require.Equal(t, 2.0, testutil.ToFloat64(m.metrics.dedupedEntries.WithLabelValues("a")))
+	require.Equal(t, 2.0, testutil.ToFloat64(m.metrics.dedupedEntries.WithLabelValues("b")))
+
+	// With the WAL enabled, callers check entries before writing them.
+	require.True(t, m.Duplicate(other))
+	select {
+	case e := <-received:
+		t.Fatalf("unexpected entry received: %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
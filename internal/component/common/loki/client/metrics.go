@@ -1,10 +1,50 @@
 package client
 
 import (
+	"sync"
+
 	"github.com/grafana/agent/internal/util"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// TenantOverflowLabelValue is the tenant label value used in metrics for
+// tenants seen after a client reached its MaxTenants.
+const TenantOverflowLabelValue = "__overflow__"
+
+// tenantLabels bounds the number of tenant label values a client exposes in
+// its metrics, so that entries carrying arbitrary tenant IDs can't create an
+// unbounded number of series.
+type tenantLabels struct {
+	mut  sync.Mutex
+	max  int
+	seen map[string]struct{}
+}
+
+func newTenantLabels(max int) *tenantLabels {
+	if max <= 0 {
+		max = MaxTenants
+	}
+	return &tenantLabels{
+		max:  max,
+		seen: make(map[string]struct{}),
+	}
+}
+
+// label returns the value to use for the tenant label of tenantID.
+func (t *tenantLabels) label(tenantID string) string {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if _, ok := t.seen[tenantID]; ok {
+		return tenantID
+	}
+	if len(t.seen) >= t.max {
+		return TenantOverflowLabelValue
+	}
+	t.seen[tenantID] = struct{}{}
+	return tenantID
+}
+
 type QueueClientMetrics struct {
 	lastReadTimestamp *prometheus.GaugeVec
 }
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/labels"
+	promql_parser "github.com/prometheus/prometheus/promql/parser"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+)
+
+// Protocols supported to push batches.
+const (
+	// ProtocolLoki pushes batches as snappy-compressed Loki push requests.
+	ProtocolLoki = "loki"
+	// ProtocolOTLPHTTP pushes batches as OTLP/HTTP protobuf export requests.
+	ProtocolOTLPHTTP = "otlphttp"
+)
+
+// protocolOf returns the protocol used by cfg, defaulting to ProtocolLoki.
+func protocolOf(cfg Config) (string, error) {
+	switch cfg.Protocol {
+	case "", ProtocolLoki:
+		return ProtocolLoki, nil
+	case ProtocolOTLPHTTP:
+		return ProtocolOTLPHTTP, nil
+	default:
+		return "", fmt.Errorf("unsupported protocol %q, must be one of %q or %q", cfg.Protocol, ProtocolLoki, ProtocolOTLPHTTP)
+	}
+}
+
+// encodeBatch encodes b for protocol, returning the encoded bytes and the
+// number of encoded entries.
+func encodeBatch(protocol string, b *batch) ([]byte, int, error) {
+	if protocol == ProtocolOTLPHTTP {
+		return b.encodeOTLP()
+	}
+	return b.encode()
+}
+
+// encodeOTLP encodes the batch as an uncompressed OTLP logs export request,
+// and returns the encoded bytes and the number of encoded entries.
+func (b *batch) encodeOTLP() ([]byte, int, error) {
+	logs, entriesCount, err := b.createOTLPLogs()
+	if err != nil {
+		return nil, 0, err
+	}
+	buf, err := plogotlp.NewExportRequestFromLogs(logs).MarshalProto()
+	if err != nil {
+		return nil, 0, err
+	}
+	return buf, entriesCount, nil
+}
+
+// createOTLPLogs converts the batch to OTLP logs. Each stream becomes a
+// resource whose attributes are the stream labels, and each entry becomes a
+// log record whose attributes are the entry's structured metadata.
+func (b *batch) createOTLPLogs() (plog.Logs, int, error) {
+	logs := plog.NewLogs()
+
+	entriesCount := 0
+	for _, stream := range b.streams {
+		ls, err := promql_parser.ParseMetric(stream.Labels)
+		if err != nil {
+			return plog.Logs{}, 0, fmt.Errorf("failed to parse stream labels %s: %w", stream.Labels, err)
+		}
+
+		rl := logs.ResourceLogs().AppendEmpty()
+		resourceAttrs := rl.Resource().Attributes()
+		ls.Range(func(l labels.Label) {
+			resourceAttrs.PutStr(l.Name, l.Value)
+		})
+
+		records := rl.ScopeLogs().AppendEmpty().LogRecords()
+		records.EnsureCapacity(len(stream.Entries))
+		for _, entry := range stream.Entries {
+			record := records.AppendEmpty()
+			record.SetTimestamp(pcommon.NewTimestampFromTime(entry.Timestamp))
+			record.Body().SetStr(entry.Line)
+			for _, md := range entry.StructuredMetadata {
+				record.Attributes().PutStr(md.Name, md.Value)
+			}
+		}
+		entriesCount += len(stream.Entries)
+	}
+	return logs, entriesCount, nil
+}
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+
+	"github.com/grafana/agent/internal/component/common/loki"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/push"
+)
+
+func TestBatch_createOTLPLogs(t *testing.T) {
+	b := newBatch(0,
+		loki.Entry{Labels: model.LabelSet{"app": "foo", "env": "prod"}, Entry: logproto.Entry{Timestamp: time.Unix(1, 5).UTC(), Line: "line1"}},
+		loki.Entry{Labels: model.LabelSet{"app": "foo", "env": "prod"}, Entry: logproto.Entry{
+			Timestamp:          time.Unix(2, 0).UTC(),
+			Line:               "line2",
+			StructuredMetadata: push.LabelsAdapter{{Name: "trace_id", Value: "abc"}},
+		}},
+		loki.Entry{Labels: model.LabelSet{"app": "bar", ReservedLabelTenantID: "tenant-1"}, Entry: logproto.Entry{Timestamp: time.Unix(3, 0).UTC(), Line: "line3"}},
+	)
+
+	logs, entriesCount, err := b.createOTLPLogs()
+	require.NoError(t, err)
+	require.Equal(t, 3, entriesCount)
+	require.Equal(t, 3, logs.LogRecordCount())
+	require.Equal(t, 2, logs.ResourceLogs().Len())
+
+	type record struct {
+		Timestamp  time.Time
+		Body       string
+		Attributes map[string]any
+	}
+	recordsByResource := map[string][]record{}
+	for i := 0; i < logs.ResourceLogs().Len(); i++ {
+		rl := logs.ResourceLogs().At(i)
+		resource := rl.Resource().Attributes().AsRaw()
+		// The tenant is sent as a header, not as an attribute.
+		require.NotContains(t, resource, ReservedLabelTenantID)
+
+		key := resource["app"].(string)
+		if env, ok := resource["env"]; ok {
+			key += "/" + env.(string)
+		}
+
+		records := rl.ScopeLogs().At(0).LogRecords()
+		for j := 0; j < records.Len(); j++ {
+			lr := records.At(j)
+			recordsByResource[key] = append(recordsByResource[key], record{
+				Timestamp:  lr.Timestamp().AsTime(),
+				Body:       lr.Body().Str(),
+				Attributes: lr.Attributes().AsRaw(),
+			})
+		}
+	}
+
+	require.Equal(t, map[string][]record{
+		"foo/prod": {
+			{Timestamp: time.Unix(1, 5).UTC(), Body: "line1", Attributes: map[string]any{}},
+			{Timestamp: time.Unix(2, 0).UTC(), Body: "line2", Attributes: map[string]any{"trace_id": "abc"}},
+		},
+		"bar": {
+			{Timestamp: time.Unix(3, 0).UTC(), Body: "line3", Attributes: map[string]any{}},
+		},
+	}, recordsByResource)
+}
+
+func TestProtocolOf(t *testing.T) {
+	for _, tc := range []struct {
+		protocol    string
+		expected    string
+		expectedErr string
+	}{
+		{protocol: "", expected: ProtocolLoki},
+		{protocol: ProtocolLoki, expected: ProtocolLoki},
+		{protocol: ProtocolOTLPHTTP, expected: ProtocolOTLPHTTP},
+		{protocol: "otlpgrpc", expectedErr: `unsupported protocol "otlpgrpc", must be one of "loki" or "otlphttp"`},
+	} {
+		actual, err := protocolOf(Config{Protocol: tc.protocol})
+		if tc.expectedErr != "" {
+			require.EqualError(t, err, tc.expectedErr)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, actual)
+	}
+}
+
+func TestClient_OTLPHTTP(t *testing.T) {
+	type receivedReq struct {
+		tenantID string
+		logs     plog.Logs
+	}
+	receivedReqs := make(chan receivedReq, 10)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first request to exercise retries.
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		req := plogotlp.NewExportRequest()
+		if r.Header.Get("Content-Type") != "application/x-protobuf" || req.UnmarshalProto(body) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		receivedReqs <- receivedReq{tenantID: r.Header.Get("X-Scope-OrgID"), logs: req.Logs()}
+	}))
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL+"/v1/logs"))
+
+	reg := prometheus.NewRegistry()
+	cfg := Config{
+		URL:           serverURL,
+		Protocol:      ProtocolOTLPHTTP,
+		BatchWait:     100 * time.Millisecond,
+		BatchSize:     1024,
+		Client:        config.HTTPClientConfig{},
+		BackoffConfig: backoff.Config{MinBackoff: 1 * time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxRetries: 3},
+		Timeout:       1 * time.Second,
+		TenantID:      "tenant-1",
+	}
+
+	c, err := New(NewMetrics(reg), cfg, 0, 0, false, log.NewNopLogger())
+	require.NoError(t, err)
+
+	c.Chan() <- loki.Entry{Labels: model.LabelSet{"app": "foo"}, Entry: logproto.Entry{Timestamp: time.Unix(1, 0).UTC(), Line: "line1"}}
+	c.Chan() <- loki.Entry{Labels: model.LabelSet{"app": "foo"}, Entry: logproto.Entry{Timestamp: time.Unix(2, 0).UTC(), Line: "line2"}}
+	c.Stop()
+	close(receivedReqs)
+
+	var lines []string
+	for req := range receivedReqs {
+		require.Equal(t, "tenant-1", req.tenantID)
+		rls := req.logs.ResourceLogs()
+		for i := 0; i < rls.Len(); i++ {
+			require.Equal(t, map[string]any{"app": "foo"}, rls.At(i).Resource().Attributes().AsRaw())
+			records := rls.At(i).ScopeLogs().At(0).LogRecords()
+			for j := 0; j < records.Len(); j++ {
+				lines = append(lines, records.At(j).Body().Str())
+			}
+		}
+	}
+	require.Equal(t, []string{"line1", "line2"}, lines)
+
+	expectedMetrics := strings.Replace(`
+		# HELP loki_write_requests_total Number of send requests, by push protocol.
+		# TYPE loki_write_requests_total counter
+		loki_write_requests_total{host="__HOST__",protocol="otlphttp",status_code="200"} 1
+		loki_write_requests_total{host="__HOST__",protocol="otlphttp",status_code="503"} 1
+		# HELP loki_write_sent_entries_total Number of log entries sent to the ingester.
+		# TYPE loki_write_sent_entries_total counter
+		loki_write_sent_entries_total{host="__HOST__"} 2
+	`, "__HOST__", serverURL.Host, -1)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expectedMetrics), "loki_write_requests_total", "loki_write_sent_entries_total"))
+}
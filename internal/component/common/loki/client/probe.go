@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/dskit/backoff"
+)
+
+// ProbeConfig configures the probe of the endpoint of a client when the
+// client is created, which pushes a request without any entry to detect
+// unreachable endpoints or invalid credentials before the first batch is
+// sent.
+type ProbeConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Timeout of each probe request. Zero means ProbeTimeout.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// ProbeState is the state of the startup probe of a client.
+type ProbeState int
+
+const (
+	// ProbeDisabled means the endpoint isn't probed.
+	ProbeDisabled ProbeState = iota
+	// ProbePending means the first probe request is in progress.
+	ProbePending
+	// ProbeSucceeded means a probe request succeeded.
+	ProbeSucceeded
+	// ProbeFailed means the probe requests failed so far. They are retried
+	// until one succeeds.
+	ProbeFailed
+)
+
+func (s ProbeState) String() string {
+	switch s {
+	case ProbeDisabled:
+		return "disabled"
+	case ProbePending:
+		return "pending"
+	case ProbeSucceeded:
+		return "succeeded"
+	case ProbeFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// ProbeResult is the result of the startup probe of a client.
+type ProbeResult struct {
+	State ProbeState
+	Err   error // Error of the last probe request when State is ProbeFailed.
+}
+
+// probingClient is implemented by the clients whose endpoint can be probed.
+type probingClient interface {
+	// probe pushes a request without any entry to the endpoint.
+	probe(ctx context.Context, timeout time.Duration) error
+}
+
+// prober probes the endpoint of a client in the background, retrying with
+// the backoff of the client until a probe request succeeds.
+type prober struct {
+	mut    sync.Mutex
+	result ProbeResult
+}
+
+func (p *prober) get() ProbeResult {
+	if p == nil {
+		return ProbeResult{State: ProbeDisabled}
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.result
+}
+
+func (p *prober) set(res ProbeResult) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.result = res
+}
+
+// run probes the endpoint of c until a probe request succeeds or ctx is
+// done. Only the first failure is logged, as a warning.
+func (p *prober) run(ctx context.Context, c probingClient, cfg Config, logger log.Logger) {
+	timeout := cfg.Probe.Timeout
+	if timeout <= 0 {
+		timeout = ProbeTimeout
+	}
+	backoffCfg := cfg.BackoffConfig
+	backoffCfg.MaxRetries = 0
+
+	logger = log.With(logger, "host", cfg.URL.Host)
+	bo := backoff.New(ctx, backoffCfg)
+	for bo.Ongoing() {
+		err := c.probe(ctx, timeout)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			if p.get().State == ProbeFailed {
+				level.Info(logger).Log("msg", "endpoint probe succeeded after failing")
+			}
+			p.set(ProbeResult{State: ProbeSucceeded})
+			return
+		}
+
+		if p.get().State != ProbeFailed {
+			level.Warn(logger).Log("msg", "endpoint probe failed, check the URL and the credentials of the endpoint; sending will be retried", "err", err)
+		}
+		p.set(ProbeResult{State: ProbeFailed, Err: err})
+		bo.Wait()
+	}
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/agent/internal/component/common/loki/wal"
+)
+
+func newProbeTestManager(t *testing.T, rawURL string, probeTimeout time.Duration) *Manager {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+
+	m, err := NewManager(NewMetrics(prometheus.NewRegistry()), log.NewNopLogger(), testLimitsConfig, prometheus.NewRegistry(), wal.Config{}, DedupConfig{}, NilNotifier, Config{
+		Name:          "probed",
+		URL:           flagext.URLValue{URL: u},
+		BatchWait:     100 * time.Millisecond,
+		BatchSize:     10,
+		Timeout:       10 * time.Second,
+		BackoffConfig: backoff.Config{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, MaxRetries: 1},
+		Probe:         ProbeConfig{Enabled: true, Timeout: probeTimeout},
+	})
+	require.NoError(t, err)
+	return m
+}
+
+func TestManager_ProbeUnreachable(t *testing.T) {
+	// Nothing listens on the address once the listener is closed.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	m := newProbeTestManager(t, "http://"+l.Addr().String()+"/loki/api/v1/push", time.Second)
+
+	require.Eventually(t, func() bool {
+		return len(m.FailedProbes()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Error(t, m.FailedProbes()["probed"])
+
+	info := m.DebugInfo()
+	require.Equal(t, ProbeFailed, info[0].Probe.State)
+	require.Error(t, info[0].Probe.Err)
+
+	// The retries of the probe don't block stopping the manager.
+	stopped := make(chan struct{})
+	go func() {
+		m.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "stopping the manager timed out")
+	}
+}
+
+func TestManager_ProbeDoesNotBlock(t *testing.T) {
+	// The endpoint accepts connections but never responds.
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	start := time.Now()
+	m := newProbeTestManager(t, srv.URL, 10*time.Second)
+	defer m.Stop()
+
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, ProbePending, m.DebugInfo()[0].Probe.State)
+	require.Empty(t, m.FailedProbes())
+}
+
+func TestManager_ProbeRecovers(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Inc() == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	m := newProbeTestManager(t, srv.URL, time.Second)
+	defer m.Stop()
+
+	require.Eventually(t, func() bool {
+		return m.DebugInfo()[0].Probe.State == ProbeSucceeded
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, m.FailedProbes())
+	require.Equal(t, int64(2), requests.Load())
+}
+
+func TestManager_ProbeDisabled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	m, err := NewManager(NewMetrics(prometheus.NewRegistry()), log.NewNopLogger(), testLimitsConfig, prometheus.NewRegistry(), wal.Config{}, DedupConfig{}, NilNotifier, Config{
+		URL:       flagext.URLValue{URL: u},
+		BatchWait: 100 * time.Millisecond,
+		BatchSize: 10,
+		Timeout:   time.Second,
+	})
+	require.NoError(t, err)
+	defer m.Stop()
+
+	require.Equal(t, ProbeDisabled, m.DebugInfo()[0].Probe.State)
+}
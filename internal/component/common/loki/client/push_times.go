@@ -0,0 +1,71 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// PushTimes holds the times of the last push requests of a client. The zero
+// time means the client didn't send such a request yet.
+type PushTimes struct {
+	LastSuccess time.Time // Last push request accepted by the endpoint.
+	LastError   time.Time // Last push request which failed, retried or not.
+}
+
+// pushRecorder records the times of the push requests of a client, and exports
+// them as metrics so that alerts can detect clients which stopped pushing.
+type pushRecorder struct {
+	host    string
+	metrics *Metrics
+
+	mut   sync.Mutex
+	times PushTimes
+}
+
+// newPushRecorder creates the pushRecorder of the client pushing to host. Its
+// metrics are initialized to 0 when they don't exist yet, so that the series
+// of clients which never pushed are exported. Otherwise, the times recorded by
+// the previous client pushing to host are carried over, so that rebuilding
+// the clients on reload doesn't reset them.
+func newPushRecorder(host string, metrics *Metrics) *pushRecorder {
+	return &pushRecorder{
+		host:    host,
+		metrics: metrics,
+		times: PushTimes{
+			LastSuccess: gaugeTime(metrics.lastSuccessfulPush.WithLabelValues(host)),
+			LastError:   gaugeTime(metrics.lastPushError.WithLabelValues(host)),
+		},
+	}
+}
+
+// gaugeTime returns the time held by a gauge set to a Unix timestamp in
+// seconds, or the zero time if the gauge is 0.
+func gaugeTime(g prometheus.Gauge) time.Time {
+	var m dto.Metric
+	if err := g.Write(&m); err != nil || m.GetGauge().GetValue() == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(m.GetGauge().GetValue()*1e9))
+}
+
+// record records the outcome of a push request sent at now.
+func (p *pushRecorder) record(now time.Time, err error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if err == nil {
+		p.times.LastSuccess = now
+		p.metrics.lastSuccessfulPush.WithLabelValues(p.host).Set(float64(now.UnixNano()) / 1e9)
+	} else {
+		p.times.LastError = now
+		p.metrics.lastPushError.WithLabelValues(p.host).Set(float64(now.UnixNano()) / 1e9)
+	}
+}
+
+func (p *pushRecorder) get() PushTimes {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.times
+}
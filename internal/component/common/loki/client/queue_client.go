@@ -16,7 +16,6 @@ import (
 	"github.com/go-kit/log/level"
 	agentWal "github.com/grafana/agent/internal/component/common/loki/wal"
 	"github.com/grafana/dskit/backoff"
-	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/record"
@@ -164,6 +163,12 @@ type queueClient struct {
 	wg sync.WaitGroup
 
 	externalLabels model.LabelSet
+	protocol       string
+	tenants        *tenantLabels
+	breaker        *circuitBreaker
+	sampler        batchSampler
+	drops          dropSampler
+	pushes         *pushRecorder
 
 	// series cache
 	series        map[chunks.HeadSeriesRef]model.LabelSet
@@ -178,6 +183,11 @@ type queueClient struct {
 	maxLineSizeTruncate bool
 	quit                chan struct{}
 	markerHandler       MarkerHandler
+
+	// pauseCtx is canceled when the client stops, to stop waiting for the
+	// circuit breaker.
+	pauseCtx    context.Context
+	cancelPause context.CancelFunc
 }
 
 // NewQueue creates a new queueClient.
@@ -189,8 +199,13 @@ func newQueueClient(metrics *Metrics, qcMetrics *QueueClientMetrics, cfg Config,
 	if cfg.URL.URL == nil {
 		return nil, errors.New("client needs target URL")
 	}
+	protocol, err := protocolOf(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+	pauseCtx, cancelPause := context.WithCancel(ctx)
 
 	c := &queueClient{
 		logger:       log.With(logger, "component", "client", "host", cfg.URL.Host),
@@ -207,35 +222,39 @@ func newQueueClient(metrics *Metrics, qcMetrics *QueueClientMetrics, cfg Config,
 		seriesSegment: make(map[chunks.HeadSeriesRef]int),
 
 		externalLabels:      cfg.ExternalLabels.LabelSet,
+		protocol:            protocol,
+		tenants:             newTenantLabels(cfg.MaxTenants),
 		ctx:                 ctx,
 		cancel:              cancel,
 		maxStreams:          maxStreams,
 		maxLineSize:         maxLineSize,
 		maxLineSizeTruncate: maxLineSizeTruncate,
+		pauseCtx:            pauseCtx,
+		cancelPause:         cancelPause,
 	}
+	c.breaker = newClientCircuitBreaker(cfg, metrics, c.logger)
 
 	// The buffered channel size is calculated using the configured capacity, which is the worst case number of bytes
 	// the send queue can consume.
 	var queueBufferSize = cfg.Queue.Capacity / cfg.BatchSize
 	c.sendQueue = newQueue(c, queueBufferSize, logger)
 
-	err := cfg.Client.Validate()
+	err = cfg.Client.Validate()
 	if err != nil {
 		return nil, err
 	}
 
-	c.client, err = config.NewClientFromConfig(cfg.Client, "GrafanaAgent", config.WithHTTP2Disabled())
+	c.client, err = newHTTPClient(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	c.client.Timeout = cfg.Timeout
-
 	// Initialize counters to 0 so the metrics are exported before the first
 	// occurrence of incrementing to avoid missing metrics.
 	for _, counter := range c.metrics.countersWithHost {
 		counter.WithLabelValues(c.cfg.URL.Host).Add(0)
 	}
+	c.pushes = newPushRecorder(c.cfg.URL.Host, c.metrics)
 
 	c.wg.Add(1)
 	go c.runSendOldBatches()
@@ -247,12 +266,12 @@ func (c *queueClient) initBatchMetrics(tenantID string) {
 	// occurrence of incrementing to avoid missing metrics.
 	for _, counter := range c.metrics.countersWithHostTenantReason {
 		for _, reason := range Reasons {
-			counter.WithLabelValues(c.cfg.URL.Host, tenantID, reason).Add(0)
+			counter.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), reason).Add(0)
 		}
 	}
 
 	for _, counter := range c.metrics.countersWithHostTenant {
-		counter.WithLabelValues(c.cfg.URL.Host, tenantID).Add(0)
+		counter.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID)).Add(0)
 	}
 }
 
@@ -306,18 +325,27 @@ func (c *queueClient) AppendEntries(entries wal.RefEntries, segment int) error {
 
 func (c *queueClient) appendSingleEntry(segmentNum int, lbs model.LabelSet, e logproto.Entry) {
 	lbs, tenantID := c.processLabels(lbs)
+	if c.cfg.StripStructuredMetadata {
+		e.StructuredMetadata = nil
+	}
+
+	lbs, ok := applyLabelLimits(c.cfg, c.metrics, c.tenants, &c.drops, tenantID, lbs, entrySize(e))
+	if !ok {
+		return
+	}
 
-	// Either drop or mutate the log entry because its length is greater than maxLineSize. maxLineSize == 0 means disabled.
-	if c.maxLineSize != 0 && len(e.Line) > c.maxLineSize {
-		if !c.maxLineSizeTruncate {
-			c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonLineTooLong).Inc()
-			c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonLineTooLong).Add(float64(len(e.Line)))
+	// Either drop or mutate the log entry because its size, structured metadata included, is greater than maxLineSize.
+	// maxLineSize == 0 means disabled.
+	if size := entrySize(e); c.maxLineSize != 0 && size > c.maxLineSize {
+		if !c.maxLineSizeTruncate || !truncateLine(&e, c.maxLineSize) {
+			c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonLineTooLong).Inc()
+			c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonLineTooLong).Add(float64(size))
+			c.drops.observe(ReasonLineTooLong, labelsMapToString(lbs, ReservedLabelTenantID), 1)
 			return
 		}
 
-		c.metrics.mutatedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonLineTooLong).Inc()
-		c.metrics.mutatedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonLineTooLong).Add(float64(len(e.Line) - c.maxLineSize))
-		e.Line = e.Line[:c.maxLineSize]
+		c.metrics.mutatedEntries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonLineTooLong).Inc()
+		c.metrics.mutatedBytes.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonLineTooLong).Add(float64(size - c.maxLineSize))
 	}
 
 	// TODO: can I make this locking more fine grained?
@@ -365,8 +393,9 @@ func (c *queueClient) appendSingleEntry(segmentNum int, lbs model.LabelSet, e lo
 		if err.Error() == errMaxStreamsLimitExceeded {
 			reason = ReasonStreamLimited
 		}
-		c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, reason).Add(float64(len(e.Line)))
-		c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, reason).Inc()
+		c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), reason).Add(float64(entrySize(e)))
+		c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), reason).Inc()
+		c.drops.observe(reason, labelsMapToString(lbs, ReservedLabelTenantID), 1)
 	}
 }
 
@@ -448,28 +477,52 @@ func (c *queueClient) enqueuePendingBatches(ctx context.Context) {
 }
 
 func (c *queueClient) sendBatch(ctx context.Context, tenantID string, batch *batch) {
-	buf, entriesCount, err := batch.encode()
+	c.sampler.observe(tenantID, batch)
+
+	requests, oversized, err := encodeRequests(c.protocol, batch, c.cfg.MaxRequestBytes, c.maxLineSizeTruncate)
 	if err != nil {
 		level.Error(c.logger).Log("msg", "error encoding batch", "error", err)
 		return
 	}
+	c.metrics.observeOversized(c.cfg.URL.Host, c.tenants.label(tenantID), oversized)
+	c.drops.observeOversized(oversized)
+
+	for _, req := range requests {
+		c.sendRequest(ctx, tenantID, req)
+	}
+}
+
+// sendRequest sends an encoded push request, retrying on failures.
+func (c *queueClient) sendRequest(ctx context.Context, tenantID string, req encodedRequest) {
+	buf, entriesCount := req.buf, req.entries
 	bufBytes := float64(len(buf))
 	c.metrics.encodedBytes.WithLabelValues(c.cfg.URL.Host).Add(bufBytes)
 
 	backoff := backoff.New(c.ctx, c.cfg.BackoffConfig)
-	var status int
+	var (
+		status int
+		err    error
+	)
 	for {
+		if err = c.breaker.acquire(c.pauseCtx); err != nil {
+			break
+		}
+
 		start := time.Now()
 		// send uses `timeout` internally, so `context.Background` is good enough.
 		status, err = c.send(ctx, tenantID, buf)
+		c.breaker.record(requestFailed(status, err))
+		c.pushes.record(time.Now(), err)
 
 		c.metrics.requestDuration.WithLabelValues(strconv.Itoa(status), c.cfg.URL.Host).Observe(time.Since(start).Seconds())
+		c.metrics.requests.WithLabelValues(strconv.Itoa(status), c.cfg.URL.Host, c.protocol).Inc()
 
 		// Immediately drop rate limited batches to avoid HOL blocking for other tenants not experiencing throttling
 		if c.cfg.DropRateLimitedBatches && batchIsRateLimited(status) {
 			level.Warn(c.logger).Log("msg", "dropping batch due to rate limiting applied at ingester")
-			c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonRateLimited).Add(bufBytes)
-			c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, ReasonRateLimited).Add(float64(entriesCount))
+			c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonRateLimited).Add(bufBytes)
+			c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), ReasonRateLimited).Add(float64(entriesCount))
+			c.drops.observeRequest(ReasonRateLimited, req)
 			return
 		}
 
@@ -486,7 +539,15 @@ func (c *queueClient) sendBatch(ctx context.Context, tenantID string, batch *bat
 		}
 
 		level.Warn(c.logger).Log("msg", "error sending batch, will retry", "status", status, "tenant", tenantID, "error", err)
-		c.metrics.batchRetries.WithLabelValues(c.cfg.URL.Host, tenantID).Inc()
+		c.metrics.batchRetries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID)).Inc()
+
+		// The batch isn't given up on while the circuit breaker is open: it's
+		// retried once the breaker lets a request through. Meanwhile the send
+		// queue fills up, which pauses the WAL watcher.
+		if c.breaker.isOpen() {
+			continue
+		}
+
 		backoff.Wait()
 
 		// Make sure it sends at least once before checking for retry.
@@ -503,8 +564,9 @@ func (c *queueClient) sendBatch(ctx context.Context, tenantID string, batch *bat
 		if batchIsRateLimited(status) {
 			dropReason = ReasonRateLimited
 		}
-		c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, tenantID, dropReason).Add(bufBytes)
-		c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, tenantID, dropReason).Add(float64(entriesCount))
+		c.metrics.droppedBytes.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), dropReason).Add(bufBytes)
+		c.metrics.droppedEntries.WithLabelValues(c.cfg.URL.Host, c.tenants.label(tenantID), dropReason).Add(float64(entriesCount))
+		c.drops.observeRequest(dropReason, req)
 	}
 }
 
@@ -553,6 +615,18 @@ func (c *queueClient) send(ctx context.Context, tenantID string, buf []byte) (in
 	return resp.StatusCode, err
 }
 
+// probe implements probingClient.
+func (c *queueClient) probe(ctx context.Context, timeout time.Duration) error {
+	buf, _, err := encodeBatch(c.protocol, newBatch(0))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, err = c.send(ctx, c.cfg.TenantID, buf)
+	return err
+}
+
 func (c *queueClient) getTenantID(labels model.LabelSet) string {
 	// Check if it has been overridden while processing the pipeline stages
 	if value, ok := labels[ReservedLabelTenantID]; ok {
@@ -572,8 +646,10 @@ func (c *queueClient) getTenantID(labels model.LabelSet) string {
 // Stop the client, enqueueing pending batches and draining the send queue accordingly. Both closing operations are
 // limited by a deadline, controlled by a configured drain timeout, which is global to the Stop call.
 func (c *queueClient) Stop() {
-	// first close main queue routine
+	// first close main queue routine, and give up on batches paused by the
+	// circuit breaker so that it doesn't block on a full send queue
 	close(c.quit)
+	c.cancelPause()
 	c.wg.Wait()
 
 	// fire timeout timer
@@ -602,9 +678,30 @@ func (c *queueClient) StopNow() {
 	c.markerHandler.Stop()
 }
 
+func (c *queueClient) circuitBreakerState() CircuitBreakerState {
+	return c.breaker.currentState()
+}
+
+func (c *queueClient) sampleBatches(n int) {
+	c.sampler.start(n)
+}
+
+func (c *queueClient) batchSamples() ([]BatchSample, int) {
+	return c.sampler.state()
+}
+
+func (c *queueClient) takeDropSamples() []DropSample {
+	return c.drops.take()
+}
+
+func (c *queueClient) pushTimes() PushTimes {
+	return c.pushes.get()
+}
+
 func (c *queueClient) processLabels(lbs model.LabelSet) (model.LabelSet, string) {
-	if len(c.externalLabels) > 0 {
-		lbs = c.externalLabels.Merge(lbs)
+	lbs, conflict := mergeExternalLabels(c.externalLabels, lbs)
+	if conflict {
+		c.metrics.externalLabelsConflicts.WithLabelValues(c.cfg.URL.Host).Inc()
 	}
 	tenantID := c.getTenantID(lbs)
 	return lbs, tenantID
@@ -2,6 +2,9 @@ package client
 
 import (
 	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
@@ -14,6 +17,7 @@ import (
 	"github.com/grafana/dskit/backoff"
 	"github.com/grafana/dskit/flagext"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
@@ -24,6 +28,7 @@ import (
 
 	"github.com/grafana/loki/pkg/ingester/wal"
 	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/push"
 	lokiflag "github.com/grafana/loki/pkg/util/flagext"
 )
 
@@ -181,6 +186,326 @@ func TestQueueClient(t *testing.T) {
 	}
 }
 
+func TestQueueClient_ExternalLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	receivedReqsChan := make(chan utils.RemoteWriteRequest, 10)
+	server := utils.NewRemoteWriteServer(receivedReqsChan, 200)
+	require.NotNil(t, server)
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	cfg := Config{
+		URL:           serverURL,
+		BatchWait:     100 * time.Millisecond,
+		BatchSize:     1024,
+		Client:        config.HTTPClientConfig{},
+		BackoffConfig: backoff.Config{MinBackoff: 5 * time.Second, MaxBackoff: 10 * time.Second, MaxRetries: 1},
+		ExternalLabels: lokiflag.LabelSet{LabelSet: model.LabelSet{
+			"cluster": "prod",
+		}},
+		Timeout: 1 * time.Second,
+		Queue: QueueConfig{
+			Capacity:     10 * 1024,
+			DrainTimeout: time.Second,
+		},
+	}
+
+	qc, err := NewQueue(NewMetrics(reg), NewQueueClientMetrics(reg).CurryWithId("test"), cfg, 0, 0, false, log.NewNopLogger(), nilMarkerHandler{})
+	require.NoError(t, err)
+
+	qc.StoreSeries([]record.RefSeries{
+		{Ref: 1, Labels: labels.FromStrings("app", "foo")},
+		{Ref: 2, Labels: labels.FromStrings("app", "bar", "cluster", "dev")},
+	}, 0)
+	for _, ref := range []chunks.HeadSeriesRef{1, 2} {
+		_ = qc.AppendEntries(wal.RefEntries{
+			Ref:     ref,
+			Entries: []logproto.Entry{{Timestamp: time.Now(), Line: "line"}},
+		}, 0)
+	}
+
+	var streams []string
+	require.Eventually(t, func() bool {
+		select {
+		case req := <-receivedReqsChan:
+			for _, s := range req.Request.Streams {
+				streams = append(streams, s.Labels)
+			}
+		default:
+		}
+		return len(streams) == 2
+	}, 5*time.Second, 10*time.Millisecond, "timed out waiting for entries to arrive")
+
+	qc.Stop()
+
+	require.ElementsMatch(t, []string{
+		`{app="foo", cluster="prod"}`,
+		`{app="bar", cluster="dev"}`,
+	}, streams)
+	require.Equal(t, 1.0, testutil.ToFloat64(qc.(*queueClient).metrics.externalLabelsConflicts.WithLabelValues(serverURL.Host)))
+}
+
+func TestQueueClient_StructuredMetadata(t *testing.T) {
+	traceID := push.LabelsAdapter{{Name: "trace_id", Value: "12345"}}
+
+	for _, strip := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strip=%t", strip), func(t *testing.T) {
+			receivedReqsChan := make(chan utils.RemoteWriteRequest, 10)
+			server := utils.NewRemoteWriteServer(receivedReqsChan, 200)
+			require.NotNil(t, server)
+			defer server.Close()
+
+			serverURL := flagext.URLValue{}
+			require.NoError(t, serverURL.Set(server.URL))
+
+			cfg := Config{
+				URL:                     serverURL,
+				BatchWait:               100 * time.Millisecond,
+				BatchSize:               1024,
+				Client:                  config.HTTPClientConfig{},
+				BackoffConfig:           backoff.Config{MinBackoff: 5 * time.Second, MaxBackoff: 10 * time.Second, MaxRetries: 1},
+				Timeout:                 1 * time.Second,
+				StripStructuredMetadata: strip,
+				Queue: QueueConfig{
+					Capacity:     10 * 1024,
+					DrainTimeout: time.Second,
+				},
+			}
+
+			reg := prometheus.NewRegistry()
+			qc, err := NewQueue(NewMetrics(reg), NewQueueClientMetrics(reg).CurryWithId("test"), cfg, 0, 0, false, log.NewNopLogger(), nilMarkerHandler{})
+			require.NoError(t, err)
+
+			qc.StoreSeries([]record.RefSeries{{Ref: 1, Labels: labels.FromStrings("app", "foo")}}, 0)
+			_ = qc.AppendEntries(wal.RefEntries{
+				Ref:     1,
+				Entries: []logproto.Entry{{Timestamp: time.Unix(1, 0).UTC(), Line: "line", StructuredMetadata: traceID}},
+			}, 0)
+
+			var received []logproto.Entry
+			require.Eventually(t, func() bool {
+				select {
+				case req := <-receivedReqsChan:
+					for _, s := range req.Request.Streams {
+						received = append(received, s.Entries...)
+					}
+				default:
+				}
+				return len(received) == 1
+			}, 5*time.Second, 10*time.Millisecond, "timed out waiting for entries to arrive")
+
+			qc.Stop()
+
+			expected := logproto.Entry{Timestamp: time.Unix(1, 0).UTC(), Line: "line", StructuredMetadata: traceID}
+			if strip {
+				expected.StructuredMetadata = nil
+			}
+			require.Equal(t, []logproto.Entry{expected}, received)
+		})
+	}
+}
+
+func TestQueueClient_CircuitBreakerKeepsBatches(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// The first requests fail, more times than the batch is retried.
+		if requests.Inc() <= 4 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	cfg := Config{
+		URL:           serverURL,
+		BatchWait:     10 * time.Millisecond,
+		BatchSize:     1024,
+		Client:        config.HTTPClientConfig{},
+		BackoffConfig: backoff.Config{MinBackoff: 1 * time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxRetries: 1},
+		Timeout:       1 * time.Second,
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold: 1,
+			OpenDuration:     20 * time.Millisecond,
+		},
+		Queue: QueueConfig{
+			Capacity:     10 * 1024,
+			DrainTimeout: time.Second,
+		},
+	}
+
+	qc, err := NewQueue(NewMetrics(reg), NewQueueClientMetrics(reg).CurryWithId("test"), cfg, 0, 0, false, log.NewNopLogger(), nilMarkerHandler{})
+	require.NoError(t, err)
+	defer qc.Stop()
+
+	qc.StoreSeries([]record.RefSeries{{Ref: 1, Labels: labels.FromStrings("app", "foo")}}, 0)
+	_ = qc.AppendEntries(wal.RefEntries{
+		Ref:     1,
+		Entries: []logproto.Entry{{Timestamp: time.Now(), Line: "line"}},
+	}, 0)
+
+	metrics := qc.(*queueClient).metrics
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.sentEntries.WithLabelValues(serverURL.Host)) == 1
+	}, 5*time.Second, 10*time.Millisecond, "timed out waiting for entries to be sent")
+	require.Equal(t, int64(5), requests.Load())
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.droppedEntries.WithLabelValues(serverURL.Host, "", ReasonGeneric)))
+	require.Equal(t, CircuitBreakerClosed, qc.(*queueClient).circuitBreakerState())
+
+	// The failed requests are recorded, followed by the successful one.
+	times := qc.(*queueClient).pushTimes()
+	require.False(t, times.LastError.IsZero())
+	require.True(t, times.LastSuccess.After(times.LastError))
+	require.Equal(t, float64(times.LastSuccess.UnixNano())/1e9, testutil.ToFloat64(metrics.lastSuccessfulPush.WithLabelValues(serverURL.Host)))
+}
+
+func TestQueueClient_InterleavedTenants(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	receivedReqsChan := make(chan utils.RemoteWriteRequest, 10)
+	server := utils.NewRemoteWriteServer(receivedReqsChan, 200)
+	require.NotNil(t, server)
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	cfg := Config{
+		URL:           serverURL,
+		BatchWait:     100 * time.Millisecond,
+		BatchSize:     1024,
+		Client:        config.HTTPClientConfig{},
+		BackoffConfig: backoff.Config{MinBackoff: 5 * time.Second, MaxBackoff: 10 * time.Second, MaxRetries: 1},
+		Timeout:       1 * time.Second,
+		TenantID:      "default",
+		MaxTenants:    2,
+		Queue: QueueConfig{
+			Capacity:     10 * 1024,
+			DrainTimeout: time.Second,
+		},
+	}
+
+	qc, err := NewQueue(NewMetrics(reg), NewQueueClientMetrics(reg).CurryWithId("test"), cfg, 0, 0, false, log.NewNopLogger(), nilMarkerHandler{})
+	require.NoError(t, err)
+
+	qc.StoreSeries([]record.RefSeries{
+		{Ref: 1, Labels: labels.FromStrings("app", "foo")},
+		{Ref: 2, Labels: labels.FromStrings("app", "foo", ReservedLabelTenantID, "tenant-1")},
+		{Ref: 3, Labels: labels.FromStrings("app", "foo", ReservedLabelTenantID, "tenant-2")},
+		{Ref: 4, Labels: labels.FromStrings("app", "foo", ReservedLabelTenantID, "tenant-3")},
+	}, 0)
+	for i, ref := range []chunks.HeadSeriesRef{1, 2, 1, 3, 2, 4} {
+		_ = qc.AppendEntries(wal.RefEntries{
+			Ref:     ref,
+			Entries: []logproto.Entry{{Timestamp: time.Unix(int64(i), 0), Line: fmt.Sprintf("line%d", i)}},
+		}, 0)
+	}
+
+	linesByTenant := map[string][]string{}
+	received := 0
+	require.Eventually(t, func() bool {
+		select {
+		case req := <-receivedReqsChan:
+			for _, s := range req.Request.Streams {
+				require.Equal(t, `{app="foo"}`, s.Labels)
+				for _, e := range s.Entries {
+					linesByTenant[req.TenantID] = append(linesByTenant[req.TenantID], e.Line)
+					received++
+				}
+			}
+		default:
+		}
+		return received == 6
+	}, 5*time.Second, 10*time.Millisecond, "timed out waiting for entries to arrive")
+
+	qc.Stop()
+
+	require.Equal(t, map[string][]string{
+		"default":  {"line0", "line2"},
+		"tenant-1": {"line1", "line4"},
+		"tenant-2": {"line3"},
+		"tenant-3": {"line5"},
+	}, linesByTenant)
+
+	host := serverURL.Host
+	batchRetries := qc.(*queueClient).metrics.batchRetries
+	require.Equal(t, 3, testutil.CollectAndCount(batchRetries))
+	require.Equal(t, 0.0, testutil.ToFloat64(batchRetries.WithLabelValues(host, TenantOverflowLabelValue)))
+}
+
+func TestQueueClient_MaxRequestBytes(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	receivedReqsChan := make(chan utils.RemoteWriteRequest, 10)
+	server := utils.NewRemoteWriteServer(receivedReqsChan, 200)
+	require.NotNil(t, server)
+	defer server.Close()
+
+	serverURL := flagext.URLValue{}
+	require.NoError(t, serverURL.Set(server.URL))
+
+	cfg := Config{
+		URL:             serverURL,
+		BatchWait:       100 * time.Millisecond,
+		BatchSize:       10 * 1024,
+		MaxRequestBytes: 1000,
+		Client:          config.HTTPClientConfig{},
+		BackoffConfig:   backoff.Config{MinBackoff: 1 * time.Millisecond, MaxBackoff: 2 * time.Millisecond, MaxRetries: 1},
+		Timeout:         1 * time.Second,
+		Queue: QueueConfig{
+			Capacity:     100 * 1024,
+			DrainTimeout: time.Second,
+		},
+	}
+
+	qc, err := NewQueue(NewMetrics(reg), NewQueueClientMetrics(reg).CurryWithId("test"), cfg, 0, 0, false, log.NewNopLogger(), nilMarkerHandler{})
+	require.NoError(t, err)
+	defer qc.Stop()
+
+	// Both entries fit in the batch, but not in a single request.
+	rnd := rand.New(rand.NewSource(1))
+	lines := []string{randomLine(rnd, 600), randomLine(rnd, 600)}
+	qc.StoreSeries([]record.RefSeries{
+		{Ref: 1, Labels: labels.FromStrings("app", "foo")},
+		{Ref: 2, Labels: labels.FromStrings("app", "bar")},
+	}, 0)
+	for i, ref := range []chunks.HeadSeriesRef{1, 2} {
+		_ = qc.AppendEntries(wal.RefEntries{
+			Ref:     ref,
+			Entries: []logproto.Entry{{Timestamp: time.Unix(int64(i), 0), Line: lines[i]}},
+		}, 0)
+	}
+
+	var (
+		requests int
+		received []string
+	)
+	require.Eventually(t, func() bool {
+		select {
+		case req := <-receivedReqsChan:
+			requests++
+			for _, s := range req.Request.Streams {
+				for _, e := range s.Entries {
+					received = append(received, e.Line)
+				}
+			}
+		default:
+		}
+		return len(received) == 2
+	}, 5*time.Second, 10*time.Millisecond, "timed out waiting for entries to arrive")
+
+	require.Equal(t, 2, requests)
+	require.ElementsMatch(t, lines, received)
+}
+
 func BenchmarkClientImplementations(b *testing.B) {
 	for name, bc := range map[string]testCase{
 		"100 entries, single series, no batching": {
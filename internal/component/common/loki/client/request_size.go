@@ -0,0 +1,145 @@
+package client
+
+import (
+	"sort"
+
+	"github.com/grafana/loki/pkg/logproto"
+)
+
+// encodedRequest is the encoded body of a push request.
+type encodedRequest struct {
+	buf     []byte
+	entries int
+
+	// The streams of the request are either all the streams of batch, or
+	// streams when the batch was split.
+	batch   *batch
+	streams []logproto.Stream
+}
+
+// oversizedEntries counts the entries which didn't fit in a request on their
+// own, and were either truncated or dropped.
+type oversizedEntries struct {
+	truncatedEntries, truncatedBytes int
+	droppedEntries, droppedBytes     int
+	droppedLabels                    []string // Labels of the stream of each dropped entry.
+}
+
+// encodeRequests encodes b as push requests whose encoded size is at most
+// maxBytes. A batch too large to be sent in a single request is split along
+// stream boundaries, and streams too large on their own are split between
+// their entries. Entries too large on their own have their line truncated to
+// fit if truncate is true, or else are dropped. Zero maxBytes disables the
+// limit.
+func encodeRequests(protocol string, b *batch, maxBytes int, truncate bool) ([]encodedRequest, oversizedEntries, error) {
+	buf, entries, err := encodeBatch(protocol, b)
+	if err != nil {
+		return nil, oversizedEntries{}, err
+	}
+	if maxBytes <= 0 || len(buf) <= maxBytes {
+		return []encodedRequest{{buf: buf, entries: entries, batch: b}}, oversizedEntries{}, nil
+	}
+
+	streams := make([]logproto.Stream, 0, len(b.streams))
+	for _, stream := range b.streams {
+		streams = append(streams, *stream)
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].Labels < streams[j].Labels })
+
+	s := requestSplitter{protocol: protocol, maxBytes: maxBytes, truncate: truncate}
+	if err := s.split(streams); err != nil {
+		return nil, oversizedEntries{}, err
+	}
+	return s.requests, s.oversized, nil
+}
+
+type requestSplitter struct {
+	protocol string
+	maxBytes int
+	truncate bool
+
+	requests  []encodedRequest
+	oversized oversizedEntries
+}
+
+// split halves streams until each half fits in a request.
+func (s *requestSplitter) split(streams []logproto.Stream) error {
+	buf, entries, err := s.encode(streams)
+	if err != nil {
+		return err
+	}
+	if len(buf) <= s.maxBytes {
+		s.requests = append(s.requests, encodedRequest{buf: buf, entries: entries, streams: streams})
+		return nil
+	}
+
+	switch {
+	case len(streams) > 1:
+		mid := len(streams) / 2
+		if err := s.split(streams[:mid]); err != nil {
+			return err
+		}
+		return s.split(streams[mid:])
+
+	case len(streams[0].Entries) > 1:
+		stream := streams[0]
+		mid := len(stream.Entries) / 2
+		if err := s.split([]logproto.Stream{{Labels: stream.Labels, Entries: stream.Entries[:mid]}}); err != nil {
+			return err
+		}
+		return s.split([]logproto.Stream{{Labels: stream.Labels, Entries: stream.Entries[mid:]}})
+
+	default:
+		return s.fitEntry(streams[0].Labels, streams[0].Entries[0])
+	}
+}
+
+// fitEntry sends entry, a single entry too large to fit in a request, with
+// the longest line which fits if truncating is enabled. Otherwise, or if no
+// line fits, the entry is dropped.
+func (s *requestSplitter) fitEntry(labels string, entry logproto.Entry) error {
+	if s.truncate {
+		var (
+			fit    *encodedRequest
+			fitLen int
+			line   = entry.Line
+		)
+		// Look for the longest line that fits in a request.
+		lo, hi := 0, len(line)-1
+		for lo <= hi {
+			mid := (lo + hi) / 2
+			entry.Line = line[:mid]
+			streams := []logproto.Stream{{Labels: labels, Entries: []logproto.Entry{entry}}}
+			buf, entries, err := s.encode(streams)
+			if err != nil {
+				return err
+			}
+			if len(buf) > s.maxBytes {
+				hi = mid - 1
+				continue
+			}
+			fit, fitLen = &encodedRequest{buf: buf, entries: entries, streams: streams}, mid
+			lo = mid + 1
+		}
+		if fit != nil {
+			s.requests = append(s.requests, *fit)
+			s.oversized.truncatedEntries++
+			s.oversized.truncatedBytes += len(line) - fitLen
+			return nil
+		}
+		entry.Line = line
+	}
+
+	s.oversized.droppedEntries++
+	s.oversized.droppedBytes += entrySize(entry)
+	s.oversized.droppedLabels = append(s.oversized.droppedLabels, labels)
+	return nil
+}
+
+func (s *requestSplitter) encode(streams []logproto.Stream) ([]byte, int, error) {
+	b := &batch{streams: make(map[string]*logproto.Stream, len(streams))}
+	for i := range streams {
+		b.streams[streams[i].Labels] = &streams[i]
+	}
+	return encodeBatch(s.protocol, b)
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/grafana/agent/internal/component/common/loki"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeRequests(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	entry := func(app string, size int) loki.Entry {
+		return loki.Entry{
+			Labels: model.LabelSet{"app": model.LabelValue(app)},
+			Entry:  logproto.Entry{Timestamp: time.Unix(1, 0), Line: randomLine(rnd, size)},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		entries  []loki.Entry
+		maxBytes int
+		truncate bool
+
+		expectRequests  [][]string // Labels of the streams of each request.
+		expectEntries   int
+		expectOversized oversizedEntries
+	}{
+		{
+			name:           "no limit",
+			entries:        []loki.Entry{entry("a", 600), entry("b", 600)},
+			expectRequests: [][]string{{`{app="a"}`, `{app="b"}`}},
+			expectEntries:  2,
+		},
+		{
+			name:           "within the limit",
+			entries:        []loki.Entry{entry("a", 100), entry("b", 100)},
+			maxBytes:       1000,
+			expectRequests: [][]string{{`{app="a"}`, `{app="b"}`}},
+			expectEntries:  2,
+		},
+		{
+			name:           "split between streams",
+			entries:        []loki.Entry{entry("b", 600), entry("a", 600)},
+			maxBytes:       1000,
+			expectRequests: [][]string{{`{app="a"}`}, {`{app="b"}`}},
+			expectEntries:  2,
+		},
+		{
+			name:           "split within a stream",
+			entries:        []loki.Entry{entry("a", 600), entry("a", 600)},
+			maxBytes:       1000,
+			expectRequests: [][]string{{`{app="a"}`}, {`{app="a"}`}},
+			expectEntries:  2,
+		},
+		{
+			name:            "entry too large is dropped",
+			entries:         []loki.Entry{entry("a", 100), entry("b", 2000)},
+			maxBytes:        1000,
+			expectRequests:  [][]string{{`{app="a"}`}},
+			expectEntries:   1,
+			expectOversized: oversizedEntries{droppedEntries: 1, droppedBytes: 2000, droppedLabels: []string{`{app="b"}`}},
+		},
+		{
+			name:           "entry too large is truncated",
+			entries:        []loki.Entry{entry("a", 100), entry("b", 2000)},
+			maxBytes:       1000,
+			truncate:       true,
+			expectRequests: [][]string{{`{app="a"}`}, {`{app="b"}`}},
+			expectEntries:  2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newBatch(0, tc.entries...)
+
+			requests, oversized, err := encodeRequests(ProtocolLoki, b, tc.maxBytes, tc.truncate)
+			require.NoError(t, err)
+
+			var (
+				streams [][]string
+				entries int
+			)
+			for _, req := range requests {
+				if tc.maxBytes > 0 {
+					require.LessOrEqual(t, len(req.buf), tc.maxBytes)
+				}
+				pr := decodePushRequest(t, req.buf)
+
+				var labels []string
+				for _, s := range pr.Streams {
+					labels = append(labels, s.Labels)
+					entries += len(s.Entries)
+				}
+				streams = append(streams, labels)
+			}
+			require.Len(t, streams, len(tc.expectRequests))
+			for i := range streams {
+				require.ElementsMatch(t, tc.expectRequests[i], streams[i])
+			}
+			require.Equal(t, tc.expectEntries, entries)
+
+			if !tc.truncate {
+				require.Equal(t, tc.expectOversized, oversized)
+				return
+			}
+			require.Equal(t, 1, oversized.truncatedEntries)
+			require.Greater(t, oversized.truncatedBytes, 1000)
+			require.Zero(t, oversized.droppedEntries)
+		})
+	}
+}
+
+func decodePushRequest(t *testing.T, buf []byte) logproto.PushRequest {
+	t.Helper()
+
+	decoded, err := snappy.Decode(nil, buf)
+	require.NoError(t, err)
+	var req logproto.PushRequest
+	require.NoError(t, proto.Unmarshal(decoded, &req))
+	return req
+}
+
+// randomLine returns a line of size bytes which snappy can't compress.
+func randomLine(rnd *rand.Rand, size int) string {
+	b := make([]byte, size/2)
+	_, _ = rnd.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -13,6 +13,7 @@ var DefaultWatchConfig = WatchConfig{
 	MinReadFrequency: 250 * time.Millisecond,
 	MaxReadFrequency: time.Second,
 	DrainTimeout:     15 * time.Second,
+	CorruptionPolicy: CorruptionPolicySkip,
 }
 
 // Config contains all WAL-related settings.
@@ -31,6 +32,10 @@ type Config struct {
 	// Note that this functionality will likely be deprecated in favour of a programmatic cleanup mechanism.
 	MaxSegmentAge time.Duration
 
+	// MaxSizeBytes is the maximum size of the WAL of each client. When a WAL grows bigger, its oldest segments are
+	// deleted, even if their entries weren't sent yet. Zero means no limit.
+	MaxSizeBytes int64
+
 	// WatchConfig configures the backoff retry used by a WAL watcher when reading from segments not via
 	// the notification channel.
 	WatchConfig WatchConfig
@@ -54,6 +59,20 @@ type WatchConfig struct {
 	// DrainTimeout is the maximum amount of time that the Watcher can spend draining the remaining segments in the WAL.
 	// After that time, the Watcher is stopped immediately, dropping all the work in process.
 	DrainTimeout time.Duration
+
+	// ReplayEntriesPerSecond limits the rate at which entries are read while the Watcher is replaying segments behind
+	// the head of the WAL, for example after a restart or an outage. Tailing the live segment is never limited. Zero
+	// means no limit.
+	ReplayEntriesPerSecond float64
+
+	// ReplayBytesPerSecond limits the rate, in log line bytes, at which entries are read while the Watcher is replaying
+	// segments behind the head of the WAL. Zero means no limit.
+	ReplayBytesPerSecond float64
+
+	// CorruptionPolicy is either CorruptionPolicySkip or CorruptionPolicyHalt. It decides whether the Watcher skips corrupt
+	// records, or stops reading the WAL at the first one, for an operator to inspect or remove the corrupt segment.
+	// Empty means CorruptionPolicySkip.
+	CorruptionPolicy string
 }
 
 // UnmarshalYAML implement YAML Unmarshaler
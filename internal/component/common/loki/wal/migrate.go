@@ -0,0 +1,134 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/logging/level"
+)
+
+const (
+	// sharedMarkerDir and sharedMarkerFile locate the segment marker of a WAL shared by all clients. They match the
+	// marker location used by the client package.
+	sharedMarkerDir  = "remote"
+	sharedMarkerFile = "segment_marker"
+
+	migratedDirMode os.FileMode = 0o700
+)
+
+// migrateSharedWAL moves the segments of a WAL shared by all clients, as written before each client had its own WAL,
+// to the WAL directory of each client. The segment marker is carried over too, so that clients don't send again the
+// entries they already sent. Clients whose WAL directory already holds segments are left as is.
+func migrateSharedWAL(dir string, clientNames []string, logger log.Logger) error {
+	segments, err := listSegments(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading segments in wal directory: %w", err)
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+
+	markerPath := filepath.Join(dir, sharedMarkerDir, sharedMarkerFile)
+	_, err = os.Stat(markerPath)
+	hasMarker := err == nil
+
+	for _, name := range clientNames {
+		clientDir := ClientDir(dir, name)
+		existing, err := listSegments(clientDir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error reading segments of client %s: %w", name, err)
+		}
+		if len(existing) > 0 {
+			continue
+		}
+
+		if err := os.MkdirAll(clientDir, migratedDirMode); err != nil {
+			return err
+		}
+		// Segments aren't written to once a newer one exists, and a WAL always starts a new segment when opened, so
+		// clients can share the migrated segments through hard links.
+		for _, segment := range segments {
+			if err := linkOrCopy(filepath.Join(dir, segment.name), filepath.Join(clientDir, segment.name)); err != nil {
+				return fmt.Errorf("error migrating segment %s for client %s: %w", segment.name, name, err)
+			}
+		}
+		if hasMarker {
+			// The marker is replaced on update rather than written in place, so a link is safe as well.
+			if err := os.MkdirAll(filepath.Join(clientDir, sharedMarkerDir), migratedDirMode); err != nil {
+				return err
+			}
+			if err := linkOrCopy(markerPath, filepath.Join(clientDir, sharedMarkerDir, sharedMarkerFile)); err != nil {
+				return fmt.Errorf("error migrating segment marker for client %s: %w", name, err)
+			}
+		}
+	}
+
+	for _, segment := range segments {
+		if err := os.Remove(filepath.Join(dir, segment.name)); err != nil {
+			return fmt.Errorf("error removing migrated segment %s: %w", segment.name, err)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(dir, sharedMarkerDir)); err != nil {
+		return fmt.Errorf("error removing migrated segment marker: %w", err)
+	}
+
+	level.Info(logger).Log("msg", "migrated shared WAL to client directories", "segments", len(segments), "clients", len(clientNames))
+	return nil
+}
+
+// removeUnusedClientDirs removes the WAL directories of clients which aren't named in clientNames anymore, so that the
+// WAL of a removed client isn't left behind. The WAL names of clients must not change when their config is updated, or
+// the entries they haven't sent yet would be removed.
+func removeUnusedClientDirs(dir string, clientNames []string, logger log.Logger) error {
+	entries, err := os.ReadDir(filepath.Join(dir, clientsDirName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading client directories: %w", err)
+	}
+
+	used := make(map[string]struct{}, len(clientNames))
+	for _, name := range clientNames {
+		used[filepath.Base(ClientDir(dir, name))] = struct{}{}
+	}
+	for _, entry := range entries {
+		if _, ok := used[entry.Name()]; ok || !entry.IsDir() {
+			continue
+		}
+		clientDir := filepath.Join(dir, clientsDirName, entry.Name())
+		if err := os.RemoveAll(clientDir); err != nil {
+			return fmt.Errorf("error removing WAL directory %s: %w", clientDir, err)
+		}
+		level.Warn(logger).Log("msg", "removed WAL of a client which isn't configured anymore, its entries not sent yet are lost", "dir", clientDir)
+	}
+	return nil
+}
+
+// linkOrCopy hard links src to dst, falling back to copying src when links aren't supported.
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,73 @@
+package wal
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// replayLimiter paces the entries dispatched by a Watcher while it's replaying segments behind the head of the WAL.
+// Both limits are optional, and a nil limiter means that dimension is not limited.
+type replayLimiter struct {
+	entries *rate.Limiter
+	bytes   *rate.Limiter
+}
+
+// newReplayLimiter creates a replayLimiter from the replay settings in cfg. Returns nil if no limit is configured.
+func newReplayLimiter(cfg WatchConfig) *replayLimiter {
+	if cfg.ReplayEntriesPerSecond <= 0 && cfg.ReplayBytesPerSecond <= 0 {
+		return nil
+	}
+	return &replayLimiter{
+		entries: newRateLimiter(cfg.ReplayEntriesPerSecond),
+		bytes:   newRateLimiter(cfg.ReplayBytesPerSecond),
+	}
+}
+
+func newRateLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	// Allow bursting up to one second worth of events, but always at least one, so that every event can be admitted.
+	return rate.NewLimiter(rate.Limit(perSecond), max(int(perSecond), 1))
+}
+
+// wait blocks until entries entries, totalling size bytes, can be dispatched according to the configured limits, or
+// until done is closed. It returns whether it was throttled, that is, if it had to block at all.
+func (l *replayLimiter) wait(done <-chan struct{}, entries, size int) bool {
+	throttledEntries := waitN(done, l.entries, entries)
+	throttledBytes := waitN(done, l.bytes, size)
+	return throttledEntries || throttledBytes
+}
+
+// waitN reserves n events from lim, splitting the reservation in chunks no bigger than the limiter burst, and
+// sleeps until they are available or done is closed.
+func waitN(done <-chan struct{}, lim *rate.Limiter, n int) bool {
+	if lim == nil {
+		return false
+	}
+
+	var throttled bool
+	for n > 0 {
+		chunk := min(n, lim.Burst())
+		n -= chunk
+
+		now := time.Now()
+		r := lim.ReserveN(now, chunk)
+		delay := r.DelayFrom(now)
+		if delay <= 0 {
+			continue
+		}
+
+		throttled = true
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-done:
+			t.Stop()
+			r.Cancel()
+			return throttled
+		}
+	}
+	return throttled
+}
@@ -92,10 +92,20 @@ type Watcher struct {
 	drainTimeout time.Duration
 	marker       Marker
 	savedSegment int
+	// replayLimiter paces reads while replaying segments behind the head of the WAL. Nil if not limited.
+	replayLimiter *replayLimiter
+	// corruptionPolicy is either CorruptionPolicySkip or CorruptionPolicyHalt.
+	corruptionPolicy string
+	// corruptSegment is the last segment found corrupt, so that each corrupt segment is only logged once.
+	corruptSegment int
 }
 
 // NewWatcher creates a new Watcher.
 func NewWatcher(walDir, id string, metrics *WatcherMetrics, writeTo WriteTo, logger log.Logger, config WatchConfig, marker Marker) *Watcher {
+	corruptionPolicy := config.CorruptionPolicy
+	if corruptionPolicy == "" {
+		corruptionPolicy = CorruptionPolicySkip
+	}
 	return &Watcher{
 		walDir:       walDir,
 		id:           id,
@@ -111,12 +121,17 @@ func NewWatcher(walDir, id string, metrics *WatcherMetrics, writeTo WriteTo, log
 		minReadFreq:  config.MinReadFrequency,
 		maxReadFreq:  config.MaxReadFrequency,
 		drainTimeout: config.DrainTimeout,
+
+		replayLimiter:    newReplayLimiter(config),
+		corruptionPolicy: corruptionPolicy,
+		corruptSegment:   -1,
 	}
 }
 
 // Start runs the watcher main loop.
 func (w *Watcher) Start() {
 	w.metrics.watchersRunning.WithLabelValues().Inc()
+	w.metrics.halted.WithLabelValues(w.id).Set(0)
 	go w.mainLoop()
 }
 
@@ -207,6 +222,11 @@ func (w *Watcher) watch(segmentNum int, tail bool) error {
 
 	reader := wlog.NewLiveReader(w.logger, nil, segment)
 
+	if tail {
+		// Reading from the head of the WAL is never throttled.
+		w.metrics.replayThrottled.WithLabelValues(w.id).Set(0)
+	}
+
 	readTimer := newBackoffTimer(w.minReadFreq, w.maxReadFreq)
 
 	segmentTicker := time.NewTicker(segmentCheckPeriod)
@@ -248,12 +268,16 @@ func (w *Watcher) watch(segmentNum int, tail bool) error {
 			}
 
 			// We now that there's either a new segment (last > segmentNum), or we are draining the WAL. Either case, read
-			// the remaining data from the segmentNum and return from `watch` to read the next one.
-			_, err = w.readSegment(reader, segmentNum)
+			// the remaining data from the segmentNum and return from `watch` to read the next one. Since the segment is
+			// behind the head, this read is subject to the replay rate limit.
+			_, err = w.readSegment(reader, segmentNum, true)
 			if debug {
 				level.Warn(w.logger).Log("msg", "Error reading segment inside segmentTicker", "segment", segmentNum, "read", reader.Offset(), "err", err)
 			}
 
+			if isCorruption(err) {
+				return w.handleCorruptSegment(segmentNum, reader.Offset(), false, err)
+			}
 			// io.EOF error are non-fatal since we are consuming the segment till the end
 			if errors.Unwrap(err) != io.EOF {
 				return err
@@ -274,7 +298,7 @@ func (w *Watcher) watch(segmentNum int, tail bool) error {
 		}
 
 		// read from open segment routine
-		ok, err := w.readSegment(reader, segmentNum)
+		ok, err := w.readSegment(reader, segmentNum, !tail)
 		if debug {
 			level.Warn(w.logger).Log("msg", "Error reading segment inside read ticker or notification", "segment", segmentNum, "read", reader.Offset(), "err", err)
 		}
@@ -284,6 +308,9 @@ func (w *Watcher) watch(segmentNum int, tail bool) error {
 		// to the end of it. If error, log a warning accordingly. After, error or no error, nil is returned so that the
 		// caller can continue to the following segment.
 		if !tail {
+			if isCorruption(err) {
+				return w.handleCorruptSegment(segmentNum, reader.Offset(), false, err)
+			}
 			if err != nil && errors.Unwrap(err) != io.EOF {
 				level.Warn(w.logger).Log("msg", "Ignoring error reading to end of segment, may have dropped data", "segment", segmentNum, "err", err)
 			} else if reader.Offset() != size {
@@ -292,6 +319,10 @@ func (w *Watcher) watch(segmentNum int, tail bool) error {
 			return nil
 		}
 
+		// Without a policy skipping them, corrupt records would be read again on every retry, never making progress.
+		if isCorruption(err) {
+			return w.handleCorruptSegment(segmentNum, reader.Offset(), true, err)
+		}
 		// io.EOF error are non-fatal since we are tailing the wal
 		if errors.Unwrap(err) != io.EOF {
 			return err
@@ -307,32 +338,41 @@ func (w *Watcher) watch(segmentNum int, tail bool) error {
 	}
 }
 
-// Read entries from a segment, decode them and dispatch them.
-func (w *Watcher) readSegment(r *wlog.LiveReader, segmentNum int) (bool, error) {
+// Read entries from a segment, decode them and dispatch them. If replaying is true, the segment is behind the head of
+// the WAL and dispatching entries is subject to the replay rate limit.
+func (w *Watcher) readSegment(r *wlog.LiveReader, segmentNum int, replaying bool) (bool, error) {
 	var readData bool
 
 	for r.Next() && !w.state.IsStopping() {
 		rec := r.Record()
 		w.metrics.recordsRead.WithLabelValues(w.id).Inc()
-		read, err := w.decodeAndDispatch(rec, segmentNum)
+		read, err := w.decodeAndDispatch(rec, segmentNum, replaying)
 		// keep true if data was read at least once
 		readData = readData || read
+		if errors.Is(err, errCorruptRecord) && w.corruptionPolicy == CorruptionPolicySkip {
+			w.skipCorruptRecord(segmentNum, len(rec), err)
+			continue
+		}
 		if err != nil {
 			return readData, fmt.Errorf("error decoding record: %w", err)
 		}
 	}
+	// The reader only fails with errors other than io.EOF on records failing their checksum or torn.
+	if err := r.Err(); err != nil && err != io.EOF {
+		return readData, fmt.Errorf("segment %d: %w: %w", segmentNum, errCorruptSegment, err)
+	}
 	return readData, fmt.Errorf("segment %d: %w", segmentNum, r.Err())
 }
 
 // decodeAndDispatch first decodes a WAL record. Upon reading either Series or Entries from the WAL record, call the
 // appropriate callbacks in the writeTo.
-func (w *Watcher) decodeAndDispatch(b []byte, segmentNum int) (bool, error) {
+func (w *Watcher) decodeAndDispatch(b []byte, segmentNum int, replaying bool) (bool, error) {
 	var readData bool
 
 	rec := recordPool.GetRecord()
 	if err := wal.DecodeRecord(b, rec); err != nil {
 		w.metrics.recordDecodeFails.WithLabelValues(w.id).Inc()
-		return readData, err
+		return readData, fmt.Errorf("%w: %w", errCorruptRecord, err)
 	}
 
 	// First process all series to ensure we don't write entries to non-existent series.
@@ -341,6 +381,9 @@ func (w *Watcher) decodeAndDispatch(b []byte, segmentNum int) (bool, error) {
 	readData = true
 
 	for _, entries := range rec.RefEntries {
+		if replaying {
+			w.throttleReplay(entries)
+		}
 		if err := w.actions.AppendEntries(entries, segmentNum); err != nil && firstErr == nil {
 			firstErr = err
 		}
@@ -349,6 +392,25 @@ func (w *Watcher) decodeAndDispatch(b []byte, segmentNum int) (bool, error) {
 	return readData, firstErr
 }
 
+// throttleReplay blocks until entries can be dispatched according to the replay rate limit. Replay is not throttled
+// while draining, since the Watcher is racing against the drain timeout.
+func (w *Watcher) throttleReplay(entries wal.RefEntries) {
+	if w.replayLimiter == nil || w.state.IsDraining() {
+		return
+	}
+
+	var size int
+	for _, e := range entries.Entries {
+		size += len(e.Line)
+		for _, md := range e.StructuredMetadata {
+			size += md.Size()
+		}
+	}
+	if w.replayLimiter.wait(w.state.WaitForStopping(), len(entries.Entries), size) {
+		w.metrics.replayThrottled.WithLabelValues(w.id).Set(1)
+	}
+}
+
 // Drain moves the Watcher to a draining state, which will assume no more data is being written to the WAL, and it will
 // attempt to read until the end of the last written segment. The calling routine of Drain will block until all data is
 // read, or a timeout occurs.
@@ -0,0 +1,114 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+)
+
+const (
+	// CorruptionPolicySkip skips corrupt records which can't be decoded, and
+	// the rest of a segment after a record failing its checksum or torn by a
+	// crash, whose end can't be found.
+	CorruptionPolicySkip = "skip"
+	// CorruptionPolicyHalt stops reading the WAL at the first corrupt record,
+	// until the corrupt segment is removed and the Watcher restarted.
+	CorruptionPolicyHalt = "halt"
+)
+
+var (
+	// errCorruptSegment is returned when a record of a segment fails its
+	// checksum or is torn. The rest of the segment can't be read.
+	errCorruptSegment = errors.New("corrupt segment")
+	// errCorruptRecord is returned when a record passes its checksum but can't
+	// be decoded.
+	errCorruptRecord = errors.New("corrupt record")
+)
+
+// ValidateCorruptionPolicy returns an error if policy is unknown. An empty
+// policy means CorruptionPolicySkip.
+func ValidateCorruptionPolicy(policy string) error {
+	switch policy {
+	case "", CorruptionPolicySkip, CorruptionPolicyHalt:
+		return nil
+	default:
+		return fmt.Errorf("unsupported corruption policy %q, must be one of %q or %q", policy, CorruptionPolicySkip, CorruptionPolicyHalt)
+	}
+}
+
+func isCorruption(err error) bool {
+	return errors.Is(err, errCorruptSegment) || errors.Is(err, errCorruptRecord)
+}
+
+// logCorruption logs that segmentNum is corrupt, once per segment.
+func (w *Watcher) logCorruption(segmentNum int, err error) {
+	if segmentNum == w.corruptSegment {
+		return
+	}
+	w.corruptSegment = segmentNum
+
+	segment := wlog.SegmentName(w.walDir, segmentNum)
+	if w.corruptionPolicy == CorruptionPolicyHalt {
+		level.Error(w.logger).Log("msg", "WAL segment is corrupt, halting until it's removed and the component restarted", "segment", segment, "err", err)
+		return
+	}
+	level.Warn(w.logger).Log("msg", "WAL segment is corrupt, skipping corrupt data", "segment", segment, "err", err)
+}
+
+// skipCorruptRecord accounts for a record of segmentNum which couldn't be
+// decoded and is skipped.
+func (w *Watcher) skipCorruptRecord(segmentNum int, size int, err error) {
+	w.logCorruption(segmentNum, err)
+	w.metrics.corruptSkippedRecords.WithLabelValues(w.id).Inc()
+	w.metrics.corruptSkippedBytes.WithLabelValues(w.id).Add(float64(size))
+}
+
+// handleCorruptSegment applies the corruption policy once segmentNum can't be
+// read past offset. With CorruptionPolicySkip, it waits for the next segment
+// to exist when tail is true, and returns nil so that the Watcher moves on to
+// it. With CorruptionPolicyHalt, it blocks until the Watcher stops.
+func (w *Watcher) handleCorruptSegment(segmentNum int, offset int64, tail bool, err error) error {
+	w.logCorruption(segmentNum, err)
+
+	if w.corruptionPolicy == CorruptionPolicyHalt {
+		w.metrics.halted.WithLabelValues(w.id).Set(1)
+		<-w.state.WaitForStopping()
+		return nil
+	}
+
+	if tail {
+		if err := w.waitForNextSegment(segmentNum); err != nil {
+			return err
+		}
+	}
+	if size, err := getSegmentSize(w.walDir, segmentNum); err == nil && size > offset {
+		w.metrics.corruptSkippedBytes.WithLabelValues(w.id).Add(float64(size - offset))
+	}
+	return nil
+}
+
+// waitForNextSegment blocks until a segment after segmentNum exists, the
+// Watcher drains or stops.
+func (w *Watcher) waitForNextSegment(segmentNum int) error {
+	ticker := time.NewTicker(segmentCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		_, last, err := w.firstAndLast()
+		if err != nil {
+			return fmt.Errorf("segments: %w", err)
+		}
+		if last > segmentNum || w.state.IsDraining() {
+			return nil
+		}
+
+		select {
+		case <-w.state.WaitForStopping():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -12,7 +12,11 @@ type WatcherMetrics struct {
 	segmentRead               *prometheus.CounterVec
 	currentSegment            *prometheus.GaugeVec
 	replaySegment             *prometheus.GaugeVec
+	replayThrottled           *prometheus.GaugeVec
 	watchersRunning           *prometheus.GaugeVec
+	corruptSkippedRecords     *prometheus.CounterVec
+	corruptSkippedBytes       *prometheus.CounterVec
+	halted                    *prometheus.GaugeVec
 }
 
 func NewWatcherMetrics(reg prometheus.Registerer) *WatcherMetrics {
@@ -71,6 +75,15 @@ func NewWatcherMetrics(reg prometheus.Registerer) *WatcherMetrics {
 			},
 			[]string{"id"},
 		),
+		replayThrottled: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "loki_write",
+				Subsystem: "wal_watcher",
+				Name:      "replay_throttled",
+				Help:      "Whether the WAL watcher is being throttled by the replay rate limit (1) or not (0).",
+			},
+			[]string{"id"},
+		),
 		watchersRunning: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Namespace: "loki_write",
@@ -80,6 +93,33 @@ func NewWatcherMetrics(reg prometheus.Registerer) *WatcherMetrics {
 			},
 			nil,
 		),
+		corruptSkippedRecords: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "loki_write",
+				Subsystem: "wal_watcher",
+				Name:      "corrupt_skipped_records_total",
+				Help:      "Number of records skipped by the WAL watcher because they couldn't be decoded. Records in the skipped rest of a corrupt segment can't be counted.",
+			},
+			[]string{"id"},
+		),
+		corruptSkippedBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "loki_write",
+				Subsystem: "wal_watcher",
+				Name:      "corrupt_skipped_bytes_total",
+				Help:      "Number of bytes of corrupt records and segments skipped by the WAL watcher.",
+			},
+			[]string{"id"},
+		),
+		halted: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: "loki_write",
+				Subsystem: "wal_watcher",
+				Name:      "halted",
+				Help:      "Whether the WAL watcher stopped reading the WAL because of a corrupt segment (1) or not (0).",
+			},
+			[]string{"id"},
+		),
 	}
 
 	if reg != nil {
@@ -88,7 +128,11 @@ func NewWatcherMetrics(reg prometheus.Registerer) *WatcherMetrics {
 		m.droppedWriteNotifications = util.MustRegisterOrGet(reg, m.droppedWriteNotifications).(*prometheus.CounterVec)
 		m.segmentRead = util.MustRegisterOrGet(reg, m.segmentRead).(*prometheus.CounterVec)
 		m.currentSegment = util.MustRegisterOrGet(reg, m.currentSegment).(*prometheus.GaugeVec)
+		m.replayThrottled = util.MustRegisterOrGet(reg, m.replayThrottled).(*prometheus.GaugeVec)
 		m.watchersRunning = util.MustRegisterOrGet(reg, m.watchersRunning).(*prometheus.GaugeVec)
+		m.corruptSkippedRecords = util.MustRegisterOrGet(reg, m.corruptSkippedRecords).(*prometheus.CounterVec)
+		m.corruptSkippedBytes = util.MustRegisterOrGet(reg, m.corruptSkippedBytes).(*prometheus.CounterVec)
+		m.halted = util.MustRegisterOrGet(reg, m.halted).(*prometheus.GaugeVec)
 	}
 
 	return m
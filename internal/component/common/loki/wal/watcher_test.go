@@ -10,8 +10,10 @@ import (
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/flow/logging/level"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/tsdb/record"
+	"github.com/prometheus/prometheus/tsdb/wlog"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 
@@ -795,3 +797,239 @@ func TestWatcher_StopAndDrainWAL(t *testing.T) {
 		require.InDelta(t, 15, int(writeTo.entriesReceived.Load()), 1.0, "expected Watcher to consume at most +/- 1 entry from the WAL")
 	})
 }
+
+func TestWatcher_ReplayRateLimit(t *testing.T) {
+	labels := model.LabelSet{
+		"app": "test",
+	}
+	linesN := func(prefix string, n int) []string {
+		lines := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			lines = append(lines, fmt.Sprintf("%s %d", prefix, i))
+		}
+		return lines
+	}
+
+	// Allow replaying 10 entries per second, with a burst of 10. Replaying a backlog of 30 entries will take at least
+	// two seconds.
+	cfg := DefaultWatchConfig
+	cfg.ReplayEntriesPerSecond = 10
+
+	type setup struct {
+		watcher *Watcher
+		metrics *WatcherMetrics
+		writeTo *testWriteTo
+		wl      WAL
+		write   func(lines ...string)
+	}
+	newSetup := func(t *testing.T, markedSegment int) setup {
+		reg := prometheus.NewRegistry()
+		logger := level.NewFilter(log.NewLogfmtLogger(os.Stdout), level.AllowInfo())
+		dir := t.TempDir()
+		metrics := NewWatcherMetrics(reg)
+		writeTo := &testWriteTo{
+			series:      map[uint64]model.LabelSet{},
+			logger:      logger,
+			ReadEntries: utils.NewSyncSlice[loki.Entry](),
+		}
+		watcher := NewWatcher(dir, "test", metrics, writeTo, logger, cfg, mockMarker{
+			LastMarkedSegmentFunc: func() int {
+				return markedSegment
+			},
+		})
+		t.Cleanup(watcher.Stop)
+		wl, err := New(Config{
+			Enabled: true,
+			Dir:     dir,
+		}, logger, reg)
+		require.NoError(t, err)
+		t.Cleanup(wl.Close)
+
+		ew := newEntryWriter()
+		return setup{
+			watcher: watcher,
+			metrics: metrics,
+			writeTo: writeTo,
+			wl:      wl,
+			write: func(lines ...string) {
+				for _, line := range lines {
+					require.NoError(t, ew.WriteEntry(loki.Entry{
+						Labels: labels,
+						Entry: logproto.Entry{
+							Timestamp: time.Now(),
+							Line:      line,
+						},
+					}, wl, logger))
+				}
+				require.NoError(t, wl.Sync())
+			},
+		}
+	}
+	throttled := func(m *WatcherMetrics) float64 {
+		return testutil.ToFloat64(m.replayThrottled.WithLabelValues("test"))
+	}
+
+	t.Run("replaying a backlog is paced", func(t *testing.T) {
+		s := newSetup(t, 0)
+
+		// Segment 0 is the marked one, segment 1 is the backlog to replay, and segment 2 is the write head.
+		s.write("marked")
+		_, err := s.wl.NextSegment()
+		require.NoError(t, err)
+		backlog := linesN("backlog", 30)
+		s.write(backlog...)
+		_, err = s.wl.NextSegment()
+		require.NoError(t, err)
+		head := linesN("head", 30)
+		s.write(head...)
+
+		start := time.Now()
+		s.watcher.Start()
+
+		require.Eventually(t, func() bool {
+			return throttled(s.metrics) == 1
+		}, time.Second*5, 10*time.Millisecond, "expected watcher to be throttled while replaying")
+
+		require.Eventually(t, func() bool {
+			return s.writeTo.ReadEntries.Length() == len(backlog)+len(head)
+		}, time.Second*10, 10*time.Millisecond, "timed out waiting for watcher to catch up")
+		elapsed := time.Since(start)
+
+		s.writeTo.AssertContainsLines(t, backlog...)
+		s.writeTo.AssertContainsLines(t, head...)
+		// The first 10 entries are admitted by the burst, and the remaining 20 are paced at 10 entries per second.
+		require.GreaterOrEqual(t, elapsed, 1800*time.Millisecond, "replay was not paced")
+		require.Equal(t, float64(0), throttled(s.metrics), "expected watcher not to be throttled after catching up")
+	})
+
+	t.Run("tailing the head is not throttled", func(t *testing.T) {
+		s := newSetup(t, -1)
+		s.watcher.Start()
+
+		// Give the watcher time to start tailing the head, so entries aren't replayed.
+		time.Sleep(100 * time.Millisecond)
+
+		start := time.Now()
+		head := linesN("head", 30)
+		s.write(head...)
+		s.watcher.NotifyWrite()
+
+		require.Eventually(t, func() bool {
+			return s.writeTo.ReadEntries.Length() == len(head)
+		}, time.Second*10, 10*time.Millisecond, "timed out waiting for watcher to catch up")
+		require.Less(t, time.Since(start), 1500*time.Millisecond, "tailing should not be paced")
+		require.Equal(t, float64(0), throttled(s.metrics))
+	})
+}
+
+func TestWatcher_Corruption(t *testing.T) {
+	labels := model.LabelSet{
+		"app": "test",
+	}
+
+	type setup struct {
+		metrics *WatcherMetrics
+		writeTo *testWriteTo
+		wl      WAL
+		write   func(lines ...string)
+	}
+	// newSetup starts a watcher tailing segment 0, whose last record fails its checksum.
+	newSetup := func(t *testing.T, policy string) setup {
+		reg := prometheus.NewRegistry()
+		logger := level.NewFilter(log.NewLogfmtLogger(os.Stdout), level.AllowInfo())
+		dir := t.TempDir()
+		metrics := NewWatcherMetrics(reg)
+		writeTo := &testWriteTo{
+			series:      map[uint64]model.LabelSet{},
+			logger:      logger,
+			ReadEntries: utils.NewSyncSlice[loki.Entry](),
+		}
+		cfg := DefaultWatchConfig
+		cfg.CorruptionPolicy = policy
+		watcher := NewWatcher(dir, "test", metrics, writeTo, logger, cfg, noMarker{})
+		t.Cleanup(watcher.Stop)
+		wl, err := New(Config{
+			Enabled: true,
+			Dir:     dir,
+		}, logger, reg)
+		require.NoError(t, err)
+		t.Cleanup(wl.Close)
+
+		ew := newEntryWriter()
+		s := setup{
+			metrics: metrics,
+			writeTo: writeTo,
+			wl:      wl,
+			write: func(lines ...string) {
+				for _, line := range lines {
+					require.NoError(t, ew.WriteEntry(loki.Entry{
+						Labels: labels,
+						Entry: logproto.Entry{
+							Timestamp: time.Now(),
+							Line:      line,
+						},
+					}, wl, logger))
+				}
+				require.NoError(t, wl.Sync())
+			},
+		}
+
+		s.write("before corruption", "corrupt")
+
+		// Flip the last byte of the segment, which belongs to the last record.
+		f, err := os.OpenFile(wlog.SegmentName(dir, 0), os.O_RDWR, 0)
+		require.NoError(t, err)
+		stat, err := f.Stat()
+		require.NoError(t, err)
+		b := make([]byte, 1)
+		_, err = f.ReadAt(b, stat.Size()-1)
+		require.NoError(t, err)
+		b[0] ^= 0xff
+		_, err = f.WriteAt(b, stat.Size()-1)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		watcher.Start()
+		require.Eventually(t, func() bool {
+			return writeTo.ReadEntries.Length() == 1
+		}, time.Second*10, 10*time.Millisecond, "timed out waiting for the records before the corruption")
+		writeTo.AssertContainsLines(t, "before corruption")
+		return s
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		s := newSetup(t, CorruptionPolicySkip)
+
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(s.metrics.corruptSkippedBytes.WithLabelValues("test")) > 0
+		}, time.Second*10, 10*time.Millisecond, "expected the rest of the segment to be skipped")
+
+		// The watcher moves on to the next segment once it exists.
+		_, err := s.wl.NextSegment()
+		require.NoError(t, err)
+		s.write("after corruption")
+
+		require.Eventually(t, func() bool {
+			return s.writeTo.ReadEntries.Length() == 2
+		}, time.Second*10, 10*time.Millisecond, "timed out waiting for watcher to make progress")
+		s.writeTo.AssertContainsLines(t, "after corruption")
+		require.Equal(t, float64(0), testutil.ToFloat64(s.metrics.halted.WithLabelValues("test")))
+	})
+
+	t.Run("halt", func(t *testing.T) {
+		s := newSetup(t, CorruptionPolicyHalt)
+
+		require.Eventually(t, func() bool {
+			return testutil.ToFloat64(s.metrics.halted.WithLabelValues("test")) == 1
+		}, time.Second*10, 10*time.Millisecond, "expected watcher to halt")
+
+		_, err := s.wl.NextSegment()
+		require.NoError(t, err)
+		s.write("after corruption")
+
+		// Nothing is read past the corruption.
+		time.Sleep(time.Second)
+		require.Equal(t, 1, s.writeTo.ReadEntries.Length())
+		require.Equal(t, float64(0), testutil.ToFloat64(s.metrics.corruptSkippedBytes.WithLabelValues("test")))
+	})
+}
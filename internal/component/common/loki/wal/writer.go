@@ -1,7 +1,9 @@
 package wal
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -11,6 +13,7 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/agent/internal/util"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb/chunks"
@@ -24,6 +27,9 @@ import (
 
 const (
 	minimumCleanSegmentsEvery = time.Second
+
+	// clientsDirName is the directory holding the WAL directory of each client.
+	clientsDirName = "clients"
 )
 
 // CleanupEventSubscriber is an interface that objects that want to receive events from the wal Writer can implement. After
@@ -40,74 +46,141 @@ type WriteEventSubscriber interface {
 }
 
 // Writer implements loki.EntryHandler, exposing a channel were scraping targets can write to. Reading from there, it
-// writes incoming entries to a WAL.
-// Also, since Writer is responsible for all changing operations over the WAL, therefore a routine is run for cleaning
-// old segments.
+// writes incoming entries to the WAL of each client. Each client has its own WAL, under the directory returned by
+// ClientDir, so that a client falling behind only fills its own WAL.
+// Also, since Writer is responsible for all changing operations over the WALs, therefore a routine is run for cleaning
+// old segments, and the oldest segments of a WAL exceeding the maximum size.
 type Writer struct {
 	entries     chan loki.Entry
 	log         log.Logger
 	wg          sync.WaitGroup
 	once        sync.Once
-	wal         WAL
+	wals        []*clientWAL
 	entryWriter *entryWriter
+	maxSize     int64
 
-	cleanupSubscribersLock sync.RWMutex
-	cleanupSubscribers     []CleanupEventSubscriber
-
-	writeSubscribersLock sync.RWMutex
-	writeSubscribers     []WriteEventSubscriber
+	// reg unregisters the metrics of the Writer and of its WALs once stopped.
+	reg *util.Unregisterer
 
 	reclaimedOldSegmentsSpaceCounter *prometheus.CounterVec
 	lastReclaimedSegment             *prometheus.GaugeVec
 	lastWrittenTimestamp             *prometheus.GaugeVec
+	diskUsage                        *prometheus.GaugeVec
+	sizeLimitDroppedSegments         *prometheus.CounterVec
+	sizeLimitDroppedBytes            *prometheus.CounterVec
 
 	closeCleaner chan struct{}
 }
 
-// NewWriter creates a new Writer.
-func NewWriter(walCfg Config, logger log.Logger, reg prometheus.Registerer) (*Writer, error) {
-	// Start WAL
-	wl, err := New(Config{
-		Dir:     walCfg.Dir,
-		Enabled: true,
-	}, logger, reg)
-	if err != nil {
-		return nil, fmt.Errorf("error starting WAL: %w", err)
+// clientWAL is the WAL of a single client, along with the subscribers to its events.
+type clientWAL struct {
+	client string
+	wal    WAL
+
+	cleanupSubscribersLock sync.RWMutex
+	cleanupSubscribers     []CleanupEventSubscriber
+
+	writeSubscribersLock sync.RWMutex
+	writeSubscribers     []WriteEventSubscriber
+}
+
+// ClientDir returns the directory of the WAL of the client named clientName, under the WAL directory dir.
+func ClientDir(dir, clientName string) string {
+	return filepath.Join(dir, clientsDirName, url.PathEscape(clientName))
+}
+
+// NewWriter creates a new Writer, writing entries to a WAL per client named in clientNames.
+func NewWriter(walCfg Config, logger log.Logger, reg prometheus.Registerer, clientNames ...string) (*Writer, error) {
+	if len(clientNames) == 0 {
+		return nil, fmt.Errorf("at least one client name must be provided")
+	}
+
+	if err := migrateSharedWAL(walCfg.Dir, clientNames, logger); err != nil {
+		return nil, fmt.Errorf("error migrating WAL to client directories: %w", err)
+	}
+	if err := removeUnusedClientDirs(walCfg.Dir, clientNames, logger); err != nil {
+		return nil, fmt.Errorf("error removing WAL of removed clients: %w", err)
 	}
 
 	wrt := &Writer{
 		entries:      make(chan loki.Entry),
 		log:          logger,
 		wg:           sync.WaitGroup{},
-		wal:          wl,
 		entryWriter:  newEntryWriter(),
+		maxSize:      walCfg.MaxSizeBytes,
+		reg:          util.WrapWithUnregisterer(reg),
 		closeCleaner: make(chan struct{}, 1),
 	}
 
+	for _, name := range clientNames {
+		// The WAL of each client registers the same metrics, tell them apart by client.
+		var walReg prometheus.Registerer
+		if reg != nil {
+			walReg = prometheus.WrapRegistererWith(prometheus.Labels{"client": name}, wrt.reg)
+		}
+
+		// Start WAL
+		wl, err := New(Config{
+			Dir:     ClientDir(walCfg.Dir, name),
+			Enabled: true,
+		}, logger, walReg)
+		if err != nil {
+			wrt.closeWALs()
+			return nil, fmt.Errorf("error starting WAL for client %s: %w", name, err)
+		}
+		wrt.wals = append(wrt.wals, &clientWAL{client: name, wal: wl})
+	}
+
 	wrt.reclaimedOldSegmentsSpaceCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "loki_write",
 		Subsystem: "wal_writer",
 		Name:      "reclaimed_space",
 		Help:      "Number of bytes reclaimed from storage.",
-	}, []string{})
+	}, []string{"client"})
 
 	wrt.lastReclaimedSegment = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "loki_write",
 		Subsystem: "wal_writer",
 		Name:      "last_reclaimed_segment",
 		Help:      "Last reclaimed segment number",
-	}, []string{})
+	}, []string{"client"})
 	wrt.lastWrittenTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "loki_write",
 		Subsystem: "wal_writer",
 		Name:      "last_written_timestamp",
 		Help:      "Latest timestamp that was written to the WAL",
 	}, []string{})
-
-	if reg != nil {
-		_ = reg.Register(wrt.reclaimedOldSegmentsSpaceCounter)
-		_ = reg.Register(wrt.lastReclaimedSegment)
-		_ = reg.Register(wrt.lastWrittenTimestamp)
+	wrt.diskUsage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "loki_write",
+		Subsystem: "wal_writer",
+		Name:      "disk_usage_bytes",
+		Help:      "Size of the segments of the WAL of a client.",
+	}, []string{"client"})
+	wrt.sizeLimitDroppedSegments = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "loki_write",
+		Subsystem: "wal_writer",
+		Name:      "size_limit_dropped_segments_total",
+		Help:      "Number of segments deleted because the WAL of a client exceeded its maximum size, including entries not sent yet.",
+	}, []string{"client"})
+	wrt.sizeLimitDroppedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "loki_write",
+		Subsystem: "wal_writer",
+		Name:      "size_limit_dropped_bytes_total",
+		Help:      "Number of bytes deleted because the WAL of a client exceeded its maximum size, including entries not sent yet.",
+	}, []string{"client"})
+
+	for _, c := range []prometheus.Collector{
+		wrt.reclaimedOldSegmentsSpaceCounter,
+		wrt.lastReclaimedSegment,
+		wrt.lastWrittenTimestamp,
+		wrt.diskUsage,
+		wrt.sizeLimitDroppedSegments,
+		wrt.sizeLimitDroppedBytes,
+	} {
+		if err := wrt.reg.Register(c); err != nil {
+			wrt.closeWALs()
+			return nil, fmt.Errorf("error registering wal writer metrics: %w", err)
+		}
 	}
 
 	wrt.start(walCfg.MaxSegmentAge)
@@ -120,20 +193,22 @@ func (wrt *Writer) start(maxSegmentAge time.Duration) {
 	go func() {
 		defer wrt.wg.Done()
 		for e := range wrt.entries {
-			if err := wrt.entryWriter.WriteEntry(e, wrt.wal, wrt.log); err != nil {
-				level.Error(wrt.log).Log("msg", "failed to write entry", "err", err)
-				// if an error occurred while writing the wal, go to next entry and don't notify write subscribers
-				continue
+			for _, cw := range wrt.wals {
+				if err := wrt.entryWriter.WriteEntry(e, cw.wal, wrt.log); err != nil {
+					level.Error(wrt.log).Log("msg", "failed to write entry", "client", cw.client, "err", err)
+					// if an error occurred while writing the wal, go to next client and don't notify write subscribers
+					continue
+				}
+
+				cw.writeSubscribersLock.RLock()
+				for _, s := range cw.writeSubscribers {
+					s.NotifyWrite()
+				}
+				cw.writeSubscribersLock.RUnlock()
 			}
 
 			// emit metric with latest written timestamp, to be able to track delay from writer to watcher
 			wrt.lastWrittenTimestamp.WithLabelValues().Set(float64(e.Timestamp.Unix()))
-
-			wrt.writeSubscribersLock.RLock()
-			for _, s := range wrt.writeSubscribers {
-				s.NotifyWrite()
-			}
-			wrt.writeSubscribersLock.RUnlock()
 		}
 	}()
 	// WAL cleanup routine that cleans old segments
@@ -174,71 +249,147 @@ func (wrt *Writer) Stop() {
 	wrt.closeCleaner <- struct{}{}
 	// Wait for routine to write to wal all pending entries
 	wrt.wg.Wait()
-	// Close WAL to finalize all pending writes
-	wrt.wal.Close()
+	// Close WALs to finalize all pending writes
+	wrt.closeWALs()
+}
+
+// closeWALs closes the WAL of each client, and unregisters the metrics of the Writer so that a new Writer can
+// register them again.
+func (wrt *Writer) closeWALs() {
+	for _, cw := range wrt.wals {
+		cw.wal.Close()
+	}
+	wrt.reg.UnregisterAll()
+}
+
+// cleanSegments cleans the segments of the WAL of each client, see cleanClientSegments.
+func (wrt *Writer) cleanSegments(maxAge time.Duration) error {
+	var errs []error
+	for _, cw := range wrt.wals {
+		if err := wrt.cleanClientSegments(cw, maxAge); err != nil {
+			errs = append(errs, fmt.Errorf("client %s: %w", cw.client, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-// cleanSegments will remove segments older than maxAge from the WAL directory. If there's just one segment, none will be
-// deleted since it's likely there's active readers on it. In case there's multiple segments, each will be deleted if:
+// cleanClientSegments will remove segments older than maxAge from the WAL directory of a client. If there's just one
+// segment, none will be deleted since it's likely there's active readers on it. In case there's multiple segments,
+// each will be deleted if:
 // - It's not the last (highest numbered) segment
 // - It's last modified date is older than the max allowed age
-func (wrt *Writer) cleanSegments(maxAge time.Duration) error {
+// Then, if the remaining segments exceed the maximum WAL size, the oldest ones are deleted until the WAL fits, except
+// for the last segment.
+func (wrt *Writer) cleanClientSegments(cw *clientWAL, maxAge time.Duration) error {
 	maxModifiedAt := time.Now().Add(-maxAge)
-	walDir := wrt.wal.Dir()
+	walDir := cw.wal.Dir()
 	segments, err := listSegments(walDir)
 	if err != nil {
 		return fmt.Errorf("error reading segments in wal directory: %w", err)
 	}
+
+	var usage int64
+	for _, segment := range segments {
+		usage += segment.size
+	}
+	defer func() {
+		wrt.diskUsage.WithLabelValues(cw.client).Set(float64(usage))
+	}()
+
 	// Only clean if there's more than one segment
 	if len(segments) <= 1 {
 		return nil
 	}
-	// find the most recent, or head segment to avoid cleaning it up
-	lastSegment := -1
+	// segments are sorted, the last one is the most recent, or head segment, which is never cleaned up
+	lastSegment := segments[len(segments)-1].number
 	maxReclaimed := -1
-	for _, segment := range segments {
-		if lastSegment < segment.number {
-			lastSegment = segment.number
-		}
-	}
+	deleted := make(map[int]struct{})
 	for _, segment := range segments {
 		if segment.lastModified.Before(maxModifiedAt) && segment.number != lastSegment {
 			// segment is older than allowed age, cleaning up
 			if err := os.Remove(filepath.Join(walDir, segment.name)); err != nil {
-				level.Error(wrt.log).Log("msg", "Error old wal segment", "err", err, "segmentNum", segment.number)
+				level.Error(wrt.log).Log("msg", "Error old wal segment", "err", err, "segmentNum", segment.number, "client", cw.client)
+				continue
 			}
-			level.Debug(wrt.log).Log("msg", "Deleted old wal segment", "segmentNum", segment.number)
-			wrt.reclaimedOldSegmentsSpaceCounter.WithLabelValues().Add(float64(segment.size))
+			level.Debug(wrt.log).Log("msg", "Deleted old wal segment", "segmentNum", segment.number, "client", cw.client)
+			wrt.reclaimedOldSegmentsSpaceCounter.WithLabelValues(cw.client).Add(float64(segment.size))
+			usage -= segment.size
+			deleted[segment.number] = struct{}{}
 			// keep track of the largest segment number reclaimed
 			if segment.number > maxReclaimed {
 				maxReclaimed = segment.number
 			}
 		}
 	}
+
+	// if the WAL is still too big, drop the oldest segments left, even though their entries may not have been sent
+	// yet.
+	if wrt.maxSize > 0 {
+		for _, segment := range segments {
+			if usage <= wrt.maxSize || segment.number == lastSegment {
+				break
+			}
+			if _, ok := deleted[segment.number]; ok {
+				continue
+			}
+			if err := os.Remove(filepath.Join(walDir, segment.name)); err != nil {
+				level.Error(wrt.log).Log("msg", "Error deleting wal segment exceeding max size", "err", err, "segmentNum", segment.number, "client", cw.client)
+				break
+			}
+			level.Warn(wrt.log).Log("msg", "Deleted wal segment because the WAL exceeds its max size, entries not sent yet are lost", "segmentNum", segment.number, "client", cw.client)
+			wrt.sizeLimitDroppedSegments.WithLabelValues(cw.client).Inc()
+			wrt.sizeLimitDroppedBytes.WithLabelValues(cw.client).Add(float64(segment.size))
+			usage -= segment.size
+			if segment.number > maxReclaimed {
+				maxReclaimed = segment.number
+			}
+		}
+	}
+
 	// if we reclaimed at least one segment, notify all subscribers
 	if maxReclaimed != -1 {
-		wrt.cleanupSubscribersLock.RLock()
-		defer wrt.cleanupSubscribersLock.RUnlock()
-		for _, subscriber := range wrt.cleanupSubscribers {
+		cw.cleanupSubscribersLock.RLock()
+		defer cw.cleanupSubscribersLock.RUnlock()
+		for _, subscriber := range cw.cleanupSubscribers {
 			subscriber.SeriesReset(maxReclaimed)
 		}
-		wrt.lastReclaimedSegment.WithLabelValues().Set(float64(maxReclaimed))
+		wrt.lastReclaimedSegment.WithLabelValues(cw.client).Set(float64(maxReclaimed))
 	}
 	return nil
 }
 
-// SubscribeCleanup adds a new CleanupEventSubscriber that will receive cleanup events.
-func (wrt *Writer) SubscribeCleanup(subscriber CleanupEventSubscriber) {
-	wrt.cleanupSubscribersLock.Lock()
-	defer wrt.cleanupSubscribersLock.Unlock()
-	wrt.cleanupSubscribers = append(wrt.cleanupSubscribers, subscriber)
+// clientWAL returns the WAL of the client named clientName, or nil if there's none.
+func (wrt *Writer) clientWAL(clientName string) *clientWAL {
+	for _, cw := range wrt.wals {
+		if cw.client == clientName {
+			return cw
+		}
+	}
+	return nil
 }
 
-// SubscribeWrite adds a new WriteEventSubscriber that will receive write events.
-func (wrt *Writer) SubscribeWrite(subscriber WriteEventSubscriber) {
-	wrt.writeSubscribersLock.Lock()
-	defer wrt.writeSubscribersLock.Unlock()
-	wrt.writeSubscribers = append(wrt.writeSubscribers, subscriber)
+// SubscribeCleanup adds a new CleanupEventSubscriber that will receive cleanup events of the WAL of the client named
+// clientName.
+func (wrt *Writer) SubscribeCleanup(clientName string, subscriber CleanupEventSubscriber) {
+	cw := wrt.clientWAL(clientName)
+	if cw == nil {
+		return
+	}
+	cw.cleanupSubscribersLock.Lock()
+	defer cw.cleanupSubscribersLock.Unlock()
+	cw.cleanupSubscribers = append(cw.cleanupSubscribers, subscriber)
+}
+
+// SubscribeWrite adds a new WriteEventSubscriber that will receive write events of the WAL of the client named
+// clientName.
+func (wrt *Writer) SubscribeWrite(clientName string, subscriber WriteEventSubscriber) {
+	cw := wrt.clientWAL(clientName)
+	if cw == nil {
+		return
+	}
+	cw.writeSubscribersLock.Lock()
+	defer cw.writeSubscribersLock.Unlock()
+	cw.writeSubscribers = append(cw.writeSubscribers, subscriber)
 }
 
 // entryWriter writes loki.Entry to a WAL, keeping in memory a single Record object that's reused
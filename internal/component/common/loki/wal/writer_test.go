@@ -10,22 +10,27 @@ import (
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/flow/logging/level"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
 
 	"github.com/grafana/agent/internal/component/common/loki"
 	"github.com/grafana/loki/pkg/logproto"
+	"github.com/grafana/loki/pkg/push"
 )
 
+const testClient = "test"
+
 func TestWriter_EntriesAreWrittenToWAL(t *testing.T) {
 	logger := log.NewLogfmtLogger(os.Stdout)
-	dir := t.TempDir()
+	walDir := t.TempDir()
+	dir := ClientDir(walDir, testClient)
 
 	writer, err := NewWriter(Config{
-		Dir:           dir,
+		Dir:           walDir,
 		Enabled:       true,
 		MaxSegmentAge: time.Minute,
-	}, logger, prometheus.NewRegistry())
+	}, logger, prometheus.NewRegistry(), testClient)
 	require.NoError(t, err)
 	defer func() {
 		writer.Stop()
@@ -52,7 +57,7 @@ func TestWriter_EntriesAreWrittenToWAL(t *testing.T) {
 	}
 
 	// accessing the WAL inside, just for testing!
-	require.NoError(t, writer.wal.Sync(), "failed to sync wal")
+	require.NoError(t, writer.wals[0].wal.Sync(), "failed to sync wal")
 
 	// assert over WAL entries
 	readEntries := eventuallyReadWAL(t, len(lines), dir)
@@ -60,6 +65,51 @@ func TestWriter_EntriesAreWrittenToWAL(t *testing.T) {
 	require.Equal(t, testLabels, readEntries[0].Labels)
 }
 
+func TestWriter_StructuredMetadataIsWrittenToWAL(t *testing.T) {
+	logger := log.NewLogfmtLogger(os.Stdout)
+	walDir := t.TempDir()
+	dir := ClientDir(walDir, testClient)
+
+	writer, err := NewWriter(Config{
+		Dir:           walDir,
+		Enabled:       true,
+		MaxSegmentAge: time.Minute,
+	}, logger, prometheus.NewRegistry(), testClient)
+	require.NoError(t, err)
+	defer func() {
+		writer.Stop()
+	}()
+
+	entries := []logproto.Entry{
+		{
+			Timestamp:          time.Unix(1, 0).UTC(),
+			Line:               "with structured metadata",
+			StructuredMetadata: push.LabelsAdapter{{Name: "trace_id", Value: "12345"}, {Name: "user", Value: "me"}},
+		},
+		{
+			Timestamp: time.Unix(2, 0).UTC(),
+			Line:      "without structured metadata",
+		},
+	}
+	for _, e := range entries {
+		writer.Chan() <- loki.Entry{Labels: model.LabelSet{"testing": "log"}, Entry: e}
+	}
+
+	// accessing the WAL inside, just for testing!
+	require.NoError(t, writer.wals[0].wal.Sync(), "failed to sync wal")
+
+	readEntries := eventuallyReadWAL(t, len(entries), dir)
+	for i, e := range readEntries {
+		require.Equal(t, entries[i].Timestamp, e.Timestamp.UTC())
+		require.Equal(t, entries[i].Line, e.Line)
+		require.Equal(t, len(entries[i].StructuredMetadata), len(e.StructuredMetadata))
+		for j, md := range entries[i].StructuredMetadata {
+			require.Equal(t, md.Name, e.StructuredMetadata[j].Name)
+			require.Equal(t, md.Value, e.StructuredMetadata[j].Value)
+		}
+	}
+}
+
 type notifySegmentsCleanedFunc func(num int)
 
 func (n notifySegmentsCleanedFunc) NotifyWrite() {
@@ -71,7 +121,8 @@ func (n notifySegmentsCleanedFunc) SeriesReset(segmentNum int) {
 
 func TestWriter_OldSegmentsAreCleanedUp(t *testing.T) {
 	logger := level.NewFilter(log.NewLogfmtLogger(os.Stdout), level.AllowDebug())
-	dir := t.TempDir()
+	walDir := t.TempDir()
+	dir := ClientDir(walDir, testClient)
 
 	maxSegmentAge := time.Second * 2
 
@@ -79,20 +130,20 @@ func TestWriter_OldSegmentsAreCleanedUp(t *testing.T) {
 	subscriber2 := []int{}
 
 	writer, err := NewWriter(Config{
-		Dir:           dir,
+		Dir:           walDir,
 		Enabled:       true,
 		MaxSegmentAge: maxSegmentAge,
-	}, logger, prometheus.NewRegistry())
+	}, logger, prometheus.NewRegistry(), testClient)
 	require.NoError(t, err)
 	defer func() {
 		writer.Stop()
 	}()
 
 	// add writer events subscriber. Add multiple to test fanout
-	writer.SubscribeCleanup(notifySegmentsCleanedFunc(func(num int) {
+	writer.SubscribeCleanup(testClient, notifySegmentsCleanedFunc(func(num int) {
 		subscriber1 = append(subscriber1, num)
 	}))
-	writer.SubscribeCleanup(notifySegmentsCleanedFunc(func(num int) {
+	writer.SubscribeCleanup(testClient, notifySegmentsCleanedFunc(func(num int) {
 		subscriber2 = append(subscriber2, num)
 	}))
 
@@ -117,7 +168,7 @@ func TestWriter_OldSegmentsAreCleanedUp(t *testing.T) {
 	}
 
 	// accessing the WAL inside, just for testing!
-	require.NoError(t, writer.wal.Sync(), "failed to sync wal")
+	require.NoError(t, writer.wals[0].wal.Sync(), "failed to sync wal")
 
 	// assert over WAL entries
 	readEntries := eventuallyReadWAL(t, len(lines), dir)
@@ -132,7 +183,7 @@ func TestWriter_OldSegmentsAreCleanedUp(t *testing.T) {
 	require.GreaterOrEqual(t, fileInfo.Size(), int64(0), "first segment size should be >= 0")
 
 	// force close segment, so that one is eventually cleaned up
-	_, err = writer.wal.NextSegment()
+	_, err = writer.wals[0].wal.NextSegment()
 	require.NoError(t, err, "error closing current segment")
 
 	// wait for segment to be cleaned
@@ -158,24 +209,25 @@ func TestWriter_OldSegmentsAreCleanedUp(t *testing.T) {
 
 func TestWriter_NoSegmentIsCleanedUpIfTheresOnlyOne(t *testing.T) {
 	logger := level.NewFilter(log.NewLogfmtLogger(os.Stdout), level.AllowDebug())
-	dir := t.TempDir()
+	walDir := t.TempDir()
+	dir := ClientDir(walDir, testClient)
 
 	maxSegmentAge := time.Second * 2
 
 	segmentsReclaimedNotificationsReceived := []int{}
 
 	writer, err := NewWriter(Config{
-		Dir:           dir,
+		Dir:           walDir,
 		Enabled:       true,
 		MaxSegmentAge: maxSegmentAge,
-	}, logger, prometheus.NewRegistry())
+	}, logger, prometheus.NewRegistry(), testClient)
 	require.NoError(t, err)
 	defer func() {
 		writer.Stop()
 	}()
 
 	// add writer events subscriber
-	writer.SubscribeCleanup(notifySegmentsCleanedFunc(func(num int) {
+	writer.SubscribeCleanup(testClient, notifySegmentsCleanedFunc(func(num int) {
 		segmentsReclaimedNotificationsReceived = append(segmentsReclaimedNotificationsReceived, num)
 	}))
 
@@ -198,7 +250,7 @@ func TestWriter_NoSegmentIsCleanedUpIfTheresOnlyOne(t *testing.T) {
 	}
 
 	// accessing the WAL inside, just for testing!
-	require.NoError(t, writer.wal.Sync(), "failed to sync wal")
+	require.NoError(t, writer.wals[0].wal.Sync(), "failed to sync wal")
 
 	// assert over WAL entries
 	readEntries := eventuallyReadWAL(t, len(lines), dir)
@@ -222,6 +274,183 @@ func TestWriter_NoSegmentIsCleanedUpIfTheresOnlyOne(t *testing.T) {
 	require.Len(t, segmentsReclaimedNotificationsReceived, 0, "expected no notification")
 }
 
+func TestWriter_EntriesAreWrittenToTheWALOfEachClient(t *testing.T) {
+	logger := log.NewLogfmtLogger(os.Stdout)
+	walDir := t.TempDir()
+
+	writer, err := NewWriter(Config{
+		Dir:           walDir,
+		Enabled:       true,
+		MaxSegmentAge: time.Minute,
+	}, logger, prometheus.NewRegistry(), "client-a", "client-b")
+	require.NoError(t, err)
+	defer func() {
+		writer.Stop()
+	}()
+
+	var testLabels = model.LabelSet{
+		"testing": "log",
+	}
+	for _, line := range []string{"some line", "some other line"} {
+		writer.Chan() <- loki.Entry{
+			Labels: testLabels,
+			Entry: logproto.Entry{
+				Timestamp: time.Now(),
+				Line:      line,
+			},
+		}
+	}
+
+	for i, client := range []string{"client-a", "client-b"} {
+		require.NoError(t, writer.wals[i].wal.Sync(), "failed to sync wal")
+		readEntries := eventuallyReadWAL(t, 2, ClientDir(walDir, client))
+		require.Equal(t, testLabels, readEntries[0].Labels)
+	}
+}
+
+func TestWriter_OldestSegmentsAreDeletedWhenExceedingMaxSize(t *testing.T) {
+	logger := level.NewFilter(log.NewLogfmtLogger(os.Stdout), level.AllowDebug())
+	walDir := t.TempDir()
+	dir := ClientDir(walDir, testClient)
+
+	writer, err := NewWriter(Config{
+		Dir:     walDir,
+		Enabled: true,
+		// Segments never get old during the test, only the size limit deletes them.
+		MaxSegmentAge: time.Hour,
+	}, logger, prometheus.NewRegistry(), testClient)
+	require.NoError(t, err)
+	defer func() {
+		writer.Stop()
+	}()
+
+	var reclaimed []int
+	writer.SubscribeCleanup(testClient, notifySegmentsCleanedFunc(func(num int) {
+		reclaimed = append(reclaimed, num)
+	}))
+
+	// write entries to 3 segments, and start a 4th, head segment
+	for segment := 0; segment < 3; segment++ {
+		for i := 0; i < 10; i++ {
+			writer.Chan() <- loki.Entry{
+				Labels: model.LabelSet{"testing": "log"},
+				Entry: logproto.Entry{
+					Timestamp: time.Now(),
+					Line:      fmt.Sprintf("segment %d line %d", segment, i),
+				},
+			}
+		}
+		_, err = writer.wals[0].wal.NextSegment()
+		require.NoError(t, err, "error closing current segment")
+	}
+	require.NoError(t, writer.wals[0].wal.Sync(), "failed to sync wal")
+
+	segments, err := listSegments(dir)
+	require.NoError(t, err)
+	require.Len(t, segments, 4)
+
+	// only the 2 most recent segments fit
+	writer.maxSize = segments[2].size + segments[3].size
+	require.NoError(t, writer.cleanSegments(time.Hour))
+
+	for _, deleted := range []string{"00000000", "00000001"} {
+		_, err = os.Stat(filepath.Join(dir, deleted))
+		require.ErrorIs(t, err, os.ErrNotExist, "expected segment %s to be deleted", deleted)
+	}
+	for _, kept := range []string{"00000002", "00000003"} {
+		_, err = os.Stat(filepath.Join(dir, kept))
+		require.NoError(t, err, "expected segment %s to be kept", kept)
+	}
+
+	require.Equal(t, []int{1}, reclaimed)
+	require.Equal(t, 2.0, testutil.ToFloat64(writer.sizeLimitDroppedSegments.WithLabelValues(testClient)))
+	require.Equal(t, float64(segments[0].size+segments[1].size), testutil.ToFloat64(writer.sizeLimitDroppedBytes.WithLabelValues(testClient)))
+	require.Equal(t, float64(segments[2].size+segments[3].size), testutil.ToFloat64(writer.diskUsage.WithLabelValues(testClient)))
+	require.Equal(t, 1.0, testutil.ToFloat64(writer.lastReclaimedSegment.WithLabelValues(testClient)))
+}
+
+func TestWriter_SharedWALIsMigrated(t *testing.T) {
+	logger := log.NewLogfmtLogger(os.Stdout)
+	walDir := t.TempDir()
+
+	// write a WAL shared by all clients, as done before each client had its own WAL
+	shared, err := New(Config{Dir: walDir, Enabled: true}, logger, nil)
+	require.NoError(t, err)
+	ew := newEntryWriter()
+	for _, line := range []string{"some line", "some other line"} {
+		require.NoError(t, ew.WriteEntry(loki.Entry{
+			Labels: model.LabelSet{"testing": "log"},
+			Entry: logproto.Entry{
+				Timestamp: time.Now(),
+				Line:      line,
+			},
+		}, shared, logger))
+	}
+	shared.Close()
+	require.NoError(t, os.MkdirAll(filepath.Join(walDir, sharedMarkerDir), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(walDir, sharedMarkerDir, sharedMarkerFile), []byte("marker"), 0o600))
+
+	writer, err := NewWriter(Config{
+		Dir:           walDir,
+		Enabled:       true,
+		MaxSegmentAge: time.Minute,
+	}, logger, prometheus.NewRegistry(), "client-a", "client-b")
+	require.NoError(t, err)
+	defer func() {
+		writer.Stop()
+	}()
+
+	for _, client := range []string{"client-a", "client-b"} {
+		readEntries := eventuallyReadWAL(t, 2, ClientDir(walDir, client))
+		require.Equal(t, "some line", readEntries[0].Line)
+
+		marker, err := os.ReadFile(filepath.Join(ClientDir(walDir, client), sharedMarkerDir, sharedMarkerFile))
+		require.NoError(t, err)
+		require.Equal(t, "marker", string(marker))
+	}
+
+	// the shared WAL is gone
+	segments, err := listSegments(walDir)
+	require.NoError(t, err)
+	require.Empty(t, segments)
+	_, err = os.Stat(filepath.Join(walDir, sharedMarkerDir))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWriter_WALOfRemovedClientsIsDeleted(t *testing.T) {
+	logger := log.NewLogfmtLogger(os.Stdout)
+	walDir := t.TempDir()
+	reg := prometheus.NewRegistry()
+
+	writer, err := NewWriter(Config{
+		Dir:           walDir,
+		Enabled:       true,
+		MaxSegmentAge: time.Minute,
+	}, logger, reg, "client-a", "client-b")
+	require.NoError(t, err)
+	writer.Stop()
+
+	// the metrics of a stopped writer are unregistered, so that the next one can register them
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	require.Empty(t, mfs)
+
+	writer, err = NewWriter(Config{
+		Dir:           walDir,
+		Enabled:       true,
+		MaxSegmentAge: time.Minute,
+	}, logger, reg, "client-b")
+	require.NoError(t, err)
+	defer func() {
+		writer.Stop()
+	}()
+
+	_, err = os.Stat(ClientDir(walDir, "client-a"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(ClientDir(walDir, "client-b"))
+	require.NoError(t, err)
+}
+
 func watchAndLogDirEntries(t *testing.T, path string) {
 	dirs, err := os.ReadDir(path)
 	if len(dirs) == 0 {
@@ -291,13 +520,13 @@ func BenchmarkWriter_WriteEntries(b *testing.B) {
 
 func benchWriteEntries(b *testing.B, lines, labelSetCount int) {
 	logger := log.NewLogfmtLogger(os.Stdout)
-	dir := b.TempDir()
+	walDir := b.TempDir()
 
 	writer, err := NewWriter(Config{
-		Dir:           dir,
+		Dir:           walDir,
 		Enabled:       true,
 		MaxSegmentAge: time.Minute,
-	}, logger, prometheus.NewRegistry())
+	}, logger, prometheus.NewRegistry(), testClient)
 	require.NoError(b, err)
 	defer func() {
 		writer.Stop()
@@ -50,6 +50,12 @@
 // encoding.TextMarshaler and encoding.TextUnmarshaler. Types implementing
 // these interfaces will be represented as strings in River.
 //
+// # Exporting secrets
+//
+// Components exporting credentials should export them as a Secret. The Flow
+// controller only caches a handle to the secret, which is read from the
+// component when a dependant decodes it into a rivertypes.Secret.
+//
 // # Component registration
 //
 // Components are registered globally by calling Register. These components are
@@ -60,6 +66,7 @@ package component
 
 import (
 	"context"
+	"time"
 )
 
 // The Arguments contains the input fields for a specific component, which is
@@ -113,3 +120,19 @@ type DebugComponent interface {
 	// DebugInfo must be safe for calling concurrently.
 	DebugInfo() interface{}
 }
+
+// ReevaluatedComponent is an extension interface for components whose
+// arguments must be re-evaluated periodically, even when none of the
+// components they reference change. This is the case of components whose
+// arguments are read from sources outside of the component graph, such as
+// files or environment variables.
+type ReevaluatedComponent interface {
+	Component
+
+	// ReevaluationInterval returns how often the arguments of the component
+	// are re-evaluated. Zero disables periodic re-evaluation.
+	//
+	// ReevaluationInterval is checked after every evaluation of the
+	// component and must be safe for calling concurrently.
+	ReevaluationInterval() time.Duration
+}
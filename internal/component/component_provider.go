@@ -99,6 +99,19 @@ type Info struct {
 	Arguments Arguments   // Current arguments value of the component.
 	Exports   Exports     // Current exports value of the component.
 	DebugInfo interface{} // Current debug info of the component.
+
+	// EvaluationProfile holds the slowest expressions of the last evaluation
+	// of the component, slowest first. It's only set when expression
+	// profiling is enabled.
+	EvaluationProfile []ExpressionTiming
+}
+
+// ExpressionTiming is the time spent in the calls to a function by the
+// expressions of a component during an evaluation.
+type ExpressionTiming struct {
+	Expression string        // Function call, such as json_decode().
+	Calls      int           // Number of calls.
+	Duration   time.Duration // Total time spent in the calls.
 }
 
 // MarshalJSON returns a JSON representation of cd. The format of the
@@ -112,19 +125,26 @@ func (info *Info) MarshalJSON() ([]byte, error) {
 		}
 
 		componentDetailJSON struct {
-			Name             string               `json:"name"`
-			Type             string               `json:"type,omitempty"`
-			LocalID          string               `json:"localID"`
-			ModuleID         string               `json:"moduleID"`
-			Label            string               `json:"label,omitempty"`
-			References       []string             `json:"referencesTo"`
-			ReferencedBy     []string             `json:"referencedBy"`
-			Health           *componentHealthJSON `json:"health"`
-			Original         string               `json:"original"`
-			Arguments        json.RawMessage      `json:"arguments,omitempty"`
-			Exports          json.RawMessage      `json:"exports,omitempty"`
-			DebugInfo        json.RawMessage      `json:"debugInfo,omitempty"`
-			CreatedModuleIDs []string             `json:"createdModuleIDs,omitempty"`
+			Name              string                 `json:"name"`
+			Type              string                 `json:"type,omitempty"`
+			LocalID           string                 `json:"localID"`
+			ModuleID          string                 `json:"moduleID"`
+			Label             string                 `json:"label,omitempty"`
+			References        []string               `json:"referencesTo"`
+			ReferencedBy      []string               `json:"referencedBy"`
+			Health            *componentHealthJSON   `json:"health"`
+			Original          string                 `json:"original"`
+			Arguments         json.RawMessage        `json:"arguments,omitempty"`
+			Exports           json.RawMessage        `json:"exports,omitempty"`
+			DebugInfo         json.RawMessage        `json:"debugInfo,omitempty"`
+			CreatedModuleIDs  []string               `json:"createdModuleIDs,omitempty"`
+			EvaluationProfile []expressionTimingJSON `json:"evaluationProfile,omitempty"`
+		}
+
+		expressionTimingJSON struct {
+			Expression string `json:"expression"`
+			Calls      int    `json:"calls"`
+			Duration   string `json:"duration"`
 		}
 	)
 
@@ -156,6 +176,15 @@ func (info *Info) MarshalJSON() ([]byte, error) {
 		return nil, err
 	}
 
+	var evaluationProfile []expressionTimingJSON
+	for _, t := range info.EvaluationProfile {
+		evaluationProfile = append(evaluationProfile, expressionTimingJSON{
+			Expression: t.Expression,
+			Calls:      t.Calls,
+			Duration:   t.Duration.String(),
+		})
+	}
+
 	return json.Marshal(&componentDetailJSON{
 		Name:         info.ComponentName,
 		Type:         "block",
@@ -169,10 +198,11 @@ func (info *Info) MarshalJSON() ([]byte, error) {
 			Message:     info.Health.Message,
 			UpdatedTime: info.Health.UpdateTime,
 		},
-		Arguments:        arguments,
-		Exports:          exports,
-		DebugInfo:        debugInfo,
-		CreatedModuleIDs: info.ModuleIDs,
+		Arguments:         arguments,
+		Exports:           exports,
+		DebugInfo:         debugInfo,
+		CreatedModuleIDs:  info.ModuleIDs,
+		EvaluationProfile: evaluationProfile,
 	})
 }
 
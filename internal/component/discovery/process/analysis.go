@@ -0,0 +1,186 @@
+//go:build linux
+
+package process
+
+import (
+	"path"
+	"reflect"
+	"time"
+
+	"github.com/go-kit/log"
+	"golang.org/x/sys/unix"
+)
+
+// analysis is the metadata of a process which is expensive to discover. It is
+// cached between refreshes, and only discovered again when the executable of
+// the process changes or when the analysis is older than the max age, for
+// example to notice libraries loaded by a JIT runtime.
+type analysis struct {
+	containerID string
+	libraries   []library
+	identity    processIdentity
+}
+
+func (a analysis) labels() map[string]string {
+	labels := librariesLabels(a.libraries)
+	a.identity.addLabels(labels)
+	if a.containerID != "" {
+		labels[labelProcessContainerID] = a.containerID
+	}
+	return labels
+}
+
+// exeStat identifies the executable of a process, which changes when the
+// process execs into a different binary.
+type exeStat struct {
+	dev   uint64
+	ino   uint64
+	mtime int64
+}
+
+func statExe(pid string) (exeStat, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path.Join("/proc", pid, "exe"), &st); err != nil {
+		return exeStat{}, err
+	}
+	return exeStat{dev: uint64(st.Dev), ino: st.Ino, mtime: st.Mtim.Nano()}, nil
+}
+
+type analysisEntry struct {
+	createTime int64
+	exe        exeStat
+	analyzedAt time.Time
+	analysis   analysis
+}
+
+// analyzer caches the analysis of the running processes by PID.
+type analyzer struct {
+	l       log.Logger
+	metrics *metrics
+	maxAge  time.Duration // Zero disables re-analysis based on age.
+
+	entries map[string]*analysisEntry
+	seen    map[string]struct{} // PIDs looked up since the last prune.
+
+	// Overridden in tests.
+	now     func() time.Time
+	statExe func(pid string) (exeStat, error)
+	analyze func(l log.Logger, pid string, cfg *DiscoverConfig) (analysis, error)
+}
+
+func newAnalyzer(l log.Logger, m *metrics, maxAge time.Duration) *analyzer {
+	return &analyzer{
+		l:       l,
+		metrics: m,
+		maxAge:  maxAge,
+		entries: make(map[string]*analysisEntry),
+		seen:    make(map[string]struct{}),
+		now:     time.Now,
+		statExe: statExe,
+		analyze: analyzeProcess,
+	}
+}
+
+// get returns the analysis of the process pid started at createTime, running
+// it again if the cached analysis is outdated.
+func (a *analyzer) get(pid string, createTime int64, cfg *DiscoverConfig) (analysis, error) {
+	a.seen[pid] = struct{}{}
+
+	// The executable of processes of other users can't always be inspected,
+	// in which case only the max age triggers a re-analysis.
+	exe, _ := a.statExe(pid)
+	now := a.now()
+
+	e, ok := a.entries[pid]
+	if ok && e.createTime != createTime {
+		// The PID was reused by a new process.
+		ok = false
+	}
+	switch {
+	case !ok:
+	case e.exe != exe:
+		a.metrics.reanalysesTotal.WithLabelValues(reasonExeChanged).Inc()
+	case a.maxAge > 0 && now.Sub(e.analyzedAt) >= a.maxAge:
+		a.metrics.reanalysesTotal.WithLabelValues(reasonMaxAge).Inc()
+	default:
+		return e.analysis, nil
+	}
+
+	res, err := a.analyze(a.l, pid, cfg)
+	if err != nil {
+		delete(a.entries, pid)
+		return analysis{}, err
+	}
+	if ok && !reflect.DeepEqual(e.analysis.labels(), res.labels()) {
+		a.metrics.labelChangesTotal.Inc()
+	}
+	a.entries[pid] = &analysisEntry{
+		createTime: createTime,
+		exe:        exe,
+		analyzedAt: now,
+		analysis:   res,
+	}
+	return res, nil
+}
+
+// prune forgets the processes which weren't looked up since the previous
+// prune.
+func (a *analyzer) prune() {
+	for pid := range a.entries {
+		if _, ok := a.seen[pid]; !ok {
+			delete(a.entries, pid)
+		}
+	}
+	a.seen = make(map[string]struct{})
+}
+
+// reset forgets all the processes, so that they are analyzed again.
+func (a *analyzer) reset() {
+	a.entries = make(map[string]*analysisEntry)
+	a.seen = make(map[string]struct{})
+}
+
+func analyzeProcess(l log.Logger, pid string, cfg *DiscoverConfig) (analysis, error) {
+	var (
+		res analysis
+		err error
+	)
+	if cfg.ContainerID {
+		res.containerID, err = getLinuxProcessContainerID(pid)
+		if err != nil {
+			return analysis{}, err
+		}
+	}
+	if cfg.Libraries {
+		res.libraries, err = getLinuxProcessLibraries(pid)
+		if err != nil {
+			logProcessError(l, pid, err)
+		}
+	}
+	if cfg.StartTime {
+		res.identity.startTime, err = getLinuxProcessStartTime(pid)
+		if err != nil {
+			return analysis{}, err
+		}
+	}
+	if cfg.EUID || cfg.EGID {
+		euid, egid, err := getLinuxProcessEffectiveIDs(pid)
+		if err != nil {
+			return analysis{}, err
+		}
+		if cfg.EUID {
+			res.identity.euid = euid
+		}
+		if cfg.EGID {
+			res.identity.egid = egid
+		}
+	}
+	if cfg.ExeHash {
+		// The executable of processes of other users can't always be read.
+		res.identity.exeHash, err = getLinuxProcessExeHash(pid)
+		if err != nil {
+			logProcessError(l, pid, err)
+		}
+	}
+	return res, nil
+}
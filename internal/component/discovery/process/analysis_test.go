@@ -0,0 +1,114 @@
+//go:build linux
+
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/component/discovery"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzer_ExeSwap(t *testing.T) {
+	var (
+		m   = newMetrics(prometheus.NewRegistry())
+		a   = newAnalyzer(log.NewNopLogger(), m, 10*time.Minute)
+		cfg = &DiscoverConfig{ContainerID: true, Libraries: true}
+
+		now      = time.Unix(0, 0)
+		exe      = exeStat{dev: 1, ino: 100, mtime: 1}
+		libs     = []library{{basename: "libc.so.6", name: "libc", version: "6"}}
+		analyses int
+	)
+	a.now = func() time.Time { return now }
+	a.statExe = func(string) (exeStat, error) { return exe, nil }
+	a.analyze = func(log.Logger, string, *DiscoverConfig) (analysis, error) {
+		analyses++
+		return analysis{containerID: "abc", libraries: libs}, nil
+	}
+	get := func() analysis {
+		res, err := a.get("42", 1000, cfg)
+		require.NoError(t, err)
+		return res
+	}
+
+	require.Equal(t, libs, get().libraries)
+	require.Equal(t, 1, analyses)
+
+	// The analysis is cached while the executable doesn't change.
+	now = now.Add(time.Minute)
+	get()
+	require.Equal(t, 1, analyses)
+	require.Equal(t, 0.0, testutil.ToFloat64(m.reanalysesTotal.WithLabelValues(reasonExeChanged)))
+
+	// The process execs into a different binary.
+	exe = exeStat{dev: 1, ino: 200, mtime: 2}
+	libs = []library{{basename: "libssl.so.3", name: "libssl", version: "3"}}
+	require.Equal(t, libs, get().libraries)
+	require.Equal(t, 2, analyses)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.reanalysesTotal.WithLabelValues(reasonExeChanged)))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.labelChangesTotal))
+
+	// The analysis is refreshed once it's too old, without changing the labels.
+	now = now.Add(10 * time.Minute)
+	get()
+	require.Equal(t, 3, analyses)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.reanalysesTotal.WithLabelValues(reasonMaxAge)))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.labelChangesTotal))
+
+	// A new process reusing the PID isn't a re-analysis.
+	_, err := a.get("42", 2000, cfg)
+	require.NoError(t, err)
+	require.Equal(t, 4, analyses)
+	require.Equal(t, 1.0, testutil.ToFloat64(m.reanalysesTotal.WithLabelValues(reasonExeChanged)))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.reanalysesTotal.WithLabelValues(reasonMaxAge)))
+
+	// Exited processes are forgotten.
+	a.prune()
+	require.Len(t, a.entries, 1)
+	a.prune()
+	require.Empty(t, a.entries)
+}
+
+func TestAnalyzer_MaxAgeDisabled(t *testing.T) {
+	var (
+		a        = newAnalyzer(log.NewNopLogger(), newMetrics(nil), 0)
+		now      = time.Unix(0, 0)
+		analyses int
+	)
+	a.now = func() time.Time { return now }
+	a.statExe = func(string) (exeStat, error) { return exeStat{}, nil }
+	a.analyze = func(log.Logger, string, *DiscoverConfig) (analysis, error) {
+		analyses++
+		return analysis{}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := a.get("42", 1000, &DiscoverConfig{})
+		require.NoError(t, err)
+		now = now.Add(24 * time.Hour)
+	}
+	require.Equal(t, 1, analyses)
+}
+
+func TestComponent_ChangedOnlyOnNewTargets(t *testing.T) {
+	var exports []discovery.Exports
+	c := &Component{
+		onStateChange: func(e component.Exports) { exports = append(exports, e.(discovery.Exports)) },
+		processes:     []discovery.Target{{labelProcessID: "42", labelProcessExe: "/bin/sh"}},
+	}
+
+	c.changed()
+	c.changed()
+	require.Len(t, exports, 1)
+
+	c.processes = []discovery.Target{{labelProcessID: "42", labelProcessExe: "/bin/bash"}}
+	c.changed()
+	require.Len(t, exports, 2)
+	require.Equal(t, "/bin/bash", exports[1].Targets[0][labelProcessExe])
+}
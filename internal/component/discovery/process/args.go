@@ -1,6 +1,7 @@
 package process
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/grafana/agent/internal/component/discovery"
@@ -9,6 +10,7 @@ import (
 type Arguments struct {
 	Join            []discovery.Target `river:"join,attr,optional"`
 	RefreshInterval time.Duration      `river:"refresh_interval,attr,optional"`
+	AnalysisMaxAge  time.Duration      `river:"analysis_max_age,attr,optional"`
 	DiscoverConfig  DiscoverConfig     `river:"discover_config,block,optional"`
 }
 
@@ -19,11 +21,17 @@ type DiscoverConfig struct {
 	Username    bool `river:"username,attr,optional"`
 	UID         bool `river:"uid,attr,optional"`
 	ContainerID bool `river:"container_id,attr,optional"`
+	Libraries   bool `river:"libraries,attr,optional"`
+	StartTime   bool `river:"start_time,attr,optional"`
+	EUID        bool `river:"euid,attr,optional"`
+	EGID        bool `river:"egid,attr,optional"`
+	ExeHash     bool `river:"exe_hash,attr,optional"`
 }
 
 var DefaultConfig = Arguments{
 	Join:            nil,
 	RefreshInterval: 60 * time.Second,
+	AnalysisMaxAge:  10 * time.Minute,
 	DiscoverConfig: DiscoverConfig{
 		Cwd:         true,
 		Exe:         true,
@@ -35,3 +43,10 @@ var DefaultConfig = Arguments{
 func (args *Arguments) SetToDefault() {
 	*args = DefaultConfig
 }
+
+func (args *Arguments) Validate() error {
+	if args.AnalysisMaxAge < 0 {
+		return fmt.Errorf("analysis_max_age must not be negative")
+	}
+	return nil
+}
@@ -35,6 +35,8 @@ type process struct {
 	containerID string
 	username    string
 	uid         string
+	libraries   []library
+	identity    processIdentity
 }
 
 func (p process) String() string {
@@ -71,47 +73,40 @@ func convertProcess(p process) discovery.Target {
 	if p.uid != "" {
 		t[labelProcessUID] = p.uid
 	}
+	for k, v := range librariesLabels(p.libraries) {
+		t[k] = v
+	}
+	p.identity.addLabels(t)
 	return t
 }
 
-func discover(l log.Logger, cfg *DiscoverConfig) ([]process, error) {
+func discover(l log.Logger, cfg *DiscoverConfig, a *analyzer) ([]process, error) {
 	processes, err := gopsutil.Processes()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list processes: %w", err)
 	}
 	res := make([]process, 0, len(processes))
-	loge := func(pid int, e error) {
-		if errors.Is(e, unix.ESRCH) {
-			return
-		}
-		if errors.Is(e, os.ErrNotExist) {
-			return
-		}
-		_ = level.Error(l).Log("msg", "failed to get process info", "err", e, "pid", pid)
-	}
 	for _, p := range processes {
 		spid := fmt.Sprintf("%d", p.Pid)
-		var (
-			exe, cwd, commandline, containerID, username, uid string
-		)
+		var exe, cwd, commandline, username, uid string
 		if cfg.Exe {
 			exe, err = p.Exe()
 			if err != nil {
-				loge(int(p.Pid), err)
+				logProcessError(l, spid, err)
 				continue
 			}
 		}
 		if cfg.Cwd {
 			cwd, err = p.Cwd()
 			if err != nil {
-				loge(int(p.Pid), err)
+				logProcessError(l, spid, err)
 				continue
 			}
 		}
 		if cfg.Commandline {
 			commandline, err = p.Cmdline()
 			if err != nil {
-				loge(int(p.Pid), err)
+				logProcessError(l, spid, err)
 				continue
 			}
 		}
@@ -119,40 +114,58 @@ func discover(l log.Logger, cfg *DiscoverConfig) ([]process, error) {
 			username, err = p.Username()
 			var uerr user.UnknownUserIdError
 			if err != nil && !errors.As(err, &uerr) {
-				loge(int(p.Pid), err)
+				logProcessError(l, spid, err)
 			}
 		}
 		if cfg.UID {
 			uids, err := p.Uids()
 			if err != nil {
-				loge(int(p.Pid), err)
+				logProcessError(l, spid, err)
 			}
 			if len(uids) > 0 {
 				uid = fmt.Sprintf("%d", uids[0])
 			}
 		}
 
-		if cfg.ContainerID {
-			containerID, err = getLinuxProcessContainerID(spid)
-			if err != nil {
-				loge(int(p.Pid), err)
-				continue
-			}
+		createTime, err := p.CreateTime()
+		if err != nil {
+			logProcessError(l, spid, err)
+			continue
+		}
+		info, err := a.get(spid, createTime, cfg)
+		if err != nil {
+			logProcessError(l, spid, err)
+			continue
 		}
 		res = append(res, process{
 			pid:         spid,
 			exe:         exe,
 			cwd:         cwd,
 			commandline: commandline,
-			containerID: containerID,
+			containerID: info.containerID,
 			username:    username,
 			uid:         uid,
+			libraries:   info.libraries,
+			identity:    info.identity,
 		})
 	}
+	a.prune()
 
 	return res, nil
 }
 
+// logProcessError logs a failure to get the info of a process, unless the
+// process has exited meanwhile.
+func logProcessError(l log.Logger, pid string, err error) {
+	if errors.Is(err, unix.ESRCH) {
+		return
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	_ = level.Error(l).Log("msg", "failed to get process info", "err", err, "pid", pid)
+}
+
 func getLinuxProcessContainerID(pid string) (string, error) {
 	if runtime.GOOS == "linux" {
 		cgroup, err := os.Open(path.Join("/proc", pid, "cgroup"))
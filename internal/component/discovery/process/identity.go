@@ -0,0 +1,208 @@
+//go:build linux
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	labelProcessStartTime = "__meta_process_start_time"
+	labelProcessEUID      = "__meta_process_euid"
+	labelProcessEGID      = "__meta_process_egid"
+	labelProcessExeHash   = "__meta_process_exe_hash"
+
+	// clockTicksPerSecond is USER_HZ, the unit of the times in
+	// /proc/<pid>/stat, which is 100 on the architectures the agent supports.
+	clockTicksPerSecond = 100
+
+	// exeHashChunkSize is how much of the start and of the end of an
+	// executable is hashed, to bound the I/O cost of hashing large binaries.
+	exeHashChunkSize = 1 << 20
+	// exeHashLength is the number of hex characters of the hash reported.
+	exeHashLength = 16
+)
+
+// processIdentity is the metadata identifying a process across deploys: when
+// it started, who it runs as and which binary it runs.
+type processIdentity struct {
+	startTime string
+	euid      string
+	egid      string
+	exeHash   string
+}
+
+func (id processIdentity) addLabels(labels map[string]string) {
+	if id.startTime != "" {
+		labels[labelProcessStartTime] = id.startTime
+	}
+	if id.euid != "" {
+		labels[labelProcessEUID] = id.euid
+	}
+	if id.egid != "" {
+		labels[labelProcessEGID] = id.egid
+	}
+	if id.exeHash != "" {
+		labels[labelProcessExeHash] = id.exeHash
+	}
+}
+
+// bootTime returns the time the host booted, which the start time of the
+// processes is relative to.
+var bootTime = sync.OnceValues(func() (time.Time, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	return parseBootTime(f)
+})
+
+// parseBootTime parses the boot time from the btime line of /proc/stat.
+func parseBootTime(stat io.Reader) (time.Time, error) {
+	scanner := bufio.NewScanner(stat)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "btime ")
+		if !ok {
+			continue
+		}
+		secs, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid btime %q: %w", value, err)
+		}
+		return time.Unix(secs, 0), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, err
+	}
+	return time.Time{}, fmt.Errorf("btime not found")
+}
+
+func getLinuxProcessStartTime(pid string) (string, error) {
+	boot, err := bootTime()
+	if err != nil {
+		return "", err
+	}
+	stat, err := os.ReadFile(path.Join("/proc", pid, "stat"))
+	if err != nil {
+		return "", err
+	}
+	ticks, err := parseStatStartTime(stat)
+	if err != nil {
+		return "", err
+	}
+	return formatStartTime(boot, ticks), nil
+}
+
+// formatStartTime formats the start time of a process started ticks clock
+// ticks after boot.
+func formatStartTime(boot time.Time, ticks uint64) string {
+	start := boot.Add(time.Duration(ticks) * time.Second / clockTicksPerSecond)
+	return start.UTC().Format(time.RFC3339)
+}
+
+// parseStatStartTime returns the start time of a process, in clock ticks
+// since boot, from its /proc/<pid>/stat file.
+func parseStatStartTime(stat []byte) (uint64, error) {
+	// The command name, the second field, is within parentheses and may
+	// contain spaces and parentheses itself, so the fields are counted from
+	// the last closing parenthesis.
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid stat: command name not found")
+	}
+	// The fields after the command name start with the state, the third
+	// field, and the start time is the 22nd field.
+	fields := strings.Fields(string(stat[i+1:]))
+	const startTimeIndex = 22 - 3
+	if len(fields) <= startTimeIndex {
+		return 0, fmt.Errorf("invalid stat: %d fields after the command name", len(fields))
+	}
+	ticks, err := strconv.ParseUint(fields[startTimeIndex], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid stat start time %q: %w", fields[startTimeIndex], err)
+	}
+	return ticks, nil
+}
+
+func getLinuxProcessEffectiveIDs(pid string) (euid, egid string, err error) {
+	status, err := os.Open(path.Join("/proc", pid, "status"))
+	if err != nil {
+		return "", "", err
+	}
+	defer status.Close()
+	return parseStatusEffectiveIDs(status)
+}
+
+// parseStatusEffectiveIDs returns the effective UID and GID of a process from
+// its /proc/<pid>/status file.
+func parseStatusEffectiveIDs(status io.Reader) (euid, egid string, err error) {
+	scanner := bufio.NewScanner(status)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || (key != "Uid" && key != "Gid") {
+			continue
+		}
+		// The real, effective, saved set and filesystem IDs.
+		ids := strings.Fields(value)
+		if len(ids) < 2 {
+			return "", "", fmt.Errorf("invalid status %s line %q", key, value)
+		}
+		if key == "Uid" {
+			euid = ids[1]
+		} else {
+			egid = ids[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+	if euid == "" || egid == "" {
+		return "", "", fmt.Errorf("invalid status: Uid or Gid not found")
+	}
+	return euid, egid, nil
+}
+
+func getLinuxProcessExeHash(pid string) (string, error) {
+	exe, err := os.Open(path.Join("/proc", pid, "exe"))
+	if err != nil {
+		return "", err
+	}
+	defer exe.Close()
+	st, err := exe.Stat()
+	if err != nil {
+		return "", err
+	}
+	return hashExe(exe, st.Size())
+}
+
+// hashExe returns a short hash of an executable of the given size. Only the
+// first and the last exeHashChunkSize bytes are hashed, along with the size,
+// so that hashing large binaries stays cheap.
+func hashExe(exe io.ReaderAt, size int64) (string, error) {
+	h := sha256.New()
+	_ = binary.Write(h, binary.LittleEndian, size)
+
+	head := min(size, exeHashChunkSize)
+	if _, err := io.Copy(h, io.NewSectionReader(exe, 0, head)); err != nil {
+		return "", err
+	}
+	// The tail doesn't overlap the head in smaller executables.
+	tail := min(size-head, exeHashChunkSize)
+	if _, err := io.Copy(h, io.NewSectionReader(exe, size-tail, tail)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:exeHashLength], nil
+}
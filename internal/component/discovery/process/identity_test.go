@@ -0,0 +1,93 @@
+//go:build linux
+
+package process
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatStartTime(t *testing.T) {
+	stat, err := os.ReadFile("testdata/stat_nginx")
+	require.NoError(t, err)
+
+	ticks, err := parseStatStartTime(stat)
+	require.NoError(t, err)
+	require.Equal(t, uint64(8624315), ticks)
+
+	// The command name may contain spaces and parentheses.
+	ticks, err = parseStatStartTime([]byte("42 (a) b (c) S 1 42 42 0 -1 4194560 1 0 0 0 0 0 0 0 20 0 1 0 1234 0 0"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1234), ticks)
+
+	_, err = parseStatStartTime([]byte("42 (truncated) S 1 42"))
+	require.Error(t, err)
+}
+
+func TestParseBootTime(t *testing.T) {
+	f, err := os.Open("testdata/proc_stat")
+	require.NoError(t, err)
+	defer f.Close()
+
+	boot, err := parseBootTime(f)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1700000000, 0), boot)
+	require.Equal(t, "2023-11-15T22:10:43Z", formatStartTime(boot, 8624315))
+
+	_, err = parseBootTime(strings.NewReader("cpu  1 2 3 4\n"))
+	require.Error(t, err)
+}
+
+func TestParseStatusEffectiveIDs(t *testing.T) {
+	f, err := os.Open("testdata/status_nginx")
+	require.NoError(t, err)
+	defer f.Close()
+
+	// The real IDs are root's, the effective ones the nginx user's.
+	euid, egid, err := parseStatusEffectiveIDs(f)
+	require.NoError(t, err)
+	require.Equal(t, "101", euid)
+	require.Equal(t, "101", egid)
+
+	_, _, err = parseStatusEffectiveIDs(strings.NewReader("Name:\tnginx\nUid:\t0\t101\t101\t101\n"))
+	require.Error(t, err)
+}
+
+func TestHashExe(t *testing.T) {
+	hash := func(b []byte) string {
+		h, err := hashExe(bytes.NewReader(b), int64(len(b)))
+		require.NoError(t, err)
+		require.Len(t, h, exeHashLength)
+		return h
+	}
+
+	small := []byte("#!/bin/sh\necho hello\n")
+	require.Equal(t, hash(small), hash(bytes.Clone(small)))
+	require.NotEqual(t, hash(small), hash([]byte("#!/bin/sh\necho world\n")))
+
+	// Only the first and the last chunks of large executables are hashed.
+	large := make([]byte, 3*exeHashChunkSize)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	h := hash(large)
+	require.Equal(t, h, hash(bytes.Clone(large)))
+
+	middle := bytes.Clone(large)
+	middle[exeHashChunkSize+42]++
+	require.Equal(t, h, hash(middle))
+
+	for _, i := range []int{0, exeHashChunkSize - 1, 2 * exeHashChunkSize, len(large) - 1} {
+		changed := bytes.Clone(large)
+		changed[i]++
+		require.NotEqual(t, h, hash(changed), "byte %d", i)
+	}
+
+	// The size is part of the hash.
+	require.NotEqual(t, h, hash(append(bytes.Clone(large[:exeHashChunkSize]), large[len(large)-exeHashChunkSize:]...)))
+}
@@ -0,0 +1,174 @@
+//go:build linux
+
+package process
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	labelProcessLibraries      = "__meta_process_libraries"
+	labelProcessLibraryPrefix  = "__meta_process_library_"
+	librariesTruncatedSuffix   = "..."
+	unknownLibraryVersion      = "unknown"
+	maxLibraries               = 64
+	maxLibrariesLabelLength    = 2048
+	maxLibraryVersionsPerLabel = 4
+)
+
+var (
+	// allowedLibraries are the libraries reported in their own
+	// __meta_process_library_<name> label.
+	allowedLibraries = map[string]struct{}{
+		"libssl":    {},
+		"libcrypto": {},
+		"libc":      {},
+	}
+
+	// libraryRe matches the basename of a shared library, such as
+	// libssl.so.3 or libc-2.31.so, capturing its name and version.
+	libraryRe = regexp.MustCompile(`^(.+?)(?:-(\d[\d.]*))?\.so(?:\.(\d[\d.]*))?$`)
+)
+
+type library struct {
+	basename string
+	name     string
+	version  string
+}
+
+func getLinuxProcessLibraries(pid string) ([]library, error) {
+	maps, err := os.Open(path.Join("/proc", pid, "maps"))
+	if err != nil {
+		return nil, err
+	}
+	defer maps.Close()
+	return getLibrariesFromMaps(maps)
+}
+
+// getLibrariesFromMaps returns the shared libraries mapped in a
+// /proc/<pid>/maps file, deduplicated by path and sorted by basename.
+func getLibrariesFromMaps(maps io.Reader) ([]library, error) {
+	var (
+		res   []library
+		paths = make(map[string]struct{})
+	)
+	scanner := bufio.NewScanner(maps)
+	for scanner.Scan() {
+		// Lines are "address perms offset dev inode pathname", where the
+		// pathname is optional and may contain spaces.
+		fields := strings.SplitN(scanner.Text(), " ", 6)
+		if len(fields) < 6 {
+			continue
+		}
+		p := strings.TrimSuffix(strings.TrimSpace(fields[5]), " (deleted)")
+		if !strings.HasPrefix(p, "/") {
+			continue
+		}
+		if _, ok := paths[p]; ok {
+			continue
+		}
+		lib, ok := parseLibrary(filepath.Base(p))
+		if !ok {
+			continue
+		}
+		paths[p] = struct{}{}
+		res = append(res, lib)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].basename < res[j].basename })
+	return res, nil
+}
+
+func parseLibrary(basename string) (library, bool) {
+	m := libraryRe.FindStringSubmatch(basename)
+	if m == nil {
+		return library{}, false
+	}
+	version := m[3]
+	if version == "" {
+		version = m[2]
+	}
+	return library{basename: basename, name: m[1], version: version}, true
+}
+
+// librariesLabels returns the labels describing libs: the list of their
+// basenames, truncated to maxLibraries entries and maxLibrariesLabelLength
+// bytes, and the versions of the allowed libraries.
+func librariesLabels(libs []library) map[string]string {
+	labels := make(map[string]string)
+	if len(libs) == 0 {
+		return labels
+	}
+
+	var (
+		list      strings.Builder
+		count     int
+		truncated bool
+		seen      = make(map[string]struct{}, len(libs))
+		versions  = make(map[string][]string)
+	)
+	for _, lib := range libs {
+		if _, ok := allowedLibraries[lib.name]; ok {
+			version := lib.version
+			if version == "" {
+				version = unknownLibraryVersion
+			}
+			versions[lib.name] = appendVersion(versions[lib.name], version)
+		}
+
+		// The same basename may be mapped from several paths.
+		if _, ok := seen[lib.basename]; ok || truncated {
+			continue
+		}
+		seen[lib.basename] = struct{}{}
+
+		length := list.Len() + len(lib.basename)
+		if count > 0 {
+			length++
+		}
+		if count == maxLibraries || length+len(librariesTruncatedSuffix)+1 > maxLibrariesLabelLength {
+			truncated = true
+			continue
+		}
+		if count > 0 {
+			list.WriteString(",")
+		}
+		list.WriteString(lib.basename)
+		count++
+	}
+	if truncated {
+		list.WriteString("," + librariesTruncatedSuffix)
+	}
+	labels[labelProcessLibraries] = list.String()
+
+	for name, vs := range versions {
+		labels[labelProcessLibraryPrefix+name] = strings.Join(vs, ",")
+	}
+	return labels
+}
+
+// appendVersion adds version to the sorted versions, unless it is already
+// present or maxLibraryVersionsPerLabel versions are already known.
+func appendVersion(versions []string, version string) []string {
+	i := sort.SearchStrings(versions, version)
+	if i < len(versions) && versions[i] == version {
+		return versions
+	}
+	if len(versions) == maxLibraryVersionsPerLabel {
+		return versions
+	}
+	versions = append(versions, "")
+	copy(versions[i+1:], versions[i:])
+	versions[i] = version
+	return versions
+}
@@ -0,0 +1,93 @@
+//go:build linux
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibrariesFromMaps(t *testing.T) {
+	f, err := os.Open("testdata/maps_nginx")
+	require.NoError(t, err)
+	defer f.Close()
+
+	libs, err := getLibrariesFromMaps(f)
+	require.NoError(t, err)
+
+	// Each path is reported once, however many times it is mapped. The same
+	// library mapped from two paths is reported twice.
+	require.Equal(t, []library{
+		{basename: "ld-linux-x86-64.so.2", name: "ld-linux-x86", version: "2"},
+		{basename: "libc.so.6", name: "libc", version: "6"},
+		{basename: "libcrypto.so.3", name: "libcrypto", version: "3"},
+		{basename: "libpcre2-8.so.0", name: "libpcre2", version: "0"},
+		{basename: "libssl.so.1.1", name: "libssl", version: "1.1"},
+		{basename: "libssl.so.3", name: "libssl", version: "3"},
+		{basename: "libz.so.1.2.13", name: "libz", version: "1.2.13"},
+		{basename: "libz.so.1.2.13", name: "libz", version: "1.2.13"},
+	}, libs)
+
+	require.Equal(t, map[string]string{
+		"__meta_process_libraries":         "ld-linux-x86-64.so.2,libc.so.6,libcrypto.so.3,libpcre2-8.so.0,libssl.so.1.1,libssl.so.3,libz.so.1.2.13",
+		"__meta_process_library_libc":      "6",
+		"__meta_process_library_libcrypto": "3",
+		"__meta_process_library_libssl":    "1.1,3",
+	}, librariesLabels(libs))
+}
+
+func TestLibrariesFromMaps_Truncated(t *testing.T) {
+	f, err := os.Open("testdata/maps_many_libraries")
+	require.NoError(t, err)
+	defer f.Close()
+
+	libs, err := getLibrariesFromMaps(f)
+	require.NoError(t, err)
+	require.Len(t, libs, 101)
+
+	expect := []string{"libc.so.6"}
+	for i := 0; i < maxLibraries-1; i++ {
+		expect = append(expect, fmt.Sprintf("libplugin%03d.so.1", i))
+	}
+	expect = append(expect, librariesTruncatedSuffix)
+
+	labels := librariesLabels(libs)
+	require.Equal(t, strings.Join(expect, ","), labels[labelProcessLibraries])
+	// Allowed libraries are reported even when the list is truncated.
+	require.Equal(t, "6", labels["__meta_process_library_libc"])
+}
+
+func TestLibrariesLabels_Length(t *testing.T) {
+	var libs []library
+	for i := 0; i < maxLibraries; i++ {
+		basename := fmt.Sprintf("lib%02d%s.so", i, strings.Repeat("x", 100))
+		libs = append(libs, library{basename: basename, name: strings.TrimSuffix(basename, ".so")})
+	}
+
+	list := librariesLabels(libs)[labelProcessLibraries]
+	require.LessOrEqual(t, len(list), maxLibrariesLabelLength)
+	require.True(t, strings.HasSuffix(list, ","+librariesTruncatedSuffix))
+	require.True(t, strings.HasPrefix(list, libs[0].basename+","))
+}
+
+func TestLibrariesLabels_Versions(t *testing.T) {
+	var libs []library
+	for _, basename := range []string{"libc.so", "libc-2.31.so", "libssl.so.1.0.0", "libssl.so.1.0.2", "libssl.so.1.1", "libssl.so.3", "libssl.so.3.1"} {
+		lib, ok := parseLibrary(basename)
+		require.True(t, ok)
+		libs = append(libs, lib)
+	}
+
+	labels := librariesLabels(libs)
+	require.Equal(t, "2.31,unknown", labels["__meta_process_library_libc"])
+	// The number of versions is bounded too.
+	require.Equal(t, "1.0.0,1.0.2,1.1,3", labels["__meta_process_library_libssl"])
+	require.NotContains(t, labels, "__meta_process_library_libcrypto")
+
+	_, ok := parseLibrary("locale-archive")
+	require.False(t, ok)
+}
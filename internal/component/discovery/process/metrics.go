@@ -0,0 +1,36 @@
+//go:build linux
+
+package process
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const (
+	reasonExeChanged = "exe_changed"
+	reasonMaxAge     = "max_age"
+)
+
+type metrics struct {
+	reanalysesTotal   *prometheus.CounterVec
+	labelChangesTotal prometheus.Counter
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		reanalysesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "discovery_process_reanalyses_total",
+			Help: "Total number of times a running process was analyzed again, by reason",
+		}, []string{"reason"}),
+		labelChangesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "discovery_process_label_changes_total",
+			Help: "Total number of times analyzing a running process again changed its labels",
+		}),
+	}
+
+	if reg != nil {
+		reg.MustRegister(
+			m.reanalysesTotal,
+			m.labelChangesTotal,
+		)
+	}
+	return m
+}
@@ -4,6 +4,7 @@ package process
 
 import (
 	"context"
+	"reflect"
 	"time"
 
 	"github.com/go-kit/log"
@@ -31,6 +32,7 @@ func New(opts component.Options, args Arguments) (*Component, error) {
 		onStateChange: opts.OnStateChange,
 		argsUpdates:   make(chan Arguments),
 		args:          args,
+		analyzer:      newAnalyzer(opts.Logger, newMetrics(opts.Registerer), args.AnalysisMaxAge),
 	}
 	return c, nil
 }
@@ -41,11 +43,14 @@ type Component struct {
 	processes     []discovery.Target
 	argsUpdates   chan Arguments
 	args          Arguments
+	analyzer      *analyzer
+
+	exported []discovery.Target // Targets of the last state change, nil before the first one.
 }
 
 func (c *Component) Run(ctx context.Context) error {
 	doDiscover := func() error {
-		processes, err := discover(c.l, &c.args.DiscoverConfig)
+		processes, err := discover(c.l, &c.args.DiscoverConfig, c.analyzer)
 		if err != nil {
 			return err
 		}
@@ -69,6 +74,12 @@ func (c *Component) Run(ctx context.Context) error {
 			}
 			t.Reset(c.args.RefreshInterval)
 		case a := <-c.argsUpdates:
+			if a.DiscoverConfig != c.args.DiscoverConfig {
+				// The cached analyses may lack metadata which is now
+				// discovered.
+				c.analyzer.reset()
+			}
+			c.analyzer.maxAge = a.AnalysisMaxAge
 			c.args = a
 			c.changed()
 		}
@@ -81,8 +92,15 @@ func (c *Component) Update(args component.Arguments) error {
 	return nil
 }
 
+// changed exports the targets, unless they didn't change since they were
+// last exported to avoid churn in the downstream components.
 func (c *Component) changed() {
+	targets := join(c.processes, c.args.Join)
+	if c.exported != nil && reflect.DeepEqual(targets, c.exported) {
+		return
+	}
+	c.exported = targets
 	c.onStateChange(discovery.Exports{
-		Targets: join(c.processes, c.args.Join),
+		Targets: targets,
 	})
 }
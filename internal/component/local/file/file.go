@@ -88,8 +88,9 @@ type Component struct {
 }
 
 var (
-	_ component.Component       = (*Component)(nil)
-	_ component.HealthComponent = (*Component)(nil)
+	_ component.Component            = (*Component)(nil)
+	_ component.HealthComponent      = (*Component)(nil)
+	_ component.ReevaluatedComponent = (*Component)(nil)
 )
 
 // New creates a new local.file component.
@@ -256,6 +257,16 @@ func (c *Component) configureDetector() error {
 	return err
 }
 
+// ReevaluationInterval implements component.ReevaluatedComponent. The
+// arguments are re-evaluated every poll_frequency, so that a filename built
+// from sources outside of the component graph, such as environment
+// variables, is picked up when they change.
+func (c *Component) ReevaluationInterval() time.Duration {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.args.PollFrequency
+}
+
 // CurrentHealth implements component.HealthComponent.
 func (c *Component) CurrentHealth() component.Health {
 	c.healthMut.RLock()
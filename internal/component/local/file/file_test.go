@@ -8,10 +8,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/component/local/file"
 	filedetector "github.com/grafana/agent/internal/filedetector"
 	"github.com/grafana/agent/internal/flow/componenttest"
+	"github.com/grafana/agent/internal/util"
 	"github.com/grafana/river/rivertypes"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 )
 
@@ -116,6 +119,30 @@ func TestFile_ImmediateExports(t *testing.T) {
 	}, tc.Exports())
 }
 
+func TestFile_ReevaluationInterval(t *testing.T) {
+	testFile := filepath.Join(t.TempDir(), "testfile")
+	require.NoError(t, os.WriteFile(testFile, []byte("Hello, world!"), 0664))
+
+	c, err := file.New(component.Options{
+		Logger:        util.TestFlowLogger(t),
+		Registerer:    prometheus.NewRegistry(),
+		OnStateChange: func(e component.Exports) {},
+	}, file.Arguments{
+		Filename:      testFile,
+		Type:          filedetector.DetectorPoll,
+		PollFrequency: time.Minute,
+	})
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, c.ReevaluationInterval())
+
+	require.NoError(t, c.Update(file.Arguments{
+		Filename:      testFile,
+		Type:          filedetector.DetectorPoll,
+		PollFrequency: 10 * time.Second,
+	}))
+	require.Equal(t, 10*time.Second, c.ReevaluationInterval())
+}
+
 // TestFile_ExistOnLoad ensures that the configured file must exist on the
 // first load of local.file.
 func TestFile_ExistOnLoad(t *testing.T) {
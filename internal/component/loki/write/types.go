@@ -17,19 +17,29 @@ import (
 
 // EndpointOptions describes an individual location to send logs to.
 type EndpointOptions struct {
-	Name              string                  `river:"name,attr,optional"`
-	URL               string                  `river:"url,attr"`
-	BatchWait         time.Duration           `river:"batch_wait,attr,optional"`
-	BatchSize         units.Base2Bytes        `river:"batch_size,attr,optional"`
-	RemoteTimeout     time.Duration           `river:"remote_timeout,attr,optional"`
-	Headers           map[string]string       `river:"headers,attr,optional"`
-	MinBackoff        time.Duration           `river:"min_backoff_period,attr,optional"`  // start backoff at this level
-	MaxBackoff        time.Duration           `river:"max_backoff_period,attr,optional"`  // increase exponentially to this level
-	MaxBackoffRetries int                     `river:"max_backoff_retries,attr,optional"` // give up after this many; zero means infinite retries
-	TenantID          string                  `river:"tenant_id,attr,optional"`
-	RetryOnHTTP429    bool                    `river:"retry_on_http_429,attr,optional"`
-	HTTPClientConfig  *types.HTTPClientConfig `river:",squash"`
-	QueueConfig       QueueConfig             `river:"queue_config,block,optional"`
+	Name                    string                  `river:"name,attr,optional"`
+	URL                     string                  `river:"url,attr"`
+	Protocol                string                  `river:"protocol,attr,optional"`
+	BatchWait               time.Duration           `river:"batch_wait,attr,optional"`
+	BatchSize               units.Base2Bytes        `river:"batch_size,attr,optional"`
+	MaxRequestBytes         units.Base2Bytes        `river:"max_request_bytes,attr,optional"`
+	RemoteTimeout           time.Duration           `river:"remote_timeout,attr,optional"`
+	DialTimeout             time.Duration           `river:"dial_timeout,attr,optional"`
+	TLSHandshakeTimeout     time.Duration           `river:"tls_handshake_timeout,attr,optional"`
+	ResponseHeaderTimeout   time.Duration           `river:"response_header_timeout,attr,optional"`
+	Headers                 map[string]string       `river:"headers,attr,optional"`
+	MinBackoff              time.Duration           `river:"min_backoff_period,attr,optional"`  // start backoff at this level
+	MaxBackoff              time.Duration           `river:"max_backoff_period,attr,optional"`  // increase exponentially to this level
+	MaxBackoffRetries       int                     `river:"max_backoff_retries,attr,optional"` // give up after this many; zero means infinite retries
+	TenantID                string                  `river:"tenant_id,attr,optional"`
+	MaxTenants              int                     `river:"max_tenants,attr,optional"`
+	RetryOnHTTP429          bool                    `river:"retry_on_http_429,attr,optional"`
+	StripStructuredMetadata bool                    `river:"strip_structured_metadata,attr,optional"`
+	HTTPClientConfig        *types.HTTPClientConfig `river:",squash"`
+	QueueConfig             QueueConfig             `river:"queue_config,block,optional"`
+	CircuitBreaker          CircuitBreakerConfig    `river:"circuit_breaker,block,optional"`
+	LabelLimits             LabelLimitsConfig       `river:"label_limits,block,optional"`
+	StartupProbe            StartupProbeConfig      `river:"startup_probe,block,optional"`
 }
 
 // GetDefaultEndpointOptions defines the default settings for sending logs to a
@@ -39,14 +49,23 @@ type EndpointOptions struct {
 // For a total time of 511.5s (8.5m) before logs are lost.
 func GetDefaultEndpointOptions() EndpointOptions {
 	var defaultEndpointOptions = EndpointOptions{
+		Protocol:          client.ProtocolLoki,
 		BatchWait:         1 * time.Second,
 		BatchSize:         1 * units.MiB,
 		RemoteTimeout:     10 * time.Second,
 		MinBackoff:        500 * time.Millisecond,
 		MaxBackoff:        5 * time.Minute,
 		MaxBackoffRetries: 10,
+		MaxTenants:        client.MaxTenants,
 		HTTPClientConfig:  types.CloneDefaultHTTPClientConfig(),
 		RetryOnHTTP429:    true,
+		CircuitBreaker:    CircuitBreakerConfig{OpenDuration: client.CircuitBreakerOpenDuration},
+		LabelLimits: LabelLimitsConfig{
+			MaxLabelNamesPerSeries: client.MaxLabelNamesPerSeries,
+			MaxLabelNameLength:     client.MaxLabelNameLength,
+			MaxLabelValueLength:    client.MaxLabelValueLength,
+		},
+		StartupProbe: StartupProbeConfig{Timeout: client.ProbeTimeout},
 	}
 
 	return defaultEndpointOptions
@@ -63,6 +82,39 @@ func (r *EndpointOptions) Validate() error {
 		return fmt.Errorf("failed to parse remote url %q: %w", r.URL, err)
 	}
 
+	if r.DialTimeout < 0 || r.TLSHandshakeTimeout < 0 || r.ResponseHeaderTimeout < 0 {
+		return fmt.Errorf("dial_timeout, tls_handshake_timeout and response_header_timeout must not be negative")
+	}
+
+	switch r.Protocol {
+	case client.ProtocolLoki, client.ProtocolOTLPHTTP:
+	default:
+		return fmt.Errorf("unsupported protocol %q, must be one of %q or %q", r.Protocol, client.ProtocolLoki, client.ProtocolOTLPHTTP)
+	}
+
+	if r.MaxTenants <= 0 {
+		return fmt.Errorf("max_tenants must be greater than 0")
+	}
+
+	if r.MaxRequestBytes < 0 {
+		return fmt.Errorf("max_request_bytes must not be negative")
+	}
+
+	if r.CircuitBreaker.FailureThreshold < 0 {
+		return fmt.Errorf("circuit_breaker failure_threshold must not be negative")
+	}
+	if r.CircuitBreaker.FailureThreshold > 0 && r.CircuitBreaker.OpenDuration <= 0 {
+		return fmt.Errorf("circuit_breaker open_duration must be greater than 0")
+	}
+
+	if r.LabelLimits.MaxLabelNamesPerSeries < 0 || r.LabelLimits.MaxLabelNameLength < 0 || r.LabelLimits.MaxLabelValueLength < 0 {
+		return fmt.Errorf("label_limits max_label_names_per_series, max_label_name_length and max_label_value_length must not be negative")
+	}
+
+	if r.StartupProbe.Timeout <= 0 {
+		return fmt.Errorf("startup_probe timeout must be greater than 0")
+	}
+
 	// We must explicitly Validate because HTTPClientConfig is squashed and it won't run otherwise
 	if r.HTTPClientConfig != nil {
 		return r.HTTPClientConfig.Validate()
@@ -86,6 +138,30 @@ func (q *QueueConfig) SetToDefault() {
 	}
 }
 
+// CircuitBreakerConfig configures the circuit breaker of an endpoint, which
+// pauses sending to the endpoint after consecutive failures.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `river:"failure_threshold,attr,optional"`
+	OpenDuration     time.Duration `river:"open_duration,attr,optional"`
+}
+
+// LabelLimitsConfig configures the validation of the labels of each entry
+// before it's sent to an endpoint.
+type LabelLimitsConfig struct {
+	MaxLabelNamesPerSeries int  `river:"max_label_names_per_series,attr,optional"`
+	MaxLabelNameLength     int  `river:"max_label_name_length,attr,optional"`
+	MaxLabelValueLength    int  `river:"max_label_value_length,attr,optional"`
+	DropInvalidLabels      bool `river:"drop_invalid_labels,attr,optional"`
+}
+
+// StartupProbeConfig configures the probe of an endpoint when the component
+// starts or is updated, which pushes a request without any log entry to the
+// endpoint.
+type StartupProbeConfig struct {
+	Enabled bool          `river:"enabled,attr,optional"`
+	Timeout time.Duration `river:"timeout,attr,optional"`
+}
+
 func (args Arguments) convertClientConfigs() []client.Config {
 	var res []client.Config
 	for _, cfg := range args.Endpoints {
@@ -93,6 +169,7 @@ func (args Arguments) convertClientConfigs() []client.Config {
 		cc := client.Config{
 			Name:      cfg.Name,
 			URL:       flagext.URLValue{URL: url},
+			Protocol:  cfg.Protocol,
 			Headers:   cfg.Headers,
 			BatchWait: cfg.BatchWait,
 			BatchSize: int(cfg.BatchSize),
@@ -102,10 +179,30 @@ func (args Arguments) convertClientConfigs() []client.Config {
 				MaxBackoff: cfg.MaxBackoff,
 				MaxRetries: cfg.MaxBackoffRetries,
 			},
-			ExternalLabels:         lokiflagext.LabelSet{LabelSet: utils.ToLabelSet(args.ExternalLabels)},
-			Timeout:                cfg.RemoteTimeout,
-			TenantID:               cfg.TenantID,
-			DropRateLimitedBatches: !cfg.RetryOnHTTP429,
+			ExternalLabels:          lokiflagext.LabelSet{LabelSet: utils.ToLabelSet(args.ExternalLabels)},
+			Timeout:                 cfg.RemoteTimeout,
+			DialTimeout:             cfg.DialTimeout,
+			TLSHandshakeTimeout:     cfg.TLSHandshakeTimeout,
+			ResponseHeaderTimeout:   cfg.ResponseHeaderTimeout,
+			TenantID:                cfg.TenantID,
+			MaxTenants:              cfg.MaxTenants,
+			DropRateLimitedBatches:  !cfg.RetryOnHTTP429,
+			StripStructuredMetadata: cfg.StripStructuredMetadata,
+			MaxRequestBytes:         int(cfg.MaxRequestBytes),
+			CircuitBreaker: client.CircuitBreakerConfig{
+				FailureThreshold: cfg.CircuitBreaker.FailureThreshold,
+				OpenDuration:     cfg.CircuitBreaker.OpenDuration,
+			},
+			LabelLimits: client.LabelLimitsConfig{
+				MaxLabelNamesPerSeries: cfg.LabelLimits.MaxLabelNamesPerSeries,
+				MaxLabelNameLength:     cfg.LabelLimits.MaxLabelNameLength,
+				MaxLabelValueLength:    cfg.LabelLimits.MaxLabelValueLength,
+				DropInvalidLabels:      cfg.LabelLimits.DropInvalidLabels,
+			},
+			Probe: client.ProbeConfig{
+				Enabled: cfg.StartupProbe.Enabled,
+				Timeout: cfg.StartupProbe.Timeout,
+			},
 			Queue: client.QueueConfig{
 				Capacity:     int(cfg.QueueConfig.Capacity),
 				DrainTimeout: cfg.QueueConfig.DrainTimeout,
@@ -3,10 +3,15 @@ package write
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/grafana/agent/internal/agentseed"
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/component/common/loki"
@@ -14,6 +19,8 @@ import (
 	"github.com/grafana/agent/internal/component/common/loki/limit"
 	"github.com/grafana/agent/internal/component/common/loki/wal"
 	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	http_service "github.com/grafana/agent/internal/service/http"
 )
 
 func init() {
@@ -35,22 +42,53 @@ type Arguments struct {
 	ExternalLabels map[string]string `river:"external_labels,attr,optional"`
 	MaxStreams     int               `river:"max_streams,attr,optional"`
 	WAL            WalArguments      `river:"wal,block,optional"`
+	Dedup          DedupArguments    `river:"deduplication,block,optional"`
+	AppendTimeout  time.Duration     `river:"append_timeout,attr,optional"`
+}
+
+// Validate implements river.Validator.
+func (a *Arguments) Validate() error {
+	if a.AppendTimeout < 0 {
+		return fmt.Errorf("append_timeout must not be negative")
+	}
+	if a.AppendTimeout > 0 && a.WAL.Enabled {
+		return fmt.Errorf("append_timeout can't be set when the WAL is enabled")
+	}
+	return nil
 }
 
 // WalArguments holds the settings for configuring the Write-Ahead Log (WAL) used
 // by the underlying remote write client.
 type WalArguments struct {
-	Enabled          bool          `river:"enabled,attr,optional"`
-	MaxSegmentAge    time.Duration `river:"max_segment_age,attr,optional"`
-	MinReadFrequency time.Duration `river:"min_read_frequency,attr,optional"`
-	MaxReadFrequency time.Duration `river:"max_read_frequency,attr,optional"`
-	DrainTimeout     time.Duration `river:"drain_timeout,attr,optional"`
+	Enabled          bool             `river:"enabled,attr,optional"`
+	MaxSegmentAge    time.Duration    `river:"max_segment_age,attr,optional"`
+	MinReadFrequency time.Duration    `river:"min_read_frequency,attr,optional"`
+	MaxReadFrequency time.Duration    `river:"max_read_frequency,attr,optional"`
+	DrainTimeout     time.Duration    `river:"drain_timeout,attr,optional"`
+	MaxSize          units.Base2Bytes `river:"max_size,attr,optional"`
+
+	ReplayMaxEntriesPerSecond float64 `river:"replay_max_entries_per_second,attr,optional"`
+	ReplayMaxBytesPerSecond   float64 `river:"replay_max_bytes_per_second,attr,optional"`
+
+	OnCorruption string `river:"on_corruption,attr,optional"`
 }
 
 func (wa *WalArguments) Validate() error {
 	if wa.MinReadFrequency >= wa.MaxReadFrequency {
 		return fmt.Errorf("WAL min read frequency should be lower than max read frequency")
 	}
+	if wa.ReplayMaxEntriesPerSecond < 0 {
+		return fmt.Errorf("WAL replay max entries per second must not be negative")
+	}
+	if wa.ReplayMaxBytesPerSecond < 0 {
+		return fmt.Errorf("WAL replay max bytes per second must not be negative")
+	}
+	if wa.MaxSize < 0 {
+		return fmt.Errorf("WAL max size must not be negative")
+	}
+	if err := wal.ValidateCorruptionPolicy(wa.OnCorruption); err != nil {
+		return fmt.Errorf("WAL on_corruption: %w", err)
+	}
 	return nil
 }
 
@@ -63,7 +101,40 @@ func (wa *WalArguments) SetToDefault() {
 		MinReadFrequency: wal.DefaultWatchConfig.MinReadFrequency,
 		MaxReadFrequency: wal.DefaultWatchConfig.MaxReadFrequency,
 		DrainTimeout:     wal.DefaultWatchConfig.DrainTimeout,
+		OnCorruption:     wal.DefaultWatchConfig.CorruptionPolicy,
+	}
+}
+
+// DedupArguments configures the deduplication of the log entries received
+// by the component, which suppresses entries with the same labels, timestamp
+// and line as an entry received within the window.
+type DedupArguments struct {
+	Enabled   bool             `river:"enabled,attr,optional"`
+	Window    time.Duration    `river:"window,attr,optional"`
+	MaxMemory units.Base2Bytes `river:"max_memory,attr,optional"`
+}
+
+// SetToDefault implements river.Defaulter.
+func (da *DedupArguments) SetToDefault() {
+	*da = DedupArguments{
+		Enabled:   false,
+		Window:    10 * time.Second,
+		MaxMemory: 16 * units.MiB,
+	}
+}
+
+// Validate implements river.Validator.
+func (da *DedupArguments) Validate() error {
+	if !da.Enabled {
+		return nil
 	}
+	if da.Window <= 0 {
+		return fmt.Errorf("deduplication window must be greater than 0")
+	}
+	if da.MaxMemory <= 0 {
+		return fmt.Errorf("deduplication max_memory must be greater than 0")
+	}
+	return nil
 }
 
 // Exports holds the receiver that is used to send log entries to the
@@ -73,7 +144,10 @@ type Exports struct {
 }
 
 var (
-	_ component.Component = (*Component)(nil)
+	_ component.Component       = (*Component)(nil)
+	_ component.DebugComponent  = (*Component)(nil)
+	_ component.HealthComponent = (*Component)(nil)
+	_ http_service.Component    = (*Component)(nil)
 )
 
 // Component implements the loki.write component.
@@ -134,6 +208,18 @@ func (c *Component) Run(ctx context.Context) error {
 			return nil
 		case entry := <-c.receiver.Chan():
 			c.mut.RLock()
+			if c.args.AppendTimeout > 0 {
+				c.appendEntry(ctx, entry)
+				c.mut.RUnlock()
+				continue
+			}
+			// With the WAL enabled, duplicates are suppressed before they're
+			// written to the WAL. Otherwise, the client manager suppresses
+			// them.
+			if c.args.WAL.Enabled && c.clientManger.Duplicate(entry) {
+				c.mut.RUnlock()
+				continue
+			}
 			select {
 			case <-ctx.Done():
 				c.mut.RUnlock()
@@ -145,6 +231,21 @@ func (c *Component) Run(ctx context.Context) error {
 	}
 }
 
+// appendEntry hands entry to the endpoints synchronously: the next entry isn't
+// received until every endpoint accepted this one or the append timeout
+// expired, which slows down upstream components while endpoints fall behind.
+// c.mut must be held for reading.
+func (c *Component) appendEntry(ctx context.Context, entry loki.Entry) {
+	appendCtx, cancel := context.WithTimeout(ctx, c.args.AppendTimeout)
+	defer cancel()
+
+	// Rejected entries are dropped for the endpoints which didn't accept them,
+	// and counted in loki_write_rejected_entries_total.
+	if err := c.clientManger.Append(appendCtx, entry); err != nil && ctx.Err() == nil {
+		level.Warn(c.opts.Logger).Log("msg", "dropped log entry not accepted by endpoints before append_timeout", "err", err)
+	}
+}
+
 // Update implements component.Component.
 func (c *Component) Update(args component.Arguments) error {
 	newArgs := args.(Arguments)
@@ -174,10 +275,16 @@ func (c *Component) Update(args component.Arguments) error {
 	walCfg := wal.Config{
 		Enabled:       newArgs.WAL.Enabled,
 		MaxSegmentAge: newArgs.WAL.MaxSegmentAge,
+		MaxSizeBytes:  int64(newArgs.WAL.MaxSize),
 		WatchConfig: wal.WatchConfig{
 			MinReadFrequency: newArgs.WAL.MinReadFrequency,
 			MaxReadFrequency: newArgs.WAL.MaxReadFrequency,
 			DrainTimeout:     newArgs.WAL.DrainTimeout,
+
+			ReplayEntriesPerSecond: newArgs.WAL.ReplayMaxEntriesPerSecond,
+			ReplayBytesPerSecond:   newArgs.WAL.ReplayMaxBytesPerSecond,
+
+			CorruptionPolicy: newArgs.WAL.OnCorruption,
 		},
 	}
 
@@ -190,7 +297,8 @@ func (c *Component) Update(args component.Arguments) error {
 	c.walWriter = nil
 	// only configure WAL Writer if enabled
 	if walCfg.Enabled {
-		c.walWriter, err = wal.NewWriter(walCfg, c.opts.Logger, c.opts.Registerer)
+		// each client gets its own WAL, named like the client manager names it
+		c.walWriter, err = wal.NewWriter(walCfg, c.opts.Logger, c.opts.Registerer, client.GetClientWALNames(cfgs...)...)
 		if err != nil {
 			return fmt.Errorf("error creating wal writer: %w", err)
 		}
@@ -199,7 +307,11 @@ func (c *Component) Update(args component.Arguments) error {
 
 	c.clientManger, err = client.NewManager(c.metrics, c.opts.Logger, limit.Config{
 		MaxStreams: newArgs.MaxStreams,
-	}, c.opts.Registerer, walCfg, notifier, cfgs...)
+	}, c.opts.Registerer, walCfg, client.DedupConfig{
+		Enabled: newArgs.Dedup.Enabled,
+		Window:  newArgs.Dedup.Window,
+		MaxSize: int64(newArgs.Dedup.MaxMemory),
+	}, notifier, cfgs...)
 	if err != nil {
 		return fmt.Errorf("failed to create client manager: %w", err)
 	}
@@ -213,3 +325,171 @@ func (c *Component) Update(args component.Arguments) error {
 
 	return err
 }
+
+// CurrentHealth implements component.HealthComponent. The component is
+// unhealthy while the startup probe of any of its endpoints fails.
+func (c *Component) CurrentHealth() component.Health {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	if c.clientManger == nil {
+		return component.Health{Health: component.HealthTypeHealthy}
+	}
+	failed := c.clientManger.FailedProbes()
+	if len(failed) == 0 {
+		return component.Health{Health: component.HealthTypeHealthy}
+	}
+
+	names := make([]string, 0, len(failed))
+	for name := range failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	reasons := make([]string, 0, len(names))
+	for _, name := range names {
+		reasons = append(reasons, fmt.Sprintf("endpoint %s: %s", name, failed[name]))
+	}
+	return component.Health{
+		Health:     component.HealthTypeUnhealthy,
+		Message:    "startup probe failed: " + strings.Join(reasons, "; "),
+		UpdateTime: time.Now(),
+	}
+}
+
+// DebugInfo returns the state of the circuit breaker of each endpoint, the
+// batches sampled through the HTTP handler, and the streams entries were
+// dropped from since the previous call.
+func (c *Component) DebugInfo() interface{} {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+
+	var res debugInfo
+	if c.clientManger == nil {
+		return res
+	}
+	for _, info := range c.clientManger.DebugInfo() {
+		endpoint := endpointDebugInfo{
+			Name:                info.Name,
+			CircuitBreakerState: info.CircuitBreakerState.String(),
+			PendingSamples:      info.PendingSamples,
+			StartupProbe:        info.Probe.State.String(),
+			LastSuccessfulPush:  info.Pushes.LastSuccess,
+			LastPushError:       info.Pushes.LastError,
+		}
+		if info.Probe.Err != nil {
+			endpoint.StartupProbeError = info.Probe.Err.Error()
+		}
+		for _, b := range info.SampledBatches {
+			sample := batchDebugInfo{
+				Tenant:           b.Tenant,
+				SentAt:           b.SentAt,
+				Entries:          b.Entries,
+				Bytes:            b.Bytes,
+				TruncatedStreams: b.Truncated,
+			}
+			for _, s := range b.Streams {
+				sample.Streams = append(sample.Streams, streamDebugInfo{
+					Labels:  s.Labels,
+					Entries: s.Entries,
+					Bytes:   s.Bytes,
+				})
+			}
+			endpoint.SampledBatches = append(endpoint.SampledBatches, sample)
+		}
+		for _, d := range info.Drops {
+			drop := dropDebugInfo{
+				Reason:           d.Reason,
+				Entries:          d.Entries,
+				UnsampledEntries: d.Unsampled,
+			}
+			for _, s := range d.Streams {
+				drop.Streams = append(drop.Streams, droppedStreamDebugInfo{
+					Labels:  s.Labels,
+					Entries: s.Entries,
+				})
+			}
+			endpoint.Drops = append(endpoint.Drops, drop)
+		}
+		res.Endpoints = append(res.Endpoints, endpoint)
+	}
+	sort.Slice(res.Endpoints, func(i, j int) bool {
+		return res.Endpoints[i].Name < res.Endpoints[j].Name
+	})
+	return res
+}
+
+type debugInfo struct {
+	Endpoints []endpointDebugInfo `river:"endpoint,block,optional"`
+}
+
+type endpointDebugInfo struct {
+	Name                string           `river:"name,attr"`
+	CircuitBreakerState string           `river:"circuit_breaker_state,attr"`
+	PendingSamples      int              `river:"pending_samples,attr,optional"`
+	StartupProbe        string           `river:"startup_probe,attr"`
+	StartupProbeError   string           `river:"startup_probe_error,attr,optional"`
+	LastSuccessfulPush  time.Time        `river:"last_successful_push,attr,optional"`
+	LastPushError       time.Time        `river:"last_push_error,attr,optional"`
+	SampledBatches      []batchDebugInfo `river:"sampled_batch,block,optional"`
+	Drops               []dropDebugInfo  `river:"dropped_entries,block,optional"`
+}
+
+type batchDebugInfo struct {
+	Tenant           string            `river:"tenant,attr,optional"`
+	SentAt           time.Time         `river:"sent_at,attr"`
+	Entries          int               `river:"entries,attr"`
+	Bytes            int               `river:"bytes,attr"`
+	TruncatedStreams int               `river:"truncated_streams,attr,optional"`
+	Streams          []streamDebugInfo `river:"stream,block,optional"`
+}
+
+type streamDebugInfo struct {
+	Labels  string `river:"labels,attr"`
+	Entries int    `river:"entries,attr"`
+	Bytes   int    `river:"bytes,attr"`
+}
+
+type dropDebugInfo struct {
+	Reason           string                   `river:"reason,attr"`
+	Entries          int                      `river:"entries,attr"`
+	UnsampledEntries int                      `river:"unsampled_entries,attr,optional"`
+	Streams          []droppedStreamDebugInfo `river:"stream,block,optional"`
+}
+
+type droppedStreamDebugInfo struct {
+	Labels  string `river:"labels,attr"`
+	Entries int    `river:"entries,attr"`
+}
+
+// Handler implements http_service.Component. A POST request to
+// /sample_batches?count=N samples the next N batches sent to each endpoint,
+// which are then reported in the debug info of the component. A zero count
+// stops sampling.
+func (c *Component) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sample_batches", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		count, err := strconv.Atoi(r.URL.Query().Get("count"))
+		if err != nil || count < 0 {
+			http.Error(w, "count must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		if count > client.MaxSampledBatches {
+			count = client.MaxSampledBatches
+		}
+
+		c.mut.RLock()
+		defer c.mut.RUnlock()
+		if c.clientManger == nil {
+			http.Error(w, "component isn't running", http.StatusServiceUnavailable)
+			return
+		}
+		c.clientManger.SampleBatches(count)
+		fmt.Fprintf(w, "sampling the next %d batches of each endpoint\n", count)
+	})
+	return mux
+}
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/grafana/agent/internal/component/common/loki"
 	"github.com/grafana/agent/internal/component/common/loki/wal"
 	"github.com/grafana/agent/internal/component/discovery"
@@ -56,6 +57,35 @@ func TestBadRiverConfig(t *testing.T) {
 	require.ErrorContains(t, err, "at most one of basic_auth, authorization, oauth2, bearer_token & bearer_token_file must be configured")
 }
 
+func TestBadMaxTenantsConfig(t *testing.T) {
+	var exampleRiverConfig = `
+	endpoint {
+		url         = "http://0.0.0.0:11111/loki/api/v1/push"
+		max_tenants = 0
+	}
+`
+
+	var args Arguments
+	err := river.Unmarshal([]byte(exampleRiverConfig), &args)
+	require.ErrorContains(t, err, "max_tenants must be greater than 0")
+}
+
+func TestBadAppendTimeoutConfig(t *testing.T) {
+	var exampleRiverConfig = `
+	endpoint {
+		url = "http://0.0.0.0:11111/loki/api/v1/push"
+	}
+	append_timeout = "5s"
+	wal {
+		enabled = true
+	}
+`
+
+	var args Arguments
+	err := river.Unmarshal([]byte(exampleRiverConfig), &args)
+	require.ErrorContains(t, err, "append_timeout can't be set when the WAL is enabled")
+}
+
 func TestUnmarshallWalAttrributes(t *testing.T) {
 	type testcase struct {
 		raw           string
@@ -80,6 +110,7 @@ func TestUnmarshallWalAttrributes(t *testing.T) {
 				MinReadFrequency: wal.DefaultWatchConfig.MinReadFrequency,
 				MaxReadFrequency: wal.DefaultWatchConfig.MaxReadFrequency,
 				DrainTimeout:     wal.DefaultWatchConfig.DrainTimeout,
+				OnCorruption:     wal.CorruptionPolicySkip,
 			},
 		},
 		"wal enabled with defaults": {
@@ -92,6 +123,7 @@ func TestUnmarshallWalAttrributes(t *testing.T) {
 				MinReadFrequency: wal.DefaultWatchConfig.MinReadFrequency,
 				MaxReadFrequency: wal.DefaultWatchConfig.MaxReadFrequency,
 				DrainTimeout:     wal.DefaultWatchConfig.DrainTimeout,
+				OnCorruption:     wal.CorruptionPolicySkip,
 			},
 		},
 		"wal enabled with some overrides": {
@@ -107,8 +139,52 @@ func TestUnmarshallWalAttrributes(t *testing.T) {
 				MinReadFrequency: time.Millisecond * 11,
 				MaxReadFrequency: wal.DefaultWatchConfig.MaxReadFrequency,
 				DrainTimeout:     time.Minute * 5,
+				OnCorruption:     wal.CorruptionPolicySkip,
+			},
+		},
+		"wal enabled with max size": {
+			raw: `
+			enabled = true
+			max_size = "512MiB"
+			`,
+			expected: WalArguments{
+				Enabled:          true,
+				MaxSegmentAge:    wal.DefaultMaxSegmentAge,
+				MinReadFrequency: wal.DefaultWatchConfig.MinReadFrequency,
+				MaxReadFrequency: wal.DefaultWatchConfig.MaxReadFrequency,
+				DrainTimeout:     wal.DefaultWatchConfig.DrainTimeout,
+				MaxSize:          512 * units.MiB,
+				OnCorruption:     wal.CorruptionPolicySkip,
+			},
+		},
+		"negative max size": {
+			raw: `
+			enabled = true
+			max_size = -1
+			`,
+			errorExpected: true,
+		},
+		"wal halting on corruption": {
+			raw: `
+			enabled = true
+			on_corruption = "halt"
+			`,
+			expected: WalArguments{
+				Enabled:          true,
+				MaxSegmentAge:    wal.DefaultMaxSegmentAge,
+				MinReadFrequency: wal.DefaultWatchConfig.MinReadFrequency,
+				MaxReadFrequency: wal.DefaultWatchConfig.MaxReadFrequency,
+				DrainTimeout:     wal.DefaultWatchConfig.DrainTimeout,
+				OnCorruption:     wal.CorruptionPolicyHalt,
 			},
 		},
+		"unknown corruption policy": {
+			raw: `
+			enabled = true
+			on_corruption = "ignore"
+			`,
+			errorExpected: true,
+		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			cfg := WalArguments{}
@@ -123,6 +199,62 @@ func TestUnmarshallWalAttrributes(t *testing.T) {
 	}
 }
 
+func TestUnmarshallDedupArguments(t *testing.T) {
+	type testcase struct {
+		raw           string
+		errorExpected bool
+		expected      DedupArguments
+	}
+
+	for name, tc := range map[string]testcase{
+		"default config is deduplication disabled": {
+			raw: "",
+			expected: DedupArguments{
+				Enabled:   false,
+				Window:    10 * time.Second,
+				MaxMemory: 16 * units.MiB,
+			},
+		},
+		"deduplication enabled with overrides": {
+			raw: `
+			enabled = true
+			window = "1m"
+			max_memory = "1MiB"
+			`,
+			expected: DedupArguments{
+				Enabled:   true,
+				Window:    time.Minute,
+				MaxMemory: units.MiB,
+			},
+		},
+		"zero window": {
+			raw: `
+			enabled = true
+			window = "0s"
+			`,
+			errorExpected: true,
+		},
+		"zero max memory": {
+			raw: `
+			enabled = true
+			max_memory = 0
+			`,
+			errorExpected: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := DedupArguments{}
+			err := river.Unmarshal([]byte(tc.raw), &cfg)
+			if tc.errorExpected {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, cfg)
+		})
+	}
+}
+
 func TestWriteToSingleEndpoint(t *testing.T) {
 	t.Run("wal disabled", func(t *testing.T) {
 		testSingleEndpoint(t, func(args *Arguments) {})
@@ -133,6 +265,12 @@ func TestWriteToSingleEndpoint(t *testing.T) {
 			args.WAL.Enabled = true
 		})
 	})
+
+	t.Run("append timeout", func(t *testing.T) {
+		testSingleEndpoint(t, func(args *Arguments) {
+			args.AppendTimeout = 5 * time.Second
+		})
+	})
 }
 
 func testSingleEndpoint(t *testing.T, alterConfig func(arguments *Arguments)) {
@@ -201,6 +339,81 @@ func testSingleEndpoint(t *testing.T, alterConfig func(arguments *Arguments)) {
 	}
 }
 
+func TestWALKeptWhenUnnamedEndpointIsUpdated(t *testing.T) {
+	// The server rejects the entries until the component is updated, so that
+	// only the client created by the update can send them.
+	var accept atomic.Bool
+	var rejected atomic.Int64
+	ch := make(chan logproto.PushRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pushReq logproto.PushRequest
+		err := loki_util.ParseProtoReader(context.Background(), r.Body, int(r.ContentLength), math.MaxInt32, &pushReq, loki_util.RawSnappy)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !accept.Load() {
+			rejected.Inc()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		select {
+		case ch <- pushReq:
+		default:
+		}
+	}))
+	defer srv.Close()
+
+	newArgs := func(batchWait string) Arguments {
+		cfg := fmt.Sprintf(`
+			endpoint {
+				url                = "%s"
+				batch_wait         = "%s"
+				min_backoff_period = "10ms"
+				max_backoff_period = "10ms"
+			}
+			wal {
+				enabled = true
+			}
+		`, srv.URL, batchWait)
+		var args Arguments
+		require.NoError(t, river.Unmarshal([]byte(cfg), &args))
+		return args
+	}
+
+	tc, err := componenttest.NewControllerFromID(util.TestLogger(t), "loki.write")
+	require.NoError(t, err)
+	go func() {
+		err = tc.Run(componenttest.TestContext(t), newArgs("10ms"))
+		require.NoError(t, err)
+	}()
+	require.NoError(t, tc.WaitExports(time.Second))
+
+	logEntry := loki.Entry{
+		Labels: model.LabelSet{"foo": "bar"},
+		Entry: logproto.Entry{
+			Timestamp: time.Now(),
+			Line:      "pending log",
+		},
+	}
+	tc.Exports().(Exports).Receiver.Chan() <- logEntry
+	require.Eventually(t, func() bool { return rejected.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// Changing the config of the endpoint changes its client name, but not
+	// its WAL, which still holds the entry not sent yet.
+	require.NoError(t, tc.Update(newArgs("20ms")))
+	accept.Store(true)
+
+	select {
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "failed waiting for the pending log")
+	case req := <-ch:
+		require.Len(t, req.Streams, 1)
+		require.Equal(t, logEntry.Labels.String(), req.Streams[0].Labels)
+		require.Equal(t, logEntry.Line, req.Streams[0].Entries[0].Line)
+	}
+}
+
 func TestEntrySentToTwoWriteComponents(t *testing.T) {
 	t.Run("wal disabled", func(t *testing.T) {
 		testMultipleEndpoint(t, func(arguments *Arguments) {})
@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"sync"
+	"time"
 
 	"go.uber.org/atomic"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/grafana/agent/internal/component/module"
 	remote_http "github.com/grafana/agent/internal/component/remote/http"
 	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow/logging/level"
 	"github.com/grafana/river/rivertypes"
 )
 
@@ -71,10 +73,17 @@ func New(o component.Options, args Arguments) (*Component, error) {
 	}
 	defer c.isCreated.Store(true)
 
-	c.managedRemoteHTTP, err = c.newManagedLocalComponent(o)
+	managedRemoteHTTP, err := c.newManagedLocalComponent(o)
 	if err != nil {
-		return nil, err
+		// Run the last content the module loaded without errors until the
+		// remote.http component can be created.
+		if lkgErr := c.mod.LoadLastKnownGood(args.Arguments); lkgErr != nil {
+			return nil, err
+		}
+		level.Warn(o.Logger).Log("msg", "failed to retrieve module content, running the last known good content", "err", err)
+		return c, nil
 	}
+	c.setManagedRemoteHTTP(managedRemoteHTTP)
 	if err := c.Update(args); err != nil {
 		return nil, err
 	}
@@ -101,16 +110,33 @@ func (c *Component) Run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	go c.mod.RunFlowController(ctx)
+
+	managedRemoteHTTP := c.getManagedRemoteHTTP()
+	for managedRemoteHTTP == nil {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.getArgs().RemoteHTTPArguments.PollFrequency):
+		}
+
+		var err error
+		managedRemoteHTTP, err = c.newManagedLocalComponent(c.opts)
+		if err != nil {
+			level.Warn(c.opts.Logger).Log("msg", "failed to retrieve module content, running the last known good content", "err", err)
+			continue
+		}
+		c.setManagedRemoteHTTP(managedRemoteHTTP)
+	}
+
 	ch := make(chan error, 1)
 	go func() {
-		err := c.managedRemoteHTTP.Run(ctx)
+		err := managedRemoteHTTP.Run(ctx)
 		if err != nil {
 			ch <- err
 		}
 	}()
 
-	go c.mod.RunFlowController(ctx)
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -129,7 +155,13 @@ func (c *Component) Update(args component.Arguments) error {
 	newArgs := args.(Arguments)
 	c.setArgs(newArgs)
 
-	err := c.managedRemoteHTTP.Update(newArgs.RemoteHTTPArguments)
+	managedRemoteHTTP := c.getManagedRemoteHTTP()
+	if managedRemoteHTTP == nil {
+		// The remote.http component is created by Run with the new
+		// arguments.
+		return nil
+	}
+	err := managedRemoteHTTP.Update(newArgs.RemoteHTTPArguments)
 	if err != nil {
 		return err
 	}
@@ -141,8 +173,12 @@ func (c *Component) Update(args component.Arguments) error {
 
 // CurrentHealth implements component.HealthComponent.
 func (c *Component) CurrentHealth() component.Health {
+	managedRemoteHTTP := c.getManagedRemoteHTTP()
+	if managedRemoteHTTP == nil {
+		return c.mod.CurrentHealth()
+	}
 	leastHealthy := component.LeastHealthy(
-		c.managedRemoteHTTP.CurrentHealth(),
+		managedRemoteHTTP.CurrentHealth(),
 		c.mod.CurrentHealth(),
 	)
 
@@ -166,6 +202,22 @@ func (c *Component) setArgs(args Arguments) {
 	c.mut.Unlock()
 }
 
+// getManagedRemoteHTTP is a goroutine safe way to get the managed remote.http
+// component, which is nil until it could be created.
+func (c *Component) getManagedRemoteHTTP() *remote_http.Component {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.managedRemoteHTTP
+}
+
+// setManagedRemoteHTTP is a goroutine safe way to set the managed remote.http
+// component.
+func (c *Component) setManagedRemoteHTTP(managedRemoteHTTP *remote_http.Component) {
+	c.mut.Lock()
+	c.managedRemoteHTTP = managedRemoteHTTP
+	c.mut.Unlock()
+}
+
 // getContent is a goroutine safe way to get content
 func (c *Component) getContent() rivertypes.OptionalSecret {
 	c.mut.RLock()
@@ -70,6 +70,27 @@ func (c *ModuleComponent) LoadFlowSource(args map[string]any, contentValue strin
 	return nil
 }
 
+// LoadLastKnownGood loads the last content the module loaded without errors,
+// for when its content can't be retrieved. It fails if the module doesn't
+// persist its content or none was persisted.
+func (c *ModuleComponent) LoadLastKnownGood(args map[string]any) error {
+	mod, ok := c.mod.(component.LastKnownGoodModule)
+	if !ok {
+		return fmt.Errorf("module doesn't persist its last known good content")
+	}
+	if err := mod.LoadLastKnownGood(args); err != nil {
+		return err
+	}
+
+	c.setLatestArgs(args)
+	c.setHealth(component.Health{
+		Health:     component.HealthTypeUnhealthy,
+		Message:    "module content can't be retrieved, running the last known good content",
+		UpdateTime: time.Now(),
+	})
+	return nil
+}
+
 // RunFlowController runs the flow controller that all module components start.
 func (c *ModuleComponent) RunFlowController(ctx context.Context) {
 	err := c.mod.Run(ctx)
@@ -0,0 +1,64 @@
+package scrape
+
+import (
+	"context"
+	"net/http/httptrace"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+)
+
+// connTracker counts the connections used by the scrapes of a pool, telling
+// new connections apart from idle connections which were reused.
+type connTracker struct {
+	pool     string
+	counters *prometheus.CounterVec
+	newConns prometheus.Counter
+	reused   prometheus.Counter
+
+	newCount    atomic.Uint64
+	reusedCount atomic.Uint64
+	trace       *httptrace.ClientTrace
+}
+
+func newConnTracker(pool string, counters *prometheus.CounterVec) *connTracker {
+	c := &connTracker{
+		pool:     pool,
+		counters: counters,
+		newConns: counters.WithLabelValues(pool, "new"),
+		reused:   counters.WithLabelValues(pool, "reused"),
+	}
+	c.trace = &httptrace.ClientTrace{GotConn: c.gotConn}
+	return c
+}
+
+// withTrace returns ctx with a trace recording the connection used by the
+// requests made with it.
+func (c *connTracker) withTrace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, c.trace)
+}
+
+func (c *connTracker) gotConn(info httptrace.GotConnInfo) {
+	if info.Reused {
+		c.reused.Inc()
+		c.reusedCount.Inc()
+		return
+	}
+	c.newConns.Inc()
+	c.newCount.Inc()
+}
+
+// stop deletes the metrics of the pool.
+func (c *connTracker) stop() {
+	c.counters.DeleteLabelValues(c.pool, "new")
+	c.counters.DeleteLabelValues(c.pool, "reused")
+}
+
+// connStats summarizes the connections recorded by a connTracker.
+type connStats struct {
+	newConns, reused uint64
+}
+
+func (c *connTracker) stats() connStats {
+	return connStats{newConns: c.newCount.Load(), reused: c.reusedCount.Load()}
+}
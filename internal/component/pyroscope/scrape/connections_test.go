@@ -0,0 +1,189 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/component/pyroscope"
+	"github.com/grafana/agent/internal/util"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrapePool_ReusesConnections(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	p, err := newScrapePool("test", NewDefaultArguments(), pyroscope.NoopAppendable, nil, util.TestLogger(t))
+	require.NoError(t, err)
+	defer p.stop()
+
+	p.mtx.Lock()
+	loop := p.newScrapeLoop(NewTarget(
+		labels.FromStrings(
+			model.SchemeLabel, "http",
+			model.AddressLabel, strings.TrimPrefix(server.URL, "http://"),
+			ProfilePath, "/debug/pprof/goroutine",
+		), labels.FromStrings(), url.Values{}))
+	p.mtx.Unlock()
+	defer loop.stop(false)
+
+	for i := 0; i < 3; i++ {
+		loop.scrape()
+	}
+	require.Equal(t, connStats{newConns: 1, reused: 2}, p.connections.stats())
+}
+
+func TestScrapePool_ReloadKeepsClient(t *testing.T) {
+	args := NewDefaultArguments()
+	p, err := newScrapePool("test", args, pyroscope.NoopAppendable, nil, util.TestLogger(t))
+	require.NoError(t, err)
+	defer p.stop()
+
+	// Changing the loop settings keeps the client and its idle connections.
+	client := p.scrapeClient
+	args.ScrapeInterval = 30 * time.Second
+	require.NoError(t, p.reload(args))
+	require.Same(t, client, p.scrapeClient)
+
+	// Changing the transport settings replaces the client.
+	args.Transport.IdleConnTimeout = time.Minute
+	require.NoError(t, p.reload(args))
+	require.NotSame(t, client, p.scrapeClient)
+}
+
+func TestTransportArguments_Validate(t *testing.T) {
+	args := DefaultTransportArguments
+	require.NoError(t, args.Validate())
+
+	args.IdleConnTimeout = 0
+	require.NoError(t, args.Validate())
+
+	args.IdleConnTimeout = -time.Second
+	require.EqualError(t, args.Validate(), "idle_conn_timeout must not be negative")
+
+	args = DefaultTransportArguments
+	args.MaxIdleConnsPerHost = 0
+	require.EqualError(t, args.Validate(), "max_idle_conns_per_host must be greater than 0")
+}
+
+func TestArguments_ForceHTTP2RequiresHTTP2(t *testing.T) {
+	args := NewDefaultArguments()
+	args.Transport.ForceHTTP2 = true
+	require.NoError(t, args.Validate())
+
+	args.HTTPClientConfig.EnableHTTP2 = false
+	require.EqualError(t, args.Validate(), "transport force_http2 can't be set when enable_http2 is false")
+}
+
+func TestScrapeClient_MaxIdleConnsPerHost(t *testing.T) {
+	for _, maxIdle := range []int{1, 2} {
+		t.Run(fmt.Sprintf("max_idle_conns_per_host=%d", maxIdle), func(t *testing.T) {
+			// Requests are held until both requests of a round arrived, so
+			// that each round needs two connections.
+			started, release := make(chan struct{}), make(chan struct{}, 2)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				started <- struct{}{}
+				<-release
+				w.Write([]byte("ok"))
+			}))
+			defer server.Close()
+
+			args := NewDefaultArguments()
+			args.Transport.MaxIdleConnsPerHost = maxIdle
+			client, err := newScrapeClient(args)
+			require.NoError(t, err)
+			defer client.CloseIdleConnections()
+
+			round := func() (reused int) {
+				var (
+					wg  sync.WaitGroup
+					mut sync.Mutex
+				)
+				for i := 0; i < 2; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+							mut.Lock()
+							defer mut.Unlock()
+							if info.Reused {
+								reused++
+							}
+						}}
+						req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, server.URL, nil)
+						require.NoError(t, err)
+						resp, err := client.Do(req)
+						require.NoError(t, err)
+						_, _ = io.Copy(io.Discard, resp.Body)
+						resp.Body.Close()
+					}()
+				}
+				<-started
+				<-started
+				release <- struct{}{}
+				release <- struct{}{}
+				wg.Wait()
+				return reused
+			}
+
+			require.Equal(t, 0, round())
+			// Only maxIdle connections were kept once the first round
+			// completed.
+			require.Equal(t, maxIdle, round())
+		})
+	}
+}
+
+func TestScrapeClient_ForceHTTP2(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		serverHTTP2 bool
+		forceHTTP2  bool
+		proto       string // Expected protocol, empty if the request fails.
+	}{
+		{name: "negotiated HTTP/2", serverHTTP2: true, proto: "HTTP/2.0"},
+		{name: "fallback to HTTP/1.1", serverHTTP2: false, proto: "HTTP/1.1"},
+		{name: "forced HTTP/2", serverHTTP2: true, forceHTTP2: true, proto: "HTTP/2.0"},
+		{name: "forced HTTP/2 without server support", serverHTTP2: false, forceHTTP2: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Proto))
+			}))
+			server.EnableHTTP2 = tt.serverHTTP2
+			server.StartTLS()
+			defer server.Close()
+
+			args := NewDefaultArguments()
+			args.HTTPClientConfig.TLSConfig.InsecureSkipVerify = true
+			args.Transport.ForceHTTP2 = tt.forceHTTP2
+			client, err := newScrapeClient(args)
+			require.NoError(t, err)
+			defer client.CloseIdleConnections()
+
+			resp, err := client.Get(server.URL)
+			if tt.proto == "" {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, tt.proto, string(body))
+		})
+	}
+}
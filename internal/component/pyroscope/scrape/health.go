@@ -0,0 +1,117 @@
+package scrape
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/agent/internal/component"
+)
+
+// HealthArguments configures when failing targets make the component
+// unhealthy.
+type HealthArguments struct {
+	// The component is unhealthy when more than this fraction of its active
+	// targets have been failing for UnhealthyFor.
+	UnhealthyTargetsRatio float64 `river:"unhealthy_targets_ratio,attr,optional"`
+	// How long a target must have been failing to count as unhealthy.
+	UnhealthyFor time.Duration `river:"unhealthy_for,attr,optional"`
+}
+
+// DefaultHealthArguments holds the default health settings.
+var DefaultHealthArguments = HealthArguments{
+	UnhealthyTargetsRatio: 0.5,
+	UnhealthyFor:          10 * time.Minute,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *HealthArguments) SetToDefault() {
+	*args = DefaultHealthArguments
+}
+
+// Validate implements river.Validator.
+func (args *HealthArguments) Validate() error {
+	if args.UnhealthyTargetsRatio < 0 || args.UnhealthyTargetsRatio > 1 {
+		return fmt.Errorf("unhealthy_targets_ratio must be between 0 and 1")
+	}
+	if args.UnhealthyFor <= 0 {
+		return fmt.Errorf("unhealthy_for must be greater than 0")
+	}
+	return nil
+}
+
+// targetsHealth returns the health of the component derived from its active
+// targets at now. It is unhealthy when more than the configured fraction of
+// the targets have been failing for longer than the configured duration.
+func targetsHealth(targets []*Target, args HealthArguments, now time.Time) component.Health {
+	var (
+		failing   int
+		errCounts = make(map[string]int)
+	)
+	for _, t := range targets {
+		t.mtx.RLock()
+		if t.health == HealthBad && now.Sub(t.unhealthySince) >= args.UnhealthyFor {
+			failing++
+			if t.lastError != nil {
+				errCounts[t.lastError.Error()]++
+			}
+		}
+		t.mtx.RUnlock()
+	}
+
+	if len(targets) == 0 || float64(failing)/float64(len(targets)) <= args.UnhealthyTargetsRatio {
+		return component.Health{
+			Health:     component.HealthTypeHealthy,
+			Message:    fmt.Sprintf("%d/%d targets failing for %s", failing, len(targets), args.UnhealthyFor),
+			UpdateTime: now,
+		}
+	}
+	return component.Health{
+		Health:     component.HealthTypeUnhealthy,
+		Message:    fmt.Sprintf("%d/%d targets failing for %s, most common error: %s", failing, len(targets), args.UnhealthyFor, mostCommonError(errCounts)),
+		UpdateTime: now,
+	}
+}
+
+// mostCommonError returns the error the most targets failed with. Ties are
+// broken by the error message so that the result is stable.
+func mostCommonError(errCounts map[string]int) string {
+	msgs := make([]string, 0, len(errCounts))
+	for msg := range errCounts {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		if errCounts[msgs[i]] != errCounts[msgs[j]] {
+			return errCounts[msgs[i]] > errCounts[msgs[j]]
+		}
+		return msgs[i] < msgs[j]
+	})
+	if len(msgs) == 0 {
+		return "unknown"
+	}
+	return msgs[0]
+}
+
+var _ component.HealthComponent = (*Component)(nil)
+
+// CurrentHealth implements component.HealthComponent. The health is derived
+// from the health of the active targets, and its update time is the time it
+// last changed.
+func (c *Component) CurrentHealth() component.Health {
+	c.mut.RLock()
+	args := c.args.Health
+	c.mut.RUnlock()
+
+	var targets []*Target
+	for _, tt := range c.scraper.TargetsActive() {
+		targets = append(targets, tt...)
+	}
+	health := targetsHealth(targets, args, time.Now())
+
+	c.healthMut.Lock()
+	defer c.healthMut.Unlock()
+	if c.health.Health != health.Health || c.health.Message != health.Message {
+		c.health = health
+	}
+	return c.health
+}
@@ -0,0 +1,81 @@
+package scrape
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetsHealth(t *testing.T) {
+	now := time.Now()
+	args := DefaultHealthArguments
+
+	// 7 targets failing for long, 1 failing recently and 2 healthy ones.
+	var targets []*Target
+	for i := 0; i < 10; i++ {
+		target := NewTarget(labels.FromStrings("__address__", fmt.Sprintf("localhost:%d", 9000+i)), nil, nil)
+		switch {
+		case i < 5:
+			setTargetHealth(target, HealthBad, now.Add(-time.Hour), errors.New("connection refused"))
+		case i < 7:
+			setTargetHealth(target, HealthBad, now.Add(-time.Hour), errors.New("context deadline exceeded"))
+		case i < 8:
+			setTargetHealth(target, HealthBad, now.Add(-time.Minute), errors.New("context deadline exceeded"))
+		default:
+			setTargetHealth(target, HealthGood, time.Time{}, nil)
+		}
+		targets = append(targets, target)
+	}
+
+	health := targetsHealth(targets, args, now)
+	require.Equal(t, component.HealthTypeUnhealthy, health.Health)
+	require.Equal(t, "7/10 targets failing for 10m0s, most common error: connection refused", health.Message)
+
+	// Targets failing for less than unhealthy_for aren't counted.
+	args.UnhealthyFor = 2 * time.Hour
+	health = targetsHealth(targets, args, now)
+	require.Equal(t, component.HealthTypeHealthy, health.Health)
+	require.Equal(t, "0/10 targets failing for 2h0m0s", health.Message)
+
+	// The fraction of failing targets must exceed unhealthy_targets_ratio.
+	args = DefaultHealthArguments
+	args.UnhealthyTargetsRatio = 0.7
+	require.Equal(t, component.HealthTypeHealthy, targetsHealth(targets, args, now).Health)
+
+	// The component recovers once the targets are scraped successfully.
+	for _, target := range targets[:3] {
+		setTargetHealth(target, HealthGood, time.Time{}, nil)
+	}
+	health = targetsHealth(targets, DefaultHealthArguments, now)
+	require.Equal(t, component.HealthTypeHealthy, health.Health)
+	require.Equal(t, "4/10 targets failing for 10m0s", health.Message)
+
+	// Components without targets are healthy.
+	require.Equal(t, component.HealthTypeHealthy, targetsHealth(nil, DefaultHealthArguments, now).Health)
+}
+
+func TestScrapeLoop_UnhealthySince(t *testing.T) {
+	target := NewTarget(labels.FromStrings("__address__", "localhost:9000"), nil, nil)
+	loop := &scrapeLoop{Target: target}
+
+	start := time.Now()
+	loop.updateTargetStatus(start, 0, errors.New("connection refused"))
+	loop.updateTargetStatus(start.Add(time.Minute), 0, errors.New("connection refused"))
+	require.Equal(t, start, target.unhealthySince)
+
+	loop.updateTargetStatus(start.Add(2*time.Minute), 10, nil)
+	require.True(t, target.unhealthySince.IsZero())
+}
+
+func setTargetHealth(t *Target, health TargetHealth, since time.Time, err error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.health = health
+	t.unhealthySince = since
+	t.lastError = err
+}
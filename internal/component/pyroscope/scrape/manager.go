@@ -8,6 +8,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/component/pyroscope"
 	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 )
 
@@ -18,6 +19,7 @@ type Manager struct {
 
 	graceShut  chan struct{}
 	appendable pyroscope.Appendable
+	metrics    *metrics
 
 	mtxScrape     sync.Mutex // Guards the fields below.
 	config        Arguments
@@ -27,13 +29,14 @@ type Manager struct {
 	triggerReload chan struct{}
 }
 
-func NewManager(appendable pyroscope.Appendable, logger log.Logger) *Manager {
+func NewManager(appendable pyroscope.Appendable, reg prometheus.Registerer, logger log.Logger) *Manager {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
 	return &Manager{
 		logger:        logger,
 		appendable:    appendable,
+		metrics:       newMetrics(reg),
 		graceShut:     make(chan struct{}),
 		triggerReload: make(chan struct{}, 1),
 		targetsGroups: make(map[string]*scrapePool),
@@ -88,7 +91,7 @@ func (m *Manager) reload() {
 	var wg sync.WaitGroup
 	for setName, groups := range m.targetSets {
 		if _, ok := m.targetsGroups[setName]; !ok {
-			sp, err := newScrapePool(m.config, m.appendable, log.With(m.logger, "scrape_pool", setName))
+			sp, err := newScrapePool(setName, m.config, m.appendable, m.metrics, log.With(m.logger, "scrape_pool", setName))
 			if err != nil {
 				level.Error(m.logger).Log("msg", "error creating new scrape pool", "err", err, "scrape_pool", setName)
 				continue
@@ -184,6 +187,30 @@ func (m *Manager) TargetsDropped() map[string][]*Target {
 	return targets
 }
 
+// scrapeSkews returns the skews recorded by each scrape pool.
+func (m *Manager) scrapeSkews() map[string]skewStats {
+	m.mtxScrape.Lock()
+	defer m.mtxScrape.Unlock()
+
+	skews := make(map[string]skewStats, len(m.targetsGroups))
+	for name, sp := range m.targetsGroups {
+		skews[name] = sp.skew.stats()
+	}
+	return skews
+}
+
+// connectionStats returns the connections recorded by each scrape pool.
+func (m *Manager) connectionStats() map[string]connStats {
+	m.mtxScrape.Lock()
+	defer m.mtxScrape.Unlock()
+
+	stats := make(map[string]connStats, len(m.targetsGroups))
+	for name, sp := range m.targetsGroups {
+		stats[name] = sp.connections.stats()
+	}
+	return stats
+}
+
 func (m *Manager) Stop() {
 	m.mtxScrape.Lock()
 	defer m.mtxScrape.Unlock()
@@ -18,7 +18,7 @@ func TestManager(t *testing.T) {
 
 	m := NewManager(pyroscope.AppendableFunc(func(ctx context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
 		return nil
-	}), util.TestLogger(t))
+	}), nil, util.TestLogger(t))
 
 	defer m.Stop()
 	targetSetsChan := make(chan map[string][]*targetgroup.Group)
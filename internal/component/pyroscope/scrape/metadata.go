@@ -0,0 +1,47 @@
+package scrape
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// Labels injected into scraped profiles when inject_metadata is enabled.
+const (
+	AgentHostnameLabel        = "agent_hostname"
+	ScrapeJobLabel            = "scrape_job"
+	ScrapePoolGenerationLabel = "scrape_pool_generation"
+)
+
+// scrapeMetadata describes which agent and scrape pool scraped a profile.
+type scrapeMetadata struct {
+	hostname string
+	job      string
+	// generation is the number of times the configuration of the scrape pool
+	// was applied since the pool was created.
+	generation uint64
+}
+
+// inject returns lbs with the metadata labels set. Since lbs are the labels
+// of the target after relabeling, the metadata labels take precedence over
+// labels of the same names set by relabeling rules.
+func (md *scrapeMetadata) inject(lbs labels.Labels) labels.Labels {
+	b := labels.NewBuilder(lbs)
+	if md.hostname != "" {
+		b.Set(AgentHostnameLabel, md.hostname)
+	}
+	b.Set(ScrapeJobLabel, md.job)
+	b.Set(ScrapePoolGenerationLabel, strconv.FormatUint(md.generation, 10))
+	return b.Labels()
+}
+
+// agentHostname returns the hostname injected into profiles, or an empty
+// string if it can't be determined.
+func agentHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
@@ -0,0 +1,61 @@
+package scrape
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// durationBuckets covers fetches of delta profiles, which take about as long
+// as the scrape interval.
+var durationBuckets = []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 15, 30, 60}
+
+type metrics struct {
+	invalidProfiles *prometheus.CounterVec
+	droppedProfiles prometheus.Counter
+	fetchDuration   prometheus.Histogram
+	pushDuration    prometheus.Histogram
+	scrapeSkew      *prometheus.SummaryVec
+	connections     *prometheus.CounterVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		invalidProfiles: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pyroscope_scrape_invalid_profiles_total",
+			Help: "Total number of scraped payloads rejected because they are not valid pprof profiles, by job.",
+		}, []string{"job"}),
+		droppedProfiles: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "pyroscope_scrape_dropped_profiles_total",
+			Help: "Total number of scraped profiles dropped because too many pushes of the same target were pending.",
+		}),
+		fetchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "pyroscope_scrape_fetch_duration_seconds",
+			Help:    "Time spent fetching profiles from targets.",
+			Buckets: durationBuckets,
+		}),
+		pushDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "pyroscope_scrape_push_duration_seconds",
+			Help:    "Time spent pushing scraped profiles to the components in forward_to.",
+			Buckets: durationBuckets,
+		}),
+		scrapeSkew: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Name:       "pyroscope_scrape_skew_seconds",
+			Help:       "Delay between the time scrapes are scheduled at and the time they start, by scrape pool. Reset when the component is updated.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.99: 0.001},
+		}, []string{"scrape_pool"}),
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pyroscope_scrape_connections_total",
+			Help: "Total number of connections used to fetch profiles, by scrape pool and whether the connection was new or a reused idle connection.",
+		}, []string{"scrape_pool", "state"}),
+	}
+
+	if reg != nil {
+		reg.MustRegister(
+			m.invalidProfiles,
+			m.droppedProfiles,
+			m.fetchDuration,
+			m.pushDuration,
+			m.scrapeSkew,
+			m.connections,
+		)
+	}
+
+	return m
+}
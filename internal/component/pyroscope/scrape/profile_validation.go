@@ -0,0 +1,97 @@
+package scrape
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxValidatedPrefix is the number of uncompressed bytes of a gzipped profile
+// which validateProfile decompresses to check its protobuf structure.
+const maxValidatedPrefix = 4096
+
+var errInvalidProfile = errors.New("invalid profile")
+
+// validateProfile performs a lightweight check that b is a pprof profile,
+// either gzipped or as a raw protobuf message. It catches the common cases of
+// targets returning HTML error pages or truncated bodies with a 2xx status.
+//
+// validateProfile does not fully decode the profile. Only the first
+// maxValidatedPrefix bytes of gzipped profiles are decompressed, so gzipped
+// profiles truncated past that point aren't detected. The top-level fields of
+// raw profiles are walked without decoding their values.
+func validateProfile(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("%w: empty payload", errInvalidProfile)
+	}
+
+	if !isGzip(b) {
+		return validatePprofFields(b, false)
+	}
+
+	gzr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("%w: bad gzip header: %v", errInvalidProfile, err)
+	}
+	defer gzr.Close()
+
+	var prefix bytes.Buffer
+	if _, err := io.CopyN(&prefix, gzr, maxValidatedPrefix); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: bad gzip stream: %v", errInvalidProfile, err)
+	}
+	if prefix.Len() == 0 {
+		return fmt.Errorf("%w: empty gzip stream", errInvalidProfile)
+	}
+	return validatePprofFields(prefix.Bytes(), prefix.Len() == maxValidatedPrefix)
+}
+
+func isGzip(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b
+}
+
+// validatePprofFields checks that b is a sequence of well-formed fields of
+// the pprof Profile message. If partial is true, b may be cut off at any
+// point and a truncated trailing field is not reported as an error.
+func validatePprofFields(b []byte, partial bool) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			if partial && errors.Is(protowire.ParseError(n), io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return fmt.Errorf("%w: not a pprof protobuf message", errInvalidProfile)
+		}
+		if !isPprofField(num, typ) {
+			return fmt.Errorf("%w: unexpected field %d with wire type %d for a pprof message", errInvalidProfile, num, typ)
+		}
+
+		m := protowire.ConsumeFieldValue(num, typ, b[n:])
+		if m < 0 {
+			if partial && errors.Is(protowire.ParseError(m), io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return fmt.Errorf("%w: truncated pprof message", errInvalidProfile)
+		}
+		b = b[n+m:]
+	}
+	return nil
+}
+
+// isPprofField reports whether num and typ describe a field of the Profile
+// message from https://github.com/google/pprof/blob/main/proto/profile.proto.
+func isPprofField(num protowire.Number, typ protowire.Type) bool {
+	switch num {
+	case 1, 2, 3, 4, 5, 6, 11: // Repeated messages and strings.
+		return typ == protowire.BytesType
+	case 7, 8, 9, 10, 12, 14: // Scalar integers.
+		return typ == protowire.VarintType
+	case 13: // Repeated integers, possibly packed.
+		return typ == protowire.VarintType || typ == protowire.BytesType
+	default:
+		return false
+	}
+}
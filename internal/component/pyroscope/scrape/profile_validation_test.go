@@ -0,0 +1,114 @@
+package scrape
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestValidateProfile(t *testing.T) {
+	var gzipped bytes.Buffer
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&gzipped, 0))
+
+	gzr, err := gzip.NewReader(bytes.NewReader(gzipped.Bytes()))
+	require.NoError(t, err)
+	raw, err := io.ReadAll(gzr)
+	require.NoError(t, err)
+
+	// The truncated profiles are cut off before maxValidatedPrefix bytes,
+	// past which truncation of gzipped profiles isn't detected.
+	small := smallProfile()
+	smallGzipped := gzipBytes(t, small)
+
+	for _, tt := range []struct {
+		name    string
+		payload []byte
+		valid   bool
+	}{
+		{
+			name:    "gzipped pprof",
+			payload: gzipped.Bytes(),
+			valid:   true,
+		},
+		{
+			name:    "raw pprof",
+			payload: raw,
+			valid:   true,
+		},
+		{
+			name:    "html error page",
+			payload: []byte("<!DOCTYPE html><html><body><h1>502 Bad Gateway</h1></body></html>"),
+		},
+		{
+			name:    "small gzipped pprof",
+			payload: smallGzipped,
+			valid:   true,
+		},
+		{
+			name:    "gzipped html error page",
+			payload: gzipBytes(t, []byte("<html><body>oops</body></html>")),
+		},
+		{
+			name:    "truncated gzipped pprof",
+			payload: smallGzipped[:len(smallGzipped)/2],
+		},
+		{
+			name:    "truncated raw pprof",
+			payload: small[:len(small)-1],
+		},
+		{
+			name:    "json error",
+			payload: []byte(`{"error":"profiling disabled"}`),
+		},
+		{
+			name:    "empty",
+			payload: []byte{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProfile(tt.payload)
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, errInvalidProfile)
+			}
+		})
+	}
+}
+
+// smallProfile returns a raw pprof profile much smaller than
+// maxValidatedPrefix.
+func smallProfile() []byte {
+	var sampleType []byte
+	sampleType = protowire.AppendTag(sampleType, 1, protowire.VarintType) // type
+	sampleType = protowire.AppendVarint(sampleType, 1)
+	sampleType = protowire.AppendTag(sampleType, 2, protowire.VarintType) // unit
+	sampleType = protowire.AppendVarint(sampleType, 2)
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType) // sample_type
+	b = protowire.AppendBytes(b, sampleType)
+	for _, s := range []string{"", "goroutine", "count"} {
+		b = protowire.AppendTag(b, 6, protowire.BytesType) // string_table
+		b = protowire.AppendString(b, s)
+	}
+	b = protowire.AppendTag(b, 9, protowire.VarintType) // time_nanos
+	b = protowire.AppendVarint(b, 1700000000000000000)
+	return b
+}
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	_, err := gzw.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, gzw.Close())
+	return buf.Bytes()
+}
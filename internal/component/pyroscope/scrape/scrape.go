@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sort"
 	"sync"
 	"time"
 
@@ -17,7 +18,6 @@ import (
 	"github.com/grafana/agent/internal/component"
 	component_config "github.com/grafana/agent/internal/component/common/config"
 	"github.com/grafana/agent/internal/component/discovery"
-	"github.com/grafana/agent/internal/component/prometheus/scrape"
 )
 
 const (
@@ -58,8 +58,26 @@ type Arguments struct {
 	ScrapeInterval time.Duration `river:"scrape_interval,attr,optional"`
 	// The timeout for scraping targets of this config.
 	ScrapeTimeout time.Duration `river:"scrape_timeout,attr,optional"`
+	// The timeout for pushing a scraped profile to the components in
+	// ForwardTo. It is independent from ScrapeTimeout.
+	PushTimeout time.Duration `river:"push_timeout,attr,optional"`
 	// The URL scheme with which to fetch metrics from targets.
 	Scheme string `river:"scheme,attr,optional"`
+	// The port of targets whose address has none. The port is inferred from
+	// the scheme when 0.
+	DefaultPort int `river:"default_port,attr,optional"`
+	// Uses the pyroscope.io/port and pyroscope.io/scheme annotations of
+	// Kubernetes pods to set the port and the scheme of their targets.
+	HonorAnnotations bool `river:"honor_annotations,attr,optional"`
+	// Disables checking that scraped payloads are pprof profiles before
+	// forwarding them, for targets which serve other formats.
+	SkipProfileValidation bool `river:"skip_profile_validation,attr,optional"`
+	// Logs a warning when a scrape starts this long after the time it was
+	// scheduled at. Disabled when 0.
+	ScrapeSkewWarningThreshold time.Duration `river:"scrape_skew_warning_threshold,attr,optional"`
+	// Adds the agent_hostname, scrape_job and scrape_pool_generation labels
+	// to scraped profiles, after relabeling.
+	InjectMetadata bool `river:"inject_metadata,attr,optional"`
 
 	// todo(ctovena): add support for limits.
 	// // An uncompressed response body larger than this many bytes will cause the
@@ -80,11 +98,50 @@ type Arguments struct {
 
 	HTTPClientConfig component_config.HTTPClientConfig `river:",squash"`
 
+	Transport TransportArguments `river:"transport,block,optional"`
+
+	Health HealthArguments `river:"health,block,optional"`
+
 	ProfilingConfig ProfilingConfig `river:"profiling_config,block,optional"`
 
 	Clustering cluster.ComponentBlock `river:"clustering,block,optional"`
 }
 
+// TransportArguments configures the connections to the targets.
+type TransportArguments struct {
+	// How long an idle connection is kept open for the next scrape of the
+	// same target. Idle connections are never closed when 0.
+	IdleConnTimeout time.Duration `river:"idle_conn_timeout,attr,optional"`
+	// Maximum number of idle connections kept open per host. Targets served
+	// by the same host, such as the profile types of a target, share them.
+	MaxIdleConnsPerHost int `river:"max_idle_conns_per_host,attr,optional"`
+	// Only scrape targets over TLS with HTTP/2, failing to scrape targets
+	// which don't support it instead of falling back to HTTP/1.1.
+	ForceHTTP2 bool `river:"force_http2,attr,optional"`
+}
+
+// DefaultTransportArguments holds the default transport settings.
+var DefaultTransportArguments = TransportArguments{
+	IdleConnTimeout:     5 * time.Minute,
+	MaxIdleConnsPerHost: 1000,
+}
+
+// SetToDefault implements river.Defaulter.
+func (args *TransportArguments) SetToDefault() {
+	*args = DefaultTransportArguments
+}
+
+// Validate implements river.Validator.
+func (args *TransportArguments) Validate() error {
+	if args.IdleConnTimeout < 0 {
+		return fmt.Errorf("idle_conn_timeout must not be negative")
+	}
+	if args.MaxIdleConnsPerHost <= 0 {
+		return fmt.Errorf("max_idle_conns_per_host must be greater than 0")
+	}
+	return nil
+}
+
 type ProfilingConfig struct {
 	Memory            ProfilingTarget         `river:"profile.memory,block,optional"`
 	Block             ProfilingTarget         `river:"profile.block,block,optional"`
@@ -121,6 +178,7 @@ func (cfg *ProfilingConfig) AllTargets() map[string]ProfilingTarget {
 			Enabled: custom.Enabled,
 			Path:    custom.Path,
 			Delta:   custom.Delta,
+			Params:  custom.Params,
 		}
 	}
 
@@ -174,10 +232,34 @@ func (cfg *ProfilingConfig) SetToDefault() {
 	*cfg = DefaultProfilingConfig
 }
 
+// Validate implements river.Validator.
+func (cfg *ProfilingConfig) Validate() error {
+	builtins := DefaultProfilingConfig.AllTargets()
+	seen := make(map[string]struct{}, len(cfg.Custom))
+	for _, custom := range cfg.Custom {
+		if _, ok := builtins[custom.Name]; ok {
+			return fmt.Errorf("custom profile %q clashes with the built-in profile of the same name", custom.Name)
+		}
+		if _, ok := seen[custom.Name]; ok {
+			return fmt.Errorf("custom profile %q is defined more than once", custom.Name)
+		}
+		seen[custom.Name] = struct{}{}
+
+		if !model.LabelName(profileEnabledLabel(custom.Name)).IsValid() {
+			return fmt.Errorf("invalid custom profile name %q: it must only contain letters, digits and underscores", custom.Name)
+		}
+	}
+	return nil
+}
+
 type ProfilingTarget struct {
 	Enabled bool   `river:"enabled,attr,optional"`
 	Path    string `river:"path,attr,optional"`
 	Delta   bool   `river:"delta,attr,optional"`
+
+	// Params are the query parameters of custom profiling targets, which
+	// take precedence over the params of the scrape job.
+	Params url.Values
 }
 
 type CustomProfilingTarget struct {
@@ -185,6 +267,9 @@ type CustomProfilingTarget struct {
 	Path    string `river:"path,attr"`
 	Delta   bool   `river:"delta,attr,optional"`
 	Name    string `river:",label"`
+	// Query parameters with which the profile is scraped, in addition to the
+	// params of the scrape job.
+	Params url.Values `river:"params,attr,optional"`
 }
 
 var DefaultArguments = NewDefaultArguments()
@@ -196,7 +281,10 @@ func NewDefaultArguments() Arguments {
 		HTTPClientConfig: component_config.DefaultHTTPClientConfig,
 		ScrapeInterval:   15 * time.Second,
 		ScrapeTimeout:    10 * time.Second,
+		PushTimeout:      10 * time.Second,
 		ProfilingConfig:  DefaultProfilingConfig,
+		Transport:        DefaultTransportArguments,
+		Health:           DefaultHealthArguments,
 	}
 }
 
@@ -210,6 +298,15 @@ func (arg *Arguments) Validate() error {
 	if arg.ScrapeTimeout.Seconds() <= 0 {
 		return fmt.Errorf("scrape_timeout must be greater than 0")
 	}
+	if arg.PushTimeout <= 0 {
+		return fmt.Errorf("push_timeout must be greater than 0")
+	}
+	if arg.ScrapeSkewWarningThreshold < 0 {
+		return fmt.Errorf("scrape_skew_warning_threshold must not be negative")
+	}
+	if arg.DefaultPort < 0 || arg.DefaultPort > 65535 {
+		return fmt.Errorf("default_port must be between 1 and 65535 when set")
+	}
 
 	// ScrapeInterval must be at least 2 seconds, because if
 	// ProfilingTarget.Delta is true the ScrapeInterval - 1s is propagated in
@@ -220,6 +317,10 @@ func (arg *Arguments) Validate() error {
 		}
 	}
 
+	if arg.Transport.ForceHTTP2 && !arg.HTTPClientConfig.EnableHTTP2 {
+		return fmt.Errorf("transport force_http2 can't be set when enable_http2 is false")
+	}
+
 	// We must explicitly Validate because HTTPClientConfig is squashed and it won't run otherwise
 	return arg.HTTPClientConfig.Validate()
 }
@@ -235,6 +336,9 @@ type Component struct {
 	args       Arguments
 	scraper    *Manager
 	appendable *pyroscope.Fanout
+
+	healthMut sync.Mutex
+	health    component.Health // Last health reported by CurrentHealth.
 }
 
 var _ component.Component = (*Component)(nil)
@@ -248,7 +352,7 @@ func New(o component.Options, args Arguments) (*Component, error) {
 	clusterData := data.(cluster.Cluster)
 
 	flowAppendable := pyroscope.NewFanout(args.ForwardTo, o.ID, o.Registerer)
-	scraper := NewManager(flowAppendable, o.Logger)
+	scraper := NewManager(flowAppendable, o.Registerer, o.Logger)
 	c := &Component{
 		opts:          o,
 		cluster:       clusterData,
@@ -366,27 +470,90 @@ func convertLabelSet(tg discovery.Target) model.LabelSet {
 
 // DebugInfo implements component.DebugComponent.
 func (c *Component) DebugInfo() interface{} {
-	var res []scrape.TargetStatus
+	var res []TargetStatus
 
 	for job, stt := range c.scraper.TargetsActive() {
 		for _, st := range stt {
-			var lastError string
-			if st.LastError() != nil {
-				lastError = st.LastError().Error()
+			if st != nil {
+				res = append(res, st.status(job))
 			}
+		}
+	}
+
+	var dropped []DroppedTargetStatus
+	for job, stt := range c.scraper.TargetsDropped() {
+		for _, st := range stt {
 			if st != nil {
-				res = append(res, scrape.TargetStatus{
-					JobName:            job,
-					URL:                st.URL(),
-					Health:             string(st.Health()),
-					Labels:             st.discoveredLabels.Map(),
-					LastError:          lastError,
-					LastScrape:         st.LastScrape(),
-					LastScrapeDuration: st.LastScrapeDuration(),
-				})
+				dropped = append(dropped, st.droppedStatus(job))
 			}
 		}
 	}
 
-	return scrape.ScraperStatus{TargetStatus: res}
+	var (
+		pools       []ScrapePoolStatus
+		connections = c.scraper.connectionStats()
+	)
+	for name, skew := range c.scraper.scrapeSkews() {
+		pools = append(pools, ScrapePoolStatus{
+			Name:              name,
+			ScrapeSkewCount:   skew.count,
+			ScrapeSkewP50:     skew.p50,
+			ScrapeSkewP99:     skew.p99,
+			NewConnections:    connections[name].newConns,
+			ReusedConnections: connections[name].reused,
+		})
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+
+	return ScraperStatus{TargetStatus: res, DroppedTargetStatus: dropped, ScrapePoolStatus: pools}
+}
+
+// ScraperStatus reports the status of the scraper's targets and scrape pools.
+type ScraperStatus struct {
+	TargetStatus        []TargetStatus        `river:"target,block,optional"`
+	DroppedTargetStatus []DroppedTargetStatus `river:"dropped_target,block,optional"`
+	ScrapePoolStatus    []ScrapePoolStatus    `river:"scrape_pool,block,optional"`
+}
+
+// DroppedTargetStatus reports a target which isn't scraped, and the reason
+// why.
+type DroppedTargetStatus struct {
+	JobName string            `river:"job,attr"`
+	URL     string            `river:"url,attr"`
+	Labels  map[string]string `river:"labels,attr"`
+	Reason  string            `river:"reason,attr"`
+}
+
+// ScrapePoolStatus reports the skew of the scrapes of a pool, the delay
+// between the time scrapes are scheduled at and the time they start, since
+// the component was last updated. It also reports how many of the
+// connections used by the scrapes of the pool were new or reused idle
+// connections.
+type ScrapePoolStatus struct {
+	Name              string        `river:"name,attr"`
+	ScrapeSkewCount   uint64        `river:"scrape_skew_count,attr"`
+	ScrapeSkewP50     time.Duration `river:"scrape_skew_p50,attr,optional"`
+	ScrapeSkewP99     time.Duration `river:"scrape_skew_p99,attr,optional"`
+	NewConnections    uint64        `river:"new_connections,attr"`
+	ReusedConnections uint64        `river:"reused_connections,attr"`
+}
+
+// TargetStatus reports on the status of the latest scrape and push for a
+// target. Health and LastError only reflect fetching the profile; failures to
+// push it downstream are reported by LastPushError. LastScrapeSize is the size
+// in bytes of the last fetched payload, and NextScrape is when the target is
+// scheduled to be scraped next.
+type TargetStatus struct {
+	JobName            string            `river:"job,attr"`
+	URL                string            `river:"url,attr"`
+	Health             string            `river:"health,attr"`
+	Labels             map[string]string `river:"labels,attr"`
+	LastError          string            `river:"last_error,attr,optional"`
+	LastScrape         time.Time         `river:"last_scrape,attr"`
+	LastScrapeDuration time.Duration     `river:"last_scrape_duration,attr,optional"`
+	LastScrapeSize     int               `river:"last_scrape_size,attr,optional"`
+	NextScrape         time.Time         `river:"next_scrape,attr,optional"`
+	LastPushError      string            `river:"last_push_error,attr,optional"`
+	LastPush           time.Time         `river:"last_push,attr,optional"`
+	LastPushDuration   time.Duration     `river:"last_push_duration,attr,optional"`
 }
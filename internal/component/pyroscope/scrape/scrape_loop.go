@@ -14,7 +14,7 @@ import (
 	"github.com/grafana/agent/internal/component/pyroscope"
 	"github.com/grafana/agent/internal/flow/logging/level"
 	"github.com/grafana/agent/internal/useragent"
-	commonconfig "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"github.com/prometheus/prometheus/util/pool"
 	"golang.org/x/net/context/ctxhttp"
@@ -27,27 +27,44 @@ var (
 
 type scrapePool struct {
 	config Arguments
+	name   string
+
+	// generation is the number of times config was applied since the pool
+	// was created, injected into profiles along with hostname.
+	generation uint64
+	hostname   string
 
 	logger       log.Logger
 	scrapeClient *http.Client
 	appendable   pyroscope.Appendable
+	metrics      *metrics
+	skew         *skewTracker
+	connections  *connTracker
 
 	mtx            sync.RWMutex
 	activeTargets  map[uint64]*scrapeLoop
 	droppedTargets []*Target
 }
 
-func newScrapePool(cfg Arguments, appendable pyroscope.Appendable, logger log.Logger) (*scrapePool, error) {
-	scrapeClient, err := commonconfig.NewClientFromConfig(*cfg.HTTPClientConfig.Convert(), cfg.JobName)
+func newScrapePool(name string, cfg Arguments, appendable pyroscope.Appendable, m *metrics, logger log.Logger) (*scrapePool, error) {
+	scrapeClient, err := newScrapeClient(cfg)
 	if err != nil {
 		return nil, err
 	}
+	if m == nil {
+		m = newMetrics(nil)
+	}
 
 	return &scrapePool{
 		config:        cfg,
+		name:          name,
+		hostname:      agentHostname(),
 		logger:        logger,
 		scrapeClient:  scrapeClient,
 		appendable:    appendable,
+		metrics:       m,
+		skew:          newSkewTracker(name, cfg, m.scrapeSkew, logger),
+		connections:   newConnTracker(name, m.connections),
 		activeTargets: map[uint64]*scrapeLoop{},
 	}, nil
 }
@@ -60,11 +77,7 @@ func (tg *scrapePool) sync(groups []*targetgroup.Group) {
 	var actives []*Target
 	tg.droppedTargets = tg.droppedTargets[:0]
 	for _, group := range groups {
-		targets, dropped, err := targetsFromGroup(group, tg.config, allTargets)
-		if err != nil {
-			level.Error(tg.logger).Log("msg", "creating targets failed", "err", err)
-			continue
-		}
+		targets, dropped := targetsFromGroup(group, tg.config, allTargets)
 		for _, t := range targets {
 			if t.Labels().Len() > 0 {
 				actives = append(actives, t)
@@ -75,7 +88,7 @@ func (tg *scrapePool) sync(groups []*targetgroup.Group) {
 
 	for _, t := range actives {
 		if _, ok := tg.activeTargets[t.Hash()]; !ok {
-			loop := newScrapeLoop(t, tg.scrapeClient, tg.appendable, tg.config.ScrapeInterval, tg.config.ScrapeTimeout, tg.logger)
+			loop := tg.newScrapeLoop(t)
 			tg.activeTargets[t.Hash()] = loop
 			loop.start()
 		} else {
@@ -100,30 +113,73 @@ func (tg *scrapePool) reload(cfg Arguments) error {
 	tg.mtx.Lock()
 	defer tg.mtx.Unlock()
 
-	if tg.config.ScrapeInterval == cfg.ScrapeInterval &&
+	// Skews recorded with the previous configuration are no longer relevant.
+	tg.skew.reset(cfg)
+	tg.generation++
+
+	// The client, along with its idle connections, is kept unless its
+	// settings changed.
+	clientChanged := tg.config.Transport != cfg.Transport ||
+		!reflect.DeepEqual(tg.config.HTTPClientConfig, cfg.HTTPClientConfig)
+
+	if !clientChanged &&
+		tg.config.ScrapeInterval == cfg.ScrapeInterval &&
 		tg.config.ScrapeTimeout == cfg.ScrapeTimeout &&
-		reflect.DeepEqual(tg.config.HTTPClientConfig, cfg.HTTPClientConfig) {
+		tg.config.PushTimeout == cfg.PushTimeout &&
+		tg.config.SkipProfileValidation == cfg.SkipProfileValidation {
 
 		tg.config = cfg
+		for _, loop := range tg.activeTargets {
+			loop.setMetadata(tg.metadata())
+		}
 		return nil
 	}
 	tg.config = cfg
 
-	scrapeClient, err := commonconfig.NewClientFromConfig(*cfg.HTTPClientConfig.Convert(), cfg.JobName)
-	if err != nil {
-		return err
+	if clientChanged {
+		scrapeClient, err := newScrapeClient(cfg)
+		if err != nil {
+			return err
+		}
+		tg.scrapeClient.CloseIdleConnections()
+		tg.scrapeClient = scrapeClient
 	}
-	tg.scrapeClient = scrapeClient
 	for hash, t := range tg.activeTargets {
 		// restart the loop with the new configuration
 		t.stop(false)
-		loop := newScrapeLoop(t.Target, tg.scrapeClient, tg.appendable, tg.config.ScrapeInterval, tg.config.ScrapeTimeout, tg.logger)
+		loop := tg.newScrapeLoop(t.Target)
 		tg.activeTargets[hash] = loop
 		loop.start()
 	}
 	return nil
 }
 
+// newScrapeLoop creates a scrape loop for t using the current configuration
+// of the pool. tg.mtx must be held when calling newScrapeLoop.
+func (tg *scrapePool) newScrapeLoop(t *Target) *scrapeLoop {
+	loop := newScrapeLoop(t, tg.scrapeClient, tg.appendable, tg.metrics, tg.config.ScrapeInterval, tg.config.ScrapeTimeout, tg.logger)
+	loop.validateProfiles = !tg.config.SkipProfileValidation
+	loop.pushTimeout = tg.config.PushTimeout
+	loop.skew = tg.skew
+	loop.connections = tg.connections
+	loop.metadata = tg.metadata()
+	return loop
+}
+
+// metadata returns the metadata injected into the profiles scraped by the
+// pool, or nil if inject_metadata is disabled. tg.mtx must be held when
+// calling metadata.
+func (tg *scrapePool) metadata() *scrapeMetadata {
+	if !tg.config.InjectMetadata {
+		return nil
+	}
+	return &scrapeMetadata{
+		hostname:   tg.hostname,
+		job:        tg.name,
+		generation: tg.generation,
+	}
+}
+
 func (tg *scrapePool) stop() {
 	tg.mtx.Lock()
 	defer tg.mtx.Unlock()
@@ -137,6 +193,7 @@ func (tg *scrapePool) stop() {
 		}(t)
 	}
 	wg.Wait()
+	tg.connections.stop()
 }
 
 func (tg *scrapePool) ActiveTargets() []*Target {
@@ -157,6 +214,11 @@ func (tg *scrapePool) DroppedTargets() []*Target {
 	return result
 }
 
+// maxPendingPushes is the number of scraped profiles of a target which may
+// wait to be pushed downstream. Profiles scraped while the queue is full are
+// dropped so that slow pushes never delay the next scrape.
+const maxPendingPushes = 2
+
 type scrapeLoop struct {
 	*Target
 
@@ -165,6 +227,26 @@ type scrapeLoop struct {
 	scrapeClient *http.Client
 	appender     pyroscope.Appender
 
+	// validateProfiles enables checking that fetched payloads are pprof
+	// profiles before appending them.
+	validateProfiles bool
+	metrics          *metrics
+
+	// pushTimeout bounds the time spent appending a single profile,
+	// independently of the scrape timeout.
+	pushTimeout time.Duration
+	pushes      chan []byte
+
+	// skew records the delay between the scheduled and actual start of
+	// scrapes. Nil when the loop doesn't belong to a pool.
+	skew *skewTracker
+	// connections records whether scrapes use new or reused connections. Nil
+	// when the loop doesn't belong to a pool.
+	connections *connTracker
+	// metadata is injected into the labels of appended profiles. Nil when
+	// inject_metadata is disabled. Guarded by the mutex of the target.
+	metadata *scrapeMetadata
+
 	req               *http.Request
 	logger            log.Logger
 	interval, timeout time.Duration
@@ -173,7 +255,7 @@ type scrapeLoop struct {
 	wg                sync.WaitGroup
 }
 
-func newScrapeLoop(t *Target, scrapeClient *http.Client, appendable pyroscope.Appendable, interval, timeout time.Duration, logger log.Logger) *scrapeLoop {
+func newScrapeLoop(t *Target, scrapeClient *http.Client, appendable pyroscope.Appendable, m *metrics, interval, timeout time.Duration, logger log.Logger) *scrapeLoop {
 	// if the URL parameter have a seconds parameter, then the collection will
 	// take at least scrape_duration - 1 second, as the HTTP request will block
 	// until the profile is collected.
@@ -186,6 +268,8 @@ func newScrapeLoop(t *Target, scrapeClient *http.Client, appendable pyroscope.Ap
 		logger:       logger,
 		scrapeClient: scrapeClient,
 		appender:     NewDeltaAppender(appendable.Appender(), t.allLabels),
+		metrics:      m,
+		pushTimeout:  DefaultArguments.PushTimeout,
 		interval:     interval,
 		timeout:      timeout,
 	}
@@ -194,26 +278,64 @@ func newScrapeLoop(t *Target, scrapeClient *http.Client, appendable pyroscope.Ap
 func (t *scrapeLoop) start() {
 	t.graceShut = make(chan struct{})
 	t.once = sync.Once{}
-	t.wg.Add(1)
+	t.pushes = make(chan []byte, maxPendingPushes)
+	t.wg.Add(2)
+
+	// Once the loop is stopped, the pushes which are still pending share a
+	// single push_timeout deadline, so that stopping the loop doesn't take
+	// push_timeout for each of them.
+	pushCtx, cancelPushes := context.WithCancel(context.Background())
 
 	go func() {
 		defer t.wg.Done()
-
+		// Pushes which are still pending are flushed by the push loop.
+		defer func() {
+			time.AfterFunc(t.pushTimeout, cancelPushes)
+			close(t.pushes)
+		}()
+
+		offset := t.offset(t.interval)
+		t.setNextScrape(time.Now().Add(offset))
 		select {
-		case <-time.After(t.offset(t.interval)):
+		case <-time.After(offset):
 		case <-t.graceShut:
 			return
 		}
 		ticker := time.NewTicker(t.interval)
 		defer ticker.Stop()
+		t.setNextScrape(time.Now().Add(t.interval))
 
 		for {
+			var tick time.Time
 			select {
 			case <-t.graceShut:
 				return
-			case <-ticker.C:
+			case tick = <-ticker.C:
 			}
+			if t.skew != nil {
+				t.skew.observe(t.Labels().String(), time.Since(tick))
+			}
+			next := tick.Add(t.interval)
+			t.setNextScrape(next)
 			t.scrape()
+
+			// The ticker drops ticks while a scrape is running, so a scrape
+			// taking longer than the interval is followed by another one
+			// right away.
+			if now := time.Now(); now.After(next) {
+				t.setNextScrape(now)
+			}
+		}
+	}()
+
+	go func() {
+		defer t.wg.Done()
+		defer cancelPushes()
+
+		// Profiles are pushed one at a time and in order, since appenders
+		// computing delta profiles are stateful.
+		for b := range t.pushes {
+			t.push(pushCtx, b)
 		}
 	}()
 }
@@ -234,9 +356,11 @@ func (t *scrapeLoop) scrape() {
 			break
 		}
 	}
-	if err := t.fetchProfile(scrapeCtx, profileType, buf); err != nil {
+	err := t.fetchProfile(scrapeCtx, profileType, buf)
+	t.metrics.fetchDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
 		level.Error(t.logger).Log("msg", "fetch profile failed", "target", t.Labels().String(), "err", err)
-		t.updateTargetStatus(start, err)
+		t.updateTargetStatus(start, buf.Len(), err)
 		return
 	}
 
@@ -244,26 +368,83 @@ func (t *scrapeLoop) scrape() {
 	if len(b) > 0 {
 		t.lastScrapeSize = len(b)
 	}
-	if err := t.appender.Append(context.Background(), t.allLabels, []*pyroscope.RawSample{{RawProfile: b}}); err != nil {
+	if t.validateProfiles {
+		if err := validateProfile(b); err != nil {
+			err = fmt.Errorf("rejected %s profile from %s: %w", profileType, t.req.URL.String(), err)
+			level.Error(t.logger).Log("msg", "invalid profile", "target", t.Labels().String(), "err", err)
+			t.metrics.invalidProfiles.WithLabelValues(t.Labels().Get(model.JobLabel)).Inc()
+			t.updateTargetStatus(start, len(b), err)
+			return
+		}
+	}
+	t.updateTargetStatus(start, len(b), nil)
+
+	select {
+	case t.pushes <- b:
+	default:
+		level.Warn(t.logger).Log("msg", "dropping profile, too many pushes are pending", "target", t.Labels().String())
+		t.metrics.droppedProfiles.Inc()
+	}
+}
+
+// push appends a scraped profile downstream and records the outcome on the
+// target. Push failures don't affect the health of the target, which only
+// reflects whether it could be scraped.
+func (t *scrapeLoop) push(ctx context.Context, b []byte) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, t.pushTimeout)
+	defer cancel()
+
+	lbs := t.allLabels
+	t.mtx.RLock()
+	md := t.metadata
+	t.mtx.RUnlock()
+	if md != nil {
+		lbs = md.inject(lbs)
+	}
+
+	err := t.appender.Append(ctx, lbs, []*pyroscope.RawSample{{RawProfile: b}})
+	t.metrics.pushDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
 		level.Error(t.logger).Log("msg", "push failed", "labels", t.Labels().String(), "err", err)
-		t.updateTargetStatus(start, err)
-		return
 	}
-	t.updateTargetStatus(start, nil)
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.lastPushError = err
+	t.lastPush = start
+	t.lastPushDuration = time.Since(start)
 }
 
-func (t *scrapeLoop) updateTargetStatus(start time.Time, err error) {
+func (t *scrapeLoop) updateTargetStatus(start time.Time, size int, err error) {
 	t.mtx.Lock()
 	defer t.mtx.Unlock()
 	if err != nil {
+		if t.health != HealthBad {
+			t.unhealthySince = start
+		}
 		t.health = HealthBad
 		t.lastError = err
 	} else {
 		t.health = HealthGood
 		t.lastError = nil
+		t.unhealthySince = time.Time{}
 	}
 	t.lastScrape = start
 	t.lastScrapeDuration = time.Since(start)
+	t.lastScrapeSize = size
+}
+
+func (t *scrapeLoop) setMetadata(md *scrapeMetadata) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.metadata = md
+}
+
+func (t *scrapeLoop) setNextScrape(next time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.nextScrape = next
 }
 
 func (t *scrapeLoop) fetchProfile(ctx context.Context, profileType string, buf io.Writer) error {
@@ -278,6 +459,9 @@ func (t *scrapeLoop) fetchProfile(ctx context.Context, profileType string, buf i
 	}
 
 	level.Debug(t.logger).Log("msg", "scraping profile", "labels", t.Labels().String(), "url", t.req.URL.String())
+	if t.connections != nil {
+		ctx = t.connections.withTrace(ctx)
+	}
 	resp, err := ctxhttp.Do(ctx, t.scrapeClient, t.req)
 	if err != nil {
 		return err
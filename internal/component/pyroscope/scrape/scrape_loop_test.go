@@ -2,6 +2,7 @@ package scrape
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -14,6 +15,8 @@ import (
 	"github.com/grafana/agent/internal/component/discovery"
 	"github.com/grafana/agent/internal/component/pyroscope"
 	"github.com/grafana/agent/internal/util"
+	"github.com/grafana/river"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"github.com/prometheus/prometheus/model/labels"
@@ -33,11 +36,11 @@ func TestScrapePool(t *testing.T) {
 	args.ProfilingConfig.Goroutine.Enabled = false
 	args.ProfilingConfig.Memory.Enabled = false
 
-	p, err := newScrapePool(args, pyroscope.AppendableFunc(
+	p, err := newScrapePool("test", args, pyroscope.AppendableFunc(
 		func(ctx context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
 			return nil
 		}),
-		util.TestLogger(t))
+		nil, util.TestLogger(t))
 	require.NoError(t, err)
 
 	defer p.stop()
@@ -157,6 +160,154 @@ func TestScrapePool(t *testing.T) {
 	}
 }
 
+func TestScrapePool_CustomProfile(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"))
+
+	queries := make(chan url.Values, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/debug/pprof/lock-contention" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		select {
+		case queries <- r.URL.Query():
+		default:
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	args := NewDefaultArguments()
+	args.ScrapeInterval = 100 * time.Millisecond
+	args.ScrapeTimeout = time.Second
+	args.Params = url.Values{"debug": []string{"1"}, "gc": []string{"1"}}
+	args.ProfilingConfig.Memory.Enabled = false
+	args.ProfilingConfig.Block.Enabled = false
+	args.ProfilingConfig.Goroutine.Enabled = false
+	args.ProfilingConfig.Mutex.Enabled = false
+	args.ProfilingConfig.ProcessCPU.Enabled = false
+	args.ProfilingConfig.Custom = []CustomProfilingTarget{{
+		Name:    "lock_contention",
+		Enabled: true,
+		Path:    "/debug/pprof/lock-contention",
+		Params:  url.Values{"event": []string{"lock"}, "debug": []string{"0"}},
+	}}
+
+	appended := make(chan labels.Labels, 10)
+	p, err := newScrapePool("test", args, pyroscope.AppendableFunc(
+		func(ctx context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
+			select {
+			case appended <- labels:
+			default:
+			}
+			return nil
+		}),
+		nil, util.TestLogger(t))
+	require.NoError(t, err)
+	defer p.stop()
+
+	p.sync([]*targetgroup.Group{{
+		Targets: []model.LabelSet{
+			{model.AddressLabel: model.LabelValue(strings.TrimPrefix(server.URL, "http://"))},
+		},
+	}})
+
+	// The params of the custom profile take precedence over the job ones.
+	select {
+	case q := <-queries:
+		require.Equal(t, url.Values{"debug": []string{"0"}, "gc": []string{"1"}, "event": []string{"lock"}}, q)
+	case <-time.After(5 * time.Second):
+		t.Fatal("custom profile wasn't scraped")
+	}
+	select {
+	case lbls := <-appended:
+		require.Equal(t, "lock_contention", lbls.Get(model.MetricNameLabel))
+	case <-time.After(5 * time.Second):
+		t.Fatal("custom profile wasn't appended")
+	}
+
+	// Job params aren't modified by the params of the profile.
+	require.Equal(t, url.Values{"debug": []string{"1"}, "gc": []string{"1"}}, args.Params)
+}
+
+func TestScrapePool_InjectMetadata(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	args := NewDefaultArguments()
+	args.ScrapeInterval = 100 * time.Millisecond
+	args.ScrapeTimeout = time.Second
+	args.SkipProfileValidation = true
+	args.ProfilingConfig.Memory.Enabled = false
+	args.ProfilingConfig.Block.Enabled = false
+	args.ProfilingConfig.Mutex.Enabled = false
+	args.ProfilingConfig.ProcessCPU.Enabled = false
+	args.InjectMetadata = true
+
+	appended := make(chan labels.Labels, 10)
+	p, err := newScrapePool("test", args, pyroscope.AppendableFunc(
+		func(ctx context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
+			select {
+			case appended <- labels:
+			default:
+			}
+			return nil
+		}),
+		nil, util.TestLogger(t))
+	require.NoError(t, err)
+	defer p.stop()
+
+	// The label set on the target is overridden by the injected one.
+	p.sync([]*targetgroup.Group{{
+		Targets: []model.LabelSet{{
+			model.AddressLabel: model.LabelValue(strings.TrimPrefix(server.URL, "http://")),
+			ScrapeJobLabel:     "relabeled",
+		}},
+	}})
+
+	nextLabels := func() labels.Labels {
+		// Drain the profiles appended before the last change.
+	drain:
+		for {
+			select {
+			case <-appended:
+			default:
+				break drain
+			}
+		}
+		select {
+		case lbls := <-appended:
+			return lbls
+		case <-time.After(5 * time.Second):
+			t.Fatal("no profile was appended")
+			return nil
+		}
+	}
+
+	lbls := nextLabels()
+	require.Equal(t, agentHostname(), lbls.Get(AgentHostnameLabel))
+	require.Equal(t, "test", lbls.Get(ScrapeJobLabel))
+	require.Equal(t, "0", lbls.Get(ScrapePoolGenerationLabel))
+
+	// Applying the configuration again bumps the generation.
+	require.NoError(t, p.reload(args))
+	require.Eventually(t, func() bool {
+		return nextLabels().Get(ScrapePoolGenerationLabel) == "1"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// No metadata is injected once disabled.
+	args.InjectMetadata = false
+	require.NoError(t, p.reload(args))
+	require.Eventually(t, func() bool {
+		lbls := nextLabels()
+		return !lbls.Has(AgentHostnameLabel) && !lbls.Has(ScrapePoolGenerationLabel) && lbls.Get(ScrapeJobLabel) == "relabeled"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
 func TestScrapeLoop(t *testing.T) {
 	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"))
 
@@ -191,7 +342,7 @@ func TestScrapeLoop(t *testing.T) {
 			require.Equal(t, []byte("ok"), samples[0].RawProfile)
 			return nil
 		}),
-		200*time.Millisecond, 30*time.Second, util.TestLogger(t))
+		newMetrics(nil), 200*time.Millisecond, 30*time.Second, util.TestLogger(t))
 	defer loop.stop(true)
 
 	require.Equal(t, HealthUnknown, loop.Health())
@@ -209,15 +360,217 @@ func TestScrapeLoop(t *testing.T) {
 	require.NotEmpty(t, loop.LastScrapeDuration())
 }
 
+func TestScrapeLoop_InvalidProfile(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>Service Unavailable</body></html>"))
+	}))
+	defer server.Close()
+
+	args := NewDefaultArguments()
+	args.ScrapeInterval = 100 * time.Millisecond
+	appendTotal := atomic.NewInt64(0)
+	m := newMetrics(nil)
+
+	p, err := newScrapePool("test", args, pyroscope.AppendableFunc(
+		func(ctx context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
+			appendTotal.Inc()
+			return nil
+		}),
+		m, util.TestLogger(t))
+	require.NoError(t, err)
+
+	p.mtx.Lock()
+	loop := p.newScrapeLoop(NewTarget(
+		labels.FromStrings(
+			model.SchemeLabel, "http",
+			model.AddressLabel, strings.TrimPrefix(server.URL, "http://"),
+			ProfilePath, "/debug/pprof/goroutine",
+		), labels.FromStrings(), url.Values{}))
+	p.mtx.Unlock()
+	defer loop.stop(true)
+
+	loop.start()
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(m.invalidProfiles.WithLabelValues("")) > 0
+	}, 5*time.Second, 100*time.Millisecond)
+
+	require.Equal(t, HealthBad, loop.Health())
+	require.ErrorIs(t, loop.LastError(), errInvalidProfile)
+	require.Contains(t, loop.LastError().Error(), server.URL)
+	require.Zero(t, appendTotal.Load())
+}
+
+func TestScrapeLoop_DebugInfoDuringFailure(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Keep scrapes in flight while the debug info is rendered.
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("boom"))
+	}))
+	defer server.Close()
+
+	args := NewDefaultArguments()
+	args.ScrapeInterval = 50 * time.Millisecond
+	p, err := newScrapePool("test", args, pyroscope.NoopAppendable, nil, util.TestLogger(t))
+	require.NoError(t, err)
+
+	p.mtx.Lock()
+	target := NewTarget(
+		labels.FromStrings(
+			model.SchemeLabel, "http",
+			model.AddressLabel, strings.TrimPrefix(server.URL, "http://"),
+			ProfilePath, "/debug/pprof/goroutine",
+		), labels.FromStrings("foo", "bar"), url.Values{})
+	loop := p.newScrapeLoop(target)
+	p.activeTargets[target.Hash()] = loop
+	p.mtx.Unlock()
+	defer loop.stop(true)
+
+	// Before the first scrape, the status only reports when it is scheduled.
+	st := target.status("job")
+	require.Equal(t, string(HealthUnknown), st.Health)
+	require.True(t, st.LastScrape.IsZero())
+
+	loop.start()
+	require.Eventually(t, func() bool {
+		return !target.status("job").NextScrape.IsZero()
+	}, time.Second, 5*time.Millisecond)
+
+	var status TargetStatus
+	require.Eventually(t, func() bool {
+		var res []TargetStatus
+		for _, tgt := range p.ActiveTargets() {
+			res = append(res, tgt.status("job"))
+		}
+		_, err := river.Marshal(ScraperStatus{TargetStatus: res})
+		require.NoError(t, err)
+
+		status = res[0]
+		return status.Health == string(HealthBad)
+	}, 5*time.Second, 5*time.Millisecond)
+
+	require.Equal(t, "job", status.JobName)
+	require.Equal(t, target.URL(), status.URL)
+	require.Equal(t, map[string]string{"foo": "bar"}, status.Labels)
+	require.Contains(t, status.LastError, "server returned HTTP status (500) boom")
+	require.Equal(t, len("boom"), status.LastScrapeSize)
+	require.GreaterOrEqual(t, status.LastScrapeDuration, 20*time.Millisecond)
+	require.True(t, status.NextScrape.After(status.LastScrape))
+	require.WithinDuration(t, status.LastScrape.Add(args.ScrapeInterval), status.NextScrape, args.ScrapeInterval)
+	require.Empty(t, status.LastPushError)
+	require.True(t, status.LastPush.IsZero())
+}
+
+func TestScrapeLoop_SlowAppender(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"))
+
+	var (
+		fetchTotal = atomic.NewInt64(0)
+		unblock    = make(chan struct{})
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetchTotal.Inc()
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	loop := newScrapeLoop(
+		NewTarget(
+			labels.FromStrings(
+				model.SchemeLabel, "http",
+				model.AddressLabel, strings.TrimPrefix(server.URL, "http://"),
+				ProfilePath, "/debug/pprof/goroutine",
+			), labels.FromStrings(), url.Values{}),
+		server.Client(),
+		pyroscope.AppendableFunc(func(ctx context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-unblock:
+				return nil
+			}
+		}),
+		newMetrics(nil), 50*time.Millisecond, time.Second, util.TestLogger(t))
+	loop.validateProfiles = false
+	loop.pushTimeout = 200 * time.Millisecond
+	defer loop.stop(true)
+
+	loop.start()
+
+	// Scrapes keep happening while pushes are stuck, and the target stays
+	// healthy since fetching profiles succeeds.
+	require.Eventually(t, func() bool {
+		return fetchTotal.Load() > 5 && testutil.ToFloat64(loop.metrics.droppedProfiles) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Equal(t, HealthGood, loop.Health())
+	require.NoError(t, loop.LastError())
+	require.WithinDuration(t, time.Now(), loop.LastScrape(), time.Second)
+
+	// Pushes time out independently of the scrape timeout.
+	require.Eventually(t, func() bool {
+		return errors.Is(loop.LastPushError(), context.DeadlineExceeded)
+	}, 5*time.Second, 50*time.Millisecond)
+	require.GreaterOrEqual(t, loop.LastPushDuration(), 200*time.Millisecond)
+	require.Equal(t, HealthGood, loop.Health())
+
+	// Pushes succeed again once the appender recovers.
+	close(unblock)
+	require.Eventually(t, func() bool {
+		return loop.LastPushError() == nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestScrapeLoop_StopWithPendingPushes(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	loop := newScrapeLoop(
+		NewTarget(
+			labels.FromStrings(
+				model.SchemeLabel, "http",
+				model.AddressLabel, strings.TrimPrefix(server.URL, "http://"),
+				ProfilePath, "/debug/pprof/goroutine",
+			), labels.FromStrings(), url.Values{}),
+		server.Client(),
+		pyroscope.AppendableFunc(func(ctx context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+		newMetrics(nil), 20*time.Millisecond, time.Second, util.TestLogger(t))
+	loop.validateProfiles = false
+	loop.pushTimeout = 500 * time.Millisecond
+
+	loop.start()
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(loop.metrics.droppedProfiles) > 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// The pending pushes share a single push_timeout deadline instead of
+	// timing out one after the other.
+	start := time.Now()
+	loop.stop(true)
+	require.Less(t, time.Since(start), 2*loop.pushTimeout)
+}
+
 func BenchmarkSync(b *testing.B) {
 	args := NewDefaultArguments()
 	args.Targets = []discovery.Target{}
 
-	p, err := newScrapePool(args, pyroscope.AppendableFunc(
+	p, err := newScrapePool("test", args, pyroscope.AppendableFunc(
 		func(ctx context.Context, labels labels.Labels, samples []*pyroscope.RawSample) error {
 			return nil
 		}),
-		log.NewNopLogger())
+		nil, log.NewNopLogger())
 	require.NoError(b, err)
 	groups1 := []*targetgroup.Group{
 		{
@@ -5,13 +5,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/component/discovery"
-	"github.com/grafana/agent/internal/component/prometheus/scrape"
 	"github.com/grafana/agent/internal/component/pyroscope"
 	"github.com/grafana/agent/internal/service/cluster"
 	"github.com/grafana/agent/internal/util"
@@ -44,7 +44,7 @@ func TestComponent(t *testing.T) {
 
 	// trigger an update
 	require.Empty(t, c.appendable.Children())
-	require.Empty(t, c.DebugInfo().(scrape.ScraperStatus).TargetStatus)
+	require.Empty(t, c.DebugInfo().(ScraperStatus).TargetStatus)
 
 	arg.ForwardTo = []pyroscope.Appendable{pyroscope.NoopAppendable}
 	arg.Targets = []discovery.Target{
@@ -56,13 +56,24 @@ func TestComponent(t *testing.T) {
 			model.AddressLabel:  "bar",
 			serviceNameK8SLabel: "k",
 		},
+		{
+			model.AddressLabel:                   "baz",
+			serviceNameLabel:                     "b",
+			profileEnabledLabel(pprofProcessCPU): "false",
+		},
 	}
 	c.Update(arg)
 
 	require.Eventually(t, func() bool {
-		fmt.Println(c.DebugInfo().(scrape.ScraperStatus).TargetStatus)
-		return len(c.appendable.Children()) == 1 && len(c.DebugInfo().(scrape.ScraperStatus).TargetStatus) == 10
+		fmt.Println(c.DebugInfo().(ScraperStatus).TargetStatus)
+		return len(c.appendable.Children()) == 1 && len(c.DebugInfo().(ScraperStatus).TargetStatus) == 14
 	}, 5*time.Second, 100*time.Millisecond)
+
+	dropped := c.DebugInfo().(ScraperStatus).DroppedTargetStatus
+	require.Len(t, dropped, 1)
+	require.Equal(t, "test", dropped[0].JobName)
+	require.Equal(t, "baz", dropped[0].Labels[model.AddressLabel])
+	require.Contains(t, dropped[0].Reason, "disabled by label")
 }
 
 func getServiceData(name string) (interface{}, error) {
@@ -170,6 +181,14 @@ func TestUnmarshalConfig(t *testing.T) {
 				return r
 			},
 		},
+		"invalid push_timeout": {
+			in: `
+			targets    = []
+			forward_to = null
+			push_timeout = "0s"
+			`,
+			expectedErr: "push_timeout must be greater than 0",
+		},
 		"invalid HTTPClientConfig": {
 			in: `
 			targets    = []
@@ -181,6 +200,16 @@ func TestUnmarshalConfig(t *testing.T) {
 			`,
 			expectedErr: "at most one of basic_auth, authorization, oauth2, bearer_token & bearer_token_file must be configured",
 		},
+		"invalid unhealthy targets ratio": {
+			in: `
+			targets    = []
+			forward_to = null
+			health {
+				unhealthy_targets_ratio = 1.5
+			}
+			`,
+			expectedErr: "unhealthy_targets_ratio must be between 0 and 1",
+		},
 	} {
 		tt := tt
 		name := name
@@ -198,6 +227,76 @@ func TestUnmarshalConfig(t *testing.T) {
 	}
 }
 
+func TestUnmarshalConfig_CustomProfiles(t *testing.T) {
+	var arg Arguments
+	require.NoError(t, river.Unmarshal([]byte(`
+		targets    = []
+		forward_to = null
+		params     = { "debug" = ["1"] }
+		profiling_config {
+			profile.custom "lock_contention" {
+				enabled = true
+				path    = "/debug/pprof/lock-contention"
+				params  = { "event" = ["lock"], "debug" = ["0"] }
+			}
+		}
+	`), &arg))
+	require.Equal(t, ProfilingTarget{
+		Enabled: true,
+		Path:    "/debug/pprof/lock-contention",
+		Params:  url.Values{"event": []string{"lock"}, "debug": []string{"0"}},
+	}, arg.ProfilingConfig.AllTargets()["lock_contention"])
+
+	for name, tc := range map[string]struct {
+		custom      string
+		expectedErr string
+	}{
+		"clash with built-in": {
+			custom: `
+				profile.custom "memory" {
+					enabled = true
+					path    = "/debug/pprof/heap"
+				}
+			`,
+			expectedErr: `custom profile "memory" clashes with the built-in profile of the same name`,
+		},
+		"duplicate": {
+			custom: `
+				profile.custom "lock" {
+					enabled = true
+					path    = "/debug/pprof/lock"
+				}
+				profile.custom "lock" {
+					enabled = true
+					path    = "/debug/pprof/lock-contention"
+				}
+			`,
+			expectedErr: `custom profile "lock" is defined more than once`,
+		},
+		"invalid name": {
+			custom: `
+				profile.custom "lock-contention" {
+					enabled = true
+					path    = "/debug/pprof/lock-contention"
+				}
+			`,
+			expectedErr: `invalid custom profile name "lock-contention"`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var arg Arguments
+			err := river.Unmarshal([]byte(`
+				targets    = []
+				forward_to = null
+				profiling_config {
+			`+tc.custom+`
+				}
+			`), &arg)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
 func TestUpdateWhileScraping(t *testing.T) {
 	args := NewDefaultArguments()
 	// speed up reload interval for this tests
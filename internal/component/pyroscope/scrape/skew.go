@@ -0,0 +1,96 @@
+package scrape
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// skewWarningInterval is the minimum time between two warnings about large
+// skews of the same scrape pool.
+const skewWarningInterval = time.Minute
+
+// skewTracker records the skew of the scrapes of a pool, the delay between
+// the time a scrape is scheduled at and the time it starts. Large skews mean
+// that scrape loops can't keep up, for example under CPU pressure.
+type skewTracker struct {
+	pool      string
+	summaries *prometheus.SummaryVec
+	logger    log.Logger
+
+	mut         sync.Mutex // Guards the fields below.
+	job         string
+	threshold   time.Duration
+	lastWarning time.Time
+}
+
+func newSkewTracker(pool string, cfg Arguments, summaries *prometheus.SummaryVec, logger log.Logger) *skewTracker {
+	return &skewTracker{
+		pool:      pool,
+		summaries: summaries,
+		logger:    logger,
+		job:       cfg.JobName,
+		threshold: cfg.ScrapeSkewWarningThreshold,
+	}
+}
+
+// reset drops the skews recorded so far and applies the settings of cfg.
+func (s *skewTracker) reset(cfg Arguments) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.job = cfg.JobName
+	s.threshold = cfg.ScrapeSkewWarningThreshold
+	s.lastWarning = time.Time{}
+	s.summaries.DeleteLabelValues(s.pool)
+}
+
+// observe records the skew of a scrape of target. A warning is logged when
+// skew exceeds the configured threshold, at most once per
+// skewWarningInterval.
+func (s *skewTracker) observe(target string, skew time.Duration) {
+	s.summaries.WithLabelValues(s.pool).Observe(skew.Seconds())
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.threshold <= 0 || skew < s.threshold || time.Since(s.lastWarning) < skewWarningInterval {
+		return
+	}
+	s.lastWarning = time.Now()
+	level.Warn(s.logger).Log("msg", "scrape started late, scrape loops may not keep up with the scrape interval", "job", s.job, "target", target, "skew", skew, "threshold", s.threshold)
+}
+
+// skewStats summarizes the skews recorded by a skewTracker.
+type skewStats struct {
+	count    uint64
+	p50, p99 time.Duration
+}
+
+func (s *skewTracker) stats() skewStats {
+	observer, err := s.summaries.GetMetricWithLabelValues(s.pool)
+	if err != nil {
+		return skewStats{}
+	}
+	var m dto.Metric
+	if err := observer.(prometheus.Metric).Write(&m); err != nil {
+		return skewStats{}
+	}
+
+	stats := skewStats{count: m.GetSummary().GetSampleCount()}
+	if stats.count == 0 {
+		return stats
+	}
+	for _, q := range m.GetSummary().GetQuantile() {
+		value := time.Duration(q.GetValue() * float64(time.Second))
+		switch q.GetQuantile() {
+		case 0.5:
+			stats.p50 = value
+		case 0.99:
+			stats.p99 = value
+		}
+	}
+	return stats
+}
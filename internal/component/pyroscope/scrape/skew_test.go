@@ -0,0 +1,107 @@
+package scrape
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component/pyroscope"
+	"github.com/grafana/agent/internal/util"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/goleak"
+)
+
+func TestScrapeLoop_Skew(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"))
+
+	scrapes := atomic.NewInt64(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Delay the first scrape past several intervals, so that the next one
+		// starts late.
+		if scrapes.Inc() == 1 {
+			time.Sleep(350 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	args := NewDefaultArguments()
+	args.ScrapeInterval = 100 * time.Millisecond
+	p, err := newScrapePool("test", args, pyroscope.NoopAppendable, nil, util.TestLogger(t))
+	require.NoError(t, err)
+
+	p.mtx.Lock()
+	loop := p.newScrapeLoop(NewTarget(
+		labels.FromStrings(
+			model.SchemeLabel, "http",
+			model.AddressLabel, strings.TrimPrefix(server.URL, "http://"),
+			ProfilePath, "/debug/pprof/goroutine",
+		), labels.FromStrings(), url.Values{}))
+	p.mtx.Unlock()
+	defer loop.stop(true)
+
+	loop.start()
+	require.Eventually(t, func() bool {
+		return scrapes.Load() >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := p.skew.stats()
+	require.GreaterOrEqual(t, stats.count, uint64(2))
+	require.GreaterOrEqual(t, stats.p99, 150*time.Millisecond)
+
+	// Reloading the pool resets the recorded skews.
+	loop.stop(true)
+	require.NoError(t, p.reload(args))
+	require.Equal(t, skewStats{}, p.skew.stats())
+}
+
+func TestSkewTracker_Warning(t *testing.T) {
+	var (
+		mut sync.Mutex
+		buf bytes.Buffer
+	)
+	logger := log.LoggerFunc(func(keyvals ...interface{}) error {
+		mut.Lock()
+		defer mut.Unlock()
+		return log.NewLogfmtLogger(&buf).Log(keyvals...)
+	})
+	warnings := func() int {
+		mut.Lock()
+		defer mut.Unlock()
+		return strings.Count(buf.String(), "scrape started late")
+	}
+
+	args := NewDefaultArguments()
+	args.JobName = "my-job"
+	args.ScrapeSkewWarningThreshold = time.Second
+	skew := newSkewTracker("test", args, newMetrics(nil).scrapeSkew, logger)
+
+	skew.observe("target", 100*time.Millisecond)
+	require.Zero(t, warnings())
+
+	// Only a single warning is logged per skewWarningInterval.
+	skew.observe("target", 2*time.Second)
+	skew.observe("target", 3*time.Second)
+	require.Equal(t, 1, warnings())
+	require.Contains(t, buf.String(), "job=my-job")
+
+	stats := skew.stats()
+	require.Equal(t, uint64(3), stats.count)
+	require.Equal(t, 2*time.Second, stats.p50)
+	require.Equal(t, 3*time.Second, stats.p99)
+
+	// Disabling the threshold disables warnings.
+	args.ScrapeSkewWarningThreshold = 0
+	skew.reset(args)
+	skew.observe("target", 2*time.Second)
+	require.Equal(t, 1, warnings())
+}
@@ -53,11 +53,19 @@ type Target struct {
 	params url.Values
 	hash   uint64
 	url    string
+	// Why the target isn't scraped, for dropped targets.
+	dropReason string
 
 	mtx                sync.RWMutex
 	lastError          error
+	unhealthySince     time.Time // Time of the first of the failed scrapes in a row.
 	lastScrape         time.Time
 	lastScrapeDuration time.Duration
+	lastScrapeSize     int
+	nextScrape         time.Time
+	lastPushError      error
+	lastPush           time.Time
+	lastPushDuration   time.Duration
 	health             TargetHealth
 }
 
@@ -179,6 +187,12 @@ func (t *Target) SetDiscoveredLabels(l labels.Labels) {
 	t.discoveredLabels = l
 }
 
+// DropReason returns why the target isn't scraped. It's empty for active
+// targets.
+func (t *Target) DropReason() string {
+	return t.dropReason
+}
+
 // URL returns the target's URL as string.
 func (t *Target) URL() string {
 	return t.url
@@ -208,6 +222,32 @@ func (t *Target) LastScrapeDuration() time.Duration {
 	return t.lastScrapeDuration
 }
 
+// LastPushError returns the error encountered while pushing the last profile
+// downstream.
+func (t *Target) LastPushError() error {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	return t.lastPushError
+}
+
+// LastPush returns the time of the last push.
+func (t *Target) LastPush() time.Time {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	return t.lastPush
+}
+
+// LastPushDuration returns how long the last push of a profile of the target
+// took.
+func (t *Target) LastPushDuration() time.Duration {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	return t.lastPushDuration
+}
+
 // Health returns the last known health state of the target.
 func (t *Target) Health() TargetHealth {
 	t.mtx.RLock()
@@ -216,24 +256,107 @@ func (t *Target) Health() TargetHealth {
 	return t.health
 }
 
+// status returns the status of the target reported in the debug info of the
+// component. The status is copied under lock so that it is consistent even
+// while the target is being scraped.
+func (t *Target) status(jobName string) TargetStatus {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	st := TargetStatus{
+		JobName:            jobName,
+		URL:                t.url,
+		Health:             string(t.health),
+		Labels:             t.discoveredLabels.Map(),
+		LastScrape:         t.lastScrape,
+		LastScrapeDuration: t.lastScrapeDuration,
+		LastScrapeSize:     t.lastScrapeSize,
+		NextScrape:         t.nextScrape,
+		LastPush:           t.lastPush,
+		LastPushDuration:   t.lastPushDuration,
+	}
+	if t.lastError != nil {
+		st.LastError = t.lastError.Error()
+	}
+	if t.lastPushError != nil {
+		st.LastPushError = t.lastPushError.Error()
+	}
+	return st
+}
+
+// droppedStatus returns the status of a dropped target reported in the debug
+// info of the component.
+func (t *Target) droppedStatus(jobName string) DroppedTargetStatus {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+
+	return DroppedTargetStatus{
+		JobName: jobName,
+		URL:     t.url,
+		Labels:  t.discoveredLabels.Map(),
+		Reason:  t.dropReason,
+	}
+}
+
 // LabelsByProfiles returns the labels for a given ProfilingConfig.
 func LabelsByProfiles(lset labels.Labels, c *ProfilingConfig) []labels.Labels {
-	res := []labels.Labels{}
-	add := func(profileType string, cfgs ...ProfilingTarget) {
-		for _, p := range cfgs {
+	res, _ := labelsByProfiles(lset, c)
+	return res
+}
+
+// disabledProfile is a profile type which the labels of a target disable, or
+// enable with an invalid value.
+type disabledProfile struct {
+	lset   labels.Labels
+	reason string
+}
+
+// labelsByProfiles returns the labels of the profile types enabled for the
+// target with the label set lset, as well as the profile types enabled by
+// the ProfilingConfig but disabled for that target by its labels.
+func labelsByProfiles(lset labels.Labels, c *ProfilingConfig) ([]labels.Labels, []disabledProfile) {
+	var (
+		res      = []labels.Labels{}
+		disabled []disabledProfile
+	)
+
+	for profilingType, p := range c.AllTargets() {
+		l := lset.Copy()
+		l = append(l, labels.Label{Name: ProfilePath, Value: p.Path}, labels.Label{Name: ProfileName, Value: profilingType})
+
+		labelName := profileEnabledLabel(profilingType)
+		value := lset.Get(labelName)
+		if value == "" {
 			if p.Enabled {
-				l := lset.Copy()
-				l = append(l, labels.Label{Name: ProfilePath, Value: p.Path}, labels.Label{Name: ProfileName, Value: profileType})
 				res = append(res, l)
 			}
+			continue
 		}
-	}
 
-	for profilingType, profilingConfig := range c.AllTargets() {
-		add(profilingType, profilingConfig)
+		enabled, err := strconv.ParseBool(value)
+		switch {
+		case err != nil:
+			disabled = append(disabled, disabledProfile{
+				lset:   l,
+				reason: fmt.Sprintf("invalid value %q for label %s", value, labelName),
+			})
+		case enabled:
+			res = append(res, l)
+		case p.Enabled:
+			disabled = append(disabled, disabledProfile{
+				lset:   l,
+				reason: fmt.Sprintf("profile type %q disabled by label %s", profilingType, labelName),
+			})
+		}
 	}
 
-	return res
+	return res, disabled
+}
+
+// profileEnabledLabel returns the name of the label which enables or disables
+// the given profile type for a single target.
+func profileEnabledLabel(profileType string) string {
+	return profileEnabledLabelPrefix + profileType + profileEnabledLabelSuffix
 }
 
 // Targets is a sortable list of targets.
@@ -248,6 +371,16 @@ const (
 	ProfileName         = "__name__"
 	serviceNameLabel    = "service_name"
 	serviceNameK8SLabel = "__meta_kubernetes_pod_annotation_pyroscope_io_service_name"
+
+	// Labels of the form __profile_<type>_enabled__ override the enabled
+	// attribute of the profiling_config block for a single target.
+	profileEnabledLabelPrefix = "__profile_"
+	profileEnabledLabelSuffix = "_enabled__"
+
+	// Annotations of Kubernetes pods which set the port and the scheme of
+	// their targets when honor_annotations is set.
+	portAnnotationLabel   = model.MetaLabelPrefix + "kubernetes_pod_annotation_pyroscope_io_port"
+	schemeAnnotationLabel = model.MetaLabelPrefix + "kubernetes_pod_annotation_pyroscope_io_scheme"
 )
 
 // populateLabels builds a label set from the given label set and scrape configuration.
@@ -261,8 +394,17 @@ func populateLabels(lset labels.Labels, cfg Arguments) (res, orig labels.Labels,
 	}
 	lb := labels.NewBuilder(lset)
 
+	// The scheme annotation takes precedence over the scheme of the target
+	// and of the scrape job.
+	if scheme := lset.Get(schemeAnnotationLabel); cfg.HonorAnnotations && scheme != "" {
+		if scheme != "http" && scheme != "https" {
+			return nil, nil, fmt.Errorf("invalid scheme %q in annotation pyroscope.io/scheme", scheme)
+		}
+		lb.Set(model.SchemeLabel, scheme)
+	}
+
 	for _, l := range scrapeLabels {
-		if lv := lset.Get(l.Name); lv == "" {
+		if lv := lb.Get(l.Name); lv == "" {
 			lb.Set(l.Name, l.Value)
 		}
 	}
@@ -301,22 +443,32 @@ func populateLabels(lset labels.Labels, cfg Arguments) (res, orig labels.Labels,
 		return err == nil
 	}
 	addr := lset.Get(model.AddressLabel)
-	// If it's an address with no trailing port, infer it based on the used scheme.
+	// The port annotation replaces the port of the address, if any.
+	if port := lset.Get(portAnnotationLabel); cfg.HonorAnnotations && port != "" {
+		if addr, err = withPort(addr, port); err != nil {
+			return nil, nil, err
+		}
+		lb.Set(model.AddressLabel, addr)
+	}
+	// If it's an address with no trailing port, use the default port or infer
+	// it based on the used scheme.
 	if addPort(addr) {
 		// Addresses reaching this point are already wrapped in [] if necessary.
-		switch lset.Get(model.SchemeLabel) {
-		case "http", "":
+		switch scheme := lset.Get(model.SchemeLabel); {
+		case cfg.DefaultPort != 0:
+			addr = addr + ":" + strconv.Itoa(cfg.DefaultPort)
+		case scheme == "http" || scheme == "":
 			addr = addr + ":80"
-		case "https":
+		case scheme == "https":
 			addr = addr + ":443"
 		default:
-			return nil, nil, fmt.Errorf("invalid scheme: %q", cfg.Scheme)
+			return nil, nil, fmt.Errorf("invalid scheme: %q", scheme)
 		}
 		lb.Set(model.AddressLabel, addr)
 	}
 
 	if err := config.CheckTargetAddress(model.LabelValue(addr)); err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("invalid address: %w", err)
 	}
 
 	// Meta labels are deleted after relabelling. Other internal labels propagate to
@@ -347,14 +499,29 @@ func populateLabels(lset labels.Labels, cfg Arguments) (res, orig labels.Labels,
 	return res, lset, nil
 }
 
-// targetsFromGroup builds targets based on the given TargetGroup, config and target types map.
-func targetsFromGroup(group *targetgroup.Group, cfg Arguments, targetTypes map[string]ProfilingTarget) ([]*Target, []*Target, error) {
+// withPort returns addr with its port, if any, replaced by port.
+func withPort(addr, port string) (string, error) {
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return "", fmt.Errorf("invalid port %q in annotation pyroscope.io/port", port)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		// The address has no port, but IPv6 addresses may still be wrapped in [].
+		host = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// targetsFromGroup builds targets based on the given TargetGroup, config and
+// target types map. Targets whose labels are invalid, for instance because
+// their address can't be parsed, are dropped with the reason why.
+func targetsFromGroup(group *targetgroup.Group, cfg Arguments, targetTypes map[string]ProfilingTarget) ([]*Target, []*Target) {
 	var (
 		targets        = make([]*Target, 0, len(group.Targets))
 		droppedTargets = make([]*Target, 0, len(group.Targets))
 	)
 
-	for i, tlset := range group.Targets {
+	for _, tlset := range group.Targets {
 		lbls := make([]labels.Label, 0, len(tlset)+len(group.Labels))
 
 		for ln, lv := range tlset {
@@ -367,7 +534,11 @@ func targetsFromGroup(group *targetgroup.Group, cfg Arguments, targetTypes map[s
 		}
 
 		lset := labels.New(lbls...)
-		lsets := LabelsByProfiles(lset, &cfg.ProfilingConfig)
+		lsets, disabled := labelsByProfiles(lset, &cfg.ProfilingConfig)
+
+		for _, d := range disabled {
+			droppedTargets = append(droppedTargets, newDroppedTarget(d.lset, d.lset, cfg, d.reason))
+		}
 
 		for _, lset := range lsets {
 			var profType string
@@ -376,35 +547,23 @@ func targetsFromGroup(group *targetgroup.Group, cfg Arguments, targetTypes map[s
 					profType = label.Value
 				}
 			}
-			lbls, origLabels, err := populateLabels(lset, cfg)
+			// Params are encoded as labels, so the params of the profile type
+			// must be set before populating them.
+			params := targetParams(cfg.Params, targetTypes[profType].Params)
+			profileCfg := cfg
+			profileCfg.Params = params
+
+			lbls, origLabels, err := populateLabels(lset, profileCfg)
 			if err != nil {
-				return nil, nil, fmt.Errorf("instance %d in group %s: %s", i, group, err)
+				droppedTargets = append(droppedTargets, newDroppedTarget(lset, lset, cfg, err.Error()))
+				continue
 			}
 			// This is a dropped target, according to the current return behaviour of populateLabels
 			if lbls == nil && origLabels != nil {
-				// ensure we get the full url path for dropped targets
-				params := cfg.Params
-				if params == nil {
-					params = url.Values{}
-				}
-				lbls = append(lbls, labels.Label{Name: model.AddressLabel, Value: lset.Get(model.AddressLabel)})
-				lbls = append(lbls, labels.Label{Name: model.SchemeLabel, Value: cfg.Scheme})
-				lbls = append(lbls, labels.Label{Name: ProfilePath, Value: lset.Get(ProfilePath)})
-				// Encode scrape query parameters as labels.
-				for k, v := range cfg.Params {
-					if len(v) > 0 {
-						lbls = append(lbls, labels.Label{Name: model.ParamLabelPrefix + k, Value: v[0]})
-					}
-				}
-				droppedTargets = append(droppedTargets, NewTarget(lbls, origLabels, params))
+				droppedTargets = append(droppedTargets, newDroppedTarget(lset, origLabels, cfg, "dropped by relabeling"))
 				continue
 			}
 			if lbls != nil || origLabels != nil {
-				params := cfg.Params
-				if params == nil {
-					params = url.Values{}
-				}
-
 				if pcfg, found := targetTypes[profType]; found && pcfg.Delta {
 					params.Add("seconds", strconv.Itoa(int((cfg.ScrapeInterval)/time.Second)-1))
 				}
@@ -413,7 +572,44 @@ func targetsFromGroup(group *targetgroup.Group, cfg Arguments, targetTypes map[s
 		}
 	}
 
-	return targets, droppedTargets, nil
+	return targets, droppedTargets
+}
+
+// targetParams returns a copy of the params of a scrape job, with the params
+// of a profile type taking precedence.
+func targetParams(jobParams, profileParams url.Values) url.Values {
+	params := make(url.Values, len(jobParams)+len(profileParams))
+	for k, v := range jobParams {
+		params[k] = append([]string(nil), v...)
+	}
+	for k, v := range profileParams {
+		params[k] = append([]string(nil), v...)
+	}
+	return params
+}
+
+// newDroppedTarget creates a target which won't be scraped for the given
+// reason. Its labels only hold what's needed to build the full URL that would
+// have been scraped.
+func newDroppedTarget(lset, origLabels labels.Labels, cfg Arguments, reason string) *Target {
+	params := cfg.Params
+	if params == nil {
+		params = url.Values{}
+	}
+	lbls := labels.Labels{
+		{Name: model.AddressLabel, Value: lset.Get(model.AddressLabel)},
+		{Name: model.SchemeLabel, Value: cfg.Scheme},
+		{Name: ProfilePath, Value: lset.Get(ProfilePath)},
+	}
+	// Encode scrape query parameters as labels.
+	for k, v := range cfg.Params {
+		if len(v) > 0 {
+			lbls = append(lbls, labels.Label{Name: model.ParamLabelPrefix + k, Value: v[0]})
+		}
+	}
+	t := NewTarget(lbls, origLabels, params)
+	t.dropReason = reason
+	return t
 }
 
 func inferServiceName(lset labels.Labels) string {
@@ -8,6 +8,7 @@ import (
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/discovery/targetgroup"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,7 +18,7 @@ func Test_targetsFromGroup(t *testing.T) {
 	args.ProfilingConfig.Goroutine.Enabled = false
 	args.ProfilingConfig.Mutex.Enabled = false
 
-	active, dropped, err := targetsFromGroup(&targetgroup.Group{
+	active, dropped := targetsFromGroup(&targetgroup.Group{
 		Targets: []model.LabelSet{
 			{model.AddressLabel: "localhost:9090"},
 			{model.AddressLabel: "localhost:9091", serviceNameLabel: "svc"},
@@ -230,9 +231,188 @@ func Test_targetsFromGroup(t *testing.T) {
 			}),
 			url.Values{"seconds": []string{"14"}}),
 	}
-	require.NoError(t, err)
 	sort.Sort(Targets(active))
 	sort.Sort(Targets(expected))
 	require.Equal(t, expected, active)
 	require.Empty(t, dropped)
 }
+
+func Test_targetsFromGroup_profileEnabledLabels(t *testing.T) {
+	args := NewDefaultArguments()
+	args.ProfilingConfig.Memory.Enabled = false
+	args.ProfilingConfig.Block.Enabled = false
+	args.ProfilingConfig.Goroutine.Enabled = false
+	args.ProfilingConfig.Mutex.Enabled = false
+
+	// Disable CPU profiling for the targets of the "batch" container only, as
+	// a discovery.relabel rule would.
+	rule := &relabel.Config{
+		SourceLabels: model.LabelNames{"__meta_kubernetes_pod_container_name"},
+		Regex:        relabel.MustNewRegexp("batch"),
+		Action:       relabel.Replace,
+		TargetLabel:  profileEnabledLabel(pprofProcessCPU),
+		Replacement:  "false",
+	}
+	group := &targetgroup.Group{}
+	for _, lset := range []labels.Labels{
+		labels.FromStrings(model.AddressLabel, "localhost:9090", "__meta_kubernetes_pod_container_name", "server", serviceNameLabel, "server"),
+		labels.FromStrings(model.AddressLabel, "localhost:9091", "__meta_kubernetes_pod_container_name", "batch", serviceNameLabel, "batch"),
+	} {
+		lset, keep := relabel.Process(lset, rule)
+		require.True(t, keep)
+
+		tlset := model.LabelSet{}
+		lset.Range(func(l labels.Label) {
+			tlset[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+		})
+		group.Targets = append(group.Targets, tlset)
+	}
+	// Enable memory profiling for the "server" container only.
+	group.Targets[0][model.LabelName(profileEnabledLabel(pprofMemory))] = "true"
+
+	active, dropped := targetsFromGroup(group, args, args.ProfilingConfig.AllTargets())
+
+	var activeURLs []string
+	for _, tgt := range active {
+		activeURLs = append(activeURLs, tgt.URL())
+	}
+	require.ElementsMatch(t, []string{
+		"http://localhost:9090/debug/pprof/allocs",
+		"http://localhost:9090/debug/pprof/profile?seconds=14",
+	}, activeURLs)
+
+	require.Len(t, dropped, 1)
+	require.Equal(t, "http://localhost:9091/debug/pprof/profile", dropped[0].URL())
+	require.Equal(t, `profile type "process_cpu" disabled by label __profile_process_cpu_enabled__`, dropped[0].DropReason())
+	require.Equal(t, "batch", dropped[0].DiscoveredLabels().Get("__meta_kubernetes_pod_container_name"))
+}
+
+func Test_targetsFromGroup_invalidProfileEnabledLabel(t *testing.T) {
+	args := NewDefaultArguments()
+
+	active, dropped := targetsFromGroup(&targetgroup.Group{
+		Targets: []model.LabelSet{
+			{model.AddressLabel: "localhost:9090", "__profile_mutex_enabled__": "maybe"},
+		},
+	}, args, args.ProfilingConfig.AllTargets())
+	require.Len(t, active, len(LabelsByProfiles(labels.FromStrings(model.AddressLabel, "localhost:9090"), &args.ProfilingConfig))-1)
+
+	require.Len(t, dropped, 1)
+	require.Equal(t, "http://localhost:9090/debug/pprof/mutex", dropped[0].URL())
+	require.Equal(t, `invalid value "maybe" for label __profile_mutex_enabled__`, dropped[0].DropReason())
+}
+
+func Test_targetsFromGroup_portAndSchemeInference(t *testing.T) {
+	const (
+		portAnnotation   = "__meta_kubernetes_pod_annotation_pyroscope_io_port"
+		schemeAnnotation = "__meta_kubernetes_pod_annotation_pyroscope_io_scheme"
+	)
+	tt := []struct {
+		name             string
+		target           model.LabelSet
+		defaultPort      int
+		honorAnnotations bool
+		expectedURL      string
+	}{
+		{
+			name:        "port inferred from scheme",
+			target:      model.LabelSet{model.AddressLabel: "localhost"},
+			expectedURL: "http://localhost:80/debug/pprof/allocs",
+		},
+		{
+			name:        "port inferred from target scheme",
+			target:      model.LabelSet{model.AddressLabel: "localhost", model.SchemeLabel: "https"},
+			expectedURL: "https://localhost:443/debug/pprof/allocs",
+		},
+		{
+			name:        "default port takes precedence over scheme",
+			target:      model.LabelSet{model.AddressLabel: "localhost", model.SchemeLabel: "https"},
+			defaultPort: 4040,
+			expectedURL: "https://localhost:4040/debug/pprof/allocs",
+		},
+		{
+			name:        "address port takes precedence over default port",
+			target:      model.LabelSet{model.AddressLabel: "localhost:9090"},
+			defaultPort: 4040,
+			expectedURL: "http://localhost:9090/debug/pprof/allocs",
+		},
+		{
+			name:        "default port for IPv6 address",
+			target:      model.LabelSet{model.AddressLabel: "[::1]"},
+			defaultPort: 4040,
+			expectedURL: "http://[::1]:4040/debug/pprof/allocs",
+		},
+		{
+			name:        "annotations ignored by default",
+			target:      model.LabelSet{model.AddressLabel: "localhost:9090", portAnnotation: "6060", schemeAnnotation: "https"},
+			expectedURL: "http://localhost:9090/debug/pprof/allocs",
+		},
+		{
+			name:             "port annotation takes precedence over address port",
+			target:           model.LabelSet{model.AddressLabel: "localhost:9090", portAnnotation: "6060"},
+			defaultPort:      4040,
+			honorAnnotations: true,
+			expectedURL:      "http://localhost:6060/debug/pprof/allocs",
+		},
+		{
+			name:             "port annotation for IPv6 address",
+			target:           model.LabelSet{model.AddressLabel: "[::1]", portAnnotation: "6060"},
+			honorAnnotations: true,
+			expectedURL:      "http://[::1]:6060/debug/pprof/allocs",
+		},
+		{
+			name:             "scheme annotation takes precedence over target scheme",
+			target:           model.LabelSet{model.AddressLabel: "localhost", model.SchemeLabel: "http", schemeAnnotation: "https"},
+			honorAnnotations: true,
+			expectedURL:      "https://localhost:443/debug/pprof/allocs",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			args := NewDefaultArguments()
+			args.DefaultPort = tc.defaultPort
+			args.HonorAnnotations = tc.honorAnnotations
+			args.ProfilingConfig.ProcessCPU.Enabled = false
+			args.ProfilingConfig.Block.Enabled = false
+			args.ProfilingConfig.Goroutine.Enabled = false
+			args.ProfilingConfig.Mutex.Enabled = false
+
+			active, dropped := targetsFromGroup(&targetgroup.Group{
+				Targets: []model.LabelSet{tc.target},
+			}, args, args.ProfilingConfig.AllTargets())
+			require.Empty(t, dropped)
+			require.Len(t, active, 1)
+			require.Equal(t, tc.expectedURL, active[0].URL())
+		})
+	}
+}
+
+func Test_targetsFromGroup_invalidTargets(t *testing.T) {
+	args := NewDefaultArguments()
+	args.HonorAnnotations = true
+	args.ProfilingConfig.ProcessCPU.Enabled = false
+	args.ProfilingConfig.Block.Enabled = false
+	args.ProfilingConfig.Goroutine.Enabled = false
+	args.ProfilingConfig.Mutex.Enabled = false
+
+	active, dropped := targetsFromGroup(&targetgroup.Group{
+		Targets: []model.LabelSet{
+			{model.AddressLabel: "localhost:9090"},
+			{model.AddressLabel: "localhost/metrics"},
+			{model.AddressLabel: "localhost:9091", "__meta_kubernetes_pod_annotation_pyroscope_io_port": "http"},
+			{model.AddressLabel: "localhost:9092", "__meta_kubernetes_pod_annotation_pyroscope_io_scheme": "ftp"},
+		},
+	}, args, args.ProfilingConfig.AllTargets())
+
+	// Invalid targets don't prevent the other targets of the group from
+	// being scraped.
+	require.Len(t, active, 1)
+	require.Equal(t, "http://localhost:9090/debug/pprof/allocs", active[0].URL())
+
+	require.Len(t, dropped, 3)
+	require.Contains(t, dropped[0].DropReason(), "invalid address")
+	require.Contains(t, dropped[0].DropReason(), "is not a valid hostname")
+	require.Equal(t, `invalid port "http" in annotation pyroscope.io/port`, dropped[1].DropReason())
+	require.Equal(t, `invalid scheme "ftp" in annotation pyroscope.io/scheme`, dropped[2].DropReason())
+	require.Equal(t, "localhost:9092", dropped[2].DiscoveredLabels().Get(model.AddressLabel))
+}
@@ -0,0 +1,222 @@
+package scrape
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-conntrack"
+	commonconfig "github.com/prometheus/common/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// newScrapeClient creates the client fetching profiles from the targets of a
+// pool.
+//
+// It mirrors commonconfig.NewClientFromConfig, whose transport always keeps
+// up to 1000 idle connections per host and can't be forced to use HTTP/2, so
+// that the transport block can configure them.
+func newScrapeClient(cfg Arguments) (*http.Client, error) {
+	httpCfg := *cfg.HTTPClientConfig.Convert()
+	rt, err := newScrapeRoundTripper(httpCfg, cfg.JobName, cfg.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: rt}
+	if !httpCfg.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client, nil
+}
+
+// newScrapeRoundTripper creates the transport of the scrape client of a pool,
+// wrapped with the round trippers authenticating requests as configured by
+// cfg. name is used to label the connection metrics of the pool.
+func newScrapeRoundTripper(cfg commonconfig.HTTPClientConfig, name string, args TransportArguments) (http.RoundTripper, error) {
+	dialContext := conntrack.NewDialContextFunc(
+		conntrack.DialWithTracing(),
+		conntrack.DialWithName(name))
+
+	newRT := func(tlsConfig *tls.Config) (http.RoundTripper, error) {
+		// Requests are bounded by the scrape timeout, so no other timeout is
+		// set here.
+		transport := &http.Transport{
+			Proxy:                 cfg.ProxyConfig.Proxy(),
+			ProxyConnectHeader:    cfg.ProxyConfig.GetProxyConnectHeader(),
+			MaxIdleConns:          20000,
+			MaxIdleConnsPerHost:   args.MaxIdleConnsPerHost,
+			TLSClientConfig:       tlsConfig,
+			DisableCompression:    true,
+			IdleConnTimeout:       args.IdleConnTimeout,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			DialContext:           dialContext,
+		}
+
+		var rt http.RoundTripper = transport
+		if cfg.EnableHTTP2 {
+			http2t, err := http2.ConfigureTransports(transport)
+			if err != nil {
+				return nil, err
+			}
+			// Close connections to targets which stopped responding, see
+			// https://github.com/golang/go/issues/32388.
+			http2t.ReadIdleTimeout = time.Minute
+
+			if args.ForceHTTP2 {
+				// Only offer HTTP/2 when negotiating TLS, so that targets
+				// without HTTP/2 support fail the handshake.
+				transport.TLSClientConfig.NextProtos = []string{http2.NextProtoTLS}
+				rt = &forceHTTP2RoundTripper{next: rt}
+			}
+		}
+
+		if cfg.Authorization != nil && len(cfg.Authorization.CredentialsFile) > 0 {
+			rt = commonconfig.NewAuthorizationCredentialsFileRoundTripper(cfg.Authorization.Type, cfg.Authorization.CredentialsFile, rt)
+		} else if cfg.Authorization != nil {
+			rt = commonconfig.NewAuthorizationCredentialsRoundTripper(cfg.Authorization.Type, cfg.Authorization.Credentials, rt)
+		}
+		if len(cfg.BearerToken) > 0 {
+			rt = commonconfig.NewAuthorizationCredentialsRoundTripper("Bearer", cfg.BearerToken, rt)
+		} else if len(cfg.BearerTokenFile) > 0 {
+			rt = commonconfig.NewAuthorizationCredentialsFileRoundTripper("Bearer", cfg.BearerTokenFile, rt)
+		}
+		if cfg.BasicAuth != nil {
+			rt = commonconfig.NewBasicAuthRoundTripper(cfg.BasicAuth.Username, cfg.BasicAuth.Password, cfg.BasicAuth.UsernameFile, cfg.BasicAuth.PasswordFile, rt)
+		}
+		if cfg.OAuth2 != nil {
+			var err error
+			if rt, err = newOAuth2RoundTripper(cfg.OAuth2, rt, name); err != nil {
+				return nil, err
+			}
+		}
+		return rt, nil
+	}
+
+	tlsConfig, err := commonconfig.NewTLSConfig(&cfg.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.TLSConfig.CAFile) == 0 {
+		return newRT(tlsConfig)
+	}
+	// Reload the CA file when it changes.
+	return commonconfig.NewTLSRoundTripper(tlsConfig, commonconfig.TLSRoundTripperSettings{
+		CA:       cfg.TLSConfig.CA,
+		CAFile:   cfg.TLSConfig.CAFile,
+		Cert:     cfg.TLSConfig.Cert,
+		CertFile: cfg.TLSConfig.CertFile,
+		Key:      string(cfg.TLSConfig.Key),
+		KeyFile:  cfg.TLSConfig.KeyFile,
+	}, newRT)
+}
+
+// forceHTTP2RoundTripper rejects the responses of targets scraped over TLS
+// which weren't served with HTTP/2. Targets whose TLS servers don't negotiate
+// any application protocol are otherwise scraped with HTTP/1.1.
+type forceHTTP2RoundTripper struct {
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *forceHTTP2RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil || req.URL.Scheme != "https" || resp.ProtoMajor == 2 {
+		return resp, err
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("force_http2 is set but the target responded with %s", resp.Proto)
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (rt *forceHTTP2RoundTripper) CloseIdleConnections() {
+	if ci, ok := rt.next.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// oauth2RoundTripper authenticates requests with the OAuth2 client
+// credentials flow, like the round tripper of prometheus/common, which can't
+// be created outside of commonconfig.NewRoundTripperFromConfig. The client
+// secret file is read again on each request, so that a rotated secret is
+// used to fetch the next tokens.
+type oauth2RoundTripper struct {
+	config      *commonconfig.OAuth2
+	next        http.RoundTripper
+	tokenClient *http.Client
+
+	mut    sync.RWMutex
+	secret string
+	rt     http.RoundTripper
+}
+
+func newOAuth2RoundTripper(config *commonconfig.OAuth2, next http.RoundTripper, name string) (*oauth2RoundTripper, error) {
+	// Tokens are fetched with the TLS and proxy settings of the oauth2 block.
+	tokenClient, err := commonconfig.NewClientFromConfig(commonconfig.HTTPClientConfig{
+		TLSConfig:       config.TLSConfig,
+		ProxyConfig:     config.ProxyConfig,
+		FollowRedirects: true,
+	}, name+"_oauth2")
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2RoundTripper{config: config, next: next, tokenClient: tokenClient}, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *oauth2RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	secret := string(rt.config.ClientSecret)
+	if rt.config.ClientSecretFile != "" {
+		data, err := os.ReadFile(rt.config.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read oauth2 client secret file %s: %w", rt.config.ClientSecretFile, err)
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+
+	rt.mut.RLock()
+	current := rt.rt
+	changed := current == nil || secret != rt.secret
+	rt.mut.RUnlock()
+
+	if changed {
+		endpointParams := url.Values{}
+		for name, value := range rt.config.EndpointParams {
+			endpointParams.Set(name, value)
+		}
+		config := &clientcredentials.Config{
+			ClientID:       rt.config.ClientID,
+			ClientSecret:   secret,
+			Scopes:         rt.config.Scopes,
+			TokenURL:       rt.config.TokenURL,
+			EndpointParams: endpointParams,
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, rt.tokenClient)
+		current = &oauth2.Transport{Base: rt.next, Source: config.TokenSource(ctx)}
+
+		rt.mut.Lock()
+		rt.secret, rt.rt = secret, current
+		rt.mut.Unlock()
+	}
+	return current.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport
+// and of the client fetching tokens.
+func (rt *oauth2RoundTripper) CloseIdleConnections() {
+	rt.tokenClient.CloseIdleConnections()
+	if ci, ok := rt.next.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
@@ -55,6 +55,17 @@ type Module interface {
 	Run(context.Context) error
 }
 
+// LastKnownGoodModule is a Module which persists the last config it loaded
+// without errors, so that it can be loaded again when the config can't be
+// retrieved.
+type LastKnownGoodModule interface {
+	Module
+
+	// LoadLastKnownGood loads the last config loaded without errors by a
+	// Module with the same ID, including by a previous process.
+	LoadLastKnownGood(args map[string]any) error
+}
+
 // ExportFunc is used for onExport of the Module
 type ExportFunc func(exports map[string]any)
 
@@ -0,0 +1,65 @@
+package component
+
+import (
+	"fmt"
+
+	"github.com/grafana/river/rivertypes"
+)
+
+// Secret is an exported secret which is never stored by the Flow controller.
+// Only a handle to the secret is cached along with the other exports of the
+// component; the secret is read from the component each time a dependant
+// decodes it into a rivertypes.Secret or rivertypes.OptionalSecret.
+//
+// Secret values are opaque: they can't be converted to strings and are never
+// included when exports are encoded for debugging.
+//
+// Components must export a new Secret, created with NewSecret, when the value
+// of the secret changes so that dependants are evaluated again.
+type Secret struct {
+	h *secretHandle
+}
+
+type secretHandle struct {
+	read func() rivertypes.Secret
+}
+
+var (
+	_ fmt.Stringer   = Secret{}
+	_ fmt.GoStringer = Secret{}
+)
+
+// NewSecret returns a Secret whose value is returned by read.
+func NewSecret(read func() rivertypes.Secret) Secret {
+	return Secret{h: &secretHandle{read: read}}
+}
+
+// Read returns the value of the secret. The zero Secret is empty.
+func (s Secret) Read() rivertypes.Secret {
+	if s.h == nil {
+		return ""
+	}
+	return s.h.read()
+}
+
+// RiverCapsule marks Secret as a River capsule.
+func (Secret) RiverCapsule() {}
+
+// ConvertInto converts the Secret into the secret types of River.
+func (s Secret) ConvertInto(dst interface{}) error {
+	switch dst := dst.(type) {
+	case *rivertypes.Secret:
+		*dst = s.Read()
+		return nil
+	case *rivertypes.OptionalSecret:
+		*dst = rivertypes.OptionalSecret{IsSecret: true, Value: string(s.Read())}
+		return nil
+	}
+	return fmt.Errorf("secret can't be converted into %T", dst)
+}
+
+// String implements fmt.Stringer without revealing the secret.
+func (Secret) String() string { return "(secret)" }
+
+// GoString implements fmt.GoStringer without revealing the secret.
+func (Secret) GoString() string { return "(secret)" }
@@ -0,0 +1,53 @@
+package flow
+
+import (
+	"sort"
+	"time"
+)
+
+// ConfigStatus describes the config most recently applied by a controller
+// and by the modules it runs.
+type ConfigStatus struct {
+	// ModuleID is the ID of the module, empty for the root controller.
+	ModuleID string `json:"moduleID,omitempty"`
+	// Fingerprint identifies the applied config. Configs which only differ by
+	// whitespace, comments, or the order of their blocks have the same
+	// fingerprint.
+	Fingerprint string `json:"fingerprint"`
+	// Generation is the number of times a config was applied, zero if none
+	// was applied yet.
+	Generation  uint64         `json:"generation"`
+	AppliedAt   time.Time      `json:"appliedAt"`
+	Diagnostics int            `json:"diagnostics"`
+	Modules     []ConfigStatus `json:"modules,omitempty"`
+}
+
+// ConfigStatus returns the status of the config applied by f, with the
+// status of the modules created by its components nested under it.
+func (f *Flow) ConfigStatus() ConfigStatus {
+	f.loadMut.RLock()
+	defer f.loadMut.RUnlock()
+
+	info := f.loader.ApplyInfo()
+	status := ConfigStatus{
+		ModuleID:    f.opts.ControllerID,
+		Fingerprint: info.Fingerprint,
+		Generation:  info.Generation,
+		AppliedAt:   info.Timestamp,
+		Diagnostics: info.Diagnostics,
+	}
+
+	for _, cn := range f.loader.Components() {
+		for _, id := range cn.ModuleIDs() {
+			mod, ok := f.modules.Get(id)
+			if !ok {
+				continue
+			}
+			status.Modules = append(status.Modules, mod.f.ConfigStatus())
+		}
+	}
+	sort.Slice(status.Modules, func(i, j int) bool {
+		return status.Modules[i].ModuleID < status.Modules[j].ModuleID
+	})
+	return status
+}
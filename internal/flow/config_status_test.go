@@ -0,0 +1,61 @@
+package flow_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/flow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigStatus(t *testing.T) {
+	config := `
+		declare "test" {
+			export "output" {
+				value = 1
+			}
+		}
+
+		test "a" {}
+		test "b" {}
+	`
+
+	ctrl := flow.New(testOptions(t))
+	require.Zero(t, ctrl.ConfigStatus().Generation)
+
+	f, err := flow.ParseSource(t.Name(), []byte(config))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Each custom component runs its own config, nested under the root one.
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		status := ctrl.ConfigStatus()
+		assert.Equal(c, uint64(1), status.Generation)
+		assert.NotEmpty(c, status.Fingerprint)
+		if !assert.Len(c, status.Modules, 2) {
+			return
+		}
+		for i, id := range []string{"test.a", "test.b"} {
+			assert.Equal(c, id, status.Modules[i].ModuleID)
+			assert.Equal(c, uint64(1), status.Modules[i].Generation)
+			assert.NotEqual(c, status.Fingerprint, status.Modules[i].Fingerprint)
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Both custom components load the same template.
+	status := ctrl.ConfigStatus()
+	require.Equal(t, status.Modules[0].Fingerprint, status.Modules[1].Fingerprint)
+}
@@ -4,14 +4,19 @@ import (
 	"context"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/featuregate"
 	"github.com/grafana/agent/internal/flow"
+	"github.com/grafana/agent/internal/flow/internal/controller"
 	"github.com/grafana/agent/internal/flow/internal/testcomponents"
 	"github.com/grafana/agent/internal/flow/logging"
 	"github.com/grafana/agent/internal/service"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -55,6 +60,39 @@ func TestDeclare(t *testing.T) {
 			`,
 			expected: 10,
 		},
+		{
+			name: "AliasedDeclare",
+			config: `
+			declare "renamed" {
+				argument "input" {
+					optional = false
+				}
+
+				export "output" {
+					value = argument.input.value
+				}
+			}
+
+			alias "test" {
+				from = "test"
+				to   = "renamed"
+			}
+
+			testcomponents.count "inc" {
+				frequency = "10ms"
+				max = 10
+			}
+
+			test "myModule" {
+				input = testcomponents.count.inc.count
+			}
+
+			testcomponents.summation "sum" {
+				input = test.myModule.output
+			}
+			`,
+			expected: 10,
+		},
 		{
 			name: "NestedDeclares",
 			config: `
@@ -513,3 +551,225 @@ func TestDeclareUpdateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestDeclareMetrics(t *testing.T) {
+	config := `
+		declare "test" {
+			export "output" {
+				value = 1
+			}
+		}
+
+		test "a" {}
+		test "b" {}
+	`
+	updatedConfig := `
+		declare "test" {
+			export "output" {
+				value = 2
+			}
+		}
+
+		test "a" {}
+		test "b" {}
+	`
+
+	reg := prometheus.NewRegistry()
+	opts := testOptions(t)
+	opts.Reg = reg
+	ctrl := flow.New(opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	load := func(config string) {
+		f, err := flow.ParseSource(t.Name(), []byte(config))
+		require.NoError(t, err)
+		require.NoError(t, ctrl.LoadSource(f, nil))
+	}
+
+	metricNames := []string{
+		"agent_component_controller_custom_component_instantiations_total",
+		"agent_component_controller_custom_component_reinstantiations_total",
+		"agent_component_controller_running_custom_components",
+	}
+
+	load(config)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP agent_component_controller_custom_component_instantiations_total Number of custom components created from a declare block
+		# TYPE agent_component_controller_custom_component_instantiations_total counter
+		agent_component_controller_custom_component_instantiations_total{controller_id="",controller_path="/",declare="test"} 2
+		# HELP agent_component_controller_running_custom_components Number of running custom components per declare block.
+		# TYPE agent_component_controller_running_custom_components gauge
+		agent_component_controller_running_custom_components{controller_id="",controller_path="/",declare="test"} 2
+	`), metricNames...))
+
+	// Reloading the same config reuses the existing custom components.
+	load(config)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP agent_component_controller_custom_component_instantiations_total Number of custom components created from a declare block
+		# TYPE agent_component_controller_custom_component_instantiations_total counter
+		agent_component_controller_custom_component_instantiations_total{controller_id="",controller_path="/",declare="test"} 2
+		# HELP agent_component_controller_running_custom_components Number of running custom components per declare block.
+		# TYPE agent_component_controller_running_custom_components gauge
+		agent_component_controller_running_custom_components{controller_id="",controller_path="/",declare="test"} 2
+	`), metricNames...))
+
+	// Changing the declare block reloads both instances.
+	load(updatedConfig)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP agent_component_controller_custom_component_instantiations_total Number of custom components created from a declare block
+		# TYPE agent_component_controller_custom_component_instantiations_total counter
+		agent_component_controller_custom_component_instantiations_total{controller_id="",controller_path="/",declare="test"} 2
+		# HELP agent_component_controller_custom_component_reinstantiations_total Number of times a running custom component was reloaded because its declare block changed
+		# TYPE agent_component_controller_custom_component_reinstantiations_total counter
+		agent_component_controller_custom_component_reinstantiations_total{controller_id="",controller_path="/",declare="test"} 2
+		# HELP agent_component_controller_running_custom_components Number of running custom components per declare block.
+		# TYPE agent_component_controller_running_custom_components gauge
+		agent_component_controller_running_custom_components{controller_id="",controller_path="/",declare="test"} 2
+	`), metricNames...))
+}
+
+func TestDeclareFailingInstance(t *testing.T) {
+	config := `
+		declare "test" {
+			argument "input" {
+				optional = false
+			}
+			argument "lag" {
+				optional = false
+			}
+
+			testcomponents.passthrough "pt" {
+				input = argument.input.value
+				lag = argument.lag.value
+			}
+
+			export "output" {
+				value = testcomponents.passthrough.pt.output
+			}
+		}
+		testcomponents.count "inc" {
+			frequency = "10ms"
+			max = 10
+		}
+
+		test "good" {
+			input = testcomponents.count.inc.count
+			lag = "1ms"
+		}
+		test "bad" {
+			input = testcomponents.count.inc.count
+			lag = "not a duration"
+		}
+
+		testcomponents.summation "sum" {
+			input = test.good.output
+		}
+	`
+
+	ctrl := flow.New(testOptions(t))
+	f, err := flow.ParseSource(t.Name(), []byte(config))
+	require.NoError(t, err)
+
+	// The bad instance doesn't fail the load of the parent.
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	require.Eventually(t, func() bool {
+		export := getExport[testcomponents.SummationExports](t, ctrl, "", "testcomponents.summation.sum")
+		return export.LastAdded == 10
+	}, 3*time.Second, 10*time.Millisecond)
+
+	health := func(id string) component.Health {
+		info, err := ctrl.GetComponent(component.ID{LocalID: id}, component.InfoOptions{GetHealth: true})
+		require.NoError(t, err)
+		return info.Health
+	}
+	require.Equal(t, component.HealthTypeHealthy, health("test.good").Health)
+
+	bad := health("test.bad")
+	require.Equal(t, component.HealthTypeUnhealthy, bad.Health)
+	require.Contains(t, bad.Message, "testcomponents.passthrough.pt")
+}
+
+func TestDeclareArgumentsDebugInfo(t *testing.T) {
+	config := `
+		declare "test" {
+			argument "input" {
+				optional = false
+			}
+			argument "lag" {
+				optional = true
+				default = "1ms"
+			}
+			argument "prefix" {
+				optional = true
+				default = "default-"
+			}
+			argument "token" {
+				optional = true
+			}
+
+			testcomponents.passthrough "pt" {
+				input = argument.input.value
+				lag = argument.lag.value
+			}
+		}
+
+		testcomponents.secret "token" {
+			value = "hunter2"
+		}
+
+		test "myModule" {
+			input = "a"
+			prefix = "supplied-"
+			token = testcomponents.secret.token.value
+		}
+	`
+
+	ctrl := flow.New(testOptions(t))
+	f, err := flow.ParseSource(t.Name(), []byte(config))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	info, err := ctrl.GetComponent(component.ID{LocalID: "test.myModule"}, component.InfoOptions{GetDebugInfo: true})
+	require.NoError(t, err)
+	require.Equal(t, controller.CustomComponentDebugInfo{
+		Arguments: []controller.ModuleArgument{
+			{Name: "input", Source: controller.ArgumentSourceSupplied, Value: "a"},
+			{Name: "lag", Source: controller.ArgumentSourceDefault, Value: "1ms"},
+			{Name: "prefix", Source: controller.ArgumentSourceSupplied, Value: "supplied-"},
+			{Name: "token", Source: controller.ArgumentSourceSupplied, Value: "(secret)"},
+		},
+	}, info.DebugInfo)
+
+	// Supplying an argument on reload replaces its default.
+	f, err = flow.ParseSource(t.Name(), []byte(strings.Replace(config, `input = "a"`, `input = "a"
+			lag = "5ms"`, 1)))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	info, err = ctrl.GetComponent(component.ID{LocalID: "test.myModule"}, component.InfoOptions{GetDebugInfo: true})
+	require.NoError(t, err)
+	require.Contains(t, info.DebugInfo.(controller.CustomComponentDebugInfo).Arguments,
+		controller.ModuleArgument{Name: "lag", Source: controller.ArgumentSourceSupplied, Value: "5ms"})
+}
@@ -47,6 +47,7 @@ package flow
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -101,6 +102,58 @@ type Options struct {
 	// loaded config source.
 	OnExportsChange func(exports map[string]any)
 
+	// GoroutineLeakCheckDelay enables goroutine leak detection when non-zero.
+	// Goroutines which are still running GoroutineLeakCheckDelay after the
+	// component that launched them was removed are reported through logs and
+	// metrics.
+	GoroutineLeakCheckDelay time.Duration
+
+	// MinUpdateInterval is the minimum time between two evaluations of the
+	// dependants of a component caused by changes of its exports. Changes
+	// within the interval are coalesced and propagated at the end of the
+	// interval with the latest exports. Updates of unhealthy components are
+	// never delayed. Disabled when zero.
+	MinUpdateInterval time.Duration
+
+	// RetryMaxBackoff enables the retries of nodes which fail evaluation,
+	// such as components whose arguments can't be evaluated because of a
+	// transient error. Failed nodes are evaluated again with an exponential
+	// backoff, starting at 1s and capped at RetryMaxBackoff, until they're
+	// evaluated successfully. Disabled when zero.
+	RetryMaxBackoff time.Duration
+
+	// MaxDeclareLabels is the maximum number of distinct values of the
+	// declare label of the custom component metrics. Custom components of
+	// further declare blocks are counted under a single overflow value.
+	// Defaults to DefaultMaxDeclareLabels when zero.
+	MaxDeclareLabels int
+
+	// DrainTimeout is how long the controller waits for each component to
+	// stop when it exits, before stopping the components it depends on
+	// anyway. Components are stopped before the components they send data
+	// to. Defaults to DefaultDrainTimeout when zero.
+	DrainTimeout time.Duration
+
+	// ProfileExpressions enables timing the function calls of the expressions
+	// of the components when they're evaluated, to find the expressions which
+	// make evaluations slow. The slowest expressions of the last evaluation of
+	// a component are reported in its debug info.
+	ProfileExpressions bool
+
+	// LastKnownGoodPath is the directory where the last source loaded without
+	// errors is persisted, so that it can be loaded with LoadLastKnownGood
+	// when the primary source is unavailable. The raw source is persisted,
+	// never evaluated values. The last content loaded by modules and imports
+	// is persisted in subdirectories, and loaded again when it can't be
+	// retrieved. Disabled when empty.
+	LastKnownGoodPath string
+
+	// CriticalComponents are the IDs of the components which make the
+	// controller not ready while they're unhealthy, such as components
+	// without which the controller is useless. Only components of the root
+	// module can be critical.
+	CriticalComponents []string
+
 	// List of Services to run with the Flow controller.
 	//
 	// Services are configured when LoadFile is invoked. Services are started
@@ -108,6 +161,14 @@ type Options struct {
 	Services []service.Service
 }
 
+const (
+	// DefaultDrainTimeout is the default value of Options.DrainTimeout.
+	DefaultDrainTimeout = controller.DefaultDrainTimeout
+	// DefaultMaxDeclareLabels is the default value of
+	// Options.MaxDeclareLabels.
+	DefaultMaxDeclareLabels = controller.DefaultMaxDeclareLabels
+)
+
 // Flow is the Flow system.
 type Flow struct {
 	log    *logging.Logger
@@ -131,10 +192,21 @@ func New(o Options) *Flow {
 		Options:        o,
 		ModuleRegistry: newModuleRegistry(),
 		IsModule:       false, // We are creating a new root controller.
-		WorkerPool:     worker.NewDefaultWorkerPool(),
+		WorkerPool:     newWorkerPool(o),
 	})
 }
 
+// newWorkerPool returns the worker pool of a root controller, which is shared
+// with the controllers of its modules. The pool reports its metrics with
+// o.Reg and logs the tasks it runs for too long with o.Logger.
+func newWorkerPool(o Options) worker.Pool {
+	opts := worker.Options{Registerer: o.Reg}
+	if o.Logger != nil {
+		opts.Logger = o.Logger
+	}
+	return worker.NewDefaultInstrumentedWorkerPool(opts)
+}
+
 // controllerOptions are internal options used to create both root Flow
 // controller and controllers for modules.
 type controllerOptions struct {
@@ -177,7 +249,13 @@ func newController(o controllerOptions) *Flow {
 		opts:   o,
 
 		updateQueue: controller.NewQueue(),
-		sched:       controller.NewScheduler(),
+		sched: controller.NewScheduler(controller.SchedulerOptions{
+			Logger:         log,
+			Registerer:     o.Reg,
+			ControllerID:   o.ControllerID,
+			LeakCheckDelay: o.GoroutineLeakCheckDelay,
+			DrainTimeout:   o.DrainTimeout,
+		}),
 
 		modules: o.ModuleRegistry,
 
@@ -196,21 +274,29 @@ func newController(o controllerOptions) *Flow {
 				// Changed node should be queued for reevaluation.
 				f.updateQueue.Enqueue(&controller.QueuedNode{Node: cn, LastUpdatedTime: time.Now()})
 			},
-			OnExportsChange: o.OnExportsChange,
-			Registerer:      o.Reg,
-			ControllerID:    o.ControllerID,
+			OnExportsChange:   o.OnExportsChange,
+			Registerer:        o.Reg,
+			ControllerID:      o.ControllerID,
+			LastKnownGoodPath: o.LastKnownGoodPath,
 			NewModuleController: func(id string) controller.ModuleController {
 				return newModuleController(&moduleControllerOptions{
-					ComponentRegistry: o.ComponentRegistry,
-					ModuleRegistry:    o.ModuleRegistry,
-					Logger:            log,
-					Tracer:            tracer,
-					Reg:               o.Reg,
-					DataPath:          o.DataPath,
-					MinStability:      o.MinStability,
-					ID:                id,
-					ServiceMap:        serviceMap,
-					WorkerPool:        workerPool,
+					ComponentRegistry:  o.ComponentRegistry,
+					ModuleRegistry:     o.ModuleRegistry,
+					Logger:             log,
+					Tracer:             tracer,
+					Reg:                o.Reg,
+					DataPath:           o.DataPath,
+					MinStability:       o.MinStability,
+					LeakCheckDelay:     o.GoroutineLeakCheckDelay,
+					MinUpdateInterval:  o.MinUpdateInterval,
+					RetryMaxBackoff:    o.RetryMaxBackoff,
+					DrainTimeout:       o.DrainTimeout,
+					MaxDeclareLabels:   o.MaxDeclareLabels,
+					ProfileExpressions: o.ProfileExpressions,
+					LastKnownGoodPath:  o.LastKnownGoodPath,
+					ID:                 id,
+					ServiceMap:         serviceMap,
+					WorkerPool:         workerPool,
 				})
 			},
 			GetServiceData: func(name string) (interface{}, error) {
@@ -222,10 +308,15 @@ func newController(o controllerOptions) *Flow {
 			},
 		},
 
-		Services:          o.Services,
-		Host:              f,
-		ComponentRegistry: o.ComponentRegistry,
-		WorkerPool:        workerPool,
+		Services:           o.Services,
+		Host:               f,
+		ComponentRegistry:  o.ComponentRegistry,
+		WorkerPool:         workerPool,
+		MinUpdateInterval:  o.MinUpdateInterval,
+		CriticalComponents: o.CriticalComponents,
+		RetryPolicy:        controller.RetryPolicy{MaxBackoff: o.RetryMaxBackoff},
+		ProfileExpressions: o.ProfileExpressions,
+		MaxDeclareLabels:   o.MaxDeclareLabels,
 	})
 
 	return f
@@ -236,6 +327,12 @@ func newController(o controllerOptions) *Flow {
 func (f *Flow) Run(ctx context.Context) {
 	defer func() { _ = f.sched.Close() }()
 	defer f.loader.Cleanup(!f.opts.IsModule)
+	defer func() {
+		// Stop components before the components they send data to, so that
+		// the latter can flush it. Components are drained before the worker
+		// pool is stopped, as their exports may still change while they stop.
+		f.sched.Drain(f.loader.Dependants())
+	}()
 	defer level.Debug(f.log).Log("msg", "flow controller exiting")
 
 	for {
@@ -320,10 +417,63 @@ func (f *Flow) loadSource(source *Source, args map[string]any, customComponentRe
 	default:
 		// A refresh is already scheduled
 	}
-	return diags.ErrorOrNil()
+	if !diags.HasErrors() {
+		if f.opts.LastKnownGoodPath != "" && !f.opts.IsModule {
+			if err := writeLastKnownGood(f.opts.LastKnownGoodPath, source); err != nil {
+				level.Warn(f.log).Log("msg", "failed to persist last known good config", "path", f.opts.LastKnownGoodPath, "err", err)
+			}
+		}
+		// Warnings are logged by the loader and don't fail the load.
+		return nil
+	}
+	return diags
+}
+
+// Validate checks source the way LoadSource does without loading it, so
+// that an invalid source can be rejected before the running components are
+// touched. Validate doesn't evaluate components, so errors only found when
+// evaluating them are still reported by LoadSource.
+func (f *Flow) Validate(source *Source, args map[string]any) error {
+	diags := f.loader.Validate(controller.ApplyOptions{
+		Args:            args,
+		ComponentBlocks: source.components,
+		ConfigBlocks:    source.configBlocks,
+		DeclareBlocks:   source.declareBlocks,
+	})
+	if diags.HasErrors() {
+		return diags
+	}
+	return nil
+}
+
+// WaitForStable blocks until the components loaded by the most recent
+// LoadSource and their dependants are done evaluating, or until ctx is done.
+// It is useful to read the exports of components right after loading a
+// source, as changes of exports are propagated asynchronously.
+//
+// The controller is stable once no evaluations are queued or running and no
+// exports changed for a short settle window. Components which keep updating
+// their exports prevent the controller from ever being stable, in which case
+// ctx.Err() is returned once ctx is done.
+func (f *Flow) WaitForStable(ctx context.Context) error {
+	// Wait for any in-progress load to complete.
+	f.loadMut.RLock()
+	f.loadMut.RUnlock() //nolint:staticcheck // Empty critical section is intentional.
+
+	return f.loader.WaitForStable(ctx, func() bool { return f.updateQueue.Len() > 0 })
 }
 
-// Ready returns whether the Flow controller has finished its initial load.
+// Ready returns whether the Flow controller has finished its initial load,
+// and none of its critical components is unhealthy.
 func (f *Flow) Ready() bool {
-	return f.loadedOnce.Load()
+	return f.Readiness() == nil
+}
+
+// Readiness returns nil if the Flow controller is ready, or the reason why it
+// isn't otherwise.
+func (f *Flow) Readiness() error {
+	if !f.loadedOnce.Load() {
+		return errors.New("the initial configuration was not loaded yet")
+	}
+	return f.loader.CheckCriticalComponents()
 }
@@ -127,5 +127,24 @@ func (f *Flow) getComponentDetail(cn controller.ComponentNode, graph *dag.Graph,
 			componentInfo.DebugInfo = builtinComponent.DebugInfo()
 		}
 	}
+	if customComponent, ok := cn.(*controller.CustomComponentNode); ok && opts.GetDebugInfo {
+		componentInfo.DebugInfo = customComponent.DebugInfo()
+	}
+	if opts.GetDebugInfo {
+		componentInfo.EvaluationProfile = f.loader.EvaluationProfile(cn.NodeID())
+	}
 	return componentInfo
 }
+
+// ComponentSchema describes the arguments and exports of a component.
+type ComponentSchema = controller.ComponentSchema
+
+// ComponentSchemas returns the schema of each builtin component which can be
+// used by f, and of each custom component used by the config of f, sorted by
+// component name.
+func (f *Flow) ComponentSchemas() []ComponentSchema {
+	f.loadMut.RLock()
+	defer f.loadMut.RUnlock()
+
+	return f.loader.ComponentSchemas()
+}
@@ -334,6 +334,93 @@ func TestComponents_Using_Services_In_Modules(t *testing.T) {
 	require.NoError(t, componentBuilt.Wait(5*time.Second), "Component should have been built")
 }
 
+// TestServices_BlockInModule ensures that a module can't configure a service
+// also configured by the root configuration.
+func TestServices_BlockInModule(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	type ServiceOptions struct {
+		Name string `river:"name,attr"`
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		configuredName = atomic.NewString("")
+		moduleErr      = make(chan error, 1)
+
+		svc = &testservices.Fake{
+			DefinitionFunc: func() service.Definition {
+				return service.Definition{
+					Name:       "fake",
+					ConfigType: ServiceOptions{},
+				}
+			},
+
+			UpdateFunc: func(newConfig any) error {
+				configuredName.Store(newConfig.(ServiceOptions).Name)
+				return nil
+			},
+		}
+
+		registry = controller.NewRegistryMap(
+			featuregate.StabilityStable,
+			map[string]component.Registration{
+				"module_loader": {
+					Name:      "module_loader",
+					Args:      struct{}{},
+					Stability: featuregate.StabilityStable,
+					Build: func(opts component.Options, _ component.Arguments) (component.Component, error) {
+						mod, err := opts.ModuleController.NewModule("", nil)
+						require.NoError(t, err, "Failed to create module")
+
+						moduleErr <- mod.LoadConfig([]byte(`
+							// Only the root configuration can configure services.
+							fake {
+								name = "module"
+							}
+						`), nil)
+						return &testcomponents.Fake{}, nil
+					},
+				},
+			},
+		)
+	)
+
+	f, err := ParseSource(t.Name(), []byte(`
+		fake {
+			name = "root"
+		}
+
+		module_loader "example" {}
+	`))
+	require.NoError(t, err)
+
+	opts := testOptions(t)
+	opts.Services = append(opts.Services, svc)
+
+	ctrl := newController(controllerOptions{
+		Options:           opts,
+		ComponentRegistry: registry,
+		ModuleRegistry:    newModuleRegistry(),
+	})
+	require.NoError(t, ctrl.LoadSource(f, nil))
+	go ctrl.Run(ctx)
+
+	// The error points at the block inside the module source.
+	select {
+	case err := <-moduleErr:
+		require.ErrorContains(t, err, `:3:8: service blocks not allowed inside a module: "fake"; services are shared with the root configuration`)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "module config wasn't loaded")
+	}
+
+	// The service keeps the configuration of the root configuration.
+	require.Eventually(t, func() bool {
+		return configuredName.Load() == "root"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
 func makeEmptyFile(t *testing.T) *Source {
 	t.Helper()
 
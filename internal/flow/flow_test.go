@@ -2,7 +2,9 @@ package flow
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/grafana/agent/internal/component"
@@ -11,6 +13,7 @@ import (
 	"github.com/grafana/agent/internal/flow/internal/dag"
 	"github.com/grafana/agent/internal/flow/internal/testcomponents"
 	"github.com/grafana/agent/internal/flow/logging"
+	"github.com/grafana/river/diag"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 )
@@ -54,6 +57,138 @@ func TestController_LoadSource_Evaluation(t *testing.T) {
 	require.Equal(t, "hello, world!", out.(testcomponents.PassthroughExports).Output)
 }
 
+func TestController_Validate(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	ctrl := New(testOptions(t))
+	defer cleanUpController(ctrl)
+
+	f, err := ParseSource(t.Name(), []byte(testFile))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+	components := ctrl.loader.Components()
+
+	t.Run("valid source", func(t *testing.T) {
+		valid, err := ParseSource(t.Name(), []byte(`
+			testcomponents.passthrough "static" {
+				input = "goodbye, world!"
+			}
+		`))
+		require.NoError(t, err)
+		require.NoError(t, ctrl.Validate(valid, nil))
+	})
+
+	t.Run("invalid source", func(t *testing.T) {
+		invalid, err := ParseSource(t.Name(), []byte(`
+			testcomponents.passthrough "static" {
+				input = "goodbye, world!"
+			}
+
+			testcomponents.passthrough "forwarded" {
+				input = testcomponents.passthrough.missing.output
+			}
+		`))
+		require.NoError(t, err)
+
+		err = ctrl.Validate(invalid, nil)
+		var diags diag.Diagnostics
+		require.ErrorAs(t, err, &diags)
+		require.ErrorContains(t, err, "does not exist or is out of scope")
+	})
+
+	// Validating doesn't change the loaded graph.
+	require.Equal(t, components, ctrl.loader.Components())
+	in, _ := getFields(t, ctrl.loader.Graph(), "testcomponents.passthrough.static")
+	require.Equal(t, "hello, world!", in.(testcomponents.PassthroughConfig).Input)
+	static := ctrl.loader.Graph().GetByID("testcomponents.passthrough.static").(*controller.BuiltinComponentNode)
+	require.Same(t, f.components[1], static.Block())
+}
+
+func TestController_LastKnownGood(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	lastKnownGoodPath := filepath.Join(t.TempDir(), "last-known-good")
+
+	opts := testOptions(t)
+	opts.LastKnownGoodPath = lastKnownGoodPath
+	ctrl := New(opts)
+	defer cleanUpController(ctrl)
+
+	_, err := LoadLastKnownGood(lastKnownGoodPath)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	f, err := ParseSource("config.river", []byte(testFile))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	// A source which fails to load doesn't replace the last known good one.
+	invalid, err := ParseSource("config.river", []byte(`
+		testcomponents.passthrough "forwarded" {
+			input = testcomponents.passthrough.missing.output
+		}
+	`))
+	require.NoError(t, err)
+	require.Error(t, ctrl.LoadSource(invalid, nil))
+
+	// Simulate a restart while the primary source is unavailable.
+	restored, err := LoadLastKnownGood(lastKnownGoodPath)
+	require.NoError(t, err)
+	require.Equal(t, f.SHA256(), restored.SHA256())
+	require.Equal(t, map[string][]byte{
+		filepath.Join(lastKnownGoodPath, "config.river"): []byte(testFile),
+	}, restored.RawConfigs())
+
+	restarted := New(opts)
+	defer cleanUpController(restarted)
+	require.NoError(t, restarted.LoadSource(restored, nil))
+	require.Len(t, restarted.loader.Components(), 4)
+}
+
+func TestController_LastKnownGoodImport(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	moduleFile := filepath.Join(t.TempDir(), "module.river")
+	require.NoError(t, os.WriteFile(moduleFile, []byte(`
+		declare "passthrough" {
+			argument "input" {}
+
+			testcomponents.passthrough "inner" {
+				input = argument.input.value
+			}
+
+			export "output" {
+				value = testcomponents.passthrough.inner.output
+			}
+		}
+	`), 0o600))
+
+	f, err := ParseSource("config.river", []byte(fmt.Sprintf(`
+		import.file "lib" {
+			filename = %q
+		}
+
+		lib.passthrough "forwarded" {
+			input = "hello, world!"
+		}
+	`, moduleFile)))
+	require.NoError(t, err)
+
+	opts := testOptions(t)
+	opts.LastKnownGoodPath = filepath.Join(t.TempDir(), "last-known-good")
+	ctrl := New(opts)
+	defer cleanUpController(ctrl)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+
+	// Simulate a restart while the imported file is unavailable: the
+	// imported content which was persisted is used instead.
+	require.NoError(t, os.Remove(moduleFile))
+	restarted := New(opts)
+	defer cleanUpController(restarted)
+	require.NoError(t, restarted.LoadSource(f, nil))
+	require.NotNil(t, restarted.loader.Graph().GetByID("lib.passthrough.forwarded"))
+
+	withoutLastKnownGood := New(testOptions(t))
+	defer cleanUpController(withoutLastKnownGood)
+	require.ErrorContains(t, withoutLastKnownGood.LoadSource(f, nil), "failed to read file")
+}
+
 func getFields(t *testing.T, g *dag.Graph, nodeID string) (component.Arguments, component.Exports) {
 	t.Helper()
 
@@ -64,6 +199,54 @@ func getFields(t *testing.T, g *dag.Graph, nodeID string) (component.Arguments,
 	return uc.Arguments(), uc.Exports()
 }
 
+func TestController_CriticalComponents(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	opts := testOptions(t)
+	opts.CriticalComponents = []string{"testcomponents.passthrough.critical"}
+	ctrl := New(opts)
+	defer cleanUpController(ctrl)
+
+	load := func(criticalLag, otherLag string) error {
+		f, err := ParseSource(t.Name(), []byte(fmt.Sprintf(`
+			testcomponents.passthrough "critical" {
+				input = "hello"
+				lag   = %q
+			}
+
+			testcomponents.passthrough "other" {
+				input = "hello"
+				lag   = %q
+			}
+		`, criticalLag, otherLag)))
+		require.NoError(t, err)
+		return ctrl.LoadSource(f, nil)
+	}
+
+	require.EqualError(t, ctrl.Readiness(), "the initial configuration was not loaded yet")
+
+	require.NoError(t, load("1ms", "1ms"))
+	require.NoError(t, ctrl.Readiness())
+	require.True(t, ctrl.Ready())
+
+	// A non-critical component failing doesn't affect readiness.
+	require.Error(t, load("1ms", "not a duration"))
+	require.NoError(t, ctrl.Readiness())
+
+	// A critical component failing does.
+	require.Error(t, load("not a duration", "1ms"))
+	require.ErrorContains(t, ctrl.Readiness(), "critical component testcomponents.passthrough.critical is unhealthy")
+	require.False(t, ctrl.Ready())
+
+	require.NoError(t, load("1ms", "1ms"))
+	require.NoError(t, ctrl.Readiness())
+
+	// Removing a critical component also affects readiness.
+	f, err := ParseSource(t.Name(), []byte(`testcomponents.passthrough "other" { input = "hello" }`))
+	require.NoError(t, err)
+	require.NoError(t, ctrl.LoadSource(f, nil))
+	require.EqualError(t, ctrl.Readiness(), "critical component testcomponents.passthrough.critical is not defined")
+}
+
 func testOptions(t *testing.T) Options {
 	t.Helper()
 
@@ -74,6 +74,62 @@ func TestController_Updates(t *testing.T) {
 	require.Equal(t, 10, in.(testcomponents.SummationConfig).Input)
 }
 
+func TestController_WaitForStable(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+
+	// Chain of dependants, each of them lagging.
+	config := `
+	testcomponents.count "inc" {
+		frequency = "10ms"
+		max = 10
+	}
+
+	testcomponents.passthrough "inc_dep_1" {
+		input = testcomponents.count.inc.count
+		lag = "20ms"
+	}
+
+	testcomponents.passthrough "inc_dep_2" {
+		input = testcomponents.passthrough.inc_dep_1.output
+		lag = "20ms"
+	}
+
+	testcomponents.summation "sum" {
+		input = testcomponents.passthrough.inc_dep_2.output
+	}
+`
+
+	ctrl := newTestController(t)
+
+	f, err := ParseSource(t.Name(), []byte(config))
+	require.NoError(t, err)
+	require.NotNil(t, f)
+
+	err = ctrl.LoadSource(f, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ctrl.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	require.NoError(t, ctrl.WaitForStable(waitCtx))
+
+	// The tail of the chain must have been evaluated with the final count by
+	// the time WaitForStable returns.
+	in, out := getFields(t, ctrl.loader.Graph(), "testcomponents.summation.sum")
+	require.Equal(t, 10, in.(testcomponents.SummationConfig).Input)
+	require.Equal(t, 10, out.(testcomponents.SummationExports).LastAdded)
+}
+
 func TestController_Updates_WithQueueFull(t *testing.T) {
 	defer verifyNoGoroutineLeaks(t)
 
@@ -0,0 +1,280 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/agent/internal/flow/internal/dag"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/diag"
+	"github.com/grafana/river/vm"
+)
+
+const aliasBlockID = "alias"
+
+// referenceAlias allows references to a component to keep using its old ID
+// while a config is migrated to a new one, for example after renaming the
+// label of the component. An alias to the label of a declare block allows
+// blocks to keep instantiating the declare with its old label instead.
+type referenceAlias struct {
+	from  ComponentID
+	to    ComponentID
+	block *ast.BlockStmt
+
+	// declare is the declare block the alias points to, or nil if the alias
+	// points to a component.
+	declare *DeclareNode
+}
+
+type aliasBlock struct {
+	From string `river:"from,attr"`
+	To   string `river:"to,attr"`
+}
+
+// aliasMap holds the aliases of a config, by the ID they redirect from.
+type aliasMap map[string]*referenceAlias
+
+// splitAliasBlocks separates the alias blocks from the other config blocks.
+func splitAliasBlocks(blocks []*ast.BlockStmt) (aliasBlocks, configBlocks []*ast.BlockStmt) {
+	for _, b := range blocks {
+		if b.GetBlockName() == aliasBlockID {
+			aliasBlocks = append(aliasBlocks, b)
+		} else {
+			configBlocks = append(configBlocks, b)
+		}
+	}
+	return aliasBlocks, configBlocks
+}
+
+// newAliasMap decodes alias blocks. Aliases must be static: they're resolved
+// before any component is evaluated.
+func newAliasMap(blocks []*ast.BlockStmt) (aliasMap, diag.Diagnostics) {
+	var (
+		diags    diag.Diagnostics
+		aliases  = make(aliasMap, len(blocks))
+		blockMap = make(map[string]*ast.BlockStmt, len(blocks))
+	)
+
+	for _, block := range blocks {
+		id := BlockComponentID(block).String()
+		if diag, defined := blockAlreadyDefined(blockMap, id, block); defined {
+			diags = append(diags, diag)
+			continue
+		}
+
+		var args aliasBlock
+		if err := vm.New(block.Body).Evaluate(&vm.Scope{}, &args); err != nil {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("decoding %s: %s", id, err),
+				StartPos: ast.StartPos(block).Position(),
+				EndPos:   ast.EndPos(block).Position(),
+			})
+			continue
+		}
+
+		var msg string
+		switch {
+		case args.From == "" || args.To == "":
+			msg = fmt.Sprintf("%s: from and to must not be empty", id)
+		case args.From == args.To:
+			msg = fmt.Sprintf("%s: from and to must be different", id)
+		case aliases[args.From] != nil:
+			msg = fmt.Sprintf("%s: %q is already aliased at %s", id, args.From, ast.StartPos(aliases[args.From].block).Position())
+		}
+		if msg != "" {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  msg,
+				StartPos: ast.StartPos(block).Position(),
+				EndPos:   ast.EndPos(block).Position(),
+			})
+			continue
+		}
+
+		aliases[args.From] = &referenceAlias{
+			from:  strings.Split(args.From, "."),
+			to:    strings.Split(args.To, "."),
+			block: block,
+		}
+	}
+
+	return aliases, diags
+}
+
+// Validate ensures that every alias resolves to a component of g, and that
+// the IDs aliases redirect from don't overlap with the IDs of the nodes of g.
+// Overlapping IDs would be ambiguous in expressions.
+func (aliases aliasMap) Validate(g *dag.Graph) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	for from, a := range aliases {
+		if a.declare != nil {
+			// Aliases to declare blocks are validated by resolveDeclares.
+			continue
+		}
+
+		var conflict string
+		for _, n := range g.Nodes() {
+			if idsOverlap(a.from, strings.Split(n.NodeID(), ".")) {
+				conflict = n.NodeID()
+				break
+			}
+		}
+		for other := range aliases {
+			if other != from && idsOverlap(a.from, aliases[other].from) {
+				conflict = other
+				break
+			}
+		}
+		if conflict != "" {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("alias from %q conflicts with %q", from, conflict),
+				StartPos: ast.StartPos(a.block).Position(),
+				EndPos:   ast.EndPos(a.block).Position(),
+			})
+			continue
+		}
+
+		if _, resolveDiags := aliases.resolve(a, g); resolveDiags.HasErrors() {
+			diags = append(diags, resolveDiags...)
+		}
+	}
+
+	return diags
+}
+
+// resolveDeclares marks the aliases which point to the label of one of
+// declares. The old label of a renamed declare must be a single identifier
+// which isn't the label of another declare.
+func (aliases aliasMap) resolveDeclares(declares map[string]*DeclareNode) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	for from, a := range aliases {
+		declare, ok := declares[a.to.String()]
+		if !ok {
+			continue
+		}
+
+		var msg string
+		switch {
+		case len(a.from) != 1:
+			msg = fmt.Sprintf("alias from %q to declare %q must be a single identifier", from, a.to)
+		case declares[from] != nil:
+			msg = fmt.Sprintf("alias from %q conflicts with declare %q", from, from)
+		}
+		if msg != "" {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  msg,
+				StartPos: ast.StartPos(a.block).Position(),
+				EndPos:   ast.EndPos(a.block).Position(),
+			})
+			continue
+		}
+		a.declare = declare
+	}
+
+	return diags
+}
+
+// resolve follows a chain of aliases starting at a, and returns the component
+// it ends at.
+func (aliases aliasMap) resolve(a *referenceAlias, g *dag.Graph) (ComponentNode, diag.Diagnostics) {
+	var (
+		diags diag.Diagnostics
+		seen  = map[*referenceAlias]struct{}{}
+	)
+
+	for {
+		seen[a] = struct{}{}
+
+		to := a.to.String()
+		if n := g.GetByID(to); n != nil {
+			if cn, ok := n.(ComponentNode); ok {
+				return cn, nil
+			}
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("alias target %q is not a component", to),
+				StartPos: ast.StartPos(a.block).Position(),
+				EndPos:   ast.EndPos(a.block).Position(),
+			})
+			return nil, diags
+		}
+
+		next, ok := aliases[to]
+		if !ok {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("alias target %q does not exist", to),
+				StartPos: ast.StartPos(a.block).Position(),
+				EndPos:   ast.EndPos(a.block).Position(),
+			})
+			return nil, diags
+		}
+		if _, loop := seen[next]; loop {
+			diags.Add(diag.Diagnostic{
+				Severity: diag.SeverityLevelError,
+				Message:  fmt.Sprintf("alias %q is part of an alias loop", to),
+				StartPos: ast.StartPos(a.block).Position(),
+				EndPos:   ast.EndPos(a.block).Position(),
+			})
+			return nil, diags
+		}
+		a = next
+	}
+}
+
+// Targets returns the ID of the component each alias resolves to, by the ID
+// the alias redirects from. Aliases which don't resolve are omitted.
+func (aliases aliasMap) Targets(g *dag.Graph) map[string]ComponentID {
+	targets := make(map[string]ComponentID, len(aliases))
+	for from, a := range aliases {
+		if a.declare != nil {
+			continue
+		}
+		if cn, diags := aliases.resolve(a, g); !diags.HasErrors() {
+			targets[from] = cn.ID()
+		}
+	}
+	return targets
+}
+
+// deprecationWarning returns the diagnostic reported for a reference at the
+// traversal t which is resolved through the alias a to target.
+func (a *referenceAlias) deprecationWarning(t Traversal, target BlockNode) diag.Diagnostic {
+	return diag.Diagnostic{
+		Severity: diag.SeverityLevelWarn,
+		Message: fmt.Sprintf(
+			"reference to %q is resolved through the deprecated alias declared at %s; reference %q declared at %s instead",
+			a.from.String(), ast.StartPos(a.block).Position(), target.NodeID(), ast.StartPos(target.Block()).Position(),
+		),
+		StartPos: ast.StartPos(t[0]).Position(),
+		EndPos:   ast.StartPos(t[len(t)-1]).Position(),
+	}
+}
+
+// declareDeprecationWarning returns the diagnostic reported for the custom
+// component cc which instantiates a declare through the alias a.
+func (a *referenceAlias) declareDeprecationWarning(cc *CustomComponentNode) diag.Diagnostic {
+	return diag.Diagnostic{
+		Severity: diag.SeverityLevelWarn,
+		Message: fmt.Sprintf(
+			"block %q instantiates declare %q through the deprecated alias declared at %s; use %q instead",
+			cc.NodeID(), a.declare.Label(), ast.StartPos(a.block).Position(), a.declare.Label(),
+		),
+		StartPos: ast.StartPos(cc.Block()).Position(),
+		EndPos:   ast.EndPos(cc.Block()).Position(),
+	}
+}
+
+// idsOverlap reports whether one of a and b is a prefix of the other.
+func idsOverlap(a, b ComponentID) bool {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	return a[:n].Equals(b[:n])
+}
@@ -0,0 +1,176 @@
+package controller_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow/internal/controller"
+	"github.com/grafana/agent/internal/flow/internal/testcomponents"
+	"github.com/grafana/agent/internal/flow/logging"
+	"github.com/grafana/river/diag"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestLoader_Aliases(t *testing.T) {
+	newLoader := func() *controller.Loader {
+		l, _ := logging.New(os.Stderr, logging.DefaultOptions)
+		return controller.NewLoader(controller.LoaderOptions{
+			ComponentGlobals: controller.ComponentGlobals{
+				Logger:            l,
+				TraceProvider:     noop.NewTracerProvider(),
+				DataPath:          t.TempDir(),
+				MinStability:      featuregate.StabilityBeta,
+				OnBlockNodeUpdate: func(cn controller.BlockNode) { /* no-op */ },
+				Registerer:        prometheus.NewRegistry(),
+				NewModuleController: func(id string) controller.ModuleController {
+					return nil
+				},
+			},
+		})
+	}
+
+	t.Run("Alias chain", func(t *testing.T) {
+		file := `
+			testcomponents.passthrough "renamed" {
+				input = "hello, world!"
+			}
+
+			testcomponents.passthrough "forwarded" {
+				input = testcomponents.passthrough.original.output
+			}
+		`
+		config := `
+			alias "original" {
+				from = "testcomponents.passthrough.original"
+				to   = "testcomponents.passthrough.intermediate"
+			}
+
+			alias "intermediate" {
+				from = "testcomponents.passthrough.intermediate"
+				to   = "testcomponents.passthrough.renamed"
+			}
+		`
+		l := newLoader()
+		diags := applyFromContent(t, l, []byte(file), []byte(config), nil)
+		require.False(t, diags.HasErrors(), diags.Error())
+
+		// The reference through the aliases is wired to the target component.
+		requireGraph(t, l.Graph(), graphDefinition{
+			Nodes: []string{
+				"testcomponents.passthrough.renamed",
+				"testcomponents.passthrough.forwarded",
+				"logging",
+				"tracing",
+			},
+			OutEdges: []edge{
+				{From: "testcomponents.passthrough.forwarded", To: "testcomponents.passthrough.renamed"},
+			},
+		})
+
+		require.Len(t, diags, 1)
+		require.Equal(t, diag.SeverityLevelWarn, diags[0].Severity)
+		require.Equal(t,
+			`reference to "testcomponents.passthrough.original" is resolved through the deprecated alias declared at TestLoader_Aliases/Alias_chain:2:4; `+
+				`reference "testcomponents.passthrough.renamed" declared at TestLoader_Aliases/Alias_chain:2:4 instead`,
+			diags[0].Message,
+		)
+
+		// The alias evaluates to the exports of the target component.
+		for _, cn := range l.Components() {
+			if cn.NodeID() == "testcomponents.passthrough.forwarded" {
+				require.Equal(t, "hello, world!", cn.Arguments().(testcomponents.PassthroughConfig).Input)
+			}
+		}
+	})
+
+	t.Run("Alias to missing target", func(t *testing.T) {
+		file := `
+			testcomponents.passthrough "forwarded" {
+				input = testcomponents.passthrough.original.output
+			}
+		`
+		config := `
+			alias "original" {
+				from = "testcomponents.passthrough.original"
+				to   = "testcomponents.passthrough.missing"
+			}
+		`
+		l := newLoader()
+		diags := applyFromContent(t, l, []byte(file), []byte(config), nil)
+		require.ErrorContains(t, diags.ErrorOrNil(), `alias target "testcomponents.passthrough.missing" does not exist`)
+	})
+
+	t.Run("Alias loop", func(t *testing.T) {
+		config := `
+			alias "a" {
+				from = "testcomponents.passthrough.a"
+				to   = "testcomponents.passthrough.b"
+			}
+
+			alias "b" {
+				from = "testcomponents.passthrough.b"
+				to   = "testcomponents.passthrough.a"
+			}
+		`
+		l := newLoader()
+		diags := applyFromContent(t, l, nil, []byte(config), nil)
+		require.ErrorContains(t, diags.ErrorOrNil(), "is part of an alias loop")
+	})
+
+	t.Run("Alias conflicting with a component", func(t *testing.T) {
+		file := `
+			testcomponents.passthrough "original" {
+				input = "hello, world!"
+			}
+		`
+		config := `
+			alias "original" {
+				from = "testcomponents.passthrough.original"
+				to   = "testcomponents.passthrough.renamed"
+			}
+		`
+		l := newLoader()
+		diags := applyFromContent(t, l, []byte(file), []byte(config), nil)
+		require.ErrorContains(t, diags.ErrorOrNil(), `alias from "testcomponents.passthrough.original" conflicts with "testcomponents.passthrough.original"`)
+	})
+
+	t.Run("Cycle through an alias", func(t *testing.T) {
+		file := `
+			testcomponents.passthrough "a" {
+				input = testcomponents.passthrough.old_b.output
+			}
+
+			testcomponents.passthrough "b" {
+				input = testcomponents.passthrough.a.output
+			}
+		`
+		config := `
+			alias "old_b" {
+				from = "testcomponents.passthrough.old_b"
+				to   = "testcomponents.passthrough.b"
+			}
+		`
+		l := newLoader()
+		diags := applyFromContent(t, l, []byte(file), []byte(config), nil)
+		require.ErrorContains(t, diags.ErrorOrNil(), "cycle")
+	})
+
+	t.Run("Alias to a declare conflicting with a declare", func(t *testing.T) {
+		config := `
+			alias "a" {
+				from = "a"
+				to   = "b"
+			}
+		`
+		declares := `
+			declare "a" {}
+			declare "b" {}
+		`
+		l := newLoader()
+		diags := applyFromContent(t, l, nil, []byte(config), []byte(declares))
+		require.ErrorContains(t, diags.ErrorOrNil(), `alias from "a" conflicts with declare "a"`)
+	})
+}
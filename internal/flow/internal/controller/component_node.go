@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"time"
+
 	"github.com/grafana/agent/internal/component"
 )
 
@@ -11,6 +13,10 @@ type ComponentNode interface {
 	// CurrentHealth returns the current health of the component.
 	CurrentHealth() component.Health
 
+	// LastEvaluation returns the time the component was last evaluated, or
+	// the zero time if it wasn't evaluated yet.
+	LastEvaluation() time.Time
+
 	// Arguments returns the current arguments of the managed component.
 	Arguments() component.Arguments
 
@@ -25,8 +25,9 @@ type Reference struct {
 }
 
 // ComponentReferences returns the list of references a component is making to
-// other components.
-func ComponentReferences(cn dag.Node, g *dag.Graph) ([]Reference, diag.Diagnostics) {
+// other components. References through aliases are resolved to the component
+// the alias points to, and reported with a deprecation warning.
+func ComponentReferences(cn dag.Node, g *dag.Graph, aliases aliasMap) ([]Reference, diag.Diagnostics) {
 	var (
 		traversals []Traversal
 
@@ -52,7 +53,7 @@ func ComponentReferences(cn dag.Node, g *dag.Graph) ([]Reference, diag.Diagnosti
 			continue
 		}
 
-		ref, resolveDiags := resolveTraversal(t, g)
+		ref, resolveDiags := resolveTraversal(t, g, aliases)
 		diags = append(diags, resolveDiags...)
 		if resolveDiags.HasErrors() {
 			continue
@@ -129,7 +130,7 @@ func (tw *traversalWalker) flush() {
 	tw.currentTraversal = nil
 }
 
-func resolveTraversal(t Traversal, g *dag.Graph) (Reference, diag.Diagnostics) {
+func resolveTraversal(t Traversal, g *dag.Graph, aliases aliasMap) (Reference, diag.Diagnostics) {
 	var (
 		diags diag.Diagnostics
 
@@ -144,6 +145,24 @@ func resolveTraversal(t Traversal, g *dag.Graph) (Reference, diag.Diagnostics) {
 				Traversal: rem,
 			}, nil
 		}
+		if a, ok := aliases[partial.String()]; ok && a.declare == nil {
+			target, resolveDiags := aliases.resolve(a, g)
+			if resolveDiags.HasErrors() {
+				// The alias itself is reported as invalid when validating aliases.
+				diags.Add(diag.Diagnostic{
+					Severity: diag.SeverityLevelError,
+					Message:  fmt.Sprintf("alias %q does not resolve to a component", partial),
+					StartPos: ast.StartPos(t[0]).Position(),
+					EndPos:   ast.StartPos(t[len(t)-1]).Position(),
+				})
+				return Reference{}, diags
+			}
+			diags.Add(a.deprecationWarning(t, target))
+			return Reference{
+				Target:    target,
+				Traversal: rem,
+			}, diags
+		}
 
 		if len(rem) == 0 {
 			// Stop: there's no more elements to look at in the traversal.
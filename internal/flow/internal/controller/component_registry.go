@@ -5,6 +5,8 @@ import (
 
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/featuregate"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 // ComponentRegistry is a collection of registered components.
@@ -39,6 +41,17 @@ func (reg defaultComponentRegistry) Get(name string) (component.Registration, er
 	return cr, nil
 }
 
+// registeredNames returns the names of the components which can be looked up
+// in reg, sorted.
+func registeredNames(reg ComponentRegistry) []string {
+	if m, ok := reg.(*registryMap); ok {
+		names := maps.Keys(m.registrations)
+		slices.Sort(names)
+		return names
+	}
+	return component.AllNames()
+}
+
 type registryMap struct {
 	registrations map[string]component.Registration
 	minStability  featuregate.Stability
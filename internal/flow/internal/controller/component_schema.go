@@ -0,0 +1,304 @@
+package controller
+
+import (
+	"bytes"
+	"encoding"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/printer"
+	"github.com/grafana/river/rivertypes"
+	"github.com/grafana/river/token/builder"
+)
+
+// ComponentSchema describes the arguments and exports of a component.
+type ComponentSchema struct {
+	Name      string        `json:"name"`
+	Arguments []FieldSchema `json:"arguments"`
+	Exports   []FieldSchema `json:"exports"`
+}
+
+// FieldSchema describes an attribute or a block of the arguments or exports
+// of a component.
+type FieldSchema struct {
+	Name string `json:"name"`
+	// Kind is attr, block, enum or label.
+	Kind string `json:"kind"`
+	// Type is the River type of attributes.
+	Type     string `json:"type,omitempty"`
+	Required bool   `json:"required"`
+	// Default is the River expression of the default value of optional
+	// attributes, if it isn't the zero value of Type.
+	Default string `json:"default,omitempty"`
+	// Repeated is set for blocks which can be set more than once.
+	Repeated bool `json:"repeated,omitempty"`
+	// Fields are the attributes and blocks of blocks.
+	Fields []FieldSchema `json:"fields,omitempty"`
+}
+
+// ComponentSchemas returns the schema of each builtin component which can be
+// used with the component registry of the Loader, whether the loaded config
+// uses it or not, and of each custom component used by the loaded config,
+// sorted by component name.
+func (l *Loader) ComponentSchemas() []ComponentSchema {
+	schemas := map[string]ComponentSchema{}
+
+	reg := l.componentNodeManager.builtinComponentReg
+	for _, name := range registeredNames(reg) {
+		r, err := reg.Get(name)
+		if err != nil {
+			// The component can't be used, for instance because of its
+			// stability level.
+			continue
+		}
+		schemas[name] = builtinComponentSchema(name, r)
+	}
+
+	for _, cn := range l.Components() {
+		cn, ok := cn.(*CustomComponentNode)
+		if !ok {
+			continue
+		}
+		name := cn.ComponentName()
+		if _, ok := schemas[name]; ok {
+			continue
+		}
+		template := cn.Template()
+		if template == nil {
+			// The schema isn't known until the component is evaluated.
+			continue
+		}
+		schemas[name] = customComponentSchema(name, template)
+	}
+
+	res := make([]ComponentSchema, 0, len(schemas))
+	for _, schema := range schemas {
+		res = append(res, schema)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// builtinComponentSchema describes a builtin component from the river tags of
+// its registered Args and Exports.
+func builtinComponentSchema(name string, reg component.Registration) ComponentSchema {
+	schema := ComponentSchema{Name: name}
+	if reg.Args != nil {
+		schema.Arguments = structSchema(reflect.TypeOf(reg.Args), true)
+	}
+	if reg.Exports != nil {
+		schema.Exports = structSchema(reflect.TypeOf(reg.Exports), false)
+	}
+	return schema
+}
+
+// structSchema describes the fields of the struct type t. Required and
+// defaults are only reported for arguments, since exports are always set by
+// the component.
+func structSchema(t reflect.Type, arguments bool) []FieldSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	// Defaults are the values of a struct the component would decode into.
+	defaults := reflect.New(t)
+	if isDefaulter(t) {
+		defaults.Interface().(interface{ SetToDefault() }).SetToDefault()
+	}
+	return fieldsSchema(t, defaults.Elem(), arguments)
+}
+
+func fieldsSchema(t reflect.Type, defaults reflect.Value, arguments bool) []FieldSchema {
+	var fields []FieldSchema
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("river")
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		if len(parts) < 2 {
+			continue
+		}
+		var (
+			name     = parts[0]
+			kind     = parts[1]
+			optional = len(parts) > 2 && parts[2] == "optional"
+			value    = defaults.Field(i)
+		)
+
+		switch kind {
+		case "squash":
+			fields = append(fields, fieldsSchema(field.Type, value, arguments)...)
+			continue
+		case "label":
+			fields = append(fields, FieldSchema{Name: labelFieldName, Kind: kind, Type: "string", Required: arguments})
+			continue
+		}
+
+		fs := FieldSchema{
+			Name:     name,
+			Kind:     kind,
+			Required: arguments && !optional,
+		}
+		switch kind {
+		case "attr":
+			fs.Type = riverType(field.Type)
+			if arguments && optional {
+				fs.Default = defaultExpr(value)
+			}
+		case "block", "enum":
+			fs.Repeated = field.Type.Kind() == reflect.Slice || field.Type.Kind() == reflect.Array
+			fs.Fields = blockSchema(field.Type, value, arguments)
+		}
+		fields = append(fields, fs)
+	}
+	return fields
+}
+
+// blockSchema describes the fields of a block of type t. The defaults of
+// blocks are the ones set by the enclosing struct, unless the block sets its
+// own defaults.
+func blockSchema(t reflect.Type, value reflect.Value, arguments bool) []FieldSchema {
+	switch {
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return structSchema(t.Elem(), arguments)
+	case t.Kind() == reflect.Struct && !isDefaulter(t):
+		return fieldsSchema(t, value, arguments)
+	default:
+		return structSchema(t, arguments)
+	}
+}
+
+// labelFieldName is the name of the label of blocks, which isn't named in
+// River.
+const labelFieldName = "label"
+
+func isDefaulter(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(defaulterType)
+}
+
+var (
+	defaulterType      = reflect.TypeOf((*interface{ SetToDefault() })(nil)).Elem()
+	durationType       = reflect.TypeOf(time.Duration(0))
+	secretType         = reflect.TypeOf(rivertypes.Secret(""))
+	optionalSecretType = reflect.TypeOf(rivertypes.OptionalSecret{})
+	textMarshalerType  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// riverType returns the name of the River type Go values of type t are
+// converted to.
+func riverType(t reflect.Type) string {
+	switch t {
+	case durationType:
+		return "duration"
+	case secretType, optionalSecretType:
+		return "secret"
+	}
+	if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return riverType(t.Elem())
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list(" + riverType(t.Elem()) + ")"
+	case reflect.Map:
+		return "map(" + riverType(t.Elem()) + ")"
+	case reflect.Struct:
+		return "object"
+	case reflect.Func:
+		return "function"
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "any"
+		}
+		return "capsule"
+	default:
+		return "capsule"
+	}
+}
+
+// defaultExpr returns the River expression of v, or an empty string if v is
+// the zero value of its type or can't be represented in River.
+func defaultExpr(v reflect.Value) string {
+	if !v.IsValid() || v.IsZero() {
+		return ""
+	}
+	switch riverType(v.Type()) {
+	case "capsule", "function", "any":
+		return ""
+	}
+
+	expr := builder.NewExpr()
+	expr.SetValue(v.Interface())
+	return string(expr.Bytes())
+}
+
+// customComponentSchema describes a custom component from the argument and
+// export blocks of its declare block.
+func customComponentSchema(name string, template ast.Body) ComponentSchema {
+	schema := ComponentSchema{Name: name}
+	for _, stmt := range template {
+		block, ok := stmt.(*ast.BlockStmt)
+		if !ok {
+			continue
+		}
+		switch block.GetBlockName() {
+		case argumentBlockID:
+			fs := FieldSchema{Name: block.Label, Kind: "attr", Required: true}
+			for _, attr := range blockAttributes(block) {
+				switch attr.Name.Name {
+				case "optional":
+					fs.Required = !isTrueLiteral(attr.Value)
+				case "default":
+					fs.Default = exprString(attr.Value)
+				}
+			}
+			schema.Arguments = append(schema.Arguments, fs)
+		case exportBlockID:
+			schema.Exports = append(schema.Exports, FieldSchema{Name: block.Label, Kind: "attr"})
+		}
+	}
+	return schema
+}
+
+func blockAttributes(block *ast.BlockStmt) []*ast.AttributeStmt {
+	var attrs []*ast.AttributeStmt
+	for _, stmt := range block.Body {
+		if attr, ok := stmt.(*ast.AttributeStmt); ok {
+			attrs = append(attrs, attr)
+		}
+	}
+	return attrs
+}
+
+func isTrueLiteral(expr ast.Expr) bool {
+	lit, ok := expr.(*ast.LiteralExpr)
+	return ok && lit.Value == "true"
+}
+
+func exprString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, expr); err != nil {
+		return ""
+	}
+	return buf.String()
+}
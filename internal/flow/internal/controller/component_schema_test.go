@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/parser"
+	"github.com/grafana/river/rivertypes"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+type schemaTestArguments struct {
+	Targets  []map[string]string `river:"targets,attr"`
+	Interval time.Duration       `river:"interval,attr,optional"`
+	Password rivertypes.Secret   `river:"password,attr,optional"`
+
+	Client schemaTestClient   `river:"client,block,optional"`
+	Rules  []schemaTestRule   `river:"rule,block,optional"`
+	Common schemaTestCommon   `river:",squash"`
+	Hooks  []schemaTestHook   `river:"hook,enum,optional"`
+	Ignore func() interface{} `river:"ignore,attr,optional"`
+}
+
+func (args *schemaTestArguments) SetToDefault() {
+	*args = schemaTestArguments{
+		Interval: time.Minute,
+		Client:   schemaTestClient{URL: "http://localhost"},
+	}
+}
+
+type schemaTestClient struct {
+	URL string `river:"url,attr,optional"`
+
+	TLS *schemaTestTLS `river:"tls,block,optional"`
+}
+
+type schemaTestTLS struct {
+	CAFile string `river:"ca_file,attr"`
+}
+
+type schemaTestRule struct {
+	Name   string `river:",label"`
+	Action string `river:"action,attr"`
+}
+
+type schemaTestCommon struct {
+	Enabled bool `river:"enabled,attr,optional"`
+}
+
+type schemaTestHook struct {
+	Exec *schemaTestCommon `river:"exec,block,optional"`
+}
+
+type schemaTestExports struct {
+	Receiver interface{ Receive() } `river:"receiver,attr"`
+}
+
+func TestBuiltinComponentSchema(t *testing.T) {
+	schema := builtinComponentSchema("test.schema", component.Registration{
+		Args:    schemaTestArguments{},
+		Exports: schemaTestExports{},
+	})
+
+	expect := ComponentSchema{
+		Name: "test.schema",
+		Arguments: []FieldSchema{
+			{Name: "targets", Kind: "attr", Type: "list(map(string))", Required: true},
+			{Name: "interval", Kind: "attr", Type: "duration", Default: `"1m0s"`},
+			{Name: "password", Kind: "attr", Type: "secret"},
+			{Name: "client", Kind: "block", Fields: []FieldSchema{
+				{Name: "url", Kind: "attr", Type: "string", Default: `"http://localhost"`},
+				{Name: "tls", Kind: "block", Fields: []FieldSchema{
+					{Name: "ca_file", Kind: "attr", Type: "string", Required: true},
+				}},
+			}},
+			{Name: "rule", Kind: "block", Repeated: true, Fields: []FieldSchema{
+				{Name: "label", Kind: "label", Type: "string", Required: true},
+				{Name: "action", Kind: "attr", Type: "string", Required: true},
+			}},
+			{Name: "enabled", Kind: "attr", Type: "bool"},
+			{Name: "hook", Kind: "enum", Repeated: true, Fields: []FieldSchema{
+				{Name: "exec", Kind: "block", Fields: []FieldSchema{
+					{Name: "enabled", Kind: "attr", Type: "bool"},
+				}},
+			}},
+			{Name: "ignore", Kind: "attr", Type: "function"},
+		},
+		Exports: []FieldSchema{
+			{Name: "receiver", Kind: "attr", Type: "capsule"},
+		},
+	}
+	require.Equal(t, expect, schema)
+}
+
+func TestLoader_ComponentSchemas(t *testing.T) {
+	l := NewLoader(LoaderOptions{
+		ComponentGlobals: ComponentGlobals{
+			Logger:        log.NewNopLogger(),
+			TraceProvider: noop.NewTracerProvider(),
+			MinStability:  featuregate.StabilityBeta,
+		},
+		ComponentRegistry: NewRegistryMap(featuregate.StabilityBeta, map[string]component.Registration{
+			"test.schema": {
+				Name:      "test.schema",
+				Stability: featuregate.StabilityBeta,
+				Args:      schemaTestArguments{},
+				Exports:   schemaTestExports{},
+			},
+			"test.exports": {
+				Name:      "test.exports",
+				Stability: featuregate.StabilityBeta,
+				Exports:   schemaTestExports{},
+			},
+			"test.experimental": {
+				Name:      "test.experimental",
+				Stability: featuregate.StabilityExperimental,
+				Args:      schemaTestCommon{},
+			},
+		}),
+	})
+
+	// Registered components are described even though the loaded config
+	// doesn't use them, unless their stability level doesn't allow it.
+	schemas := l.ComponentSchemas()
+	require.Len(t, schemas, 2)
+	require.Equal(t, "test.exports", schemas[0].Name)
+	require.Empty(t, schemas[0].Arguments)
+	require.Equal(t, []FieldSchema{{Name: "receiver", Kind: "attr", Type: "capsule"}}, schemas[0].Exports)
+	require.Equal(t, builtinComponentSchema("test.schema", component.Registration{
+		Args:    schemaTestArguments{},
+		Exports: schemaTestExports{},
+	}), schemas[1])
+}
+
+func TestCustomComponentSchema(t *testing.T) {
+	file, err := parser.ParseFile(t.Name(), []byte(`
+		declare "example" {
+			argument "input" {
+				comment = "The required input."
+			}
+
+			argument "interval" {
+				optional = true
+				default  = "15s"
+			}
+
+			argument "labels" {
+				optional = true
+				default  = ["a", "b"]
+			}
+
+			argument "forced" {
+				optional = false
+			}
+
+			testcomponents.passthrough "pt" {
+				input = argument.input.value
+			}
+
+			export "output" {
+				value = testcomponents.passthrough.pt.output
+			}
+		}
+	`))
+	require.NoError(t, err)
+	require.Len(t, file.Body, 1)
+
+	schema := customComponentSchema("example", file.Body[0].(*ast.BlockStmt).Body)
+
+	expect := ComponentSchema{
+		Name: "example",
+		Arguments: []FieldSchema{
+			{Name: "input", Kind: "attr", Required: true},
+			{Name: "interval", Kind: "attr", Default: `"15s"`},
+			{Name: "labels", Kind: "attr", Default: `["a", "b"]`},
+			{Name: "forced", Kind: "attr", Required: true},
+		},
+		Exports: []FieldSchema{
+			{Name: "output", Kind: "attr"},
+		},
+	}
+	require.Equal(t, expect, schema)
+}
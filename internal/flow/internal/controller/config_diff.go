@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/token"
+)
+
+// BlockChangeType describes how a block changed between two calls to Apply.
+type BlockChangeType string
+
+const (
+	BlockAdded    BlockChangeType = "added"
+	BlockRemoved  BlockChangeType = "removed"
+	BlockModified BlockChangeType = "modified"
+)
+
+// BlockChange is a single block which changed between two calls to Apply.
+// BlockChange never holds the contents of the block, so values such as
+// secrets are never exposed through it.
+type BlockChange struct {
+	Type BlockChangeType
+	ID   string
+	// Position is the position of the block in the config it was loaded
+	// from. For removed blocks, it is the position in the previous config.
+	Position token.Position
+}
+
+// String returns the ID and position of the change, such as
+// "local.file.example (main.river:3:1)".
+func (c BlockChange) String() string {
+	return fmt.Sprintf("%s (%s)", c.ID, c.Position)
+}
+
+// diffBlocks returns the blocks which were added, removed, or modified in
+// next compared to prev. Blocks are matched by ID; a block is modified when
+// its formatted contents differ.
+func diffBlocks(prev, next []*ast.BlockStmt) []BlockChange {
+	prevBlocks := make(map[string]*ast.BlockStmt, len(prev))
+	for _, b := range prev {
+		prevBlocks[BlockComponentID(b).String()] = b
+	}
+
+	var (
+		changes []BlockChange
+		seen    = make(map[string]struct{}, len(next))
+	)
+	for _, b := range next {
+		id := BlockComponentID(b).String()
+		seen[id] = struct{}{}
+
+		old, ok := prevBlocks[id]
+		switch {
+		case !ok:
+			changes = append(changes, BlockChange{Type: BlockAdded, ID: id, Position: ast.StartPos(b).Position()})
+		case !sameBlock(old, b):
+			changes = append(changes, BlockChange{Type: BlockModified, ID: id, Position: ast.StartPos(b).Position()})
+		}
+	}
+	for _, b := range prev {
+		id := BlockComponentID(b).String()
+		if _, ok := seen[id]; !ok {
+			changes = append(changes, BlockChange{Type: BlockRemoved, ID: id, Position: ast.StartPos(b).Position()})
+		}
+	}
+	return changes
+}
+
+// sameBlock reports whether a and b format to the same River text, ignoring
+// where they are located in the config.
+func sameBlock(a, b *ast.BlockStmt) bool {
+	return a == b || sameTemplate(ast.Body{a}, ast.Body{b})
+}
+
+// configDiffLogFields returns the key/value pairs used to log changes.
+func configDiffLogFields(changes []BlockChange) []interface{} {
+	byType := make(map[BlockChangeType][]string)
+	for _, c := range changes {
+		byType[c.Type] = append(byType[c.Type], c.String())
+	}
+
+	var fields []interface{}
+	for _, typ := range []BlockChangeType{BlockAdded, BlockRemoved, BlockModified} {
+		if len(byType[typ]) > 0 {
+			fields = append(fields, string(typ), strings.Join(byType[typ], ", "))
+		}
+	}
+	return fields
+}
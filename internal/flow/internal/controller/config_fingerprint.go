@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/printer"
+)
+
+// ApplyInfo describes the config loaded by the most recent call to Apply.
+type ApplyInfo struct {
+	// Fingerprint identifies the set of loaded blocks. Configs which only
+	// differ by whitespace, comments, or the order of their blocks have the
+	// same fingerprint.
+	Fingerprint string
+	// Generation is incremented by every call to Apply which loaded a config,
+	// starting at 1.
+	Generation uint64
+	// Timestamp is when the config was applied.
+	Timestamp time.Time
+	// Diagnostics is the number of diagnostics reported when applying the
+	// config, including warnings.
+	Diagnostics int
+}
+
+// fingerprintBlocks returns the hex-encoded SHA-256 hash of the canonical
+// form of blocks, sorted by ID.
+func fingerprintBlocks(blocks []*ast.BlockStmt) string {
+	sorted := make([]*ast.BlockStmt, len(blocks))
+	copy(sorted, blocks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return BlockComponentID(sorted[i]).String() < BlockComponentID(sorted[j]).String()
+	})
+
+	var sb strings.Builder
+	for _, b := range sorted {
+		writeCanonicalStmt(&sb, b)
+	}
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeCanonicalStmt writes stmt to w on a single line, without comments
+// and with a fixed spacing. Unlike the printer, which keeps the line breaks
+// of the source, two statements only differing by whitespace are always
+// written the same way.
+func writeCanonicalStmt(w *strings.Builder, stmt ast.Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.AttributeStmt:
+		w.WriteString(stmt.Name.Name + "=")
+		writeCanonicalExpr(w, stmt.Value)
+		w.WriteString(";")
+	case *ast.BlockStmt:
+		w.WriteString(strings.Join(stmt.Name, "."))
+		if stmt.Label != "" {
+			w.WriteString(" " + strconv.Quote(stmt.Label))
+		}
+		w.WriteString("{")
+		for _, s := range stmt.Body {
+			writeCanonicalStmt(w, s)
+		}
+		w.WriteString("}")
+	}
+}
+
+func writeCanonicalExpr(w *strings.Builder, expr ast.Expr) {
+	switch expr := expr.(type) {
+	case *ast.ArrayExpr:
+		w.WriteString("[")
+		for _, e := range expr.Elements {
+			writeCanonicalExpr(w, e)
+			w.WriteString(",")
+		}
+		w.WriteString("]")
+	case *ast.ObjectExpr:
+		w.WriteString("{")
+		for _, f := range expr.Fields {
+			// Quoted and unquoted keys are equivalent.
+			w.WriteString(strconv.Quote(f.Name.Name) + "=")
+			writeCanonicalExpr(w, f.Value)
+			w.WriteString(",")
+		}
+		w.WriteString("}")
+	case *ast.AccessExpr:
+		writeCanonicalExpr(w, expr.Value)
+		w.WriteString("." + expr.Name.Name)
+	case *ast.IndexExpr:
+		writeCanonicalExpr(w, expr.Value)
+		w.WriteString("[")
+		writeCanonicalExpr(w, expr.Index)
+		w.WriteString("]")
+	case *ast.CallExpr:
+		writeCanonicalExpr(w, expr.Value)
+		w.WriteString("(")
+		for _, arg := range expr.Args {
+			writeCanonicalExpr(w, arg)
+			w.WriteString(",")
+		}
+		w.WriteString(")")
+	case *ast.UnaryExpr:
+		w.WriteString(expr.Kind.String())
+		writeCanonicalExpr(w, expr.Value)
+	case *ast.BinaryExpr:
+		w.WriteString("(")
+		writeCanonicalExpr(w, expr.Left)
+		w.WriteString(" " + expr.Kind.String() + " ")
+		writeCanonicalExpr(w, expr.Right)
+		w.WriteString(")")
+	case *ast.ParenExpr:
+		writeCanonicalExpr(w, expr.Inner)
+	default:
+		// Literals and identifiers never span multiple lines.
+		_ = printer.Fprint(w, expr)
+	}
+}
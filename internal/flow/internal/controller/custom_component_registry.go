@@ -49,6 +49,14 @@ func (s *CustomComponentRegistry) registerDeclare(declare *ast.BlockStmt) {
 	s.declares[declare.Label] = declare.Body
 }
 
+// registerDeclareAlias stores a local declare block under name, the label
+// an alias redirects from.
+func (s *CustomComponentRegistry) registerDeclareAlias(name string, declare *ast.BlockStmt) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.declares[name] = declare.Body
+}
+
 // registerImport stores the import namespace.
 // The content will be added later during evaluation.
 // It's important to register it before populating the component nodes
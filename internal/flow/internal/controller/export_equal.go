@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"math"
+	"reflect"
+	"unsafe"
+
+	"github.com/grafana/river"
+)
+
+// moduleExportsEqual reports whether two sets of module exports are equal,
+// comparing their values with exportValuesEqual.
+func moduleExportsEqual(a, b map[string]any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, av := range a {
+		bv, ok := b[name]
+		if !ok || !exportValuesEqual(av, bv) {
+			return false
+		}
+	}
+	return true
+}
+
+// exportValuesEqual reports whether two exported values are equal.
+//
+// Values are compared the way River sees them rather than with
+// reflect.DeepEqual: nil and empty slices or maps are equal, as are NaN
+// floats. Pointers, maps and slices are equal when they're the same, and
+// otherwise compared recursively along with interfaces and the fields of
+// structs, while channels are compared by identity. Functions are only equal
+// when both are nil, as Go can't tell whether two functions are the same.
+//
+// Capsules are opaque to River, so they're only compared by identity: they
+// often hold clients or other handles whose contents mustn't be inspected.
+func exportValuesEqual(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return valuesEqual(reflect.ValueOf(a), reflect.ValueOf(b), make(map[visitedPair]struct{}))
+}
+
+// visitedPair is a pair of pointers being compared, recorded to stop
+// comparing cyclic values.
+type visitedPair struct {
+	a, b unsafe.Pointer
+	typ  reflect.Type
+}
+
+func valuesEqual(a, b reflect.Value, visited map[visitedPair]struct{}) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	if a.Type().Implements(capsuleType) {
+		return capsulesEqual(a, b)
+	}
+
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if a.IsNil() || b.IsNil() {
+			break
+		}
+		if a.UnsafePointer() == b.UnsafePointer() && (a.Kind() != reflect.Slice || a.Len() == b.Len()) {
+			return true
+		}
+		pair := visitedPair{a: a.UnsafePointer(), b: b.UnsafePointer(), typ: a.Type()}
+		if _, ok := visited[pair]; ok {
+			return true
+		}
+		visited[pair] = struct{}{}
+	}
+
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() == b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() == b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float() || (math.IsNaN(a.Float()) && math.IsNaN(b.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.String:
+		return a.String() == b.String()
+
+	case reflect.Chan, reflect.UnsafePointer:
+		return a.UnsafePointer() == b.UnsafePointer()
+	case reflect.Func:
+		return a.IsNil() && b.IsNil()
+
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() && b.IsNil()
+		}
+		return valuesEqual(a.Elem(), b.Elem(), visited)
+
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !valuesEqual(a.Index(i), b.Index(i), visited) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		iter := a.MapRange()
+		for iter.Next() {
+			bv := b.MapIndex(iter.Key())
+			if !bv.IsValid() || !valuesEqual(iter.Value(), bv, visited) {
+				return false
+			}
+		}
+		return true
+
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !valuesEqual(a.Field(i), b.Field(i), visited) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+var capsuleType = reflect.TypeOf((*river.Capsule)(nil)).Elem()
+
+// capsulesEqual reports whether two capsules of the same type are the same.
+// Capsules of reference types are compared by identity, and other capsules
+// with ==, without looking into the values they point to.
+func capsulesEqual(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Chan, reflect.UnsafePointer:
+		return a.UnsafePointer() == b.UnsafePointer()
+	case reflect.Slice:
+		return a.UnsafePointer() == b.UnsafePointer() && a.Len() == b.Len()
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() && b.IsNil()
+		}
+		return a.Elem().Type() == b.Elem().Type() && capsulesEqual(a.Elem(), b.Elem())
+	}
+	if !a.Comparable() {
+		return false
+	}
+	return a.Equal(b)
+}
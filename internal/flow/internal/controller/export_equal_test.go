@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/river/rivertypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportValuesEqual(t *testing.T) {
+	type capsule struct {
+		name string
+		ch   chan int
+	}
+	type cyclic struct {
+		Next *cyclic
+	}
+
+	var (
+		ch       = make(chan int)
+		cycleA   = &cyclic{}
+		cycleB   = &cyclic{}
+		someFunc = func() {}
+		shared   = &capsule{name: "a", ch: ch}
+		slice    = []func(){someFunc}
+		client   = &riverCapsule{name: "a"}
+	)
+	cycleA.Next = cycleA
+	cycleB.Next = cycleB
+
+	tt := []struct {
+		name  string
+		a, b  any
+		equal bool
+	}{
+		{"nil", nil, nil, true},
+		{"nil and value", nil, 1, false},
+		{"different types", int64(1), int32(1), false},
+		{"numbers", 1.5, 1.5, true},
+		{"NaN", math.NaN(), math.NaN(), true},
+		{"strings", "a", "b", false},
+		{"nil and empty slices", []string(nil), []string{}, true},
+		{"slices", []int{1, 2}, []int{2, 1}, false},
+		{"nil and empty maps", map[string]any(nil), map[string]any{}, true},
+		{"maps", map[string]any{"a": 1, "b": []any{"c"}}, map[string]any{"b": []any{"c"}, "a": 1}, true},
+		{"maps with different values", map[string]any{"a": 1}, map[string]any{"a": 2}, false},
+		{"maps with different keys", map[string]any{"a": 1}, map[string]any{"b": 1}, false},
+		{"pointers", &capsule{name: "a"}, &capsule{name: "a"}, true},
+		{"pointers to different values", &capsule{name: "a"}, &capsule{name: "b"}, false},
+		{"same channel", capsule{ch: ch}, capsule{ch: ch}, true},
+		{"different channels", capsule{ch: ch}, capsule{ch: make(chan int)}, false},
+		{"functions", someFunc, someFunc, false},
+		{"nil functions", (func())(nil), (func())(nil), true},
+		{"cyclic values", cycleA, cycleB, true},
+		{"same pointer", shared, shared, true},
+		{"same slice", slice, slice, true},
+		{"same slice with different lengths", slice[:0], slice, false},
+		{"same capsule", client, client, true},
+		{"capsules with the same contents", client, &riverCapsule{name: "a"}, false},
+		{"capsule values", rivertypes.Secret("a"), rivertypes.Secret("a"), true},
+		{"different capsule values", rivertypes.Secret("a"), rivertypes.Secret("b"), false},
+		{"capsules in maps", map[string]any{"c": client}, map[string]any{"c": client}, true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.equal, exportValuesEqual(tc.a, tc.b))
+			require.Equal(t, tc.equal, exportValuesEqual(tc.b, tc.a))
+		})
+	}
+}
+
+// riverCapsule is a capsule whose contents would be equal if compared
+// recursively.
+type riverCapsule struct{ name string }
+
+func (*riverCapsule) RiverCapsule() {}
@@ -0,0 +1,248 @@
+package controller_test
+
+import (
+	"context"
+	"hash/fnv"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow/internal/controller"
+	"github.com/grafana/agent/internal/flow/internal/testcomponents"
+	"github.com/grafana/agent/internal/flow/internal/worker"
+	"github.com/grafana/agent/internal/flow/logging"
+	"github.com/grafana/agent/internal/service"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestLoader_ExportTransforms(t *testing.T) {
+	// Two simulated peers share the same config and each only evaluates the
+	// targets it owns.
+	peers := []*fakeShardingService{
+		{self: 0, peers: 2},
+		{self: 1, peers: 2},
+	}
+	loaders := make([]*controller.Loader, len(peers))
+	updated := make([]chan controller.BlockNode, len(peers))
+	for i, svc := range peers {
+		loaders[i], updated[i] = newShardedLoader(t, svc)
+	}
+
+	config := []byte(`
+		testcomponents.targets "discovered" {
+			targets = [
+				{"__address__" = "a:80"},
+				{"__address__" = "b:80"},
+				{"__address__" = "c:80"},
+				{"__address__" = "d:80"},
+				{"__address__" = "e:80"},
+				{"__address__" = "f:80"},
+			]
+		}
+
+		testcomponents.targets "scraped" {
+			targets = testcomponents.targets.discovered.targets
+		}
+	`)
+	for _, l := range loaders {
+		require.NoError(t, applyFromContent(t, l, config, nil, nil).ErrorOrNil())
+	}
+
+	// Each target is evaluated by exactly one peer.
+	var all []map[string]string
+	for i, l := range loaders {
+		shard := scrapedTargets(t, l)
+		require.NotEmpty(t, shard)
+		for _, target := range shard {
+			require.True(t, peers[i].owns(target))
+		}
+		all = append(all, shard...)
+
+		// The exports of the discovering component are left untouched.
+		require.Len(t, componentTargets(t, l, "testcomponents.targets.discovered"), 6)
+	}
+	require.ElementsMatch(t, componentTargets(t, loaders[0], "testcomponents.targets.discovered"), all)
+
+	// Drop the updates queued by the exports set while applying the config.
+	for len(updated[0]) > 0 {
+		<-updated[0]
+	}
+
+	// When the second peer leaves, the first one owns all the targets and
+	// the dependants of the discovering component are evaluated again.
+	peers[0].setPeers(1)
+	var node controller.BlockNode
+	select {
+	case node = <-updated[0]:
+	case <-time.After(time.Second):
+		require.FailNow(t, "component wasn't queued for reevaluation")
+	}
+	require.Equal(t, "testcomponents.targets.discovered", node.NodeID())
+	require.Len(t, updated[0], 0, "components without transformed exports are never queued")
+
+	loaders[0].EvaluateDependants(context.Background(), []*controller.QueuedNode{{Node: node, LastUpdatedTime: time.Now()}})
+	require.Eventually(t, func() bool {
+		return len(scrapedTargets(t, loaders[0])) == 6
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Watchers are unregistered on cleanup.
+	for _, l := range loaders {
+		l.Cleanup(true)
+	}
+	for _, svc := range peers {
+		require.Empty(t, svc.watchers)
+	}
+}
+
+func TestLoader_ExportTransformsWrongType(t *testing.T) {
+	// A transform returning a value of another type leaves the exports
+	// untransformed instead of panicking during evaluation.
+	l, _ := newShardedLoader(t, &fakeShardingService{self: 0, peers: 2, wrongType: true})
+
+	config := []byte(`
+		testcomponents.targets "discovered" {
+			targets = [
+				{"__address__" = "a:80"},
+				{"__address__" = "b:80"},
+			]
+		}
+
+		testcomponents.targets "scraped" {
+			targets = testcomponents.targets.discovered.targets
+		}
+	`)
+	require.NoError(t, applyFromContent(t, l, config, nil, nil).ErrorOrNil())
+	require.Len(t, scrapedTargets(t, l), 2)
+
+	l.Cleanup(true)
+}
+
+func newShardedLoader(t *testing.T, svc *fakeShardingService) (*controller.Loader, chan controller.BlockNode) {
+	t.Helper()
+
+	logger, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+
+	updated := make(chan controller.BlockNode, 10)
+	l := controller.NewLoader(controller.LoaderOptions{
+		ComponentGlobals: controller.ComponentGlobals{
+			Logger:            logger,
+			TraceProvider:     noop.NewTracerProvider(),
+			DataPath:          t.TempDir(),
+			MinStability:      featuregate.StabilityBeta,
+			OnBlockNodeUpdate: func(cn controller.BlockNode) { updated <- cn },
+			NewModuleController: func(id string) controller.ModuleController {
+				return nil
+			},
+		},
+		Services:   []service.Service{svc},
+		WorkerPool: worker.NewFixedWorkerPool(1, 10),
+	})
+	return l, updated
+}
+
+func scrapedTargets(t *testing.T, l *controller.Loader) []map[string]string {
+	return componentTargets(t, l, "testcomponents.targets.scraped")
+}
+
+func componentTargets(t *testing.T, l *controller.Loader, id string) []map[string]string {
+	t.Helper()
+
+	node := l.Graph().GetByID(id)
+	require.NotNil(t, node)
+	return node.(controller.ComponentNode).Exports().(testcomponents.TargetsExports).Targets
+}
+
+// fakeShardingService splits lists of targets between peers by hashing their
+// address.
+type fakeShardingService struct {
+	mut      sync.Mutex
+	self     int
+	peers    int
+	watchers map[int]func()
+	nextID   int
+
+	// wrongType makes the transform return a value of another type.
+	wrongType bool
+}
+
+var (
+	_ service.Service           = (*fakeShardingService)(nil)
+	_ service.ExportTransformer = (*fakeShardingService)(nil)
+)
+
+func (s *fakeShardingService) Definition() service.Definition {
+	return service.Definition{Name: "fake_sharding"}
+}
+
+func (s *fakeShardingService) Run(ctx context.Context, host service.Host) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (s *fakeShardingService) Update(newConfig any) error { return nil }
+
+func (s *fakeShardingService) Data() any { return nil }
+
+func (s *fakeShardingService) ExportTransforms() []service.ExportTransform {
+	return []service.ExportTransform{{
+		Type: reflect.TypeOf([]map[string]string(nil)),
+		Transform: func(v any) any {
+			if s.wrongType {
+				return "not a list of targets"
+			}
+			var owned []map[string]string
+			for _, target := range v.([]map[string]string) {
+				if s.owns(target) {
+					owned = append(owned, target)
+				}
+			}
+			return owned
+		},
+	}}
+}
+
+func (s *fakeShardingService) WatchExportTransforms(onChange func()) func() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.watchers == nil {
+		s.watchers = make(map[int]func())
+	}
+	id := s.nextID
+	s.nextID++
+	s.watchers[id] = onChange
+
+	return func() {
+		s.mut.Lock()
+		defer s.mut.Unlock()
+		delete(s.watchers, id)
+	}
+}
+
+func (s *fakeShardingService) owns(target map[string]string) bool {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(target["__address__"]))
+	return h.Sum32()%uint32(s.peers) == uint32(s.self)
+}
+
+func (s *fakeShardingService) setPeers(peers int) {
+	s.mut.Lock()
+	s.peers = peers
+	watchers := make([]func(), 0, len(s.watchers))
+	for _, w := range s.watchers {
+		watchers = append(watchers, w)
+	}
+	s.mut.Unlock()
+
+	for _, w := range watchers {
+		w()
+	}
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/flow/internal/dag"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/vm"
+)
+
+// maxProfiledExpressions is the number of expressions kept in the evaluation
+// profile of a node.
+const maxProfiledExpressions = 5
+
+// expressionProfiler records the time spent in the function calls of the
+// expressions of the nodes, to find the expressions which make evaluations
+// slow, such as decoding large JSON documents.
+type expressionProfiler struct {
+	mut      sync.Mutex
+	profiles map[string][]component.ExpressionTiming // NodeID -> profile of the last evaluation
+}
+
+func newExpressionProfiler() *expressionProfiler {
+	return &expressionProfiler{profiles: make(map[string][]component.ExpressionTiming)}
+}
+
+// profile returns a scope to evaluate n with instead of scope, in which the
+// functions called by the expressions of n are timed. The returned function
+// records the profile of the evaluation once it's done.
+func (p *expressionProfiler) profile(n BlockNode, scope *vm.Scope) (*vm.Scope, func()) {
+	block := n.Block()
+	if block == nil {
+		return scope, func() {}
+	}
+
+	var (
+		timings = make(map[string]*component.ExpressionTiming)
+		wrapped = make(map[string]interface{})
+	)
+	for _, name := range calledFunctions(block.Body) {
+		fn, ok := scope.Lookup(name)
+		if !ok {
+			continue
+		}
+		rv := reflect.ValueOf(fn)
+		if rv.Kind() != reflect.Func {
+			continue
+		}
+		timing := &component.ExpressionTiming{Expression: name + "()"}
+		timings[name] = timing
+		wrapped[name] = timedFunction(rv, timing).Interface()
+	}
+	if len(wrapped) == 0 {
+		return scope, func() { p.record(n.NodeID(), nil) }
+	}
+
+	// The wrapped functions shadow the functions they wrap, wherever they're
+	// defined.
+	profiled := &vm.Scope{Parent: scope, Variables: wrapped}
+	return profiled, func() {
+		res := make([]component.ExpressionTiming, 0, len(timings))
+		for _, t := range timings {
+			if t.Calls > 0 {
+				res = append(res, *t)
+			}
+		}
+		p.record(n.NodeID(), res)
+	}
+}
+
+// timedFunction wraps fn to add the duration of its calls to timing.
+func timedFunction(fn reflect.Value, timing *component.ExpressionTiming) reflect.Value {
+	return reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+		start := time.Now()
+		defer func() {
+			timing.Calls++
+			timing.Duration += time.Since(start)
+		}()
+
+		if fn.Type().IsVariadic() {
+			return fn.CallSlice(args)
+		}
+		return fn.Call(args)
+	})
+}
+
+// record stores the slowest expressions of the last evaluation of a node.
+func (p *expressionProfiler) record(nodeID string, timings []component.ExpressionTiming) {
+	sort.Slice(timings, func(i, j int) bool {
+		if timings[i].Duration != timings[j].Duration {
+			return timings[i].Duration > timings[j].Duration
+		}
+		return timings[i].Expression < timings[j].Expression
+	})
+	if len(timings) > maxProfiledExpressions {
+		timings = timings[:maxProfiledExpressions]
+	}
+
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.profiles[nodeID] = timings
+}
+
+// get returns the slowest expressions of the last evaluation of a node.
+func (p *expressionProfiler) get(nodeID string) []component.ExpressionTiming {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	return p.profiles[nodeID]
+}
+
+// sync forgets the profiles of the nodes which aren't in g anymore.
+func (p *expressionProfiler) sync(g *dag.Graph) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	for id := range p.profiles {
+		if g.GetByID(id) == nil {
+			delete(p.profiles, id)
+		}
+	}
+}
+
+// calledFunctions returns the names of the functions called by name in body,
+// such as json_decode.
+func calledFunctions(body ast.Body) []string {
+	var w callWalker
+	ast.Walk(&w, body)
+	return w.names
+}
+
+type callWalker struct {
+	names []string
+	seen  map[string]struct{}
+}
+
+func (cw *callWalker) Visit(node ast.Node) ast.Visitor {
+	call, ok := node.(*ast.CallExpr)
+	if !ok {
+		return cw
+	}
+	if ident, ok := call.Value.(*ast.IdentifierExpr); ok {
+		if cw.seen == nil {
+			cw.seen = make(map[string]struct{})
+		}
+		if _, ok := cw.seen[ident.Ident.Name]; !ok {
+			cw.seen[ident.Ident.Name] = struct{}{}
+			cw.names = append(cw.names, ident.Ident.Name)
+		}
+	}
+	return cw
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/internal/dag"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/parser"
+	"github.com/grafana/river/vm"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// profiledNode is a BlockNode evaluating the expressions of its block.
+type profiledNode struct {
+	block *ast.BlockStmt
+	args  profiledArgs
+}
+
+type profiledArgs struct {
+	Slow string `river:"slow,attr"`
+	Fast string `river:"fast,attr"`
+}
+
+func (n *profiledNode) NodeID() string               { return "test.profiled" }
+func (n *profiledNode) Block() *ast.BlockStmt        { return n.block }
+func (n *profiledNode) UpdateBlock(b *ast.BlockStmt) { n.block = b }
+func (n *profiledNode) Evaluate(scope *vm.Scope) error {
+	return vm.New(n.block.Body).Evaluate(scope, &n.args)
+}
+
+func TestLoader_ProfileExpressions(t *testing.T) {
+	file, err := parser.ParseFile(t.Name(), []byte(`
+		test "profiled" {
+			slow = slow_upper("hello")
+			fast = format("%s-%s", "a", slow_upper("b"))
+		}
+	`))
+	require.NoError(t, err)
+
+	// The scope holds a deliberately slow custom function along with the
+	// components, and the stdlib functions are looked up through it.
+	scope := &vm.Scope{Variables: map[string]interface{}{
+		"slow_upper": func(s string) string {
+			time.Sleep(50 * time.Millisecond)
+			return strings.ToUpper(s)
+		},
+	}}
+
+	newLoader := func(profile bool) *Loader {
+		return NewLoader(LoaderOptions{
+			ComponentGlobals: ComponentGlobals{
+				Logger:        log.NewNopLogger(),
+				TraceProvider: noop.NewTracerProvider(),
+			},
+			ProfileExpressions: profile,
+		})
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		l := newLoader(true)
+		n := &profiledNode{block: file.Body[0].(*ast.BlockStmt)}
+
+		require.NoError(t, l.evaluateNode(log.NewNopLogger(), n, scope))
+		require.Equal(t, profiledArgs{Slow: "HELLO", Fast: "a-B"}, n.args)
+
+		// The calls to the slow function are the slowest expression, and the
+		// calls of all the expressions are counted. The arguments of a call
+		// are evaluated before it, so format doesn't include slow_upper.
+		profile := l.EvaluationProfile(n.NodeID())
+		require.Len(t, profile, 2)
+		require.Equal(t, "slow_upper()", profile[0].Expression)
+		require.Equal(t, 2, profile[0].Calls)
+		require.GreaterOrEqual(t, profile[0].Duration, 100*time.Millisecond)
+		require.Equal(t, "format()", profile[1].Expression)
+		require.Equal(t, 1, profile[1].Calls)
+		require.Less(t, profile[1].Duration, 50*time.Millisecond)
+
+		// Profiles are forgotten once the node is removed from the graph.
+		var g dag.Graph
+		g.Add(n)
+		l.profiler.sync(&g)
+		require.Len(t, l.EvaluationProfile(n.NodeID()), 2)
+		l.profiler.sync(&dag.Graph{})
+		require.Nil(t, l.EvaluationProfile(n.NodeID()))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		l := newLoader(false)
+		n := &profiledNode{block: file.Body[0].(*ast.BlockStmt)}
+
+		require.NoError(t, l.evaluateNode(log.NewNopLogger(), n, scope))
+		require.Equal(t, profiledArgs{Slow: "HELLO", Fast: "a-B"}, n.args)
+		require.Nil(t, l.EvaluationProfile(n.NodeID()))
+	})
+}
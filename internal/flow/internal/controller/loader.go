@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/flow/internal/dag"
 	"github.com/grafana/agent/internal/flow/internal/worker"
 	"github.com/grafana/agent/internal/flow/logging/level"
@@ -19,9 +21,11 @@ import (
 	"github.com/grafana/river/ast"
 	"github.com/grafana/river/diag"
 	"github.com/hashicorp/go-multierror"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
 )
 
 // The Loader builds and evaluates ComponentNodes from River blocks.
@@ -32,12 +36,15 @@ type Loader struct {
 	services   []service.Service
 	host       service.Host
 	workerPool worker.Pool
+	critical   []string // IDs of the critical components.
 	// backoffConfig is used to backoff when an updated component's dependencies cannot be submitted to worker
 	// pool for evaluation in EvaluateDependants, because the queue is full. This is an unlikely scenario, but when
 	// it happens we should avoid retrying too often to give other goroutines a chance to progress. Having a backoff
 	// also prevents log spamming with errors.
 	backoffConfig        backoff.Config
 	componentNodeManager *ComponentNodeManager
+	transforms           []service.ExportTransform // Transforms of exports provided by services
+	unwatchTransforms    []func()                  // Unregisters the watchers of transforms
 
 	mut               sync.RWMutex
 	graph             *dag.Graph
@@ -45,12 +52,21 @@ type Loader struct {
 	componentNodes    []ComponentNode
 	declareNodes      map[string]*DeclareNode
 	importConfigNodes map[string]*ImportConfigNode
+	aliases           aliasMap
 	serviceNodes      []*ServiceNode
 	cache             *valueCache
 	blocks            []*ast.BlockStmt // Most recently loaded blocks, used for writing
+	lastDiff          []BlockChange    // Blocks changed by the most recent Apply
+	applyInfo         ApplyInfo        // Config loaded by the most recent Apply
 	cm                *controllerMetrics
 	cc                *controllerCollector
+	damper            *updateDamper
+	reevaluations     *reevaluationScheduler
+	retries           *retryScheduler
+	profiler          *expressionProfiler // Nil when expressions aren't profiled.
 	moduleExportIndex int
+
+	submitting atomic.Int64 // Number of calls to EvaluateDependants in progress
 }
 
 // LoaderOptions holds options for creating a Loader.
@@ -62,6 +78,25 @@ type LoaderOptions struct {
 	Host              service.Host      // Service host (when running services).
 	ComponentRegistry ComponentRegistry // Registry to search for components.
 	WorkerPool        worker.Pool       // Worker pool to use for async tasks.
+	MaxDeclareLabels  int               // Maximum number of declare label values in custom component metrics.
+
+	// MinUpdateInterval is the minimum time between two evaluations of the
+	// dependants of a component caused by changes of its exports. Changes
+	// within the interval are coalesced. Disabled when zero.
+	MinUpdateInterval time.Duration
+
+	// CriticalComponents are the IDs of the components whose failure is
+	// reported by CheckCriticalComponents.
+	CriticalComponents []string
+
+	// RetryPolicy configures the retries of nodes which fail evaluation.
+	// Failed nodes aren't retried when its MaxBackoff is zero.
+	RetryPolicy RetryPolicy
+
+	// ProfileExpressions enables timing the function calls of the
+	// expressions of every node evaluation. The slowest expressions of the
+	// last evaluation of a node are returned by EvaluationProfile.
+	ProfileExpressions bool
 }
 
 // NewLoader creates a new Loader. Components built by the Loader will be built
@@ -85,6 +120,7 @@ func NewLoader(opts LoaderOptions) *Loader {
 		services:   services,
 		host:       host,
 		workerPool: opts.WorkerPool,
+		critical:   opts.CriticalComponents,
 
 		componentNodeManager: NewComponentNodeManager(globals, reg),
 
@@ -98,18 +134,60 @@ func NewLoader(opts LoaderOptions) *Loader {
 		graph:         &dag.Graph{},
 		originalGraph: &dag.Graph{},
 		cache:         newValueCache(),
-		cm:            newControllerMetrics(globals.ControllerID),
+		cm:            newControllerMetrics(globals.ControllerID, opts.MaxDeclareLabels),
 	}
 	l.cc = newControllerCollector(l, globals.ControllerID)
+	l.damper = newUpdateDamper(opts.MinUpdateInterval, func(n BlockNode) {
+		if globals.OnBlockNodeUpdate != nil {
+			globals.OnBlockNodeUpdate(n)
+		}
+	}, l.cm.coalescedUpdates.Inc)
+	l.reevaluations = newReevaluationScheduler(l.submitReevaluation)
+	l.retries = newRetryScheduler(opts.RetryPolicy, l.submitRetry)
+	if opts.ProfileExpressions {
+		l.profiler = newExpressionProfiler()
+	}
 
 	if globals.Registerer != nil {
-		globals.Registerer.MustRegister(l.cc)
-		globals.Registerer.MustRegister(l.cm)
+		for _, c := range []prometheus.Collector{l.cc, l.cm} {
+			if err := registerCollector(globals.Registerer, c); err != nil {
+				level.Error(l.log).Log("msg", "failed to register controller metrics", "err", err)
+			}
+		}
 	}
 
+	for _, svc := range services {
+		transformer, ok := svc.(service.ExportTransformer)
+		if !ok {
+			continue
+		}
+		l.transforms = append(l.transforms, transformer.ExportTransforms()...)
+		l.unwatchTransforms = append(l.unwatchTransforms, transformer.WatchExportTransforms(l.onExportTransformsChange))
+	}
+	l.cache.SetExportTransforms(l.transforms)
+
 	return l
 }
 
+// onExportTransformsChange queues the components with transformed exports
+// for reevaluation, so that their dependants are evaluated with the new
+// transformed values.
+func (l *Loader) onExportTransformsChange() {
+	if l.globals.OnBlockNodeUpdate == nil {
+		return
+	}
+
+	l.mut.RLock()
+	nodes := l.componentNodes
+	l.mut.RUnlock()
+
+	for _, n := range nodes {
+		if hasTransformedExports(n.Exports(), l.transforms) {
+			l.globals.OnBlockNodeUpdate(n)
+		}
+	}
+}
+
 // ApplyOptions are options that can be provided when loading a new River config.
 type ApplyOptions struct {
 	Args map[string]any // input values of a module (nil for the root module)
@@ -156,6 +234,10 @@ func (l *Loader) Apply(options ApplyOptions) diag.Diagnostics {
 	if diags.HasErrors() {
 		return diags
 	}
+	for _, d := range diags {
+		level.Warn(l.log).Log("msg", "configuration warning", "pos", d.StartPos, "warning", d.Message)
+	}
+	l.cache.SyncAliases(l.aliases.Targets(&newGraph))
 
 	var (
 		components   = make([]ComponentNode, 0)
@@ -196,10 +278,18 @@ func (l *Loader) Apply(options ApplyOptions) diag.Diagnostics {
 			componentIDs = append(componentIDs, n.ID())
 
 			if err = l.evaluate(logger, n); err != nil {
-				var evalDiags diag.Diagnostics
-				if errors.As(err, &evalDiags) {
+				var (
+					instanceErr *InstanceError
+					evalDiags   diag.Diagnostics
+				)
+				switch {
+				case errors.As(err, &instanceErr):
+					// A failing custom component instance is only marked
+					// unhealthy, the rest of the config still applies.
+					diags = append(diags, instanceErr.Diagnostics(n.Block())...)
+				case errors.As(err, &evalDiags):
 					diags = append(diags, evalDiags...)
-				} else {
+				default:
 					diags.Add(diag.Diagnostic{
 						Severity: diag.SeverityLevelError,
 						Message:  fmt.Sprintf("Failed to build component: %s", err),
@@ -240,6 +330,10 @@ func (l *Loader) Apply(options ApplyOptions) diag.Diagnostics {
 			}
 		}
 
+		if bn, ok := n.(BlockNode); ok {
+			l.retries.update(bn, err)
+		}
+
 		// We only use the error for updating the span status; we don't return the
 		// error because we want to evaluate as many nodes as we can.
 		if err != nil {
@@ -253,8 +347,15 @@ func (l *Loader) Apply(options ApplyOptions) diag.Diagnostics {
 	l.componentNodes = components
 	l.serviceNodes = services
 	l.graph = &newGraph
+	l.damper.sync(l.graph)
+	l.reevaluations.sync(l.graph)
+	l.retries.sync(l.graph)
+	if l.profiler != nil {
+		l.profiler.sync(l.graph)
+	}
 	l.cache.SyncIDs(componentIDs)
-	l.blocks = options.ComponentBlocks
+	l.applyBlocks(options)
+	l.updateApplyInfo(start, len(diags))
 	if l.globals.OnExportsChange != nil && l.cache.ExportChangeIndex() != l.moduleExportIndex {
 		l.moduleExportIndex = l.cache.ExportChangeIndex()
 		l.globals.OnExportsChange(l.cache.CreateModuleExports())
@@ -262,16 +363,97 @@ func (l *Loader) Apply(options ApplyOptions) diag.Diagnostics {
 	return diags
 }
 
-// Cleanup unregisters any existing metrics and optionally stops the worker pool.
+// Validate builds the graph for options the same way Apply does, and returns
+// the diagnostics found while building it. The state of the Loader isn't
+// changed and no component is built or evaluated: the blocks are loaded into
+// a scratch Loader, so existing nodes are never updated with the new blocks.
+func (l *Loader) Validate(options ApplyOptions) diag.Diagnostics {
+	scratch := &Loader{
+		log:      l.log,
+		tracer:   l.tracer,
+		globals:  l.globals,
+		services: l.services,
+		host:     l.host,
+
+		componentNodeManager: NewComponentNodeManager(l.globals, l.componentNodeManager.builtinComponentReg),
+
+		graph:         &dag.Graph{},
+		originalGraph: &dag.Graph{},
+		cache:         newValueCache(),
+		cm:            newControllerMetrics(l.globals.ControllerID, 0),
+	}
+	scratch.componentNodeManager.setCustomComponentRegistry(NewCustomComponentRegistry(options.CustomComponentRegistry))
+
+	_, diags := scratch.loadNewGraph(options.Args, options.ComponentBlocks, options.ConfigBlocks, options.DeclareBlocks)
+	return diags
+}
+
+// applyBlocks stores the blocks loaded by Apply and logs which of them
+// changed since the previous Apply. l.mut must be held when calling
+// applyBlocks.
+func (l *Loader) applyBlocks(options ApplyOptions) {
+	blocks := make([]*ast.BlockStmt, 0, len(options.ComponentBlocks)+len(options.ConfigBlocks)+len(options.DeclareBlocks))
+	blocks = append(blocks, options.ComponentBlocks...)
+	blocks = append(blocks, options.ConfigBlocks...)
+	blocks = append(blocks, options.DeclareBlocks...)
+
+	l.lastDiff = diffBlocks(l.blocks, blocks)
+	l.blocks = blocks
+
+	if len(l.lastDiff) > 0 {
+		fields := append([]interface{}{"msg", "configuration changed"}, configDiffLogFields(l.lastDiff)...)
+		level.Info(l.log).Log(fields...)
+	}
+}
+
+// updateApplyInfo records that the blocks stored by applyBlocks were applied
+// at start, with the given number of diagnostics. l.mut must be held when
+// calling updateApplyInfo.
+func (l *Loader) updateApplyInfo(start time.Time, diagnostics int) {
+	l.applyInfo = ApplyInfo{
+		Fingerprint: fingerprintBlocks(l.blocks),
+		Generation:  l.applyInfo.Generation + 1,
+		Timestamp:   start,
+		Diagnostics: diagnostics,
+	}
+	l.cm.onConfigApplied(l.applyInfo)
+}
+
+// ApplyInfo returns information about the config loaded by the most recent
+// call to Apply. The generation of a Loader which never loaded a config is
+// zero.
+func (l *Loader) ApplyInfo() ApplyInfo {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+	return l.applyInfo
+}
+
+// LastConfigDiff returns the blocks which were added, removed, or modified by
+// the most recent call to Apply. Only block IDs and positions are reported,
+// never block contents.
+func (l *Loader) LastConfigDiff() []BlockChange {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+	return l.lastDiff
+}
+
+// Cleanup unregisters any existing metrics and watchers of export transforms
+// and optionally stops the worker pool.
 func (l *Loader) Cleanup(stopWorkerPool bool) {
+	l.damper.stop()
+	l.reevaluations.stop()
+	l.retries.stop()
+	for _, unwatch := range l.unwatchTransforms {
+		unwatch()
+	}
 	if stopWorkerPool {
 		l.workerPool.Stop()
 	}
 	if l.globals.Registerer == nil {
 		return
 	}
-	l.globals.Registerer.Unregister(l.cm)
-	l.globals.Registerer.Unregister(l.cc)
+	unregisterCollector(l.globals.Registerer, l.cm)
+	unregisterCollector(l.globals.Registerer, l.cc)
 }
 
 // loadNewGraph creates a new graph from the provided blocks and validates it.
@@ -281,14 +463,25 @@ func (l *Loader) loadNewGraph(args map[string]any, componentBlocks []*ast.BlockS
 	// Split component blocks into blocks for components and services.
 	componentBlocks, serviceBlocks := l.splitComponentBlocks(componentBlocks)
 
+	// Alias blocks don't become nodes of the graph, they're resolved when
+	// wiring the edges of the graph.
+	aliasBlocks, configBlocks := splitAliasBlocks(configBlocks)
+	aliases, diags := newAliasMap(aliasBlocks)
+
 	// Fill our graph with service blocks, which must be added before any other
 	// block.
-	diags := l.populateServiceNodes(&g, serviceBlocks)
+	serviceDiags := l.populateServiceNodes(&g, serviceBlocks)
+	diags = append(diags, serviceDiags...)
 
 	// Fill our graph with declare blocks, must be added before componentNodes.
 	declareDiags := l.populateDeclareNodes(&g, declareBlocks)
 	diags = append(diags, declareDiags...)
 
+	// Register the aliases to declare blocks before the components which may
+	// instantiate them.
+	declareAliasDiags := l.registerDeclareAliases(aliases)
+	diags = append(diags, declareAliasDiags...)
+
 	// Fill our graph with config blocks.
 	configBlockDiags := l.populateConfigBlockNodes(args, &g, configBlocks)
 	diags = append(diags, configBlockDiags...)
@@ -297,8 +490,12 @@ func (l *Loader) loadNewGraph(args map[string]any, componentBlocks []*ast.BlockS
 	componentNodeDiags := l.populateComponentNodes(&g, componentBlocks)
 	diags = append(diags, componentNodeDiags...)
 
+	// Validate aliases now that all the nodes they may point to are known.
+	aliasDiags := aliases.Validate(&g)
+	diags = append(diags, aliasDiags...)
+
 	// Write up the edges of the graph
-	wireDiags := l.wireGraphEdges(&g)
+	wireDiags := l.wireGraphEdges(&g, aliases)
 	diags = append(diags, wireDiags...)
 
 	// Validate graph to detect cycles
@@ -308,6 +505,12 @@ func (l *Loader) loadNewGraph(args map[string]any, componentBlocks []*ast.BlockS
 		return g, diags
 	}
 
+	// Only keep the aliases of a valid graph, so that a failed load doesn't
+	// change how the current graph is resolved.
+	if !diags.HasErrors() {
+		l.aliases = aliases
+	}
+
 	// Copy the original graph, this is so we can have access to the original graph for things like displaying a UI or
 	// debug information.
 	l.originalGraph = g.Clone()
@@ -375,6 +578,20 @@ func (l *Loader) populateDeclareNodes(g *dag.Graph, declareBlocks []*ast.BlockSt
 	return diags
 }
 
+// registerDeclareAliases registers the aliases which point to a declare
+// block, so that blocks using the old label of the declare instantiate it.
+func (l *Loader) registerDeclareAliases(aliases aliasMap) diag.Diagnostics {
+	diags := aliases.resolveDeclares(l.declareNodes)
+	for from, a := range aliases {
+		if a.declare == nil {
+			continue
+		}
+		l.componentNodeManager.customComponentReg.registerDeclareAlias(from, a.declare.Block())
+		l.declareNodes[from] = a.declare
+	}
+	return diags
+}
+
 // blockAlreadyDefined returns (diag, true) if the given id is already in the provided blockMap.
 // else it adds the block to the map and returns (empty diag, false).
 func blockAlreadyDefined(blockMap map[string]*ast.BlockStmt, id string, block *ast.BlockStmt) (diag.Diagnostic, bool) {
@@ -429,10 +646,14 @@ func (l *Loader) populateServiceNodes(g *dag.Graph, serviceBlocks []*ast.BlockSt
 	for _, block := range serviceBlocks {
 		blockID := BlockComponentID(block).String()
 
+		// Services are shared by the root controller and all the modules, so a
+		// block configuring one in a module would compete with the block of the
+		// root configuration.
 		if !l.isRootController() {
 			diags.Add(diag.Diagnostic{
 				Severity: diag.SeverityLevelError,
-				Message:  fmt.Sprintf("service blocks not allowed inside a module: %q", blockID),
+				Message: fmt.Sprintf("service blocks not allowed inside a module: %q; services are shared with the root configuration, "+
+					"which is the only one that can configure them", blockID),
 				StartPos: ast.StartPos(block).Position(),
 				EndPos:   ast.EndPos(block).Position(),
 			})
@@ -555,6 +776,10 @@ func (l *Loader) populateComponentNodes(g *dag.Graph, componentBlocks []*ast.Blo
 				})
 				continue
 			}
+			if cc, ok := c.(*CustomComponentNode); ok {
+				cc.onTemplateChange = l.cm.onCustomComponentReinstantiated
+				l.cm.onCustomComponentInstantiated(componentName)
+			}
 			g.Add(c)
 		}
 	}
@@ -563,7 +788,7 @@ func (l *Loader) populateComponentNodes(g *dag.Graph, componentBlocks []*ast.Blo
 }
 
 // Wire up all the related nodes
-func (l *Loader) wireGraphEdges(g *dag.Graph) diag.Diagnostics {
+func (l *Loader) wireGraphEdges(g *dag.Graph, aliases aliasMap) diag.Diagnostics {
 	var diags diag.Diagnostics
 
 	for _, n := range g.Nodes() {
@@ -597,10 +822,13 @@ func (l *Loader) wireGraphEdges(g *dag.Graph) diag.Diagnostics {
 			continue
 		case *CustomComponentNode:
 			l.wireCustomComponentNode(g, n)
+			if a, ok := aliases[n.customComponentName]; ok && a.declare != nil && n.importNamespace == "" {
+				diags.Add(a.declareDeprecationWarning(n))
+			}
 		}
 
 		// Finally, wire component references.
-		refs, nodeDiags := ComponentReferences(n, g)
+		refs, nodeDiags := ComponentReferences(n, g, aliases)
 		for _, ref := range refs {
 			g.AddEdge(dag.Edge{From: n, To: ref.Target})
 		}
@@ -639,6 +867,67 @@ func (l *Loader) Components() []ComponentNode {
 	return l.componentNodes
 }
 
+// CheckCriticalComponents returns an error naming the critical components
+// which are unhealthy or not defined, or nil if all of them are healthy or
+// their health is still unknown.
+func (l *Loader) CheckCriticalComponents() error {
+	if len(l.critical) == 0 {
+		return nil
+	}
+
+	nodes := make(map[string]ComponentNode)
+	for _, cn := range l.Components() {
+		nodes[cn.NodeID()] = cn
+	}
+
+	var reasons []string
+	for _, id := range l.critical {
+		cn, ok := nodes[id]
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("critical component %s is not defined", id))
+			continue
+		}
+		if health := cn.CurrentHealth(); health.Health == component.HealthTypeUnhealthy {
+			reasons = append(reasons, fmt.Sprintf("critical component %s is unhealthy: %s", id, health.Message))
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(reasons, "; "))
+}
+
+// ModuleArguments returns the values taken by the arguments declared by the
+// loaded module, sorted by name. Arguments which are required but weren't
+// supplied are omitted.
+func (l *Loader) ModuleArguments() []ModuleArgument {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+
+	var res []ModuleArgument
+	for _, n := range l.graph.Nodes() {
+		argNode, ok := n.(*ArgumentConfigNode)
+		if !ok {
+			continue
+		}
+		value, isDefault, ok := l.cache.GetModuleArgument(argNode.Label())
+		if !ok {
+			continue
+		}
+		source := ArgumentSourceSupplied
+		if isDefault {
+			source = ArgumentSourceDefault
+		}
+		res = append(res, ModuleArgument{
+			Name:   argNode.Label(),
+			Source: source,
+			Value:  scrubSecrets(value),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
 // Services returns the current set of service nodes.
 func (l *Loader) Services() []*ServiceNode {
 	l.mut.RLock()
@@ -668,6 +957,31 @@ func (l *Loader) OriginalGraph() *dag.Graph {
 	return l.originalGraph.Clone()
 }
 
+// EvaluationProfile returns the slowest expressions of the last evaluation
+// of the node with the given ID, slowest first. It returns nil unless
+// LoaderOptions.ProfileExpressions is set.
+func (l *Loader) EvaluationProfile(nodeID string) []component.ExpressionTiming {
+	if l.profiler == nil {
+		return nil
+	}
+	return l.profiler.get(nodeID)
+}
+
+// Dependants returns the IDs of the nodes which directly depend on each node
+// of the graph, by node ID. See Scheduler.Drain.
+func (l *Loader) Dependants() map[string][]string {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+
+	res := make(map[string][]string)
+	for _, n := range l.graph.Nodes() {
+		for _, dep := range l.graph.Dependants(n) {
+			res[n.NodeID()] = append(res[n.NodeID()], dep.NodeID())
+		}
+	}
+	return res
+}
+
 // EvaluateDependants sends nodes which depend directly on nodes in updatedNodes for evaluation to the
 // workerPool. It should be called whenever nodes update their exports.
 // It is beneficial to call EvaluateDependants with a batch of nodes, as it will enqueue the entire batch before
@@ -678,6 +992,9 @@ func (l *Loader) EvaluateDependants(ctx context.Context, updatedNodes []*QueuedN
 	if len(updatedNodes) == 0 {
 		return
 	}
+	l.submitting.Inc()
+	defer l.submitting.Dec()
+
 	tracer := l.tracer.Tracer("")
 	spanCtx, span := tracer.Start(context.Background(), "SubmitDependantsForEvaluation", trace.WithSpanKind(trace.SpanKindInternal))
 	span.SetAttributes(attribute.Int("originators_count", len(updatedNodes)))
@@ -690,8 +1007,15 @@ func (l *Loader) EvaluateDependants(ctx context.Context, updatedNodes []*QueuedN
 	l.mut.RLock()
 	defer l.mut.RUnlock()
 
+	now := time.Now()
 	dependenciesToParentsMap := make(map[dag.Node]*QueuedNode)
 	for _, parent := range updatedNodes {
+		// Updates coalesced by the damper are requeued at the end of the
+		// interval, so skip them for now.
+		if !l.damper.allow(parent.Node, now) {
+			continue
+		}
+
 		switch parentNode := parent.Node.(type) {
 		case ComponentNode:
 			// Make sure we're in-sync with the current exports of parent.
@@ -754,11 +1078,61 @@ func (l *Loader) EvaluateDependants(ctx context.Context, updatedNodes []*QueuedN
 	l.cm.evaluationQueueSize.Set(float64(l.workerPool.QueueSize()))
 }
 
+// submitReevaluation submits n to the worker pool for a periodic
+// re-evaluation. Since it uses the same key as evaluations caused by updates
+// of its dependencies, it is coalesced with any such evaluation which is
+// already queued.
+func (l *Loader) submitReevaluation(n BlockNode) {
+	l.cm.scheduledReevaluations.Inc()
+
+	if err := l.submitNode(n, "SubmitForReevaluation"); err != nil {
+		// The node is submitted again at the end of its next interval.
+		level.Warn(l.log).Log("msg", "failed to submit node for periodic re-evaluation", "node_id", n.NodeID(), "err", err)
+	}
+}
+
+// submitRetry submits n to the worker pool to retry its failed evaluation.
+// Like periodic re-evaluations, it's coalesced with any evaluation of the
+// node which is already queued.
+func (l *Loader) submitRetry(n BlockNode) {
+	l.cm.evaluationRetries.WithLabelValues(nodeTypeLabel(n)).Inc()
+
+	if err := l.submitNode(n, "SubmitForRetry"); err != nil {
+		level.Warn(l.log).Log("msg", "failed to submit node for evaluation retry", "node_id", n.NodeID(), "err", err)
+		// Back off further before the next retry.
+		l.retries.update(n, err)
+	}
+}
+
+// submitNode submits n to the worker pool to be evaluated with the current
+// exports of its dependencies, tracing the submission with a span named
+// spanName.
+func (l *Loader) submitNode(n BlockNode, spanName string) error {
+	tracer := l.tracer.Tracer("")
+	spanCtx, span := tracer.Start(context.Background(), spanName, trace.WithSpanKind(trace.SpanKindInternal))
+	span.SetAttributes(attribute.String("node_id", n.NodeID()))
+	defer span.End()
+
+	// The node is its own originator: it's evaluated with the current
+	// exports of its dependencies.
+	queued := &QueuedNode{Node: n, LastUpdatedTime: time.Now()}
+	globalUniqueKey := path.Join(l.globals.ControllerID, n.NodeID())
+	err := l.workerPool.SubmitWithKey(globalUniqueKey, func() {
+		l.concurrentEvalFn(n, spanCtx, tracer, queued)
+	})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	span.SetStatus(codes.Ok, "node submitted for evaluation")
+	return nil
+}
+
 // concurrentEvalFn returns a function that evaluates a node and updates the cache. This function can be submitted to
 // a worker pool for asynchronous evaluation.
 func (l *Loader) concurrentEvalFn(n dag.Node, spanCtx context.Context, tracer trace.Tracer, parent *QueuedNode) {
 	start := time.Now()
-	l.cm.dependenciesWaitTime.Observe(time.Since(parent.LastUpdatedTime).Seconds())
+	l.cm.onDependencyWait(nodeTypeLabel(n), time.Since(parent.LastUpdatedTime))
 	_, span := tracer.Start(spanCtx, "EvaluateNode", trace.WithSpanKind(trace.SpanKindInternal))
 	span.SetAttributes(attribute.String("node_id", n.NodeID()))
 	defer span.End()
@@ -773,12 +1147,19 @@ func (l *Loader) concurrentEvalFn(n dag.Node, spanCtx context.Context, tracer tr
 	switch n := n.(type) {
 	case BlockNode:
 		ectx := l.cache.BuildContext()
-		evalErr := n.Evaluate(ectx)
+		evalErr := l.evaluateNode(l.log, n, ectx)
 
 		// Only obtain loader lock after we have evaluated the node, allowing for concurrent evaluation.
 		l.mut.RLock()
 		err = l.postEvaluate(l.log, n, evalErr)
 
+		// Nodes may change their re-evaluation interval when evaluated. Nodes
+		// removed from the graph meanwhile aren't scheduled again.
+		if l.graph.GetByID(n.NodeID()) == n {
+			l.reevaluations.update(n)
+			l.retries.update(n, err)
+		}
+
 		// Additional post-evaluation steps necessary for module exports.
 		if exp, ok := n.(*ExportConfigNode); ok {
 			l.cache.CacheModuleExportValue(exp.Label(), exp.Value())
@@ -811,7 +1192,7 @@ func (l *Loader) concurrentEvalFn(n dag.Node, spanCtx context.Context, tracer tr
 // evaluates it. mut must be held when calling evaluate.
 func (l *Loader) evaluate(logger log.Logger, bn BlockNode) error {
 	ectx := l.cache.BuildContext()
-	err := bn.Evaluate(ectx)
+	err := l.evaluateNode(logger, bn, ectx)
 	return l.postEvaluate(logger, bn, err)
 }
 
@@ -827,7 +1208,7 @@ func (l *Loader) postEvaluate(logger log.Logger, bn BlockNode, err error) error
 	case *ArgumentConfigNode:
 		if _, found := l.cache.moduleArguments[c.Label()]; !found {
 			if c.Optional() {
-				l.cache.CacheModuleArgument(c.Label(), c.Default())
+				l.cache.CacheModuleArgumentDefault(c.Label(), c.Default())
 			} else {
 				// NOTE: this masks the previous evaluation error, but we treat a missing module arguments as
 				// a more important error to address.
@@ -1,7 +1,9 @@
 package controller_test
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"testing"
@@ -15,6 +17,7 @@ import (
 	"github.com/grafana/river/diag"
 	"github.com/grafana/river/parser"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/trace/noop"
 
@@ -183,6 +186,51 @@ func TestLoader(t *testing.T) {
 		require.ErrorContains(t, diags.ErrorOrNil(), "stability levels must be defined: got \"beta\" as stability of component \"testcomponents.tick\" and <invalid_stability_level> as the minimum stability level")
 	})
 
+	t.Run("Load experimental component", func(t *testing.T) {
+		experimentalFile := `
+			testcomponents.experimental "example" {}
+		`
+
+		tt := []struct {
+			name         string
+			minStability featuregate.Stability
+			expectedErr  string
+		}{
+			{
+				name:         "allowed by flag",
+				minStability: featuregate.StabilityExperimental,
+			},
+			{
+				name:         "denied at beta",
+				minStability: featuregate.StabilityBeta,
+				expectedErr:  `component "testcomponents.experimental" is at stability level "experimental", which is below the minimum allowed stability level "beta". Use --stability.level command-line flag to enable "experimental" features`,
+			},
+			{
+				name:         "denied at stable",
+				minStability: featuregate.StabilityStable,
+				expectedErr:  `component "testcomponents.experimental" is at stability level "experimental", which is below the minimum allowed stability level "stable". Use --stability.level command-line flag to enable "experimental" features`,
+			},
+		}
+
+		for _, tc := range tt {
+			t.Run(tc.name, func(t *testing.T) {
+				l := controller.NewLoader(newLoaderOptionsWithStability(tc.minStability))
+				diags := applyFromContent(t, l, []byte(experimentalFile), nil, nil)
+				if tc.expectedErr == "" {
+					require.NoError(t, diags.ErrorOrNil())
+					require.NotNil(t, l.Graph().GetByID("testcomponents.experimental.example"))
+					return
+				}
+
+				require.Len(t, diags, 1)
+				require.Equal(t, diag.SeverityLevelError, diags[0].Severity)
+				require.Contains(t, diags[0].Message, tc.expectedErr)
+				// The diagnostic must point at the offending block.
+				require.Equal(t, 2, diags[0].StartPos.Line)
+			})
+		}
+	})
+
 	t.Run("Partial load with invalid reference", func(t *testing.T) {
 		invalidFile := `
 			testcomponents.tick "ticker" {
@@ -360,6 +408,509 @@ func TestScopeWithFailingComponent(t *testing.T) {
 	require.True(t, strings.Contains(diags.Error(), `unrecognized attribute name "frequenc"`))
 }
 
+// panicRegistry is a ComponentRegistry which adds a testcomponents.panic
+// component whose Build always panics.
+type panicRegistry struct {
+	controller.ComponentRegistry
+}
+
+func (r panicRegistry) Get(name string) (component.Registration, error) {
+	if name != "testcomponents.panic" {
+		return r.ComponentRegistry.Get(name)
+	}
+	return component.Registration{
+		Name:      "testcomponents.panic",
+		Stability: featuregate.StabilityStable,
+		Args:      struct{}{},
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			panic("something went wrong")
+		},
+	}, nil
+}
+
+func TestLoader_EvaluationPanic(t *testing.T) {
+	testFile := `
+		testcomponents.panic "broken" {
+		}
+
+		testcomponents.passthrough "static" {
+			input = "hello, world!"
+		}
+	`
+	l, _ := logging.New(os.Stderr, logging.DefaultOptions)
+	loader := controller.NewLoader(controller.LoaderOptions{
+		ComponentGlobals: controller.ComponentGlobals{
+			Logger:            l,
+			TraceProvider:     noop.NewTracerProvider(),
+			DataPath:          t.TempDir(),
+			MinStability:      featuregate.StabilityBeta,
+			OnBlockNodeUpdate: func(cn controller.BlockNode) { /* no-op */ },
+			Registerer:        prometheus.NewRegistry(),
+			NewModuleController: func(id string) controller.ModuleController {
+				return nil
+			},
+		},
+		ComponentRegistry: panicRegistry{controller.NewDefaultComponentRegistry(featuregate.StabilityBeta)},
+	})
+
+	diags := applyFromContent(t, loader, []byte(testFile), nil, nil)
+	require.Len(t, diags, 1)
+	require.Contains(t, diags[0].Message, "panic while evaluating testcomponents.panic.broken: something went wrong")
+
+	// The other components are still loaded, and the panicking one is
+	// reported as unhealthy.
+	require.Len(t, loader.Components(), 2)
+	for _, c := range loader.Components() {
+		switch c.NodeID() {
+		case "testcomponents.panic.broken":
+			require.Equal(t, component.HealthTypeUnhealthy, c.CurrentHealth().Health)
+			require.Contains(t, c.CurrentHealth().Message, "panic while evaluating testcomponents.panic.broken")
+		case "testcomponents.passthrough.static":
+			require.NotEqual(t, component.HealthTypeUnhealthy, c.CurrentHealth().Health)
+		}
+	}
+}
+
+func TestLoader_ConfigDiff(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := logging.New(&logs, logging.DefaultOptions)
+	require.NoError(t, err)
+
+	l := controller.NewLoader(controller.LoaderOptions{
+		ComponentGlobals: controller.ComponentGlobals{
+			Logger:            logger,
+			TraceProvider:     noop.NewTracerProvider(),
+			DataPath:          t.TempDir(),
+			MinStability:      featuregate.StabilityBeta,
+			OnBlockNodeUpdate: func(cn controller.BlockNode) { /* no-op */ },
+			Registerer:        prometheus.NewRegistry(),
+			NewModuleController: func(id string) controller.ModuleController {
+				return nil
+			},
+		},
+	})
+
+	type change struct {
+		Type controller.BlockChangeType
+		ID   string
+		Line int
+	}
+	lastDiff := func() []change {
+		var res []change
+		for _, c := range l.LastConfigDiff() {
+			res = append(res, change{Type: c.Type, ID: c.ID, Line: c.Position.Line})
+		}
+		return res
+	}
+
+	diags := applyFromContent(t, l,
+		[]byte(`
+			testcomponents.passthrough "static" {
+				input = "hunter2"
+			}
+
+			testcomponents.passthrough "removed" {
+				input = "hello"
+			}
+		`),
+		[]byte(`
+			logging {
+				level = "debug"
+			}
+		`),
+		[]byte(`
+			declare "a" {}
+		`),
+	)
+	require.NoError(t, diags.ErrorOrNil())
+	require.Equal(t, []change{
+		{controller.BlockAdded, "testcomponents.passthrough.static", 2},
+		{controller.BlockAdded, "testcomponents.passthrough.removed", 6},
+		{controller.BlockAdded, "logging", 2},
+		{controller.BlockAdded, "declare.a", 2},
+	}, lastDiff())
+
+	// Moving a block without changing it isn't reported.
+	logs.Reset()
+	diags = applyFromContent(t, l,
+		[]byte(`
+			testcomponents.passthrough "removed" {
+				input = "hello"
+			}
+
+			testcomponents.passthrough "static" {
+				input = "correct horse battery staple"
+			}
+
+			testcomponents.passthrough "added" {
+				input = "hello"
+			}
+		`),
+		[]byte(`
+			logging {
+				level = "info"
+			}
+		`),
+		nil,
+	)
+	require.NoError(t, diags.ErrorOrNil())
+	require.Equal(t, []change{
+		{controller.BlockModified, "testcomponents.passthrough.static", 6},
+		{controller.BlockAdded, "testcomponents.passthrough.added", 10},
+		{controller.BlockModified, "logging", 2},
+		{controller.BlockRemoved, "declare.a", 2},
+	}, lastDiff())
+
+	// The change is logged once, with IDs and positions but without values.
+	var changeLogs []string
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, "configuration changed") {
+			changeLogs = append(changeLogs, line)
+		}
+	}
+	require.Len(t, changeLogs, 1)
+	require.Contains(t, changeLogs[0], "testcomponents.passthrough.static (TestLoader_ConfigDiff:6:4)")
+	require.Contains(t, changeLogs[0], "declare.a (TestLoader_ConfigDiff:2:4)")
+	require.NotContains(t, changeLogs[0], "hunter2")
+	require.NotContains(t, changeLogs[0], "correct horse battery staple")
+
+	// Applying the same config again changes nothing.
+	logs.Reset()
+	diags = applyFromContent(t, l,
+		[]byte(`
+			testcomponents.passthrough "removed" {
+				input = "hello"
+			}
+
+			testcomponents.passthrough "static" {
+				input = "correct horse battery staple"
+			}
+
+			testcomponents.passthrough "added" {
+				input = "hello"
+			}
+		`),
+		[]byte(`
+			logging {
+				level = "info"
+			}
+		`),
+		nil,
+	)
+	require.NoError(t, diags.ErrorOrNil())
+	require.Empty(t, l.LastConfigDiff())
+	require.NotContains(t, logs.String(), "configuration changed")
+}
+
+func TestLoader_ApplyInfo(t *testing.T) {
+	logger, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+
+	reg := prometheus.NewRegistry()
+	l := controller.NewLoader(controller.LoaderOptions{
+		ComponentGlobals: controller.ComponentGlobals{
+			Logger:            logger,
+			TraceProvider:     noop.NewTracerProvider(),
+			DataPath:          t.TempDir(),
+			MinStability:      featuregate.StabilityBeta,
+			OnBlockNodeUpdate: func(cn controller.BlockNode) { /* no-op */ },
+			Registerer:        reg,
+			NewModuleController: func(id string) controller.ModuleController {
+				return nil
+			},
+		},
+	})
+	require.Zero(t, l.ApplyInfo().Generation)
+
+	diags := applyFromContent(t, l, []byte(`
+		testcomponents.passthrough "a" {
+			input = "hello"
+		}
+
+		testcomponents.passthrough "b" {
+			input = testcomponents.passthrough.a.output
+			lag   = "1ms"
+		}
+	`), nil, []byte(`
+		declare "d" {
+			argument "in" {
+				optional = true
+				default  = ["x", "y"]
+			}
+		}
+	`))
+	require.NoError(t, diags.ErrorOrNil())
+	first := l.ApplyInfo()
+	require.Equal(t, uint64(1), first.Generation)
+	require.Len(t, first.Fingerprint, 64)
+	require.Zero(t, first.Diagnostics)
+	require.False(t, first.Timestamp.IsZero())
+
+	// The same blocks with different whitespace, comments, and order have the
+	// same fingerprint, but a new generation.
+	diags = applyFromContent(t, l, []byte(`
+		// The second passthrough.
+		testcomponents.passthrough "b" {
+			input = testcomponents.passthrough.a.output
+
+			lag = "1ms"
+		}
+		testcomponents.passthrough "a" { input = "hello" }
+	`), nil, []byte(`
+		declare "d" {
+			argument "in" {
+				optional = true
+				default  = [
+					"x",
+					"y",
+				]
+			}
+		}
+	`))
+	require.NoError(t, diags.ErrorOrNil())
+	second := l.ApplyInfo()
+	require.Equal(t, uint64(2), second.Generation)
+	require.Equal(t, first.Fingerprint, second.Fingerprint)
+
+	// Changing a value changes the fingerprint.
+	diags = applyFromContent(t, l, []byte(`
+		testcomponents.passthrough "a" {
+			input = "hello"
+		}
+
+		testcomponents.passthrough "b" {
+			input = testcomponents.passthrough.a.output
+			lag   = "2ms"
+		}
+	`), nil, []byte(`
+		declare "d" {
+			argument "in" {
+				optional = true
+				default  = ["x", "y"]
+			}
+		}
+	`))
+	require.NoError(t, diags.ErrorOrNil())
+	third := l.ApplyInfo()
+	require.Equal(t, uint64(3), third.Generation)
+	require.NotEqual(t, first.Fingerprint, third.Fingerprint)
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+		# HELP agent_component_controller_config_generation Number of times a config was applied by the controller
+		# TYPE agent_component_controller_config_generation gauge
+		agent_component_controller_config_generation{controller_id="",controller_path="/"} 3
+		# HELP agent_component_controller_config_info Fingerprint of the config most recently applied by the controller, always set to 1
+		# TYPE agent_component_controller_config_info gauge
+		agent_component_controller_config_info{controller_id="",controller_path="/",fingerprint=%q} 1
+	`, third.Fingerprint)), "agent_component_controller_config_generation", "agent_component_controller_config_info"))
+}
+
+func TestLoader_NestedControllerMetrics(t *testing.T) {
+	logger, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+
+	reg := prometheus.NewRegistry()
+	newLoader := func(id string) *controller.Loader {
+		return controller.NewLoader(controller.LoaderOptions{
+			ComponentGlobals: controller.ComponentGlobals{
+				Logger:            logger,
+				TraceProvider:     noop.NewTracerProvider(),
+				DataPath:          t.TempDir(),
+				MinStability:      featuregate.StabilityBeta,
+				OnBlockNodeUpdate: func(cn controller.BlockNode) { /* no-op */ },
+				Registerer:        reg,
+				NewModuleController: func(id string) controller.ModuleController {
+					return nil
+				},
+				ControllerID: id,
+			},
+		})
+	}
+
+	controllerPaths := func() []string {
+		families, err := reg.Gather()
+		require.NoError(t, err)
+
+		var paths []string
+		for _, mf := range families {
+			if mf.GetName() != "agent_component_controller_config_generation" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, lp := range m.GetLabel() {
+					if lp.GetName() == "controller_path" {
+						paths = append(paths, lp.GetValue())
+					}
+				}
+			}
+		}
+		return paths
+	}
+
+	parent := newLoader("module.file.a")
+	child := newLoader("module.file.a/module.file.b")
+	require.ElementsMatch(t, []string{"/module.file.a", "/module.file.a/module.file.b"}, controllerPaths())
+
+	// A controller replacing another one with the same path, such as a
+	// reloaded module, takes over its metrics.
+	replacement := newLoader("module.file.a/module.file.b")
+	require.ElementsMatch(t, []string{"/module.file.a", "/module.file.a/module.file.b"}, controllerPaths())
+
+	// Cleaning up the replaced controller leaves the metrics of its
+	// replacement registered.
+	child.Cleanup(false)
+	require.ElementsMatch(t, []string{"/module.file.a", "/module.file.a/module.file.b"}, controllerPaths())
+
+	replacement.Cleanup(false)
+	require.ElementsMatch(t, []string{"/module.file.a"}, controllerPaths())
+	parent.Cleanup(false)
+	require.Empty(t, controllerPaths())
+}
+
+func TestLoader_ModuleExportsUnchanged(t *testing.T) {
+	logger, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+
+	var changes []map[string]any
+	l := controller.NewLoader(controller.LoaderOptions{
+		ComponentGlobals: controller.ComponentGlobals{
+			Logger:            logger,
+			TraceProvider:     noop.NewTracerProvider(),
+			DataPath:          t.TempDir(),
+			MinStability:      featuregate.StabilityBeta,
+			OnBlockNodeUpdate: func(cn controller.BlockNode) { /* no-op */ },
+			OnExportsChange:   func(exports map[string]any) { changes = append(changes, exports) },
+			Registerer:        prometheus.NewRegistry(),
+			NewModuleController: func(id string) controller.ModuleController {
+				return nil
+			},
+			ControllerID: "module",
+		},
+	})
+
+	exports := []byte(`
+		export "list" {
+			value = ["a", "b"]
+		}
+
+		export "object" {
+			value = { c = 1, d = [], e = { f = "g" } }
+		}
+	`)
+	diags := applyFromContent(t, l, nil, exports, nil)
+	require.NoError(t, diags.ErrorOrNil())
+	require.Len(t, changes, 1)
+
+	// Applying the same exports again doesn't report a change.
+	diags = applyFromContent(t, l, nil, exports, nil)
+	require.NoError(t, diags.ErrorOrNil())
+	require.Len(t, changes, 1)
+
+	diags = applyFromContent(t, l, nil, []byte(`
+		export "list" {
+			value = ["a", "b"]
+		}
+	`), nil)
+	require.NoError(t, diags.ErrorOrNil())
+	require.Len(t, changes, 2)
+	require.Equal(t, map[string]any{"list": []any{"a", "b"}}, changes[1])
+}
+
+func TestLoader_ComponentLogLevel(t *testing.T) {
+	var logs bytes.Buffer
+	logger, err := logging.New(&logs, logging.DefaultOptions)
+	require.NoError(t, err)
+
+	l := controller.NewLoader(controller.LoaderOptions{
+		ComponentGlobals: controller.ComponentGlobals{
+			Logger:            logger,
+			TraceProvider:     noop.NewTracerProvider(),
+			DataPath:          t.TempDir(),
+			MinStability:      featuregate.StabilityBeta,
+			OnBlockNodeUpdate: func(cn controller.BlockNode) { /* no-op */ },
+			Registerer:        prometheus.NewRegistry(),
+			NewModuleController: func(id string) controller.ModuleController {
+				return nil
+			},
+		},
+	})
+
+	// The passthrough component logs its input at info level on every update.
+	diags := applyFromContent(t, l, []byte(`
+		testcomponents.passthrough "a" {
+			input     = "a1"
+			log_level = "warn"
+		}
+
+		testcomponents.passthrough "b" {
+			input = "b1"
+		}
+	`), nil, nil)
+	require.NoError(t, diags.ErrorOrNil())
+	require.NotContains(t, logs.String(), "value=a1")
+	require.Contains(t, logs.String(), "value=b1")
+
+	// Changing log_level applies to the running components.
+	diags = applyFromContent(t, l, []byte(`
+		testcomponents.passthrough "a" {
+			input = "a2"
+		}
+
+		testcomponents.passthrough "b" {
+			input     = "b2"
+			log_level = "error"
+		}
+	`), nil, nil)
+	require.NoError(t, diags.ErrorOrNil())
+	require.Contains(t, logs.String(), "value=a2")
+	require.NotContains(t, logs.String(), "value=b2")
+
+	// A component can log at a more verbose level than the logging block.
+	diags = applyFromContent(t, l, []byte(`
+		testcomponents.passthrough "a" {
+			input = "a2"
+		}
+
+		testcomponents.passthrough "b" {
+			input     = "b2"
+			log_level = "debug"
+		}
+	`), []byte(`
+		logging {
+			level = "error"
+		}
+	`), nil)
+	require.NoError(t, diags.ErrorOrNil())
+	diags = applyFromContent(t, l, []byte(`
+		testcomponents.passthrough "a" {
+			input = "a3"
+		}
+
+		testcomponents.passthrough "b" {
+			input     = "b3"
+			log_level = "debug"
+		}
+	`), []byte(`
+		logging {
+			level = "error"
+		}
+	`), nil)
+	require.NoError(t, diags.ErrorOrNil())
+	require.NotContains(t, logs.String(), "value=a3")
+	require.Contains(t, logs.String(), "value=b3")
+
+	diags = applyFromContent(t, l, []byte(`
+		testcomponents.passthrough "a" {
+			input     = "a4"
+			log_level = "verbose"
+		}
+	`), nil, nil)
+	require.Error(t, diags.ErrorOrNil())
+	require.Len(t, diags, 1)
+	require.Equal(t, diag.SeverityLevelError, diags[0].Severity)
+	require.Contains(t, diags[0].Message, `unrecognized log level "verbose"`)
+}
+
 func applyFromContent(t *testing.T, l *controller.Loader, componentBytes []byte, configBytes []byte, declareBytes []byte) diag.Diagnostics {
 	t.Helper()
 
@@ -1,26 +1,111 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
+	"path"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/grafana/agent/internal/flow/internal/dag"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// DefaultMaxDeclareLabels is the default maximum number of distinct values of
+// the declare label exposed by the custom component metrics.
+const DefaultMaxDeclareLabels = 100
+
+const (
+	// declareOverflowLabel is used as the declare label of custom components
+	// once the maximum number of distinct declare labels has been reached.
+	declareOverflowLabel = "__overflow__"
+)
+
+// controllerPath returns the controller_path label value of the controller
+// with the given ID: the IDs of the module instances it's nested in, joined
+// with slashes. The root controller has the path "/".
+func controllerPath(id string) string {
+	return "/" + strings.Trim(path.Clean("/"+id), "/")
+}
+
+// controllerLabels returns the constant labels of the metrics of the
+// controller with the given ID.
+func controllerLabels(id string) prometheus.Labels {
+	return prometheus.Labels{
+		"controller_id":   id,
+		"controller_path": controllerPath(id),
+	}
+}
+
+// registerCollector registers c with reg. A collector with the same
+// descriptors is registered by a controller with the same path which hasn't
+// been cleaned up yet, such as a module being replaced; it's unregistered in
+// favor of c.
+func registerCollector(reg prometheus.Registerer, c prometheus.Collector) error {
+	err := reg.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if !errors.As(err, &are) {
+		return err
+	}
+	reg.Unregister(are.ExistingCollector)
+	return reg.Register(c)
+}
+
+// unregisterCollector unregisters c from reg, unless c was replaced by
+// another collector since it was registered.
+func unregisterCollector(reg prometheus.Registerer, c prometheus.Collector) {
+	// Registering c again is the only way to find out which collector is
+	// registered with its descriptors.
+	err := reg.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) && are.ExistingCollector != c {
+		return
+	}
+	reg.Unregister(c)
+}
+
 // controllerMetrics contains the metrics for components controller
 type controllerMetrics struct {
-	controllerEvaluation        prometheus.Gauge
-	componentEvaluationTime     prometheus.Histogram
-	dependenciesWaitTime        prometheus.Histogram
-	evaluationQueueSize         prometheus.Gauge
-	slowComponentThreshold      time.Duration
-	slowComponentEvaluationTime *prometheus.CounterVec
+	controllerEvaluation            prometheus.Gauge
+	componentEvaluationTime         prometheus.Histogram
+	dependenciesWaitTime            *prometheus.HistogramVec
+	dependenciesMaxWaitTime         *prometheus.Desc
+	evaluationQueueSize             prometheus.Gauge
+	evaluationPanics                prometheus.Counter
+	coalescedUpdates                prometheus.Counter
+	scheduledReevaluations          prometheus.Counter
+	evaluationRetries               *prometheus.CounterVec
+	slowComponentThreshold          time.Duration
+	slowComponentEvaluationTime     *prometheus.CounterVec
+	customComponentInstantiations   *prometheus.CounterVec
+	customComponentReinstantiations *prometheus.CounterVec
+	configGeneration                prometheus.Gauge
+	configInfo                      *prometheus.GaugeVec
+
+	declareLabelsMut sync.Mutex
+	maxDeclareLabels int
+	declareLabels    map[string]struct{}
+
+	// maxWaitTimes holds the longest time a node of each type waited to be
+	// evaluated since the metrics were last collected.
+	maxWaitTimesMut sync.Mutex
+	maxWaitTimes    map[string]time.Duration
 }
 
-// newControllerMetrics inits the metrics for the components controller
-func newControllerMetrics(id string) *controllerMetrics {
+// newControllerMetrics inits the metrics for the components controller.
+// maxDeclareLabels bounds the number of distinct declare label values; it
+// defaults to DefaultMaxDeclareLabels when zero.
+func newControllerMetrics(id string, maxDeclareLabels int) *controllerMetrics {
+	if maxDeclareLabels <= 0 {
+		maxDeclareLabels = DefaultMaxDeclareLabels
+	}
+
 	cm := &controllerMetrics{
 		slowComponentThreshold: 1 * time.Minute,
+		maxDeclareLabels:       maxDeclareLabels,
+		declareLabels:          make(map[string]struct{}),
+		maxWaitTimes:           make(map[string]time.Duration),
 	}
 
 	// The evaluation time becomes particularly problematic in the range of 30s+, so add more buckets
@@ -31,47 +116,135 @@ func newControllerMetrics(id string) *controllerMetrics {
 	cm.controllerEvaluation = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name:        "agent_component_controller_evaluating",
 		Help:        "Tracks if the controller is currently in the middle of a graph evaluation",
-		ConstLabels: map[string]string{"controller_id": id},
+		ConstLabels: controllerLabels(id),
 	})
 
 	cm.componentEvaluationTime = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Name:                            "agent_component_evaluation_seconds",
 			Help:                            "Time spent performing component evaluation",
-			ConstLabels:                     map[string]string{"controller_id": id},
+			ConstLabels:                     controllerLabels(id),
 			Buckets:                         evaluationTimesBuckets,
 			NativeHistogramBucketFactor:     1.1,
 			NativeHistogramMaxBucketNumber:  100,
 			NativeHistogramMinResetDuration: 1 * time.Hour,
 		},
 	)
-	cm.dependenciesWaitTime = prometheus.NewHistogram(
+	cm.dependenciesWaitTime = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:                            "agent_component_dependencies_wait_seconds",
 			Help:                            "Time spent by components waiting to be evaluated after their dependency is updated.",
-			ConstLabels:                     map[string]string{"controller_id": id},
+			ConstLabels:                     controllerLabels(id),
 			Buckets:                         evaluationTimesBuckets,
 			NativeHistogramBucketFactor:     1.1,
 			NativeHistogramMaxBucketNumber:  100,
 			NativeHistogramMinResetDuration: 1 * time.Hour,
 		},
+		[]string{"node_type"},
+	)
+	cm.dependenciesMaxWaitTime = prometheus.NewDesc(
+		"agent_component_dependencies_max_wait_seconds",
+		"Longest time spent by a node waiting to be evaluated after its dependency is updated, since the previous scrape.",
+		[]string{"node_type"},
+		controllerLabels(id),
 	)
 
 	cm.evaluationQueueSize = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name:        "agent_component_evaluation_queue_size",
 		Help:        "Tracks the number of components waiting to be evaluated in the worker pool",
-		ConstLabels: map[string]string{"controller_id": id},
+		ConstLabels: controllerLabels(id),
+	})
+
+	cm.evaluationPanics = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "agent_component_evaluation_panics_total",
+		Help:        "Number of node evaluations which panicked",
+		ConstLabels: controllerLabels(id),
 	})
 
+	cm.coalescedUpdates = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "agent_component_coalesced_updates_total",
+		Help:        "Number of component updates whose propagation to dependants was deferred by the minimum update interval",
+		ConstLabels: controllerLabels(id),
+	})
+
+	cm.scheduledReevaluations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "agent_component_scheduled_reevaluations_total",
+		Help:        "Number of periodic re-evaluations of components which requested them",
+		ConstLabels: controllerLabels(id),
+	})
+
+	cm.evaluationRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "agent_component_evaluation_retries_total",
+		Help:        "Number of retries of nodes which failed evaluation",
+		ConstLabels: controllerLabels(id),
+	}, []string{"node_type"})
+
 	cm.slowComponentEvaluationTime = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name:        "agent_component_evaluation_slow_seconds",
 		Help:        fmt.Sprintf("Number of seconds spent evaluating components that take longer than %v to evaluate", cm.slowComponentThreshold),
-		ConstLabels: map[string]string{"controller_id": id},
+		ConstLabels: controllerLabels(id),
 	}, []string{"component_id"})
 
+	cm.customComponentInstantiations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "agent_component_controller_custom_component_instantiations_total",
+		Help:        "Number of custom components created from a declare block",
+		ConstLabels: controllerLabels(id),
+	}, []string{"declare"})
+
+	cm.customComponentReinstantiations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "agent_component_controller_custom_component_reinstantiations_total",
+		Help:        "Number of times a running custom component was reloaded because its declare block changed",
+		ConstLabels: controllerLabels(id),
+	}, []string{"declare"})
+
+	cm.configGeneration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "agent_component_controller_config_generation",
+		Help:        "Number of times a config was applied by the controller",
+		ConstLabels: controllerLabels(id),
+	})
+
+	cm.configInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "agent_component_controller_config_info",
+		Help:        "Fingerprint of the config most recently applied by the controller, always set to 1",
+		ConstLabels: controllerLabels(id),
+	}, []string{"fingerprint"})
+
 	return cm
 }
 
+// onConfigApplied reports the generation and fingerprint of the config
+// described by info.
+func (cm *controllerMetrics) onConfigApplied(info ApplyInfo) {
+	cm.configGeneration.Set(float64(info.Generation))
+	cm.configInfo.Reset()
+	cm.configInfo.WithLabelValues(info.Fingerprint).Set(1)
+}
+
+// declareLabel returns the declare label value to use for the custom
+// component name. Once maxDeclareLabels distinct names have been seen, any
+// other name is reported as declareOverflowLabel.
+func (cm *controllerMetrics) declareLabel(name string) string {
+	cm.declareLabelsMut.Lock()
+	defer cm.declareLabelsMut.Unlock()
+
+	if _, ok := cm.declareLabels[name]; ok {
+		return name
+	}
+	if len(cm.declareLabels) >= cm.maxDeclareLabels {
+		return declareOverflowLabel
+	}
+	cm.declareLabels[name] = struct{}{}
+	return name
+}
+
+func (cm *controllerMetrics) onCustomComponentInstantiated(name string) {
+	cm.customComponentInstantiations.WithLabelValues(cm.declareLabel(name)).Inc()
+}
+
+func (cm *controllerMetrics) onCustomComponentReinstantiated(name string) {
+	cm.customComponentReinstantiations.WithLabelValues(cm.declareLabel(name)).Inc()
+}
+
 func (cm *controllerMetrics) onComponentEvaluationDone(name string, duration time.Duration) {
 	cm.componentEvaluationTime.Observe(duration.Seconds())
 	if duration >= cm.slowComponentThreshold {
@@ -79,25 +252,87 @@ func (cm *controllerMetrics) onComponentEvaluationDone(name string, duration tim
 	}
 }
 
+// nodeTypeLabel returns the node_type label value of n used by the
+// dependency wait metrics.
+func nodeTypeLabel(n dag.Node) string {
+	switch n.(type) {
+	case *BuiltinComponentNode, *CustomComponentNode:
+		return "component"
+	case *ServiceNode:
+		return "service"
+	case *ExportConfigNode:
+		return "export"
+	case *DeclareNode:
+		return "declare"
+	case *ImportConfigNode:
+		return "import"
+	default:
+		return "config"
+	}
+}
+
+// onDependencyWait records that a node of type nodeType waited for wait
+// before being evaluated after one of its dependencies was updated.
+func (cm *controllerMetrics) onDependencyWait(nodeType string, wait time.Duration) {
+	cm.dependenciesWaitTime.WithLabelValues(nodeType).Observe(wait.Seconds())
+
+	cm.maxWaitTimesMut.Lock()
+	defer cm.maxWaitTimesMut.Unlock()
+	if wait > cm.maxWaitTimes[nodeType] {
+		cm.maxWaitTimes[nodeType] = wait
+	}
+}
+
+// collectMaxWaitTimes sends the max wait time of each node type and resets
+// it, so that each scrape reports the longest wait since the previous one.
+func (cm *controllerMetrics) collectMaxWaitTimes(ch chan<- prometheus.Metric) {
+	cm.maxWaitTimesMut.Lock()
+	defer cm.maxWaitTimesMut.Unlock()
+
+	for nodeType, wait := range cm.maxWaitTimes {
+		ch <- prometheus.MustNewConstMetric(cm.dependenciesMaxWaitTime, prometheus.GaugeValue, wait.Seconds(), nodeType)
+		cm.maxWaitTimes[nodeType] = 0
+	}
+}
+
 func (cm *controllerMetrics) Collect(ch chan<- prometheus.Metric) {
 	cm.componentEvaluationTime.Collect(ch)
 	cm.controllerEvaluation.Collect(ch)
 	cm.dependenciesWaitTime.Collect(ch)
+	cm.collectMaxWaitTimes(ch)
 	cm.evaluationQueueSize.Collect(ch)
+	cm.evaluationPanics.Collect(ch)
+	cm.coalescedUpdates.Collect(ch)
+	cm.scheduledReevaluations.Collect(ch)
+	cm.evaluationRetries.Collect(ch)
 	cm.slowComponentEvaluationTime.Collect(ch)
+	cm.customComponentInstantiations.Collect(ch)
+	cm.customComponentReinstantiations.Collect(ch)
+	cm.configGeneration.Collect(ch)
+	cm.configInfo.Collect(ch)
 }
 
 func (cm *controllerMetrics) Describe(ch chan<- *prometheus.Desc) {
 	cm.componentEvaluationTime.Describe(ch)
 	cm.controllerEvaluation.Describe(ch)
 	cm.dependenciesWaitTime.Describe(ch)
+	ch <- cm.dependenciesMaxWaitTime
 	cm.evaluationQueueSize.Describe(ch)
+	cm.evaluationPanics.Describe(ch)
+	cm.coalescedUpdates.Describe(ch)
+	cm.scheduledReevaluations.Describe(ch)
+	cm.evaluationRetries.Describe(ch)
 	cm.slowComponentEvaluationTime.Describe(ch)
+	cm.customComponentInstantiations.Describe(ch)
+	cm.customComponentReinstantiations.Describe(ch)
+	cm.configGeneration.Describe(ch)
+	cm.configInfo.Describe(ch)
 }
 
 type controllerCollector struct {
-	l                      *Loader
-	runningComponentsTotal *prometheus.Desc
+	l                       *Loader
+	runningComponentsTotal  *prometheus.Desc
+	runningCustomComponents *prometheus.Desc
 }
 
 func newControllerCollector(l *Loader, id string) *controllerCollector {
@@ -107,19 +342,29 @@ func newControllerCollector(l *Loader, id string) *controllerCollector {
 			"agent_component_controller_running_components",
 			"Total number of running components.",
 			[]string{"health_type"},
-			map[string]string{"controller_id": id},
+			controllerLabels(id),
+		),
+		runningCustomComponents: prometheus.NewDesc(
+			"agent_component_controller_running_custom_components",
+			"Number of running custom components per declare block.",
+			[]string{"declare"},
+			controllerLabels(id),
 		),
 	}
 }
 
 func (cc *controllerCollector) Collect(ch chan<- prometheus.Metric) {
 	componentsByHealth := make(map[string]int)
+	customComponentsByDeclare := make(map[string]int)
 
 	for _, component := range cc.l.Components() {
 		health := component.CurrentHealth().Health.String()
 		componentsByHealth[health]++
-		if builtinComponent, ok := component.(*BuiltinComponentNode); ok {
-			builtinComponent.registry.Collect(ch)
+		switch component := component.(type) {
+		case *BuiltinComponentNode:
+			component.registry.Collect(ch)
+		case *CustomComponentNode:
+			customComponentsByDeclare[cc.l.cm.declareLabel(component.componentName)]++
 		}
 	}
 
@@ -132,8 +377,13 @@ func (cc *controllerCollector) Collect(ch chan<- prometheus.Metric) {
 	for health, count := range componentsByHealth {
 		ch <- prometheus.MustNewConstMetric(cc.runningComponentsTotal, prometheus.GaugeValue, float64(count), health)
 	}
+
+	for declare, count := range customComponentsByDeclare {
+		ch <- prometheus.MustNewConstMetric(cc.runningCustomComponents, prometheus.GaugeValue, float64(count), declare)
+	}
 }
 
 func (cc *controllerCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cc.runningComponentsTotal
+	ch <- cc.runningCustomComponents
 }
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/flow/internal/dag"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControllerMetrics_DeclareLabelOverflow(t *testing.T) {
+	cm := newControllerMetrics("test", 2)
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(cm))
+
+	cm.onCustomComponentInstantiated("a")
+	cm.onCustomComponentInstantiated("b")
+	cm.onCustomComponentInstantiated("c")
+	cm.onCustomComponentInstantiated("d")
+	cm.onCustomComponentInstantiated("a")
+	cm.onCustomComponentReinstantiated("b")
+	cm.onCustomComponentReinstantiated("c")
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP agent_component_controller_custom_component_instantiations_total Number of custom components created from a declare block
+		# TYPE agent_component_controller_custom_component_instantiations_total counter
+		agent_component_controller_custom_component_instantiations_total{controller_id="test",controller_path="/test",declare="a"} 2
+		agent_component_controller_custom_component_instantiations_total{controller_id="test",controller_path="/test",declare="b"} 1
+		agent_component_controller_custom_component_instantiations_total{controller_id="test",controller_path="/test",declare="__overflow__"} 2
+		# HELP agent_component_controller_custom_component_reinstantiations_total Number of times a running custom component was reloaded because its declare block changed
+		# TYPE agent_component_controller_custom_component_reinstantiations_total counter
+		agent_component_controller_custom_component_reinstantiations_total{controller_id="test",controller_path="/test",declare="b"} 1
+		agent_component_controller_custom_component_reinstantiations_total{controller_id="test",controller_path="/test",declare="__overflow__"} 1
+	`),
+		"agent_component_controller_custom_component_instantiations_total",
+		"agent_component_controller_custom_component_reinstantiations_total",
+	))
+}
+
+func TestControllerMetrics_DefaultMaxDeclareLabels(t *testing.T) {
+	cm := newControllerMetrics("test", 0)
+	require.Equal(t, DefaultMaxDeclareLabels, cm.maxDeclareLabels)
+}
+
+func TestNodeTypeLabel(t *testing.T) {
+	for _, tc := range []struct {
+		node     dag.Node
+		expected string
+	}{
+		{&BuiltinComponentNode{}, "component"},
+		{&CustomComponentNode{}, "component"},
+		{&ServiceNode{}, "service"},
+		{&ExportConfigNode{}, "export"},
+		{&DeclareNode{}, "declare"},
+		{&ImportConfigNode{}, "import"},
+		{&ArgumentConfigNode{}, "config"},
+		{&LoggingConfigNode{}, "config"},
+	} {
+		require.Equal(t, tc.expected, nodeTypeLabel(tc.node), "%T", tc.node)
+	}
+}
+
+func TestControllerMetrics_DependencyWait(t *testing.T) {
+	cm := newControllerMetrics("test", 0)
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(cm))
+
+	cm.onDependencyWait(nodeTypeLabel(&ServiceNode{}), 3*time.Second)
+	cm.onDependencyWait(nodeTypeLabel(&ServiceNode{}), 5*time.Second)
+	cm.onDependencyWait(nodeTypeLabel(&BuiltinComponentNode{}), 10*time.Millisecond)
+
+	waitCounts := func() map[string]uint64 {
+		families, err := reg.Gather()
+		require.NoError(t, err)
+
+		res := map[string]uint64{}
+		for _, f := range families {
+			if f.GetName() != "agent_component_dependencies_wait_seconds" {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "node_type" {
+						res[l.GetValue()] = m.GetHistogram().GetSampleCount()
+					}
+				}
+			}
+		}
+		return res
+	}
+	require.Equal(t, map[string]uint64{"service": 2, "component": 1}, waitCounts())
+
+	// Gathering resets the max wait times, so only the waits recorded since
+	// the previous gather are reported.
+	cm.onDependencyWait("service", 4*time.Second)
+	cm.onDependencyWait("component", 20*time.Millisecond)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP agent_component_dependencies_max_wait_seconds Longest time spent by a node waiting to be evaluated after its dependency is updated, since the previous scrape.
+		# TYPE agent_component_dependencies_max_wait_seconds gauge
+		agent_component_dependencies_max_wait_seconds{controller_id="test",controller_path="/test",node_type="component"} 0.02
+		agent_component_dependencies_max_wait_seconds{controller_id="test",controller_path="/test",node_type="service"} 4
+	`), "agent_component_dependencies_max_wait_seconds"))
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP agent_component_dependencies_max_wait_seconds Longest time spent by a node waiting to be evaluated after its dependency is updated, since the previous scrape.
+		# TYPE agent_component_dependencies_max_wait_seconds gauge
+		agent_component_dependencies_max_wait_seconds{controller_id="test",controller_path="/test",node_type="component"} 0
+		agent_component_dependencies_max_wait_seconds{controller_id="test",controller_path="/test",node_type="service"} 0
+	`), "agent_component_dependencies_max_wait_seconds"))
+}
+
+func TestControllerPath(t *testing.T) {
+	require.Equal(t, "/", controllerPath(""))
+	require.Equal(t, "/module.file.a", controllerPath("module.file.a"))
+	require.Equal(t, "/module.file.a/b", controllerPath("module.file.a/b"))
+	require.Equal(t, "/module.file.a/b", controllerPath("/module.file.a/b/"))
+}
@@ -24,6 +24,7 @@ type CustomComponent interface {
 	// LoadBody loads a River AST body into the CustomComponent. LoadBody can be called
 	// multiple times, and called prior to [CustomComponent.Run].
 	// customComponentRegistry provides custom component definitions for the loaded config.
+	// Evaluation failures of the loaded config are returned as an *InstanceError.
 	LoadBody(body ast.Body, args map[string]any, customComponentRegistry *CustomComponentRegistry) error
 
 	// Run starts the CustomComponent. No components within the CustomComponent
@@ -32,4 +33,8 @@ type CustomComponent interface {
 	// Run blocks until the provided context is canceled. The ID of a CustomComponent as defined in
 	// ModuleController.NewCustomComponent will not be released until Run returns.
 	Run(context.Context) error
+
+	// ModuleArguments returns the values taken by the arguments declared by
+	// the loaded body, whether they were supplied or took their default.
+	ModuleArguments() []ModuleArgument
 }
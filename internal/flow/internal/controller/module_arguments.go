@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/river/rivertypes"
+)
+
+// Sources of the value of a module argument.
+const (
+	ArgumentSourceSupplied = "supplied" // The argument was supplied.
+	ArgumentSourceDefault  = "default"  // The argument took its default value.
+)
+
+// ModuleArgument describes the value taken by an argument declared by a
+// module.
+type ModuleArgument struct {
+	Name   string `river:"name,attr"`
+	Source string `river:"source,attr"` // ArgumentSourceSupplied or ArgumentSourceDefault.
+	Value  any    `river:"value,attr,optional"`
+}
+
+// CustomComponentDebugInfo is the debug info of a CustomComponentNode.
+type CustomComponentDebugInfo struct {
+	Arguments []ModuleArgument `river:"argument,block,optional"`
+}
+
+// scrubbedSecret replaces secrets in the values of module arguments.
+const scrubbedSecret = "(secret)"
+
+// scrubSecrets returns v with the secrets it holds replaced, so that module
+// arguments can be reported without revealing them. v is never modified.
+func scrubSecrets(v any) any {
+	switch v := v.(type) {
+	case rivertypes.Secret, component.Secret:
+		return scrubbedSecret
+	case rivertypes.OptionalSecret:
+		if v.IsSecret {
+			return scrubbedSecret
+		}
+		return v.Value
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for key, elem := range v {
+			res[key] = scrubSecrets(elem)
+		}
+		return res
+	case []any:
+		res := make([]any, len(v))
+		for i, elem := range v {
+			res[i] = scrubSecrets(elem)
+		}
+		return res
+	default:
+		return v
+	}
+}
@@ -57,6 +57,10 @@ func (id ComponentID) Equals(other ComponentID) bool {
 	return true
 }
 
+// logLevelAttr is the name of the attribute which sets the log level of a
+// single component.
+const logLevelAttr = "log_level"
+
 // DialFunc is a function to establish a network connection.
 type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
 
@@ -73,6 +77,7 @@ type ComponentGlobals struct {
 	ControllerID        string                                 // ID of controller.
 	NewModuleController func(id string) ModuleController       // Func to generate a module controller.
 	GetServiceData      func(name string) (interface{}, error) // Get data for a service.
+	LastKnownGoodPath   string                                 // Directory where the last content of imports is persisted, disabled when empty.
 }
 
 // BuiltinComponentNode is a controller node which manages a builtin component.
@@ -93,11 +98,13 @@ type BuiltinComponentNode struct {
 	moduleController  ModuleController
 	OnBlockNodeUpdate func(cn BlockNode) // Informs controller that we need to reevaluate
 
-	mut     sync.RWMutex
-	block   *ast.BlockStmt // Current River block to derive args from
-	eval    *vm.Evaluator
-	managed component.Component // Inner managed component
-	args    component.Arguments // Evaluated arguments for the managed component
+	mut      sync.RWMutex
+	block    *ast.BlockStmt // Current River block to derive args from
+	eval     *vm.Evaluator
+	logLevel ast.Expr                // Value of the log_level attribute, if set
+	logger   *logging.OverrideLogger // Logger given to the managed component
+	managed  component.Component     // Inner managed component
+	args     component.Arguments     // Evaluated arguments for the managed component
 
 	// NOTE(rfratto): health and exports have their own mutex because they may be
 	// set asynchronously while mut is still being held (i.e., when calling Evaluate
@@ -149,7 +156,6 @@ func NewBuiltinComponentNode(globals ComponentGlobals, reg component.Registratio
 		OnBlockNodeUpdate: globals.OnBlockNodeUpdate,
 
 		block: b,
-		eval:  vm.New(b.Body),
 
 		// Prepopulate arguments and exports with their zero values.
 		args:    reg.Args,
@@ -158,6 +164,7 @@ func NewBuiltinComponentNode(globals ComponentGlobals, reg component.Registratio
 		evalHealth: initHealth,
 		runHealth:  initHealth,
 	}
+	cn.setBlock(b)
 	cn.managedOpts = getManagedOptions(globals, cn)
 
 	return cn
@@ -165,9 +172,16 @@ func NewBuiltinComponentNode(globals ComponentGlobals, reg component.Registratio
 
 func getManagedOptions(globals ComponentGlobals, cn *BuiltinComponentNode) component.Options {
 	cn.registry = prometheus.NewRegistry()
+
+	var logger log.Logger = globals.Logger
+	if globals.Logger != nil {
+		cn.logger = globals.Logger.WithLevelOverride()
+		logger = cn.logger
+	}
+
 	return component.Options{
 		ID:     cn.globalID,
-		Logger: log.With(globals.Logger, "component", cn.globalID),
+		Logger: log.With(logger, "component", cn.globalID),
 		Registerer: prometheus.WrapRegistererWith(prometheus.Labels{
 			"component_id": cn.globalID,
 		}, cn.registry),
@@ -229,8 +243,25 @@ func (cn *BuiltinComponentNode) UpdateBlock(b *ast.BlockStmt) {
 
 	cn.mut.Lock()
 	defer cn.mut.Unlock()
+	cn.setBlock(b)
+}
+
+// setBlock sets the block of the component. The log_level attribute is
+// handled by the controller and is not passed on to the component's
+// arguments. cn.mut must be held when calling setBlock.
+func (cn *BuiltinComponentNode) setBlock(b *ast.BlockStmt) {
+	body := make(ast.Body, 0, len(b.Body))
+	cn.logLevel = nil
+	for _, stmt := range b.Body {
+		if attr, ok := stmt.(*ast.AttributeStmt); ok && attr.Name.Name == logLevelAttr {
+			cn.logLevel = attr.Value
+			continue
+		}
+		body = append(body, stmt)
+	}
+
 	cn.block = b
-	cn.eval = vm.New(b.Body)
+	cn.eval = vm.New(body)
 }
 
 // Evaluate implements BlockNode and updates the arguments for the managed component
@@ -256,6 +287,10 @@ func (cn *BuiltinComponentNode) evaluate(scope *vm.Scope) error {
 	cn.mut.Lock()
 	defer cn.mut.Unlock()
 
+	if err := cn.evaluateLogLevel(scope); err != nil {
+		return err
+	}
+
 	argsPointer := cn.reg.CloneArguments()
 	if err := cn.eval.Evaluate(scope, argsPointer); err != nil {
 		return fmt.Errorf("decoding River: %w", err)
@@ -293,6 +328,22 @@ func (cn *BuiltinComponentNode) evaluate(scope *vm.Scope) error {
 	return nil
 }
 
+// evaluateLogLevel applies the log_level attribute of the block to the
+// component's logger. Without the attribute, the component logs at the level
+// of the logging block. cn.mut must be held when calling evaluateLogLevel.
+func (cn *BuiltinComponentNode) evaluateLogLevel(scope *vm.Scope) error {
+	var lvl logging.Level
+	if cn.logLevel != nil {
+		if err := vm.New(cn.logLevel).Evaluate(scope, &lvl); err != nil {
+			return fmt.Errorf("decoding %s: %w", logLevelAttr, err)
+		}
+	}
+	if cn.logger != nil {
+		cn.logger.SetLevel(lvl)
+	}
+	return nil
+}
+
 // Run runs the managed component in the calling goroutine until ctx is
 // canceled. Evaluate must have been called at least once without returning an
 // error before calling Run.
@@ -336,6 +387,17 @@ func (cn *BuiltinComponentNode) Arguments() component.Arguments {
 	return cn.args
 }
 
+// ReevaluationInterval implements ReevaluatedNode, returning the
+// re-evaluation interval requested by the managed component, if any.
+func (cn *BuiltinComponentNode) ReevaluationInterval() time.Duration {
+	cn.mut.RLock()
+	defer cn.mut.RUnlock()
+	if rc, ok := cn.managed.(component.ReevaluatedComponent); ok {
+		return rc.ReevaluationInterval()
+	}
+	return 0
+}
+
 // Block implements BlockNode and returns the current block of the managed component.
 func (cn *BuiltinComponentNode) Block() *ast.BlockStmt {
 	cn.mut.RLock()
@@ -418,6 +480,19 @@ func (cn *BuiltinComponentNode) DebugInfo() interface{} {
 	return nil
 }
 
+// LastEvaluation returns the time the component was last evaluated, or the
+// zero time if it wasn't evaluated yet.
+func (cn *BuiltinComponentNode) LastEvaluation() time.Time {
+	cn.healthMut.RLock()
+	defer cn.healthMut.RUnlock()
+
+	// The evaluation health is only unknown until the first evaluation.
+	if cn.evalHealth.Health == component.HealthTypeUnknown {
+		return time.Time{}
+	}
+	return cn.evalHealth.UpdateTime
+}
+
 // setEvalHealth sets the internal health from a call to Evaluate. See Health
 // for information on how overall health is calculated.
 func (cn *BuiltinComponentNode) setEvalHealth(t component.HealthType, msg string) {
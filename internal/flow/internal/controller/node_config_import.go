@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"maps"
+	"net/url"
 	"path"
 	"path/filepath"
 	"strings"
@@ -16,6 +17,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/flow/internal/importsource"
+	"github.com/grafana/agent/internal/flow/internal/lastknowngood"
 	"github.com/grafana/agent/internal/flow/logging/level"
 	"github.com/grafana/agent/internal/flow/tracing"
 	"github.com/grafana/agent/internal/runner"
@@ -173,11 +175,20 @@ func (cn *ImportConfigNode) CurrentHealth() component.Health {
 }
 
 // Evaluate implements BlockNode and evaluates the import source.
+//
+// If the source fails to evaluate before it ever retrieved content, the last
+// content the import loaded without errors is used instead when it was
+// persisted.
 func (cn *ImportConfigNode) Evaluate(scope *vm.Scope) error {
 	err := cn.source.Evaluate(scope)
-	switch err {
-	case nil:
+	switch {
+	case err == nil:
 		cn.setEvalHealth(component.HealthTypeHealthy, "source evaluated")
+	case cn.restoreLastKnownGood():
+		level.Warn(cn.logger).Log("msg", "source evaluation failed, using the last known good content", "err", err)
+		msg := fmt.Sprintf("source evaluation failed, using the last known good content: %s", err)
+		cn.setEvalHealth(component.HealthTypeUnhealthy, msg)
+		return nil
 	default:
 		msg := fmt.Sprintf("source evaluation failed: %s", err)
 		cn.setEvalHealth(component.HealthTypeUnhealthy, msg)
@@ -185,6 +196,57 @@ func (cn *ImportConfigNode) Evaluate(scope *vm.Scope) error {
 	return err
 }
 
+// restoreLastKnownGood loads the persisted content of the import if it has no
+// content yet. It returns true if the import has content afterwards.
+func (cn *ImportConfigNode) restoreLastKnownGood() bool {
+	if cn.globals.LastKnownGoodPath == "" {
+		return false
+	}
+	cn.mut.RLock()
+	hasContent := cn.importedContent != nil
+	cn.mut.RUnlock()
+	if hasContent {
+		return false
+	}
+
+	files, err := lastknowngood.Read(cn.lastKnownGoodDir())
+	if err != nil || len(files) == 0 {
+		return false
+	}
+	content := make(map[string]string, len(files))
+	for name, bb := range files {
+		key, err := url.PathUnescape(name)
+		if err != nil {
+			return false
+		}
+		content[key] = string(bb)
+	}
+	cn.onContentUpdate(content)
+
+	cn.mut.RLock()
+	defer cn.mut.RUnlock()
+	return cn.importedContent != nil
+}
+
+// writeLastKnownGood persists the content of the import. cn.mut must be held
+// when calling.
+func (cn *ImportConfigNode) writeLastKnownGood() {
+	if cn.globals.LastKnownGoodPath == "" {
+		return
+	}
+	files := make(map[string][]byte, len(cn.importedContent))
+	for key, content := range cn.importedContent {
+		files[url.PathEscape(key)] = []byte(content)
+	}
+	if err := lastknowngood.Write(cn.lastKnownGoodDir(), files); err != nil {
+		level.Warn(cn.logger).Log("msg", "failed to persist last known good import content", "err", err)
+	}
+}
+
+func (cn *ImportConfigNode) lastKnownGoodDir() string {
+	return lastknowngood.Dir(cn.globals.LastKnownGoodPath, lastknowngood.ImportsDir, cn.globalID)
+}
+
 // onContentUpdate is triggered every time the managed import source has new content.
 func (cn *ImportConfigNode) onContentUpdate(importedContent map[string]string) {
 	cn.mut.Lock()
@@ -238,6 +300,7 @@ func (cn *ImportConfigNode) onContentUpdate(importedContent map[string]string) {
 		}
 	}
 
+	cn.writeLastKnownGood()
 	cn.setContentHealth(component.HealthTypeHealthy, "content updated")
 	cn.OnBlockNodeUpdate(cn)
 }
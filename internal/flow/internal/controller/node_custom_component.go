@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"path"
 	"reflect"
@@ -13,6 +15,8 @@ import (
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/flow/logging/level"
 	"github.com/grafana/river/ast"
+	"github.com/grafana/river/diag"
+	"github.com/grafana/river/printer"
 	"github.com/grafana/river/vm"
 )
 
@@ -38,11 +42,17 @@ type CustomComponentNode struct {
 
 	getConfig getCustomComponentConfig // Retrieve the custom component config.
 
-	mut     sync.RWMutex
-	block   *ast.BlockStmt // Current River block to derive args from
-	eval    *vm.Evaluator
-	managed CustomComponent     // Inner managed custom component
-	args    component.Arguments // Evaluated arguments for the managed component
+	// onTemplateChange, if set, is invoked with the component name when the
+	// managed custom component is reloaded with a different template.
+	onTemplateChange func(componentName string)
+
+	mut      sync.RWMutex
+	block    *ast.BlockStmt // Current River block to derive args from
+	eval     *vm.Evaluator
+	managed  CustomComponent     // Inner managed custom component
+	args     component.Arguments // Evaluated arguments for the managed component
+	template ast.Body            // Template last loaded into the managed component
+	loaded   bool                // Whether a template was loaded into the managed component
 
 	// NOTE(rfratto): health and exports have their own mutex because they may be
 	// set asynchronously while mut is still being held (i.e., when calling Evaluate
@@ -202,11 +212,86 @@ func (cn *CustomComponentNode) evaluate(evalScope *vm.Scope) error {
 
 	// Reload the custom component with new config
 	if err := cn.managed.LoadBody(template, args, customComponentRegistry); err != nil {
+		var instanceErr *InstanceError
+		if errors.As(err, &instanceErr) {
+			instanceErr.NodeID = cn.nodeID
+			return instanceErr
+		}
 		return fmt.Errorf("updating custom component: %w", err)
 	}
+
+	if cn.loaded && cn.onTemplateChange != nil && !sameTemplate(cn.template, template) {
+		cn.onTemplateChange(cn.componentName)
+	}
+	cn.template, cn.loaded = template, true
 	return nil
 }
 
+// InstanceError is returned by CustomComponent.LoadBody when the body of the
+// instance was loaded but some of its nodes failed to evaluate. Only the
+// instance is affected, so its errors are reported to the parent controller
+// as warnings by Diagnostics. Errors in the body itself, such as unknown
+// references, aren't wrapped and still fail the parent.
+type InstanceError struct {
+	NodeID string // NodeID of the CustomComponentNode, set by the node.
+	Err    error  // Error returned when evaluating the instance.
+}
+
+// Error implements error.
+func (e *InstanceError) Error() string {
+	return fmt.Sprintf("updating custom component: %s", e.Err)
+}
+
+// Unwrap returns the error returned when evaluating the instance.
+func (e *InstanceError) Unwrap() error { return e.Err }
+
+// Diagnostics returns the diagnostics of the instance, namespaced with the
+// NodeID of the instance and with errors downgraded to warnings. Errors which
+// aren't diagnostics are reported at the position of block, the block of the
+// CustomComponentNode.
+func (e *InstanceError) Diagnostics(block *ast.BlockStmt) diag.Diagnostics {
+	var instanceDiags diag.Diagnostics
+	if !errors.As(e.Err, &instanceDiags) {
+		instanceDiags = diag.Diagnostics{{
+			Severity: diag.SeverityLevelError,
+			Message:  e.Err.Error(),
+			StartPos: ast.StartPos(block).Position(),
+			EndPos:   ast.EndPos(block).Position(),
+		}}
+	}
+
+	res := make(diag.Diagnostics, 0, len(instanceDiags))
+	for _, d := range instanceDiags {
+		if d.Severity == diag.SeverityLevelError {
+			d.Severity = diag.SeverityLevelWarn
+		}
+		d.Message = fmt.Sprintf("custom component %s: %s", e.NodeID, d.Message)
+		res = append(res, d)
+	}
+	return res
+}
+
+// sameTemplate reports whether two custom component templates are
+// equivalent. Templates are reparsed on every config reload, so they are
+// compared by their formatted content rather than by identity.
+func sameTemplate(a, b ast.Body) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if len(a) == 0 || &a[0] == &b[0] {
+		return true
+	}
+
+	var bufA, bufB bytes.Buffer
+	if err := printer.Fprint(&bufA, &ast.File{Body: a}); err != nil {
+		return false
+	}
+	if err := printer.Fprint(&bufB, &ast.File{Body: b}); err != nil {
+		return false
+	}
+	return bytes.Equal(bufA.Bytes(), bufB.Bytes())
+}
+
 func (cn *CustomComponentNode) Run(ctx context.Context) error {
 	cn.mut.RLock()
 	managed := cn.managed
@@ -235,6 +320,26 @@ func (cn *CustomComponentNode) Arguments() component.Arguments {
 	return cn.args
 }
 
+// DebugInfo returns the arguments declared by the managed custom component,
+// with the values they took.
+func (cn *CustomComponentNode) DebugInfo() interface{} {
+	cn.mut.RLock()
+	defer cn.mut.RUnlock()
+
+	if cn.managed == nil {
+		return nil
+	}
+	return CustomComponentDebugInfo{Arguments: cn.managed.ModuleArguments()}
+}
+
+// Template returns the template last loaded into the managed custom
+// component, or nil if none was loaded yet.
+func (cn *CustomComponentNode) Template() ast.Body {
+	cn.mut.RLock()
+	defer cn.mut.RUnlock()
+	return cn.template
+}
+
 // Block implements BlockNode and returns the current block of the managed custom component.
 func (cn *CustomComponentNode) Block() *ast.BlockStmt {
 	cn.mut.RLock()
@@ -287,6 +392,19 @@ func (cn *CustomComponentNode) CurrentHealth() component.Health {
 	return component.LeastHealthy(cn.runHealth, cn.evalHealth)
 }
 
+// LastEvaluation returns the time the component was last evaluated, or the
+// zero time if it wasn't evaluated yet.
+func (cn *CustomComponentNode) LastEvaluation() time.Time {
+	cn.healthMut.RLock()
+	defer cn.healthMut.RUnlock()
+
+	// The evaluation health is only unknown until the first evaluation.
+	if cn.evalHealth.Health == component.HealthTypeUnknown {
+		return time.Time{}
+	}
+	return cn.evalHealth.UpdateTime
+}
+
 // setEvalHealth sets the internal health from a call to Evaluate. See Health
 // for information on how overall health is calculated.
 func (cn *CustomComponentNode) setEvalHealth(t component.HealthType, msg string) {
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/grafana/river/vm"
+)
+
+// EvaluationPanicError is returned when evaluating a node panicked.
+type EvaluationPanicError struct {
+	NodeID string
+	Value  interface{} // Value passed to panic.
+	Stack  []byte      // Stack trace of the goroutine which panicked.
+}
+
+// Error implements error. The stack trace is not included; it is logged when
+// the panic is recovered.
+func (e *EvaluationPanicError) Error() string {
+	return fmt.Sprintf("panic while evaluating %s: %v", e.NodeID, e.Value)
+}
+
+// evalHealthSetter is implemented by nodes which report the health of their
+// latest evaluation.
+type evalHealthSetter interface {
+	setEvalHealth(t component.HealthType, msg string)
+}
+
+// evaluateNode evaluates bn with scope. If the evaluation panics, the panic is
+// recovered and returned as an *EvaluationPanicError, and bn is marked as
+// unhealthy, so that a single node can't take down the whole process.
+func (l *Loader) evaluateNode(logger log.Logger, bn BlockNode, scope *vm.Scope) (err error) {
+	if l.profiler != nil {
+		var done func()
+		scope, done = l.profiler.profile(bn, scope)
+		defer done()
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		panicErr := &EvaluationPanicError{NodeID: bn.NodeID(), Value: r, Stack: debug.Stack()}
+		level.Error(logger).Log("msg", "recovered from panic while evaluating node", "node_id", bn.NodeID(), "panic", r, "stack", string(panicErr.Stack))
+		l.cm.evaluationPanics.Inc()
+
+		if hs, ok := bn.(evalHealthSetter); ok {
+			hs.setEvalHealth(component.HealthTypeUnhealthy, fmt.Sprintf("component evaluation failed: %s", panicErr))
+		}
+		err = panicErr
+	}()
+
+	return bn.Evaluate(scope)
+}
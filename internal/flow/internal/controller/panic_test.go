@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/vm"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// panickingNode is a BlockNode whose Evaluate always panics.
+type panickingNode struct {
+	id string
+}
+
+var _ BlockNode = (*panickingNode)(nil)
+
+func (n *panickingNode) NodeID() string             { return n.id }
+func (n *panickingNode) Block() *ast.BlockStmt      { return &ast.BlockStmt{Name: []string{n.id}} }
+func (n *panickingNode) UpdateBlock(*ast.BlockStmt) {}
+func (n *panickingNode) Evaluate(*vm.Scope) error   { panic("something went wrong") }
+
+func TestLoader_RecoverEvaluationPanic(t *testing.T) {
+	l := NewLoader(LoaderOptions{
+		ComponentGlobals: ComponentGlobals{
+			Logger:        log.NewNopLogger(),
+			TraceProvider: noop.NewTracerProvider(),
+		},
+	})
+	node := &panickingNode{id: "fake.panicking"}
+
+	err := l.evaluate(log.NewNopLogger(), node)
+	var panicErr *EvaluationPanicError
+	require.ErrorAs(t, err, &panicErr)
+	require.Equal(t, "fake.panicking", panicErr.NodeID)
+	require.Equal(t, "something went wrong", panicErr.Value)
+	require.Contains(t, string(panicErr.Stack), "panickingNode")
+	require.EqualError(t, err, "panic while evaluating fake.panicking: something went wrong")
+	require.Equal(t, 1.0, testutil.ToFloat64(l.cm.evaluationPanics))
+
+	// Panics in the worker pool path are recovered too.
+	parent := &QueuedNode{Node: &panickingNode{id: "fake.parent"}, LastUpdatedTime: time.Now()}
+	require.NotPanics(t, func() {
+		l.concurrentEvalFn(node, context.Background(), noop.NewTracerProvider().Tracer(""), parent)
+	})
+	require.Equal(t, 2.0, testutil.ToFloat64(l.cm.evaluationPanics))
+}
@@ -52,6 +52,13 @@ func (q *Queue) Enqueue(c *QueuedNode) {
 // Chan returns a channel which is written to when the queue is non-empty.
 func (q *Queue) Chan() <-chan struct{} { return q.updateCh }
 
+// Len returns the number of nodes in the queue.
+func (q *Queue) Len() int {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	return len(q.queuedOrder)
+}
+
 // DequeueAll removes all BlockNode from the queue and returns them.
 func (q *Queue) DequeueAll() []*QueuedNode {
 	q.mut.Lock()
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/internal/flow/internal/dag"
+)
+
+// ReevaluatedNode is implemented by nodes which can request to be
+// re-evaluated periodically, even when none of their dependencies changed.
+type ReevaluatedNode interface {
+	BlockNode
+
+	// ReevaluationInterval returns how often the node must be re-evaluated.
+	// Zero disables periodic re-evaluation.
+	ReevaluationInterval() time.Duration
+}
+
+// reevaluationScheduler periodically submits the nodes which request it for
+// evaluation. The interval of a node is checked again every time it is
+// evaluated, so that nodes can change or stop requesting re-evaluations.
+type reevaluationScheduler struct {
+	submit func(BlockNode)
+
+	mut       sync.Mutex
+	scheduled map[string]*scheduledReevaluation // NodeID -> scheduled re-evaluation
+}
+
+type scheduledReevaluation struct {
+	node     BlockNode
+	interval time.Duration
+	timer    *time.Timer
+}
+
+// newReevaluationScheduler creates a reevaluationScheduler. submit is called
+// with a node every time its interval elapses.
+func newReevaluationScheduler(submit func(BlockNode)) *reevaluationScheduler {
+	return &reevaluationScheduler{
+		submit:    submit,
+		scheduled: make(map[string]*scheduledReevaluation),
+	}
+}
+
+// update schedules, reschedules or unschedules the periodic re-evaluation of
+// n according to its current interval.
+func (s *reevaluationScheduler) update(n BlockNode) {
+	var interval time.Duration
+	if rn, ok := n.(ReevaluatedNode); ok {
+		interval = rn.ReevaluationInterval()
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.updateLocked(n, interval)
+}
+
+// sync updates the re-evaluation of every node in g, and unschedules the
+// nodes which aren't in g anymore.
+func (s *reevaluationScheduler) sync(g *dag.Graph) {
+	intervals := make(map[BlockNode]time.Duration)
+	for _, n := range g.Nodes() {
+		if rn, ok := n.(ReevaluatedNode); ok {
+			intervals[rn] = rn.ReevaluationInterval()
+		}
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	for id, r := range s.scheduled {
+		if _, ok := intervals[r.node]; !ok {
+			r.timer.Stop()
+			delete(s.scheduled, id)
+		}
+	}
+	for n, interval := range intervals {
+		s.updateLocked(n, interval)
+	}
+}
+
+// updateLocked implements update. s.mut must be held.
+func (s *reevaluationScheduler) updateLocked(n BlockNode, interval time.Duration) {
+	id := n.NodeID()
+	cur, ok := s.scheduled[id]
+	switch {
+	case ok && cur.node == n && cur.interval == interval:
+		return
+	case ok:
+		cur.timer.Stop()
+		delete(s.scheduled, id)
+	}
+	if interval <= 0 {
+		return
+	}
+
+	r := &scheduledReevaluation{node: n, interval: interval}
+	var fire func()
+	fire = func() {
+		s.submit(n)
+
+		s.mut.Lock()
+		defer s.mut.Unlock()
+		// Rearm the timer unless the re-evaluation was updated meanwhile.
+		if s.scheduled[id] == r {
+			r.timer = time.AfterFunc(interval, fire)
+		}
+	}
+	r.timer = time.AfterFunc(interval, fire)
+	s.scheduled[id] = r
+}
+
+// stop unschedules all the re-evaluations.
+func (s *reevaluationScheduler) stop() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	for id, r := range s.scheduled {
+		r.timer.Stop()
+		delete(s.scheduled, id)
+	}
+}
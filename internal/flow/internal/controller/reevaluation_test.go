@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/internal/dag"
+	"github.com/grafana/agent/internal/flow/internal/worker"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/vm"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/atomic"
+)
+
+// reevaluatedNode is a BlockNode standing in for a component which requests
+// periodic re-evaluations.
+type reevaluatedNode struct {
+	id          string
+	interval    atomic.Duration
+	evaluations atomic.Int32
+}
+
+var _ ReevaluatedNode = (*reevaluatedNode)(nil)
+
+func (n *reevaluatedNode) NodeID() string                      { return n.id }
+func (n *reevaluatedNode) Block() *ast.BlockStmt               { return &ast.BlockStmt{Name: []string{n.id}} }
+func (n *reevaluatedNode) UpdateBlock(*ast.BlockStmt)          {}
+func (n *reevaluatedNode) ReevaluationInterval() time.Duration { return n.interval.Load() }
+func (n *reevaluatedNode) Evaluate(*vm.Scope) error {
+	n.evaluations.Inc()
+	return nil
+}
+
+func TestReevaluationScheduler(t *testing.T) {
+	var submitted atomic.Int32
+	s := newReevaluationScheduler(func(BlockNode) { submitted.Inc() })
+	defer s.stop()
+
+	n := &reevaluatedNode{id: "fake.reevaluated"}
+	n.interval.Store(100 * time.Millisecond)
+
+	var g dag.Graph
+	g.Add(n)
+	s.sync(&g)
+	require.Eventually(t, func() bool { return submitted.Load() >= 3 }, 2*time.Second, 10*time.Millisecond)
+
+	// Nodes which stop requesting re-evaluations are unscheduled.
+	n.interval.Store(0)
+	s.update(n)
+	require.Empty(t, s.scheduled)
+
+	// Nodes removed from the graph are unscheduled.
+	n.interval.Store(100 * time.Millisecond)
+	s.update(n)
+	require.Len(t, s.scheduled, 1)
+	s.sync(&dag.Graph{})
+	require.Empty(t, s.scheduled)
+
+	count := submitted.Load()
+	time.Sleep(250 * time.Millisecond)
+	require.Equal(t, count, submitted.Load())
+}
+
+func TestLoader_Reevaluation(t *testing.T) {
+	pool := worker.NewFixedWorkerPool(1, 10)
+	defer pool.Stop()
+
+	l := NewLoader(LoaderOptions{
+		ComponentGlobals: ComponentGlobals{
+			Logger:        log.NewNopLogger(),
+			TraceProvider: noop.NewTracerProvider(),
+		},
+		WorkerPool: pool,
+	})
+	defer l.Cleanup(false)
+
+	n := &reevaluatedNode{id: "fake.reevaluated"}
+	n.interval.Store(100 * time.Millisecond)
+	l.reevaluations.update(n)
+
+	// The node is evaluated through the worker pool at every interval.
+	require.Eventually(t, func() bool { return n.evaluations.Load() >= 3 }, 2*time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, testutil.ToFloat64(l.cm.scheduledReevaluations), 3.0)
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/internal/flow/internal/dag"
+	"github.com/grafana/river/ast"
+)
+
+// RetryPolicy configures the retries of nodes which fail evaluation. A failed
+// node is evaluated again after MinBackoff, and the backoff doubles after
+// every failed retry, up to MaxBackoff. Retries are disabled when MaxBackoff
+// is zero.
+type RetryPolicy struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryMinBackoff is the MinBackoff used when a RetryPolicy doesn't
+// set it.
+const DefaultRetryMinBackoff = 1 * time.Second
+
+// retryScheduler submits the nodes which failed evaluation for another
+// evaluation with exponential backoff. Retries of a node stop once it's
+// evaluated successfully, and restart from the minimum backoff when it's
+// updated with a new block. Once stopped, a retryScheduler never schedules
+// retries again.
+type retryScheduler struct {
+	policy RetryPolicy
+	submit func(BlockNode)
+
+	mut       sync.Mutex
+	scheduled map[string]*scheduledRetry // NodeID -> scheduled retry
+	stopped   bool
+}
+
+type scheduledRetry struct {
+	node    BlockNode
+	block   *ast.BlockStmt // Block of the node when it failed.
+	backoff time.Duration
+	timer   *time.Timer
+}
+
+// newRetryScheduler creates a retryScheduler. submit is called with a failed
+// node every time its backoff elapses.
+func newRetryScheduler(policy RetryPolicy, submit func(BlockNode)) *retryScheduler {
+	if policy.MinBackoff <= 0 {
+		policy.MinBackoff = DefaultRetryMinBackoff
+	}
+	policy.MinBackoff = min(policy.MinBackoff, policy.MaxBackoff)
+
+	return &retryScheduler{
+		policy:    policy,
+		submit:    submit,
+		scheduled: make(map[string]*scheduledRetry),
+	}
+}
+
+// update schedules a retry of n if its evaluation failed with err, or
+// unschedules its retries if it succeeded. update is a no-op once the
+// retryScheduler is stopped.
+func (s *retryScheduler) update(n BlockNode, err error) {
+	if s.policy.MaxBackoff <= 0 {
+		return
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.stopped {
+		return
+	}
+
+	id := n.NodeID()
+	cur, ok := s.scheduled[id]
+	if ok {
+		cur.timer.Stop()
+		delete(s.scheduled, id)
+	}
+	if err == nil {
+		return
+	}
+
+	r := &scheduledRetry{node: n, block: n.Block(), backoff: s.policy.MinBackoff}
+	if ok && cur.node == n && cur.block == r.block {
+		r.backoff = min(2*cur.backoff, s.policy.MaxBackoff)
+	}
+	r.timer = time.AfterFunc(r.backoff, func() { s.fire(r) })
+	s.scheduled[id] = r
+}
+
+// fire submits the node of r, unless r was unscheduled since its timer
+// fired.
+func (s *retryScheduler) fire(r *scheduledRetry) {
+	s.mut.Lock()
+	current := !s.stopped && s.scheduled[r.node.NodeID()] == r
+	s.mut.Unlock()
+
+	if current {
+		s.submit(r.node)
+	}
+}
+
+// sync unschedules the retries of the nodes which aren't in g anymore, so
+// that nodes removed by Apply are never retried.
+func (s *retryScheduler) sync(g *dag.Graph) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	for id, r := range s.scheduled {
+		if g.GetByID(id) != r.node {
+			r.timer.Stop()
+			delete(s.scheduled, id)
+		}
+	}
+}
+
+// stop unschedules all the retries, and prevents new ones from being
+// scheduled.
+func (s *retryScheduler) stop() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.stopped = true
+
+	for id, r := range s.scheduled {
+		r.timer.Stop()
+		delete(s.scheduled, id)
+	}
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/internal/dag"
+	"github.com/grafana/agent/internal/flow/internal/worker"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/vm"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/atomic"
+)
+
+// flakyNode is a BlockNode whose first evaluations fail, standing in for a
+// component whose arguments can't be evaluated because of a transient error.
+type flakyNode struct {
+	id          string
+	block       *ast.BlockStmt
+	failures    int32
+	evaluations atomic.Int32
+}
+
+func (n *flakyNode) NodeID() string               { return n.id }
+func (n *flakyNode) Block() *ast.BlockStmt        { return n.block }
+func (n *flakyNode) UpdateBlock(b *ast.BlockStmt) { n.block = b }
+func (n *flakyNode) Evaluate(*vm.Scope) error {
+	if n.evaluations.Inc() <= n.failures {
+		return errors.New("transient failure")
+	}
+	return nil
+}
+
+func TestRetryScheduler(t *testing.T) {
+	s := newRetryScheduler(RetryPolicy{MinBackoff: time.Hour, MaxBackoff: 3 * time.Hour}, func(BlockNode) {})
+	defer s.stop()
+
+	n := &flakyNode{id: "fake.flaky", block: &ast.BlockStmt{}}
+	failed := errors.New("failed")
+
+	// The backoff doubles after every failure, up to the maximum backoff.
+	for _, backoff := range []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour, 3 * time.Hour} {
+		s.update(n, failed)
+		require.Equal(t, backoff, s.scheduled[n.id].backoff)
+	}
+
+	// The backoff is reset when the node is updated with a new block.
+	n.UpdateBlock(&ast.BlockStmt{})
+	s.update(n, failed)
+	require.Equal(t, time.Hour, s.scheduled[n.id].backoff)
+
+	// Retries stop once the node is evaluated successfully.
+	s.update(n, nil)
+	require.Empty(t, s.scheduled)
+
+	// Nodes removed from the graph are unscheduled.
+	s.update(n, failed)
+	var g dag.Graph
+	g.Add(n)
+	s.sync(&g)
+	require.Len(t, s.scheduled, 1)
+	s.sync(&dag.Graph{})
+	require.Empty(t, s.scheduled)
+
+	// Retries aren't scheduled once the scheduler is stopped.
+	s.update(n, failed)
+	s.stop()
+	require.Empty(t, s.scheduled)
+	s.update(n, failed)
+	require.Empty(t, s.scheduled)
+
+	// Retries are disabled without a maximum backoff.
+	s = newRetryScheduler(RetryPolicy{}, func(BlockNode) {})
+	s.update(n, failed)
+	require.Empty(t, s.scheduled)
+}
+
+func TestRetryScheduler_Unscheduled(t *testing.T) {
+	submitted := make(chan BlockNode, 10)
+	s := newRetryScheduler(RetryPolicy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond}, func(n BlockNode) {
+		submitted <- n
+	})
+	defer s.stop()
+
+	n := &flakyNode{id: "fake.flaky", block: &ast.BlockStmt{}}
+	s.update(n, errors.New("failed"))
+
+	// The timer fires after the node was removed from the graph, as if Apply
+	// removed it while the retry was being submitted.
+	s.mut.Lock()
+	r := s.scheduled[n.id]
+	s.mut.Unlock()
+	s.sync(&dag.Graph{})
+	s.fire(r)
+
+	select {
+	case <-submitted:
+		require.FailNow(t, "removed node was retried")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLoader_Retry(t *testing.T) {
+	pool := worker.NewFixedWorkerPool(1, 10)
+	defer pool.Stop()
+
+	l := NewLoader(LoaderOptions{
+		ComponentGlobals: ComponentGlobals{
+			Logger:        log.NewNopLogger(),
+			TraceProvider: noop.NewTracerProvider(),
+		},
+		WorkerPool:  pool,
+		RetryPolicy: RetryPolicy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond},
+	})
+	defer l.Cleanup(false)
+
+	// The node fails twice, and then succeeds.
+	n := &flakyNode{id: "fake.flaky", block: &ast.BlockStmt{}, failures: 2}
+	l.graph.Add(n)
+
+	l.mut.Lock()
+	err := l.evaluate(log.NewNopLogger(), n)
+	l.mut.Unlock()
+	require.Error(t, err)
+	l.retries.update(n, err)
+
+	// The node is retried through the worker pool until it succeeds.
+	require.Eventually(t, func() bool {
+		l.retries.mut.Lock()
+		defer l.retries.mut.Unlock()
+		return n.evaluations.Load() == 3 && len(l.retries.scheduled) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, 2.0, testutil.ToFloat64(l.cm.evaluationRetries.WithLabelValues("config")))
+
+	// No retry is scheduled after the successful evaluation.
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, int32(3), n.evaluations.Load())
+}
@@ -3,7 +3,20 @@ package controller
 import (
 	"context"
 	"fmt"
+	"runtime/pprof"
 	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Labels attached to the goroutines of running nodes. Goroutines launched by
+// a node inherit these labels, so they can be attributed to the node in
+// goroutine profiles.
+const (
+	controllerIDLabel = "controller_id"
+	nodeIDLabel       = "node_id"
 )
 
 // RunnableNode is any BlockNode which can also be run.
@@ -18,22 +31,58 @@ type Scheduler struct {
 	cancel  context.CancelFunc
 	running sync.WaitGroup
 
+	controllerID string
+	log          log.Logger
+	drainTimeout time.Duration
+	leaks        *leakDetector // nil when leak detection is disabled.
+
 	tasksMut sync.Mutex
 	tasks    map[string]*task
 }
 
+// SchedulerOptions holds options for creating a Scheduler.
+type SchedulerOptions struct {
+	Logger       log.Logger            // Logger to use for scheduler logs.
+	Registerer   prometheus.Registerer // Registerer for scheduler metrics.
+	ControllerID string                // ID of the controller owning the Scheduler.
+
+	// LeakCheckDelay enables goroutine leak detection when non-zero. Once a
+	// node has been removed, the Scheduler waits for LeakCheckDelay and then
+	// reports any goroutines which are still labeled with the node's ID.
+	LeakCheckDelay time.Duration
+
+	// DrainTimeout is how long Drain waits for each node to stop before
+	// stopping the nodes it depends on anyway. Defaults to
+	// DefaultDrainTimeout.
+	DrainTimeout time.Duration
+}
+
 // NewScheduler creates a new Scheduler. Call Synchronize to manage the set of
 // components which are running.
 //
-// Call Close to stop the Scheduler and all running components.
-func NewScheduler() *Scheduler {
+// Call Close to stop the Scheduler and all running components, optionally
+// after calling Drain to stop them in dependency order.
+func NewScheduler(opts SchedulerOptions) *Scheduler {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Scheduler{
+	s := &Scheduler{
 		ctx:    ctx,
 		cancel: cancel,
 
-		tasks: make(map[string]*task),
+		controllerID: opts.ControllerID,
+		log:          opts.Logger,
+		drainTimeout: opts.DrainTimeout,
+		tasks:        make(map[string]*task),
+	}
+	if s.log == nil {
+		s.log = log.NewNopLogger()
+	}
+	if s.drainTimeout <= 0 {
+		s.drainTimeout = DefaultDrainTimeout
+	}
+	if opts.LeakCheckDelay > 0 {
+		s.leaks = newLeakDetector(ctx, opts, s.isScheduled)
 	}
+	return s
 }
 
 // Synchronize synchronizes the running components to those defined by rr.
@@ -58,12 +107,16 @@ func (s *Scheduler) Synchronize(rr []RunnableNode) error {
 	}
 
 	// Stop tasks that are not defined in rr.
-	var stopping sync.WaitGroup
+	var (
+		stopping sync.WaitGroup
+		removed  []string
+	)
 	for id, t := range s.tasks {
 		if _, keep := newRunnables[id]; keep {
 			continue
 		}
 
+		removed = append(removed, id)
 		stopping.Add(1)
 		go func(t *task) {
 			defer stopping.Done()
@@ -85,6 +138,7 @@ func (s *Scheduler) Synchronize(rr []RunnableNode) error {
 		opts := taskOptions{
 			Context:  s.ctx,
 			Runnable: newRunnable,
+			Labels:   pprof.Labels(controllerIDLabel, s.controllerID, nodeIDLabel, nodeID),
 			OnDone: func() {
 				defer s.running.Done()
 
@@ -100,14 +154,32 @@ func (s *Scheduler) Synchronize(rr []RunnableNode) error {
 
 	// Wait for all stopping runnables to exit.
 	stopping.Wait()
+
+	if s.leaks != nil {
+		for _, id := range removed {
+			s.leaks.Schedule(id)
+		}
+	}
 	return nil
 }
 
+// isScheduled returns true if a task for nodeID is currently running.
+func (s *Scheduler) isScheduled(nodeID string) bool {
+	s.tasksMut.Lock()
+	defer s.tasksMut.Unlock()
+
+	_, ok := s.tasks[nodeID]
+	return ok
+}
+
 // Close stops the Scheduler and returns after all running goroutines have
 // exited.
 func (s *Scheduler) Close() error {
 	s.cancel()
 	s.running.Wait()
+	if s.leaks != nil {
+		s.leaks.Close()
+	}
 	return nil
 }
 
@@ -121,6 +193,7 @@ type task struct {
 type taskOptions struct {
 	Context  context.Context
 	Runnable RunnableNode
+	Labels   pprof.LabelSet // Labels for the goroutine running Runnable.
 	OnDone   func()
 }
 
@@ -137,7 +210,9 @@ func newTask(opts taskOptions) *task {
 	go func() {
 		defer opts.OnDone()
 		defer close(t.exited)
-		_ = opts.Runnable.Run(t.ctx)
+		pprof.Do(t.ctx, opts.Labels, func(ctx context.Context) {
+			_ = opts.Runnable.Run(ctx)
+		})
 	}()
 	return t
 }
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/internal/flow/logging/level"
+)
+
+// DefaultDrainTimeout is the default time Drain waits for each node to stop.
+const DefaultDrainTimeout = 30 * time.Second
+
+// Drain stops the running nodes in dependency order: a node is only stopped
+// once every node depending on it has stopped, so that components stop
+// before the components they send data to, which can then flush it. For
+// example, a loki.source component is stopped before the loki.write
+// component it forwards entries to.
+//
+// dependants holds the IDs of the nodes which directly depend on each node,
+// by node ID. It may include nodes which aren't running, such as config
+// nodes, which the order goes through.
+//
+// Nodes which don't stop within the drain timeout of the Scheduler stop
+// delaying the nodes they depend on. Their IDs are logged and returned,
+// sorted. Drain doesn't wait for them to exit; Close does.
+//
+// Drain must not be called concurrently with Synchronize.
+func (s *Scheduler) Drain(dependants map[string][]string) []string {
+	s.tasksMut.Lock()
+	tasks := make(map[string]*task, len(s.tasks))
+	for id, t := range s.tasks {
+		tasks[id] = t
+	}
+	s.tasksMut.Unlock()
+
+	// stopped is closed once the node has stopped, or once it exceeded the
+	// drain timeout.
+	stopped := make(map[string]chan struct{}, len(tasks)+len(dependants))
+	for id := range tasks {
+		stopped[id] = make(chan struct{})
+	}
+	for id, deps := range dependants {
+		stopped[id] = make(chan struct{})
+		for _, dep := range deps {
+			stopped[dep] = make(chan struct{})
+		}
+	}
+
+	var (
+		wg          sync.WaitGroup
+		exceededMut sync.Mutex
+		exceeded    []string
+	)
+	for id := range stopped {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			defer close(stopped[id])
+
+			for _, dep := range dependants[id] {
+				<-stopped[dep]
+			}
+
+			t, running := tasks[id]
+			if !running {
+				return
+			}
+			t.cancel()
+
+			timer := time.NewTimer(s.drainTimeout)
+			defer timer.Stop()
+			select {
+			case <-t.exited:
+			case <-timer.C:
+				exceededMut.Lock()
+				exceeded = append(exceeded, id)
+				exceededMut.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	if len(exceeded) > 0 {
+		sort.Strings(exceeded)
+		level.Warn(s.log).Log(
+			"msg", "nodes did not stop within the drain timeout, the nodes they depend on were stopped anyway",
+			"timeout", s.drainTimeout,
+			"nodes", strings.Join(exceeded, ","),
+		)
+	}
+	return exceeded
+}
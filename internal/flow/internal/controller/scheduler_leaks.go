@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/flow/logging/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// leakDetector reports goroutines which keep running after the node that
+// launched them has been removed from the Scheduler.
+//
+// Goroutines are attributed to nodes through the pprof labels set when a task
+// is started; see newTask.
+type leakDetector struct {
+	ctx          context.Context
+	log          log.Logger
+	delay        time.Duration
+	controllerID string
+	isScheduled  func(nodeID string) bool
+	registerer   prometheus.Registerer
+
+	leakedGoroutines *prometheus.GaugeVec
+
+	checks sync.WaitGroup
+}
+
+func newLeakDetector(ctx context.Context, opts SchedulerOptions, isScheduled func(nodeID string) bool) *leakDetector {
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	ld := &leakDetector{
+		ctx:          ctx,
+		log:          logger,
+		delay:        opts.LeakCheckDelay,
+		controllerID: opts.ControllerID,
+		isScheduled:  isScheduled,
+		registerer:   opts.Registerer,
+
+		leakedGoroutines: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "agent_component_controller_leaked_goroutines",
+			Help:        "Number of goroutines still running after the node which launched them was removed.",
+			ConstLabels: controllerLabels(opts.ControllerID),
+		}, []string{"node_id"}),
+	}
+
+	if opts.Registerer != nil {
+		if err := opts.Registerer.Register(ld.leakedGoroutines); err != nil {
+			level.Warn(logger).Log("msg", "failed to register goroutine leak metric", "err", err)
+		}
+	}
+	return ld
+}
+
+// Schedule checks for leaked goroutines of nodeID after the configured delay.
+// The check is skipped if nodeID has been scheduled again in the meantime.
+func (ld *leakDetector) Schedule(nodeID string) {
+	ld.checks.Add(1)
+	go func() {
+		defer ld.checks.Done()
+
+		// Goroutines inherit labels from the goroutine which created them.
+		// Clear them so the check itself isn't counted as a leak of the node
+		// which owns this Scheduler.
+		pprof.SetGoroutineLabels(context.Background())
+
+		t := time.NewTimer(ld.delay)
+		defer t.Stop()
+
+		select {
+		case <-ld.ctx.Done():
+			return
+		case <-t.C:
+			ld.check(nodeID)
+		}
+	}()
+}
+
+func (ld *leakDetector) check(nodeID string) {
+	if ld.isScheduled(nodeID) {
+		// The node came back; its goroutines are expected to be running.
+		ld.leakedGoroutines.DeleteLabelValues(nodeID)
+		return
+	}
+
+	count, err := countLabeledGoroutines(pprof.Labels(controllerIDLabel, ld.controllerID, nodeIDLabel, nodeID))
+	if err != nil {
+		level.Warn(ld.log).Log("msg", "failed to check for leaked goroutines", "node_id", nodeID, "err", err)
+		return
+	}
+
+	if count == 0 {
+		ld.leakedGoroutines.DeleteLabelValues(nodeID)
+		return
+	}
+
+	ld.leakedGoroutines.WithLabelValues(nodeID).Set(float64(count))
+	level.Warn(ld.log).Log(
+		"msg", "goroutines are still running after node was removed",
+		"node_id", nodeID,
+		"goroutines", count,
+		"removed_for", ld.delay,
+	)
+}
+
+// Close waits for any pending checks to exit and unregisters metrics. The
+// context passed to newLeakDetector must be canceled before calling Close.
+func (ld *leakDetector) Close() {
+	ld.checks.Wait()
+	if ld.registerer != nil {
+		ld.registerer.Unregister(ld.leakedGoroutines)
+	}
+}
+
+// countLabeledGoroutines returns the number of goroutines which carry all of
+// the given pprof labels.
+func countLabeledGoroutines(labels pprof.LabelSet) (int, error) {
+	var want []string
+	pprof.ForLabels(pprof.WithLabels(context.Background(), labels), func(key, value string) bool {
+		want = append(want, fmt.Sprintf("%q:%q", key, value))
+		return true
+	})
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return 0, err
+	}
+
+	// With debug=1, the goroutine profile groups goroutines by stack. Each
+	// group starts with a "<count> @ <pcs>" line, optionally followed by a
+	// "# labels: {...}" line.
+	var (
+		total     int
+		lastCount int
+	)
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if countText, _, found := strings.Cut(line, " @ "); found {
+			n, err := strconv.Atoi(countText)
+			if err != nil {
+				lastCount = 0
+				continue
+			}
+			lastCount = n
+			continue
+		}
+
+		if lbls, found := strings.CutPrefix(line, "# labels: "); found && matchesAllLabels(lbls, want) {
+			total += lastCount
+		}
+	}
+	return total, scanner.Err()
+}
+
+func matchesAllLabels(labels string, want []string) bool {
+	for _, kv := range want {
+		if !strings.Contains(labels, kv) {
+			return false
+		}
+	}
+	return true
+}
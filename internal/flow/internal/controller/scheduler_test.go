@@ -2,13 +2,17 @@ package controller_test
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/flow/internal/controller"
 	"github.com/grafana/river/ast"
 	"github.com/grafana/river/vm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,7 +30,7 @@ func TestScheduler_Synchronize(t *testing.T) {
 			return nil
 		}
 
-		sched := controller.NewScheduler()
+		sched := controller.NewScheduler(controller.SchedulerOptions{})
 		sched.Synchronize([]controller.RunnableNode{
 			fakeRunnable{ID: "component-a", Component: mockComponent{RunFunc: runFunc}},
 			fakeRunnable{ID: "component-b", Component: mockComponent{RunFunc: runFunc}},
@@ -48,7 +52,7 @@ func TestScheduler_Synchronize(t *testing.T) {
 			return nil
 		}
 
-		sched := controller.NewScheduler()
+		sched := controller.NewScheduler(controller.SchedulerOptions{})
 
 		for i := 0; i < 10; i++ {
 			// If a new runnable is created, runFunc will panic since the WaitGroup
@@ -74,7 +78,7 @@ func TestScheduler_Synchronize(t *testing.T) {
 			return nil
 		}
 
-		sched := controller.NewScheduler()
+		sched := controller.NewScheduler(controller.SchedulerOptions{})
 
 		sched.Synchronize([]controller.RunnableNode{
 			fakeRunnable{ID: "component-a", Component: mockComponent{RunFunc: runFunc}},
@@ -88,6 +92,155 @@ func TestScheduler_Synchronize(t *testing.T) {
 	})
 }
 
+func TestScheduler_LeakDetection(t *testing.T) {
+	t.Run("Reports leaked goroutines", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		sched := controller.NewScheduler(controller.SchedulerOptions{
+			Registerer:     reg,
+			ControllerID:   "test",
+			LeakCheckDelay: 10 * time.Millisecond,
+		})
+		defer func() { require.NoError(t, sched.Close()) }()
+
+		// The leaky component launches goroutines which outlive its Run method.
+		leakStop := make(chan struct{})
+		defer close(leakStop)
+
+		var started sync.WaitGroup
+		started.Add(2)
+		runFunc := func(ctx context.Context) error {
+			for i := 0; i < 2; i++ {
+				go func() {
+					started.Done()
+					<-leakStop
+				}()
+			}
+			<-ctx.Done()
+			return nil
+		}
+
+		sched.Synchronize([]controller.RunnableNode{
+			fakeRunnable{ID: "component-a", Component: mockComponent{RunFunc: runFunc}},
+		})
+		started.Wait()
+		sched.Synchronize([]controller.RunnableNode{})
+
+		expect := `
+# HELP agent_component_controller_leaked_goroutines Number of goroutines still running after the node which launched them was removed.
+# TYPE agent_component_controller_leaked_goroutines gauge
+agent_component_controller_leaked_goroutines{controller_id="test",controller_path="/test",node_id="component-a"} 2
+`
+		require.Eventually(t, func() bool {
+			err := testutil.GatherAndCompare(reg, strings.NewReader(expect), "agent_component_controller_leaked_goroutines")
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Ignores well-behaved components", func(t *testing.T) {
+		reg := prometheus.NewRegistry()
+		sched := controller.NewScheduler(controller.SchedulerOptions{
+			Registerer:     reg,
+			ControllerID:   "test",
+			LeakCheckDelay: 10 * time.Millisecond,
+		})
+		defer func() { require.NoError(t, sched.Close()) }()
+
+		var started, finished sync.WaitGroup
+		started.Add(1)
+		finished.Add(1)
+		runFunc := func(ctx context.Context) error {
+			go func() {
+				defer finished.Done()
+				started.Done()
+				<-ctx.Done()
+			}()
+			<-ctx.Done()
+			return nil
+		}
+
+		sched.Synchronize([]controller.RunnableNode{
+			fakeRunnable{ID: "component-a", Component: mockComponent{RunFunc: runFunc}},
+		})
+		started.Wait()
+		sched.Synchronize([]controller.RunnableNode{})
+		finished.Wait()
+
+		// Give the leak check a chance to run.
+		time.Sleep(100 * time.Millisecond)
+
+		count, err := testutil.GatherAndCount(reg, "agent_component_controller_leaked_goroutines")
+		require.NoError(t, err)
+		require.Zero(t, count)
+	})
+}
+
+func TestScheduler_Drain(t *testing.T) {
+	// recordStop returns a run function which appends id to stopped once its
+	// context is canceled, after waiting for delay.
+	var (
+		stopMut sync.Mutex
+		stopped []string
+	)
+	recordStop := func(id string, delay time.Duration) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(delay)
+			stopMut.Lock()
+			defer stopMut.Unlock()
+			stopped = append(stopped, id)
+			return nil
+		}
+	}
+
+	// The chain is source -> process -> write, where each node sends data to
+	// the next one, and so references it.
+	dependants := map[string][]string{
+		"write":   {"process"},
+		"process": {"source"},
+	}
+
+	t.Run("Stops producers before consumers", func(t *testing.T) {
+		stopped = nil
+		sched := controller.NewScheduler(controller.SchedulerOptions{})
+		sched.Synchronize([]controller.RunnableNode{
+			fakeRunnable{ID: "write", Component: mockComponent{RunFunc: recordStop("write", 0)}},
+			fakeRunnable{ID: "process", Component: mockComponent{RunFunc: recordStop("process", 0)}},
+			fakeRunnable{ID: "source", Component: mockComponent{RunFunc: recordStop("source", 50*time.Millisecond)}},
+		})
+
+		require.Empty(t, sched.Drain(dependants))
+		require.NoError(t, sched.Close())
+		require.Equal(t, []string{"source", "process", "write"}, stopped)
+	})
+
+	t.Run("Goes through nodes which aren't running", func(t *testing.T) {
+		stopped = nil
+		sched := controller.NewScheduler(controller.SchedulerOptions{})
+		sched.Synchronize([]controller.RunnableNode{
+			fakeRunnable{ID: "write", Component: mockComponent{RunFunc: recordStop("write", 0)}},
+			fakeRunnable{ID: "source", Component: mockComponent{RunFunc: recordStop("source", 50*time.Millisecond)}},
+		})
+
+		require.Empty(t, sched.Drain(dependants))
+		require.NoError(t, sched.Close())
+		require.Equal(t, []string{"source", "write"}, stopped)
+	})
+
+	t.Run("Reports nodes exceeding the drain timeout", func(t *testing.T) {
+		stopped = nil
+		sched := controller.NewScheduler(controller.SchedulerOptions{DrainTimeout: 50 * time.Millisecond})
+		sched.Synchronize([]controller.RunnableNode{
+			fakeRunnable{ID: "write", Component: mockComponent{RunFunc: recordStop("write", 0)}},
+			fakeRunnable{ID: "process", Component: mockComponent{RunFunc: recordStop("process", time.Second)}},
+			fakeRunnable{ID: "source", Component: mockComponent{RunFunc: recordStop("source", 0)}},
+		})
+
+		require.Equal(t, []string{"process"}, sched.Drain(dependants))
+		require.NoError(t, sched.Close())
+		require.Equal(t, []string{"source", "write", "process"}, stopped)
+	})
+}
+
 type fakeRunnable struct {
 	ID        string
 	Component component.Component
@@ -0,0 +1,86 @@
+package controller_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/agent/internal/flow/internal/controller"
+	"github.com/grafana/agent/internal/flow/internal/testcomponents"
+	"github.com/grafana/agent/internal/flow/logging"
+	"github.com/grafana/river/rivertypes"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestLoader_SecretExports(t *testing.T) {
+	l := newSecretTestLoader(t)
+
+	config := []byte(`
+		testcomponents.secret "source" {
+			value = "hunter2"
+		}
+
+		testcomponents.secret "dependant" {
+			value = testcomponents.secret.source.value
+		}
+	`)
+	require.NoError(t, applyFromContent(t, l, config, nil, nil).ErrorOrNil())
+
+	// Dependants read the secret when they are evaluated.
+	require.Equal(t, rivertypes.Secret("hunter2"), secretExport(t, l, "testcomponents.secret.dependant").Read())
+
+	// The secret is neither stored by the controller nor revealed when
+	// printing its exports.
+	require.NotContains(t, fmt.Sprintf("%#v", l.Variables()), "hunter2")
+	require.NotContains(t, fmt.Sprintf("%v", l.Variables()), "hunter2")
+	require.Equal(t, "(secret)", secretExport(t, l, "testcomponents.secret.source").String())
+}
+
+func TestLoader_SecretExportsConversion(t *testing.T) {
+	l := newSecretTestLoader(t)
+
+	// Secrets can't be converted into strings.
+	config := []byte(`
+		testcomponents.secret "source" {
+			value = "hunter2"
+		}
+
+		testcomponents.passthrough "leak" {
+			input = testcomponents.secret.source.value
+		}
+	`)
+	require.Error(t, applyFromContent(t, l, config, nil, nil).ErrorOrNil())
+}
+
+func newSecretTestLoader(t *testing.T) *controller.Loader {
+	t.Helper()
+
+	logger, err := logging.New(os.Stderr, logging.DefaultOptions)
+	require.NoError(t, err)
+
+	return controller.NewLoader(controller.LoaderOptions{
+		ComponentGlobals: controller.ComponentGlobals{
+			Logger:            logger,
+			TraceProvider:     noop.NewTracerProvider(),
+			DataPath:          t.TempDir(),
+			MinStability:      featuregate.StabilityBeta,
+			OnBlockNodeUpdate: func(cn controller.BlockNode) { /* no-op */ },
+			Registerer:        prometheus.NewRegistry(),
+			NewModuleController: func(id string) controller.ModuleController {
+				return nil
+			},
+		},
+	})
+}
+
+func secretExport(t *testing.T, l *controller.Loader, id string) component.Secret {
+	t.Helper()
+
+	node := l.Graph().GetByID(id)
+	require.NotNil(t, node)
+	return node.(controller.ComponentNode).Exports().(testcomponents.SecretExports).Value
+}
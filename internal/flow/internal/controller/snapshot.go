@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/grafana/river/encoding/riverjson"
+)
+
+// DefaultSnapshotMaxValueSize is the default size after which the arguments
+// or the exports of a component are truncated in a Snapshot.
+const DefaultSnapshotMaxValueSize = 64 * 1024
+
+// Snapshot is the state of all the components of a Loader at a given time.
+type Snapshot struct {
+	Time time.Time `json:"time"`
+	// Components are the components of the Loader by node ID.
+	Components map[string]ComponentSnapshot `json:"components"`
+}
+
+// ComponentSnapshot is the state of a component in a Snapshot. Its arguments
+// and exports are encoded like in the component API, with the values of
+// secrets masked.
+type ComponentSnapshot struct {
+	Health         SnapshotHealth  `json:"health"`
+	LastEvaluation *time.Time      `json:"lastEvaluation,omitempty"`
+	Arguments      json.RawMessage `json:"arguments"`
+	Exports        json.RawMessage `json:"exports"`
+}
+
+// SnapshotHealth is the health of a component in a Snapshot.
+type SnapshotHealth struct {
+	State       string    `json:"state"`
+	Message     string    `json:"message"`
+	UpdatedTime time.Time `json:"updatedTime"`
+}
+
+// truncatedValue replaces the arguments or the exports of a component in a
+// Snapshot when they're larger than the max size.
+type truncatedValue struct {
+	Truncated bool `json:"truncated"`
+	// Size is the size of the encoded value which was truncated.
+	Size int `json:"size"`
+}
+
+// Snapshot returns the state of all the components of the Loader. The
+// arguments and the exports of each component are replaced with a truncation
+// marker when they're larger than maxValueSize bytes once encoded, unless
+// maxValueSize is 0.
+//
+// The snapshot is taken under the read lock of the Loader, so that it
+// reflects a single graph.
+func (l *Loader) Snapshot(maxValueSize int) (Snapshot, error) {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+
+	res := Snapshot{
+		Time:       time.Now(),
+		Components: make(map[string]ComponentSnapshot, len(l.componentNodes)),
+	}
+	for _, cn := range l.componentNodes {
+		health := cn.CurrentHealth()
+		cs := ComponentSnapshot{
+			Health: SnapshotHealth{
+				State:       health.Health.String(),
+				Message:     health.Message,
+				UpdatedTime: health.UpdateTime,
+			},
+		}
+		if t := cn.LastEvaluation(); !t.IsZero() {
+			cs.LastEvaluation = &t
+		}
+
+		var err error
+		if cs.Arguments, err = snapshotValue(cn.Arguments(), maxValueSize); err != nil {
+			return Snapshot{}, err
+		}
+		if cs.Exports, err = snapshotValue(cn.Exports(), maxValueSize); err != nil {
+			return Snapshot{}, err
+		}
+		res.Components[cn.NodeID()] = cs
+	}
+	return res, nil
+}
+
+// snapshotValue encodes the arguments or the exports of a component, masking
+// secrets, or returns a truncation marker if they're larger than maxSize.
+func snapshotValue(v any, maxSize int) (json.RawMessage, error) {
+	bb, err := riverjson.MarshalBody(v)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize == 0 || len(bb) <= maxSize {
+		return bb, nil
+	}
+	return json.Marshal(truncatedValue{Truncated: true, Size: len(bb)})
+}
@@ -0,0 +1,63 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoader_Snapshot(t *testing.T) {
+	l := newSecretTestLoader(t)
+
+	config := []byte(fmt.Sprintf(`
+		testcomponents.secret "source" {
+			value = "hunter2"
+		}
+
+		testcomponents.passthrough "large" {
+			input = %q
+		}
+	`, strings.Repeat("a", 1000)))
+	require.NoError(t, applyFromContent(t, l, config, nil, nil).ErrorOrNil())
+
+	t.Run("secrets are masked", func(t *testing.T) {
+		snapshot, err := l.Snapshot(0)
+		require.NoError(t, err)
+		require.Len(t, snapshot.Components, 2)
+
+		source := snapshot.Components["testcomponents.secret.source"]
+		require.NotEmpty(t, source.Health.State)
+		require.NotNil(t, source.LastEvaluation)
+		require.Contains(t, string(source.Arguments), "(secret)")
+		require.Contains(t, string(source.Exports), "(secret)")
+
+		bb, err := json.Marshal(snapshot)
+		require.NoError(t, err)
+		require.NotContains(t, string(bb), "hunter2")
+
+		// Values aren't truncated without a max size.
+		require.Contains(t, string(snapshot.Components["testcomponents.passthrough.large"].Arguments), strings.Repeat("a", 1000))
+	})
+
+	t.Run("large values are truncated", func(t *testing.T) {
+		snapshot, err := l.Snapshot(500)
+		require.NoError(t, err)
+
+		large := snapshot.Components["testcomponents.passthrough.large"]
+		var marker struct {
+			Truncated bool `json:"truncated"`
+			Size      int  `json:"size"`
+		}
+		require.NoError(t, json.Unmarshal(large.Arguments, &marker))
+		require.True(t, marker.Truncated)
+		require.Greater(t, marker.Size, 1000)
+		require.NoError(t, json.Unmarshal(large.Exports, &marker))
+		require.True(t, marker.Truncated)
+
+		// Smaller values are kept.
+		require.Contains(t, string(snapshot.Components["testcomponents.secret.source"].Arguments), "(secret)")
+	})
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// stableSettleWindow is how long the Loader must stay idle, without any
+	// exports being cached, to be considered stable.
+	stableSettleWindow = 100 * time.Millisecond
+
+	// stablePollInterval is how often WaitForStable checks whether the Loader
+	// is idle.
+	stablePollInterval = 10 * time.Millisecond
+)
+
+// WaitForStable blocks until the Loader is stable or ctx is done, returning
+// ctx.Err() in the latter case.
+//
+// The Loader is stable once no evaluations are queued or running in the
+// worker pool, no dependants are being submitted or waiting for a deferred
+// update, and no component exports were cached for stableSettleWindow.
+// pending, when non-nil, reports updates which are yet to be passed to
+// EvaluateDependants by the caller; the Loader isn't stable while it returns
+// true.
+//
+// Note that the worker pool may be shared with other Loaders, such as the
+// ones of modules, whose evaluations are waited for as well.
+func (l *Loader) WaitForStable(ctx context.Context, pending func() bool) error {
+	ticker := time.NewTicker(stablePollInterval)
+	defer ticker.Stop()
+
+	var (
+		lastIndex   = l.cache.ExportsCachedIndex()
+		stableSince = time.Now()
+	)
+	for {
+		index := l.cache.ExportsCachedIndex()
+		switch now := time.Now(); {
+		case l.busy() || (pending != nil && pending()) || index != lastIndex:
+			lastIndex, stableSince = index, now
+		case now.Sub(stableSince) >= stableSettleWindow:
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// busy reports whether the Loader has evaluations in progress.
+func (l *Loader) busy() bool {
+	if l.submitting.Load() > 0 || l.damper.hasPending() {
+		return true
+	}
+	return l.workerPool != nil && l.workerPool.QueueSize() > 0
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/flow/internal/dag"
+)
+
+// updateDamper limits how often the dependants of a component are evaluated
+// when the component's exports change.
+//
+// Once the dependants of a component have been evaluated, further updates of
+// that component within minInterval are coalesced: the component is requeued
+// once at the end of the interval, and its dependants are evaluated with its
+// latest exports at that point.
+type updateDamper struct {
+	minInterval time.Duration
+	requeue     func(BlockNode)
+	onCoalesced func()
+
+	mut            sync.Mutex
+	lastPropagated map[string]time.Time
+	pending        map[string]*time.Timer
+}
+
+// newUpdateDamper creates an updateDamper. requeue is called with a node at
+// the end of its interval if any of its updates were deferred, and
+// onCoalesced is called for each deferred update.
+func newUpdateDamper(minInterval time.Duration, requeue func(BlockNode), onCoalesced func()) *updateDamper {
+	return &updateDamper{
+		minInterval:    minInterval,
+		requeue:        requeue,
+		onCoalesced:    onCoalesced,
+		lastPropagated: make(map[string]time.Time),
+		pending:        make(map[string]*time.Timer),
+	}
+}
+
+// allow reports whether the update of n can be propagated to its dependants
+// now. If it can't, the update is deferred to the end of the interval.
+//
+// Only updates of healthy components are damped, so that errors and health
+// changes are propagated immediately.
+func (d *updateDamper) allow(n BlockNode, now time.Time) bool {
+	if d.minInterval <= 0 {
+		return true
+	}
+	hn, ok := n.(interface{ CurrentHealth() component.Health })
+	if !ok || hn.CurrentHealth().Health != component.HealthTypeHealthy {
+		return true
+	}
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	id := n.NodeID()
+	if _, ok := d.pending[id]; ok {
+		d.onCoalesced()
+		return false
+	}
+
+	last, ok := d.lastPropagated[id]
+	if !ok || now.Sub(last) >= d.minInterval {
+		d.lastPropagated[id] = now
+		return true
+	}
+
+	d.onCoalesced()
+	d.pending[id] = time.AfterFunc(last.Add(d.minInterval).Sub(now), func() {
+		d.mut.Lock()
+		delete(d.pending, id)
+		d.mut.Unlock()
+
+		d.requeue(n)
+	})
+	return false
+}
+
+// hasPending reports whether any deferred update is waiting for the end of
+// its interval.
+func (d *updateDamper) hasPending() bool {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	return len(d.pending) > 0
+}
+
+// sync forgets the nodes which aren't in g anymore, cancelling their
+// deferred updates.
+func (d *updateDamper) sync(g *dag.Graph) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	for id := range d.lastPropagated {
+		if g.GetByID(id) == nil {
+			delete(d.lastPropagated, id)
+		}
+	}
+	for id, t := range d.pending {
+		if g.GetByID(id) == nil {
+			t.Stop()
+			delete(d.pending, id)
+		}
+	}
+}
+
+// stop cancels all the deferred updates.
+func (d *updateDamper) stop() {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	for id, t := range d.pending {
+		t.Stop()
+		delete(d.pending, id)
+	}
+}
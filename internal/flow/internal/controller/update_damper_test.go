@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/flow/internal/dag"
+	"github.com/grafana/agent/internal/flow/internal/worker"
+	"github.com/grafana/river/ast"
+	"github.com/grafana/river/vm"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/atomic"
+)
+
+// flappingNode is a BlockNode standing in for a component whose exports
+// change very frequently.
+type flappingNode struct {
+	id     string
+	health component.HealthType
+}
+
+var _ BlockNode = (*flappingNode)(nil)
+
+func (n *flappingNode) NodeID() string             { return n.id }
+func (n *flappingNode) Block() *ast.BlockStmt      { return &ast.BlockStmt{Name: []string{n.id}} }
+func (n *flappingNode) UpdateBlock(*ast.BlockStmt) {}
+func (n *flappingNode) Evaluate(*vm.Scope) error   { return nil }
+func (n *flappingNode) CurrentHealth() component.Health {
+	return component.Health{Health: n.health}
+}
+
+func TestUpdateDamper(t *testing.T) {
+	var (
+		requeued  atomic.Int32
+		coalesced atomic.Int32
+	)
+	d := newUpdateDamper(100*time.Millisecond, func(BlockNode) { requeued.Inc() }, func() { coalesced.Inc() })
+	defer d.stop()
+
+	parent := &flappingNode{id: "fake.flapping", health: component.HealthTypeHealthy}
+	now := time.Now()
+
+	// The first update is propagated, and the next ones within the interval
+	// are coalesced into a single requeue at the end of the interval.
+	require.True(t, d.allow(parent, now))
+	for i := 1; i <= 10; i++ {
+		require.False(t, d.allow(parent, now.Add(time.Duration(i)*time.Millisecond)))
+	}
+	require.Equal(t, int32(10), coalesced.Load())
+	require.Eventually(t, func() bool { return requeued.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// Once the interval is over, the requeued update is propagated.
+	require.True(t, d.allow(parent, now.Add(100*time.Millisecond)))
+
+	// Updates of unhealthy components are never damped.
+	parent.health = component.HealthTypeUnhealthy
+	require.True(t, d.allow(parent, now.Add(101*time.Millisecond)))
+	require.Equal(t, int32(10), coalesced.Load())
+
+	// Nodes which aren't components are never damped.
+	other := &panickingNode{id: "fake.other"}
+	require.True(t, d.allow(other, now))
+	require.True(t, d.allow(other, now))
+
+	time.Sleep(150 * time.Millisecond)
+	require.Equal(t, int32(1), requeued.Load())
+}
+
+func TestUpdateDamper_Sync(t *testing.T) {
+	var requeued atomic.Int32
+	d := newUpdateDamper(50*time.Millisecond, func(BlockNode) { requeued.Inc() }, func() {})
+	defer d.stop()
+
+	kept := &flappingNode{id: "fake.kept", health: component.HealthTypeHealthy}
+	removed := &flappingNode{id: "fake.removed", health: component.HealthTypeHealthy}
+	now := time.Now()
+	for _, n := range []*flappingNode{kept, removed} {
+		require.True(t, d.allow(n, now))
+		require.False(t, d.allow(n, now.Add(time.Millisecond)))
+	}
+
+	// Nodes removed from the graph are forgotten, and their deferred updates
+	// are cancelled.
+	var g dag.Graph
+	g.Add(kept)
+	d.sync(&g)
+
+	d.mut.Lock()
+	require.Len(t, d.lastPropagated, 1)
+	require.Contains(t, d.lastPropagated, kept.id)
+	require.Len(t, d.pending, 1)
+	d.mut.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, int32(1), requeued.Load())
+}
+
+func TestLoader_MinUpdateInterval(t *testing.T) {
+	var requeued atomic.Int32
+	pool := worker.NewFixedWorkerPool(1, 10)
+	defer pool.Stop()
+
+	l := NewLoader(LoaderOptions{
+		ComponentGlobals: ComponentGlobals{
+			Logger:            log.NewNopLogger(),
+			TraceProvider:     noop.NewTracerProvider(),
+			OnBlockNodeUpdate: func(BlockNode) { requeued.Inc() },
+		},
+		WorkerPool:        pool,
+		MinUpdateInterval: time.Minute,
+	})
+	defer l.damper.stop()
+
+	parent := &flappingNode{id: "fake.flapping", health: component.HealthTypeHealthy}
+	for i := 0; i < 20; i++ {
+		l.EvaluateDependants(context.Background(), []*QueuedNode{{Node: parent, LastUpdatedTime: time.Now()}})
+	}
+
+	// The first update is propagated and the other 19 are coalesced into a
+	// single update, requeued at the end of the interval.
+	require.Equal(t, 19.0, testutil.ToFloat64(l.cm.coalescedUpdates))
+	require.Len(t, l.damper.pending, 1)
+	require.Equal(t, int32(0), requeued.Load())
+}
@@ -2,9 +2,11 @@ package controller
 
 import (
 	"reflect"
+	"strings"
 	"sync"
 
 	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/service"
 	"github.com/grafana/river/vm"
 )
 
@@ -13,24 +15,36 @@ import (
 //
 // The current state of valueCache can then be built into a *vm.Scope for other
 // components to be evaluated.
+//
+// Exported component.Secret values are only handles: secrets are read from
+// the exporting component when dependants are evaluated and are never stored
+// by the valueCache.
 type valueCache struct {
 	mut                sync.RWMutex
-	components         map[string]ComponentID // NodeID -> ComponentID
-	args               map[string]interface{} // NodeID -> component arguments value
-	exports            map[string]interface{} // NodeID -> component exports value
-	moduleArguments    map[string]any         // key -> module arguments value
-	moduleExports      map[string]any         // name -> value for the value of module exports
-	moduleChangedIndex int                    // Everytime a change occurs this is incremented
+	components         map[string]ComponentID    // NodeID -> ComponentID
+	args               map[string]interface{}    // NodeID -> component arguments value
+	exports            map[string]interface{}    // NodeID -> component exports value
+	aliases            map[string]ComponentID    // Aliased ID -> ComponentID of the target
+	moduleArguments    map[string]any            // key -> module arguments value
+	defaultArguments   map[string]struct{}       // keys of module arguments set to their default
+	moduleExports      map[string]any            // name -> value for the value of module exports
+	moduleExportsDirty bool                      // Whether moduleExports may differ from lastModuleExports
+	lastModuleExports  map[string]any            // Module exports as of the last change of moduleChangedIndex
+	moduleChangedIndex int                       // Everytime a change occurs this is incremented
+	exportsCachedIndex int                       // Incremented every time component exports are cached
+	transforms         []service.ExportTransform // Transforms applied to exports when building contexts
 }
 
 // newValueCache creates a new ValueCache.
 func newValueCache() *valueCache {
 	return &valueCache{
-		components:      make(map[string]ComponentID),
-		args:            make(map[string]interface{}),
-		exports:         make(map[string]interface{}),
-		moduleArguments: make(map[string]any),
-		moduleExports:   make(map[string]any),
+		components:       make(map[string]ComponentID),
+		args:             make(map[string]interface{}),
+		exports:          make(map[string]interface{}),
+		aliases:          make(map[string]ComponentID),
+		moduleArguments:  make(map[string]any),
+		defaultArguments: make(map[string]struct{}),
+		moduleExports:    make(map[string]any),
 	}
 }
 
@@ -64,6 +78,15 @@ func (vc *valueCache) CacheExports(id ComponentID, exports component.Exports) {
 		exportsVal = exports
 	}
 	vc.exports[nodeID] = exportsVal
+	vc.exportsCachedIndex++
+}
+
+// SetExportTransforms sets the transforms to apply to exports when building
+// contexts.
+func (vc *valueCache) SetExportTransforms(transforms []service.ExportTransform) {
+	vc.mut.Lock()
+	defer vc.mut.Unlock()
+	vc.transforms = transforms
 }
 
 // CacheModuleArgument will cache the provided exports using the given id.
@@ -76,6 +99,28 @@ func (vc *valueCache) CacheModuleArgument(key string, value any) {
 	} else {
 		vc.moduleArguments[key] = value
 	}
+	delete(vc.defaultArguments, key)
+}
+
+// CacheModuleArgumentDefault caches value as the default of an optional
+// module argument which wasn't supplied.
+func (vc *valueCache) CacheModuleArgumentDefault(key string, value any) {
+	vc.mut.Lock()
+	defer vc.mut.Unlock()
+
+	vc.moduleArguments[key] = value
+	vc.defaultArguments[key] = struct{}{}
+}
+
+// GetModuleArgument returns the cached value of a module argument, and
+// whether it is its default value. ok is false if the argument isn't cached.
+func (vc *valueCache) GetModuleArgument(key string) (value any, isDefault bool, ok bool) {
+	vc.mut.RLock()
+	defer vc.mut.RUnlock()
+
+	value, ok = vc.moduleArguments[key]
+	_, isDefault = vc.defaultArguments[key]
+	return value, isDefault, ok
 }
 
 // CacheModuleExportValue saves the value to the map
@@ -83,15 +128,8 @@ func (vc *valueCache) CacheModuleExportValue(name string, value any) {
 	vc.mut.Lock()
 	defer vc.mut.Unlock()
 
-	// Need to see if the module exports have changed.
-	v, found := vc.moduleExports[name]
-	if !found {
-		vc.moduleChangedIndex++
-	} else if !reflect.DeepEqual(v, value) {
-		vc.moduleChangedIndex++
-	}
-
 	vc.moduleExports[name] = value
+	vc.moduleExportsDirty = true
 }
 
 // CreateModuleExports creates a map for usage on OnExportsChanged
@@ -106,21 +144,43 @@ func (vc *valueCache) CreateModuleExports() map[string]any {
 	return exports
 }
 
-// ClearModuleExports empties the map and notifies that the exports have changed.
+// ClearModuleExports empties the map. The exports are only considered
+// changed if they differ once cached again.
 func (vc *valueCache) ClearModuleExports() {
 	vc.mut.Lock()
 	defer vc.mut.Unlock()
 
-	vc.moduleChangedIndex++
 	vc.moduleExports = make(map[string]any)
+	vc.moduleExportsDirty = true
 }
 
-// ExportChangeIndex return the change index.
+// ExportChangeIndex return the change index. The index is only incremented
+// when the module exports differ from the ones of the previous index, so
+// re-caching identical exports doesn't report a change.
 func (vc *valueCache) ExportChangeIndex() int {
+	vc.mut.Lock()
+	defer vc.mut.Unlock()
+
+	if vc.moduleExportsDirty {
+		vc.moduleExportsDirty = false
+		if vc.lastModuleExports == nil || !moduleExportsEqual(vc.lastModuleExports, vc.moduleExports) {
+			vc.moduleChangedIndex++
+			vc.lastModuleExports = make(map[string]any, len(vc.moduleExports))
+			for k, v := range vc.moduleExports {
+				vc.lastModuleExports[k] = v
+			}
+		}
+	}
+	return vc.moduleChangedIndex
+}
+
+// ExportsCachedIndex returns an index incremented every time component
+// exports are cached.
+func (vc *valueCache) ExportsCachedIndex() int {
 	vc.mut.RLock()
 	defer vc.mut.RUnlock()
 
-	return vc.moduleChangedIndex
+	return vc.exportsCachedIndex
 }
 
 // SyncIDs will remove any cached values for any Component ID which is not in
@@ -145,6 +205,14 @@ func (vc *valueCache) SyncIDs(ids []ComponentID) {
 	}
 }
 
+// SyncAliases replaces the set of aliases exposed by the cache. The exports
+// of the target of an alias are also exposed under the ID of the alias.
+func (vc *valueCache) SyncAliases(aliases map[string]ComponentID) {
+	vc.mut.Lock()
+	defer vc.mut.Unlock()
+	vc.aliases = aliases
+}
+
 // SyncModuleArgs will remove any cached values for any args no longer in the map.
 func (vc *valueCache) SyncModuleArgs(args map[string]any) {
 	vc.mut.Lock()
@@ -155,6 +223,7 @@ func (vc *valueCache) SyncModuleArgs(args map[string]any) {
 			continue
 		}
 		delete(vc.moduleArguments, id)
+		delete(vc.defaultArguments, id)
 	}
 }
 
@@ -175,6 +244,10 @@ func (vc *valueCache) BuildContext() *vm.Scope {
 		blockName := id[0]
 		componentsByBlockName[blockName] = append(componentsByBlockName[blockName], id)
 	}
+	for alias := range vc.aliases {
+		id := ComponentID(strings.Split(alias, "."))
+		componentsByBlockName[id[0]] = append(componentsByBlockName[id[0]], id)
+	}
 
 	// Then, convert each partition into a single value.
 	for blockName, ids := range componentsByBlockName {
@@ -208,11 +281,14 @@ func (vc *valueCache) buildValue(from []ComponentID, offset int) interface{} {
 
 		// TODO(rfratto): should we allow arguments to be returned so users can
 		// reference arguments as well as exports?
+		if target, ok := vc.aliases[name]; ok {
+			name = target.String()
+		}
 		exports, ok := vc.exports[name]
 		if !ok {
 			exports = make(map[string]interface{})
 		}
-		return exports
+		return transformExports(exports, vc.transforms)
 	}
 
 	attrs := make(map[string]interface{})
@@ -230,3 +306,99 @@ func (vc *valueCache) buildValue(from []ComponentID, offset int) interface{} {
 	}
 	return attrs
 }
+
+// transformExports applies transforms to exports when it is of a transformed
+// type, or else to the exported fields of a transformed type when it is a
+// struct. exports is never modified; a copy is returned if any field is
+// transformed. Values for which a transform returns a value of another type
+// are left untransformed.
+func transformExports(exports any, transforms []service.ExportTransform) any {
+	if exports == nil || len(transforms) == 0 {
+		return exports
+	}
+
+	rv := reflect.ValueOf(exports)
+	for _, t := range transforms {
+		if rv.Type() == t.Type {
+			if v, ok := applyTransform(t, rv); ok {
+				return v.Interface()
+			}
+			return exports
+		}
+	}
+	if rv.Kind() != reflect.Struct {
+		return exports
+	}
+
+	var out reflect.Value
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		for _, t := range transforms {
+			if field.Type != t.Type {
+				continue
+			}
+			v, ok := applyTransform(t, rv.Field(i))
+			if !ok {
+				break
+			}
+			if !out.IsValid() {
+				out = reflect.New(rv.Type()).Elem()
+				out.Set(rv)
+			}
+			out.Field(i).Set(v)
+			break
+		}
+	}
+	if !out.IsValid() {
+		return exports
+	}
+	return out.Interface()
+}
+
+// applyTransform returns the value of t.Transform for v. A nil result is
+// converted to the zero value of t.Type. It returns false if t.Transform
+// returns a value which can't be assigned to t.Type, so that the caller keeps
+// v rather than panicking.
+func applyTransform(t service.ExportTransform, v reflect.Value) (reflect.Value, bool) {
+	out := t.Transform(v.Interface())
+	if out == nil {
+		return reflect.Zero(t.Type), true
+	}
+	rv := reflect.ValueOf(out)
+	if !rv.Type().AssignableTo(t.Type) {
+		return reflect.Value{}, false
+	}
+	return rv, true
+}
+
+// hasTransformedExports returns whether transformExports would transform
+// exports.
+func hasTransformedExports(exports any, transforms []service.ExportTransform) bool {
+	if exports == nil {
+		return false
+	}
+	rt := reflect.TypeOf(exports)
+	for _, t := range transforms {
+		if rt == t.Type {
+			return true
+		}
+	}
+	if rt.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		for _, t := range transforms {
+			if field.Type == t.Type {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -115,7 +115,26 @@ func TestExportValueCacheUncomparable(t *testing.T) {
 	vc.CacheModuleExportValue("t2", test{TM: map[string]string{}})
 	index := vc.ExportChangeIndex()
 	vc.CacheModuleExportValue("t2", test{TM: map[string]string{}})
-	require.Equal(t, index, vc.moduleChangedIndex)
+	require.Equal(t, index, vc.ExportChangeIndex())
+}
+
+func TestExportValueCacheReset(t *testing.T) {
+	vc := newValueCache()
+	vc.CacheModuleExportValue("list", []any{"a", map[string]any{"b": 1, "c": 2}})
+	vc.CacheModuleExportValue("object", map[string]any{"d": []string{}})
+	index := vc.ExportChangeIndex()
+
+	// Clearing and re-setting identical exports, as done when a config is
+	// applied again, isn't a change.
+	vc.ClearModuleExports()
+	vc.CacheModuleExportValue("object", map[string]any{"d": []string(nil)})
+	vc.CacheModuleExportValue("list", []any{"a", map[string]any{"c": 2, "b": 1}})
+	require.Equal(t, index, vc.ExportChangeIndex())
+
+	// Removed exports are a change.
+	vc.ClearModuleExports()
+	vc.CacheModuleExportValue("list", []any{"a", map[string]any{"b": 1, "c": 2}})
+	require.NotEqual(t, index, vc.ExportChangeIndex())
 }
 
 func TestModuleArgumentCache(t *testing.T) {
@@ -90,6 +90,9 @@ func (im *ImportFile) Evaluate(scope *vm.Scope) error {
 
 	// Force an immediate read of the file to report any potential errors early.
 	if err := im.readFile(); err != nil {
+		// Reset the arguments so that the file is read again by the next
+		// evaluation.
+		im.args = FileArguments{}
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
@@ -133,6 +136,9 @@ func (im *ImportFile) Run(ctx context.Context) error {
 	defer func() {
 		im.mut.Lock()
 		defer im.mut.Unlock()
+		if im.detector == nil {
+			return
+		}
 		if err := im.detector.Close(); err != nil {
 			level.Error(im.managedOpts.Logger).Log("msg", "failed to shut down detector", "err", err)
 		}
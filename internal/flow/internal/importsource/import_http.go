@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/grafana/agent/internal/component"
@@ -15,10 +16,14 @@ import (
 
 // ImportHTTP imports a module from a HTTP server via the remote.http component.
 type ImportHTTP struct {
+	arguments   component.Arguments
+	managedOpts component.Options
+	eval        *vm.Evaluator
+
+	mut               sync.RWMutex
 	managedRemoteHTTP *remote_http.Component
-	arguments         component.Arguments
-	managedOpts       component.Options
-	eval              *vm.Evaluator
+	// created is closed once managedRemoteHTTP is created.
+	created chan struct{}
 }
 
 var _ ImportSource = (*ImportHTTP)(nil)
@@ -31,6 +36,7 @@ func NewImportHTTP(managedOpts component.Options, eval *vm.Evaluator, onContentC
 	return &ImportHTTP{
 		managedOpts: opts,
 		eval:        eval,
+		created:     make(chan struct{}),
 	}
 }
 
@@ -65,9 +71,13 @@ func (im *ImportHTTP) Evaluate(scope *vm.Scope) error {
 	if err := im.eval.Evaluate(scope, &arguments); err != nil {
 		return fmt.Errorf("decoding River: %w", err)
 	}
-	if im.managedRemoteHTTP == nil {
+	im.mut.RLock()
+	managedRemoteHTTP := im.managedRemoteHTTP
+	im.mut.RUnlock()
+
+	if managedRemoteHTTP == nil {
 		var err error
-		im.managedRemoteHTTP, err = remote_http.New(im.managedOpts, remote_http.Arguments{
+		managedRemoteHTTP, err = remote_http.New(im.managedOpts, remote_http.Arguments{
 			URL:           arguments.URL,
 			PollFrequency: arguments.PollFrequency,
 			PollTimeout:   arguments.PollTimeout,
@@ -80,6 +90,12 @@ func (im *ImportHTTP) Evaluate(scope *vm.Scope) error {
 			return fmt.Errorf("creating http component: %w", err)
 		}
 		im.arguments = arguments
+
+		im.mut.Lock()
+		im.managedRemoteHTTP = managedRemoteHTTP
+		im.mut.Unlock()
+		close(im.created)
+		return nil
 	}
 
 	if reflect.DeepEqual(im.arguments, arguments) {
@@ -87,18 +103,38 @@ func (im *ImportHTTP) Evaluate(scope *vm.Scope) error {
 	}
 
 	// Update the existing managed component
-	if err := im.managedRemoteHTTP.Update(arguments); err != nil {
+	if err := managedRemoteHTTP.Update(arguments); err != nil {
 		return fmt.Errorf("updating component: %w", err)
 	}
 	im.arguments = arguments
 	return nil
 }
 
+// Run runs the managed remote.http component. If it couldn't be created yet,
+// for example because the first request failed and the import uses its last
+// known good content instead, Run waits for a later evaluation to create it.
 func (im *ImportHTTP) Run(ctx context.Context) error {
-	return im.managedRemoteHTTP.Run(ctx)
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-im.created:
+	}
+
+	im.mut.RLock()
+	managedRemoteHTTP := im.managedRemoteHTTP
+	im.mut.RUnlock()
+	return managedRemoteHTTP.Run(ctx)
 }
 
 func (im *ImportHTTP) CurrentHealth() component.Health {
+	im.mut.RLock()
+	defer im.mut.RUnlock()
+	if im.managedRemoteHTTP == nil {
+		return component.Health{
+			Health:  component.HealthTypeUnhealthy,
+			Message: "http component not created",
+		}
+	}
 	return im.managedRemoteHTTP.CurrentHealth()
 }
 
@@ -0,0 +1,121 @@
+// Package lastknowngood persists the last content loaded without errors by
+// the Flow controller, its modules and its imports, so that it can be loaded
+// again when the content can't be retrieved.
+package lastknowngood
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ModulesDir is the directory of a last known good path where the
+	// content of modules is persisted.
+	ModulesDir = "modules"
+	// ImportsDir is the directory of a last known good path where the
+	// content of imports is persisted.
+	ImportsDir = "imports"
+
+	// tmpPrefix is the prefix of the temporary files written before being
+	// renamed over the persisted files.
+	tmpPrefix = ".tmp-"
+)
+
+// Dir returns the directory of the last known good path root where the
+// content of the module or the import with the given ID is persisted.
+func Dir(root, kind, id string) string {
+	return filepath.Join(root, kind, url.PathEscape(id))
+}
+
+// Write persists files to the directory dir, by file name. Each file is
+// written to a temporary file which is synced before being renamed over the
+// persisted one, so that a crash never leaves a partially written file. The
+// files of dir which aren't in files are removed afterwards, while its
+// subdirectories are kept.
+func Write(dir string, files map[string][]byte) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	for name, bb := range files {
+		if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, tmpPrefix) {
+			return fmt.Errorf("invalid file name %q", name)
+		}
+		if err := writeFile(filepath.Join(dir, name), bb); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, ok := files[entry.Name()]; ok || entry.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return syncDir(dir)
+}
+
+// writeFile atomically replaces the file at path with bb.
+func writeFile(path string, bb []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), tmpPrefix+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+
+	_, err = f.Write(bb)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+	}
+	return err
+}
+
+// syncDir syncs the directory dir, so that the renames of its files are
+// durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Read returns the files persisted to dir by Write, by file name.
+func Read(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), tmpPrefix) {
+			continue
+		}
+		bb, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name()] = bb
+	}
+	return files, nil
+}
@@ -0,0 +1,79 @@
+package testcomponents
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/featuregate"
+	"github.com/grafana/river/rivertypes"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:      "testcomponents.secret",
+		Stability: featuregate.StabilityBeta,
+		Args:      SecretConfig{},
+		Exports:   SecretExports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return NewSecret(opts, args.(SecretConfig))
+		},
+	})
+}
+
+// SecretConfig configures the testcomponents.secret component.
+type SecretConfig struct {
+	Value rivertypes.Secret `river:"value,attr"`
+}
+
+// SecretExports describes exported fields for the testcomponents.secret
+// component.
+type SecretExports struct {
+	Value component.Secret `river:"value,attr"`
+}
+
+// Secret implements the testcomponents.secret component, where it exports
+// its input secret without the controller storing it.
+type Secret struct {
+	opts component.Options
+
+	mut   sync.RWMutex
+	value rivertypes.Secret
+}
+
+// NewSecret creates a new secret component.
+func NewSecret(o component.Options, cfg SecretConfig) (*Secret, error) {
+	t := &Secret{opts: o}
+	if err := t.Update(cfg); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+var _ component.Component = (*Secret)(nil)
+
+// Run implements Component.
+func (t *Secret) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Update implements Component.
+func (t *Secret) Update(args component.Arguments) error {
+	c := args.(SecretConfig)
+
+	t.mut.Lock()
+	t.value = c.Value
+	t.mut.Unlock()
+
+	t.opts.OnStateChange(SecretExports{Value: component.NewSecret(t.Value)})
+	return nil
+}
+
+// Value returns the current secret.
+func (t *Secret) Value() rivertypes.Secret {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	return t.value
+}
@@ -0,0 +1,62 @@
+package testcomponents
+
+import (
+	"context"
+
+	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/featuregate"
+)
+
+func init() {
+	component.Register(component.Registration{
+		Name:      "testcomponents.targets",
+		Stability: featuregate.StabilityBeta,
+		Args:      TargetsConfig{},
+		Exports:   TargetsExports{},
+
+		Build: func(opts component.Options, args component.Arguments) (component.Component, error) {
+			return NewTargets(opts, args.(TargetsConfig))
+		},
+	})
+}
+
+// TargetsConfig configures the testcomponents.targets component.
+type TargetsConfig struct {
+	Targets []map[string]string `river:"targets,attr"`
+}
+
+// TargetsExports describes exported fields for the testcomponents.targets
+// component.
+type TargetsExports struct {
+	Targets []map[string]string `river:"targets,attr"`
+}
+
+// Targets implements the testcomponents.targets component, where it always
+// exports its input list of targets.
+type Targets struct {
+	opts component.Options
+}
+
+// NewTargets creates a new targets component.
+func NewTargets(o component.Options, cfg TargetsConfig) (*Targets, error) {
+	t := &Targets{opts: o}
+	if err := t.Update(cfg); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+var _ component.Component = (*Targets)(nil)
+
+// Run implements Component.
+func (t *Targets) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// Update implements Component.
+func (t *Targets) Update(args component.Arguments) error {
+	c := args.(TargetsConfig)
+	t.opts.OnStateChange(TargetsExports{Targets: c.Targets})
+	return nil
+}
@@ -0,0 +1,156 @@
+package worker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultSlowTaskThreshold is the default duration after which a running task
+// is logged by the watchdog of an instrumented Pool.
+const DefaultSlowTaskThreshold = 1 * time.Minute
+
+// Options configures the instrumentation of a Pool.
+type Options struct {
+	// Logger is used by the watchdog to log slow tasks. Slow tasks aren't
+	// logged if nil.
+	Logger log.Logger
+	// Registerer is used to register the metrics of the pool. The metrics
+	// aren't registered if nil.
+	Registerer prometheus.Registerer
+	// SlowTaskThreshold is how long a task must be running before the watchdog
+	// logs it. A task which keeps running is logged again every
+	// SlowTaskThreshold. Defaults to DefaultSlowTaskThreshold when zero.
+	SlowTaskThreshold time.Duration
+}
+
+// poolMetrics contains the metrics of a worker pool.
+type poolMetrics struct {
+	taskQueueAge prometheus.Histogram
+	taskDuration prometheus.Histogram
+	runningTasks prometheus.Gauge
+}
+
+func newPoolMetrics() *poolMetrics {
+	// Tasks which wait or run for 30s+ are the ones causing issues, so use the
+	// same buckets as the component evaluation time: 5ms, 25ms, 100ms, 500ms,
+	// 1s, 5s, 10s, 30s, 1m, 2m, 5m, 10m
+	buckets := []float64{.005, .025, .1, .5, 1, 5, 10, 30, 60, 120, 300, 600}
+
+	return &poolMetrics{
+		taskQueueAge: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "agent_component_worker_pool_task_queue_age_seconds",
+			Help:                            "Time tasks spent in the worker pool queue before they started running",
+			Buckets:                         buckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 1 * time.Hour,
+		}),
+		taskDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:                            "agent_component_worker_pool_task_duration_seconds",
+			Help:                            "Time tasks spent running in the worker pool",
+			Buckets:                         buckets,
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMaxBucketNumber:  100,
+			NativeHistogramMinResetDuration: 1 * time.Hour,
+		}),
+		runningTasks: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "agent_component_worker_pool_running_tasks",
+			Help: "Number of tasks currently running in the worker pool",
+		}),
+	}
+}
+
+func (m *poolMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.taskQueueAge, m.taskDuration, m.runningTasks}
+}
+
+// register registers the metrics with reg. Metrics registered by a previous
+// pool are replaced.
+func (m *poolMetrics) register(reg prometheus.Registerer) error {
+	for _, c := range m.collectors() {
+		err := reg.Register(c)
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			reg.Unregister(are.ExistingCollector)
+			err = reg.Register(c)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unregister unregisters the metrics from reg, unless they were replaced by
+// the metrics of another pool since they were registered.
+func (m *poolMetrics) unregister(reg prometheus.Registerer) {
+	for _, c := range m.collectors() {
+		// Registering c again is the only way to find out which collector is
+		// registered with its descriptors.
+		err := reg.Register(c)
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) && are.ExistingCollector != c {
+			continue
+		}
+		reg.Unregister(c)
+	}
+}
+
+// slowTask is a task found by the watchdog to be running for longer than the
+// slow task threshold.
+type slowTask struct {
+	key     string
+	running time.Duration
+}
+
+// watchdog periodically logs the tasks running for longer than the slow task
+// threshold until the pool is stopped.
+func (w *fixedWorkerPool) watchdog() {
+	defer w.allStopped.Done()
+
+	// Check twice per threshold, so that a slow task is logged at most half a
+	// threshold late.
+	ticker := time.NewTicker(w.slowTaskThreshold / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.quit:
+			return
+		case now := <-ticker.C:
+			for _, t := range w.workQueue.slowTasks(now, w.slowTaskThreshold) {
+				level.Warn(w.logger).Log(
+					"msg", "worker pool task is running for longer than the threshold",
+					"key", t.key,
+					"running_for", t.running,
+					"threshold", w.slowTaskThreshold,
+				)
+			}
+		}
+	}
+}
+
+// slowTasks returns the tasks which have been running for at least threshold
+// at now. To rate limit the logs, a task is only returned again once another
+// threshold has elapsed.
+func (w *workQueue) slowTasks(now time.Time, threshold time.Duration) []slowTask {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var res []slowTask
+	for key, started := range w.startedAt {
+		if now.Sub(started) < threshold {
+			continue
+		}
+		if reported, ok := w.reportedAt[key]; ok && now.Sub(reported) < threshold {
+			continue
+		}
+		w.reportedAt[key] = now
+		res = append(res, slowTask{key: key, running: now.Sub(started)})
+	}
+	return res
+}
@@ -4,6 +4,11 @@ import (
 	"fmt"
 	"runtime"
 	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Pool interface {
@@ -33,6 +38,11 @@ type fixedWorkerPool struct {
 	workQueue    *workQueue
 	quit         chan struct{}
 	allStopped   sync.WaitGroup
+
+	metrics           *poolMetrics
+	reg               prometheus.Registerer
+	logger            log.Logger
+	slowTaskThreshold time.Duration
 }
 
 var _ Pool = (*fixedWorkerPool)(nil)
@@ -41,19 +51,55 @@ func NewDefaultWorkerPool() Pool {
 	return NewFixedWorkerPool(runtime.NumCPU(), 1024)
 }
 
+// NewDefaultInstrumentedWorkerPool is like NewDefaultWorkerPool, but the pool
+// is instrumented according to opts. See NewInstrumentedWorkerPool.
+func NewDefaultInstrumentedWorkerPool(opts Options) Pool {
+	return NewInstrumentedWorkerPool(runtime.NumCPU(), 1024, opts)
+}
+
 // NewFixedWorkerPool creates a new Pool with the given number of workers and given max queue size.
 // The max queue size is the maximum number of tasks that can be queued OR running at the same time.
 // The tasks can run on a random worker, but workQueue ensures only one task with given key is running at a time.
 // The pool is automatically started and ready to accept work. To prevent resource leak, Stop() must be called when the
 // pool is no longer needed.
 func NewFixedWorkerPool(workersCount int, maxQueueSize int) Pool {
+	return NewInstrumentedWorkerPool(workersCount, maxQueueSize, Options{})
+}
+
+// NewInstrumentedWorkerPool is like NewFixedWorkerPool, but the pool reports
+// how long tasks wait in the queue and run, and the number of running tasks,
+// with the metrics registered with opts.Registerer. When opts.Logger is set, a
+// watchdog logs the key of the tasks running for longer than
+// opts.SlowTaskThreshold.
+func NewInstrumentedWorkerPool(workersCount int, maxQueueSize int, opts Options) Pool {
 	if workersCount <= 0 {
 		panic(fmt.Sprintf("workersCount must be positive, got %d", workersCount))
 	}
+	if opts.SlowTaskThreshold <= 0 {
+		opts.SlowTaskThreshold = DefaultSlowTaskThreshold
+	}
+
+	metrics := newPoolMetrics()
+	if opts.Registerer != nil {
+		// Failing to register the metrics shouldn't prevent the pool from
+		// running; they're only left unreported.
+		if err := metrics.register(opts.Registerer); err != nil {
+			if opts.Logger != nil {
+				level.Warn(opts.Logger).Log("msg", "failed to register worker pool metrics", "err", err)
+			}
+			metrics.unregister(opts.Registerer)
+			opts.Registerer = nil
+		}
+	}
+
 	pool := &fixedWorkerPool{
-		workersCount: workersCount,
-		workQueue:    newWorkQueue(maxQueueSize),
-		quit:         make(chan struct{}),
+		workersCount:      workersCount,
+		workQueue:         newWorkQueue(maxQueueSize, metrics),
+		quit:              make(chan struct{}),
+		metrics:           metrics,
+		reg:               opts.Registerer,
+		logger:            opts.Logger,
+		slowTaskThreshold: opts.SlowTaskThreshold,
 	}
 	pool.start()
 	return pool
@@ -72,6 +118,9 @@ func (w *fixedWorkerPool) QueueSize() int {
 func (w *fixedWorkerPool) Stop() {
 	close(w.quit)
 	w.allStopped.Wait()
+	if w.reg != nil {
+		w.metrics.unregister(w.reg)
+	}
 }
 
 func (w *fixedWorkerPool) start() {
@@ -89,24 +138,36 @@ func (w *fixedWorkerPool) start() {
 			}
 		}()
 	}
+	if w.logger != nil {
+		w.allStopped.Add(1)
+		go w.watchdog()
+	}
 }
 
 type workQueue struct {
 	maxSize    int
 	tasksToRun chan func()
+	metrics    *poolMetrics
 
 	lock         sync.Mutex
 	waitingOrder []string
 	waiting      map[string]func()
+	enqueuedAt   map[string]time.Time // When the waiting tasks were enqueued.
 	running      map[string]struct{}
+	startedAt    map[string]time.Time // When the running tasks started.
+	reportedAt   map[string]time.Time // When the running tasks were last reported as slow.
 }
 
-func newWorkQueue(maxSize int) *workQueue {
+func newWorkQueue(maxSize int, metrics *poolMetrics) *workQueue {
 	return &workQueue{
 		maxSize:    maxSize,
 		tasksToRun: make(chan func(), maxSize),
+		metrics:    metrics,
 		waiting:    make(map[string]func()),
+		enqueuedAt: make(map[string]time.Time),
 		running:    make(map[string]struct{}),
+		startedAt:  make(map[string]time.Time),
+		reportedAt: make(map[string]time.Time),
 	}
 }
 
@@ -128,6 +189,7 @@ func (w *workQueue) tryEnqueue(key string, f func()) (bool, error) {
 	// Else enqueue
 	w.waitingOrder = append(w.waitingOrder, key)
 	w.waiting[key] = f
+	w.enqueuedAt[key] = time.Now()
 
 	// A task may have become runnable now, emit it
 	w.emitNextTask()
@@ -135,10 +197,26 @@ func (w *workQueue) tryEnqueue(key string, f func()) (bool, error) {
 	return true, nil
 }
 
-func (w *workQueue) taskDone(key string) {
+// taskStarted records that the task with the given key, enqueued at
+// enqueuedAt, started running. It returns the time the task started.
+func (w *workQueue) taskStarted(key string, enqueuedAt time.Time) time.Time {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	now := time.Now()
+	w.startedAt[key] = now
+	w.metrics.taskQueueAge.Observe(now.Sub(enqueuedAt).Seconds())
+	w.metrics.runningTasks.Inc()
+	return now
+}
+
+func (w *workQueue) taskDone(key string, startedAt time.Time) {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 	delete(w.running, key)
+	delete(w.startedAt, key)
+	delete(w.reportedAt, key)
+	w.metrics.taskDuration.Observe(time.Since(startedAt).Seconds())
+	w.metrics.runningTasks.Dec()
 	// A task may have become runnable now, emit it
 	w.emitNextTask()
 }
@@ -172,12 +250,15 @@ func (w *workQueue) emitNextTask() {
 	// tasks queued to be ~10, the slice is actually faster because it does not allocate memory. See BenchmarkQueue.
 	w.waitingOrder = append(w.waitingOrder[:index], w.waitingOrder[index+1:]...)
 	task = w.waiting[key]
+	enqueuedAt := w.enqueuedAt[key]
 	delete(w.waiting, key)
+	delete(w.enqueuedAt, key)
 	w.running[key] = struct{}{}
 
 	// Wrap the actual task to make sure we mark it as done when it finishes
 	wrapped := func() {
-		defer w.taskDone(key)
+		startedAt := w.taskStarted(key, enqueuedAt)
+		defer w.taskDone(key, startedAt)
 		task()
 	}
 
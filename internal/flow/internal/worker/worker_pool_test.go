@@ -3,9 +3,13 @@ package worker
 import (
 	"container/list"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 	"go.uber.org/goleak"
@@ -281,6 +285,126 @@ func TestWorkerPool(t *testing.T) {
 	})
 }
 
+func TestInstrumentedWorkerPool(t *testing.T) {
+	t.Run("should report task metrics", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		reg := prometheus.NewRegistry()
+		pool := NewInstrumentedWorkerPool(1, 10, Options{Registerer: reg})
+
+		// The first task blocks the only worker, so that the second one waits
+		// in the queue.
+		blockFirstTask := make(chan struct{})
+		firstTaskRunning := make(chan struct{})
+		require.NoError(t, pool.SubmitWithKey("k1", func() {
+			firstTaskRunning <- struct{}{}
+			<-blockFirstTask
+		}))
+		<-firstTaskRunning
+		require.NoError(t, pool.SubmitWithKey("k2", func() {}))
+
+		require.Equal(t, 1.0, testutil.ToFloat64(pool.(*fixedWorkerPool).metrics.runningTasks))
+		time.Sleep(50 * time.Millisecond)
+		close(blockFirstTask)
+
+		require.Eventually(t, func() bool { return pool.QueueSize() == 0 }, 3*time.Second, 1*time.Millisecond)
+
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		histograms := make(map[string]*dto.Histogram)
+		for _, mf := range families {
+			if mf.GetType() == dto.MetricType_HISTOGRAM {
+				histograms[mf.GetName()] = mf.GetMetric()[0].GetHistogram()
+			}
+		}
+
+		queueAge := histograms["agent_component_worker_pool_task_queue_age_seconds"]
+		require.NotNil(t, queueAge)
+		require.Equal(t, uint64(2), queueAge.GetSampleCount())
+		// The second task waited for the first one to finish.
+		require.GreaterOrEqual(t, queueAge.GetSampleSum(), (50 * time.Millisecond).Seconds())
+
+		duration := histograms["agent_component_worker_pool_task_duration_seconds"]
+		require.NotNil(t, duration)
+		require.Equal(t, uint64(2), duration.GetSampleCount())
+		require.GreaterOrEqual(t, duration.GetSampleSum(), (50 * time.Millisecond).Seconds())
+
+		require.Equal(t, 0.0, testutil.ToFloat64(pool.(*fixedWorkerPool).metrics.runningTasks))
+
+		// Stopping the pool unregisters its metrics.
+		pool.Stop()
+		families, err = reg.Gather()
+		require.NoError(t, err)
+		require.Empty(t, families)
+	})
+
+	t.Run("should log slow tasks", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		logger := &captureLogger{}
+		pool := NewInstrumentedWorkerPool(2, 10, Options{
+			Logger:            logger,
+			SlowTaskThreshold: 50 * time.Millisecond,
+		})
+		defer pool.Stop()
+
+		unblock := make(chan struct{})
+		require.NoError(t, pool.SubmitWithKey("slow", func() { <-unblock }))
+		require.NoError(t, pool.SubmitWithKey("fast", func() {}))
+
+		require.Eventually(t, func() bool {
+			return len(logger.keys()) > 0
+		}, 3*time.Second, 1*time.Millisecond)
+		close(unblock)
+
+		// Only the slow task is logged, and at most once per threshold.
+		keys := logger.keys()
+		require.Less(t, len(keys), 3)
+		for _, key := range keys {
+			require.Equal(t, "slow", key)
+		}
+	})
+
+	t.Run("should not log tasks faster than the threshold", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		logger := &captureLogger{}
+		pool := NewInstrumentedWorkerPool(1, 10, Options{
+			Logger:            logger,
+			SlowTaskThreshold: time.Second,
+		})
+
+		done := make(chan struct{})
+		require.NoError(t, pool.SubmitWithKey("k1", func() {
+			time.Sleep(10 * time.Millisecond)
+			close(done)
+		}))
+		<-done
+		pool.Stop()
+		require.Empty(t, logger.keys())
+	})
+}
+
+// captureLogger records the keys of the tasks logged by the watchdog.
+type captureLogger struct {
+	mut     sync.Mutex
+	logKeys []string
+}
+
+func (l *captureLogger) Log(keyvals ...interface{}) error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		if keyvals[i] == "key" {
+			l.logKeys = append(l.logKeys, keyvals[i+1].(string))
+		}
+	}
+	return nil
+}
+
+func (l *captureLogger) keys() []string {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return append([]string(nil), l.logKeys...)
+}
+
 func BenchmarkQueue(b *testing.B) {
 	/* The slice-based implementation is faster when queue size is less than 100 elements, as it doesn't allocate:
 
@@ -0,0 +1,68 @@
+package flow
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/grafana/agent/internal/flow/internal/lastknowngood"
+)
+
+// writeLastKnownGood persists the raw content of source to the directory
+// path, one file per source file. Each file is replaced atomically, and the
+// files of a previous source which aren't part of source are removed.
+func writeLastKnownGood(path string, source *Source) error {
+	files := make(map[string][]byte, len(source.RawConfigs()))
+	for name, bb := range source.RawConfigs() {
+		// Files are named after the source files, which are all in the
+		// same directory when loaded from disk.
+		fileName := filepath.Base(name)
+		if _, ok := files[fileName]; ok {
+			return fmt.Errorf("source files with the same name %q can't be persisted", fileName)
+		}
+		files[fileName] = bb
+	}
+	return lastknowngood.Write(path, files)
+}
+
+// LoadLastKnownGood parses the source persisted to path by the controller
+// created with Options.LastKnownGoodPath set to path.
+func LoadLastKnownGood(path string) (*Source, error) {
+	files, err := lastknowngood.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string][]byte, len(files))
+	for name, bb := range files {
+		sources[filepath.Join(path, name)] = bb
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no last known good config in %s", path)
+	}
+	return ParseSources(sources)
+}
+
+// lastKnownGoodModuleFile is the name of the file the content of a module is
+// persisted to.
+const lastKnownGoodModuleFile = "module.river"
+
+// writeLastKnownGoodModule persists the content of the module with the given
+// ID to the last known good path root.
+func writeLastKnownGoodModule(root, id string, config []byte) error {
+	dir := lastknowngood.Dir(root, lastknowngood.ModulesDir, id)
+	return lastknowngood.Write(dir, map[string][]byte{lastKnownGoodModuleFile: config})
+}
+
+// readLastKnownGoodModule returns the content of the module with the given ID
+// persisted to the last known good path root.
+func readLastKnownGoodModule(root, id string) ([]byte, error) {
+	files, err := lastknowngood.Read(lastknowngood.Dir(root, lastknowngood.ModulesDir, id))
+	if err != nil {
+		return nil, err
+	}
+	config, ok := files[lastKnownGoodModuleFile]
+	if !ok {
+		return nil, fmt.Errorf("no last known good content for module %s", id)
+	}
+	return config, nil
+}
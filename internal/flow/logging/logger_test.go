@@ -185,6 +185,52 @@ func Test_lokiWriter_nil(t *testing.T) {
 	})
 }
 
+func TestOverrideLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, infoLevel())
+	require.NoError(t, err)
+
+	override := logger.WithLevelOverride()
+	logLines := func() string {
+		buf.Reset()
+		flowlevel.Debug(override).Log("msg", "debug")
+		flowlevel.Info(override).Log("msg", "info")
+		flowlevel.Warn(override).Log("msg", "warn")
+		return withoutTimestamps(buf.String())
+	}
+
+	// Without an override, the level of the parent is used.
+	require.Equal(t, "level=info msg=info\nlevel=warn msg=warn\n", logLines())
+
+	override.SetLevel(logging.LevelDebug)
+	require.Equal(t, "level=debug msg=debug\nlevel=info msg=info\nlevel=warn msg=warn\n", logLines())
+
+	override.SetLevel(logging.LevelWarn)
+	require.Equal(t, "level=warn msg=warn\n", logLines())
+
+	// The parent is unaffected by the override.
+	buf.Reset()
+	flowlevel.Info(logger).Log("msg", "info")
+	require.Equal(t, "level=info msg=info\n", withoutTimestamps(buf.String()))
+
+	// Clearing the override follows the parent level again, including
+	// changes to it.
+	override.SetLevel("")
+	require.NoError(t, logger.Update(debugLevel()))
+	require.Equal(t, "level=debug msg=debug\nlevel=info msg=info\nlevel=warn msg=warn\n", logLines())
+}
+
+// withoutTimestamps removes the leading ts field of each logfmt line in s.
+func withoutTimestamps(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "ts=") {
+			lines[i] = line[strings.Index(line, " ")+1:]
+		}
+	}
+	return strings.Join(lines, "")
+}
+
 func BenchmarkLogging_NoLevel_Prints(b *testing.B) {
 	logger, err := logging.New(io.Discard, infoLevel())
 	require.NoError(b, err)
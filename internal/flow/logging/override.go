@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/grafana/agent/internal/slogadapter"
+)
+
+// OverrideLogger writes logs to a Logger. When its level is set, logs are
+// filtered by that level instead of the level of the Logger, so a single
+// component can log more or less than the rest of the process. The level can
+// be changed at any time.
+type OverrideLogger struct {
+	parent  *Logger
+	leveler *overrideLeveler
+	handler *handler
+}
+
+var _ EnabledAware = (*OverrideLogger)(nil)
+
+// WithLevelOverride returns an OverrideLogger which writes to l. The returned
+// logger uses the level of l until SetLevel is called.
+func (l *Logger) WithLevelOverride() *OverrideLogger {
+	leveler := &overrideLeveler{parent: l.level}
+	return &OverrideLogger{
+		parent:  l,
+		leveler: leveler,
+		handler: &handler{
+			w:         l.writer,
+			leveler:   leveler,
+			formatter: l.format,
+		},
+	}
+}
+
+// SetLevel sets the level used to filter logs. Setting an empty level
+// restores the level of the parent Logger.
+func (o *OverrideLogger) SetLevel(level Level) {
+	o.leveler.Set(level)
+}
+
+// Enabled implements EnabledAware interface.
+func (o *OverrideLogger) Enabled(ctx context.Context, level slog.Level) bool {
+	return o.handler.Enabled(ctx, level)
+}
+
+// Log implements log.Logger.
+func (o *OverrideLogger) Log(kvps ...interface{}) error {
+	// Logs are buffered by the parent until the log format is known.
+	o.parent.bufferMut.RLock()
+	hasLogFormat := o.parent.hasLogFormat
+	o.parent.bufferMut.RUnlock()
+	if !hasLogFormat {
+		return o.parent.Log(kvps...)
+	}
+
+	return slogadapter.GoKit(o.handler).Log(kvps...)
+}
+
+// overrideLeveler is a slog.Leveler which returns the level of its parent
+// unless an override is set.
+type overrideLeveler struct {
+	parent slog.Leveler
+
+	mut      sync.RWMutex
+	override *slog.Level
+}
+
+func (o *overrideLeveler) Set(level Level) {
+	o.mut.Lock()
+	defer o.mut.Unlock()
+
+	if level == "" {
+		o.override = nil
+		return
+	}
+	l := slogLevel(level).Level()
+	o.override = &l
+}
+
+func (o *overrideLeveler) Level() slog.Level {
+	o.mut.RLock()
+	defer o.mut.RUnlock()
+
+	if o.override != nil {
+		return *o.override
+	}
+	return o.parent.Level()
+}
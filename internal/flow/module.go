@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"path"
 	"sync"
+	"time"
 
 	"github.com/grafana/agent/internal/component"
 	"github.com/grafana/agent/internal/featuregate"
@@ -123,7 +124,8 @@ type moduleOptions struct {
 }
 
 var (
-	_ component.Module = (*module)(nil)
+	_ component.Module              = (*module)(nil)
+	_ component.LastKnownGoodModule = (*module)(nil)
 )
 
 // newModule creates a module instance for a specific component.
@@ -147,7 +149,14 @@ func newModule(o *moduleOptions) *module {
 						o.export(exports)
 					}
 				},
-				Services: o.ServiceMap.List(),
+				Services:                o.ServiceMap.List(),
+				GoroutineLeakCheckDelay: o.LeakCheckDelay,
+				MinUpdateInterval:       o.MinUpdateInterval,
+				RetryMaxBackoff:         o.RetryMaxBackoff,
+				DrainTimeout:            o.DrainTimeout,
+				MaxDeclareLabels:        o.MaxDeclareLabels,
+				ProfileExpressions:      o.ProfileExpressions,
+				LastKnownGoodPath:       o.LastKnownGoodPath,
 			},
 		}),
 	}
@@ -159,7 +168,29 @@ func (c *module) LoadConfig(config []byte, args map[string]any) error {
 	if err != nil {
 		return err
 	}
-	return c.f.LoadSource(ff, args)
+	if err := c.f.LoadSource(ff, args); err != nil {
+		return err
+	}
+
+	if c.o.LastKnownGoodPath != "" {
+		if err := writeLastKnownGoodModule(c.o.LastKnownGoodPath, c.o.ID, config); err != nil {
+			level.Warn(c.f.log).Log("msg", "failed to persist last known good module content", "module", c.o.ID, "err", err)
+		}
+	}
+	return nil
+}
+
+// LoadLastKnownGood loads the last content loaded without errors by a module
+// with the same ID, if any was persisted.
+func (c *module) LoadLastKnownGood(args map[string]any) error {
+	if c.o.LastKnownGoodPath == "" {
+		return fmt.Errorf("no last known good path configured")
+	}
+	config, err := readLastKnownGoodModule(c.o.LastKnownGoodPath, c.o.ID)
+	if err != nil {
+		return err
+	}
+	return c.LoadConfig(config, args)
 }
 
 // LoadBody loads a pre-parsed River config.
@@ -168,7 +199,20 @@ func (c *module) LoadBody(body ast.Body, args map[string]any, customComponentReg
 	if err != nil {
 		return err
 	}
-	return c.f.loadSource(ff, args, customComponentRegistry)
+
+	// The generation of the loader only changes when the graph was built, so
+	// a failed load which changed it comes from evaluating the nodes.
+	generation := c.f.loader.ApplyInfo().Generation
+	err = c.f.loadSource(ff, args, customComponentRegistry)
+	if err != nil && c.f.loader.ApplyInfo().Generation != generation {
+		return &controller.InstanceError{Err: err}
+	}
+	return err
+}
+
+// ModuleArguments implements [controller.CustomComponent].
+func (c *module) ModuleArguments() []controller.ModuleArgument {
+	return c.f.loader.ModuleArguments()
 }
 
 // Run starts the Module. No components within the Module
@@ -209,6 +253,34 @@ type moduleControllerOptions struct {
 	// the user, for example, via command-line flags.
 	MinStability featuregate.Stability
 
+	// LeakCheckDelay is the delay after which goroutines of removed components
+	// are reported as leaked. Leak detection is disabled when zero.
+	LeakCheckDelay time.Duration
+
+	// MinUpdateInterval is the minimum time between two evaluations of the
+	// dependants of a component caused by changes of its exports.
+	MinUpdateInterval time.Duration
+
+	// RetryMaxBackoff is the maximum backoff between two retries of a node
+	// which failed evaluation. Disabled when zero.
+	RetryMaxBackoff time.Duration
+
+	// DrainTimeout is how long the module waits for each of its components
+	// to stop when it exits. Defaults to DefaultDrainTimeout when zero.
+	DrainTimeout time.Duration
+
+	// MaxDeclareLabels is the maximum number of distinct values of the
+	// declare label of the custom component metrics of the module.
+	MaxDeclareLabels int
+
+	// ProfileExpressions enables timing the function calls of the
+	// expressions of the components of the module.
+	ProfileExpressions bool
+
+	// LastKnownGoodPath is the directory where the last content loaded
+	// without errors by the module is persisted. Disabled when empty.
+	LastKnownGoodPath string
+
 	// ID is the attached components full ID.
 	ID string
 
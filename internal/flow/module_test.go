@@ -82,7 +82,7 @@ func TestModule(t *testing.T) {
 			name:                  "Service blocks not allowed in module config",
 			argumentModuleContent: argumentConfig + serviceConfig,
 			exportModuleContent:   exportStringConfig,
-			expectedErrorContains: "service blocks not allowed inside a module: \"testservice\"",
+			expectedErrorContains: "t1:7:2: service blocks not allowed inside a module: \"testservice\"; services are shared with the root configuration",
 		},
 		{
 			name:                  "Argument not defined in module source",
@@ -190,6 +190,30 @@ func TestExportsWhenNotUsed(t *testing.T) {
 	}
 }
 
+func TestModule_LastKnownGood(t *testing.T) {
+	defer verifyNoGoroutineLeaks(t)
+	o := testModuleControllerOptions(t)
+	o.LastKnownGoodPath = t.TempDir()
+	defer o.WorkerPool.Stop()
+
+	mod, err := newModuleController(o).NewModule("t1", nil)
+	require.NoError(t, err)
+	require.NoError(t, mod.LoadConfig([]byte(argumentConfig), map[string]any{"username": "bob"}))
+
+	// Content which fails to load isn't persisted.
+	require.Error(t, mod.LoadConfig([]byte(argumentConfig), nil))
+
+	// Simulate a restart of the module while its content can't be retrieved.
+	restarted, err := newModuleController(o).NewModule("t1", nil)
+	require.NoError(t, err)
+	require.NoError(t, restarted.(component.LastKnownGoodModule).LoadLastKnownGood(map[string]any{"username": "bob"}))
+	require.Len(t, restarted.(*module).ModuleArguments(), 2)
+
+	other, err := newModuleController(o).NewModule("t2", nil)
+	require.NoError(t, err)
+	require.ErrorIs(t, other.(component.LastKnownGoodModule).LoadLastKnownGood(nil), os.ErrNotExist)
+}
+
 func TestIDList(t *testing.T) {
 	defer verifyNoGoroutineLeaks(t)
 	o := testModuleControllerOptions(t)
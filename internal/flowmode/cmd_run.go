@@ -60,6 +60,8 @@ func runCommand() *cobra.Command {
 		clusterAdvInterfaces:  advertise.DefaultInterfaces,
 		ClusterMaxJoinPeers:   5,
 		clusterRejoinInterval: 60 * time.Second,
+		drainTimeout:          flow.DefaultDrainTimeout,
+		maxDeclareLabels:      flow.DefaultMaxDeclareLabels,
 	}
 
 	cmd := &cobra.Command{
@@ -89,7 +91,14 @@ Additionally, the HTTP server exposes the following debug endpoints:
 
 If reloading the config dir/file-path fails, Grafana Agent Flow will continue running in
 its last valid state. Components which failed may be be listed as unhealthy,
-depending on the nature of the reload error.
+depending on the nature of the reload error. Configs which fail validation, for
+example because of a syntax error or a reference to an unknown component, are
+rejected before any running component is updated.
+
+When --config.last-known-good-path is set, the last config loaded successfully
+is persisted to that directory. If the config dir/file-path can't be loaded at
+startup, Grafana Agent Flow runs the persisted config instead, and reports it
+through the agent_config_last_known_good_active metric.
 `,
 		Args:         cobra.ExactArgs(1),
 		SilenceUsage: true,
@@ -131,12 +140,20 @@ depending on the nature of the reload error.
 	cmd.Flags().StringVar(&r.configFormat, "config.format", r.configFormat, fmt.Sprintf("The format of the source file. Supported formats: %s.", supportedFormatsList()))
 	cmd.Flags().BoolVar(&r.configBypassConversionErrors, "config.bypass-conversion-errors", r.configBypassConversionErrors, "Enable bypassing errors when converting")
 	cmd.Flags().StringVar(&r.configExtraArgs, "config.extra-args", r.configExtraArgs, "Extra arguments from the original format used by the converter. Multiple arguments can be passed by separating them with a space.")
+	cmd.Flags().StringVar(&r.configLastKnownGoodPath, "config.last-known-good-path", r.configLastKnownGoodPath, "Directory where the last config loaded successfully is persisted, and loaded from when the config can't be loaded at startup. Disabled when empty")
 
 	// Misc flags
 	cmd.Flags().
 		BoolVar(&r.disableReporting, "disable-reporting", r.disableReporting, "Disable reporting of enabled components to Grafana.")
 	cmd.Flags().StringVar(&r.storagePath, "storage.path", r.storagePath, "Base directory where components can store data")
 	cmd.Flags().Var(&r.minStability, "stability.level", fmt.Sprintf("Minimum stability level of features to enable. Supported values: %s", strings.Join(featuregate.AllowedValues(), ", ")))
+	cmd.Flags().DurationVar(&r.goroutineLeakCheckDelay, "debug.goroutine-leak-check-delay", r.goroutineLeakCheckDelay, "Report goroutines which are still running this long after their component was removed. Disabled when 0")
+	cmd.Flags().BoolVar(&r.profileExpressions, "debug.profile-expressions", r.profileExpressions, "Time the function calls of the expressions of components, and report the slowest ones of their last evaluation in their debug info")
+	cmd.Flags().DurationVar(&r.minUpdateInterval, "component.min-update-interval", r.minUpdateInterval, "Minimum time between two re-evaluations of the dependants of a component caused by changes of its exports. Disabled when 0")
+	cmd.Flags().DurationVar(&r.retryMaxBackoff, "component.retry-max-backoff", r.retryMaxBackoff, "Maximum backoff between two retries of a component which failed evaluation. Failed components aren't retried when 0")
+	cmd.Flags().DurationVar(&r.drainTimeout, "component.drain-timeout", r.drainTimeout, "How long to wait for each component to stop on shutdown before stopping the components it sends data to anyway")
+	cmd.Flags().IntVar(&r.maxDeclareLabels, "component.max-declare-labels", r.maxDeclareLabels, "Maximum number of distinct declare labels of the custom component metrics. Custom components of further declare blocks are reported under the __overflow__ label")
+	cmd.Flags().StringSliceVar(&r.criticalComponents, "component.critical", r.criticalComponents, "IDs of the components which make the agent not ready while they're unhealthy, such as prometheus.remote_write.default")
 	return cmd
 }
 
@@ -160,6 +177,14 @@ type flowRun struct {
 	configFormat                 string
 	configBypassConversionErrors bool
 	configExtraArgs              string
+	configLastKnownGoodPath      string
+	goroutineLeakCheckDelay      time.Duration
+	profileExpressions           bool
+	minUpdateInterval            time.Duration
+	retryMaxBackoff              time.Duration
+	drainTimeout                 time.Duration
+	maxDeclareLabels             int
+	criticalComponents           []string
 }
 
 func (fr *flowRun) Run(configPath string) error {
@@ -219,7 +244,8 @@ func (fr *flowRun) Run(configPath string) error {
 	// service needs and set them after the Flow controller exists.
 	var (
 		reload func() (*flow.Source, error)
-		ready  func() bool
+		ready  func() error
+		stable func(ctx context.Context) error
 	)
 
 	clusterService, err := buildClusterService(clusterOptions{
@@ -247,8 +273,9 @@ func (fr *flowRun) Run(configPath string) error {
 		Tracer:   t,
 		Gatherer: prometheus.DefaultGatherer,
 
-		ReadyFunc:  func() bool { return ready() },
+		ReadyFunc:  func() error { return ready() },
 		ReloadFunc: func() (*flow.Source, error) { return reload() },
+		StableFunc: func(ctx context.Context) error { return stable(ctx) },
 
 		HTTPListenAddr:   fr.httpListenAddr,
 		MemoryListenAddr: fr.inMemoryAddr,
@@ -281,6 +308,16 @@ func (fr *flowRun) Run(configPath string) error {
 		DataPath:     fr.storagePath,
 		Reg:          reg,
 		MinStability: fr.minStability,
+
+		GoroutineLeakCheckDelay: fr.goroutineLeakCheckDelay,
+		ProfileExpressions:      fr.profileExpressions,
+		MinUpdateInterval:       fr.minUpdateInterval,
+		RetryMaxBackoff:         fr.retryMaxBackoff,
+		DrainTimeout:            fr.drainTimeout,
+		MaxDeclareLabels:        fr.maxDeclareLabels,
+		LastKnownGoodPath:       fr.configLastKnownGoodPath,
+		CriticalComponents:      fr.criticalComponents,
+
 		Services: []service.Service{
 			httpService,
 			uiService,
@@ -291,7 +328,8 @@ func (fr *flowRun) Run(configPath string) error {
 		},
 	})
 
-	ready = f.Ready
+	ready = f.Readiness
+	stable = f.WaitForStable
 	reload = func() (*flow.Source, error) {
 		flowSource, err := loadFlowSource(configPath, fr.configFormat, fr.configBypassConversionErrors, fr.configExtraArgs)
 		defer instrumentation.InstrumentSHA256(flowSource.SHA256())
@@ -300,10 +338,15 @@ func (fr *flowRun) Run(configPath string) error {
 		if err != nil {
 			return nil, fmt.Errorf("reading config path %q: %w", configPath, err)
 		}
+		// Reject invalid configs before the running components are updated.
+		if err := f.Validate(flowSource, nil); err != nil {
+			return flowSource, fmt.Errorf("validating config path %q: %w", configPath, err)
+		}
 		if err := f.LoadSource(flowSource, nil); err != nil {
 			return flowSource, fmt.Errorf("error during the initial grafana/agent load: %w", err)
 		}
 
+		instrumentation.InstrumentLastKnownGood(false)
 		return flowSource, nil
 	}
 
@@ -333,7 +376,16 @@ func (fr *flowRun) Run(configPath string) error {
 	// Perform the initial reload. This is done after starting the HTTP server so
 	// that /metric and pprof endpoints are available while the Flow controller
 	// is loading.
-	if source, err := reload(); err != nil {
+	source, err := reload()
+	if err != nil && fr.configLastKnownGoodPath != "" {
+		if lkgErr := loadLastKnownGood(f, fr.configLastKnownGoodPath); lkgErr != nil {
+			level.Error(l).Log("msg", "failed to load the last known good config", "path", fr.configLastKnownGoodPath, "err", lkgErr)
+		} else {
+			level.Warn(l).Log("msg", "failed to load config, running the last known good config instead", "path", fr.configLastKnownGoodPath, "err", err)
+			err = nil
+		}
+	}
+	if err != nil {
 		var diags diag.Diagnostics
 		if errors.As(err, &diags) {
 			p := diag.NewPrinter(diag.PrinterConfig{
@@ -380,6 +432,22 @@ func (fr *flowRun) Run(configPath string) error {
 	}
 }
 
+// loadLastKnownGood loads the config persisted to path by f.
+func loadLastKnownGood(f *flow.Flow, path string) error {
+	source, err := flow.LoadLastKnownGood(path)
+	if err != nil {
+		return err
+	}
+	if err := f.Validate(source, nil); err != nil {
+		return err
+	}
+	if err := f.LoadSource(source, nil); err != nil {
+		return err
+	}
+	instrumentation.InstrumentLastKnownGood(true)
+	return nil
+}
+
 // getEnabledComponentsFunc returns a function that gets the current enabled components
 func getEnabledComponentsFunc(f *flow.Flow) func() map[string]interface{} {
 	return func() map[string]interface{} {
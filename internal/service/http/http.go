@@ -4,6 +4,7 @@ package http
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/gorilla/mux"
@@ -34,6 +36,10 @@ import (
 // ServiceName defines the name used for the HTTP service.
 const ServiceName = "http"
 
+// defaultStableTimeout is how long /-/stable waits for the component
+// controller to be stable when no timeout is given.
+const defaultStableTimeout = 30 * time.Second
+
 // Options are used to configure the HTTP service. Options are constant for the
 // lifetime of the HTTP service.
 type Options struct {
@@ -41,8 +47,9 @@ type Options struct {
 	Tracer   trace.TracerProvider // Where to send traces.
 	Gatherer prometheus.Gatherer  // Where to collect metrics from.
 
-	ReadyFunc  func() bool
+	ReadyFunc  func() error // Returns nil when ready, or the reason why not ready.
 	ReloadFunc func() (*flow.Source, error)
+	StableFunc func(ctx context.Context) error
 
 	HTTPListenAddr   string // Address to listen for HTTP traffic on.
 	MemoryListenAddr string // Address to accept in-memory traffic on.
@@ -173,12 +180,12 @@ func (s *Service) Run(ctx context.Context, host service.Host) error {
 
 	if s.opts.ReadyFunc != nil {
 		r.HandleFunc("/-/ready", func(w http.ResponseWriter, _ *http.Request) {
-			if s.opts.ReadyFunc() {
+			if err := s.opts.ReadyFunc(); err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintf(w, "Agent is not ready: %s\n", err)
+			} else {
 				w.WriteHeader(http.StatusOK)
 				fmt.Fprintln(w, "Agent is ready.")
-			} else {
-				w.WriteHeader(http.StatusServiceUnavailable)
-				fmt.Fprintln(w, "Agent is not ready.")
 			}
 		})
 	}
@@ -190,7 +197,7 @@ func (s *Service) Run(ctx context.Context, host service.Host) error {
 			_, err := s.opts.ReloadFunc()
 			if err != nil {
 				level.Error(s.log).Log("msg", "failed to reload config", "err", err.Error())
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				writeReloadError(w, err)
 				return
 			}
 
@@ -199,6 +206,10 @@ func (s *Service) Run(ctx context.Context, host service.Host) error {
 		}).Methods(http.MethodGet, http.MethodPost)
 	}
 
+	if s.opts.StableFunc != nil {
+		r.HandleFunc("/-/stable", s.handleStable).Methods(http.MethodGet)
+	}
+
 	// Wire custom service handlers for services which depend on the http
 	// service.
 	//
@@ -231,6 +242,32 @@ func (s *Service) Run(ctx context.Context, host service.Host) error {
 	return nil
 }
 
+// handleStable waits for the component controller to be stable for up to the
+// duration given by the timeout query parameter.
+func (s *Service) handleStable(w http.ResponseWriter, r *http.Request) {
+	timeout := defaultStableTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "invalid timeout %q\n", v)
+			return
+		}
+		timeout = d
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	if err := s.opts.StableFunc(ctx); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "Components are not stable.")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Components are stable.")
+}
+
 // getServiceRoutes returns a sorted list of service routes for services which
 // depend on the HTTP service.
 //
@@ -265,11 +302,16 @@ func (s *Service) componentHandler(host service.Host) http.HandlerFunc {
 		// Trim the path prefix to get our full path.
 		trimmedPath := strings.TrimPrefix(r.URL.Path, s.componentHttpPathPrefix)
 
-		// splitURLPath should only fail given an unexpected path.
+		// Components are looked up on every request, so that the handlers of
+		// unloaded components can't be reached anymore.
 		componentID, componentPath, err := splitURLPath(host, trimmedPath)
-		if err != nil {
+		if errors.Is(err, component.ErrComponentNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			fmt.Fprintf(w, "failed to parse URL path %q: %s\n", r.URL.Path, err)
+			return
 		}
 
 		info, err := host.GetComponent(componentID, component.InfoOptions{})
@@ -292,7 +334,40 @@ func (s *Service) componentHandler(host service.Host) http.HandlerFunc {
 		// Send just the remaining path to our component so each component can
 		// handle paths from their own root path.
 		r.URL.Path = componentPath
-		handler.ServeHTTP(w, r)
+
+		start := time.Now()
+		rw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rw, r)
+		level.Debug(s.log).Log(
+			"msg", "served component HTTP request",
+			"component", componentID.String(),
+			"method", r.Method,
+			"path", componentPath,
+			"status", rw.status,
+			"duration", time.Since(start),
+		)
+	}
+}
+
+// statusResponseWriter records the status code written by a component
+// handler for the access log.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush implements http.Flusher, so that components can stream responses.
+func (w *statusResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
 }
 
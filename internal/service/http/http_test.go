@@ -2,8 +2,12 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"sync"
 	"testing"
 
 	"github.com/grafana/agent/internal/component"
@@ -12,6 +16,8 @@ import (
 	"github.com/grafana/agent/internal/service"
 	"github.com/grafana/agent/internal/util"
 	"github.com/grafana/river"
+	"github.com/grafana/river/diag"
+	"github.com/grafana/river/token"
 	"github.com/phayes/freeport"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/config"
@@ -155,9 +161,220 @@ func Test_Toggle_TLS(t *testing.T) {
 	}
 }
 
+func TestReload(t *testing.T) {
+	ctx := componenttest.TestContext(t)
+
+	env, err := newTestEnvironment(t)
+	require.NoError(t, err)
+	require.NoError(t, env.ApplyConfig(`/* empty */`))
+
+	go func() {
+		require.NoError(t, env.Run(ctx))
+	}()
+
+	reload := func(t require.TestingT) *http.Response {
+		resp, err := http.Post(fmt.Sprintf("http://%s/-/reload", env.ListenAddr()), "", nil)
+		require.NoError(t, err)
+		return resp
+	}
+
+	util.Eventually(t, func(t require.TestingT) {
+		resp := reload(t)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("diagnostics", func(t *testing.T) {
+		reloadErr := fmt.Errorf("validating config path %q: %w", "config.river", diag.Diagnostics{{
+			Severity: diag.SeverityLevelError,
+			Message:  `component "testcomponents.passthrough.missing" does not exist`,
+			StartPos: token.Position{Filename: "config.river", Line: 2, Column: 11},
+			EndPos:   token.Position{Filename: "config.river", Line: 2, Column: 49},
+		}})
+		env.SetReloadError(reloadErr)
+
+		resp := reload(t)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+		var body reloadErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Equal(t, reloadErr.Error(), body.Error)
+		require.Equal(t, []reloadDiagnostic{{
+			Severity: "error",
+			Message:  `component "testcomponents.passthrough.missing" does not exist`,
+			StartPos: "config.river:2:11",
+			EndPos:   "config.river:2:49",
+		}}, body.Diagnostics)
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		reloadErr := fmt.Errorf("reading config path %q: %w", "config.river", os.ErrNotExist)
+		env.SetReloadError(reloadErr)
+
+		resp := reload(t)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, reloadErr.Error()+"\n", string(body))
+	})
+}
+
+func TestStable(t *testing.T) {
+	ctx := componenttest.TestContext(t)
+
+	env, err := newTestEnvironment(t)
+	require.NoError(t, err)
+	require.NoError(t, env.ApplyConfig(`/* empty */`))
+
+	go func() {
+		require.NoError(t, env.Run(ctx))
+	}()
+
+	stable := func(t require.TestingT, query string) *http.Response {
+		resp, err := http.Get(fmt.Sprintf("http://%s/-/stable%s", env.ListenAddr(), query))
+		require.NoError(t, err)
+		return resp
+	}
+
+	util.Eventually(t, func(t require.TestingT) {
+		resp := stable(t, "")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		env.SetStableFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		defer env.SetStableFunc(nil)
+
+		resp := stable(t, "?timeout=10ms")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		resp := stable(t, "?timeout=soon")
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestComponentHandler(t *testing.T) {
+	ctx := componenttest.TestContext(t)
+
+	host := &componentHost{components: map[component.ID]component.Component{
+		component.ParseID("test.handler.a"):                  &handlerComponent{name: "root"},
+		component.ParseID("module.string.m/test.handler.a"):  &handlerComponent{name: "module"},
+		component.ParseID("test.no_handler"):                 &handlerComponent{},
+		component.ParseID("module.string.m/test.no_handler"): nil,
+	}}
+
+	env, err := newTestEnvironment(t)
+	require.NoError(t, err)
+	env.host = host
+	require.NoError(t, env.ApplyConfig(`/* empty */`))
+
+	go func() {
+		require.NoError(t, env.Run(ctx))
+	}()
+
+	get := func(t require.TestingT, path string) (int, string) {
+		resp, err := http.Get(fmt.Sprintf("http://%s/api/v0/component/%s", env.ListenAddr(), path))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	util.Eventually(t, func(t require.TestingT) {
+		status, body := get(t, "test.handler.a/hello")
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "root: /hello", body)
+	})
+
+	// The path is routed to the component with the longest matching ID.
+	status, body := get(t, "module.string.m/test.handler.a/hello/")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "module: /hello/", body)
+
+	for _, path := range []string{"test.unknown/hello", "test.no_handler/hello", "module.string.m/test.no_handler"} {
+		status, _ := get(t, path)
+		require.Equal(t, http.StatusNotFound, status, path)
+	}
+
+	// The handler of an unloaded component can't be reached anymore.
+	host.remove(component.ParseID("test.handler.a"))
+	status, _ = get(t, "test.handler.a/hello")
+	require.Equal(t, http.StatusNotFound, status)
+	status, body = get(t, "module.string.m/test.handler.a/hello")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "module: /hello", body)
+}
+
+// componentHost is a service.Host holding a set of components.
+type componentHost struct {
+	fakeHost
+
+	mut        sync.Mutex
+	components map[component.ID]component.Component
+}
+
+func (h *componentHost) GetComponent(id component.ID, _ component.InfoOptions) (*component.Info, error) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	c, ok := h.components[id]
+	if !ok {
+		return nil, component.ErrComponentNotFound
+	}
+	return &component.Info{ID: id, Component: c}, nil
+}
+
+func (h *componentHost) remove(id component.ID) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	delete(h.components, id)
+}
+
+// handlerComponent is a component whose handler writes its name and the path
+// of the request. Its handler is nil when it has no name.
+type handlerComponent struct {
+	name string
+}
+
+var _ Component = (*handlerComponent)(nil)
+
+func (c *handlerComponent) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (c *handlerComponent) Update(_ component.Arguments) error { return nil }
+
+func (c *handlerComponent) Handler() http.Handler {
+	if c.name == "" {
+		return nil
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s: %s", c.name, r.URL.Path)
+	})
+}
+
 type testEnvironment struct {
 	svc  *Service
 	addr string
+	host service.Host
+
+	reloadMut sync.Mutex
+	reloadErr error                           // Returned by the reload function of svc.
+	stable    func(ctx context.Context) error // Called by the stable function of svc when non-nil.
 }
 
 func newTestEnvironment(t *testing.T) (*testEnvironment, error) {
@@ -166,23 +383,36 @@ func newTestEnvironment(t *testing.T) (*testEnvironment, error) {
 		return nil, err
 	}
 
-	svc := New(Options{
+	env := &testEnvironment{
+		addr: fmt.Sprintf("127.0.0.1:%d", port),
+		host: fakeHost{},
+	}
+	env.svc = New(Options{
 		Logger:   util.TestLogger(t),
 		Tracer:   noop.NewTracerProvider(),
 		Gatherer: prometheus.NewRegistry(),
 
-		ReadyFunc:  func() bool { return true },
-		ReloadFunc: func() (*flow.Source, error) { return nil, nil },
+		ReadyFunc: func() error { return nil },
+		ReloadFunc: func() (*flow.Source, error) {
+			env.reloadMut.Lock()
+			defer env.reloadMut.Unlock()
+			return nil, env.reloadErr
+		},
+		StableFunc: func(ctx context.Context) error {
+			env.reloadMut.Lock()
+			stable := env.stable
+			env.reloadMut.Unlock()
+			if stable == nil {
+				return nil
+			}
+			return stable(ctx)
+		},
 
 		HTTPListenAddr:   fmt.Sprintf("127.0.0.1:%d", port),
 		MemoryListenAddr: "agent.internal:12345",
 		EnablePProf:      true,
 	})
-
-	return &testEnvironment{
-		svc:  svc,
-		addr: fmt.Sprintf("127.0.0.1:%d", port),
-	}, nil
+	return env, nil
 }
 
 func (env *testEnvironment) ApplyConfig(config string) error {
@@ -193,8 +423,20 @@ func (env *testEnvironment) ApplyConfig(config string) error {
 	return env.svc.Update(args)
 }
 
+func (env *testEnvironment) SetReloadError(err error) {
+	env.reloadMut.Lock()
+	defer env.reloadMut.Unlock()
+	env.reloadErr = err
+}
+
+func (env *testEnvironment) SetStableFunc(f func(ctx context.Context) error) {
+	env.reloadMut.Lock()
+	defer env.reloadMut.Unlock()
+	env.stable = f
+}
+
 func (env *testEnvironment) Run(ctx context.Context) error {
-	return env.svc.Run(ctx, fakeHost{})
+	return env.svc.Run(ctx, env.host)
 }
 
 func (env *testEnvironment) ListenAddr() string { return env.addr }
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/grafana/river/diag"
+)
+
+// reloadErrorResponse is the response of the /-/reload endpoint when the
+// config is rejected because of diagnostics.
+type reloadErrorResponse struct {
+	Error       string             `json:"error"`
+	Diagnostics []reloadDiagnostic `json:"diagnostics"`
+}
+
+type reloadDiagnostic struct {
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Value    string `json:"value,omitempty"`
+	StartPos string `json:"start_pos,omitempty"`
+	EndPos   string `json:"end_pos,omitempty"`
+}
+
+// writeReloadError writes the error of a failed reload. Diagnostics are
+// written as JSON so that callers can tell which blocks are invalid, other
+// errors are written as text.
+func writeReloadError(w http.ResponseWriter, err error) {
+	var diags diag.Diagnostics
+	if !errors.As(err, &diags) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := reloadErrorResponse{
+		Error:       err.Error(),
+		Diagnostics: make([]reloadDiagnostic, 0, len(diags)),
+	}
+	for _, d := range diags {
+		severity := "error"
+		if d.Severity == diag.SeverityLevelWarn {
+			severity = "warning"
+		}
+		rd := reloadDiagnostic{
+			Severity: severity,
+			Message:  d.Message,
+			Value:    d.Value,
+		}
+		if d.StartPos.Line > 0 {
+			rd.StartPos = d.StartPos.String()
+		}
+		if d.EndPos.Line > 0 {
+			rd.EndPos = d.EndPos.String()
+		}
+		resp.Diagnostics = append(resp.Diagnostics, rd)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -16,7 +16,8 @@ import (
 // will be prometheus.exporter.unix and /metrics.
 //
 // The "remain" portion is optional; it's valid to give a path just containing
-// a component name.
+// a component name. component.ErrComponentNotFound is returned if no
+// component matches the path.
 func splitURLPath(host service.Host, path string) (id component.ID, remain string, err error) {
 	if len(path) == 0 {
 		return component.ID{}, "", fmt.Errorf("invalid path")
@@ -49,7 +50,7 @@ func splitURLPath(host service.Host, path string) (id component.ID, remain strin
 		return componentID, preparePath(path, trimmedLeadingSlash, trimmedTailingSlash), nil
 	}
 
-	return component.ID{}, "", fmt.Errorf("invalid path")
+	return component.ID{}, "", component.ErrComponentNotFound
 }
 
 func preparePath(path string, addLeadingSlash, addTrailingSlash bool) string {
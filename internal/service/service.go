@@ -9,6 +9,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"reflect"
 
 	"github.com/grafana/agent/internal/component"
 )
@@ -134,3 +135,35 @@ type Service interface {
 	// Data may be invoked before Run.
 	Data() any
 }
+
+// ExportTransform transforms the exported values of type Type before they
+// are exposed to other components, such as to only expose the share of a
+// list of targets owned by the local cluster peer.
+type ExportTransform struct {
+	// Type is the type of the exported values to transform. Exports of type
+	// Type and fields of type Type of exported structs are transformed.
+	Type reflect.Type
+
+	// Transform returns the transformed value of v, which is of type Type.
+	// Transform must return a value of type Type and must not modify v. If
+	// it returns a value of another type, v is exposed untransformed.
+	//
+	// Transformed values can be transformed again, such as when they are
+	// passed to a module, so transforming a value twice must be the same as
+	// transforming it once.
+	Transform func(v any) any
+}
+
+// ExportTransformer is implemented by services which transform the exports
+// of components. ExportTransforms is called once per Flow controller, so the
+// returned transforms must use the current state of the service.
+type ExportTransformer interface {
+	// ExportTransforms returns the transforms to apply to component exports.
+	ExportTransforms() []ExportTransform
+
+	// WatchExportTransforms registers onChange to be called when the result
+	// of the transforms changes, so that the components referencing
+	// transformed exports are evaluated again. The returned function
+	// unregisters onChange.
+	WatchExportTransforms(onChange func()) (unregister func())
+}
@@ -205,6 +205,13 @@ func (c *Config) Validate(fs *flag.FlagSet) error {
 		return err
 	}
 
+	// The spanmetrics handler endpoints of the traces configs must not use
+	// the ports of the agent servers.
+	c.Traces.ListenAddresses = map[string]string{
+		"HTTP server": c.ServerFlags.HTTP.ListenAddress,
+		"gRPC server": c.ServerFlags.GRPC.ListenAddress,
+	}
+
 	// since the Traces config might rely on an existing Loki config
 	// this check is made here to look for cross config issues before we attempt to load
 	if err := c.Traces.Validate(c.Logs); err != nil {
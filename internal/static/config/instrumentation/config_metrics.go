@@ -15,6 +15,7 @@ type configMetrics struct {
 	configLoadSuccess        prometheus.Gauge
 	configLoadSuccessSeconds prometheus.Gauge
 	configLoadFailures       prometheus.Counter
+	configLastKnownGood      prometheus.Gauge
 }
 
 var confMetrics *configMetrics
@@ -46,6 +47,10 @@ func newConfigMetrics() *configMetrics {
 		Name: "agent_config_load_failures_total",
 		Help: "Configuration load failures.",
 	})
+	m.configLastKnownGood = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "agent_config_last_known_good_active",
+		Help: "Whether the active config is the last known good config, because the configured one couldn't be loaded.",
+	})
 	return &m
 }
 
@@ -73,3 +78,14 @@ func InstrumentLoad(success bool) {
 		confMetrics.configLoadFailures.Inc()
 	}
 }
+
+// InstrumentLastKnownGood exposes whether the active config is the last known
+// good config.
+func InstrumentLastKnownGood(active bool) {
+	configMetricsInitializer.Do(initializeConfigMetrics)
+	if active {
+		confMetrics.configLastKnownGood.Set(1)
+	} else {
+		confMetrics.configLastKnownGood.Set(0)
+	}
+}
@@ -29,6 +29,8 @@ type Bundle struct {
 	agentMetricsTargets   []byte
 	agentLogsInstances    []byte
 	agentLogsTargets      []byte
+	agentTracesConfig     []byte
+	agentTracesTopology   []byte
 	heapBuf               *bytes.Buffer
 	goroutineBuf          *bytes.Buffer
 	blockBuf              *bytes.Buffer
@@ -128,6 +130,24 @@ func Export(ctx context.Context, enabledFeatures []string, cfg []byte, srvAddres
 		return nil, fmt.Errorf("failed to read Agent logs targets: %s", err)
 	}
 
+	// Collect the effective config of the Agent's traces instances.
+	resp, err = httpClient.Get("http://" + srvAddress + "/agent/api/v1/traces/config")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Agent traces config: %s", err)
+	}
+	agentTracesConfig, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Agent traces config: %s", err)
+	}
+	resp, err = httpClient.Get("http://" + srvAddress + "/agent/api/v1/traces/topology")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Agent traces topology: %s", err)
+	}
+	agentTracesTopology, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Agent traces topology: %s", err)
+	}
+
 	// Export pprof data.
 	var (
 		cpuBuf       bytes.Buffer
@@ -173,6 +193,8 @@ func Export(ctx context.Context, enabledFeatures []string, cfg []byte, srvAddres
 		agentMetricsTargets:   agentMetricsTargets,
 		agentLogsInstances:    agentLogsInstances,
 		agentLogsTargets:      agentLogsTargets,
+		agentTracesConfig:     agentTracesConfig,
+		agentTracesTopology:   agentTracesTopology,
 		heapBuf:               &heapBuf,
 		goroutineBuf:          &goroutineBuf,
 		blockBuf:              &blockBuf,
@@ -198,6 +220,8 @@ func Serve(rw http.ResponseWriter, b *Bundle, logsBuf *bytes.Buffer) error {
 		"agent-metrics-targets.json":   b.agentMetricsTargets,
 		"agent-logs-instances.json":    b.agentLogsInstances,
 		"agent-logs-targets.json":      b.agentLogsTargets,
+		"agent-traces-config.yaml":     b.agentTracesConfig,
+		"agent-traces-topology.json":   b.agentTracesTopology,
 		"agent-logs.txt":               logsBuf.Bytes(),
 		"pprof/cpu.pprof":              b.cpuBuf.Bytes(),
 		"pprof/heap.pprof":             b.heapBuf.Bytes(),
@@ -49,12 +49,13 @@ type automaticLoggingProcessor struct {
 	logsInstance *logs.Instance
 	done         atomic.Bool
 
-	labels map[string]struct{}
+	labels      map[string]struct{}
+	rateLimiter *lineRateLimiter
 
 	logger log.Logger
 }
 
-func newTraceProcessor(nextConsumer consumer.Traces, cfg *AutomaticLoggingConfig) (processor.Traces, error) {
+func newTraceProcessor(nextConsumer consumer.Traces, cfg *AutomaticLoggingConfig, set processor.CreateSettings) (processor.Traces, error) {
 	logger := log.With(util.Logger, "component", "traces automatic logging")
 
 	if nextConsumer == nil {
@@ -77,6 +78,14 @@ func newTraceProcessor(nextConsumer consumer.Traces, cfg *AutomaticLoggingConfig
 		return nil, fmt.Errorf("automaticLoggingProcessor requires a backend of type '%s' or '%s'", BackendLogs, BackendStdout)
 	}
 
+	if err := cfg.RateLimit.validate(); err != nil {
+		return nil, fmt.Errorf("automaticLoggingProcessor: %w", err)
+	}
+	rateLimiter, err := newLineRateLimiter(cfg.RateLimit, set.MeterProvider, set.ID.String())
+	if err != nil {
+		return nil, err
+	}
+
 	logToStdout := false
 	if cfg.Backend == BackendStdout {
 		logToStdout = true
@@ -101,6 +110,7 @@ func newTraceProcessor(nextConsumer consumer.Traces, cfg *AutomaticLoggingConfig
 		logger:       logger,
 		done:         atomic.Bool{},
 		labels:       labels,
+		rateLimiter:  rateLimiter,
 	}, nil
 }
 
@@ -125,18 +135,21 @@ func (p *automaticLoggingProcessor) ConsumeTraces(ctx context.Context, td ptrace
 				span := ss.Spans().At(k)
 				traceID := span.TraceID().String()
 
-				if p.cfg.Spans {
+				if p.cfg.Spans && p.rateLimiter.allow(ctx, typeSpan) {
 					keyValues := append(p.spanKeyVals(span), p.processKeyVals(rs.Resource(), svc)...)
 					p.exportToLogsInstance(typeSpan, traceID, p.spanLabels(keyValues), keyValues...)
 				}
 
-				if p.cfg.Roots && span.ParentSpanID().IsEmpty() {
+				if p.cfg.Roots && span.ParentSpanID().IsEmpty() && p.rateLimiter.allow(ctx, typeRoot) {
 					keyValues := append(p.spanKeyVals(span), p.processKeyVals(rs.Resource(), svc)...)
 					p.exportToLogsInstance(typeRoot, traceID, p.spanLabels(keyValues), keyValues...)
 				}
 
 				if p.cfg.Processes && lastTraceID != traceID {
 					lastTraceID = traceID
+					if !p.rateLimiter.allow(ctx, typeProcess) {
+						continue
+					}
 					keyValues := p.processKeyVals(rs.Resource(), svc)
 					p.exportToLogsInstance(typeProcess, traceID, p.spanLabels(keyValues), keyValues...)
 				}
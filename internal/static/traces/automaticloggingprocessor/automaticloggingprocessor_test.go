@@ -2,17 +2,26 @@ package automaticloggingprocessor
 
 import (
 	"context"
+	"encoding/binary"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/grafana/agent/internal/static/logs"
+	"github.com/grafana/agent/internal/static/traces/traceutils"
 	"github.com/grafana/agent/internal/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/processor/processortest"
+	semconv "go.opentelemetry.io/collector/semconv/v1.6.1"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"gopkg.in/yaml.v3"
 )
 
@@ -108,7 +117,7 @@ func TestSpanKeyVals(t *testing.T) {
 	for _, tc := range tests {
 		tc.cfg.Backend = BackendStdout
 		tc.cfg.Spans = true
-		p, err := newTraceProcessor(&automaticLoggingProcessor{}, &tc.cfg)
+		p, err := newTraceProcessor(&automaticLoggingProcessor{}, &tc.cfg, processortest.NewNopCreateSettings())
 		require.NoError(t, err)
 
 		span := ptrace.NewSpan()
@@ -160,7 +169,7 @@ func TestProcessKeyVals(t *testing.T) {
 	for _, tc := range tests {
 		tc.cfg.Backend = BackendStdout
 		tc.cfg.Spans = true
-		p, err := newTraceProcessor(&automaticLoggingProcessor{}, &tc.cfg)
+		p, err := newTraceProcessor(&automaticLoggingProcessor{}, &tc.cfg, processortest.NewNopCreateSettings())
 		require.NoError(t, err)
 
 		process := pcommon.NewResource()
@@ -199,10 +208,28 @@ func TestBadConfigs(t *testing.T) {
 				Backend: "stdout",
 			},
 		},
+		{
+			cfg: &AutomaticLoggingConfig{
+				Spans:     true,
+				RateLimit: RateLimitConfig{Spans: KindRateLimitConfig{LinesPerSecond: -1}},
+			},
+		},
+		{
+			cfg: &AutomaticLoggingConfig{
+				Spans:     true,
+				RateLimit: RateLimitConfig{Roots: KindRateLimitConfig{Burst: -1}},
+			},
+		},
+		{
+			cfg: &AutomaticLoggingConfig{
+				Spans:     true,
+				RateLimit: RateLimitConfig{Processes: KindRateLimitConfig{OverflowPolicy: "block"}},
+			},
+		},
 	}
 
 	for _, tc := range tests {
-		p, err := newTraceProcessor(&automaticLoggingProcessor{}, tc.cfg)
+		p, err := newTraceProcessor(&automaticLoggingProcessor{}, tc.cfg, processortest.NewNopCreateSettings())
 		require.Error(t, err)
 		require.Nil(t, p)
 	}
@@ -214,7 +241,7 @@ func TestLogToStdoutSet(t *testing.T) {
 		Spans:   true,
 	}
 
-	p, err := newTraceProcessor(&automaticLoggingProcessor{}, cfg)
+	p, err := newTraceProcessor(&automaticLoggingProcessor{}, cfg, processortest.NewNopCreateSettings())
 	require.NoError(t, err)
 	require.True(t, p.(*automaticLoggingProcessor).logToStdout)
 
@@ -226,7 +253,7 @@ func TestLogToStdoutSet(t *testing.T) {
 		Spans:   true,
 	}
 
-	p, err = newTraceProcessor(&automaticLoggingProcessor{}, cfg)
+	p, err = newTraceProcessor(&automaticLoggingProcessor{}, cfg, processortest.NewNopCreateSettings())
 	require.NoError(t, err)
 	require.False(t, p.(*automaticLoggingProcessor).logToStdout)
 }
@@ -236,7 +263,7 @@ func TestDefaults(t *testing.T) {
 		Spans: true,
 	}
 
-	p, err := newTraceProcessor(&automaticLoggingProcessor{}, cfg)
+	p, err := newTraceProcessor(&automaticLoggingProcessor{}, cfg, processortest.NewNopCreateSettings())
 	require.NoError(t, err)
 	require.Equal(t, BackendStdout, p.(*automaticLoggingProcessor).cfg.Backend)
 	require.Equal(t, defaultTimeout, p.(*automaticLoggingProcessor).cfg.Timeout)
@@ -346,7 +373,7 @@ func TestLabels(t *testing.T) {
 				Spans:  true,
 				Labels: tc.labels,
 			}
-			p, err := newTraceProcessor(&automaticLoggingProcessor{}, cfg)
+			p, err := newTraceProcessor(&automaticLoggingProcessor{}, cfg, processortest.NewNopCreateSettings())
 			require.NoError(t, err)
 
 			ls := p.(*automaticLoggingProcessor).spanLabels(tc.keyValues)
@@ -354,3 +381,99 @@ func TestLabels(t *testing.T) {
 		})
 	}
 }
+
+func TestRateLimit(t *testing.T) {
+	const spans = 10
+
+	tests := []struct {
+		name      string
+		cfg       AutomaticLoggingConfig
+		rateLimit RateLimitConfig
+		expected  string
+	}{
+		{
+			name: "spans",
+			cfg:  AutomaticLoggingConfig{Spans: true},
+			rateLimit: RateLimitConfig{
+				Spans: KindRateLimitConfig{LinesPerSecond: 0.001, Burst: 2},
+			},
+			expected: `
+				# HELP traces_automatic_logging_dropped_lines_total Total count of automatic logging lines dropped by the rate limit
+				# TYPE traces_automatic_logging_dropped_lines_total counter
+				traces_automatic_logging_dropped_lines_total{kind="span"} 8
+			`,
+		},
+		{
+			name: "roots",
+			cfg:  AutomaticLoggingConfig{Roots: true},
+			rateLimit: RateLimitConfig{
+				Roots: KindRateLimitConfig{LinesPerSecond: 0.001, Burst: 3, OverflowPolicy: OverflowPolicyDrop},
+			},
+			expected: `
+				# HELP traces_automatic_logging_dropped_lines_total Total count of automatic logging lines dropped by the rate limit
+				# TYPE traces_automatic_logging_dropped_lines_total counter
+				traces_automatic_logging_dropped_lines_total{kind="root"} 7
+			`,
+		},
+		{
+			name: "processes",
+			cfg:  AutomaticLoggingConfig{Processes: true},
+			rateLimit: RateLimitConfig{
+				Processes: KindRateLimitConfig{LinesPerSecond: 0.001, Burst: 4},
+			},
+			expected: `
+				# HELP traces_automatic_logging_dropped_lines_total Total count of automatic logging lines dropped by the rate limit
+				# TYPE traces_automatic_logging_dropped_lines_total counter
+				traces_automatic_logging_dropped_lines_total{kind="process"} 6
+			`,
+		},
+		{
+			name: "limits are separate for each kind",
+			cfg:  AutomaticLoggingConfig{Spans: true, Roots: true, Processes: true},
+			rateLimit: RateLimitConfig{
+				Spans: KindRateLimitConfig{LinesPerSecond: 0.001, Burst: 1},
+				Roots: KindRateLimitConfig{LinesPerSecond: 0.001, Burst: 5},
+			},
+			expected: `
+				# HELP traces_automatic_logging_dropped_lines_total Total count of automatic logging lines dropped by the rate limit
+				# TYPE traces_automatic_logging_dropped_lines_total counter
+				traces_automatic_logging_dropped_lines_total{kind="root"} 5
+				traces_automatic_logging_dropped_lines_total{kind="span"} 9
+			`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			promExporter, err := traceutils.PrometheusExporter(reg)
+			require.NoError(t, err)
+
+			set := processortest.NewNopCreateSettings()
+			set.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(promExporter))
+
+			cfg := tc.cfg
+			cfg.RateLimit = tc.rateLimit
+			p, err := newTraceProcessor(consumertest.NewNop(), &cfg, set)
+			require.NoError(t, err)
+
+			// Each span is the root of its own trace, so that it produces a
+			// log line of every kind.
+			traces := ptrace.NewTraces()
+			rs := traces.ResourceSpans().AppendEmpty()
+			rs.Resource().Attributes().PutStr(semconv.AttributeServiceName, "svc")
+			ss := rs.ScopeSpans().AppendEmpty()
+			for i := 0; i < spans; i++ {
+				var traceID pcommon.TraceID
+				binary.BigEndian.PutUint64(traceID[8:], uint64(i+1))
+
+				span := ss.Spans().AppendEmpty()
+				span.SetName("test")
+				span.SetTraceID(traceID)
+			}
+
+			require.NoError(t, p.ConsumeTraces(context.Background(), traces))
+			require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(tc.expected)))
+		})
+	}
+}
@@ -32,6 +32,9 @@ type AutomaticLoggingConfig struct {
 	Timeout           time.Duration  `mapstructure:"timeout" yaml:"timeout,omitempty"`
 	Labels            []string       `mapstructure:"labels" yaml:"labels,omitempty"`
 
+	// RateLimit limits how many log lines of each kind are emitted.
+	RateLimit RateLimitConfig `mapstructure:"rate_limit" yaml:"rate_limit,omitempty"`
+
 	// Deprecated fields:
 	LokiName string `mapstructure:"loki_name" yaml:"loki_name,omitempty"` // Superseded by LogsName
 }
@@ -64,6 +67,10 @@ func (c *AutomaticLoggingConfig) Validate(logsConfig *logs.Config) error {
 		c.Overrides.LogsTag, c.Overrides.LokiTag = c.Overrides.LokiTag, ""
 	}
 
+	if err := c.RateLimit.validate(); err != nil {
+		return err
+	}
+
 	// Ensure the logging instance exists when using it as a backend.
 	if c.Backend == BackendLogs {
 		var found bool
@@ -124,5 +131,5 @@ func createTraceProcessor(
 ) (processor.Traces, error) {
 
 	oCfg := cfg.(*Config)
-	return newTraceProcessor(nextConsumer, oCfg.LoggingConfig)
+	return newTraceProcessor(nextConsumer, oCfg.LoggingConfig, cp)
 }
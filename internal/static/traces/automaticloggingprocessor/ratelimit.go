@@ -0,0 +1,106 @@
+package automaticloggingprocessor
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// OverflowPolicyDrop drops the log lines exceeding the rate limit and
+	// counts them in the traces_automatic_logging_dropped_lines_total metric.
+	OverflowPolicyDrop = "drop"
+
+	droppedLinesName = "automatic_logging_dropped_lines"
+)
+
+// RateLimitConfig holds the rate limits of each kind of log line.
+type RateLimitConfig struct {
+	Spans     KindRateLimitConfig `mapstructure:"spans" yaml:"spans,omitempty"`
+	Roots     KindRateLimitConfig `mapstructure:"roots" yaml:"roots,omitempty"`
+	Processes KindRateLimitConfig `mapstructure:"processes" yaml:"processes,omitempty"`
+}
+
+// KindRateLimitConfig limits how many log lines of a kind are emitted per
+// second. A LinesPerSecond of 0 disables the limit.
+type KindRateLimitConfig struct {
+	LinesPerSecond float64 `mapstructure:"lines_per_second" yaml:"lines_per_second,omitempty"`
+	Burst          int     `mapstructure:"burst" yaml:"burst,omitempty"`
+	OverflowPolicy string  `mapstructure:"overflow_policy" yaml:"overflow_policy,omitempty"`
+}
+
+func (c *RateLimitConfig) validate() error {
+	for kind, kc := range c.byKind() {
+		if err := kc.validate(); err != nil {
+			return fmt.Errorf("rate_limit for %s: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+func (c *RateLimitConfig) byKind() map[string]KindRateLimitConfig {
+	return map[string]KindRateLimitConfig{
+		typeSpan:    c.Spans,
+		typeRoot:    c.Roots,
+		typeProcess: c.Processes,
+	}
+}
+
+func (c KindRateLimitConfig) validate() error {
+	if c.LinesPerSecond < 0 {
+		return fmt.Errorf("lines_per_second must not be negative")
+	}
+	if c.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	if c.OverflowPolicy != "" && c.OverflowPolicy != OverflowPolicyDrop {
+		return fmt.Errorf("unsupported overflow_policy %q, only %q is supported", c.OverflowPolicy, OverflowPolicyDrop)
+	}
+	return nil
+}
+
+// lineRateLimiter drops log lines exceeding the rate limit of their kind.
+type lineRateLimiter struct {
+	limiters     map[string]*rate.Limiter
+	droppedLines metric.Int64Counter
+}
+
+func newLineRateLimiter(cfg RateLimitConfig, mp metric.MeterProvider, meterID string) (*lineRateLimiter, error) {
+	droppedLines, err := mp.Meter(meterID).Int64Counter(
+		droppedLinesName,
+		metric.WithDescription("Total count of automatic logging lines dropped by the rate limit"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register automatic logging metrics: %w", err)
+	}
+
+	l := &lineRateLimiter{
+		limiters:     make(map[string]*rate.Limiter),
+		droppedLines: droppedLines,
+	}
+	for kind, kc := range cfg.byKind() {
+		if kc.LinesPerSecond == 0 {
+			continue
+		}
+		burst := kc.Burst
+		if burst == 0 {
+			burst = int(math.Max(math.Ceil(kc.LinesPerSecond), 1))
+		}
+		l.limiters[kind] = rate.NewLimiter(rate.Limit(kc.LinesPerSecond), burst)
+	}
+	return l, nil
+}
+
+// allow reports whether a log line of the given kind can be emitted now.
+func (l *lineRateLimiter) allow(ctx context.Context, kind string) bool {
+	limiter, ok := l.limiters[kind]
+	if !ok || limiter.Allow() {
+		return true
+	}
+	l.droppedLines.Add(ctx, 1, metric.WithAttributes(attribute.String("kind", kind)))
+	return false
+}
@@ -0,0 +1,297 @@
+// Package backpressure rejects the spans pushed to trace receivers while the
+// sending queue of an exporter is saturated, so that clients back off and
+// retry them later instead of the exporter silently dropping spans.
+//
+// The saturation of the queues is sampled from the exporter_queue_size and
+// exporter_queue_capacity metrics which exporters report, and applied by
+// wrapping the consumer receivers push spans to.
+package backpressure
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/receiver"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultThreshold is the fraction of the capacity of a sending queue
+	// above which it's saturated when none is configured.
+	DefaultThreshold = 0.9
+	// DefaultSampleInterval is the interval between samples of the queue
+	// metrics when none is configured.
+	DefaultSampleInterval = time.Second
+
+	// Names of the queue metrics of exporters, once exported to Prometheus
+	// by traceutils.PrometheusExporter.
+	queueSizeName     = "traces_exporter_queue_size"
+	queueCapacityName = "traces_exporter_queue_capacity"
+
+	meterName         = "backpressure"
+	rejectedName      = "backpressure_rejected_batches"
+	receiverAttribute = "receiver"
+	exporterAttribute = "exporter"
+)
+
+// Config configures the back-pressure applied to receivers.
+type Config struct {
+	// Enabled rejects spans while the sending queue of an exporter is
+	// saturated.
+	Enabled bool `yaml:"enabled"`
+	// Threshold is the fraction of the capacity of a sending queue above
+	// which it's saturated, between 0 and 1. Zero means DefaultThreshold.
+	Threshold float64 `yaml:"threshold,omitempty"`
+	// SampleInterval is the interval between samples of the queue metrics.
+	// Zero means DefaultSampleInterval.
+	SampleInterval time.Duration `yaml:"sample_interval,omitempty"`
+}
+
+// Validate returns an error if the config is invalid.
+func (c *Config) Validate() error {
+	if c.Threshold < 0 || c.Threshold > 1 {
+		return fmt.Errorf("backpressure: threshold must be between 0 and 1, got %v", c.Threshold)
+	}
+	if c.SampleInterval < 0 {
+		return fmt.Errorf("backpressure: sample_interval must not be negative")
+	}
+	return nil
+}
+
+func (c *Config) threshold() float64 {
+	if c.Threshold == 0 {
+		return DefaultThreshold
+	}
+	return c.Threshold
+}
+
+func (c *Config) sampleInterval() time.Duration {
+	if c.SampleInterval == 0 {
+		return DefaultSampleInterval
+	}
+	return c.SampleInterval
+}
+
+// Monitor samples the sending queues of the exporters of a pipeline.
+type Monitor struct {
+	cfg      Config
+	logger   *zap.Logger
+	gatherer *prometheus.Registry
+
+	mut sync.RWMutex
+	// saturated is the ID of the saturated exporter, or empty if no queue is
+	// saturated.
+	saturated string
+}
+
+// NewMonitor creates a Monitor. The metrics of the pipeline must be
+// registered with the Registerer of the Monitor.
+func NewMonitor(cfg Config, logger *zap.Logger) *Monitor {
+	return &Monitor{
+		cfg:      cfg,
+		logger:   logger,
+		gatherer: prometheus.NewRegistry(),
+	}
+}
+
+// Registerer returns a Registerer which registers collectors with both reg
+// and the Monitor, so that the Monitor can sample the queue metrics the
+// collectors report. reg may be nil.
+func (m *Monitor) Registerer(reg prometheus.Registerer) prometheus.Registerer {
+	return &teeRegisterer{reg: reg, monitor: m.gatherer}
+}
+
+// Run samples the queue metrics until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.sampleInterval())
+	defer ticker.Stop()
+
+	for {
+		m.sample()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample updates the saturated exporter from the current queue metrics.
+func (m *Monitor) sample() {
+	mfs, err := m.gatherer.Gather()
+	if err != nil {
+		m.logger.Debug("failed to gather exporter queue metrics", zap.Error(err))
+	}
+
+	sizes := make(map[string]float64)
+	capacities := make(map[string]float64)
+	for _, mf := range mfs {
+		var values map[string]float64
+		switch mf.GetName() {
+		case queueSizeName:
+			values = sizes
+		case queueCapacityName:
+			values = capacities
+		default:
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			for _, l := range metric.GetLabel() {
+				if l.GetName() == exporterAttribute {
+					values[l.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+
+	exporters := make([]string, 0, len(capacities))
+	for exporter := range capacities {
+		exporters = append(exporters, exporter)
+	}
+	sort.Strings(exporters)
+
+	var saturated string
+	for _, exporter := range exporters {
+		if capacity := capacities[exporter]; capacity > 0 && sizes[exporter] >= m.cfg.threshold()*capacity {
+			saturated = exporter
+			break
+		}
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	switch {
+	case saturated != "" && m.saturated == "":
+		m.logger.Warn("sending queue of exporter is saturated, rejecting spans until it drains", zap.String("exporter", saturated))
+	case saturated == "" && m.saturated != "":
+		m.logger.Info("sending queues of exporters drained, accepting spans again")
+	}
+	m.saturated = saturated
+}
+
+// saturatedExporter returns the ID of the exporter whose queue is saturated,
+// or empty if no queue is saturated.
+func (m *Monitor) saturatedExporter() string {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	return m.saturated
+}
+
+// Consumer wraps next, the consumer the receiver created with set pushes
+// spans to, so that it rejects spans while a sending queue is saturated.
+func (m *Monitor) Consumer(set receiver.CreateSettings, next consumer.Traces) (consumer.Traces, error) {
+	rejected, err := set.MeterProvider.Meter(meterName).Int64Counter(
+		rejectedName,
+		metric.WithDescription("Total count of batches of spans rejected by receivers because the sending queue of an exporter was saturated"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register backpressure metrics: %w", err)
+	}
+
+	return &backpressureConsumer{
+		next:     next,
+		receiver: set.ID.String(),
+		monitor:  m,
+		rejected: rejected,
+	}, nil
+}
+
+type backpressureConsumer struct {
+	next     consumer.Traces
+	receiver string
+	monitor  *Monitor
+	rejected metric.Int64Counter
+}
+
+var _ consumer.Traces = (*backpressureConsumer)(nil)
+
+// Capabilities implements consumer.Traces.
+func (c *backpressureConsumer) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+// ConsumeTraces implements consumer.Traces.
+func (c *backpressureConsumer) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	exporter := c.monitor.saturatedExporter()
+	if exporter == "" {
+		return c.next.ConsumeTraces(ctx, td)
+	}
+
+	c.rejected.Add(ctx, 1, metric.WithAttributes(
+		attribute.String(receiverAttribute, c.receiver),
+		attribute.String(exporterAttribute, exporter),
+	))
+	return status.Errorf(codes.ResourceExhausted, "sending queue of exporter %s is saturated, %d spans rejected", exporter, td.SpanCount())
+}
+
+// NewFactory wraps f so that the trace receivers it creates reject spans
+// while a sending queue sampled by m is saturated.
+func NewFactory(f receiver.Factory, m *Monitor) receiver.Factory {
+	return &factory{Factory: f, monitor: m}
+}
+
+type factory struct {
+	receiver.Factory
+	monitor *Monitor
+}
+
+// CreateTracesReceiver implements receiver.Factory.
+func (f *factory) CreateTracesReceiver(ctx context.Context, set receiver.CreateSettings, cfg component.Config, next consumer.Traces) (receiver.Traces, error) {
+	c, err := f.monitor.Consumer(set, next)
+	if err != nil {
+		return nil, err
+	}
+	return f.Factory.CreateTracesReceiver(ctx, set, cfg, c)
+}
+
+// teeRegisterer registers collectors with both a Registerer and the registry
+// sampled by a Monitor.
+type teeRegisterer struct {
+	reg     prometheus.Registerer
+	monitor prometheus.Registerer
+}
+
+// Register implements prometheus.Registerer.
+func (r *teeRegisterer) Register(c prometheus.Collector) error {
+	if r.reg != nil {
+		if err := r.reg.Register(c); err != nil {
+			return err
+		}
+	}
+	if err := r.monitor.Register(c); err != nil {
+		if r.reg != nil {
+			r.reg.Unregister(c)
+		}
+		return err
+	}
+	return nil
+}
+
+// MustRegister implements prometheus.Registerer.
+func (r *teeRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister implements prometheus.Registerer.
+func (r *teeRegisterer) Unregister(c prometheus.Collector) bool {
+	if r.reg != nil {
+		r.reg.Unregister(c)
+	}
+	return r.monitor.Unregister(c)
+}
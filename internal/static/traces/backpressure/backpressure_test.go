@@ -0,0 +1,199 @@
+package backpressure
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grafana/agent/internal/static/traces/traceutils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/receiver"
+	"go.opentelemetry.io/collector/receiver/receivertest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeQueue reports the queue metrics of an exporter like the sending queue
+// of the exporter helper does.
+type fakeQueue struct {
+	size     atomic.Int64
+	capacity int64
+}
+
+func newFakeQueue(t *testing.T, meterProvider metric.MeterProvider, exporter string, capacity int64) *fakeQueue {
+	t.Helper()
+
+	q := &fakeQueue{capacity: capacity}
+	attrs := metric.WithAttributes(attribute.String("exporter", exporter))
+	meter := meterProvider.Meter("exporterhelper")
+	_, err := meter.Int64ObservableGauge("exporter_queue_size", metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+		o.Observe(q.size.Load(), attrs)
+		return nil
+	}))
+	require.NoError(t, err)
+	_, err = meter.Int64ObservableGauge("exporter_queue_capacity", metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+		o.Observe(q.capacity, attrs)
+		return nil
+	}))
+	require.NoError(t, err)
+	return q
+}
+
+func TestMonitor_SaturatedQueue(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMonitor(Config{Enabled: true, Threshold: 0.8}, zap.NewNop())
+	set := newCreateSettings(t, m.Registerer(reg), "otlp")
+	queue := newFakeQueue(t, set.MeterProvider, "otlp/0", 100)
+	newFakeQueue(t, set.MeterProvider, "otlphttp/1", 100)
+
+	sink := new(consumertest.TracesSink)
+	c, err := m.Consumer(set, sink)
+	require.NoError(t, err)
+
+	// The queue is below the threshold.
+	queue.size.Store(79)
+	m.sample()
+	require.NoError(t, c.ConsumeTraces(context.Background(), newTraces(5)))
+
+	// The queue is saturated, spans are rejected until it drains.
+	queue.size.Store(80)
+	m.sample()
+	for i := 0; i < 2; i++ {
+		err := c.ConsumeTraces(context.Background(), newTraces(5))
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.ErrorContains(t, err, "otlp/0")
+	}
+
+	queue.size.Store(10)
+	m.sample()
+	require.NoError(t, c.ConsumeTraces(context.Background(), newTraces(5)))
+	require.Equal(t, 10, sink.SpanCount())
+
+	expected := `
+		# HELP traces_backpressure_rejected_batches_total Total count of batches of spans rejected by receivers because the sending queue of an exporter was saturated
+		# TYPE traces_backpressure_rejected_batches_total counter
+		traces_backpressure_rejected_batches_total{exporter="otlp/0",receiver="otlp"} 2
+	`
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "traces_backpressure_rejected_batches_total"))
+}
+
+func TestMonitor_DefaultThreshold(t *testing.T) {
+	m := NewMonitor(Config{Enabled: true}, zap.NewNop())
+	set := newCreateSettings(t, m.Registerer(nil), "otlp")
+	queue := newFakeQueue(t, set.MeterProvider, "otlp/0", 10)
+
+	queue.size.Store(8)
+	m.sample()
+	require.Empty(t, m.saturatedExporter())
+
+	queue.size.Store(9)
+	m.sample()
+	require.Equal(t, "otlp/0", m.saturatedExporter())
+}
+
+func TestMonitor_DisabledQueue(t *testing.T) {
+	// Exporters without a sending queue report no capacity, and are never
+	// saturated.
+	m := NewMonitor(Config{Enabled: true}, zap.NewNop())
+	set := newCreateSettings(t, m.Registerer(nil), "otlp")
+	newFakeQueue(t, set.MeterProvider, "otlp/0", 0)
+
+	m.sample()
+	require.Empty(t, m.saturatedExporter())
+}
+
+func TestNewFactory(t *testing.T) {
+	var next consumer.Traces
+	f := receiver.NewFactory("fake", func() component.Config { return &struct{}{} },
+		receiver.WithTraces(func(_ context.Context, _ receiver.CreateSettings, _ component.Config, c consumer.Traces) (receiver.Traces, error) {
+			next = c
+			return struct {
+				component.StartFunc
+				component.ShutdownFunc
+			}{}, nil
+		}, component.StabilityLevelUndefined))
+
+	m := NewMonitor(Config{Enabled: true}, zap.NewNop())
+	set := newCreateSettings(t, m.Registerer(nil), "fake")
+	queue := newFakeQueue(t, set.MeterProvider, "otlp/0", 10)
+
+	sink := new(consumertest.TracesSink)
+	wrapped := NewFactory(f, m)
+	require.Equal(t, f.Type(), wrapped.Type())
+	_, err := wrapped.CreateTracesReceiver(context.Background(), set, wrapped.CreateDefaultConfig(), sink)
+	require.NoError(t, err)
+
+	// Spans pushed by the receiver are rejected while the queue is saturated.
+	queue.size.Store(10)
+	m.sample()
+	require.Equal(t, codes.ResourceExhausted, status.Code(next.ConsumeTraces(context.Background(), newTraces(1))))
+	require.Zero(t, sink.SpanCount())
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		expectErr string
+	}{
+		{
+			name: "valid",
+			cfg:  Config{Enabled: true, Threshold: 0.5},
+		},
+		{
+			name:      "threshold above 1",
+			cfg:       Config{Enabled: true, Threshold: 1.5},
+			expectErr: "threshold must be between 0 and 1",
+		},
+		{
+			name:      "negative sample interval",
+			cfg:       Config{Enabled: true, SampleInterval: -1},
+			expectErr: "sample_interval must not be negative",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.expectErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+}
+
+func newCreateSettings(t *testing.T, reg prometheus.Registerer, id string) receiver.CreateSettings {
+	t.Helper()
+
+	promExporter, err := traceutils.PrometheusExporter(reg)
+	require.NoError(t, err)
+
+	set := receivertest.NewNopCreateSettings()
+	set.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(promExporter))
+
+	typ, name, _ := strings.Cut(id, "/")
+	set.ID = component.NewIDWithName(component.Type(typ), name)
+	return set
+}
+
+func newTraces(spans int) ptrace.Traces {
+	traces := ptrace.NewTraces()
+	ss := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty()
+	for i := 0; i < spans; i++ {
+		ss.Spans().AppendEmpty().SetName("test")
+	}
+	return traces
+}
@@ -0,0 +1,73 @@
+package traces
+
+import (
+	"fmt"
+	"slices"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Supported values of InstanceConfig.CollectorLogs.
+const (
+	// collectorLogsAgent writes the logs of the collector with the agent
+	// logger.
+	collectorLogsAgent = "agent"
+	// collectorLogsCollector keeps the collector's own zap output on stderr.
+	collectorLogsCollector = "collector"
+)
+
+// Keys of the fields the collector adds to the loggers of its components.
+const (
+	collectorKindKey = "kind"
+	collectorNameKey = "name"
+
+	// componentIDKey is the key the component ID is reported with in the
+	// agent logs.
+	componentIDKey = "component_id"
+)
+
+func validateCollectorLogs(output string) error {
+	switch output {
+	case "", collectorLogsAgent, collectorLogsCollector:
+		return nil
+	default:
+		return fmt.Errorf("collector_logs: unknown value %q, must be %q or %q", output, collectorLogsAgent, collectorLogsCollector)
+	}
+}
+
+// collectorLoggingOptions returns the options of the logger of the collector
+// service of an instance logging with logger, depending on where its logs
+// should be written.
+func collectorLoggingOptions(output string, logger *zap.Logger) []zap.Option {
+	if output == collectorLogsCollector {
+		return nil
+	}
+	return []zap.Option{
+		zap.WrapCore(func(zapcore.Core) zapcore.Core {
+			return collectorLogCore{Core: logger.Core()}
+		}),
+	}
+}
+
+// collectorLogCore bridges the logs of the collector service to the agent
+// logger, which maps their levels and adds the name of the traces instance.
+// The ID of the component logging is reported as component_id.
+type collectorLogCore struct {
+	zapcore.Core
+}
+
+// With implements zapcore.Core.
+func (c collectorLogCore) With(ff []zapcore.Field) zapcore.Core {
+	// The loggers of the collector components are created with both their
+	// kind and their ID, in the name field.
+	if slices.ContainsFunc(ff, func(f zapcore.Field) bool { return f.Key == collectorKindKey }) {
+		ff = slices.Clone(ff)
+		for i := range ff {
+			if ff[i].Key == collectorNameKey {
+				ff[i].Key = componentIDKey
+			}
+		}
+	}
+	return collectorLogCore{Core: c.Core.With(ff)}
+}
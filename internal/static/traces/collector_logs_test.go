@@ -0,0 +1,55 @@
+package traces
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCollectorLoggingOptions(t *testing.T) {
+	var buf bytes.Buffer
+	instLogger := newLogger(log.NewLogfmtLogger(&buf)).With(zap.String("traces_config", "default"))
+	buf.Reset()
+
+	// The collector service builds its logger with the logging options, and
+	// creates the loggers of its components with their kind and ID.
+	serviceLogger := zap.New(zapcore.NewNopCore(), collectorLoggingOptions("", instLogger)...)
+	receiverLogger := serviceLogger.With(
+		zap.String("kind", "receiver"),
+		zap.String("name", "otlp/grpc"),
+		zap.String("data_type", "traces"),
+	)
+	receiverLogger.Error("failed to receive spans", zap.Error(errors.New("connection reset")))
+
+	require.Equal(t,
+		`level=error component=traces traces_config=default kind=receiver component_id=otlp/grpc data_type=traces msg="failed to receive spans" error="connection reset"`+"\n",
+		buf.String(),
+	)
+
+	// Fields of the other loggers are left alone.
+	buf.Reset()
+	serviceLogger.With(zap.String("name", "value")).Warn("something happened")
+	require.Equal(t,
+		`level=warn component=traces traces_config=default name=value msg="something happened"`+"\n",
+		buf.String(),
+	)
+}
+
+func TestCollectorLoggingOptions_CollectorOutput(t *testing.T) {
+	instLogger := newLogger(log.NewNopLogger())
+
+	// The collector keeps the core built from its own logging config.
+	require.Empty(t, collectorLoggingOptions(collectorLogsCollector, instLogger))
+}
+
+func TestValidateCollectorLogs(t *testing.T) {
+	require.NoError(t, validateCollectorLogs(""))
+	require.NoError(t, validateCollectorLogs("agent"))
+	require.NoError(t, validateCollectorLogs("collector"))
+	require.EqualError(t, validateCollectorLogs("stderr"), `collector_logs: unknown value "stderr", must be "agent" or "collector"`)
+}
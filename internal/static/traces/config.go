@@ -1,23 +1,33 @@
 package traces
 
 import (
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"net/url"
 	"os"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	promsdconsumer "github.com/grafana/agent/internal/static/traces/promsdprocessor/consumer"
+	"github.com/grafana/river/diag"
 	"github.com/mitchellh/mapstructure"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/loadbalancingexporter"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/prometheusexporter"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/basicauthextension"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/headerssetterextension"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/jaegerremotesampling"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/extension/oauth2clientauthextension"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/attributesprocessor"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/filterprocessor"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/groupbytraceprocessor"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/probabilisticsamplerprocessor"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/spanmetricsprocessor"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/receiver/jaegerreceiver"
@@ -26,6 +36,7 @@ import (
 	"github.com/open-telemetry/opentelemetry-collector-contrib/receiver/zipkinreceiver"
 	"github.com/prometheus/client_golang/prometheus"
 	prom_config "github.com/prometheus/common/config"
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
 	"go.opentelemetry.io/collector/confmap"
 	otelexporter "go.opentelemetry.io/collector/exporter"
@@ -42,10 +53,16 @@ import (
 
 	"github.com/grafana/agent/internal/static/logs"
 	"github.com/grafana/agent/internal/static/traces/automaticloggingprocessor"
+	"github.com/grafana/agent/internal/static/traces/backpressure"
+	"github.com/grafana/agent/internal/static/traces/debugfilter"
+	"github.com/grafana/agent/internal/static/traces/exporterlimit"
+	"github.com/grafana/agent/internal/static/traces/headertemplate"
 	"github.com/grafana/agent/internal/static/traces/noopreceiver"
 	"github.com/grafana/agent/internal/static/traces/promsdprocessor"
 	"github.com/grafana/agent/internal/static/traces/pushreceiver"
+	"github.com/grafana/agent/internal/static/traces/receiverratelimit"
 	"github.com/grafana/agent/internal/static/traces/remotewriteexporter"
+	"github.com/grafana/agent/internal/static/traces/selfmonitor"
 	"github.com/grafana/agent/internal/static/traces/servicegraphprocessor"
 	"github.com/grafana/agent/internal/util"
 )
@@ -55,6 +72,10 @@ const (
 	spanMetricsPipelineName     = "spanmetrics"
 	spanMetricsPipelineFullName = spanMetricsPipelineType + "/" + spanMetricsPipelineName
 
+	serviceGraphsPipelineName     = "servicegraphs"
+	serviceGraphsPipelineFullName = spanMetricsPipelineType + "/" + serviceGraphsPipelineName
+	serviceGraphsExporterName     = remotewriteexporter.TypeStr + "/" + serviceGraphsPipelineName
+
 	// defaultDecisionWait is the default time to wait for a trace before making a sampling decision
 	defaultDecisionWait = time.Second * 5
 
@@ -63,6 +84,9 @@ const (
 
 	// defaultLoadBalancingPort is the default port the agent uses for internal load balancing
 	defaultLoadBalancingPort = "4318"
+	// loadBalancingReceiverName is the receiver of the spans load balanced
+	// by other agents
+	loadBalancingReceiverName = "otlp/lb"
 	// agent's load balancing options
 	dnsTagName        = "dns"
 	staticTagName     = "static"
@@ -74,6 +98,10 @@ const (
 	// otlp receiver
 	otlpReceiverName = "otlp"
 
+	// batchDisabledKey is the key inside the batch block used to explicitly
+	// disable the batch processor.
+	batchDisabledKey = "disabled"
+
 	// A string to print out when marshaling "secrets" strings, like passwords.
 	secretMarshalString = "<secret>"
 )
@@ -84,6 +112,11 @@ type Config struct {
 
 	// Unmarshaled is true when the Config was unmarshaled from YAML.
 	Unmarshaled bool `yaml:"-"`
+
+	// ListenAddresses are the addresses the agent listens on, keyed by the
+	// server using them, such as "HTTP server". The spanmetrics handler
+	// endpoint of an instance isn't allowed to use their ports.
+	ListenAddresses map[string]string `yaml:"-"`
 }
 
 // UnmarshalYAML implements yaml.Unmarshaler.
@@ -107,11 +140,37 @@ func (c *Config) Validate(logsConfig *logs.Config) error {
 	}
 
 	for _, inst := range c.Configs {
+		inst.listenAddresses = c.ListenAddresses
 		if inst.AutomaticLogging != nil {
 			if err := inst.AutomaticLogging.Validate(logsConfig); err != nil {
 				return fmt.Errorf("failed to validate automatic_logging for traces config %s: %w", inst.Name, err)
 			}
 		}
+		if err := inst.validateReceivers(); err != nil {
+			return fmt.Errorf("failed to validate receivers for traces config %s: %w", inst.Name, err)
+		}
+		for i, rw := range inst.RemoteWrite {
+			if _, _, err := sendingQueue(rw.SendingQueue); err != nil {
+				return fmt.Errorf("failed to validate remote_write[%d] for traces config %s: %w", i, inst.Name, err)
+			}
+		}
+		if err := inst.validateExtraProcessors(); err != nil {
+			return fmt.Errorf("failed to validate extra processors for traces config %s: %w", inst.Name, err)
+		}
+		if err := inst.validateGroupByTrace(); err != nil {
+			return fmt.Errorf("failed to validate traces config %s: %w", inst.Name, err)
+		}
+		if err := inst.validateHandlerEndpoint(); err != nil {
+			return fmt.Errorf("failed to validate traces config %s: %w", inst.Name, err)
+		}
+		if inst.ReceiverBasicAuth != nil {
+			if err := inst.ReceiverBasicAuth.Validate(); err != nil {
+				return fmt.Errorf("failed to validate traces config %s: %w", inst.Name, err)
+			}
+		}
+		if err := validateCollectorLogs(inst.CollectorLogs); err != nil {
+			return fmt.Errorf("failed to validate traces config %s: %w", inst.Name, err)
+		}
 	}
 
 	return nil
@@ -128,14 +187,56 @@ type InstanceConfig struct {
 	// https://github.com/open-telemetry/opentelemetry-collector/blob/v0.87.0/receiver/README.md
 	Receivers ReceiverMap `yaml:"receivers,omitempty"`
 
+	// ReceiverBasicAuth protects the HTTP protocols of the receivers with the
+	// basicauth extension:
+	// https://github.com/open-telemetry/opentelemetry-collector-contrib/tree/v0.87.0/extension/basicauthextension
+	ReceiverBasicAuth *ReceiverBasicAuthConfig `yaml:"receiver_basic_auth,omitempty"`
+
+	// Pipelines are named traces pipelines sharing the exporters of the
+	// default pipeline, which skip some of its processors.
+	Pipelines []pipelineConfig `yaml:"pipelines,omitempty"`
+
+	// ReceiverPipelines assigns receivers to Pipelines. The spans of the other
+	// receivers go through the default pipeline.
+	ReceiverPipelines []receiverPipelineConfig `yaml:"receiver_pipelines,omitempty"`
+
 	// Batch:
 	// https://github.com/open-telemetry/opentelemetry-collector/tree/v0.87.0/processor/batchprocessor
+	//
+	// Setting `disabled: true` explicitly opts out of batching.
 	Batch map[string]interface{} `yaml:"batch,omitempty"`
 
+	// ThroughputProfile derives the batch block, and the sending_queue and
+	// retry_on_failure blocks of each remote_write block, from the expected
+	// throughput of the pipeline when those blocks are absent.
+	ThroughputProfile *throughputProfile `yaml:"throughput_profile,omitempty"`
+
 	// Attributes:
 	// https://github.com/open-telemetry/opentelemetry-collector-contrib/tree/v0.87.0/processor
 	Attributes map[string]interface{} `yaml:"attributes,omitempty"`
 
+	// Redact removes or hashes sensitive span attributes before any other
+	// processor sees them.
+	Redact *redactConfig `yaml:"redact,omitempty"`
+
+	// ReceiverRateLimit limits the rate of spans accepted by the receivers,
+	// before any processor sees them.
+	ReceiverRateLimit *receiverratelimit.Config `yaml:"receiver_rate_limit,omitempty"`
+
+	// DebugFilter keeps or drops spans by trace ID or resource attributes
+	// before any processor sees them. Changing it doesn't restart the
+	// pipeline.
+	DebugFilter *debugfilter.Config `yaml:"debug_filter,omitempty"`
+
+	// ExtraProcessors are raw collector processor configs, keyed by processor
+	// name, for processors which have no dedicated setting. They are added to
+	// the pipeline in the position given by ExtraProcessorOrder.
+	ExtraProcessors map[string]interface{} `yaml:"extra_processors,omitempty"`
+
+	// ExtraProcessorOrder lists every extra processor, along with the built-in
+	// processors it must run after or before.
+	ExtraProcessorOrder []string `yaml:"extra_processor_order,omitempty"`
+
 	// prom service discovery config
 	ScrapeConfigs   []interface{} `yaml:"scrape_configs,omitempty"`
 	OperationType   string        `yaml:"prom_sd_operation_type,omitempty"`
@@ -152,6 +253,10 @@ type InstanceConfig struct {
 	// https://github.com/open-telemetry/opentelemetry-collector-contrib/tree/v0.87.0/processor/tailsamplingprocessor
 	TailSampling *tailSamplingConfig `yaml:"tail_sampling,omitempty"`
 
+	// GroupByTrace groups the spans of each trace before tail sampling
+	// https://github.com/open-telemetry/opentelemetry-collector-contrib/tree/v0.87.0/processor/groupbytraceprocessor
+	GroupByTrace *groupByTraceConfig `yaml:"group_by_trace,omitempty"`
+
 	// LoadBalancing is used to distribute spans of the same trace to the same agent instance
 	// https://github.com/open-telemetry/opentelemetry-collector-contrib/tree/v0.87.0/exporter/loadbalancingexporter
 	LoadBalancing *loadBalancingConfig `yaml:"load_balancing"`
@@ -159,9 +264,26 @@ type InstanceConfig struct {
 	// ServiceGraphs
 	ServiceGraphs *serviceGraphsConfig `yaml:"service_graphs,omitempty"`
 
+	// SelfMonitoring periodically pushes a synthetic trace through the
+	// pipeline to measure its latency.
+	SelfMonitoring *selfmonitor.Config `yaml:"self_monitoring,omitempty"`
+
+	// Backpressure rejects the spans pushed to the receivers while the
+	// sending queue of an exporter is saturated, so that clients retry them.
+	Backpressure *backpressure.Config `yaml:"backpressure,omitempty"`
+
 	// Jaeger's Remote Sampling extension:
 	// https://github.com/open-telemetry/opentelemetry-collector-contrib/tree/v0.87.0/extension/jaegerremotesampling
 	JaegerRemoteSampling []JaegerRemoteSamplingConfig `yaml:"jaeger_remote_sampling"`
+
+	// CollectorLogs selects where the logs of the collector components are
+	// written: "agent", the default, writes them with the agent logger, and
+	// "collector" keeps the collector's own output on stderr.
+	CollectorLogs string `yaml:"collector_logs,omitempty"`
+
+	// listenAddresses are the addresses the agent listens on, copied from
+	// Config.ListenAddresses.
+	listenAddresses map[string]string
 }
 
 // A string type for secrets like passwords.
@@ -280,6 +402,46 @@ type TLSClientSetting struct {
 	ServerNameOverride string        `yaml:"server_name_override,omitempty"`
 }
 
+// validate checks that the TLS versions are ones the oauth2client extension
+// supports.
+func (s TLSClientSetting) validate() error {
+	for _, v := range []string{s.MinVersion, s.MaxVersion} {
+		if v == "" {
+			continue
+		}
+		if _, ok := otelTLSVersionNumbers[v]; !ok {
+			return fmt.Errorf("unknown TLS version %q, must be one of 1.0, 1.1, 1.2 or 1.3", v)
+		}
+	}
+	if s.MinVersion != "" && s.MaxVersion != "" && otelTLSVersionNumbers[s.MinVersion] > otelTLSVersionNumbers[s.MaxVersion] {
+		return fmt.Errorf("TLS min_version %s is greater than max_version %s", s.MinVersion, s.MaxVersion)
+	}
+	return nil
+}
+
+// otelTLSVersionNumbers maps the TLS versions of the OpenTelemetry Collector
+// TLS settings to their protocol version numbers.
+var otelTLSVersionNumbers = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// otelTLSVersion returns the OpenTelemetry Collector TLS setting for the TLS
+// version v of a Prometheus TLS config, or an empty string if v isn't set.
+func otelTLSVersion(v prom_config.TLSVersion) (string, error) {
+	if v == 0 {
+		return "", nil
+	}
+	for name, number := range otelTLSVersionNumbers {
+		if uint16(v) == number {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown TLS version 0x%04x", uint16(v))
+}
+
 // OAuth2Config configures the oauth2client extension for a remote_write exporter
 // compatible with oauth2clientauthextension.Config
 type OAuth2Config struct {
@@ -313,6 +475,169 @@ func (c OAuth2Config) toOtelConfig() (*oauth2clientauthextension.Config, error)
 	return result, nil
 }
 
+// receiverBasicAuthExtensionName is the name of the basicauth extension
+// created from ReceiverBasicAuthConfig.
+const receiverBasicAuthExtensionName = "basicauth/receiver"
+
+// receiverHTTPServers lists, by receiver type, the path to the HTTP server
+// settings of each HTTP-capable protocol. An empty path means the receiver
+// settings are the HTTP server settings.
+var receiverHTTPServers = map[string][][]string{
+	otlpReceiverName: {{"protocols", protocolHTTP}},
+	"jaeger":         {{"protocols", "thrift_http"}},
+	"zipkin":         {{}},
+}
+
+// ReceiverBasicAuthConfig configures the basicauth server extension that
+// protects the HTTP protocols of the receivers. Credentials are either a
+// username and a file holding its password, or an htpasswd file.
+type ReceiverBasicAuthConfig struct {
+	Username     string `yaml:"username,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+	HtpasswdFile string `yaml:"htpasswd_file,omitempty"`
+}
+
+// Validate checks that exactly one kind of credentials is configured.
+func (c *ReceiverBasicAuthConfig) Validate() error {
+	switch {
+	case c.HtpasswdFile != "" && (c.Username != "" || c.PasswordFile != ""):
+		return errors.New("receiver_basic_auth: htpasswd_file cannot be used with username and password_file")
+	case c.HtpasswdFile != "":
+		return nil
+	case c.Username == "" || c.PasswordFile == "":
+		return errors.New("receiver_basic_auth: either username and password_file, or htpasswd_file must be set")
+	case strings.Contains(c.Username, ":"):
+		return errors.New("receiver_basic_auth: username cannot contain ':'")
+	}
+	return nil
+}
+
+// toOtelConfig returns the configuration of the basicauth extension. The
+// password file is read once, so changes to it require reloading the config.
+func (c *ReceiverBasicAuthConfig) toOtelConfig() (map[string]interface{}, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	htpasswd := map[string]interface{}{}
+	if c.HtpasswdFile != "" {
+		htpasswd["file"] = c.HtpasswdFile
+	} else {
+		password, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("receiver_basic_auth: failed to read password_file: %w", err)
+		}
+		htpasswd["inline"] = c.Username + ":" + strings.TrimSpace(string(password))
+	}
+	return map[string]interface{}{"htpasswd": htpasswd}, nil
+}
+
+// withReceiverAuthenticator returns a copy of the config of the receiver
+// named name, where every enabled HTTP protocol without explicit auth settings
+// uses authenticator.
+func withReceiverAuthenticator(name string, cfg interface{}, authenticator string) (interface{}, error) {
+	receiverType, _, _ := strings.Cut(name, "/")
+	for _, path := range receiverHTTPServers[receiverType] {
+		var err error
+		cfg, err = withAuthenticator(cfg, path, authenticator)
+		if err != nil {
+			return nil, fmt.Errorf("receiver %q: %w", name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// withAuthenticator sets authenticator in the server settings found at path
+// in cfg, copying the maps along the path so that cfg isn't modified. cfg is
+// returned unchanged if path isn't present.
+func withAuthenticator(cfg interface{}, path []string, authenticator string) (interface{}, error) {
+	m, err := copyStringMap(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(path) == 0 {
+		if _, ok := m["auth"]; !ok {
+			m["auth"] = map[string]interface{}{"authenticator": authenticator}
+		}
+		return m, nil
+	}
+
+	next, ok := m[path[0]]
+	if !ok {
+		return cfg, nil
+	}
+	if m[path[0]], err = withAuthenticator(next, path[1:], authenticator); err != nil {
+		return nil, fmt.Errorf("%s: %w", path[0], err)
+	}
+	return m, nil
+}
+
+// copyStringMap returns a shallow copy of a YAML map as a map with string
+// keys. A nil value is returned as an empty map.
+func copyStringMap(v interface{}) (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	switch v := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		for k, val := range v {
+			res[k] = val
+		}
+	case map[interface{}]interface{}:
+		for k, val := range v {
+			res[fmt.Sprint(k)] = val
+		}
+	default:
+		return nil, fmt.Errorf("expected a map, got %T", v)
+	}
+	return res, nil
+}
+
+// DefaultMaxResourceDimensions is the default maximum number of resource
+// attributes copied to the dimensions of span metrics.
+const DefaultMaxResourceDimensions = 10
+
+// dimensions returns the dimensions passed to spanmetricsprocessor.
+//
+// spanmetricsprocessor looks up each dimension in the span attributes first
+// and falls back to the resource attributes, so resource dimensions are
+// appended to the dimensions. Resource dimensions which are already listed in
+// Dimensions are skipped, keeping the settings of the entry in Dimensions.
+// An error is returned if more resource dimensions than
+// MaxResourceDimensions are appended.
+func (c *SpanMetricsConfig) dimensions() ([]spanmetricsprocessor.Dimension, error) {
+	maxResourceDimensions := c.MaxResourceDimensions
+	switch {
+	case maxResourceDimensions < 0:
+		return nil, fmt.Errorf("spanmetrics: max_resource_dimensions must not be negative")
+	case maxResourceDimensions == 0:
+		maxResourceDimensions = DefaultMaxResourceDimensions
+	}
+
+	if len(c.ResourceDimensions) == 0 {
+		return c.Dimensions, nil
+	}
+
+	res := make([]spanmetricsprocessor.Dimension, 0, len(c.Dimensions)+len(c.ResourceDimensions))
+	res = append(res, c.Dimensions...)
+
+	seen := make(map[string]struct{}, len(res))
+	for _, d := range c.Dimensions {
+		seen[d.Name] = struct{}{}
+	}
+	for _, d := range c.ResourceDimensions {
+		if _, ok := seen[d.Name]; ok {
+			continue
+		}
+		seen[d.Name] = struct{}{}
+		res = append(res, d)
+	}
+	if copied := len(res) - len(c.Dimensions); copied > maxResourceDimensions {
+		return nil, fmt.Errorf("spanmetrics: at most %d resource_dimensions can be copied to the dimensions, got %d; raise max_resource_dimensions to copy more", maxResourceDimensions, copied)
+	}
+	return res, nil
+}
+
 // RemoteWriteConfig controls the configuration of an exporter
 type RemoteWriteConfig struct {
 	Endpoint    string `yaml:"endpoint,omitempty"`
@@ -328,6 +653,13 @@ type RemoteWriteConfig struct {
 	Headers            map[string]string      `yaml:"headers,omitempty"`
 	SendingQueue       map[string]interface{} `yaml:"sending_queue,omitempty"`    // https://github.com/open-telemetry/opentelemetry-collector/blob/v0.87.0/exporter/exporterhelper/queued_retry.go
 	RetryOnFailure     map[string]interface{} `yaml:"retry_on_failure,omitempty"` // https://github.com/open-telemetry/opentelemetry-collector/blob/v0.87.0/exporter/exporterhelper/queued_retry.go
+	TenantRouting      *TenantRoutingConfig   `yaml:"tenant_routing,omitempty"`
+	// SamplePercentage is the percentage of traces exported to this backend.
+	// All traces are exported when 0.
+	SamplePercentage float64 `yaml:"sample_percentage,omitempty"`
+	// MaxConcurrentRequests is the maximum number of requests sent to the
+	// backend at once. Unlimited when 0.
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests,omitempty"`
 }
 
 // UnmarshalYAML implements yaml.Unmarshaler.
@@ -347,13 +679,178 @@ func (c *RemoteWriteConfig) UnmarshalYAML(unmarshal func(interface{}) error) err
 	if c.Format != formatOtlp && c.Format != formatJaeger {
 		return fmt.Errorf("unsupported format '%s', expected 'otlp' or 'jaeger'", c.Format)
 	}
+
+	if c.SamplePercentage < 0 || c.SamplePercentage > 100 {
+		return fmt.Errorf("sample_percentage must be between 0 and 100, got %v", c.SamplePercentage)
+	}
+
+	if c.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("max_concurrent_requests must not be negative, got %d", c.MaxConcurrentRequests)
+	}
+
+	if c.TenantRouting != nil {
+		for name := range c.Headers {
+			if strings.EqualFold(name, tenantHeader) {
+				return fmt.Errorf("the %s header can't be set when tenant_routing is configured", tenantHeader)
+			}
+		}
+	}
+
+	for name, value := range c.Headers {
+		if !headertemplate.IsTemplate(value) {
+			continue
+		}
+		if c.Format != formatOtlp || c.Protocol != protocolHTTP {
+			return fmt.Errorf("header %s references resource attributes, which is only supported by the otlp format over http", name)
+		}
+		if c.Oauth2 != nil {
+			return fmt.Errorf("header %s references resource attributes, which can't be combined with oauth2", name)
+		}
+		if _, err := headertemplate.Parse(value); err != nil {
+			return fmt.Errorf("invalid header %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// headerTemplates returns the headers whose values reference resource
+// attributes, such as "${resource.service.name}".
+func (c *RemoteWriteConfig) headerTemplates() (headertemplate.Headers, error) {
+	var headers headertemplate.Headers
+	for name, value := range c.Headers {
+		if !headertemplate.IsTemplate(value) {
+			continue
+		}
+		t, err := headertemplate.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %s: %w", name, err)
+		}
+		if headers == nil {
+			headers = headertemplate.Headers{}
+		}
+		headers[name] = t
+	}
+	return headers, nil
+}
+
+// tenantHeader is the header which tells the backend the tenant of the spans.
+const tenantHeader = "X-Scope-OrgID"
+
+// TenantRoutingConfig routes spans to different tenants of a remote_write
+// backend based on the value of a resource attribute.
+type TenantRoutingConfig struct {
+	// Attribute is the resource attribute spans are routed by.
+	Attribute string `yaml:"attribute"`
+	// Mapping maps the values of Attribute to tenants.
+	Mapping map[string]string `yaml:"mapping"`
+	// DefaultTenant receives the spans whose attribute value isn't in Mapping.
+	DefaultTenant string `yaml:"default_tenant,omitempty"`
+	// DropUnmatched drops the spans whose attribute value isn't in Mapping.
+	DropUnmatched bool `yaml:"drop_unmatched,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *TenantRoutingConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain TenantRoutingConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	if c.Attribute == "" {
+		return errors.New("tenant_routing: attribute must be set")
+	}
+	if len(c.Mapping) == 0 {
+		return errors.New("tenant_routing: mapping must not be empty")
+	}
+	for value, tenant := range c.Mapping {
+		if tenant == "" {
+			return fmt.Errorf("tenant_routing: empty tenant for value '%s'", value)
+		}
+	}
+	if c.DefaultTenant != "" && c.DropUnmatched {
+		return errors.New("tenant_routing: default_tenant and drop_unmatched are mutually exclusive")
+	}
+	if c.DefaultTenant == "" && !c.DropUnmatched {
+		return errors.New("tenant_routing: one of default_tenant or drop_unmatched must be set")
+	}
 	return nil
 }
 
+// tenantRoute is a pipeline exporting the spans of a single tenant.
+type tenantRoute struct {
+	tenant   string
+	exporter string
+	// conditions are the OTTL conditions of the spans which don't belong to
+	// the tenant. Any matching span is dropped.
+	conditions []string
+	// samplePercentage is the sample_percentage of the remote_write block.
+	samplePercentage float64
+}
+
+// routes returns a route per tenant, sorted by tenant. exporterName is the
+// name of the exporter of the remote_write block.
+func (c *TenantRoutingConfig) routes(exporterName string) []tenantRoute {
+	values := map[string][]string{}
+	for value, tenant := range c.Mapping {
+		values[tenant] = append(values[tenant], value)
+	}
+	if _, ok := values[c.DefaultTenant]; c.DefaultTenant != "" && !ok {
+		values[c.DefaultTenant] = nil
+	}
+
+	tenants := make([]string, 0, len(values))
+	for tenant := range values {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	attr := fmt.Sprintf("resource.attributes[%s]", strconv.Quote(c.Attribute))
+	routes := make([]tenantRoute, 0, len(tenants))
+	for _, tenant := range tenants {
+		route := tenantRoute{tenant: tenant, exporter: tenantExporterName(exporterName, tenant)}
+		if tenant == c.DefaultTenant {
+			// Drop the spans of the other tenants.
+			for _, other := range tenants {
+				if other == tenant {
+					continue
+				}
+				otherValues := values[other]
+				sort.Strings(otherValues)
+				for _, value := range otherValues {
+					route.conditions = append(route.conditions, fmt.Sprintf("%s == %s", attr, strconv.Quote(value)))
+				}
+			}
+		} else {
+			// Drop the spans without one of the values of the tenant.
+			tenantValues := values[tenant]
+			sort.Strings(tenantValues)
+			clauses := make([]string, 0, len(tenantValues))
+			for _, value := range tenantValues {
+				clauses = append(clauses, fmt.Sprintf("%s != %s", attr, strconv.Quote(value)))
+			}
+			route.conditions = []string{strings.Join(clauses, " and ")}
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+func tenantExporterName(exporterName string, tenant string) string {
+	return fmt.Sprintf("%s/%s", exporterName, tenant)
+}
+
 // SpanMetricsConfig controls the configuration of spanmetricsprocessor and the related metrics exporter.
 type SpanMetricsConfig struct {
 	LatencyHistogramBuckets []time.Duration                  `yaml:"latency_histogram_buckets,omitempty"`
 	Dimensions              []spanmetricsprocessor.Dimension `yaml:"dimensions,omitempty"`
+	// ResourceDimensions are dimensions read from resource attributes, such as
+	// service.namespace or k8s.cluster.name. A span attribute with the same
+	// name takes precedence over the resource attribute.
+	ResourceDimensions []spanmetricsprocessor.Dimension `yaml:"resource_dimensions,omitempty"`
+	// MaxResourceDimensions caps the number of ResourceDimensions, which
+	// bounds the cardinality of the generated metrics. 0 means
+	// DefaultMaxResourceDimensions.
+	MaxResourceDimensions int `yaml:"max_resource_dimensions,omitempty"`
 	// Namespace if set, exports metrics under the provided value.
 	Namespace string `yaml:"namespace,omitempty"`
 	// ConstLabels are values that are applied for every exported metric.
@@ -392,6 +889,38 @@ type tailSamplingConfig struct {
 	ExpectedNewTracesPerSec uint64 `yaml:"expected_new_traces_per_sec,omitempty"`
 }
 
+// groupByTraceConfig defines the configuration of the groupbytrace processor,
+// which holds the spans of each trace until the whole trace is received.
+type groupByTraceConfig struct {
+	// WaitDuration is how long to wait for the spans of a trace after its
+	// first span is received.
+	WaitDuration time.Duration `yaml:"wait_duration,omitempty"`
+	// NumTraces is the maximum number of traces kept in memory.
+	NumTraces int `yaml:"num_traces,omitempty"`
+}
+
+// groupByTraceProcessorName is the name of the processor generated from the
+// group_by_trace block.
+const groupByTraceProcessorName = "groupbytrace"
+
+// validateGroupByTrace checks that group_by_trace is only configured along
+// with tail_sampling.
+func (c *InstanceConfig) validateGroupByTrace() error {
+	if c.GroupByTrace == nil {
+		return nil
+	}
+	if c.TailSampling == nil {
+		return errors.New("group_by_trace requires tail_sampling to be configured")
+	}
+	if c.GroupByTrace.WaitDuration < 0 {
+		return errors.New("group_by_trace: wait_duration must not be negative")
+	}
+	if c.GroupByTrace.NumTraces < 0 {
+		return errors.New("group_by_trace: num_traces must not be negative")
+	}
+	return nil
+}
+
 type policy struct {
 	Name   string                 `yaml:"name,omitempty"`
 	Type   string                 `yaml:"type"`
@@ -406,6 +935,59 @@ type loadBalancingConfig struct {
 	// ReceiverPort is the port the instance will use to receive load balanced traces
 	ReceiverPort string `yaml:"receiver_port"`
 	RoutingKey   string `yaml:"routing_key,omitempty"`
+	// HealthCheck enables probing the resolved backends and ejecting the
+	// failing ones from the hash ring.
+	HealthCheck *loadBalancingHealthCheckConfig `yaml:"health_check,omitempty"`
+}
+
+const (
+	healthCheckProtocolTCP  = "tcp"
+	healthCheckProtocolGRPC = "grpc"
+)
+
+// defaultLoadBalancingHealthCheckConfig holds the default settings for a
+// loadBalancingHealthCheckConfig.
+var defaultLoadBalancingHealthCheckConfig = loadBalancingHealthCheckConfig{
+	Protocol: healthCheckProtocolTCP,
+	Interval: 10 * time.Second,
+	Timeout:  2 * time.Second,
+}
+
+// loadBalancingHealthCheckConfig configures the active health checking of
+// load balancing backends. Backends which fail a probe are removed from the
+// set of backends until they pass a probe again.
+type loadBalancingHealthCheckConfig struct {
+	// Protocol is the probe used to check backends, either tcp or grpc.
+	Protocol string `yaml:"protocol,omitempty"`
+	// Interval is the time between two probes of the backends.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Timeout is the maximum duration of a single probe.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *loadBalancingHealthCheckConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = defaultLoadBalancingHealthCheckConfig
+
+	type plain loadBalancingHealthCheckConfig
+	return unmarshal((*plain)(c))
+}
+
+// Validate ensures that the health check config is valid.
+func (c *loadBalancingHealthCheckConfig) Validate() error {
+	if c.Protocol != healthCheckProtocolTCP && c.Protocol != healthCheckProtocolGRPC {
+		return fmt.Errorf("unsupported health_check protocol '%s', expected 'tcp' or 'grpc'", c.Protocol)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("health_check interval must be greater than 0")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("health_check timeout must be greater than 0")
+	}
+	if c.Timeout > c.Interval {
+		return fmt.Errorf("health_check timeout (%s) must not be greater than interval (%s)", c.Timeout, c.Interval)
+	}
+	return nil
 }
 
 // exporterConfig defined the config for an otlp exporter for load balancing
@@ -421,6 +1003,131 @@ type serviceGraphsConfig struct {
 	Enabled  bool          `yaml:"enabled,omitempty"`
 	Wait     time.Duration `yaml:"wait,omitempty"`
 	MaxItems int           `yaml:"max_items,omitempty"`
+
+	// MetricsInstance is the Agent's metrics instance the metrics are remote
+	// written to. When empty, the metrics are exposed with the metrics of the
+	// Agent.
+	MetricsInstance string `yaml:"metrics_instance,omitempty"`
+	// Namespace further namespaces the metrics remote written to
+	// MetricsInstance, as {namespace}_traces_service_graph_*.
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// remoteWrite returns whether the metrics are remote written to a metrics
+// instance.
+func (c *serviceGraphsConfig) remoteWrite() bool {
+	return c != nil && c.Enabled && c.MetricsInstance != ""
+}
+
+const (
+	redactActionDelete = "delete"
+	redactActionHash   = "hash"
+
+	// redactProcessorName is the name of the attributes processor generated
+	// from the redact block.
+	redactProcessorName = "attributes/redact"
+)
+
+// redactConfig configures the redaction of span attributes.
+type redactConfig struct {
+	// Keys are glob patterns matched against attribute keys. `*` matches any
+	// sequence of characters, including dots.
+	Keys []string `yaml:"keys"`
+	// Action is applied to the matching attributes, either delete or hash.
+	Action string `yaml:"action,omitempty"`
+
+	patterns []string
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *redactConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = redactConfig{Action: redactActionDelete}
+
+	type plain redactConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Validate ensures that the redact config is valid and compiles its key
+// patterns.
+func (c *redactConfig) Validate() error {
+	if c.Action != redactActionDelete && c.Action != redactActionHash {
+		return fmt.Errorf("unsupported redact action '%s', expected 'delete' or 'hash'", c.Action)
+	}
+	if len(c.Keys) == 0 {
+		return fmt.Errorf("redact requires at least one key")
+	}
+
+	c.patterns = make([]string, 0, len(c.Keys))
+	for _, key := range c.Keys {
+		pattern, err := globToRegexp(key)
+		if err != nil {
+			return fmt.Errorf("invalid redact key '%s': %w", key, err)
+		}
+		c.patterns = append(c.patterns, pattern)
+	}
+	return nil
+}
+
+// processor returns the attributes processor config which applies the
+// redaction.
+func (c *redactConfig) processor() map[string]interface{} {
+	actions := make([]map[string]interface{}, 0, len(c.patterns))
+	for _, pattern := range c.patterns {
+		actions = append(actions, map[string]interface{}{
+			"pattern": pattern,
+			"action":  c.Action,
+		})
+	}
+	return map[string]interface{}{
+		"actions": actions,
+	}
+}
+
+// globToRegexp translates a glob pattern into an anchored regular expression.
+// It supports `*`, `?`, character classes and backslash escapes.
+func globToRegexp(glob string) (string, error) {
+	if glob == "" {
+		return "", fmt.Errorf("pattern must not be empty")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch ch := glob[i]; ch {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '\\':
+			if i+1 == len(glob) {
+				return "", fmt.Errorf("trailing backslash")
+			}
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end <= 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	sb.WriteString("$")
+
+	if _, err := regexp.Compile(sb.String()); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
 }
 
 // exporter builds an OTel exporter from RemoteWriteConfig
@@ -429,9 +1136,13 @@ func exporter(rwCfg RemoteWriteConfig) (map[string]interface{}, error) {
 		return nil, errors.New("must have a configured a backend endpoint")
 	}
 
+	// Headers referencing resource attributes are set by the headers_setter
+	// extension instead.
 	headers := map[string]string{}
-	if rwCfg.Headers != nil {
-		headers = rwCfg.Headers
+	for name, value := range rwCfg.Headers {
+		if !headertemplate.IsTemplate(value) {
+			headers[name] = value
+		}
 	}
 
 	if rwCfg.BasicAuth != nil && rwCfg.Oauth2 != nil {
@@ -458,6 +1169,12 @@ func exporter(rwCfg RemoteWriteConfig) (map[string]interface{}, error) {
 		compression = compressionNone
 	}
 
+	queueCfg, _, err := sendingQueue(rwCfg.SendingQueue)
+	if err != nil {
+		return nil, err
+	}
+	queueCfg = limitQueueConsumers(queueCfg, rwCfg.MaxConcurrentRequests)
+
 	// Default OTLP exporter config awaits an empty headers map. Other exporters
 	// (e.g. Jaeger) may expect a nil value instead
 	if len(headers) == 0 && rwCfg.Format == formatJaeger {
@@ -467,7 +1184,7 @@ func exporter(rwCfg RemoteWriteConfig) (map[string]interface{}, error) {
 		"endpoint":         rwCfg.Endpoint,
 		"compression":      compression,
 		"headers":          headers,
-		"sending_queue":    rwCfg.SendingQueue,
+		"sending_queue":    queueCfg,
 		"retry_on_failure": rwCfg.RetryOnFailure,
 	}
 
@@ -481,6 +1198,24 @@ func exporter(rwCfg RemoteWriteConfig) (map[string]interface{}, error) {
 			tlsConfig["cert_file"] = rwCfg.TLSConfig.CertFile
 			tlsConfig["key_file"] = rwCfg.TLSConfig.KeyFile
 			tlsConfig["insecure_skip_verify"] = rwCfg.TLSConfig.InsecureSkipVerify
+
+			minVersion, err := otelTLSVersion(rwCfg.TLSConfig.MinVersion)
+			if err != nil {
+				return nil, fmt.Errorf("tls_config.min_version: %w", err)
+			}
+			maxVersion, err := otelTLSVersion(rwCfg.TLSConfig.MaxVersion)
+			if err != nil {
+				return nil, fmt.Errorf("tls_config.max_version: %w", err)
+			}
+			if minVersion != "" && maxVersion != "" && rwCfg.TLSConfig.MinVersion > rwCfg.TLSConfig.MaxVersion {
+				return nil, fmt.Errorf("tls_config.min_version %s is greater than max_version %s", minVersion, maxVersion)
+			}
+			if minVersion != "" {
+				tlsConfig["min_version"] = minVersion
+			}
+			if maxVersion != "" {
+				tlsConfig["max_version"] = maxVersion
+			}
 		} else {
 			// If not, set whatever value is specified in the old config.
 			tlsConfig["insecure_skip_verify"] = rwCfg.InsecureSkipVerify
@@ -503,30 +1238,167 @@ func exporter(rwCfg RemoteWriteConfig) (map[string]interface{}, error) {
 	return exporter, nil
 }
 
-func getExporterName(index int, protocol string, format string) (string, error) {
-	switch format {
-	case formatOtlp:
-		switch protocol {
-		case protocolGRPC:
-			return fmt.Sprintf("otlp/%d", index), nil
-		case protocolHTTP:
-			return fmt.Sprintf("otlphttp/%d", index), nil
-		default:
-			return "", errors.New("unknown protocol, expected either 'http' or 'grpc'")
-		}
-	case formatJaeger:
-		switch protocol {
-		case protocolGRPC:
-			return fmt.Sprintf("jaeger/%d", index), nil
-		default:
-			return "", errors.New("unknown protocol, expected 'grpc'")
-		}
-	default:
-		return "", errors.New("unknown format, expected either 'otlp' or 'jaeger'")
-	}
+// sendingQueueConfig holds the sending_queue fields of a remote_write block
+// which are checked before being passed to the exporter.
+type sendingQueueConfig struct {
+	Enabled      *bool `mapstructure:"enabled"`
+	NumConsumers *int  `mapstructure:"num_consumers"`
+	QueueSize    *int  `mapstructure:"queue_size"`
 }
 
-// exporters builds one or multiple exporters from a remote_write block.
+// sendingQueue validates the sending_queue of a remote_write block and returns
+// the config to pass to the exporter, along with warnings for settings which
+// are valid but make the exporter drop spans under load. A queue_size of 0
+// disables the queue.
+func sendingQueue(cfg map[string]interface{}) (map[string]interface{}, diag.Diagnostics, error) {
+	if cfg == nil {
+		return nil, nil, nil
+	}
+
+	var q sendingQueueConfig
+	if err := mapstructure.Decode(cfg, &q); err != nil {
+		return nil, nil, fmt.Errorf("invalid sending_queue: %w", err)
+	}
+	if q.NumConsumers != nil && *q.NumConsumers < 0 {
+		return nil, nil, fmt.Errorf("sending_queue.num_consumers must not be negative, got %d", *q.NumConsumers)
+	}
+	if q.QueueSize != nil && *q.QueueSize < 0 {
+		return nil, nil, fmt.Errorf("sending_queue.queue_size must not be negative, got %d", *q.QueueSize)
+	}
+
+	var diags diag.Diagnostics
+	if q.Enabled != nil && !*q.Enabled {
+		diags.Add(warning("sending_queue is disabled, spans are dropped whenever the backend can't keep up"))
+		return cfg, diags, nil
+	}
+	if q.QueueSize == nil || *q.QueueSize != 0 {
+		return cfg, nil, nil
+	}
+
+	diags.Add(warning("sending_queue.queue_size is 0, the sending queue is disabled and spans are dropped whenever the backend can't keep up"))
+	res := make(map[string]interface{}, len(cfg))
+	for k, v := range cfg {
+		res[k] = v
+	}
+	res["enabled"] = false
+	delete(res, "queue_size")
+	return res, diags, nil
+}
+
+// warning returns a diagnostic with a warning severity level.
+func warning(msg string) diag.Diagnostic {
+	return diag.Diagnostic{Severity: diag.SeverityLevelWarn, Message: msg}
+}
+
+// defaultQueueConsumers is the num_consumers of the exporter sending queue
+// when unset.
+const defaultQueueConsumers = 10
+
+// limitQueueConsumers lowers the num_consumers of an enabled sending queue to
+// maxConcurrentRequests, as each consumer sends one request at a time.
+func limitQueueConsumers(cfg map[string]interface{}, maxConcurrentRequests int) map[string]interface{} {
+	if maxConcurrentRequests <= 0 {
+		return cfg
+	}
+
+	var q sendingQueueConfig
+	if err := mapstructure.Decode(cfg, &q); err != nil || (q.Enabled != nil && !*q.Enabled) {
+		return cfg
+	}
+	numConsumers := defaultQueueConsumers
+	if q.NumConsumers != nil {
+		numConsumers = *q.NumConsumers
+	}
+	if numConsumers <= maxConcurrentRequests {
+		return cfg
+	}
+
+	res := make(map[string]interface{}, len(cfg)+1)
+	for k, v := range cfg {
+		res[k] = v
+	}
+	res["num_consumers"] = maxConcurrentRequests
+	return res
+}
+
+// defaultSendBatchSize is the send_batch_size of the batch processor when
+// unset.
+const defaultSendBatchSize = 8192
+
+// sendingQueueDiagnostics returns the warnings about the sending_queue of each
+// remote_write block. The queue_size of a sending_queue is also checked
+// against the send_batch_size of the batch processor, including when it's
+// derived from the throughput_profile.
+func (c *InstanceConfig) sendingQueueDiagnostics() diag.Diagnostics {
+	sendBatchSize := c.withThroughputDefaults().sendBatchSize()
+
+	var diags diag.Diagnostics
+	for i, rw := range c.RemoteWrite {
+		_, ds, err := sendingQueue(rw.SendingQueue)
+		if err != nil {
+			// Errors are reported when building the exporters.
+			continue
+		}
+		for _, d := range ds {
+			d.Message = fmt.Sprintf("remote_write[%d]: %s", i, d.Message)
+			diags.Add(d)
+		}
+
+		var q sendingQueueConfig
+		if len(ds) > 0 || sendBatchSize == 0 || mapstructure.Decode(rw.SendingQueue, &q) != nil || q.QueueSize == nil {
+			continue
+		}
+		if *q.QueueSize < sendBatchSize {
+			diags.Add(warning(fmt.Sprintf("remote_write[%d]: sending_queue.queue_size (%d) is lower than batch.send_batch_size (%d), the sending queue may drop spans under load", i, *q.QueueSize, sendBatchSize)))
+		}
+	}
+	return diags
+}
+
+// sendBatchSize returns the send_batch_size of the batch processor, or 0 if
+// spans aren't batched.
+func (c *InstanceConfig) sendBatchSize() int {
+	batchCfg, disabled, err := c.batchConfig()
+	if err != nil || batchCfg == nil || disabled {
+		return 0
+	}
+
+	var b struct {
+		SendBatchSize *int `mapstructure:"send_batch_size"`
+	}
+	if err := mapstructure.Decode(batchCfg, &b); err != nil {
+		return 0
+	}
+	if b.SendBatchSize == nil {
+		return defaultSendBatchSize
+	}
+	return *b.SendBatchSize
+}
+
+func getExporterName(index int, protocol string, format string) (string, error) {
+	switch format {
+	case formatOtlp:
+		switch protocol {
+		case protocolGRPC:
+			return fmt.Sprintf("otlp/%d", index), nil
+		case protocolHTTP:
+			return fmt.Sprintf("otlphttp/%d", index), nil
+		default:
+			return "", errors.New("unknown protocol, expected either 'http' or 'grpc'")
+		}
+	case formatJaeger:
+		switch protocol {
+		case protocolGRPC:
+			return fmt.Sprintf("jaeger/%d", index), nil
+		default:
+			return "", errors.New("unknown protocol, expected 'grpc'")
+		}
+	default:
+		return "", errors.New("unknown format, expected either 'otlp' or 'jaeger'")
+	}
+}
+
+// exporters builds one or multiple exporters from a remote_write block.
 func (c *InstanceConfig) exporters() (map[string]interface{}, error) {
 	exporters := map[string]interface{}{}
 	for i, remoteWriteConfig := range c.RemoteWrite {
@@ -541,26 +1413,171 @@ func (c *InstanceConfig) exporters() (map[string]interface{}, error) {
 		if remoteWriteConfig.Oauth2 != nil {
 			exporter["auth"] = map[string]string{"authenticator": getAuthExtensionName(exporterName)}
 		}
-		exporters[exporterName] = exporter
+		templates, err := remoteWriteConfig.headerTemplates()
+		if err != nil {
+			return nil, err
+		}
+		if len(templates) > 0 {
+			exporter["auth"] = map[string]string{"authenticator": getHeadersSetterExtensionName(exporterName)}
+		}
+		if remoteWriteConfig.TenantRouting == nil {
+			exporters[exporterName] = exporter
+			continue
+		}
+
+		// Export the spans of each tenant with their own exporter, which
+		// differs only by the tenant header.
+		for _, route := range remoteWriteConfig.TenantRouting.routes(exporterName) {
+			tenantExporter := make(map[string]interface{}, len(exporter))
+			for k, v := range exporter {
+				tenantExporter[k] = v
+			}
+			headers := map[string]string{}
+			if h, ok := exporter["headers"].(map[string]string); ok {
+				for k, v := range h {
+					headers[k] = v
+				}
+			}
+			headers[tenantHeader] = route.tenant
+			tenantExporter["headers"] = headers
+			exporters[route.exporter] = tenantExporter
+		}
 	}
 	return exporters, nil
 }
 
+// tenantRoutes returns the routes of the remote_write blocks with
+// tenant_routing.
+func (c *InstanceConfig) tenantRoutes() ([]tenantRoute, error) {
+	var routes []tenantRoute
+	for i, remoteWriteConfig := range c.RemoteWrite {
+		if remoteWriteConfig.TenantRouting == nil {
+			continue
+		}
+		exporterName, err := getExporterName(i, remoteWriteConfig.Protocol, remoteWriteConfig.Format)
+		if err != nil {
+			return nil, err
+		}
+		for _, route := range remoteWriteConfig.TenantRouting.routes(exporterName) {
+			route.samplePercentage = remoteWriteConfig.SamplePercentage
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == 0 {
+		return nil, nil
+	}
+
+	// Each route is a pipeline of its own, processors which don't only
+	// change the spans they see would run once per pipeline.
+	switch {
+	case c.SpanMetrics != nil:
+		return nil, errors.New("tenant_routing can't be combined with spanmetrics")
+	case c.ServiceGraphs != nil && c.ServiceGraphs.Enabled:
+		return nil, errors.New("tenant_routing can't be combined with service_graphs")
+	case c.AutomaticLogging != nil:
+		return nil, errors.New("tenant_routing can't be combined with automatic_logging")
+	case c.LoadBalancing != nil:
+		return nil, errors.New("tenant_routing can't be combined with load_balancing")
+	}
+	return routes, nil
+}
+
+// sampledExporters returns the sample_percentage of the exporters of the
+// remote_write blocks which only export a share of the traces, by exporter
+// name. Exporters of remote_write blocks with tenant_routing are sampled in
+// their tenant routes instead.
+func (c *InstanceConfig) sampledExporters() (map[string]float64, error) {
+	sampled := map[string]float64{}
+	for i, remoteWriteConfig := range c.RemoteWrite {
+		if remoteWriteConfig.TenantRouting != nil || !isSampled(remoteWriteConfig.SamplePercentage) {
+			continue
+		}
+		exporterName, err := getExporterName(i, remoteWriteConfig.Protocol, remoteWriteConfig.Format)
+		if err != nil {
+			return nil, err
+		}
+		sampled[exporterName] = remoteWriteConfig.SamplePercentage
+	}
+	return sampled, nil
+}
+
+func isSampled(percentage float64) bool {
+	return percentage > 0 && percentage < 100
+}
+
+// samplerProcessor returns the name and config of the processor sampling the
+// traces exported by exporterName.
+func samplerProcessor(exporterName string, percentage float64) (string, map[string]interface{}) {
+	return "probabilistic_sampler/" + exporterName, map[string]interface{}{
+		"sampling_percentage": percentage,
+	}
+}
+
+// withoutSideEffects returns the processors which only change the spans they
+// see. Processors which generate metrics or logs from spans must only run in
+// a single pipeline.
+func withoutSideEffects(processorNames []string) []string {
+	res := make([]string, 0, len(processorNames))
+	for _, name := range processorNames {
+		switch name {
+		case "spanmetrics", servicegraphprocessor.TypeStr, automaticloggingprocessor.TypeStr:
+			continue
+		}
+		res = append(res, name)
+	}
+	return res
+}
+
 func getAuthExtensionName(exporterName string) string {
 	return fmt.Sprintf("oauth2client/%s", strings.Replace(exporterName, "/", "", -1))
 }
 
-// builds oauth2clientauth extensions required to support RemoteWriteConfigurations.
+func getHeadersSetterExtensionName(exporterName string) string {
+	return fmt.Sprintf("headers_setter/%s", strings.Replace(exporterName, "/", "", -1))
+}
+
+// headersSetter returns the config of the headers_setter extension setting
+// headers from the client metadata set by the headertemplate exporters.
+func headersSetter(templates headertemplate.Headers) map[string]interface{} {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		headers = append(headers, map[string]interface{}{
+			"key":          name,
+			"from_context": headertemplate.MetadataKey(name),
+			"action":       "upsert",
+		})
+	}
+	return map[string]interface{}{"headers": headers}
+}
+
+// builds oauth2clientauth and headers_setter extensions required to support
+// RemoteWriteConfigurations.
 func (c *InstanceConfig) extensions() (map[string]interface{}, error) {
 	extensions := map[string]interface{}{}
 	for i, remoteWriteConfig := range c.RemoteWrite {
-		if remoteWriteConfig.Oauth2 == nil {
-			continue
-		}
 		exporterName, err := getExporterName(i, remoteWriteConfig.Protocol, remoteWriteConfig.Format)
 		if err != nil {
 			return nil, err
 		}
+		templates, err := remoteWriteConfig.headerTemplates()
+		if err != nil {
+			return nil, err
+		}
+		if len(templates) > 0 {
+			extensions[getHeadersSetterExtensionName(exporterName)] = headersSetter(templates)
+		}
+		if remoteWriteConfig.Oauth2 == nil {
+			continue
+		}
+		if err := remoteWriteConfig.Oauth2.TLS.validate(); err != nil {
+			return nil, fmt.Errorf("oauth2 tls: %w", err)
+		}
 		oauthConfig, err := remoteWriteConfig.Oauth2.toOtelConfig()
 		if err != nil {
 			return nil, err
@@ -576,6 +1593,13 @@ func (c *InstanceConfig) extensions() (map[string]interface{}, error) {
 			extensions[extName] = jrsConfig
 		}
 	}
+	if c.ReceiverBasicAuth != nil {
+		basicAuthConfig, err := c.ReceiverBasicAuth.toOtelConfig()
+		if err != nil {
+			return nil, err
+		}
+		extensions[receiverBasicAuthExtensionName] = basicAuthConfig
+	}
 	return extensions, nil
 }
 
@@ -615,6 +1639,14 @@ func (c *InstanceConfig) loadBalancingExporter() (map[string]interface{}, error)
 	if err != nil {
 		return nil, err
 	}
+	if hc := c.LoadBalancing.HealthCheck; hc != nil {
+		if err := hc.Validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := c.LoadBalancing.Resolver[kubernetesTagName]; ok {
+			return nil, fmt.Errorf("health_check is not supported with the kubernetes resolver")
+		}
+	}
 	return map[string]interface{}{
 		"protocol": map[string]interface{}{
 			"otlp": exporter,
@@ -624,6 +1656,152 @@ func (c *InstanceConfig) loadBalancingExporter() (map[string]interface{}, error)
 	}, nil
 }
 
+// batchConfig returns the batch processor config with the agent-specific
+// disabled key removed, and whether batching has been explicitly disabled.
+func (c *InstanceConfig) batchConfig() (map[string]interface{}, bool, error) {
+	if c.Batch == nil {
+		return nil, false, nil
+	}
+
+	var disabled bool
+	if v, ok := c.Batch[batchDisabledKey]; ok {
+		disabled, ok = v.(bool)
+		if !ok {
+			return nil, false, fmt.Errorf("batch.%s must be a boolean, got %v", batchDisabledKey, v)
+		}
+	}
+
+	batchCfg := make(map[string]interface{}, len(c.Batch))
+	for k, v := range c.Batch {
+		if k == batchDisabledKey {
+			continue
+		}
+		batchCfg[k] = v
+	}
+	return batchCfg, disabled, nil
+}
+
+const (
+	throughputProfileLow    = "low"
+	throughputProfileMedium = "medium"
+	throughputProfileHigh   = "high"
+)
+
+// throughputProfile is the expected throughput of a pipeline, either as the
+// name of a profile or as a number of spans per second. A number of spans
+// per second picks the profile for that throughput.
+type throughputProfile struct {
+	name           string
+	spansPerSecond float64
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (p *throughputProfile) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	switch raw {
+	case throughputProfileLow, throughputProfileMedium, throughputProfileHigh:
+		*p = throughputProfile{name: raw}
+		return nil
+	}
+
+	spansPerSecond, err := strconv.ParseFloat(raw, 64)
+	if err != nil || spansPerSecond <= 0 {
+		return fmt.Errorf("invalid throughput_profile '%s', expected 'low', 'medium', 'high' or a positive number of spans per second", raw)
+	}
+	*p = throughputProfile{spansPerSecond: spansPerSecond}
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (p throughputProfile) MarshalYAML() (interface{}, error) {
+	if p.name != "" {
+		return p.name, nil
+	}
+	return p.spansPerSecond, nil
+}
+
+// profile returns the name of the profile p stands for.
+func (p throughputProfile) profile() string {
+	switch {
+	case p.name != "":
+		return p.name
+	case p.spansPerSecond <= 500:
+		return throughputProfileLow
+	case p.spansPerSecond <= 5000:
+		return throughputProfileMedium
+	default:
+		return throughputProfileHigh
+	}
+}
+
+// batch returns the batch processor config derived from p.
+func (p throughputProfile) batch() map[string]interface{} {
+	switch p.profile() {
+	case throughputProfileLow:
+		return map[string]interface{}{"send_batch_size": 256, "send_batch_max_size": 512, "timeout": "5s"}
+	case throughputProfileMedium:
+		return map[string]interface{}{"send_batch_size": 2048, "send_batch_max_size": 4096, "timeout": "2s"}
+	default:
+		return map[string]interface{}{"send_batch_size": 8192, "send_batch_max_size": 16384, "timeout": "1s"}
+	}
+}
+
+// sendingQueue returns the exporter sending_queue config derived from p.
+func (p throughputProfile) sendingQueue() map[string]interface{} {
+	switch p.profile() {
+	case throughputProfileLow:
+		return map[string]interface{}{"num_consumers": 2, "queue_size": 100}
+	case throughputProfileMedium:
+		return map[string]interface{}{"num_consumers": 5, "queue_size": 1000}
+	default:
+		return map[string]interface{}{"num_consumers": 10, "queue_size": 5000}
+	}
+}
+
+// retryOnFailure returns the exporter retry_on_failure config derived from p.
+// Pipelines with a higher throughput give up on retries sooner, since the
+// spans waiting to be retried take up more memory.
+func (p throughputProfile) retryOnFailure() map[string]interface{} {
+	switch p.profile() {
+	case throughputProfileLow:
+		return map[string]interface{}{"initial_interval": "5s", "max_interval": "30s", "max_elapsed_time": "300s"}
+	case throughputProfileMedium:
+		return map[string]interface{}{"initial_interval": "5s", "max_interval": "30s", "max_elapsed_time": "120s"}
+	default:
+		return map[string]interface{}{"initial_interval": "1s", "max_interval": "10s", "max_elapsed_time": "60s"}
+	}
+}
+
+// withThroughputDefaults returns a copy of c where the absent batch,
+// sending_queue and retry_on_failure blocks are derived from the throughput
+// profile. Explicit blocks are always kept as is.
+func (c *InstanceConfig) withThroughputDefaults() *InstanceConfig {
+	if c.ThroughputProfile == nil {
+		return c
+	}
+	p := *c.ThroughputProfile
+
+	res := *c
+	if res.Batch == nil {
+		res.Batch = p.batch()
+	}
+	res.RemoteWrite = make([]RemoteWriteConfig, len(c.RemoteWrite))
+	for i, rw := range c.RemoteWrite {
+		if rw.SendingQueue == nil {
+			rw.SendingQueue = p.sendingQueue()
+		}
+		if rw.RetryOnFailure == nil {
+			rw.RetryOnFailure = p.retryOnFailure()
+		}
+		res.RemoteWrite[i] = rw
+	}
+	return &res
+}
+
 // formatPolicies creates sampling policies (i.e. rules) compatible with OTel's tail sampling processor
 // https://github.com/open-telemetry/opentelemetry-collector-contrib/tree/v0.87.0/processor/tailsamplingprocessor
 func formatPolicies(cfg []policy) ([]map[string]interface{}, error) {
@@ -657,15 +1835,65 @@ func formatPolicies(cfg []policy) ([]map[string]interface{}, error) {
 
 func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 	otelMapStructure := map[string]interface{}{}
+	c = c.withThroughputDefaults()
 
 	if len(c.Receivers) == 0 {
 		return nil, errors.New("must have at least one configured receiver")
 	}
 
+	if err := c.validateReceivers(); err != nil {
+		return nil, err
+	}
+
+	if err := c.validateGroupByTrace(); err != nil {
+		return nil, err
+	}
+
+	if err := c.validateHandlerEndpoint(); err != nil {
+		return nil, err
+	}
+
+	if c.ReceiverRateLimit != nil {
+		if err := c.ReceiverRateLimit.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.DebugFilter != nil {
+		if err := c.DebugFilter.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.SelfMonitoring != nil {
+		if err := c.SelfMonitoring.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Backpressure != nil {
+		if err := c.Backpressure.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	// copy the receivers so that the internal receivers added below don't
+	// leak into the config, which may be converted again later.
+	receivers := make(map[string]interface{}, len(c.Receivers)+3)
+	for name, cfg := range c.Receivers {
+		if c.ReceiverBasicAuth != nil {
+			var err error
+			if cfg, err = withReceiverAuthenticator(name, cfg, receiverBasicAuthExtensionName); err != nil {
+				return nil, err
+			}
+		}
+		receivers[name] = cfg
+	}
+
 	// add a hacky push receiver for when an integration
 	// wants to push traces directly, e.g. app agent receiver.
 	// it can only accept traces programmatically from inside the agent
-	c.Receivers[pushreceiver.TypeStr] = nil
+	receivers[pushreceiver.TypeStr] = nil
 
 	extensions, err := c.extensions()
 	if err != nil {
@@ -680,10 +1908,34 @@ func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	routes, err := c.tenantRoutes()
+	if err != nil {
+		return nil, err
+	}
+	sampledExporters, err := c.sampledExporters()
+	if err != nil {
+		return nil, err
+	}
+	routedExporters := make(map[string]struct{}, len(routes))
+	for _, route := range routes {
+		routedExporters[route.exporter] = struct{}{}
+	}
 	exportersNames := make([]string, 0, len(exporters))
 	for name := range exporters {
+		if _, ok := routedExporters[name]; ok {
+			continue
+		}
+		if _, ok := sampledExporters[name]; ok {
+			continue
+		}
 		exportersNames = append(exportersNames, name)
 	}
+	if len(sampledExporters) > 0 && len(exportersNames) == 0 && len(routes) == 0 {
+		// The primary pipeline, which runs the processors generating metrics
+		// and logs from spans, needs at least one exporter receiving all
+		// traces.
+		return nil, errors.New("sample_percentage can't be set on every remote_write, at least one remote_write must export all traces")
+	}
 
 	// processors
 	processors := map[string]interface{}{}
@@ -713,8 +1965,20 @@ func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 		processorNames = append(processorNames, "attributes")
 	}
 
-	if c.Batch != nil {
-		processors["batch"] = c.Batch
+	if c.Redact != nil {
+		if err := c.Redact.Validate(); err != nil {
+			return nil, err
+		}
+		processors[redactProcessorName] = c.Redact.processor()
+		processorNames = append(processorNames, redactProcessorName)
+	}
+
+	batchCfg, batchDisabled, err := c.batchConfig()
+	if err != nil {
+		return nil, err
+	}
+	if batchCfg != nil && !batchDisabled {
+		processors["batch"] = batchCfg
 		processorNames = append(processorNames, "batch")
 	}
 
@@ -745,11 +2009,16 @@ func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 			return nil, fmt.Errorf("must specify a prometheus instance or a metrics handler endpoint to export the metrics")
 		}
 
+		dimensions, err := c.SpanMetrics.dimensions()
+		if err != nil {
+			return nil, err
+		}
+
 		processorNames = append(processorNames, "spanmetrics")
 		spanMetrics := map[string]interface{}{
 			"metrics_exporter":          exporterName,
 			"latency_histogram_buckets": c.SpanMetrics.LatencyHistogramBuckets,
-			"dimensions":                c.SpanMetrics.Dimensions,
+			"dimensions":                dimensions,
 		}
 		if c.SpanMetrics.AggregationTemporality != "" {
 			spanMetrics["aggregation_temporality"] = c.SpanMetrics.AggregationTemporality
@@ -770,7 +2039,7 @@ func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 
 	// receivers
 	receiverNames := []string{}
-	for name := range c.Receivers {
+	for name := range receivers {
 		receiverNames = append(receiverNames, name)
 	}
 
@@ -803,6 +2072,18 @@ func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 		}
 	}
 
+	if c.GroupByTrace != nil {
+		groupByTrace := map[string]interface{}{}
+		if c.GroupByTrace.WaitDuration != 0 {
+			groupByTrace["wait_duration"] = c.GroupByTrace.WaitDuration
+		}
+		if c.GroupByTrace.NumTraces != 0 {
+			groupByTrace["num_traces"] = c.GroupByTrace.NumTraces
+		}
+		processors[groupByTraceProcessorName] = groupByTrace
+		processorNames = append(processorNames, groupByTraceProcessorName)
+	}
+
 	if c.LoadBalancing != nil {
 		internalExporter, err := c.loadBalancingExporter()
 		if err != nil {
@@ -814,7 +2095,7 @@ func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 		if c.LoadBalancing.ReceiverPort != "" {
 			receiverPort = c.LoadBalancing.ReceiverPort
 		}
-		c.Receivers["otlp/lb"] = map[string]interface{}{
+		receivers[loadBalancingReceiverName] = map[string]interface{}{
 			"protocols": map[string]interface{}{
 				"grpc": map[string]interface{}{
 					"endpoint": net.JoinHostPort("0.0.0.0", receiverPort),
@@ -824,16 +2105,79 @@ func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 	}
 
 	if c.ServiceGraphs != nil && c.ServiceGraphs.Enabled {
-		processors[servicegraphprocessor.TypeStr] = map[string]interface{}{
+		serviceGraphs := map[string]interface{}{
 			"wait":      c.ServiceGraphs.Wait,
 			"max_items": c.ServiceGraphs.MaxItems,
 		}
+
+		if c.ServiceGraphs.remoteWrite() {
+			// Configure the metrics exporter, with the same names as the
+			// metrics exposed with the metrics of the Agent.
+			namespace := "traces"
+			if len(c.ServiceGraphs.Namespace) != 0 {
+				namespace = fmt.Sprintf("%s_%s", c.ServiceGraphs.Namespace, namespace)
+			}
+			exporters[serviceGraphsExporterName] = map[string]interface{}{
+				"namespace":        namespace,
+				"metrics_instance": c.ServiceGraphs.MetricsInstance,
+			}
+			serviceGraphs["metrics_exporter"] = serviceGraphsExporterName
+
+			pipelines[serviceGraphsPipelineFullName] = map[string]interface{}{
+				"receivers": []string{noopreceiver.TypeStr},
+				"exporters": []string{serviceGraphsExporterName},
+			}
+		} else if len(c.ServiceGraphs.Namespace) != 0 {
+			return nil, errors.New("service_graphs: namespace requires metrics_instance")
+		}
+
+		processors[servicegraphprocessor.TypeStr] = serviceGraphs
 		processorNames = append(processorNames, servicegraphprocessor.TypeStr)
 	}
 
+	extraOrder, err := c.extraProcessorOrder()
+	if err != nil {
+		return nil, err
+	}
+	for name, cfg := range c.ExtraProcessors {
+		processors[name] = cfg
+		processorNames = append(processorNames, name)
+	}
+
 	// Build Pipelines
 	splitPipeline := c.LoadBalancing != nil
-	orderedSplitProcessors := orderProcessors(processorNames, splitPipeline)
+	orderedSplitProcessors := orderProcessorsWithExtra(processorNames, splitPipeline, extraOrder)
+
+	namedPipelines, assignedReceivers, err := c.namedPipelines(orderedSplitProcessors[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(namedPipelines) > 0 {
+		// Named pipelines only share the exporters of the default pipeline.
+		switch {
+		case splitPipeline:
+			return nil, errors.New("pipelines can't be combined with load_balancing")
+		case len(routes) > 0:
+			return nil, errors.New("pipelines can't be combined with tenant_routing")
+		case len(sampledExporters) > 0:
+			return nil, errors.New("pipelines can't be combined with the sample_percentage of remote_write")
+		}
+
+		defaultReceivers := make([]string, 0, len(receiverNames))
+		for _, name := range receiverNames {
+			if _, ok := assignedReceivers[name]; !ok {
+				defaultReceivers = append(defaultReceivers, name)
+			}
+		}
+		receiverNames = defaultReceivers
+	}
+	for _, p := range namedPipelines {
+		pipelines["traces/"+p.name] = map[string]interface{}{
+			"exporters":  exportersNames,
+			"processors": p.processors,
+			"receivers":  p.receivers,
+		}
+	}
 	if splitPipeline {
 		// load balancing pipeline
 		pipelines["traces/0"] = map[string]interface{}{
@@ -842,12 +2186,14 @@ func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 			"exporters":  []string{"loadbalancing"},
 		}
 		// processing pipeline
-		pipelines["traces/1"] = map[string]interface{}{
-			"exporters":  exportersNames,
-			"processors": orderedSplitProcessors[1],
-			"receivers":  []string{"otlp/lb"},
+		if len(exportersNames) > 0 || len(sampledExporters) == 0 {
+			pipelines["traces/1"] = map[string]interface{}{
+				"exporters":  exportersNames,
+				"processors": orderedSplitProcessors[1],
+				"receivers":  []string{loadBalancingReceiverName},
+			}
 		}
-	} else {
+	} else if len(exportersNames) > 0 || (len(routes) == 0 && len(sampledExporters) == 0) {
 		pipelines["traces"] = map[string]interface{}{
 			"exporters":  exportersNames,
 			"processors": orderedSplitProcessors[0],
@@ -855,18 +2201,67 @@ func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 		}
 	}
 
-	if c.SpanMetrics != nil {
+	// tenant routing pipelines, which drop the spans of other tenants before
+	// any other processor sees them
+	for _, route := range routes {
+		routeProcessors := orderedSplitProcessors[0]
+		if isSampled(route.samplePercentage) {
+			samplerName, samplerCfg := samplerProcessor(route.exporter, route.samplePercentage)
+			if _, ok := processors[samplerName]; ok {
+				return nil, fmt.Errorf("processor %q conflicts with the sampling of exporter %q", samplerName, route.exporter)
+			}
+			processors[samplerName] = samplerCfg
+			routeProcessors = append([]string{samplerName}, routeProcessors...)
+		}
+		if len(route.conditions) > 0 {
+			filterName := "filter/" + route.exporter
+			if _, ok := processors[filterName]; ok {
+				return nil, fmt.Errorf("processor %q conflicts with the tenant routing of exporter %q", filterName, route.exporter)
+			}
+			processors[filterName] = map[string]interface{}{
+				"error_mode": "ignore",
+				"traces": map[string]interface{}{
+					"span": route.conditions,
+				},
+			}
+			routeProcessors = append([]string{filterName}, routeProcessors...)
+		}
+		pipelines["traces/"+route.exporter] = map[string]interface{}{
+			"exporters":  []string{route.exporter},
+			"processors": routeProcessors,
+			"receivers":  receiverNames,
+		}
+	}
+
+	// sampled pipelines, which export a share of the traces to a single
+	// backend while the other backends get all of them
+	for exporterName, percentage := range sampledExporters {
+		sampledReceivers, sampledProcessors := receiverNames, orderedSplitProcessors[0]
+		if splitPipeline {
+			sampledReceivers, sampledProcessors = []string{loadBalancingReceiverName}, orderedSplitProcessors[1]
+		}
+		samplerName, samplerCfg := samplerProcessor(exporterName, percentage)
+		if _, ok := processors[samplerName]; ok {
+			return nil, fmt.Errorf("processor %q conflicts with the sampling of exporter %q", samplerName, exporterName)
+		}
+		processors[samplerName] = samplerCfg
+		pipelines["traces/"+exporterName] = map[string]interface{}{
+			"exporters":  []string{exporterName},
+			"processors": append([]string{samplerName}, withoutSideEffects(sampledProcessors)...),
+			"receivers":  sampledReceivers,
+		}
+	}
+
+	if c.SpanMetrics != nil || c.ServiceGraphs.remoteWrite() {
 		// Insert a noop receiver in the metrics pipeline.
 		// Added to pass validation requiring at least one receiver in a pipeline.
-		c.Receivers[noopreceiver.TypeStr] = nil
+		receivers[noopreceiver.TypeStr] = nil
 	}
 
-	receiversMap := map[string]interface{}(c.Receivers)
-
 	otelMapStructure["extensions"] = extensions
 	otelMapStructure["exporters"] = exporters
 	otelMapStructure["processors"] = processors
-	otelMapStructure["receivers"] = receiversMap
+	otelMapStructure["receivers"] = receivers
 
 	// pipelines
 	serviceMap := map[string]interface{}{
@@ -889,12 +2284,318 @@ func (c *InstanceConfig) otelConfig() (*otelcol.Config, error) {
 	return otelcolConfigFromStringMap(otelMapStructure, &factories)
 }
 
+// redactedConfigKeys are the keys of the effective OTel config whose values
+// are always redacted.
+var redactedConfigKeys = map[string]struct{}{
+	"client_secret": {},
+	"inline":        {},
+	"password":      {},
+	"bearer_token":  {},
+	"key_pem":       {},
+}
+
+// effectiveConfig returns the OTel config generated from c, including the
+// defaults of each component. All header values and the values of
+// redactedConfigKeys are redacted.
+func (c *InstanceConfig) effectiveConfig() (map[string]interface{}, error) {
+	otelCfg, err := c.otelConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conf := confmap.New()
+	if err := conf.Marshal(otelCfg); err != nil {
+		return nil, fmt.Errorf("failed to marshal OTel config: %w", err)
+	}
+	res := conf.ToStringMap()
+	redactSecrets(res)
+	return res, nil
+}
+
+// redactSecrets replaces secret values found in v in place.
+func redactSecrets(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if key == "headers" {
+				if headers, ok := val.(map[string]interface{}); ok {
+					for name := range headers {
+						headers[name] = secretMarshalString
+					}
+				}
+				continue
+			}
+			if _, ok := redactedConfigKeys[key]; ok {
+				if val != nil && val != "" {
+					v[key] = secretMarshalString
+				}
+				continue
+			}
+			redactSecrets(val)
+		}
+	case []interface{}:
+		for _, val := range v {
+			redactSecrets(val)
+		}
+	}
+}
+
+// validateReceivers decodes each configured receiver into its factory's
+// config and validates it. Receivers are an opaque map, so without this
+// mistakes in them are only found once the pipeline starts.
+func (c *InstanceConfig) validateReceivers() error {
+	_, err := c.receiverConfigs()
+	return err
+}
+
+// receiverConfigs returns the validated config of each receiver, including
+// the defaults of the receiver.
+func (c *InstanceConfig) receiverConfigs() (map[string]component.Config, error) {
+	factories, err := tracingFactories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create factories: %w", err)
+	}
+
+	names := make([]string, 0, len(c.Receivers))
+	for name := range c.Receivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cfgs := make(map[string]component.Config, len(names))
+	for _, name := range names {
+		var id component.ID
+		if err := id.UnmarshalText([]byte(name)); err != nil {
+			return nil, fmt.Errorf("invalid receiver name %q: %w", name, err)
+		}
+		factory, ok := factories.Receivers[id.Type()]
+		if !ok {
+			return nil, fmt.Errorf("receiver %q: unknown receiver type %q, supported types are: %s",
+				name, id.Type(), strings.Join(supportedReceiverTypes(factories), ", "))
+		}
+
+		cfg := factory.CreateDefaultConfig()
+		if raw := c.Receivers[name]; raw != nil {
+			conf, err := confmap.NewFromStringMap(map[string]interface{}{name: raw}).Sub(name)
+			if err != nil {
+				return nil, fmt.Errorf("receiver %q: %w", name, err)
+			}
+			if err := component.UnmarshalConfig(conf, cfg); err != nil {
+				return nil, fmt.Errorf("receiver %q: %w", name, err)
+			}
+		}
+		if err := component.ValidateConfig(cfg); err != nil {
+			return nil, fmt.Errorf("receiver %q: %w", name, err)
+		}
+		cfgs[name] = cfg
+	}
+	return cfgs, nil
+}
+
+// supportedReceiverTypes returns the sorted types of the receivers which
+// can be configured.
+func supportedReceiverTypes(factories otelcol.Factories) []string {
+	types := make([]string, 0, len(factories.Receivers))
+	for typ := range factories.Receivers {
+		types = append(types, string(typ))
+	}
+	sort.Strings(types)
+	return types
+}
+
+// withReceiverRateLimit wraps the receiver factories so that the receivers
+// they create apply the receiver rate limit, if any.
+func (c *InstanceConfig) withReceiverRateLimit(factories otelcol.Factories) otelcol.Factories {
+	if c.ReceiverRateLimit == nil {
+		return factories
+	}
+
+	// Spans load balanced by other agents were already limited by them.
+	limiter := receiverratelimit.New(*c.ReceiverRateLimit, loadBalancingReceiverName)
+	return wrapReceivers(factories, func(f receiver.Factory) receiver.Factory {
+		return receiverratelimit.NewFactory(f, limiter)
+	})
+}
+
+// withDebugFilter wraps the receiver factories so that the receivers they
+// create apply the rules of filter.
+func withDebugFilter(factories otelcol.Factories, filter *debugfilter.Filter) otelcol.Factories {
+	return wrapReceivers(factories, func(f receiver.Factory) receiver.Factory {
+		return debugfilter.NewFactory(f, filter)
+	})
+}
+
+// withBackpressure wraps the receiver factories so that the receivers they
+// create reject spans while a sending queue sampled by m is saturated. The
+// factories are returned unchanged if m is nil.
+func withBackpressure(factories otelcol.Factories, m *backpressure.Monitor) otelcol.Factories {
+	if m == nil {
+		return factories
+	}
+
+	return wrapReceivers(factories, func(f receiver.Factory) receiver.Factory {
+		return backpressure.NewFactory(f, m)
+	})
+}
+
+// withExporterLimits wraps the exporter factories so that exporters of
+// remote_write blocks with max_concurrent_requests send at most that many
+// requests at once.
+func (c *InstanceConfig) withExporterLimits(factories otelcol.Factories) (otelcol.Factories, error) {
+	limits := map[string]int{}
+	for i, remoteWriteConfig := range c.RemoteWrite {
+		if remoteWriteConfig.MaxConcurrentRequests <= 0 {
+			continue
+		}
+		exporterName, err := getExporterName(i, remoteWriteConfig.Protocol, remoteWriteConfig.Format)
+		if err != nil {
+			return otelcol.Factories{}, err
+		}
+		limits[exporterName] = remoteWriteConfig.MaxConcurrentRequests
+		if remoteWriteConfig.TenantRouting != nil {
+			for _, route := range remoteWriteConfig.TenantRouting.routes(exporterName) {
+				limits[route.exporter] = remoteWriteConfig.MaxConcurrentRequests
+			}
+		}
+	}
+	if len(limits) == 0 {
+		return factories, nil
+	}
+
+	limited := map[component.Type]bool{}
+	for name := range limits {
+		typ, _, _ := strings.Cut(name, "/")
+		limited[component.Type(typ)] = true
+	}
+	return wrapExporters(factories, func(typ component.Type, f otelexporter.Factory) otelexporter.Factory {
+		if !limited[typ] {
+			return f
+		}
+		return exporterlimit.NewFactory(f, limits)
+	}), nil
+}
+
+// withHealthCheck wraps the load balancing exporter factory so that its
+// exporters only send spans to the backends hc reports as healthy, if the
+// backends are health checked.
+func withHealthCheck(factories otelcol.Factories, hc *backendHealthChecker) otelcol.Factories {
+	if hc == nil {
+		return factories
+	}
+
+	return wrapExporters(factories, func(typ component.Type, f otelexporter.Factory) otelexporter.Factory {
+		if typ != "loadbalancing" {
+			return f
+		}
+		return hc.exporterFactory(f)
+	})
+}
+
+// withSelfMonitoring wraps the exporter factories so that exporters remove
+// the synthetic traces of self monitoring and record their latency, and the
+// factories of the processors which generate metrics or logs from spans so
+// that synthetic spans bypass them, if self monitoring is enabled.
+//
+// The loadbalancing exporter isn't wrapped: it forwards synthetic spans to
+// the agents which receive them, whose exporters measure them.
+func (c *InstanceConfig) withSelfMonitoring(factories otelcol.Factories) otelcol.Factories {
+	if c.SelfMonitoring == nil || !c.SelfMonitoring.Enabled {
+		return factories
+	}
+
+	factories = wrapExporters(factories, func(typ component.Type, f otelexporter.Factory) otelexporter.Factory {
+		if typ == "loadbalancing" {
+			return f
+		}
+		return selfmonitor.NewFactory(f)
+	})
+
+	processors := make(map[component.Type]otelprocessor.Factory, len(factories.Processors))
+	for typ, factory := range factories.Processors {
+		switch typ {
+		case "spanmetrics", servicegraphprocessor.TypeStr, automaticloggingprocessor.TypeStr:
+			processors[typ] = selfmonitor.NewProcessorFactory(factory)
+		default:
+			processors[typ] = factory
+		}
+	}
+	factories.Processors = processors
+	return factories
+}
+
+// withHeaderTemplates wraps the otlphttp exporter factory so that exporters
+// of remote_write blocks with headers referencing resource attributes export
+// the rendered headers as client metadata, which the headers_setter extension
+// sets on requests.
+func (c *InstanceConfig) withHeaderTemplates(factories otelcol.Factories) (otelcol.Factories, error) {
+	headers := map[string]headertemplate.Headers{}
+	for i, remoteWriteConfig := range c.RemoteWrite {
+		templates, err := remoteWriteConfig.headerTemplates()
+		if err != nil {
+			return otelcol.Factories{}, err
+		}
+		if len(templates) == 0 {
+			continue
+		}
+		exporterName, err := getExporterName(i, remoteWriteConfig.Protocol, remoteWriteConfig.Format)
+		if err != nil {
+			return otelcol.Factories{}, err
+		}
+		headers[exporterName] = templates
+		if remoteWriteConfig.TenantRouting != nil {
+			for _, route := range remoteWriteConfig.TenantRouting.routes(exporterName) {
+				headers[route.exporter] = templates
+			}
+		}
+	}
+	if len(headers) == 0 {
+		return factories, nil
+	}
+
+	return wrapExporters(factories, func(typ component.Type, f otelexporter.Factory) otelexporter.Factory {
+		if typ != "otlphttp" {
+			return f
+		}
+		return headertemplate.NewFactory(f, headers)
+	}), nil
+}
+
+// wrapReceivers returns factories with each receiver factory replaced by the
+// factory returned by wrap. The push receiver factory is kept as is: it's
+// looked up by integrations, which expect its concrete type.
+func wrapReceivers(factories otelcol.Factories, wrap func(receiver.Factory) receiver.Factory) otelcol.Factories {
+	receivers := make(map[component.Type]receiver.Factory, len(factories.Receivers))
+	for typ, factory := range factories.Receivers {
+		if typ == pushreceiver.TypeStr {
+			receivers[typ] = factory
+			continue
+		}
+		receivers[typ] = wrap(factory)
+	}
+	factories.Receivers = receivers
+	return factories
+}
+
+// wrapExporters returns factories with each exporter factory replaced by the
+// factory returned by wrap for its type. The exporter factories map is copied,
+// so the map of the given factories is left untouched.
+func wrapExporters(factories otelcol.Factories, wrap func(component.Type, otelexporter.Factory) otelexporter.Factory) otelcol.Factories {
+	exporters := make(map[component.Type]otelexporter.Factory, len(factories.Exporters))
+	for typ, factory := range factories.Exporters {
+		exporters[typ] = wrap(typ, factory)
+	}
+	factories.Exporters = exporters
+	return factories
+}
+
 // tracingFactories() only creates the needed factories.  if we decide to add support for a new
 // processor, exporter, receiver we need to add it here
 func tracingFactories() (otelcol.Factories, error) {
 	extensions, err := extension.MakeFactoryMap(
 		oauth2clientauthextension.NewFactory(),
 		jaegerremotesampling.NewFactory(),
+		basicauthextension.NewFactory(),
+		headerssetterextension.NewFactory(),
 	)
 	if err != nil {
 		return otelcol.Factories{}, err
@@ -931,7 +2632,12 @@ func tracingFactories() (otelcol.Factories, error) {
 		spanmetricsprocessor.NewFactory(),
 		automaticloggingprocessor.NewFactory(),
 		tailsamplingprocessor.NewFactory(),
+		groupbytraceprocessor.NewFactory(),
 		servicegraphprocessor.NewFactory(),
+		// Used by the sample_percentage of remote_write.
+		probabilisticsamplerprocessor.NewFactory(),
+		// Used by tenant routing.
+		filterprocessor.NewFactory(),
 	)
 	if err != nil {
 		return otelcol.Factories{}, err
@@ -945,26 +2651,166 @@ func tracingFactories() (otelcol.Factories, error) {
 	}, nil
 }
 
+// builtinProcessorNames are the names of the processors generated from the
+// dedicated settings of InstanceConfig. Extra processors can't use them.
+var builtinProcessorNames = map[string]struct{}{
+	promsdprocessor.TypeStr:           {},
+	automaticloggingprocessor.TypeStr: {},
+	"attributes":                      {},
+	redactProcessorName:               {},
+	"batch":                           {},
+	"spanmetrics":                     {},
+	"tail_sampling":                   {},
+	groupByTraceProcessorName:         {},
+	servicegraphprocessor.TypeStr:     {},
+}
+
+// extraProcessorOrder validates the extra processors and returns their
+// position in the pipeline, on the same scale as processorOrder.
+//
+// Extra processors listed between two built-in processors in
+// ExtraProcessorOrder are spread evenly between them. Extra processors listed
+// before the first or after the last built-in processor are placed before or
+// after it.
+func (c *InstanceConfig) extraProcessorOrder() (map[string]float64, error) {
+	if err := c.validateExtraProcessors(); err != nil {
+		return nil, err
+	}
+
+	var (
+		order   = make(map[string]float64, len(c.ExtraProcessors))
+		prev    = math.Inf(-1) // position of the previous listed built-in processor
+		pending []string       // extra processors listed since prev
+	)
+	place := func(next float64) {
+		lower, upper := prev, next
+		switch {
+		case math.IsInf(lower, -1) && math.IsInf(upper, 1):
+			lower, upper = 0, 1
+		case math.IsInf(lower, -1):
+			lower = upper - 1
+		case math.IsInf(upper, 1):
+			upper = lower + 1
+		}
+		for i, name := range pending {
+			order[name] = lower + (upper-lower)*float64(i+1)/float64(len(pending)+1)
+		}
+		pending = pending[:0]
+	}
+
+	for _, name := range c.ExtraProcessorOrder {
+		if _, ok := c.ExtraProcessors[name]; ok {
+			pending = append(pending, name)
+			continue
+		}
+		pos, ok := processorOrder[name]
+		if !ok {
+			return nil, fmt.Errorf("extra_processor_order: unknown processor %q", name)
+		}
+		if pos <= prev {
+			return nil, fmt.Errorf("extra_processor_order: built-in processor %q is not listed in pipeline order", name)
+		}
+		place(pos)
+		prev = pos
+	}
+	place(math.Inf(1))
+
+	return order, nil
+}
+
+// validateExtraProcessors checks that each extra processor is listed exactly
+// once in ExtraProcessorOrder, doesn't use the name of a built-in processor,
+// and has a valid config for its factory.
+func (c *InstanceConfig) validateExtraProcessors() error {
+	listed := make(map[string]struct{}, len(c.ExtraProcessorOrder))
+	for _, name := range c.ExtraProcessorOrder {
+		if _, ok := listed[name]; ok {
+			return fmt.Errorf("extra_processor_order: processor %q is listed more than once", name)
+		}
+		listed[name] = struct{}{}
+	}
+
+	factories, err := tracingFactories()
+	if err != nil {
+		return fmt.Errorf("failed to create factories: %w", err)
+	}
+
+	names := make([]string, 0, len(c.ExtraProcessors))
+	for name := range c.ExtraProcessors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := builtinProcessorNames[name]; ok {
+			return fmt.Errorf("extra processor %q conflicts with a built-in processor", name)
+		}
+		if _, ok := listed[name]; !ok {
+			return fmt.Errorf("extra processor %q must be listed in extra_processor_order", name)
+		}
+
+		var id component.ID
+		if err := id.UnmarshalText([]byte(name)); err != nil {
+			return fmt.Errorf("invalid extra processor name %q: %w", name, err)
+		}
+		factory, ok := factories.Processors[id.Type()]
+		if !ok {
+			return fmt.Errorf("extra processor %q: unknown processor type %q", name, id.Type())
+		}
+
+		cfg := factory.CreateDefaultConfig()
+		if raw := c.ExtraProcessors[name]; raw != nil {
+			conf, err := confmap.NewFromStringMap(map[string]interface{}{name: raw}).Sub(name)
+			if err != nil {
+				return fmt.Errorf("extra processor %q: %w", name, err)
+			}
+			if err := component.UnmarshalConfig(conf, cfg); err != nil {
+				return fmt.Errorf("extra processor %q: %w", name, err)
+			}
+		}
+		if err := component.ValidateConfig(cfg); err != nil {
+			return fmt.Errorf("extra processor %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// processorOrder is the preferred order of the built-in processors in a
+// tracing pipeline.
+var processorOrder = map[string]float64{
+	// Redaction must run before any other processor so that none of
+	// them see the redacted values.
+	redactProcessorName: -1,
+	"attributes":        0,
+	// Spanmetrics should be before tail_sampling so that
+	// metrics are generated using as many spans as possible.
+	"spanmetrics":       1,
+	"service_graphs":    2,
+	"groupbytrace":      2.5, // Right before tail_sampling, so that it decides on whole traces.
+	"tail_sampling":     3,
+	"automatic_logging": 4,
+	"batch":             5,
+}
+
 // orders the passed processors into their preferred order in a tracing pipeline. pass
 // true to splitPipelines if this function should split the input pipelines into two
 // sets: before and after load balancing
 func orderProcessors(processors []string, splitPipelines bool) [][]string {
-	order := map[string]int{
-		"attributes": 0,
-		// Spanmetrics should be before tail_sampling so that
-		// metrics are generated using as many spans as possible.
-		"spanmetrics":       1,
-		"service_graphs":    2,
-		"tail_sampling":     3,
-		"automatic_logging": 4,
-		"batch":             5,
-	}
-
-	sort.Slice(processors, func(i, j int) bool {
-		iVal := order[processors[i]]
-		jVal := order[processors[j]]
-
-		return iVal < jVal
+	return orderProcessorsWithExtra(processors, splitPipelines, nil)
+}
+
+// orderProcessorsWithExtra behaves like orderProcessors, using extraOrder as
+// the position of processors which aren't built-in.
+func orderProcessorsWithExtra(processors []string, splitPipelines bool, extraOrder map[string]float64) [][]string {
+	order := func(processor string) float64 {
+		if pos, ok := extraOrder[processor]; ok {
+			return pos
+		}
+		return processorOrder[processor]
+	}
+
+	sort.SliceStable(processors, func(i, j int) bool {
+		return order(processors[i]) < order(processors[j])
 	})
 
 	if !splitPipelines {
@@ -978,6 +2824,7 @@ func orderProcessors(processors []string, splitPipelines bool) [][]string {
 	foundAt := len(processors)
 	for i, processor := range processors {
 		if processor == "batch" ||
+			processor == groupByTraceProcessorName ||
 			processor == "tail_sampling" ||
 			processor == "automatic_logging" ||
 			processor == "spanmetrics" ||
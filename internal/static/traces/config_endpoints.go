@@ -0,0 +1,128 @@
+package traces
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/collector/confmap"
+)
+
+// udpProtocols are the receiver protocols listening on UDP, whose endpoints
+// can share a port with the TCP handler endpoint of spanmetrics.
+var udpProtocols = map[string]struct{}{
+	"thrift_compact": {},
+	"thrift_binary":  {},
+}
+
+// validateHandlerEndpoint returns an error if the spanmetrics handler
+// endpoint uses the port of a receiver or of an agent server, which
+// otherwise only fails with a bind error once the pipeline starts.
+func (c *InstanceConfig) validateHandlerEndpoint() error {
+	if c.SpanMetrics == nil || c.SpanMetrics.HandlerEndpoint == "" {
+		return nil
+	}
+	handler := c.SpanMetrics.HandlerEndpoint
+
+	names := make([]string, 0, len(c.listenAddresses))
+	for name := range c.listenAddresses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if addr := c.listenAddresses[name]; endpointsCollide(handler, addr) {
+			return fmt.Errorf("spanmetrics: handler_endpoint %q uses the same port as the agent %s listening on %q", handler, name, addr)
+		}
+	}
+
+	receivers, err := c.receiverConfigs()
+	if err != nil {
+		return err
+	}
+	names = names[:0]
+	for name := range receivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		conf := confmap.New()
+		if err := conf.Marshal(receivers[name]); err != nil {
+			return fmt.Errorf("receiver %q: %w", name, err)
+		}
+		for _, ep := range receiverEndpoints(nil, conf.ToStringMap()) {
+			if endpointsCollide(handler, ep.addr) {
+				return fmt.Errorf("spanmetrics: handler_endpoint %q uses the same port as receiver %q listening on %q (%s)", handler, name, ep.addr, ep.path)
+			}
+		}
+	}
+	return nil
+}
+
+// receiverEndpoint is a TCP endpoint found in a receiver config.
+type receiverEndpoint struct {
+	path string // Path of the endpoint in the receiver config.
+	addr string
+}
+
+// receiverEndpoints returns the TCP endpoints found in cfg, a marshaled
+// receiver config, sorted by path.
+func receiverEndpoints(path []string, cfg map[string]interface{}) []receiverEndpoint {
+	keys := make([]string, 0, len(cfg))
+	for key := range cfg {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var res []receiverEndpoint
+	for _, key := range keys {
+		if _, udp := udpProtocols[key]; udp {
+			continue
+		}
+		keyPath := append(path[:len(path):len(path)], key)
+		switch v := cfg[key].(type) {
+		case string:
+			if key == "endpoint" && v != "" {
+				res = append(res, receiverEndpoint{path: strings.Join(keyPath, "."), addr: v})
+			}
+		case map[string]interface{}:
+			res = append(res, receiverEndpoints(keyPath, v)...)
+		}
+	}
+	return res
+}
+
+// endpointsCollide returns true if listening on a and b would use the same
+// port on at least one interface. Endpoints which can't be parsed, or which
+// pick a random port, never collide.
+func endpointsCollide(a, b string) bool {
+	hostA, portA, err := net.SplitHostPort(a)
+	if err != nil {
+		return false
+	}
+	hostB, portB, err := net.SplitHostPort(b)
+	if err != nil {
+		return false
+	}
+	if portA != portB || portA == "0" {
+		return false
+	}
+	hostA, hostB = normalizeListenHost(hostA), normalizeListenHost(hostB)
+	return hostA == "" || hostB == "" || hostA == hostB
+}
+
+// normalizeListenHost returns host as an IP address when possible, or an
+// empty string if it listens on all interfaces.
+func normalizeListenHost(host string) string {
+	if host == "localhost" {
+		return "127.0.0.1"
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip.IsUnspecified() {
+		return ""
+	}
+	return ip.String()
+}
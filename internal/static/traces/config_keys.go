@@ -0,0 +1,99 @@
+package traces
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// instanceConfigKeys holds the YAML keys of InstanceConfig.
+var instanceConfigKeys = yamlKeys(reflect.TypeOf(InstanceConfig{}))
+
+// UnmarshalYAML implements yaml.Unmarshaler. Unknown keys are rejected even
+// when the config isn't decoded strictly, since a misspelled block silently
+// disables the feature it configures. The contents of blocks such as
+// receivers are left to the decoding mode of the caller.
+func (c *InstanceConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var keys yaml.MapSlice
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	for _, item := range keys {
+		key, ok := item.Key.(string)
+		if !ok {
+			return fmt.Errorf("invalid key %v in traces config", item.Key)
+		}
+		if err := checkKnownKey(key, instanceConfigKeys); err != nil {
+			return fmt.Errorf("invalid traces config: %w", err)
+		}
+	}
+
+	type plain InstanceConfig
+	return unmarshal((*plain)(c))
+}
+
+// checkKnownKey returns an error suggesting the closest known key when key
+// isn't one of known.
+func checkKnownKey(key string, known []string) error {
+	var (
+		closest  string
+		distance = -1
+	)
+	for _, k := range known {
+		if k == key {
+			return nil
+		}
+		if d := editDistance(key, k); distance < 0 || d < distance {
+			closest, distance = k, d
+		}
+	}
+
+	// Only suggest keys which are a few edits away, relative to their length.
+	if distance >= 0 && distance <= max(2, len(closest)/3) {
+		return fmt.Errorf("unknown key %q, did you mean %q?", key, closest)
+	}
+	return fmt.Errorf("unknown key %q", key)
+}
+
+// yamlKeys returns the keys of the YAML fields of the struct type t.
+func yamlKeys(t reflect.Type) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = strings.ToLower(field.Name)
+		}
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,118 @@
+package traces
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/agent/internal/static/traces/servicegraphprocessor"
+)
+
+// pipelineConfig defines a named traces pipeline. It shares the exporters
+// and processors of the default pipeline, except for the processors it skips.
+type pipelineConfig struct {
+	Name string `yaml:"name"`
+	// SkipProcessors are processors of the default pipeline, such as
+	// tail_sampling, which the pipeline doesn't run.
+	SkipProcessors []string `yaml:"skip_processors,omitempty"`
+}
+
+// receiverPipelineConfig assigns a receiver to a named pipeline.
+type receiverPipelineConfig struct {
+	Receiver string `yaml:"receiver"`
+	Pipeline string `yaml:"pipeline"`
+}
+
+// namedPipeline is a named pipeline along with the receivers assigned to it.
+type namedPipeline struct {
+	name       string
+	receivers  []string
+	processors []string
+}
+
+// namedPipelines returns the named pipelines, along with the receivers
+// assigned to them, by receiver name. processorNames are the processors of
+// the default pipeline, in their order. An error is returned if a receiver is
+// assigned to an undefined pipeline.
+func (c *InstanceConfig) namedPipelines(processorNames []string) ([]namedPipeline, map[string]struct{}, error) {
+	if len(c.Pipelines) == 0 && len(c.ReceiverPipelines) == 0 {
+		return nil, nil, nil
+	}
+
+	configured := make(map[string]struct{}, len(processorNames))
+	for _, name := range processorNames {
+		configured[name] = struct{}{}
+	}
+
+	byName := make(map[string]*namedPipeline, len(c.Pipelines))
+	for _, p := range c.Pipelines {
+		switch {
+		case p.Name == "":
+			return nil, nil, fmt.Errorf("pipelines: name is required")
+		case strings.Contains(p.Name, "/"):
+			return nil, nil, fmt.Errorf("pipelines: name %q must not contain a slash", p.Name)
+		}
+		if _, ok := byName[p.Name]; ok {
+			return nil, nil, fmt.Errorf("pipelines: pipeline %q is defined more than once", p.Name)
+		}
+
+		skipped := make(map[string]struct{}, len(p.SkipProcessors))
+		for _, name := range p.SkipProcessors {
+			if _, ok := configured[name]; !ok {
+				return nil, nil, fmt.Errorf("pipelines: pipeline %q skips processor %q, which isn't configured", p.Name, name)
+			}
+			skipped[name] = struct{}{}
+		}
+		processors := make([]string, 0, len(processorNames))
+		for _, name := range processorNames {
+			if _, ok := skipped[name]; ok {
+				continue
+			}
+			// Each pipeline runs its own instance of the processors, so
+			// processors which keep state across spans would see only
+			// part of the traces, or report duplicate metrics.
+			if isStatefulProcessor(name) {
+				return nil, nil, fmt.Errorf("pipelines: pipeline %q must skip processor %q, which can't be shared between pipelines", p.Name, name)
+			}
+			processors = append(processors, name)
+		}
+		byName[p.Name] = &namedPipeline{name: p.Name, processors: processors}
+	}
+
+	assigned := make(map[string]struct{}, len(c.ReceiverPipelines))
+	for _, rp := range c.ReceiverPipelines {
+		if _, ok := c.Receivers[rp.Receiver]; !ok {
+			return nil, nil, fmt.Errorf("receiver_pipelines: receiver %q isn't configured", rp.Receiver)
+		}
+		if _, ok := assigned[rp.Receiver]; ok {
+			return nil, nil, fmt.Errorf("receiver_pipelines: receiver %q is assigned more than once", rp.Receiver)
+		}
+		p, ok := byName[rp.Pipeline]
+		if !ok {
+			return nil, nil, fmt.Errorf("receiver_pipelines: receiver %q is assigned to undefined pipeline %q", rp.Receiver, rp.Pipeline)
+		}
+		p.receivers = append(p.receivers, rp.Receiver)
+		assigned[rp.Receiver] = struct{}{}
+	}
+
+	res := make([]namedPipeline, 0, len(byName))
+	for _, p := range byName {
+		if len(p.receivers) == 0 {
+			return nil, nil, fmt.Errorf("pipelines: no receiver is assigned to pipeline %q", p.name)
+		}
+		res = append(res, *p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].name < res[j].name })
+	return res, assigned, nil
+}
+
+// isStatefulProcessor returns whether the processor keeps state across the
+// spans of a pipeline, such as the spans of a trace or the metrics generated
+// from spans.
+func isStatefulProcessor(name string) bool {
+	switch name {
+	case "spanmetrics", servicegraphprocessor.TypeStr, "tail_sampling", groupByTraceProcessorName:
+		return true
+	}
+	return false
+}
@@ -1,16 +1,36 @@
 package traces
 
 import (
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/grafana/agent/internal/static/traces/pushreceiver"
+	"github.com/grafana/river/diag"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/attributesprocessor"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/spanmetricsprocessor"
+	prom_config "github.com/prometheus/common/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/confmap"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumertest"
 	"go.opentelemetry.io/collector/otelcol"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/processor/processortest"
 	"gopkg.in/yaml.v2"
 )
 
@@ -364,6 +384,131 @@ service:
   extensions: ["jaegerremotesampling/0", "jaegerremotesampling/1"]
 `,
 		},
+		{
+			name: "receiver basic auth",
+			cfg: `
+receivers:
+  otlp:
+    protocols:
+      grpc:
+      http:
+receiver_basic_auth:
+  username: test
+  password_file: ` + passwordFile.Name() + `
+remote_write:
+  - endpoint: example.com:12345
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  otlp:
+    protocols:
+      grpc:
+        include_metadata: true
+      http:
+        include_metadata: true
+        auth:
+          authenticator: basicauth/receiver
+exporters:
+  otlp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors: {}
+extensions:
+  basicauth/receiver:
+    htpasswd:
+      inline: test:password_in_file
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/0"]
+      processors: []
+      receivers: ["push_receiver", "otlp"]
+  extensions: ["basicauth/receiver"]
+`,
+		},
+		{
+			name: "receiver basic auth multiple receivers",
+			cfg: `
+receivers:
+  otlp:
+    protocols:
+      http:
+  otlp/custom:
+    protocols:
+      http:
+        auth:
+          authenticator: basicauth/custom
+  jaeger:
+    protocols:
+      grpc:
+      thrift_http:
+  zipkin:
+receiver_basic_auth:
+  htpasswd_file: /etc/agent/.htpasswd
+remote_write:
+  - endpoint: example.com:12345
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  otlp:
+    protocols:
+      http:
+        include_metadata: true
+        auth:
+          authenticator: basicauth/receiver
+  otlp/custom:
+    protocols:
+      http:
+        include_metadata: true
+        auth:
+          authenticator: basicauth/custom
+  jaeger:
+    protocols:
+      grpc:
+      thrift_http:
+        auth:
+          authenticator: basicauth/receiver
+  zipkin:
+    auth:
+      authenticator: basicauth/receiver
+exporters:
+  otlp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors: {}
+extensions:
+  basicauth/receiver:
+    htpasswd:
+      file: /etc/agent/.htpasswd
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/0"]
+      processors: []
+      receivers: ["push_receiver", "otlp", "otlp/custom", "jaeger", "zipkin"]
+  extensions: ["basicauth/receiver"]
+`,
+		},
+		{
+			name: "receiver basic auth without credentials",
+			cfg: `
+receivers:
+  otlp:
+    protocols:
+      http:
+receiver_basic_auth:
+  username: test
+remote_write:
+  - endpoint: example.com:12345
+`,
+			expectedError: true,
+		},
 		{
 			name: "push_config and remote_write",
 			cfg: `
@@ -577,6 +722,65 @@ processors:
     aggregation_temporality: AGGREGATION_TEMPORALITY_DELTA
     metrics_flush_interval: 20s
 extensions: {}
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/0"]
+      processors: ["spanmetrics"]
+      receivers: ["push_receiver", "jaeger"]
+    metrics/spanmetrics:
+      exporters: ["remote_write"]
+      receivers: ["noop"]
+`,
+		},
+		{
+			name: "span metrics resource dimensions",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+spanmetrics:
+  dimensions:
+    - name: http.method
+    - name: service.namespace
+      default: none
+  resource_dimensions:
+    - name: service.namespace
+    - name: k8s.cluster.name
+      default: unknown
+    - name: k8s.cluster.name
+  metrics_instance: traces
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  noop:
+  jaeger:
+    protocols:
+      grpc:
+exporters:
+  otlp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+  remote_write:
+    namespace: traces_spanmetrics
+    metrics_instance: traces
+processors:
+  spanmetrics:
+    metrics_exporter: remote_write
+    latency_histogram_buckets: {}
+    dimensions:
+      - name: http.method
+      - name: service.namespace
+        default: none
+      - name: k8s.cluster.name
+        default: unknown
+extensions: {}
 service:
   pipelines:
     traces:
@@ -753,6 +957,68 @@ service:
       receivers: ["push_receiver", "jaeger"]
 `,
 		},
+		{
+			name: "group by trace config",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+group_by_trace:
+  wait_duration: 5s
+  num_traces: 1000
+tail_sampling:
+  policies:
+    - type: always_sample
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+exporters:
+  otlp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors:
+  groupbytrace:
+    wait_duration: 5s
+    num_traces: 1000
+  tail_sampling:
+    decision_wait: 5s
+    num_traces: 50000
+    expected_new_traces_per_sec: 0
+    policies:
+      - name: always_sample/0
+        type: always_sample
+extensions: {}
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/0"]
+      processors: ["groupbytrace", "tail_sampling"]
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "group by trace without tail sampling",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+group_by_trace:
+  wait_duration: 5s
+`,
+			expectedError: true,
+		},
 		{
 			name: "tail sampling config with DNS load balancing",
 			cfg: `
@@ -1008,6 +1274,81 @@ service:
       receivers: ["push_receiver", "jaeger"]
 `,
 		},
+		{
+			name: "tls config versions",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - tls_config:
+      ca_file: server.crt
+      min_version: TLS13
+      max_version: TLS13
+    endpoint: example.com:12345
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+exporters:
+  otlp/0:
+    endpoint: example.com:12345
+    tls:
+      insecure: false
+      ca_file: server.crt
+      min_version: "1.3"
+      max_version: "1.3"
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors: {}
+extensions: {}
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/0"]
+      processors: []
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "tls config min version greater than max version",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - tls_config:
+      min_version: TLS13
+      max_version: TLS12
+    endpoint: example.com:12345
+`,
+			expectedError: true,
+		},
+		{
+			name: "oauth2 TLS unknown version",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    protocol: http
+    oauth2:
+      client_id: someclientid
+      client_secret: someclientsecret
+      token_url: https://example.com/oauth2/default/v1/token
+      tls:
+        min_version: 1.4
+`,
+			expectedError: true,
+		},
 		{
 			name: "otlp http & grpc exporters",
 			cfg: `
@@ -1125,7 +1466,7 @@ service:
 `,
 		},
 		{
-			name: "one exporter with oauth2 and basic auth",
+			name: "service graphs remote write exporter",
 			cfg: `
 receivers:
   jaeger:
@@ -1133,65 +1474,45 @@ receivers:
       grpc:
 remote_write:
   - endpoint: example.com:12345
-    basic_auth:
-      username: test
-      password: blerg
-    oauth2:
-      client_id: somecclient
-      client_secret: someclientsecret
-`,
-			expectedError: true,
-		},
-		{
-			name: "simple oauth2 config",
-			cfg: `
-receivers:
-  jaeger:
-    protocols:
-      grpc:
-remote_write:
-  - endpoint: example.com:12345
-    protocol: http
-    oauth2:
-      client_id: someclientid
-      client_secret: someclientsecret
-      token_url: https://example.com/oauth2/default/v1/token
-      scopes: ["api.metrics"]
-      timeout: 2s
+service_graphs:
+  enabled: true
+  wait: 5s
+  metrics_instance: traces
 `,
 			expectedConfig: `
 receivers:
   push_receiver: {}
+  noop:
   jaeger:
     protocols:
       grpc:
-extensions:
-  oauth2client/otlphttp0:
-    client_id: someclientid
-    client_secret: someclientsecret
-    token_url: https://example.com/oauth2/default/v1/token
-    scopes: ["api.metrics"]
-    timeout: 2s
 exporters:
-  otlphttp/0:
+  otlp/0:
     endpoint: example.com:12345
     compression: gzip
     retry_on_failure:
       max_elapsed_time: 60s
-    auth:
-      authenticator: oauth2client/otlphttp0
-processors: {}
+  remote_write/servicegraphs:
+    namespace: traces
+    metrics_instance: traces
+processors:
+  service_graphs:
+    wait: 5s
+    metrics_exporter: remote_write/servicegraphs
+extensions: {}
 service:
-  extensions: ["oauth2client/otlphttp0"]
   pipelines:
     traces:
-      exporters: ["otlphttp/0"]
-      processors: []
+      exporters: ["otlp/0"]
+      processors: ["service_graphs"]
       receivers: ["push_receiver", "jaeger"]
+    metrics/servicegraphs:
+      exporters: ["remote_write/servicegraphs"]
+      receivers: ["noop"]
 `,
 		},
 		{
-			name: "oauth2 TLS with certs and keys from files",
+			name: "service graphs namespace",
 			cfg: `
 receivers:
   jaeger:
@@ -1199,67 +1520,44 @@ receivers:
       grpc:
 remote_write:
   - endpoint: example.com:12345
-    protocol: http
-    oauth2:
-      client_id: someclientid
-      client_secret: someclientsecret
-      endpoint_params:
-        audience: [someaudience]
-      token_url: https://example.com/oauth2/default/v1/token
-      scopes: ["api.metrics"]
-      timeout: 2s
-      tls:
-        insecure: true
-        insecure_skip_verify: true
-        ca_file: /var/lib/mycert.pem
-        cert_file: certfile
-        key_file: keyfile
-        min_version: 1.3
-        reload_interval: 1h
+service_graphs:
+  enabled: true
+  metrics_instance: traces
+  namespace: tempo
 `,
 			expectedConfig: `
 receivers:
   push_receiver: {}
+  noop:
   jaeger:
     protocols:
       grpc:
-extensions:
-  oauth2client/otlphttp0:
-    client_id: someclientid
-    client_secret: someclientsecret
-    endpoint_params:
-      audience: someaudience
-    token_url: https://example.com/oauth2/default/v1/token
-    scopes: ["api.metrics"]
-    timeout: 2s
-    tls:
-      insecure: true
-      insecure_skip_verify: true
-      ca_file: /var/lib/mycert.pem
-      cert_file: certfile
-      key_file: keyfile
-      min_version: 1.3
-      reload_interval: 1h
 exporters:
-  otlphttp/0:
+  otlp/0:
     endpoint: example.com:12345
     compression: gzip
     retry_on_failure:
       max_elapsed_time: 60s
-    auth:
-      authenticator: oauth2client/otlphttp0
-processors: {}
+  remote_write/servicegraphs:
+    namespace: tempo_traces
+    metrics_instance: traces
+processors:
+  service_graphs:
+    metrics_exporter: remote_write/servicegraphs
+extensions: {}
 service:
-  extensions: ["oauth2client/otlphttp0"]
   pipelines:
     traces:
-      exporters: ["otlphttp/0"]
-      processors: []
+      exporters: ["otlp/0"]
+      processors: ["service_graphs"]
       receivers: ["push_receiver", "jaeger"]
+    metrics/servicegraphs:
+      exporters: ["remote_write/servicegraphs"]
+      receivers: ["noop"]
 `,
 		},
 		{
-			name: "oauth2 TLS with certs and keys from strings",
+			name: "service graphs and span metrics remote write exporters",
 			cfg: `
 receivers:
   jaeger:
@@ -1267,153 +1565,248 @@ receivers:
       grpc:
 remote_write:
   - endpoint: example.com:12345
-    protocol: http
-    oauth2:
-      client_id: someclientid
-      client_secret: someclientsecret
-      endpoint_params:
-        audience: [someaudience]
-      token_url: https://example.com/oauth2/default/v1/token
-      scopes: ["api.metrics"]
-      timeout: 2s
-      tls:
-        insecure: true
-        insecure_skip_verify: true
-        ca_pem: test_secret_ca_pem_string
-        cert_pem: test_secret_cert_pem_string
-        key_pem: test_secret_key_pem_string
-        max_version: 1.2
-        reload_interval: 1h
+spanmetrics:
+  metrics_instance: traces
+service_graphs:
+  enabled: true
+  metrics_instance: service-graphs
 `,
 			expectedConfig: `
 receivers:
   push_receiver: {}
+  noop:
   jaeger:
     protocols:
       grpc:
-extensions:
-  oauth2client/otlphttp0:
-    client_id: someclientid
-    client_secret: someclientsecret
-    endpoint_params:
-      audience: someaudience
-    token_url: https://example.com/oauth2/default/v1/token
-    scopes: ["api.metrics"]
-    timeout: 2s
-    tls:
-      insecure: true
-      insecure_skip_verify: true
-      ca_pem: test_secret_ca_pem_string
-      cert_pem: test_secret_cert_pem_string
-      key_pem: test_secret_key_pem_string
-      max_version: 1.2
-      reload_interval: 1h
 exporters:
-  otlphttp/0:
+  otlp/0:
     endpoint: example.com:12345
     compression: gzip
     retry_on_failure:
       max_elapsed_time: 60s
-    auth:
-      authenticator: oauth2client/otlphttp0
-processors: {}
+  remote_write:
+    namespace: traces_spanmetrics
+    metrics_instance: traces
+  remote_write/servicegraphs:
+    namespace: traces
+    metrics_instance: service-graphs
+processors:
+  spanmetrics:
+    metrics_exporter: remote_write
+    latency_histogram_buckets: {}
+    dimensions: {}
+  service_graphs:
+    metrics_exporter: remote_write/servicegraphs
+extensions: {}
 service:
-  extensions: ["oauth2client/otlphttp0"]
   pipelines:
     traces:
-      exporters: ["otlphttp/0"]
-      processors: []
+      exporters: ["otlp/0"]
+      processors: ["spanmetrics", "service_graphs"]
       receivers: ["push_receiver", "jaeger"]
+    metrics/spanmetrics:
+      exporters: ["remote_write"]
+      receivers: ["noop"]
+    metrics/servicegraphs:
+      exporters: ["remote_write/servicegraphs"]
+      receivers: ["noop"]
 `,
 		},
 		{
-			name: "2 exporters different auth",
+			name: "service graphs namespace without metrics instance",
 			cfg: `
 receivers:
- jaeger:
-   protocols:
-     grpc:
+  jaeger:
+    protocols:
+      grpc:
 remote_write:
- - endpoint: example.com:12345
-   protocol: http
-   oauth2:
-     client_id: someclientid
-     client_secret: someclientsecret
-     token_url: https://example.com/oauth2/default/v1/token
-     scopes: ["api.metrics"]
-     timeout: 2s
- - endpoint: example.com:12345
-   protocol: grpc
-   oauth2:
-     client_id: anotherclientid
-     client_secret: anotherclientsecret
-     token_url: https://example.com/oauth2/default/v1/token
-     scopes: ["api.metrics"]
-     timeout: 2s
+  - endpoint: example.com:12345
+service_graphs:
+  enabled: true
+  namespace: tempo
+`,
+			expectedError: true,
+		},
+		{
+			name: "receiver pipelines",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+  zipkin:
+remote_write:
+  - endpoint: example.com:12345
+batch:
+  timeout: 5s
+  send_batch_size: 100
+tail_sampling:
+  policies:
+    - type: always_sample
+pipelines:
+  - name: presampled
+    skip_processors: [tail_sampling]
+receiver_pipelines:
+  - receiver: zipkin
+    pipeline: presampled
 `,
 			expectedConfig: `
 receivers:
- push_receiver: {}
- jaeger:
-   protocols:
-     grpc:
-extensions:
- oauth2client/otlphttp0:
-   client_id: someclientid
-   client_secret: someclientsecret
-   token_url: https://example.com/oauth2/default/v1/token
-   scopes: ["api.metrics"]
-   timeout: 2s
- oauth2client/otlp1:
-   client_id: anotherclientid
-   client_secret: anotherclientsecret
-   token_url: https://example.com/oauth2/default/v1/token
-   scopes: ["api.metrics"]
-   timeout: 2s
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+  zipkin:
 exporters:
-  otlphttp/0:
-    endpoint: example.com:12345
-    compression: gzip
-    retry_on_failure:
-      max_elapsed_time: 60s
-    auth:
-      authenticator: oauth2client/otlphttp0
-  otlp/1:
+  otlp/0:
     endpoint: example.com:12345
     compression: gzip
     retry_on_failure:
       max_elapsed_time: 60s
-    auth:
-      authenticator: oauth2client/otlp1
-processors: {}
+processors:
+  batch:
+    timeout: 5s
+    send_batch_size: 100
+  tail_sampling:
+    decision_wait: 5s
+    num_traces: 50000
+    expected_new_traces_per_sec: 0
+    policies:
+      - name: always_sample/0
+        type: always_sample
+extensions: {}
 service:
-  extensions: ["oauth2client/otlphttp0", "oauth2client/otlp1"]
   pipelines:
     traces:
-      exporters: ["otlphttp/0", "otlp/1"]
-      processors: []
+      exporters: ["otlp/0"]
+      processors: ["tail_sampling", "batch"]
       receivers: ["push_receiver", "jaeger"]
+    traces/presampled:
+      exporters: ["otlp/0"]
+      processors: ["batch"]
+      receivers: ["zipkin"]
 `,
 		},
 		{
-			name: "exporter with insecure oauth",
+			name: "pipeline sharing stateful processor",
 			cfg: `
 receivers:
   jaeger:
     protocols:
       grpc:
+  zipkin:
 remote_write:
-  - endpoint: http://example.com:12345
-    insecure: true
-    protocol: http
+  - endpoint: example.com:12345
+tail_sampling:
+  policies:
+    - type: always_sample
+pipelines:
+  - name: presampled
+receiver_pipelines:
+  - receiver: zipkin
+    pipeline: presampled
+`,
+			expectedError: true,
+		},
+		{
+			name: "receiver assigned to undefined pipeline",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+  zipkin:
+remote_write:
+  - endpoint: example.com:12345
+pipelines:
+  - name: presampled
+receiver_pipelines:
+  - receiver: zipkin
+    pipeline: unsampled
+`,
+			expectedError: true,
+		},
+		{
+			name: "pipeline skipping unconfigured processor",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+  zipkin:
+remote_write:
+  - endpoint: example.com:12345
+pipelines:
+  - name: presampled
+    skip_processors: [tail_sampling]
+receiver_pipelines:
+  - receiver: zipkin
+    pipeline: presampled
+`,
+			expectedError: true,
+		},
+		{
+			name: "receiver pipelines with load balancing",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+  zipkin:
+remote_write:
+  - endpoint: example.com:12345
+tail_sampling:
+  policies:
+    - type: always_sample
+load_balancing:
+  exporter:
+    insecure: true
+  resolver:
+    dns:
+      hostname: agent
+pipelines:
+  - name: presampled
+    skip_processors: [tail_sampling]
+receiver_pipelines:
+  - receiver: zipkin
+    pipeline: presampled
+`,
+			expectedError: true,
+		},
+		{
+			name: "one exporter with oauth2 and basic auth",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    basic_auth:
+      username: test
+      password: blerg
+    oauth2:
+      client_id: somecclient
+      client_secret: someclientsecret
+`,
+			expectedError: true,
+		},
+		{
+			name: "simple oauth2 config",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    protocol: http
     oauth2:
       client_id: someclientid
       client_secret: someclientsecret
       token_url: https://example.com/oauth2/default/v1/token
       scopes: ["api.metrics"]
       timeout: 2s
-      tls:
-        insecure: true
 `,
 			expectedConfig: `
 receivers:
@@ -1428,13 +1821,9 @@ extensions:
     token_url: https://example.com/oauth2/default/v1/token
     scopes: ["api.metrics"]
     timeout: 2s
-    tls:
-      insecure: true
 exporters:
   otlphttp/0:
-    endpoint: http://example.com:12345
-    tls:
-      insecure: true
+    endpoint: example.com:12345
     compression: gzip
     retry_on_failure:
       max_elapsed_time: 60s
@@ -1451,102 +1840,59 @@ service:
 `,
 		},
 		{
-			name: "OTLP receivers get include_metadata set to true by default",
+			name: "headers referencing resource attributes",
 			cfg: `
 receivers:
-  otlp/0:
-    protocols:
-      grpc:
-      http:
-        endpoint: localhost:4318
-  otlp/1:
+  jaeger:
     protocols:
       grpc:
-        include_metadata: false
-      http:
-        include_metadata: false
-        endpoint: localhost:4318
 remote_write:
   - endpoint: example.com:12345
+    protocol: http
+    headers:
+      X-Env: prod
+      X-Literal: ${not.a.resource}
+      X-Service: ${resource.service.name}
+      X-Team: team-${resource.team}
 `,
 			expectedConfig: `
 receivers:
-  push_receiver:
-  otlp/0:
-    protocols:
-      grpc:
-        include_metadata: true
-      http:
-        include_metadata: true
-        endpoint: localhost:4318
-  otlp/1:
+  push_receiver: {}
+  jaeger:
     protocols:
       grpc:
-        include_metadata: false
-      http:
-        include_metadata: false
-        endpoint: localhost:4318
+extensions:
+  headers_setter/otlphttp0:
+    headers:
+      - key: X-Service
+        from_context: header_template.x-service
+        action: upsert
+      - key: X-Team
+        from_context: header_template.x-team
+        action: upsert
 exporters:
-  otlp/0:
+  otlphttp/0:
     endpoint: example.com:12345
     compression: gzip
+    headers:
+      X-Env: prod
+      X-Literal: ${not.a.resource}
     retry_on_failure:
       max_elapsed_time: 60s
+    auth:
+      authenticator: headers_setter/otlphttp0
 processors: {}
-extensions: {}
 service:
+  extensions: ["headers_setter/otlphttp0"]
   pipelines:
     traces:
-      exporters: ["otlp/0"]
+      exporters: ["otlphttp/0"]
       processors: []
-      receivers: ["push_receiver", "otlp/0", "otlp/1"]
+      receivers: ["push_receiver", "jaeger"]
 `,
 		},
-	}
-
-	for _, tc := range tt {
-		t.Run(tc.name, func(t *testing.T) {
-			var cfg InstanceConfig
-			err := yaml.Unmarshal([]byte(tc.cfg), &cfg)
-			require.NoError(t, err)
-			// check error
-			actualConfig, err := cfg.otelConfig()
-			if tc.expectedError {
-				assert.Error(t, err)
-				return
-			}
-			require.NoError(t, err)
-
-			// convert actual config to otel config
-			otelMapStructure := map[string]interface{}{}
-			err = yaml.Unmarshal([]byte(tc.expectedConfig), otelMapStructure)
-			require.NoError(t, err)
-
-			factories, err := tracingFactories()
-			require.NoError(t, err)
-
-			expectedConfig, err := otelcolConfigFromStringMap(otelMapStructure, &factories)
-			require.NoError(t, err)
-
-			// Exporters/Receivers/Processors in the config's service.Pipelines, as well as
-			// service.Extensions have to be in the same order for them to be asserted as equal.
-			sortService(actualConfig)
-			sortService(expectedConfig)
-
-			assert.Equal(t, *expectedConfig, *actualConfig)
-		})
-	}
-}
-
-func TestProcessorOrder(t *testing.T) {
-	// tests!
-	tt := []struct {
-		name               string
-		cfg                string
-		expectedProcessors map[component.ID][]component.ID
-	}{
 		{
-			name: "no processors",
+			name: "oauth2 TLS with certs and keys from files",
 			cfg: `
 receivers:
   jaeger:
@@ -1554,15 +1900,67 @@ receivers:
       grpc:
 remote_write:
   - endpoint: example.com:12345
-    headers:
-      x-some-header: Some value!
+    protocol: http
+    oauth2:
+      client_id: someclientid
+      client_secret: someclientsecret
+      endpoint_params:
+        audience: [someaudience]
+      token_url: https://example.com/oauth2/default/v1/token
+      scopes: ["api.metrics"]
+      timeout: 2s
+      tls:
+        insecure: true
+        insecure_skip_verify: true
+        ca_file: /var/lib/mycert.pem
+        cert_file: certfile
+        key_file: keyfile
+        min_version: 1.3
+        reload_interval: 1h
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+extensions:
+  oauth2client/otlphttp0:
+    client_id: someclientid
+    client_secret: someclientsecret
+    endpoint_params:
+      audience: someaudience
+    token_url: https://example.com/oauth2/default/v1/token
+    scopes: ["api.metrics"]
+    timeout: 2s
+    tls:
+      insecure: true
+      insecure_skip_verify: true
+      ca_file: /var/lib/mycert.pem
+      cert_file: certfile
+      key_file: keyfile
+      min_version: 1.3
+      reload_interval: 1h
+exporters:
+  otlphttp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+    auth:
+      authenticator: oauth2client/otlphttp0
+processors: {}
+service:
+  extensions: ["oauth2client/otlphttp0"]
+  pipelines:
+    traces:
+      exporters: ["otlphttp/0"]
+      processors: []
+      receivers: ["push_receiver", "jaeger"]
 `,
-			expectedProcessors: map[component.ID][]component.ID{
-				component.NewID("traces"): nil,
-			},
 		},
 		{
-			name: "all processors w/o load balancing",
+			name: "oauth2 TLS with certs and keys from strings",
 			cfg: `
 receivers:
   jaeger:
@@ -1570,51 +1968,1596 @@ receivers:
       grpc:
 remote_write:
   - endpoint: example.com:12345
-    headers:
-      x-some-header: Some value!
-attributes:
-  actions:
-  - key: montgomery
-    value: forever
-    action: update
-spanmetrics:
-  latency_histogram_buckets: [2ms, 6ms, 10ms, 100ms, 250ms]
-  dimensions:
-    - name: http.method
-      default: GET
-    - name: http.status_code
-  metrics_instance: traces
-automatic_logging:
-  spans: true
-batch:
-  timeout: 5s
-  send_batch_size: 100
-tail_sampling:
-  policies:
-    - type: always_sample
+    protocol: http
+    oauth2:
+      client_id: someclientid
+      client_secret: someclientsecret
+      endpoint_params:
+        audience: [someaudience]
+      token_url: https://example.com/oauth2/default/v1/token
+      scopes: ["api.metrics"]
+      timeout: 2s
+      tls:
+        insecure: true
+        insecure_skip_verify: true
+        ca_pem: test_secret_ca_pem_string
+        cert_pem: test_secret_cert_pem_string
+        key_pem: test_secret_key_pem_string
+        max_version: 1.2
+        reload_interval: 1h
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+extensions:
+  oauth2client/otlphttp0:
+    client_id: someclientid
+    client_secret: someclientsecret
+    endpoint_params:
+      audience: someaudience
+    token_url: https://example.com/oauth2/default/v1/token
+    scopes: ["api.metrics"]
+    timeout: 2s
+    tls:
+      insecure: true
+      insecure_skip_verify: true
+      ca_pem: test_secret_ca_pem_string
+      cert_pem: test_secret_cert_pem_string
+      key_pem: test_secret_key_pem_string
+      max_version: 1.2
+      reload_interval: 1h
+exporters:
+  otlphttp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+    auth:
+      authenticator: oauth2client/otlphttp0
+processors: {}
+service:
+  extensions: ["oauth2client/otlphttp0"]
+  pipelines:
+    traces:
+      exporters: ["otlphttp/0"]
+      processors: []
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "2 exporters different auth",
+			cfg: `
+receivers:
+ jaeger:
+   protocols:
+     grpc:
+remote_write:
+ - endpoint: example.com:12345
+   protocol: http
+   oauth2:
+     client_id: someclientid
+     client_secret: someclientsecret
+     token_url: https://example.com/oauth2/default/v1/token
+     scopes: ["api.metrics"]
+     timeout: 2s
+ - endpoint: example.com:12345
+   protocol: grpc
+   oauth2:
+     client_id: anotherclientid
+     client_secret: anotherclientsecret
+     token_url: https://example.com/oauth2/default/v1/token
+     scopes: ["api.metrics"]
+     timeout: 2s
+`,
+			expectedConfig: `
+receivers:
+ push_receiver: {}
+ jaeger:
+   protocols:
+     grpc:
+extensions:
+ oauth2client/otlphttp0:
+   client_id: someclientid
+   client_secret: someclientsecret
+   token_url: https://example.com/oauth2/default/v1/token
+   scopes: ["api.metrics"]
+   timeout: 2s
+ oauth2client/otlp1:
+   client_id: anotherclientid
+   client_secret: anotherclientsecret
+   token_url: https://example.com/oauth2/default/v1/token
+   scopes: ["api.metrics"]
+   timeout: 2s
+exporters:
+  otlphttp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+    auth:
+      authenticator: oauth2client/otlphttp0
+  otlp/1:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+    auth:
+      authenticator: oauth2client/otlp1
+processors: {}
+service:
+  extensions: ["oauth2client/otlphttp0", "oauth2client/otlp1"]
+  pipelines:
+    traces:
+      exporters: ["otlphttp/0", "otlp/1"]
+      processors: []
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "exporter with insecure oauth",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: http://example.com:12345
+    insecure: true
+    protocol: http
+    oauth2:
+      client_id: someclientid
+      client_secret: someclientsecret
+      token_url: https://example.com/oauth2/default/v1/token
+      scopes: ["api.metrics"]
+      timeout: 2s
+      tls:
+        insecure: true
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+extensions:
+  oauth2client/otlphttp0:
+    client_id: someclientid
+    client_secret: someclientsecret
+    token_url: https://example.com/oauth2/default/v1/token
+    scopes: ["api.metrics"]
+    timeout: 2s
+    tls:
+      insecure: true
+exporters:
+  otlphttp/0:
+    endpoint: http://example.com:12345
+    tls:
+      insecure: true
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+    auth:
+      authenticator: oauth2client/otlphttp0
+processors: {}
+service:
+  extensions: ["oauth2client/otlphttp0"]
+  pipelines:
+    traces:
+      exporters: ["otlphttp/0"]
+      processors: []
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "batch explicitly disabled",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+batch:
+  disabled: true
+  timeout: 5s
+remote_write:
+  - endpoint: example.com:12345
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+exporters:
+  otlp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors: {}
+extensions: {}
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/0"]
+      processors: []
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "batch explicitly enabled",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+batch:
+  disabled: false
+  timeout: 5s
+remote_write:
+  - endpoint: example.com:12345
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+exporters:
+  otlp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors:
+  batch:
+    timeout: 5s
+extensions: {}
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/0"]
+      processors: ["batch"]
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "batch disabled is not a boolean",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+batch:
+  disabled: sometimes
+remote_write:
+  - endpoint: example.com:12345
+`,
+			expectedError: true,
+		},
+		{
+			name: "OTLP receivers get include_metadata set to true by default",
+			cfg: `
+receivers:
+  otlp/0:
+    protocols:
+      grpc:
+      http:
+        endpoint: localhost:4318
+  otlp/1:
+    protocols:
+      grpc:
+        include_metadata: false
+      http:
+        include_metadata: false
+        endpoint: localhost:4318
+remote_write:
+  - endpoint: example.com:12345
+`,
+			expectedConfig: `
+receivers:
+  push_receiver:
+  otlp/0:
+    protocols:
+      grpc:
+        include_metadata: true
+      http:
+        include_metadata: true
+        endpoint: localhost:4318
+  otlp/1:
+    protocols:
+      grpc:
+        include_metadata: false
+      http:
+        include_metadata: false
+        endpoint: localhost:4318
+exporters:
+  otlp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors: {}
+extensions: {}
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/0"]
+      processors: []
+      receivers: ["push_receiver", "otlp/0", "otlp/1"]
+`,
+		},
+		{
+			name: "tenant routing",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    headers:
+      x-some-header: value
+    tenant_routing:
+      attribute: team
+      mapping:
+        checkout: team-a
+        payments: team-a
+        search: team-b
+      default_tenant: shared
+  - endpoint: other.example.com:12345
+batch:
+  timeout: 5s
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+exporters:
+  otlp/0/shared:
+    endpoint: example.com:12345
+    compression: gzip
+    headers:
+      x-some-header: value
+      X-Scope-OrgID: shared
+    retry_on_failure:
+      max_elapsed_time: 60s
+  otlp/0/team-a:
+    endpoint: example.com:12345
+    compression: gzip
+    headers:
+      x-some-header: value
+      X-Scope-OrgID: team-a
+    retry_on_failure:
+      max_elapsed_time: 60s
+  otlp/0/team-b:
+    endpoint: example.com:12345
+    compression: gzip
+    headers:
+      x-some-header: value
+      X-Scope-OrgID: team-b
+    retry_on_failure:
+      max_elapsed_time: 60s
+  otlp/1:
+    endpoint: other.example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors:
+  batch:
+    timeout: 5s
+  filter/otlp/0/shared:
+    error_mode: ignore
+    traces:
+      span:
+        - 'resource.attributes["team"] == "checkout"'
+        - 'resource.attributes["team"] == "payments"'
+        - 'resource.attributes["team"] == "search"'
+  filter/otlp/0/team-a:
+    error_mode: ignore
+    traces:
+      span:
+        - 'resource.attributes["team"] != "checkout" and resource.attributes["team"] != "payments"'
+  filter/otlp/0/team-b:
+    error_mode: ignore
+    traces:
+      span:
+        - 'resource.attributes["team"] != "search"'
+extensions: {}
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/1"]
+      processors: ["batch"]
+      receivers: ["push_receiver", "jaeger"]
+    traces/otlp/0/shared:
+      exporters: ["otlp/0/shared"]
+      processors: ["filter/otlp/0/shared", "batch"]
+      receivers: ["push_receiver", "jaeger"]
+    traces/otlp/0/team-a:
+      exporters: ["otlp/0/team-a"]
+      processors: ["filter/otlp/0/team-a", "batch"]
+      receivers: ["push_receiver", "jaeger"]
+    traces/otlp/0/team-b:
+      exporters: ["otlp/0/team-b"]
+      processors: ["filter/otlp/0/team-b", "batch"]
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "tenant routing dropping unmatched spans",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    tenant_routing:
+      attribute: team
+      mapping:
+        checkout: team-a
+      drop_unmatched: true
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+exporters:
+  otlp/0/team-a:
+    endpoint: example.com:12345
+    compression: gzip
+    headers:
+      X-Scope-OrgID: team-a
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors:
+  filter/otlp/0/team-a:
+    error_mode: ignore
+    traces:
+      span:
+        - 'resource.attributes["team"] != "checkout"'
+extensions: {}
+service:
+  pipelines:
+    traces/otlp/0/team-a:
+      exporters: ["otlp/0/team-a"]
+      processors: ["filter/otlp/0/team-a"]
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "sampled remote_write",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+  - endpoint: archive.example.com:12345
+    sample_percentage: 1
+batch:
+  timeout: 5s
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+exporters:
+  otlp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+  otlp/1:
+    endpoint: archive.example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors:
+  batch:
+    timeout: 5s
+  probabilistic_sampler/otlp/1:
+    sampling_percentage: 1
+extensions: {}
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/0"]
+      processors: ["batch"]
+      receivers: ["push_receiver", "jaeger"]
+    traces/otlp/1:
+      exporters: ["otlp/1"]
+      processors: ["probabilistic_sampler/otlp/1", "batch"]
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "every remote_write sampled",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    sample_percentage: 10
+  - endpoint: archive.example.com:12345
+    sample_percentage: 1
+`,
+			expectedError: true,
+		},
+		{
+			name: "remote_write sampling all traces",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    sample_percentage: 100
+`,
+			expectedConfig: `
+receivers:
+  push_receiver: {}
+  jaeger:
+    protocols:
+      grpc:
+exporters:
+  otlp/0:
+    endpoint: example.com:12345
+    compression: gzip
+    retry_on_failure:
+      max_elapsed_time: 60s
+processors: {}
+extensions: {}
+service:
+  pipelines:
+    traces:
+      exporters: ["otlp/0"]
+      processors: []
+      receivers: ["push_receiver", "jaeger"]
+`,
+		},
+		{
+			name: "tenant routing with spanmetrics",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    tenant_routing:
+      attribute: team
+      mapping:
+        checkout: team-a
+      drop_unmatched: true
+spanmetrics:
+  handler_endpoint: "0.0.0.0:8889"
+`,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg InstanceConfig
+			err := yaml.Unmarshal([]byte(tc.cfg), &cfg)
+			require.NoError(t, err)
+			// check error
+			actualConfig, err := cfg.otelConfig()
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			// convert actual config to otel config
+			otelMapStructure := map[string]interface{}{}
+			err = yaml.Unmarshal([]byte(tc.expectedConfig), otelMapStructure)
+			require.NoError(t, err)
+
+			factories, err := tracingFactories()
+			require.NoError(t, err)
+
+			expectedConfig, err := otelcolConfigFromStringMap(otelMapStructure, &factories)
+			require.NoError(t, err)
+
+			// Exporters/Receivers/Processors in the config's service.Pipelines, as well as
+			// service.Extensions have to be in the same order for them to be asserted as equal.
+			sortService(actualConfig)
+			sortService(expectedConfig)
+
+			assert.Equal(t, *expectedConfig, *actualConfig)
+		})
+	}
+}
+
+func TestProcessorOrder(t *testing.T) {
+	// tests!
+	tt := []struct {
+		name               string
+		cfg                string
+		expectedProcessors map[component.ID][]component.ID
+	}{
+		{
+			name: "no processors",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    headers:
+      x-some-header: Some value!
+`,
+			expectedProcessors: map[component.ID][]component.ID{
+				component.NewID("traces"): nil,
+			},
+		},
+		{
+			name: "all processors w/o load balancing",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    headers:
+      x-some-header: Some value!
+attributes:
+  actions:
+  - key: montgomery
+    value: forever
+    action: update
+spanmetrics:
+  latency_histogram_buckets: [2ms, 6ms, 10ms, 100ms, 250ms]
+  dimensions:
+    - name: http.method
+      default: GET
+    - name: http.status_code
+  metrics_instance: traces
+automatic_logging:
+  spans: true
+batch:
+  timeout: 5s
+  send_batch_size: 100
+group_by_trace:
+  wait_duration: 2s
+tail_sampling:
+  policies:
+    - type: always_sample
+    - type: string_attribute
+      string_attribute:
+        key: key
+        values:
+          - value1
+          - value2
+service_graphs:
+  enabled: true
+`,
+			expectedProcessors: map[component.ID][]component.ID{
+				component.NewID("traces"): {
+					component.NewID("attributes"),
+					component.NewID("spanmetrics"),
+					component.NewID("service_graphs"),
+					component.NewID("groupbytrace"),
+					component.NewID("tail_sampling"),
+					component.NewID("automatic_logging"),
+					component.NewID("batch"),
+				},
+				component.NewIDWithName(spanMetricsPipelineType, spanMetricsPipelineName): nil,
+			},
+		},
+		{
+			name: "all processors with load balancing",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    headers:
+      x-some-header: Some value!
+attributes:
+  actions:
+  - key: montgomery
+    value: forever
+    action: update
+spanmetrics:
+  latency_histogram_buckets: [2ms, 6ms, 10ms, 100ms, 250ms]
+  dimensions:
+    - name: http.method
+      default: GET
+    - name: http.status_code
+  metrics_instance: traces
+automatic_logging:
+  spans: true
+batch:
+  timeout: 5s
+  send_batch_size: 100
+group_by_trace:
+  wait_duration: 2s
+tail_sampling:
+  policies:
+    - type: always_sample
     - type: string_attribute
       string_attribute:
         key: key
         values:
           - value1
           - value2
+load_balancing:
+  exporter:
+    tls:
+      insecure: true
+  resolver:
+    dns:
+      hostname: agent
+      port: 4318
 service_graphs:
   enabled: true
 `,
-			expectedProcessors: map[component.ID][]component.ID{
-				component.NewID("traces"): {
-					component.NewID("attributes"),
-					component.NewID("spanmetrics"),
-					component.NewID("service_graphs"),
-					component.NewID("tail_sampling"),
-					component.NewID("automatic_logging"),
-					component.NewID("batch"),
+			expectedProcessors: map[component.ID][]component.ID{
+				component.NewIDWithName("traces", "0"): {
+					component.NewID("attributes"),
+				},
+				component.NewIDWithName("traces", "1"): {
+					component.NewID("spanmetrics"),
+					component.NewID("service_graphs"),
+					component.NewID("groupbytrace"),
+					component.NewID("tail_sampling"),
+					component.NewID("automatic_logging"),
+					component.NewID("batch"),
+				},
+				component.NewIDWithName(spanMetricsPipelineType, spanMetricsPipelineName): nil,
+			},
+		},
+		{
+			name: "load balancing without tail sampling",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    headers:
+      x-some-header: Some value!
+attributes:
+  actions:
+  - key: montgomery
+    value: forever
+    action: update
+spanmetrics:
+  latency_histogram_buckets: [2ms, 6ms, 10ms, 100ms, 250ms]
+  dimensions:
+    - name: http.method
+      default: GET
+    - name: http.status_code
+  metrics_instance: traces
+automatic_logging:
+  spans: true
+batch:
+  timeout: 5s
+  send_batch_size: 100
+load_balancing:
+  exporter:
+    tls:
+      insecure: true
+  resolver:
+    dns:
+      hostname: agent
+      port: 4318
+`,
+			expectedProcessors: map[component.ID][]component.ID{
+				component.NewIDWithName("traces", "0"): {
+					component.NewID("attributes"),
+				},
+				component.NewIDWithName("traces", "1"): {
+					component.NewID("spanmetrics"),
+					component.NewID("automatic_logging"),
+					component.NewID("batch"),
+				},
+				component.NewIDWithName(spanMetricsPipelineType, spanMetricsPipelineName): nil,
+			},
+		},
+		{
+			name: "extra processors",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+attributes:
+  actions:
+  - key: montgomery
+    value: forever
+    action: update
+spanmetrics:
+  metrics_instance: traces
+tail_sampling:
+  policies:
+    - type: always_sample
+batch:
+  timeout: 5s
+extra_processors:
+  probabilistic_sampler:
+    sampling_percentage: 50
+  groupbytrace/extra:
+    wait_duration: 5s
+    num_traces: 5000
+extra_processor_order:
+  - probabilistic_sampler
+  - attributes
+  - spanmetrics
+  - groupbytrace/extra
+  - tail_sampling
+`,
+			expectedProcessors: map[component.ID][]component.ID{
+				component.NewID("traces"): {
+					component.NewID("probabilistic_sampler"),
+					component.NewID("attributes"),
+					component.NewID("spanmetrics"),
+					component.NewIDWithName("groupbytrace", "extra"),
+					component.NewID("tail_sampling"),
+					component.NewID("batch"),
+				},
+				component.NewIDWithName(spanMetricsPipelineType, spanMetricsPipelineName): nil,
+			},
+		},
+		{
+			name: "extra processors with load balancing",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+spanmetrics:
+  metrics_instance: traces
+tail_sampling:
+  policies:
+    - type: always_sample
+load_balancing:
+  exporter:
+    tls:
+      insecure: true
+  resolver:
+    dns:
+      hostname: agent
+      port: 4318
+extra_processors:
+  groupbytrace/extra:
+    wait_duration: 5s
+extra_processor_order:
+  - spanmetrics
+  - groupbytrace/extra
+  - tail_sampling
+`,
+			expectedProcessors: map[component.ID][]component.ID{
+				component.NewIDWithName("traces", "0"): nil,
+				component.NewIDWithName("traces", "1"): {
+					component.NewID("spanmetrics"),
+					component.NewIDWithName("groupbytrace", "extra"),
+					component.NewID("tail_sampling"),
+				},
+				component.NewIDWithName(spanMetricsPipelineType, spanMetricsPipelineName): nil,
+			},
+		},
+		{
+			name: "redact with load balancing",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+attributes:
+  actions:
+  - key: montgomery
+    value: forever
+    action: update
+automatic_logging:
+  spans: true
+redact:
+  keys: ["*.credit_card"]
+load_balancing:
+  exporter:
+    tls:
+      insecure: true
+  resolver:
+    dns:
+      hostname: agent
+      port: 4318
+`,
+			expectedProcessors: map[component.ID][]component.ID{
+				component.NewIDWithName("traces", "0"): {
+					component.NewIDWithName("attributes", "redact"),
+					component.NewID("attributes"),
+				},
+				component.NewIDWithName("traces", "1"): {
+					component.NewID("automatic_logging"),
+				},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg InstanceConfig
+			err := yaml.Unmarshal([]byte(tc.cfg), &cfg)
+			require.NoError(t, err)
+
+			// check error
+			actualConfig, err := cfg.otelConfig()
+			require.NoError(t, err)
+
+			require.Equal(t, len(tc.expectedProcessors), len(actualConfig.Service.Pipelines))
+			for componentID := range tc.expectedProcessors {
+				if len(tc.expectedProcessors[componentID]) > 0 {
+					assert.NotNil(t, tc.expectedProcessors)
+					assert.NotNil(t, actualConfig.Service.Pipelines[componentID])
+
+					assert.Equal(t, tc.expectedProcessors[componentID], actualConfig.Service.Pipelines[componentID].Processors)
+				}
+			}
+		})
+	}
+}
+
+func TestExtraProcessorsValidation(t *testing.T) {
+	tt := []struct {
+		name          string
+		cfg           string
+		expectedError string
+	}{
+		{
+			name: "conflicts with built-in processor",
+			cfg: `
+extra_processors:
+  batch:
+extra_processor_order: [batch]
+`,
+			expectedError: `extra processor "batch" conflicts with a built-in processor`,
+		},
+		{
+			name: "not listed in order",
+			cfg: `
+extra_processors:
+  probabilistic_sampler:
+extra_processor_order: [spanmetrics]
+`,
+			expectedError: `extra processor "probabilistic_sampler" must be listed in extra_processor_order`,
+		},
+		{
+			name: "listed twice",
+			cfg: `
+extra_processors:
+  probabilistic_sampler:
+extra_processor_order: [probabilistic_sampler, probabilistic_sampler]
+`,
+			expectedError: `extra_processor_order: processor "probabilistic_sampler" is listed more than once`,
+		},
+		{
+			name: "unknown processor type",
+			cfg: `
+extra_processors:
+  memory_limiter:
+extra_processor_order: [memory_limiter]
+`,
+			expectedError: `extra processor "memory_limiter": unknown processor type "memory_limiter"`,
+		},
+		{
+			name: "invalid config",
+			cfg: `
+extra_processors:
+  probabilistic_sampler:
+    sampling_percentage: -1
+extra_processor_order: [probabilistic_sampler]
+`,
+			expectedError: `extra processor "probabilistic_sampler": `,
+		},
+		{
+			name: "unknown processor in order",
+			cfg: `
+extra_processors:
+  probabilistic_sampler:
+extra_processor_order: [probabilistic_sampler, not_a_processor]
+`,
+			expectedError: `extra_processor_order: unknown processor "not_a_processor"`,
+		},
+		{
+			name: "built-in processors out of order",
+			cfg: `
+extra_processors:
+  probabilistic_sampler:
+extra_processor_order: [tail_sampling, probabilistic_sampler, spanmetrics]
+`,
+			expectedError: `extra_processor_order: built-in processor "spanmetrics" is not listed in pipeline order`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := InstanceConfig{}
+			require.NoError(t, yaml.Unmarshal([]byte(tc.cfg), &cfg))
+
+			_, err := cfg.extraProcessorOrder()
+			require.ErrorContains(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestOrderProcessors(t *testing.T) {
+	tests := []struct {
+		processors     []string
+		splitPipelines bool
+		expected       [][]string
+	}{
+		{
+			expected: [][]string{
+				nil,
+			},
+		},
+		{
+			processors: []string{
+				"tail_sampling",
+			},
+			expected: [][]string{
+				{"tail_sampling"},
+			},
+		},
+		{
+			processors: []string{
+				"batch",
+				"tail_sampling",
+				"automatic_logging",
+			},
+			expected: [][]string{
+				{
+					"tail_sampling",
+					"automatic_logging",
+					"batch",
+				},
+			},
+		},
+		{
+			processors: []string{
+				"spanmetrics",
+				"batch",
+				"tail_sampling",
+				"attributes",
+				"automatic_logging",
+			},
+			expected: [][]string{
+				{
+					"attributes",
+					"spanmetrics",
+					"tail_sampling",
+					"automatic_logging",
+					"batch",
+				},
+			},
+		},
+		{
+			splitPipelines: true,
+			expected: [][]string{
+				nil,
+				nil,
+			},
+		},
+		{
+			processors: []string{
+				"spanmetrics",
+				"batch",
+				"tail_sampling",
+				"attributes",
+				"automatic_logging",
+			},
+			splitPipelines: true,
+			expected: [][]string{
+				{
+					"attributes",
+				},
+				{
+					"spanmetrics",
+					"tail_sampling",
+					"automatic_logging",
+					"batch",
+				},
+			},
+		},
+		{
+			processors: []string{
+				"batch",
+				"tail_sampling",
+				"automatic_logging",
+			},
+			splitPipelines: true,
+			expected: [][]string{
+				{},
+				{
+					"tail_sampling",
+					"automatic_logging",
+					"batch",
+				},
+			},
+		},
+		{
+			processors: []string{
+				"spanmetrics",
+				"attributes",
+			},
+			splitPipelines: true,
+			expected: [][]string{
+				{
+					"attributes",
+				},
+				{
+					"spanmetrics",
+				},
+			},
+		},
+		{
+			processors: []string{
+				"automatic_logging",
+				"attributes",
+				"attributes/redact",
+			},
+			expected: [][]string{
+				{
+					"attributes/redact",
+					"attributes",
+					"automatic_logging",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		actual := orderProcessors(tc.processors, tc.splitPipelines)
+		assert.Equal(t, tc.expected, actual)
+	}
+}
+
+func TestRedactConfig(t *testing.T) {
+	tt := []struct {
+		name              string
+		cfg               string
+		expectedProcessor map[string]interface{}
+		expectedErr       string
+	}{
+		{
+			name: "delete by default",
+			cfg: `
+keys:
+  - "*.credit_card"
+  - http.request.header.authorization
+`,
+			expectedProcessor: map[string]interface{}{
+				"actions": []map[string]interface{}{
+					{"pattern": `^.*\.credit_card$`, "action": "delete"},
+					{"pattern": `^http\.request\.header\.authorization$`, "action": "delete"},
 				},
-				component.NewIDWithName(spanMetricsPipelineType, spanMetricsPipelineName): nil,
 			},
 		},
 		{
-			name: "all processors with load balancing",
+			name: "hash",
+			cfg: `
+keys: ["user.ssn_?", "card.[!a]*"]
+action: hash
+`,
+			expectedProcessor: map[string]interface{}{
+				"actions": []map[string]interface{}{
+					{"pattern": `^user\.ssn_.$`, "action": "hash"},
+					{"pattern": `^card\.[^a].*$`, "action": "hash"},
+				},
+			},
+		},
+		{
+			name:        "unknown action",
+			cfg:         `{keys: [secret], action: mask}`,
+			expectedErr: "unsupported redact action 'mask', expected 'delete' or 'hash'",
+		},
+		{
+			name:        "no keys",
+			cfg:         `{action: hash}`,
+			expectedErr: "redact requires at least one key",
+		},
+		{
+			name:        "invalid glob",
+			cfg:         `{keys: ["secret.[abc"]}`,
+			expectedErr: "invalid redact key 'secret.[abc': unterminated character class",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg redactConfig
+			err := yaml.Unmarshal([]byte(tc.cfg), &cfg)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedProcessor, cfg.processor())
+		})
+	}
+}
+
+func TestRedactProcessor(t *testing.T) {
+	var redact redactConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`{keys: ["*.credit_card"], action: hash}`), &redact))
+
+	factory := attributesprocessor.NewFactory()
+	cfg := factory.CreateDefaultConfig()
+	require.NoError(t, component.UnmarshalConfig(confmap.NewFromStringMap(redact.processor()), cfg))
+
+	sink := new(consumertest.TracesSink)
+	proc, err := factory.CreateTracesProcessor(context.Background(), processortest.NewNopCreateSettings(), cfg, sink)
+	require.NoError(t, err)
+	require.NoError(t, proc.Start(context.Background(), componenttest.NewNopHost()))
+	defer func() { require.NoError(t, proc.Shutdown(context.Background())) }()
+
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.Attributes().PutStr("user.payment.credit_card", "4111111111111111")
+	span.Attributes().PutStr("http.method", "GET")
+	require.NoError(t, proc.ConsumeTraces(context.Background(), traces))
+
+	require.Len(t, sink.AllTraces(), 1)
+	attrs := sink.AllTraces()[0].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Attributes()
+
+	sum := sha1.Sum([]byte("4111111111111111"))
+	card, ok := attrs.Get("user.payment.credit_card")
+	require.True(t, ok)
+	require.Equal(t, hex.EncodeToString(sum[:]), card.Str())
+
+	method, ok := attrs.Get("http.method")
+	require.True(t, ok)
+	require.Equal(t, "GET", method.Str())
+}
+
+func TestSpanMetricsResourceDimensions(t *testing.T) {
+	cfgText := `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+spanmetrics:
+  resource_dimensions:
+    - name: k8s.cluster.name
+      default: unknown
+  metrics_instance: traces
+  metrics_flush_interval: 10ms
+`
+	var cfg InstanceConfig
+	require.NoError(t, yaml.Unmarshal([]byte(cfgText), &cfg))
+	otelConfig, err := cfg.otelConfig()
+	require.NoError(t, err)
+
+	// Drive spans through the spanmetrics processor built from the config,
+	// with the metrics exporter it sends the metrics to.
+	factories, err := tracingFactories()
+	require.NoError(t, err)
+	factory := factories.Processors["spanmetrics"]
+	proc, err := factory.CreateTracesProcessor(context.Background(), processortest.NewNopCreateSettings(),
+		otelConfig.Processors[component.NewID("spanmetrics")], new(consumertest.TracesSink))
+	require.NoError(t, err)
+
+	metrics := new(consumertest.MetricsSink)
+	host := &exportersHost{
+		Host: componenttest.NewNopHost(),
+		exporters: map[component.DataType]map[component.ID]component.Component{
+			component.DataTypeMetrics: {
+				component.NewID("remote_write"): &metricsExporter{Metrics: metrics},
+			},
+		},
+	}
+	require.NoError(t, proc.Start(context.Background(), host))
+	defer func() { require.NoError(t, proc.Shutdown(context.Background())) }()
+
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "app")
+	rs.Resource().Attributes().PutStr("k8s.cluster.name", "prod")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("GET /")
+	require.NoError(t, proc.ConsumeTraces(context.Background(), traces))
+
+	// The resource attribute is a dimension of the metrics, which the
+	// remote_write exporter writes as the k8s_cluster_name label.
+	require.Eventually(t, func() bool { return metrics.DataPointCount() > 0 }, 5*time.Second, 10*time.Millisecond)
+	md := metrics.AllMetrics()[0]
+	ms := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	for i := 0; i < ms.Len(); i++ {
+		m := ms.At(i)
+		var attrs pcommon.Map
+		switch m.Type() {
+		case pmetric.MetricTypeSum:
+			attrs = m.Sum().DataPoints().At(0).Attributes()
+		case pmetric.MetricTypeHistogram:
+			attrs = m.Histogram().DataPoints().At(0).Attributes()
+		default:
+			continue
+		}
+		cluster, ok := attrs.Get("k8s.cluster.name")
+		require.True(t, ok, "metric %s has no k8s.cluster.name attribute", m.Name())
+		require.Equal(t, "prod", cluster.Str())
+	}
+}
+
+func TestSpanMetricsMaxResourceDimensions(t *testing.T) {
+	resourceDimensions := func(n int) []spanmetricsprocessor.Dimension {
+		var res []spanmetricsprocessor.Dimension
+		for i := 0; i < n; i++ {
+			res = append(res, spanmetricsprocessor.Dimension{Name: fmt.Sprintf("resource.attr.%d", i)})
+		}
+		return res
+	}
+
+	tt := []struct {
+		name          string
+		cfg           SpanMetricsConfig
+		expectedCount int
+		expectedError string
+	}{
+		{
+			name:          "default limit",
+			cfg:           SpanMetricsConfig{ResourceDimensions: resourceDimensions(DefaultMaxResourceDimensions)},
+			expectedCount: DefaultMaxResourceDimensions,
+		},
+		{
+			name:          "above default limit",
+			cfg:           SpanMetricsConfig{ResourceDimensions: resourceDimensions(DefaultMaxResourceDimensions + 1)},
+			expectedError: "spanmetrics: at most 10 resource_dimensions can be copied to the dimensions, got 11",
+		},
+		{
+			name: "raised limit",
+			cfg: SpanMetricsConfig{
+				ResourceDimensions:    resourceDimensions(DefaultMaxResourceDimensions + 1),
+				MaxResourceDimensions: DefaultMaxResourceDimensions + 1,
+			},
+			expectedCount: DefaultMaxResourceDimensions + 1,
+		},
+		{
+			name: "dimensions already listed aren't counted",
+			cfg: SpanMetricsConfig{
+				Dimensions:            resourceDimensions(2),
+				ResourceDimensions:    resourceDimensions(3),
+				MaxResourceDimensions: 1,
+			},
+			expectedCount: 3,
+		},
+		{
+			name: "lowered limit",
+			cfg: SpanMetricsConfig{
+				ResourceDimensions:    resourceDimensions(2),
+				MaxResourceDimensions: 1,
+			},
+			expectedError: "spanmetrics: at most 1 resource_dimensions can be copied to the dimensions, got 2",
+		},
+		{
+			name:          "negative limit",
+			cfg:           SpanMetricsConfig{MaxResourceDimensions: -1},
+			expectedError: "spanmetrics: max_resource_dimensions must not be negative",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dimensions, err := tc.cfg.dimensions()
+			if tc.expectedError != "" {
+				require.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, dimensions, tc.expectedCount)
+		})
+	}
+
+	// The limit is checked when building the OpenTelemetry config.
+	cfgText := `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+spanmetrics:
+  resource_dimensions:
+    - name: k8s.cluster.name
+    - name: k8s.namespace.name
+  max_resource_dimensions: 1
+  metrics_instance: traces
+`
+	var cfg InstanceConfig
+	require.NoError(t, yaml.Unmarshal([]byte(cfgText), &cfg))
+	_, err := cfg.otelConfig()
+	require.ErrorContains(t, err, "raise max_resource_dimensions")
+}
+
+// exportersHost is a host which provides exporters to the processors which
+// send data to them, such as spanmetrics.
+type exportersHost struct {
+	component.Host
+	exporters map[component.DataType]map[component.ID]component.Component
+}
+
+func (h *exportersHost) GetExporters() map[component.DataType]map[component.ID]component.Component {
+	return h.exporters
+}
+
+type metricsExporter struct {
+	component.StartFunc
+	component.ShutdownFunc
+	consumer.Metrics
+}
+
+func TestScrubbedReceivers(t *testing.T) {
+	test := `
+receivers:
+  jaeger:
+    protocols:
+      grpc:`
+	var cfg InstanceConfig
+	err := yaml.Unmarshal([]byte(test), &cfg)
+	assert.Nil(t, err)
+	data, err := yaml.Marshal(cfg)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(data), "<secret>"))
+}
+
+func TestCreatingPushReceiver(t *testing.T) {
+	test := `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345`
+	cfg := InstanceConfig{}
+	err := yaml.Unmarshal([]byte(test), &cfg)
+	assert.Nil(t, err)
+	otel, err := cfg.otelConfig()
+	assert.Nil(t, err)
+	assert.Contains(t, otel.Service.Pipelines[component.NewID("traces")].Receivers, component.NewID(pushreceiver.TypeStr))
+}
+
+func TestReceiverValidation(t *testing.T) {
+	tt := []struct {
+		name        string
+		cfg         string
+		expectedErr []string
+	}{
+		{
+			name: "misspelled protocol",
+			cfg: `
+receivers:
+  otlp:
+    protocols:
+      grcp:
+remote_write:
+  - endpoint: example.com:12345`,
+			expectedErr: []string{`receiver "otlp"`, "'protocols' has invalid keys: grcp"},
+		},
+		{
+			name: "invalid endpoint",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+        endpoint: 0.0.0.0:notaport
+remote_write:
+  - endpoint: example.com:12345`,
+			expectedErr: []string{`receiver "jaeger"`, "gRPC endpoint"},
+		},
+		{
+			name: "unsupported receiver type",
+			cfg: `
+receivers:
+  signalfx:
+    endpoint: 0.0.0.0:9943
+remote_write:
+  - endpoint: example.com:12345`,
+			expectedErr: []string{
+				`receiver "signalfx": unknown receiver type "signalfx"`,
+				"supported types are: jaeger, kafka, noop, opencensus, otlp, push_receiver, zipkin",
+			},
+		},
+		{
+			name: "opencensus",
+			cfg: `
+receivers:
+  opencensus:
+    endpoint: 0.0.0.0:55678
+remote_write:
+  - endpoint: example.com:12345`,
+		},
+		{
+			name: "valid",
+			cfg: `
+receivers:
+  otlp:
+    protocols:
+      grpc:
+  jaeger:
+    protocols:
+      grpc:
+        endpoint: 0.0.0.0:14250
+remote_write:
+  - endpoint: example.com:12345`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg InstanceConfig
+			require.NoError(t, yaml.Unmarshal([]byte(tc.cfg), &cfg))
+			cfg.Name = "default"
+
+			_, err := cfg.otelConfig()
+			validateErr := (&Config{Configs: []InstanceConfig{cfg}}).Validate(nil)
+			if len(tc.expectedErr) == 0 {
+				require.NoError(t, err)
+				require.NoError(t, validateErr)
+				return
+			}
+			for _, expected := range tc.expectedErr {
+				require.ErrorContains(t, err, expected)
+				require.ErrorContains(t, validateErr, expected)
+			}
+		})
+	}
+}
+
+func TestHandlerEndpointValidation(t *testing.T) {
+	listenAddresses := map[string]string{
+		"HTTP server": "127.0.0.1:12345",
+		"gRPC server": "127.0.0.1:12346",
+	}
+	tt := []struct {
+		name        string
+		cfg         string
+		expectedErr string
+	}{
+		{
+			name: "jaeger thrift_http collision",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      thrift_http:
+        endpoint: 0.0.0.0:14268
+remote_write:
+  - endpoint: example.com:12345
+spanmetrics:
+  handler_endpoint: 127.0.0.1:14268`,
+			expectedErr: `spanmetrics: handler_endpoint "127.0.0.1:14268" uses the same port as receiver "jaeger" listening on "0.0.0.0:14268" (protocols.thrift_http.endpoint)`,
+		},
+		{
+			name: "agent HTTP server collision",
 			cfg: `
 receivers:
   jaeger:
@@ -1622,279 +3565,648 @@ receivers:
       grpc:
 remote_write:
   - endpoint: example.com:12345
-    headers:
-      x-some-header: Some value!
-attributes:
-  actions:
-  - key: montgomery
-    value: forever
-    action: update
 spanmetrics:
-  latency_histogram_buckets: [2ms, 6ms, 10ms, 100ms, 250ms]
-  dimensions:
-    - name: http.method
-      default: GET
-    - name: http.status_code
-  metrics_instance: traces
-automatic_logging:
-  spans: true
-batch:
-  timeout: 5s
-  send_batch_size: 100
-tail_sampling:
-  policies:
-    - type: always_sample
-    - type: string_attribute
-      string_attribute:
-        key: key
-        values:
-          - value1
-          - value2
+  handler_endpoint: 0.0.0.0:12345`,
+			expectedErr: `spanmetrics: handler_endpoint "0.0.0.0:12345" uses the same port as the agent HTTP server listening on "127.0.0.1:12345"`,
+		},
+		{
+			name: "jaeger thrift_compact is UDP",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      thrift_compact:
+        endpoint: 0.0.0.0:8889
+remote_write:
+  - endpoint: example.com:12345
+spanmetrics:
+  handler_endpoint: 0.0.0.0:8889`,
+		},
+		{
+			name: "same port on other interfaces",
+			cfg: `
+receivers:
+  jaeger:
+    protocols:
+      thrift_http:
+        endpoint: 127.0.0.1:14268
+remote_write:
+  - endpoint: example.com:12345
+spanmetrics:
+  handler_endpoint: 10.0.0.1:14268`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg InstanceConfig
+			require.NoError(t, yaml.Unmarshal([]byte(tc.cfg), &cfg))
+			cfg.Name = "default"
+
+			validateErr := (&Config{Configs: []InstanceConfig{cfg}, ListenAddresses: listenAddresses}).Validate(nil)
+			cfg.listenAddresses = listenAddresses
+			_, err := cfg.otelConfig()
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				require.NoError(t, validateErr)
+				return
+			}
+			require.EqualError(t, err, tc.expectedErr)
+			require.ErrorContains(t, validateErr, tc.expectedErr)
+		})
+	}
+}
+
+func TestOTelConfigDoesNotModifyReceivers(t *testing.T) {
+	test := `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
 load_balancing:
   exporter:
-    tls:
-      insecure: true
+    insecure: true
   resolver:
-    dns:
-      hostname: agent
-      port: 4318
-service_graphs:
-  enabled: true
-`,
-			expectedProcessors: map[component.ID][]component.ID{
-				component.NewIDWithName("traces", "0"): {
-					component.NewID("attributes"),
-				},
-				component.NewIDWithName("traces", "1"): {
-					component.NewID("spanmetrics"),
-					component.NewID("service_graphs"),
-					component.NewID("tail_sampling"),
-					component.NewID("automatic_logging"),
-					component.NewID("batch"),
-				},
-				component.NewIDWithName(spanMetricsPipelineType, spanMetricsPipelineName): nil,
-			},
+    static:
+      hostnames:
+        - agent-1:4318
+spanmetrics:
+  handler_endpoint: "0.0.0.0:8889"`
+	cfg := InstanceConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(test), &cfg))
+
+	for i := 0; i < 2; i++ {
+		otel, err := cfg.otelConfig()
+		require.NoError(t, err)
+		require.Len(t, cfg.Receivers, 1)
+		require.ElementsMatch(t,
+			[]component.ID{component.NewID("jaeger"), component.NewID(pushreceiver.TypeStr)},
+			otel.Service.Pipelines[component.NewIDWithName("traces", "0")].Receivers,
+		)
+	}
+}
+
+func TestSendingQueueValidation(t *testing.T) {
+	tt := []struct {
+		name             string
+		cfg              string
+		expectedQueue    map[string]interface{}
+		expectedWarnings []string
+		expectedErr      string
+	}{
+		{
+			name: "valid custom queue",
+			cfg: `
+remote_write:
+  - endpoint: example.com:12345
+    sending_queue:
+      num_consumers: 4
+      queue_size: 500`,
+			expectedQueue: map[string]interface{}{"num_consumers": 4, "queue_size": 500},
+		},
+		{
+			name: "zero queue size",
+			cfg: `
+remote_write:
+  - endpoint: example.com:12345
+    sending_queue:
+      queue_size: 0`,
+			expectedQueue:    map[string]interface{}{"enabled": false},
+			expectedWarnings: []string{"remote_write[0]: sending_queue.queue_size is 0"},
+		},
+		{
+			name: "disabled",
+			cfg: `
+remote_write:
+  - endpoint: example.com:12345
+    sending_queue:
+      enabled: false`,
+			expectedQueue:    map[string]interface{}{"enabled": false},
+			expectedWarnings: []string{"remote_write[0]: sending_queue is disabled"},
+		},
+		{
+			name: "queue smaller than batch",
+			cfg: `
+batch:
+  send_batch_size: 100
+remote_write:
+  - endpoint: example.com:12345
+    sending_queue:
+      num_consumers: 10
+      queue_size: 50`,
+			expectedQueue:    map[string]interface{}{"num_consumers": 10, "queue_size": 50},
+			expectedWarnings: []string{"remote_write[0]: sending_queue.queue_size (50) is lower than batch.send_batch_size (100)"},
+		},
+		{
+			name: "queue smaller than batch of throughput_profile",
+			cfg: `
+throughput_profile: high
+remote_write:
+  - endpoint: example.com:12345
+    sending_queue:
+      queue_size: 5000`,
+			expectedQueue:    map[string]interface{}{"queue_size": 5000},
+			expectedWarnings: []string{"remote_write[0]: sending_queue.queue_size (5000) is lower than batch.send_batch_size (8192)"},
+		},
+		{
+			name: "queue larger than batch",
+			cfg: `
+batch:
+  send_batch_size: 100
+remote_write:
+  - endpoint: example.com:12345
+    sending_queue:
+      num_consumers: 10
+      queue_size: 500`,
+			expectedQueue: map[string]interface{}{"num_consumers": 10, "queue_size": 500},
+		},
+		{
+			name: "negative consumers",
+			cfg: `
+remote_write:
+  - endpoint: example.com:12345
+    sending_queue:
+      num_consumers: -1`,
+			expectedErr: "sending_queue.num_consumers must not be negative, got -1",
+		},
+		{
+			name: "default consumers above max_concurrent_requests",
+			cfg: `
+remote_write:
+  - endpoint: example.com:12345
+    max_concurrent_requests: 3`,
+			expectedQueue: map[string]interface{}{"num_consumers": 3},
+		},
+		{
+			name: "consumers above max_concurrent_requests",
+			cfg: `
+remote_write:
+  - endpoint: example.com:12345
+    max_concurrent_requests: 3
+    sending_queue:
+      num_consumers: 20
+      queue_size: 500`,
+			expectedQueue: map[string]interface{}{"num_consumers": 3, "queue_size": 500},
+		},
+		{
+			name: "consumers within max_concurrent_requests",
+			cfg: `
+remote_write:
+  - endpoint: example.com:12345
+    max_concurrent_requests: 30
+    sending_queue:
+      num_consumers: 20`,
+			expectedQueue: map[string]interface{}{"num_consumers": 20},
+		},
+		{
+			name: "max_concurrent_requests with disabled queue",
+			cfg: `
+remote_write:
+  - endpoint: example.com:12345
+    max_concurrent_requests: 3
+    sending_queue:
+      enabled: false`,
+			expectedQueue:    map[string]interface{}{"enabled": false},
+			expectedWarnings: []string{"remote_write[0]: sending_queue is disabled"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg InstanceConfig
+			require.NoError(t, yaml.Unmarshal([]byte(tc.cfg), &cfg))
+			cfg.Name = "default"
+			cfg.Receivers = map[string]interface{}{"otlp": map[string]interface{}{"protocols": map[string]interface{}{"grpc": nil}}}
+
+			_, err := cfg.otelConfig()
+			validateErr := (&Config{Configs: []InstanceConfig{cfg}}).Validate(nil)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				require.ErrorContains(t, validateErr, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, validateErr)
+
+			exp, err := exporter(cfg.RemoteWrite[0])
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedQueue, exp["sending_queue"])
+
+			diags := cfg.sendingQueueDiagnostics()
+			require.Len(t, diags, len(tc.expectedWarnings))
+			for i, expected := range tc.expectedWarnings {
+				require.Equal(t, diag.SeverityLevelWarn, diags[i].Severity)
+				require.Contains(t, diags[i].Message, expected)
+			}
+		})
+	}
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	var cfg InstanceConfig
+	err := yaml.Unmarshal([]byte(`
+remote_write:
+  - endpoint: example.com:12345
+    max_concurrent_requests: -1`), &cfg)
+	require.EqualError(t, err, "max_concurrent_requests must not be negative, got -1")
+
+	require.NoError(t, yaml.Unmarshal([]byte(`
+remote_write:
+  - endpoint: example.com:12345
+    max_concurrent_requests: 5
+  - endpoint: example.com:12346
+    protocol: http
+`), &cfg))
+
+	factories, err := tracingFactories()
+	require.NoError(t, err)
+	limited, err := cfg.withExporterLimits(factories)
+	require.NoError(t, err)
+
+	// Only the factories of the exporters with a limit are wrapped.
+	require.NotEqual(t, fmt.Sprintf("%T", factories.Exporters["otlp"]), fmt.Sprintf("%T", limited.Exporters["otlp"]))
+	require.Equal(t, factories.Exporters["otlphttp"], limited.Exporters["otlphttp"])
+	require.Equal(t, factories.Exporters["otlp"].Type(), limited.Exporters["otlp"].Type())
+}
+
+func TestOtelTLSVersion(t *testing.T) {
+	v, err := otelTLSVersion(0)
+	require.NoError(t, err)
+	require.Empty(t, v)
+
+	v, err = otelTLSVersion(prom_config.TLSVersion(tls.VersionTLS12))
+	require.NoError(t, err)
+	require.Equal(t, "1.2", v)
+
+	// Versions unknown to the collector, such as SSL 3.0, are rejected.
+	_, err = otelTLSVersion(prom_config.TLSVersion(0x0300))
+	require.EqualError(t, err, "unknown TLS version 0x0300")
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("passwordfromfile\n"), 0600))
+
+	test := fmt.Sprintf(`
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    headers:
+      x-api-key: someapikey
+    basic_auth:
+      username: test
+      password_file: %s
+  - endpoint: example.com:443
+    protocol: http
+    oauth2:
+      client_id: someclientid
+      client_secret: someclientsecret
+      token_url: https://example.com/oauth2/default/v1/token
+`, passwordFile)
+	cfg := InstanceConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(test), &cfg))
+
+	effective, err := cfg.effectiveConfig()
+	require.NoError(t, err)
+
+	out, err := yaml.Marshal(effective)
+	require.NoError(t, err)
+	for _, secret := range []string{
+		"someapikey",
+		"passwordfromfile",
+		base64.StdEncoding.EncodeToString([]byte("test:passwordfromfile")),
+		"someclientsecret",
+	} {
+		require.NotContains(t, string(out), secret)
+	}
+
+	exporters := effective["exporters"].(map[string]interface{})
+	require.Len(t, exporters, 2)
+
+	grpcExporter := exporters["otlp/0"].(map[string]interface{})
+	require.Equal(t, "example.com:12345", grpcExporter["endpoint"])
+	require.Equal(t, map[string]interface{}{
+		"authorization": secretMarshalString,
+		"x-api-key":     secretMarshalString,
+	}, grpcExporter["headers"])
+
+	httpExporter := exporters["otlphttp/0"].(map[string]interface{})
+	require.Equal(t, "example.com:443", httpExporter["endpoint"])
+	require.Equal(t, map[string]interface{}{"authenticator": "oauth2client/otlphttp0"}, httpExporter["auth"])
+
+	extensions := effective["extensions"].(map[string]interface{})
+	oauth2 := extensions["oauth2client/otlphttp0"].(map[string]interface{})
+	require.Equal(t, "someclientid", oauth2["client_id"])
+	require.Equal(t, secretMarshalString, oauth2["client_secret"])
+
+	// Defaults of the components are included.
+	require.Contains(t, grpcExporter, "sending_queue")
+	require.Contains(t, grpcExporter, "timeout")
+
+	service := effective["service"].(map[string]interface{})
+	pipeline := service["pipelines"].(map[string]interface{})["traces"].(map[string]interface{})
+	require.ElementsMatch(t, []interface{}{"otlp/0", "otlphttp/0"}, pipeline["exporters"])
+	require.ElementsMatch(t, []interface{}{"oauth2client/otlphttp0"}, service["extensions"])
+}
+
+func TestThroughputProfile(t *testing.T) {
+	tt := []struct {
+		name            string
+		profile         string
+		expectedBatch   map[string]interface{}
+		expectedQueue   map[string]interface{}
+		expectedRetries map[string]interface{}
+	}{
+		{
+			name:            "low",
+			profile:         "low",
+			expectedBatch:   map[string]interface{}{"send_batch_size": 256, "send_batch_max_size": 512, "timeout": "5s"},
+			expectedQueue:   map[string]interface{}{"num_consumers": 2, "queue_size": 100},
+			expectedRetries: map[string]interface{}{"initial_interval": "5s", "max_interval": "30s", "max_elapsed_time": "300s"},
 		},
 		{
-			name: "load balancing without tail sampling",
-			cfg: `
+			name:            "medium",
+			profile:         "medium",
+			expectedBatch:   map[string]interface{}{"send_batch_size": 2048, "send_batch_max_size": 4096, "timeout": "2s"},
+			expectedQueue:   map[string]interface{}{"num_consumers": 5, "queue_size": 1000},
+			expectedRetries: map[string]interface{}{"initial_interval": "5s", "max_interval": "30s", "max_elapsed_time": "120s"},
+		},
+		{
+			name:            "high",
+			profile:         "high",
+			expectedBatch:   map[string]interface{}{"send_batch_size": 8192, "send_batch_max_size": 16384, "timeout": "1s"},
+			expectedQueue:   map[string]interface{}{"num_consumers": 10, "queue_size": 5000},
+			expectedRetries: map[string]interface{}{"initial_interval": "1s", "max_interval": "10s", "max_elapsed_time": "60s"},
+		},
+		{
+			name:            "spans per second",
+			profile:         "3000",
+			expectedBatch:   map[string]interface{}{"send_batch_size": 2048, "send_batch_max_size": 4096, "timeout": "2s"},
+			expectedQueue:   map[string]interface{}{"num_consumers": 5, "queue_size": 1000},
+			expectedRetries: map[string]interface{}{"initial_interval": "5s", "max_interval": "30s", "max_elapsed_time": "120s"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			test := fmt.Sprintf(`
 receivers:
   jaeger:
     protocols:
       grpc:
 remote_write:
   - endpoint: example.com:12345
-    headers:
-      x-some-header: Some value!
-attributes:
-  actions:
-  - key: montgomery
-    value: forever
-    action: update
-spanmetrics:
-  latency_histogram_buckets: [2ms, 6ms, 10ms, 100ms, 250ms]
-  dimensions:
-    - name: http.method
-      default: GET
-    - name: http.status_code
-  metrics_instance: traces
-automatic_logging:
-  spans: true
-batch:
-  timeout: 5s
-  send_batch_size: 100
-load_balancing:
-  exporter:
-    tls:
-      insecure: true
-  resolver:
-    dns:
-      hostname: agent
-      port: 4318
-`,
-			expectedProcessors: map[component.ID][]component.ID{
-				component.NewIDWithName("traces", "0"): {
-					component.NewID("attributes"),
-				},
-				component.NewIDWithName("traces", "1"): {
-					component.NewID("spanmetrics"),
-					component.NewID("automatic_logging"),
-					component.NewID("batch"),
-				},
-				component.NewIDWithName(spanMetricsPipelineType, spanMetricsPipelineName): nil,
-			},
-		},
-	}
+throughput_profile: %s
+`, tc.profile)
+			cfg := InstanceConfig{}
+			require.NoError(t, yaml.Unmarshal([]byte(test), &cfg))
 
-	for _, tc := range tt {
-		t.Run(tc.name, func(t *testing.T) {
-			var cfg InstanceConfig
-			err := yaml.Unmarshal([]byte(tc.cfg), &cfg)
-			require.NoError(t, err)
+			derived := cfg.withThroughputDefaults()
+			require.Equal(t, tc.expectedBatch, derived.Batch)
+			require.Equal(t, tc.expectedQueue, derived.RemoteWrite[0].SendingQueue)
+			require.Equal(t, tc.expectedRetries, derived.RemoteWrite[0].RetryOnFailure)
 
-			// check error
-			actualConfig, err := cfg.otelConfig()
+			// The config itself isn't modified.
+			require.Nil(t, cfg.Batch)
+			require.Nil(t, cfg.RemoteWrite[0].SendingQueue)
+			require.Nil(t, cfg.RemoteWrite[0].RetryOnFailure)
+
+			// The derived values are part of the effective config.
+			effective, err := cfg.effectiveConfig()
 			require.NoError(t, err)
 
-			require.Equal(t, len(tc.expectedProcessors), len(actualConfig.Service.Pipelines))
-			for componentID := range tc.expectedProcessors {
-				if len(tc.expectedProcessors[componentID]) > 0 {
-					assert.NotNil(t, tc.expectedProcessors)
-					assert.NotNil(t, actualConfig.Service.Pipelines[componentID])
+			batch := effective["processors"].(map[string]interface{})["batch"].(map[string]interface{})
+			require.EqualValues(t, tc.expectedBatch["send_batch_size"], batch["send_batch_size"])
+			require.EqualValues(t, tc.expectedBatch["send_batch_max_size"], batch["send_batch_max_size"])
+			requireDuration(t, tc.expectedBatch["timeout"], batch["timeout"])
 
-					assert.Equal(t, tc.expectedProcessors[componentID], actualConfig.Service.Pipelines[componentID].Processors)
-				}
+			exporter := effective["exporters"].(map[string]interface{})["otlp/0"].(map[string]interface{})
+			queue := exporter["sending_queue"].(map[string]interface{})
+			require.EqualValues(t, tc.expectedQueue["num_consumers"], queue["num_consumers"])
+			require.EqualValues(t, tc.expectedQueue["queue_size"], queue["queue_size"])
+
+			retries := exporter["retry_on_failure"].(map[string]interface{})
+			for _, key := range []string{"initial_interval", "max_interval", "max_elapsed_time"} {
+				requireDuration(t, tc.expectedRetries[key], retries[key])
 			}
 		})
 	}
+
+	t.Run("explicit settings win", func(t *testing.T) {
+		test := `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    sending_queue:
+      queue_size: 42
+  - endpoint: example.com:12346
+    retry_on_failure:
+      max_elapsed_time: 10s
+batch:
+  disabled: true
+throughput_profile: high
+`
+		cfg := InstanceConfig{}
+		require.NoError(t, yaml.Unmarshal([]byte(test), &cfg))
+
+		derived := cfg.withThroughputDefaults()
+		require.Equal(t, map[string]interface{}{"disabled": true}, derived.Batch)
+		require.Equal(t, map[string]interface{}{"queue_size": 42}, derived.RemoteWrite[0].SendingQueue)
+		require.Equal(t, tt[2].expectedRetries, derived.RemoteWrite[0].RetryOnFailure)
+		require.Equal(t, tt[2].expectedQueue, derived.RemoteWrite[1].SendingQueue)
+		require.Equal(t, map[string]interface{}{"max_elapsed_time": "10s"}, derived.RemoteWrite[1].RetryOnFailure)
+
+		effective, err := cfg.effectiveConfig()
+		require.NoError(t, err)
+		processors, _ := effective["processors"].(map[string]interface{})
+		require.NotContains(t, processors, "batch")
+	})
+
+	t.Run("invalid profile", func(t *testing.T) {
+		for _, profile := range []string{"huge", "0", "-10"} {
+			cfg := InstanceConfig{}
+			err := yaml.Unmarshal([]byte("throughput_profile: "+profile), &cfg)
+			require.ErrorContains(t, err, fmt.Sprintf("invalid throughput_profile '%s'", profile))
+		}
+	})
 }
 
-func TestOrderProcessors(t *testing.T) {
-	tests := []struct {
-		processors     []string
-		splitPipelines bool
-		expected       [][]string
+// requireDuration asserts that actual is the duration expected, a string
+// parsed by time.ParseDuration.
+func requireDuration(t *testing.T, expected, actual interface{}) {
+	t.Helper()
+	d, err := time.ParseDuration(expected.(string))
+	require.NoError(t, err)
+	require.Equal(t, d.String(), fmt.Sprint(actual))
+}
+
+func TestTenantRoutingValidation(t *testing.T) {
+	tt := []struct {
+		name        string
+		cfg         string
+		expectedErr string
 	}{
 		{
-			expected: [][]string{
-				nil,
-			},
+			name: "valid",
+			cfg: `
+endpoint: example.com:12345
+tenant_routing:
+  attribute: team
+  mapping:
+    checkout: team-a
+  default_tenant: shared`,
 		},
 		{
-			processors: []string{
-				"tail_sampling",
-			},
-			expected: [][]string{
-				{"tail_sampling"},
-			},
+			name: "missing attribute",
+			cfg: `
+endpoint: example.com:12345
+tenant_routing:
+  mapping:
+    checkout: team-a
+  default_tenant: shared`,
+			expectedErr: "tenant_routing: attribute must be set",
 		},
 		{
-			processors: []string{
-				"batch",
-				"tail_sampling",
-				"automatic_logging",
-			},
-			expected: [][]string{
-				{
-					"tail_sampling",
-					"automatic_logging",
-					"batch",
-				},
-			},
+			name: "empty mapping",
+			cfg: `
+endpoint: example.com:12345
+tenant_routing:
+  attribute: team
+  default_tenant: shared`,
+			expectedErr: "tenant_routing: mapping must not be empty",
 		},
 		{
-			processors: []string{
-				"spanmetrics",
-				"batch",
-				"tail_sampling",
-				"attributes",
-				"automatic_logging",
-			},
-			expected: [][]string{
-				{
-					"attributes",
-					"spanmetrics",
-					"tail_sampling",
-					"automatic_logging",
-					"batch",
-				},
-			},
+			name: "no fallback",
+			cfg: `
+endpoint: example.com:12345
+tenant_routing:
+  attribute: team
+  mapping:
+    checkout: team-a`,
+			expectedErr: "tenant_routing: one of default_tenant or drop_unmatched must be set",
 		},
 		{
-			splitPipelines: true,
-			expected: [][]string{
-				nil,
-				nil,
-			},
+			name: "both fallbacks",
+			cfg: `
+endpoint: example.com:12345
+tenant_routing:
+  attribute: team
+  mapping:
+    checkout: team-a
+  default_tenant: shared
+  drop_unmatched: true`,
+			expectedErr: "tenant_routing: default_tenant and drop_unmatched are mutually exclusive",
 		},
 		{
-			processors: []string{
-				"spanmetrics",
-				"batch",
-				"tail_sampling",
-				"attributes",
-				"automatic_logging",
-			},
-			splitPipelines: true,
-			expected: [][]string{
-				{
-					"attributes",
-				},
-				{
-					"spanmetrics",
-					"tail_sampling",
-					"automatic_logging",
-					"batch",
-				},
-			},
+			name: "tenant header",
+			cfg: `
+endpoint: example.com:12345
+headers:
+  x-scope-orgid: team-a
+tenant_routing:
+  attribute: team
+  mapping:
+    checkout: team-a
+  drop_unmatched: true`,
+			expectedErr: "the X-Scope-OrgID header can't be set when tenant_routing is configured",
 		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg RemoteWriteConfig
+			err := yaml.Unmarshal([]byte(tc.cfg), &cfg)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestHeaderTemplatesValidation(t *testing.T) {
+	tt := []struct {
+		name        string
+		cfg         string
+		expectedErr string
+	}{
 		{
-			processors: []string{
-				"batch",
-				"tail_sampling",
-				"automatic_logging",
-			},
-			splitPipelines: true,
-			expected: [][]string{
-				{},
-				{
-					"tail_sampling",
-					"automatic_logging",
-					"batch",
-				},
-			},
+			name:        "grpc",
+			cfg:         "endpoint: example.com:12345\nheaders:\n  X-Service: ${resource.service.name}",
+			expectedErr: "header X-Service references resource attributes, which is only supported by the otlp format over http",
 		},
 		{
-			processors: []string{
-				"spanmetrics",
-				"attributes",
-			},
-			splitPipelines: true,
-			expected: [][]string{
-				{
-					"attributes",
-				},
-				{
-					"spanmetrics",
-				},
-			},
+			name:        "jaeger",
+			cfg:         "endpoint: example.com:12345\nformat: jaeger\nheaders:\n  X-Service: ${resource.service.name}",
+			expectedErr: "only supported by the otlp format over http",
+		},
+		{
+			name:        "oauth2",
+			cfg:         "endpoint: example.com:12345\nprotocol: http\noauth2:\n  client_id: id\nheaders:\n  X-Service: ${resource.service.name}",
+			expectedErr: "can't be combined with oauth2",
 		},
 	}
 
-	for _, tc := range tests {
-		actual := orderProcessors(tc.processors, tc.splitPipelines)
-		assert.Equal(t, tc.expected, actual)
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg RemoteWriteConfig
+			err := yaml.Unmarshal([]byte(tc.cfg), &cfg)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
 	}
+
+	// Literal headers can be used with grpc.
+	var cfg RemoteWriteConfig
+	require.NoError(t, yaml.Unmarshal([]byte("endpoint: example.com:12345\nheaders:\n  X-Service: checkout"), &cfg))
 }
 
-func TestScrubbedReceivers(t *testing.T) {
-	test := `
-receivers:
-  jaeger:
-    protocols:
-      grpc:`
-	var cfg InstanceConfig
-	err := yaml.Unmarshal([]byte(test), &cfg)
-	assert.Nil(t, err)
-	data, err := yaml.Marshal(cfg)
-	assert.Nil(t, err)
-	assert.True(t, strings.Contains(string(data), "<secret>"))
+func TestSamplePercentageValidation(t *testing.T) {
+	for _, percentage := range []string{"-1", "101"} {
+		var cfg RemoteWriteConfig
+		err := yaml.Unmarshal([]byte("endpoint: example.com:12345\nsample_percentage: "+percentage), &cfg)
+		require.ErrorContains(t, err, "sample_percentage must be between 0 and 100")
+	}
 }
 
-func TestCreatingPushReceiver(t *testing.T) {
-	test := `
-receivers:
-  jaeger:
-    protocols:
-      grpc:
-remote_write:
-  - endpoint: example.com:12345`
-	cfg := InstanceConfig{}
-	err := yaml.Unmarshal([]byte(test), &cfg)
-	assert.Nil(t, err)
-	otel, err := cfg.otelConfig()
-	assert.Nil(t, err)
-	assert.Contains(t, otel.Service.Pipelines[component.NewID("traces")].Receivers, component.NewID(pushreceiver.TypeStr))
+func TestWithoutSideEffects(t *testing.T) {
+	require.Equal(t,
+		[]string{"attributes", "tail_sampling", "batch"},
+		withoutSideEffects([]string{"attributes", "spanmetrics", "service_graphs", "tail_sampling", "automatic_logging", "batch"}),
+	)
+}
+
+func TestTenantRoutes(t *testing.T) {
+	cfg := TenantRoutingConfig{
+		Attribute: "team",
+		Mapping: map[string]string{
+			"checkout": "team-a",
+			"search":   "team-b",
+		},
+		DefaultTenant: "team-b",
+	}
+
+	// The default tenant receives the unmatched spans on top of its own.
+	require.Equal(t, []tenantRoute{
+		{
+			tenant:     "team-a",
+			exporter:   "otlphttp/2/team-a",
+			conditions: []string{`resource.attributes["team"] != "checkout"`},
+		},
+		{
+			tenant:     "team-b",
+			exporter:   "otlphttp/2/team-b",
+			conditions: []string{`resource.attributes["team"] == "checkout"`},
+		},
+	}, cfg.routes("otlphttp/2"))
 }
 
 func TestUnmarshalYAMLEmptyOTLP(t *testing.T) {
@@ -1918,6 +4230,36 @@ receivers:
 	require.Contains(t, err.Error(), "otlp receiver requires a \"protocols\" field which must be a YAML map: otlp")
 }
 
+func TestUnmarshalYAMLUnknownKeys(t *testing.T) {
+	t.Run("typoed key", func(t *testing.T) {
+		test := `
+tail_samplng:
+  policies:
+    - type: always_sample`
+		cfg := InstanceConfig{}
+		err := yaml.Unmarshal([]byte(test), &cfg)
+		require.EqualError(t, err, `invalid traces config: unknown key "tail_samplng", did you mean "tail_sampling"?`)
+	})
+
+	t.Run("unrelated key", func(t *testing.T) {
+		cfg := InstanceConfig{}
+		err := yaml.Unmarshal([]byte("not_a_traces_key: true"), &cfg)
+		require.EqualError(t, err, `invalid traces config: unknown key "not_a_traces_key"`)
+	})
+
+	t.Run("unknown keys in receivers", func(t *testing.T) {
+		test := `
+receivers:
+  otlp/custom:
+    protocols:
+      grpc:
+    some_future_setting: true`
+		cfg := InstanceConfig{}
+		require.NoError(t, yaml.Unmarshal([]byte(test), &cfg))
+		require.Contains(t, cfg.Receivers, "otlp/custom")
+	})
+}
+
 // sortService is a helper function to lexicographically sort all
 // the possibly unsorted elements of a given cfg.Service
 func sortService(cfg *otelcol.Config) {
@@ -0,0 +1,243 @@
+// Package debugfilter keeps or drops spans by trace ID or resource
+// attributes, to capture a single trace or to drop the traffic of a
+// misbehaving client during an incident.
+//
+// The rules are applied by wrapping the consumer receivers push spans to,
+// before any processor of the pipeline sees them. They can be updated while
+// the receivers run.
+package debugfilter
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/receiver"
+	"go.uber.org/zap"
+)
+
+const (
+	// ActionAllow keeps the spans matching the rule. Once a rule allows
+	// spans, the spans not allowed by any rule are dropped.
+	ActionAllow = "allow"
+	// ActionDeny drops the spans matching the rule, even if they are allowed
+	// by another rule.
+	ActionDeny = "deny"
+)
+
+// Config is a list of rules keeping or dropping spans.
+type Config struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule matches the spans whose trace ID starts with TraceIDPrefix and whose
+// resource has all of ResourceAttributes. At least one of them must be set.
+type Rule struct {
+	// Action is either ActionAllow or ActionDeny.
+	Action string `yaml:"action"`
+	// TraceIDPrefix is a prefix of the hex-encoded trace ID.
+	TraceIDPrefix string `yaml:"trace_id_prefix,omitempty"`
+	// ResourceAttributes are matched against the string value of the
+	// resource attributes of the same keys.
+	ResourceAttributes map[string]string `yaml:"resource_attributes,omitempty"`
+	// ExpiresAt is the time after which the rule is ignored. The zero time
+	// means the rule never expires.
+	ExpiresAt time.Time `yaml:"expires_at,omitempty"`
+}
+
+// Validate returns an error if the config is invalid.
+func (c *Config) Validate() error {
+	if len(c.Rules) == 0 {
+		return fmt.Errorf("debug_filter: at least one rule is required")
+	}
+	for i, r := range c.Rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("debug_filter: rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) validate() error {
+	switch r.Action {
+	case ActionAllow, ActionDeny:
+	default:
+		return fmt.Errorf("unsupported action %q, must be one of %q or %q", r.Action, ActionAllow, ActionDeny)
+	}
+	if r.TraceIDPrefix == "" && len(r.ResourceAttributes) == 0 {
+		return fmt.Errorf("trace_id_prefix or resource_attributes is required")
+	}
+	if len(r.TraceIDPrefix) > 2*len(pcommon.TraceID{}) {
+		return fmt.Errorf("trace_id_prefix %q is longer than a trace ID", r.TraceIDPrefix)
+	}
+	for _, ch := range r.TraceIDPrefix {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", ch) {
+			return fmt.Errorf("trace_id_prefix %q must be hex-encoded", r.TraceIDPrefix)
+		}
+	}
+	return nil
+}
+
+// rule is a Rule applied by a Filter.
+type rule struct {
+	Rule
+	index       int
+	expiredOnce sync.Once
+}
+
+func (r *rule) expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && now.After(r.ExpiresAt)
+}
+
+func (r *rule) matches(traceID string, res pcommon.Map) bool {
+	if !strings.HasPrefix(traceID, r.TraceIDPrefix) {
+		return false
+	}
+	for key, want := range r.ResourceAttributes {
+		v, ok := res.Get(key)
+		if !ok || v.AsString() != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter holds the rules applied to the spans of the receivers of a
+// pipeline.
+type Filter struct {
+	logger *zap.Logger
+	rules  atomic.Pointer[[]*rule]
+}
+
+// New creates a Filter without rules, which keeps every span.
+func New(logger *zap.Logger) *Filter {
+	return &Filter{logger: logger}
+}
+
+// Update replaces the rules of the Filter with the ones of cfg, which must be
+// valid. A nil cfg removes every rule.
+func (f *Filter) Update(cfg *Config) {
+	var rules []*rule
+	if cfg != nil {
+		rules = make([]*rule, 0, len(cfg.Rules))
+		for i, r := range cfg.Rules {
+			r.TraceIDPrefix = strings.ToLower(r.TraceIDPrefix)
+			rules = append(rules, &rule{Rule: r, index: i})
+		}
+	}
+	f.rules.Store(&rules)
+
+	// Report the rules which expired before being applied right away.
+	f.activeRules(time.Now())
+}
+
+// activeRules returns the rules which didn't expire at now. A warning is
+// logged once for each expired rule.
+func (f *Filter) activeRules(now time.Time) []*rule {
+	rules := f.rules.Load()
+	if rules == nil {
+		return nil
+	}
+
+	active := make([]*rule, 0, len(*rules))
+	for _, r := range *rules {
+		if !r.expired(now) {
+			active = append(active, r)
+			continue
+		}
+		r.expiredOnce.Do(func() {
+			f.logger.Warn("debug_filter rule expired, ignoring it",
+				zap.Int("rule", r.index),
+				zap.String("action", r.Action),
+				zap.Time("expires_at", r.ExpiresAt),
+			)
+		})
+	}
+	return active
+}
+
+// keep returns whether the span with the given trace ID and resource
+// attributes is kept by rules.
+func keep(rules []*rule, traceID pcommon.TraceID, res pcommon.Map) bool {
+	id := hex.EncodeToString(traceID[:])
+
+	var allowRules, allowed bool
+	for _, r := range rules {
+		matches := r.matches(id, res)
+		switch r.Action {
+		case ActionDeny:
+			if matches {
+				return false
+			}
+		case ActionAllow:
+			allowRules = true
+			allowed = allowed || matches
+		}
+	}
+	return !allowRules || allowed
+}
+
+// Consumer wraps next, the consumer a receiver pushes spans to, so that it
+// only receives the spans kept by the rules of f.
+func (f *Filter) Consumer(next consumer.Traces) consumer.Traces {
+	return &filteredConsumer{next: next, filter: f}
+}
+
+type filteredConsumer struct {
+	next   consumer.Traces
+	filter *Filter
+}
+
+var _ consumer.Traces = (*filteredConsumer)(nil)
+
+// Capabilities implements consumer.Traces.
+func (c *filteredConsumer) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: true}
+}
+
+// ConsumeTraces implements consumer.Traces.
+func (c *filteredConsumer) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	rules := c.filter.activeRules(time.Now())
+	if len(rules) == 0 {
+		return c.next.ConsumeTraces(ctx, td)
+	}
+
+	td.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		res := rs.Resource().Attributes()
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				return !keep(rules, span.TraceID(), res)
+			})
+			return ss.Spans().Len() == 0
+		})
+		return rs.ScopeSpans().Len() == 0
+	})
+	if td.ResourceSpans().Len() == 0 {
+		return nil
+	}
+	return c.next.ConsumeTraces(ctx, td)
+}
+
+// NewFactory wraps f so that the trace receivers it creates only push the
+// spans kept by filter.
+func NewFactory(f receiver.Factory, filter *Filter) receiver.Factory {
+	return &factory{Factory: f, filter: filter}
+}
+
+type factory struct {
+	receiver.Factory
+	filter *Filter
+}
+
+// CreateTracesReceiver implements receiver.Factory.
+func (f *factory) CreateTracesReceiver(ctx context.Context, set receiver.CreateSettings, cfg component.Config, next consumer.Traces) (receiver.Traces, error) {
+	return f.Factory.CreateTracesReceiver(ctx, set, cfg, f.filter.Consumer(next))
+}
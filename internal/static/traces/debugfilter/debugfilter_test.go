@@ -0,0 +1,198 @@
+package debugfilter
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type testSpan struct {
+	service string
+	traceID string
+}
+
+var testSpans = []testSpan{
+	{service: "api", traceID: "0af7651916cd43dd8448eb211c80319c"},
+	{service: "api", traceID: "4bf92f3577b34da6a3ce929d0e0e4736"},
+	{service: "noisy", traceID: "0af7651916cd43dd8448eb211c80319c"},
+	{service: "noisy", traceID: "5b8efff798038103d269b633813fc60c"},
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []Rule
+		expected []testSpan
+	}{
+		{
+			name:     "no rules",
+			expected: testSpans,
+		},
+		{
+			name: "allow only",
+			rules: []Rule{
+				{Action: ActionAllow, TraceIDPrefix: "0AF765"},
+			},
+			expected: []testSpan{testSpans[0], testSpans[2]},
+		},
+		{
+			name: "deny only",
+			rules: []Rule{
+				{Action: ActionDeny, ResourceAttributes: map[string]string{"service.name": "noisy"}},
+			},
+			expected: []testSpan{testSpans[0], testSpans[1]},
+		},
+		{
+			name: "deny overrides allow",
+			rules: []Rule{
+				{Action: ActionAllow, TraceIDPrefix: "0af765"},
+				{Action: ActionDeny, ResourceAttributes: map[string]string{"service.name": "noisy"}},
+			},
+			expected: []testSpan{testSpans[0]},
+		},
+		{
+			name: "all conditions of a rule must match",
+			rules: []Rule{
+				{Action: ActionDeny, TraceIDPrefix: "0af765", ResourceAttributes: map[string]string{"service.name": "noisy"}},
+			},
+			expected: []testSpan{testSpans[0], testSpans[1], testSpans[3]},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := New(zap.NewNop())
+			if tc.rules != nil {
+				cfg := &Config{Rules: tc.rules}
+				require.NoError(t, cfg.Validate())
+				f.Update(cfg)
+			}
+
+			sink := new(consumertest.TracesSink)
+			require.NoError(t, f.Consumer(sink).ConsumeTraces(context.Background(), newTraces(t, testSpans)))
+			require.Equal(t, tc.expected, receivedSpans(sink))
+		})
+	}
+}
+
+func TestFilter_DropsEverything(t *testing.T) {
+	f := New(zap.NewNop())
+	f.Update(&Config{Rules: []Rule{{Action: ActionAllow, TraceIDPrefix: "ffff"}}})
+
+	// Requests whose spans are all dropped aren't passed on.
+	sink := new(consumertest.TracesSink)
+	require.NoError(t, f.Consumer(sink).ConsumeTraces(context.Background(), newTraces(t, testSpans)))
+	require.Empty(t, sink.AllTraces())
+}
+
+func TestFilter_Expiry(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	f := New(zap.New(core))
+
+	sink := new(consumertest.TracesSink)
+	c := f.Consumer(sink)
+
+	f.Update(&Config{Rules: []Rule{
+		{Action: ActionDeny, ResourceAttributes: map[string]string{"service.name": "noisy"}, ExpiresAt: time.Now().Add(-time.Minute)},
+		{Action: ActionDeny, TraceIDPrefix: "4bf9", ExpiresAt: time.Now().Add(time.Hour)},
+	}})
+
+	// The expired rule is ignored, and reported once.
+	for i := 0; i < 2; i++ {
+		sink.Reset()
+		require.NoError(t, c.ConsumeTraces(context.Background(), newTraces(t, testSpans)))
+		require.Equal(t, []testSpan{testSpans[0], testSpans[2], testSpans[3]}, receivedSpans(sink))
+	}
+	entries := logs.FilterMessage("debug_filter rule expired, ignoring it").All()
+	require.Len(t, entries, 1)
+	require.Equal(t, int64(0), entries[0].ContextMap()["rule"])
+
+	// Updating the rules takes effect without recreating the consumer.
+	f.Update(nil)
+	sink.Reset()
+	require.NoError(t, c.ConsumeTraces(context.Background(), newTraces(t, testSpans)))
+	require.Equal(t, testSpans, receivedSpans(sink))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       []Rule
+		expectedErr string
+	}{
+		{
+			name:        "no rules",
+			expectedErr: "debug_filter: at least one rule is required",
+		},
+		{
+			name:        "unknown action",
+			rules:       []Rule{{Action: "keep", TraceIDPrefix: "0af7"}},
+			expectedErr: `debug_filter: rule 0: unsupported action "keep", must be one of "allow" or "deny"`,
+		},
+		{
+			name:        "no condition",
+			rules:       []Rule{{Action: ActionAllow}},
+			expectedErr: "debug_filter: rule 0: trace_id_prefix or resource_attributes is required",
+		},
+		{
+			name:        "invalid trace ID prefix",
+			rules:       []Rule{{Action: ActionDeny, TraceIDPrefix: "0af7"}, {Action: ActionDeny, TraceIDPrefix: "trace"}},
+			expectedErr: `debug_filter: rule 1: trace_id_prefix "trace" must be hex-encoded`,
+		},
+		{
+			name:        "trace ID prefix too long",
+			rules:       []Rule{{Action: ActionDeny, TraceIDPrefix: "0af7651916cd43dd8448eb211c80319c00"}},
+			expectedErr: `debug_filter: rule 0: trace_id_prefix "0af7651916cd43dd8448eb211c80319c00" is longer than a trace ID`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Config{Rules: tc.rules}
+			require.EqualError(t, cfg.Validate(), tc.expectedErr)
+		})
+	}
+}
+
+func newTraces(t *testing.T, spans []testSpan) ptrace.Traces {
+	t.Helper()
+
+	traces := ptrace.NewTraces()
+	for _, s := range spans {
+		rs := traces.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutStr("service.name", s.service)
+
+		raw, err := hex.DecodeString(s.traceID)
+		require.NoError(t, err)
+		var id pcommon.TraceID
+		copy(id[:], raw)
+		rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty().SetTraceID(id)
+	}
+	return traces
+}
+
+func receivedSpans(sink *consumertest.TracesSink) []testSpan {
+	var res []testSpan
+	for _, td := range sink.AllTraces() {
+		for i := 0; i < td.ResourceSpans().Len(); i++ {
+			rs := td.ResourceSpans().At(i)
+			service, _ := rs.Resource().Attributes().Get("service.name")
+			for j := 0; j < rs.ScopeSpans().Len(); j++ {
+				spans := rs.ScopeSpans().At(j).Spans()
+				for k := 0; k < spans.Len(); k++ {
+					id := spans.At(k).TraceID()
+					res = append(res, testSpan{service: service.Str(), traceID: hex.EncodeToString(id[:])})
+				}
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+// Package exporterlimit limits the number of requests trace exporters send
+// concurrently, so that a slow backend can't be sent an unbounded number of
+// requests at once.
+//
+// The limit is applied by wrapping the exporters created by a factory. When
+// the sending queue of an exporter is enabled, requests are sent by the
+// consumers of the queue, whose number must be limited as well.
+package exporterlimit
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	meterName         = "exporter_limit"
+	inFlightName      = "exporter_calls_in_flight"
+	exporterAttribute = "exporter"
+)
+
+// NewFactory wraps f so that the trace exporters it creates send at most the
+// number of concurrent requests of their ID in limits. Exporters without a
+// limit aren't wrapped.
+func NewFactory(f exporter.Factory, limits map[string]int) exporter.Factory {
+	return &factory{Factory: f, limits: limits}
+}
+
+type factory struct {
+	exporter.Factory
+	limits map[string]int
+}
+
+// CreateTracesExporter implements exporter.Factory.
+func (f *factory) CreateTracesExporter(ctx context.Context, set exporter.CreateSettings, cfg component.Config) (exporter.Traces, error) {
+	exp, err := f.Factory.CreateTracesExporter(ctx, set, cfg)
+	if err != nil {
+		return nil, err
+	}
+	limit, ok := f.limits[set.ID.String()]
+	if !ok || limit <= 0 {
+		return exp, nil
+	}
+	return newLimitedExporter(exp, set, limit)
+}
+
+// limitedExporter limits the concurrent calls to the exporter it wraps. The
+// calls are counted by the exporter_calls_in_flight metric. When the sending
+// queue is enabled a call returns once its request is queued, so the requests
+// waiting in the queue or being sent by its consumers aren't counted.
+type limitedExporter struct {
+	exporter.Traces
+	sem      chan struct{}
+	inFlight metric.Int64UpDownCounter
+	attrs    metric.MeasurementOption
+}
+
+func newLimitedExporter(exp exporter.Traces, set exporter.CreateSettings, limit int) (*limitedExporter, error) {
+	inFlight, err := set.MeterProvider.Meter(meterName).Int64UpDownCounter(
+		inFlightName,
+		metric.WithDescription("Number of calls to the exporter in progress, until their request is queued or sent"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register exporter limit metrics: %w", err)
+	}
+
+	return &limitedExporter{
+		Traces:   exp,
+		sem:      make(chan struct{}, limit),
+		inFlight: inFlight,
+		attrs:    metric.WithAttributes(attribute.String(exporterAttribute, set.ID.String())),
+	}, nil
+}
+
+// Capabilities implements consumer.Traces.
+func (e *limitedExporter) Capabilities() consumer.Capabilities {
+	return e.Traces.Capabilities()
+}
+
+// ConsumeTraces implements consumer.Traces. It waits for one of the other
+// requests to complete when the limit is reached, or for ctx to be done.
+func (e *limitedExporter) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	select {
+	case e.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-e.sem }()
+
+	e.inFlight.Add(ctx, 1, e.attrs)
+	defer e.inFlight.Add(context.Background(), -1, e.attrs)
+	return e.Traces.ConsumeTraces(ctx, td)
+}
@@ -0,0 +1,133 @@
+package exporterlimit
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/static/traces/traceutils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.uber.org/atomic"
+)
+
+func TestNewFactory(t *testing.T) {
+	var (
+		release  = make(chan struct{})
+		inFlight atomic.Int32
+		maxSeen  atomic.Int32
+	)
+	f := exporter.NewFactory("fake", func() component.Config { return &struct{}{} },
+		exporter.WithTraces(func(_ context.Context, _ exporter.CreateSettings, _ component.Config) (exporter.Traces, error) {
+			return &fakeExporter{consume: func(context.Context, ptrace.Traces) error {
+				n := inFlight.Inc()
+				defer inFlight.Dec()
+				for {
+					seen := maxSeen.Load()
+					if n <= seen || maxSeen.CompareAndSwap(seen, n) {
+						break
+					}
+				}
+				<-release
+				return nil
+			}}, nil
+		}, component.StabilityLevelUndefined))
+
+	wrapped := NewFactory(f, map[string]int{"fake/limited": 2})
+	require.Equal(t, f.Type(), wrapped.Type())
+
+	// Exporters without a limit aren't wrapped.
+	set := exportertest.NewNopCreateSettings()
+	set.ID = component.NewIDWithName("fake", "unlimited")
+	exp, err := wrapped.CreateTracesExporter(context.Background(), set, wrapped.CreateDefaultConfig())
+	require.NoError(t, err)
+	require.IsType(t, &fakeExporter{}, exp)
+
+	reg := prometheus.NewRegistry()
+	set = newCreateSettings(t, reg, "fake/limited")
+	exp, err = wrapped.CreateTracesExporter(context.Background(), set, wrapped.CreateDefaultConfig())
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, exp.ConsumeTraces(context.Background(), ptrace.NewTraces()))
+		}()
+	}
+
+	// Only two requests are sent at once, the others wait for them.
+	require.Eventually(t, func() bool { return inFlight.Load() == 2 }, time.Second, 10*time.Millisecond)
+	require.Never(t, func() bool { return inFlight.Load() > 2 }, 100*time.Millisecond, 10*time.Millisecond)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP traces_exporter_calls_in_flight Number of calls to the exporter in progress, until their request is queued or sent
+		# TYPE traces_exporter_calls_in_flight gauge
+		traces_exporter_calls_in_flight{exporter="fake/limited"} 2
+	`)))
+
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(2), maxSeen.Load())
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP traces_exporter_calls_in_flight Number of calls to the exporter in progress, until their request is queued or sent
+		# TYPE traces_exporter_calls_in_flight gauge
+		traces_exporter_calls_in_flight{exporter="fake/limited"} 0
+	`)))
+}
+
+func TestLimitedExporter_ContextDone(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	exp, err := newLimitedExporter(&fakeExporter{consume: func(context.Context, ptrace.Traces) error {
+		<-release
+		return nil
+	}}, newCreateSettings(t, prometheus.NewRegistry(), "fake"), 1)
+	require.NoError(t, err)
+
+	go func() { _ = exp.ConsumeTraces(context.Background(), ptrace.NewTraces()) }()
+	require.Eventually(t, func() bool { return len(exp.sem) == 1 }, time.Second, 10*time.Millisecond)
+
+	// Requests waiting for the limit give up once their context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, exp.ConsumeTraces(ctx, ptrace.NewTraces()), context.DeadlineExceeded)
+}
+
+func newCreateSettings(t *testing.T, reg prometheus.Registerer, id string) exporter.CreateSettings {
+	t.Helper()
+
+	promExporter, err := traceutils.PrometheusExporter(reg)
+	require.NoError(t, err)
+
+	set := exportertest.NewNopCreateSettings()
+	set.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(promExporter))
+
+	typ, name, _ := strings.Cut(id, "/")
+	set.ID = component.NewIDWithName(component.Type(typ), name)
+	return set
+}
+
+type fakeExporter struct {
+	component.StartFunc
+	component.ShutdownFunc
+	consume func(context.Context, ptrace.Traces) error
+}
+
+func (e *fakeExporter) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{}
+}
+
+func (e *fakeExporter) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	return e.consume(ctx, td)
+}
@@ -0,0 +1,179 @@
+// Package headertemplate sets headers of exported requests from the resource
+// attributes of the exported spans, such as an X-Service header equal to the
+// service.name of the spans.
+//
+// Exporters can't set headers per span, so the spans of each request are
+// split by the rendered header values. Each share is exported with the
+// rendered values in its client metadata, from which the headers_setter
+// extension sets the headers.
+package headertemplate
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/multierr"
+)
+
+// metadataKeyPrefix prefixes the client metadata keys holding rendered
+// header values.
+const metadataKeyPrefix = "header_template."
+
+// attributeRe matches a reference to a resource attribute in a header value.
+var attributeRe = regexp.MustCompile(`\$\{resource\.([^}]+)\}`)
+
+// IsTemplate returns whether value references resource attributes.
+func IsTemplate(value string) bool {
+	return attributeRe.MatchString(value)
+}
+
+// Template is a header value referencing resource attributes as
+// ${resource.<attribute>}.
+type Template struct {
+	literals   []string
+	attributes []string
+}
+
+// Parse parses value as a Template.
+func Parse(value string) (*Template, error) {
+	var (
+		t    Template
+		last int
+	)
+	for _, m := range attributeRe.FindAllStringSubmatchIndex(value, -1) {
+		t.literals = append(t.literals, value[last:m[0]])
+		t.attributes = append(t.attributes, value[m[2]:m[3]])
+		last = m[1]
+	}
+	if len(t.attributes) == 0 {
+		return nil, fmt.Errorf("header value %q doesn't reference any resource attribute", value)
+	}
+	t.literals = append(t.literals, value[last:])
+	return &t, nil
+}
+
+// Render returns the value of t for a resource with the given attributes.
+// Missing attributes are rendered as empty strings.
+func (t *Template) Render(attrs pcommon.Map) string {
+	var sb strings.Builder
+	for i, attr := range t.attributes {
+		sb.WriteString(t.literals[i])
+		if v, ok := attrs.Get(attr); ok {
+			sb.WriteString(v.AsString())
+		}
+	}
+	sb.WriteString(t.literals[len(t.literals)-1])
+	return sb.String()
+}
+
+// MetadataKey returns the client metadata key holding the rendered value of
+// header.
+func MetadataKey(header string) string {
+	return metadataKeyPrefix + strings.ToLower(header)
+}
+
+// Headers are the templated headers of an exporter, by header name.
+type Headers map[string]*Template
+
+// NewFactory wraps f so that the trace exporters with an ID in headers export
+// the rendered values of their templated headers as client metadata.
+func NewFactory(f exporter.Factory, headers map[string]Headers) exporter.Factory {
+	return &factory{Factory: f, headers: headers}
+}
+
+type factory struct {
+	exporter.Factory
+	headers map[string]Headers
+}
+
+// CreateTracesExporter implements exporter.Factory.
+func (f *factory) CreateTracesExporter(ctx context.Context, set exporter.CreateSettings, cfg component.Config) (exporter.Traces, error) {
+	exp, err := f.Factory.CreateTracesExporter(ctx, set, cfg)
+	if err != nil {
+		return nil, err
+	}
+	headers, ok := f.headers[set.ID.String()]
+	if !ok || len(headers) == 0 {
+		return exp, nil
+	}
+	return newTemplatedExporter(exp, headers), nil
+}
+
+type templatedExporter struct {
+	exporter.Traces
+	names   []string
+	headers Headers
+}
+
+func newTemplatedExporter(exp exporter.Traces, headers Headers) *templatedExporter {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &templatedExporter{Traces: exp, names: names, headers: headers}
+}
+
+// Capabilities implements consumer.Traces.
+func (e *templatedExporter) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+// ConsumeTraces implements consumer.Traces.
+func (e *templatedExporter) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	var (
+		keys   []string
+		values = make(map[string][]string)
+		groups = make(map[string]ptrace.Traces)
+	)
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		rendered := e.render(rs.Resource().Attributes())
+		key := strings.Join(rendered, "\x00")
+
+		group, ok := groups[key]
+		if !ok {
+			keys = append(keys, key)
+			values[key] = rendered
+			group = ptrace.NewTraces()
+			groups[key] = group
+		}
+		rs.CopyTo(group.ResourceSpans().AppendEmpty())
+	}
+
+	var errs error
+	for _, key := range keys {
+		errs = multierr.Append(errs, e.Traces.ConsumeTraces(e.withMetadata(ctx, values[key]), groups[key]))
+	}
+	return errs
+}
+
+func (e *templatedExporter) render(attrs pcommon.Map) []string {
+	rendered := make([]string, len(e.names))
+	for i, name := range e.names {
+		rendered[i] = e.headers[name].Render(attrs)
+	}
+	return rendered
+}
+
+// withMetadata returns ctx with the rendered header values as client
+// metadata.
+func (e *templatedExporter) withMetadata(ctx context.Context, rendered []string) context.Context {
+	md := make(map[string][]string, len(e.names))
+	for i, name := range e.names {
+		md[MetadataKey(name)] = []string{rendered[i]}
+	}
+	info := client.FromContext(ctx)
+	info.Metadata = client.NewMetadata(md)
+	return client.NewContext(ctx, info)
+}
@@ -0,0 +1,140 @@
+package headertemplate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestTemplate(t *testing.T) {
+	attrs := pcommon.NewMap()
+	attrs.PutStr("service.name", "checkout")
+	attrs.PutInt("replica", 2)
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "${resource.service.name}", expected: "checkout"},
+		{value: "svc-${resource.service.name}-${resource.replica}", expected: "svc-checkout-2"},
+		{value: "${resource.missing}", expected: ""},
+		{value: "${resource.service.name}${resource.service.name}", expected: "checkoutcheckout"},
+	}
+	for _, tc := range tests {
+		require.True(t, IsTemplate(tc.value))
+		tmpl, err := Parse(tc.value)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, tmpl.Render(attrs), tc.value)
+	}
+
+	for _, literal := range []string{"checkout", "${service.name}", "$resource.service.name", "${resource.}"} {
+		require.False(t, IsTemplate(literal), literal)
+		_, err := Parse(literal)
+		require.Error(t, err)
+	}
+}
+
+func TestNewFactory(t *testing.T) {
+	type request struct {
+		metadata map[string]string
+		services []string
+	}
+	var requests []request
+
+	f := exporter.NewFactory("fake", func() component.Config { return &struct{}{} },
+		exporter.WithTraces(func(context.Context, exporter.CreateSettings, component.Config) (exporter.Traces, error) {
+			return &fakeExporter{consume: func(ctx context.Context, td ptrace.Traces) error {
+				info := client.FromContext(ctx)
+				req := request{metadata: map[string]string{}}
+				for _, key := range []string{MetadataKey("X-Service"), MetadataKey("X-Team")} {
+					if v := info.Metadata.Get(key); len(v) > 0 {
+						req.metadata[key] = v[0]
+					}
+				}
+				rss := td.ResourceSpans()
+				for i := 0; i < rss.Len(); i++ {
+					name, _ := rss.At(i).Resource().Attributes().Get("service.name")
+					req.services = append(req.services, name.AsString())
+				}
+				requests = append(requests, req)
+				return nil
+			}}, nil
+		}, component.StabilityLevelUndefined))
+
+	service, err := Parse("${resource.service.name}")
+	require.NoError(t, err)
+	team, err := Parse("team-${resource.team}")
+	require.NoError(t, err)
+
+	wrapped := NewFactory(f, map[string]Headers{
+		"fake/templated": {"X-Service": service, "X-Team": team},
+	})
+
+	// Exporters without templated headers aren't wrapped.
+	set := exportertest.NewNopCreateSettings()
+	set.ID = component.NewIDWithName("fake", "literal")
+	exp, err := wrapped.CreateTracesExporter(context.Background(), set, wrapped.CreateDefaultConfig())
+	require.NoError(t, err)
+	require.IsType(t, &fakeExporter{}, exp)
+
+	set.ID = component.NewIDWithName("fake", "templated")
+	exp, err = wrapped.CreateTracesExporter(context.Background(), set, wrapped.CreateDefaultConfig())
+	require.NoError(t, err)
+
+	td := ptrace.NewTraces()
+	for _, res := range [][2]string{{"checkout", "a"}, {"search", "a"}, {"checkout", "a"}, {"checkout", "b"}} {
+		rs := td.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutStr("service.name", res[0])
+		rs.Resource().Attributes().PutStr("team", res[1])
+		rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty().SetName("span")
+	}
+	require.NoError(t, exp.ConsumeTraces(context.Background(), td))
+
+	// Resources with the same rendered headers are exported together, in
+	// the order they were received.
+	require.Equal(t, []request{
+		{
+			metadata: map[string]string{"header_template.x-service": "checkout", "header_template.x-team": "team-a"},
+			services: []string{"checkout", "checkout"},
+		},
+		{
+			metadata: map[string]string{"header_template.x-service": "search", "header_template.x-team": "team-a"},
+			services: []string{"search"},
+		},
+		{
+			metadata: map[string]string{"header_template.x-service": "checkout", "header_template.x-team": "team-b"},
+			services: []string{"checkout"},
+		},
+	}, requests)
+
+	// The exported traces are left untouched.
+	require.Equal(t, 4, td.ResourceSpans().Len())
+}
+
+func TestMetadataKey(t *testing.T) {
+	// Header names are case-insensitive.
+	require.Equal(t, "header_template.x-service", MetadataKey("X-Service"))
+	require.Equal(t, MetadataKey("X-Service"), MetadataKey("x-service"))
+}
+
+type fakeExporter struct {
+	component.StartFunc
+	component.ShutdownFunc
+	consume func(context.Context, ptrace.Traces) error
+}
+
+func (e *fakeExporter) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{}
+}
+
+func (e *fakeExporter) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	return e.consume(ctx, td)
+}
@@ -0,0 +1,131 @@
+package traces
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// WireAPI adds API routes to the provided mux router.
+func (t *Traces) WireAPI(r *mux.Router) {
+	r.HandleFunc("/agent/api/v1/traces/config", t.EffectiveConfigHandler).Methods("GET")
+	r.HandleFunc("/agent/api/v1/traces/topology", t.TopologyHandler).Methods("GET")
+	r.HandleFunc("/agent/api/v1/traces/status", t.StatusHandler).Methods("GET")
+}
+
+// EffectiveConfigHandler writes the OpenTelemetry Collector config run by each
+// traces instance, with secrets redacted, as YAML.
+func (t *Traces) EffectiveConfigHandler(w http.ResponseWriter, _ *http.Request) {
+	t.mut.Lock()
+	instances := make(map[string]*Instance, len(t.instances))
+	for name, inst := range t.instances {
+		instances[name] = inst
+	}
+	t.mut.Unlock()
+
+	configs := make(map[string]interface{}, len(instances))
+	for name, inst := range instances {
+		cfg, err := inst.EffectiveConfig()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to render config of traces instance %s: %s", name, err), http.StatusInternalServerError)
+			return
+		}
+		configs[name] = cfg
+	}
+
+	bb, err := yaml.Marshal(configs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal traces config: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-yaml")
+	if _, err := w.Write(bb); err != nil {
+		t.logger.Error("failed to write response", zap.Error(err))
+	}
+}
+
+// GeneratedConfigs returns the collector config generated by each traces
+// instance on its last successful reload, with secrets redacted, by instance
+// name.
+func (t *Traces) GeneratedConfigs() map[string]interface{} {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	configs := make(map[string]interface{}, len(t.instances))
+	for name, inst := range t.instances {
+		if cfg := inst.GeneratedConfig(); cfg != nil {
+			configs[name] = cfg
+		}
+	}
+	return configs
+}
+
+// Topologies returns the topology of the pipelines run by each traces
+// instance, by instance name.
+func (t *Traces) Topologies() map[string]Topology {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	topologies := make(map[string]Topology, len(t.instances))
+	for name, inst := range t.instances {
+		topologies[name] = inst.Topology()
+	}
+	return topologies
+}
+
+// TopologyHandler writes the topology of the pipelines run by each traces
+// instance as JSON.
+func (t *Traces) TopologyHandler(w http.ResponseWriter, _ *http.Request) {
+	bb, err := json.Marshal(t.Topologies())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal traces topology: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(bb); err != nil {
+		t.logger.Error("failed to write response", zap.Error(err))
+	}
+}
+
+// InstanceStatus is the status of a traces instance.
+type InstanceStatus struct {
+	// LastPushError is the last error returned by the pipeline when consuming
+	// spans pushed through the push receiver, if any.
+	LastPushError string `json:"last_push_error,omitempty"`
+}
+
+// Statuses returns the status of each traces instance, by instance name.
+func (t *Traces) Statuses() map[string]InstanceStatus {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	statuses := make(map[string]InstanceStatus, len(t.instances))
+	for name, inst := range t.instances {
+		var status InstanceStatus
+		if err := inst.LastPushError(); err != nil {
+			status.LastPushError = err.Error()
+		}
+		statuses[name] = status
+	}
+	return statuses
+}
+
+// StatusHandler writes the status of each traces instance as JSON.
+func (t *Traces) StatusHandler(w http.ResponseWriter, _ *http.Request) {
+	bb, err := json.Marshal(t.Statuses())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal traces status: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(bb); err != nil {
+		t.logger.Error("failed to write response", zap.Error(err))
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/connector"
+	"go.opentelemetry.io/collector/consumer"
 	otelexporter "go.opentelemetry.io/collector/exporter"
 	"go.opentelemetry.io/collector/extension"
 	"go.opentelemetry.io/collector/otelcol"
@@ -15,13 +16,16 @@ import (
 	"go.opentelemetry.io/collector/receiver"
 	"go.opentelemetry.io/collector/service"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 
 	"github.com/grafana/agent/internal/build"
 	"github.com/grafana/agent/internal/static/logs"
 	"github.com/grafana/agent/internal/static/metrics/instance"
 	"github.com/grafana/agent/internal/static/traces/automaticloggingprocessor"
+	"github.com/grafana/agent/internal/static/traces/backpressure"
 	"github.com/grafana/agent/internal/static/traces/contextkeys"
+	"github.com/grafana/agent/internal/static/traces/debugfilter"
+	"github.com/grafana/agent/internal/static/traces/pushreceiver"
+	"github.com/grafana/agent/internal/static/traces/selfmonitor"
 	"github.com/grafana/agent/internal/static/traces/servicegraphprocessor"
 	"github.com/grafana/agent/internal/static/traces/traceutils"
 	"github.com/grafana/agent/internal/util"
@@ -37,14 +41,60 @@ type Instance struct {
 
 	factories otelcol.Factories
 	service   *service.Service
+
+	// reg is the registerer of the metrics of the instance.
+	reg prom_client.Registerer
+
+	// healthCheck probes the load balancing backends, if they're health
+	// checked. It outlives the pipelines it routes spans of, and only
+	// changes with the config.
+	healthCheck       *backendHealthChecker
+	healthCheckCancel context.CancelFunc
+
+	selfMonitoringCancel context.CancelFunc
+
+	// backpressureCancel stops sampling the sending queues of the running
+	// pipeline, if back-pressure is enabled.
+	backpressureCancel context.CancelFunc
+
+	// pushMetrics instruments the push receiver of every pipeline built by
+	// the instance.
+	pushMetrics *pushreceiver.Metrics
+
+	// debugFilter applies the debug_filter rules to the spans of the
+	// receivers of every pipeline built by the instance, so that the rules
+	// can change without rebuilding the pipeline.
+	debugFilter *debugfilter.Filter
+
+	// generated is the collector config of the running pipeline, with
+	// secrets redacted. It's refreshed after every successful ApplyConfig.
+	generated map[string]interface{}
+
+	// topology summarizes the pipelines of the running pipeline. It's
+	// refreshed every time the pipeline is built.
+	topology Topology
+
+	// batchHintOnce ensures the hint about a missing batch block is only
+	// logged once per instance rather than on every config reload.
+	batchHintOnce sync.Once
 }
 
 // NewInstance creates and starts an instance of tracing pipelines.
 func NewInstance(logsSubsystem *logs.Logs, reg prom_client.Registerer, cfg InstanceConfig, logger *zap.Logger, promInstanceManager instance.Manager) (*Instance, error) {
 	instance := &Instance{}
 	instance.logger = logger
+	instance.pushMetrics = pushreceiver.NewMetrics()
+	instance.debugFilter = debugfilter.New(logger)
+	if reg != nil {
+		if err := reg.Register(instance.pushMetrics); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := instance.ApplyConfig(logsSubsystem, promInstanceManager, reg, cfg); err != nil {
+		if reg != nil {
+			reg.Unregister(instance.pushMetrics)
+		}
 		return nil, err
 	}
 	return instance, nil
@@ -59,31 +109,169 @@ func (i *Instance) ApplyConfig(logsSubsystem *logs.Logs, promInstanceManager ins
 		// No config change
 		return nil
 	}
+
+	// Only update the rules of the running pipeline if nothing else changed,
+	// so that the receivers keep running.
+	if i.service != nil && onlyDebugFilterChanged(i.cfg, cfg) {
+		if cfg.DebugFilter != nil {
+			if err := cfg.DebugFilter.Validate(); err != nil {
+				return err
+			}
+		}
+		i.cfg = cfg
+		i.debugFilter.Update(cfg.DebugFilter)
+		return nil
+	}
+
+	// Check the new config before shutting down the existing pipeline so
+	// that an invalid config leaves the previous pipeline running.
+	if _, err := cfg.otelConfig(); err != nil {
+		return fmt.Errorf("failed to load otelConfig from agent traces config: %w", err)
+	}
+
 	i.cfg = cfg
+	i.debugFilter.Update(cfg.DebugFilter)
+	i.reg = reg
 
 	// Shut down any existing pipeline
+	i.stopSelfMonitoring()
+	i.stopHealthCheck()
 	i.stop()
 
+	if cfg.LoadBalancing != nil && cfg.LoadBalancing.HealthCheck != nil {
+		if err := i.newHealthCheck(cfg.LoadBalancing); err != nil {
+			return fmt.Errorf("failed to start load balancing health check: %w", err)
+		}
+	}
+
 	err := i.buildAndStartPipeline(context.Background(), cfg, logsSubsystem, promInstanceManager, reg)
 	if err != nil {
 		return fmt.Errorf("failed to create pipeline: %w", err)
 	}
+	i.startHealthCheck()
+
+	if cfg.SelfMonitoring != nil && cfg.SelfMonitoring.Enabled {
+		i.startSelfMonitoring(*cfg.SelfMonitoring)
+	}
 
+	generated, err := cfg.effectiveConfig()
+	if err != nil {
+		i.logger.Warn("failed to render generated collector config", zap.Error(err))
+	}
+	i.generated = generated
+	i.logger.Info("traces pipelines loaded", i.topology.fields()...)
+
+	return nil
+}
+
+// onlyDebugFilterChanged returns true if prev and next only differ by their
+// debug_filter block.
+func onlyDebugFilterChanged(prev, next InstanceConfig) bool {
+	prev.DebugFilter, next.DebugFilter = nil, nil
+	return util.CompareYAML(prev, next)
+}
+
+// startSelfMonitoring starts pushing synthetic traces to the push receiver of
+// the pipeline. i.mut must be held when calling startSelfMonitoring.
+func (i *Instance) startSelfMonitoring(cfg selfmonitor.Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	i.selfMonitoringCancel = cancel
+	go selfmonitor.Run(ctx, cfg, i.pushConsumer, i.logger)
+}
+
+// stopSelfMonitoring stops pushing synthetic traces, if self monitoring is
+// running. i.mut must be held when calling stopSelfMonitoring.
+func (i *Instance) stopSelfMonitoring() {
+	if i.selfMonitoringCancel == nil {
+		return
+	}
+	i.selfMonitoringCancel()
+	i.selfMonitoringCancel = nil
+}
+
+// pushConsumer returns the consumer of the push receiver of the running
+// pipeline, or nil if there is none. The pipeline can be rebuilt at any time,
+// so the consumer is looked up again for every push.
+func (i *Instance) pushConsumer() consumer.Traces {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	if f, ok := i.factories.Receivers[pushreceiver.TypeStr].(*pushreceiver.Factory); ok {
+		return f.Consumer
+	}
+	return nil
+}
+
+// newHealthCheck creates the health checker of the load balancing backends,
+// which the load balancing exporter of the pipeline is wrapped with. i.mut
+// must be held when calling newHealthCheck.
+func (i *Instance) newHealthCheck(lb *loadBalancingConfig) error {
+	hc, err := newBackendHealthChecker(i.logger, lb)
+	if err != nil {
+		return err
+	}
+	if i.reg != nil {
+		if err := i.reg.Register(hc.healthyBackends); err != nil {
+			return err
+		}
+	}
+	i.healthCheck = hc
 	return nil
 }
 
+// startHealthCheck starts probing the load balancing backends, if they're
+// health checked. Spans are routed around the failing backends inside the
+// load balancing exporter, without rebuilding the pipeline. i.mut must be
+// held when calling startHealthCheck.
+func (i *Instance) startHealthCheck() {
+	if i.healthCheck == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	i.healthCheckCancel = cancel
+	go i.healthCheck.run(ctx)
+}
+
+// stopHealthCheck stops the running health checker, if any. i.mut must be
+// held when calling stopHealthCheck.
+func (i *Instance) stopHealthCheck() {
+	if i.healthCheck == nil {
+		return
+	}
+
+	if i.healthCheckCancel != nil {
+		i.healthCheckCancel()
+	}
+	if i.reg != nil {
+		i.reg.Unregister(i.healthCheck.healthyBackends)
+	}
+	i.healthCheck = nil
+	i.healthCheckCancel = nil
+}
+
 // Stop stops the OpenTelemetry collector subsystem
 func (i *Instance) Stop() {
 	i.mut.Lock()
 	defer i.mut.Unlock()
 
+	i.stopSelfMonitoring()
+	i.stopHealthCheck()
 	i.stop()
+	if i.reg != nil {
+		i.reg.Unregister(i.pushMetrics)
+	}
 }
 
 func (i *Instance) stop() {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if i.backpressureCancel != nil {
+		i.backpressureCancel()
+		i.backpressureCancel = nil
+	}
+
 	if i.service != nil {
 		err := i.service.Shutdown(shutdownCtx)
 		if err != nil {
@@ -121,6 +309,11 @@ func (i *Instance) buildAndStartPipeline(ctx context.Context, cfg InstanceConfig
 			"Load balancing via service name is required for spanmetrics to work properly in multi agent deployments")
 	}
 
+	i.logBatchHints(cfg)
+	for _, d := range cfg.sendingQueueDiagnostics() {
+		i.logger.Warn(d.Message)
+	}
+
 	if cfg.AutomaticLogging != nil && cfg.AutomaticLogging.Backend != automaticloggingprocessor.BackendStdout {
 		ctx = context.WithValue(ctx, contextkeys.Logs, logs)
 	}
@@ -129,7 +322,29 @@ func (i *Instance) buildAndStartPipeline(ctx context.Context, cfg InstanceConfig
 	if err != nil {
 		return fmt.Errorf("failed to load tracing factories: %w", err)
 	}
-	i.factories = factories
+	// The queue metrics of the exporters are sampled from the metrics of the
+	// pipeline.
+	var monitor *backpressure.Monitor
+	promReg := reg
+	if cfg.Backpressure != nil && cfg.Backpressure.Enabled {
+		monitor = backpressure.NewMonitor(*cfg.Backpressure, i.logger)
+		promReg = monitor.Registerer(reg)
+	}
+
+	// The debug filter applies first, so that the spans it drops don't count
+	// towards the receiver rate limit, nor get rejected by back-pressure.
+	factories, err = cfg.withExporterLimits(cfg.withReceiverRateLimit(withBackpressure(withDebugFilter(factories, i.debugFilter), monitor)))
+	if err != nil {
+		return fmt.Errorf("failed to load tracing factories: %w", err)
+	}
+	factories, err = cfg.withHeaderTemplates(factories)
+	if err != nil {
+		return fmt.Errorf("failed to load tracing factories: %w", err)
+	}
+	i.factories = cfg.withSelfMonitoring(withHealthCheck(factories, i.healthCheck))
+	if f, ok := i.factories.Receivers[pushreceiver.TypeStr].(*pushreceiver.Factory); ok {
+		f.Metrics = i.pushMetrics
+	}
 
 	appinfo := component.BuildInfo{
 		Command:     "agent",
@@ -142,7 +357,7 @@ func (i *Instance) buildAndStartPipeline(ctx context.Context, cfg InstanceConfig
 		return err
 	}
 
-	promExporter, err := traceutils.PrometheusExporter(reg)
+	promExporter, err := traceutils.PrometheusExporter(promReg)
 	if err != nil {
 		return fmt.Errorf("error creating otel prometheus exporter: %w", err)
 	}
@@ -154,17 +369,13 @@ func (i *Instance) buildAndStartPipeline(ctx context.Context, cfg InstanceConfig
 		Exporters:                otelexporter.NewBuilder(otelConfig.Exporters, i.factories.Exporters),
 		Connectors:               connector.NewBuilder(otelConfig.Connectors, i.factories.Connectors),
 		Extensions:               extension.NewBuilder(otelConfig.Extensions, i.factories.Extensions),
-		OtelMetricViews:          servicegraphprocessor.OtelMetricViews(),
+		OtelMetricViews:          append(servicegraphprocessor.OtelMetricViews(), selfmonitor.OtelMetricViews()...),
 		OtelMetricReader:         promExporter,
 		DisableProcessMetrics:    true,
 		UseExternalMetricsServer: true,
 		TracerProvider:           noop.NewTracerProvider(),
 		//TODO: Plug in an AsyncErrorChannel to shut down the Agent in case of a fatal event
-		LoggingOptions: []zap.Option{
-			zap.WrapCore(func(zapcore.Core) zapcore.Core {
-				return i.logger.Core()
-			}),
-		},
+		LoggingOptions: collectorLoggingOptions(cfg.CollectorLogs, i.logger),
 	}, otelConfig.Service)
 	if err != nil {
 		return fmt.Errorf("failed to create Otel service: %w", err)
@@ -175,14 +386,74 @@ func (i *Instance) buildAndStartPipeline(ctx context.Context, cfg InstanceConfig
 		return fmt.Errorf("failed to start Otel service: %w", err)
 	}
 
+	if monitor != nil {
+		monitorCtx, cancel := context.WithCancel(context.Background())
+		i.backpressureCancel = cancel
+		go monitor.Run(monitorCtx)
+	}
+
+	i.topology = newTopology(otelConfig)
 	return err
 }
 
+// logBatchHints logs the performance implications of running without a batch
+// processor. The batch processor which is checked is the one run by the
+// pipeline, which the throughput_profile configures when the batch block is
+// absent.
+func (i *Instance) logBatchHints(cfg InstanceConfig) {
+	cfg = *cfg.withThroughputDefaults()
+	if cfg.Batch == nil {
+		i.batchHintOnce.Do(func() {
+			i.logger.Info("No batch block configured, spans will not be batched before export. " +
+				"Configure a batch block, or set batch.disabled to true if this is intentional")
+		})
+		return
+	}
+
+	if _, disabled, err := cfg.batchConfig(); err == nil && disabled {
+		i.logger.Warn("The batch processor is explicitly disabled. " +
+			"Exporting spans without batching increases the number of outgoing requests and may degrade performance")
+	}
+}
+
+// EffectiveConfig returns the OpenTelemetry Collector config run by the
+// Instance, with secrets redacted.
+func (i *Instance) EffectiveConfig() (map[string]interface{}, error) {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	return i.cfg.effectiveConfig()
+}
+
+// GeneratedConfig returns the collector config generated by the last
+// successful ApplyConfig, with secrets redacted like in EffectiveConfig.
+func (i *Instance) GeneratedConfig() map[string]interface{} {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	return i.generated
+}
+
+// Topology returns the topology of the running pipeline.
+func (i *Instance) Topology() Topology {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	return i.topology
+}
+
 // ReportFatalError implements component.Host
 func (i *Instance) ReportFatalError(err error) {
 	i.logger.Error("fatal error reported", zap.Error(err))
 }
 
+// LastPushError returns the last error returned by the pipeline when
+// consuming spans pushed through the push receiver, or nil if no push was
+// ever rejected.
+func (i *Instance) LastPushError() error {
+	return i.pushMetrics.LastError()
+}
+
 // GetFactory implements component.Host
 func (i *Instance) GetFactory(kind component.Kind, componentType component.Type) component.Factory {
 	switch kind {
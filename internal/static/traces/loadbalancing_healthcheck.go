@@ -0,0 +1,427 @@
+package traces
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/loadbalancingexporter"
+	prom_client "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	otelexporter "go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// defaultBackendPort is the port used by the load balancing exporter when
+	// a backend doesn't specify one.
+	defaultBackendPort = "4317"
+
+	// defaultDNSResolverInterval is the default re-resolution interval of the
+	// load balancing exporter's DNS resolver.
+	defaultDNSResolverInterval = 5 * time.Second
+)
+
+// backendHealthChecker periodically probes the backends of a load_balancing
+// block and reports the set of healthy backends when it changes. The load
+// balancing exporters created by its exporter factory only send spans to the
+// healthy backends.
+type backendHealthChecker struct {
+	logger *zap.Logger
+	cfg    loadBalancingHealthCheckConfig
+
+	// resolve returns the current list of backends. It is called at most
+	// once every resolveInterval.
+	resolve         func(ctx context.Context) ([]string, error)
+	resolveInterval time.Duration
+	probe           func(ctx context.Context, backend string) error
+
+	// onChange is called with the list of healthy backends when it changes.
+	// A nil list means that every backend is healthy, or that none are, in
+	// which case the configured resolver should be used as is. It defaults to
+	// setHealthy.
+	onChange func(healthy []string)
+
+	healthyBackends prom_client.Gauge
+
+	mut       sync.Mutex
+	healthy   []string
+	exporters map[*healthAwareExporter]struct{}
+}
+
+func newBackendHealthChecker(logger *zap.Logger, lb *loadBalancingConfig) (*backendHealthChecker, error) {
+	hc := &backendHealthChecker{
+		logger: logger,
+		cfg:    *lb.HealthCheck,
+		healthyBackends: prom_client.NewGauge(prom_client.GaugeOpts{
+			Name: "traces_loadbalancer_healthy_backends",
+			Help: "Number of load balancing backends which passed their last health check.",
+		}),
+		exporters: make(map[*healthAwareExporter]struct{}),
+	}
+	hc.onChange = hc.setHealthy
+	if err := hc.cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case lb.Resolver[staticTagName] != nil:
+		var static struct {
+			Hostnames []string `yaml:"hostnames"`
+		}
+		if err := remarshalYAML(lb.Resolver[staticTagName], &static); err != nil {
+			return nil, fmt.Errorf("failed to parse static resolver: %w", err)
+		}
+		hc.resolve = func(context.Context) ([]string, error) { return static.Hostnames, nil }
+
+	case lb.Resolver[dnsTagName] != nil:
+		dns := struct {
+			Hostname string        `yaml:"hostname"`
+			Port     string        `yaml:"port"`
+			Interval time.Duration `yaml:"interval"`
+		}{
+			Port:     defaultBackendPort,
+			Interval: defaultDNSResolverInterval,
+		}
+		if err := remarshalYAML(lb.Resolver[dnsTagName], &dns); err != nil {
+			return nil, fmt.Errorf("failed to parse dns resolver: %w", err)
+		}
+		hc.resolveInterval = dns.Interval
+		hc.resolve = func(ctx context.Context) ([]string, error) {
+			return resolveDNSBackends(ctx, dns.Hostname, dns.Port)
+		}
+
+	default:
+		return nil, fmt.Errorf("health_check requires a static or dns resolver")
+	}
+
+	switch hc.cfg.Protocol {
+	case healthCheckProtocolGRPC:
+		var creds credentials.TransportCredentials
+		if lb.Exporter.Insecure {
+			creds = insecure.NewCredentials()
+		} else {
+			creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: lb.Exporter.InsecureSkipVerify})
+		}
+		hc.probe = func(ctx context.Context, backend string) error {
+			return probeGRPC(ctx, backend, creds)
+		}
+	default:
+		hc.probe = probeTCP
+	}
+
+	return hc, nil
+}
+
+// run probes the backends until ctx is canceled.
+func (hc *backendHealthChecker) run(ctx context.Context) {
+	var (
+		backends    []string
+		lastResolve time.Time
+		lastHealthy []string
+	)
+
+	ticker := time.NewTicker(hc.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if backends == nil || time.Since(lastResolve) >= hc.resolveInterval {
+			resolved, err := hc.resolve(ctx)
+			if err != nil {
+				hc.logger.Warn("failed to resolve load balancing backends", zap.Error(err))
+			} else {
+				backends, lastResolve = resolved, time.Now()
+			}
+		}
+
+		healthy := hc.probeAll(ctx, backends)
+		if ctx.Err() != nil {
+			return
+		}
+		hc.healthyBackends.Set(float64(len(healthy)))
+
+		switch {
+		case len(healthy) == len(backends):
+			healthy = nil
+		case len(healthy) == 0:
+			hc.logger.Warn("no load balancing backend passed its health check, sending to all backends")
+			healthy = nil
+		}
+		if !slices.Equal(healthy, lastHealthy) {
+			if healthy != nil {
+				hc.logger.Info("set of healthy load balancing backends changed", zap.Strings("healthy", healthy))
+			}
+			lastHealthy = healthy
+			hc.onChange(healthy)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeAll probes backends concurrently and returns the sorted list of
+// healthy ones.
+func (hc *backendHealthChecker) probeAll(ctx context.Context, backends []string) []string {
+	var (
+		wg      sync.WaitGroup
+		mut     sync.Mutex
+		healthy = make([]string, 0, len(backends))
+	)
+
+	for _, backend := range backends {
+		wg.Add(1)
+		go func(backend string) {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, hc.cfg.Timeout)
+			defer cancel()
+
+			if err := hc.probe(probeCtx, withDefaultPort(backend)); err != nil {
+				hc.logger.Debug("load balancing backend failed its health check", zap.String("backend", backend), zap.Error(err))
+				return
+			}
+			mut.Lock()
+			healthy = append(healthy, backend)
+			mut.Unlock()
+		}(backend)
+	}
+	wg.Wait()
+
+	sort.Strings(healthy)
+	return healthy
+}
+
+// setHealthy routes the spans of the exporters created by the checker to
+// the healthy backends, or to the backends of the configured resolver if
+// healthy is nil.
+func (hc *backendHealthChecker) setHealthy(healthy []string) {
+	hc.mut.Lock()
+	defer hc.mut.Unlock()
+
+	hc.healthy = healthy
+	for e := range hc.exporters {
+		e.setBackends(healthy)
+	}
+}
+
+// exporterFactory wraps the load balancing exporter factory f so that its
+// exporters only send spans to the healthy backends.
+func (hc *backendHealthChecker) exporterFactory(f otelexporter.Factory) otelexporter.Factory {
+	return &healthAwareExporterFactory{Factory: f, checker: hc}
+}
+
+type healthAwareExporterFactory struct {
+	otelexporter.Factory
+	checker *backendHealthChecker
+}
+
+// CreateTracesExporter implements otelexporter.Factory.
+func (f *healthAwareExporterFactory) CreateTracesExporter(ctx context.Context, set otelexporter.CreateSettings, cfg component.Config) (otelexporter.Traces, error) {
+	lbCfg, ok := cfg.(*loadbalancingexporter.Config)
+	if !ok {
+		return nil, fmt.Errorf("unexpected load balancing exporter config type %T", cfg)
+	}
+
+	f.checker.mut.Lock()
+	defer f.checker.mut.Unlock()
+
+	e := &healthAwareExporter{
+		factory: f.Factory,
+		set:     set,
+		cfg:     *lbCfg,
+		logger:  set.Logger,
+		onShutdown: func(e *healthAwareExporter) {
+			f.checker.mut.Lock()
+			defer f.checker.mut.Unlock()
+			delete(f.checker.exporters, e)
+		},
+	}
+	var err error
+	e.current, err = e.create(ctx, f.checker.healthy)
+	if err != nil {
+		return nil, err
+	}
+	f.checker.exporters[e] = struct{}{}
+	return e, nil
+}
+
+// healthAwareExporter is a load balancing exporter which only sends spans to
+// a set of healthy backends. When the set changes, a load balancing exporter
+// with a static resolver listing the healthy backends replaces the current
+// one, so that the rest of the pipeline keeps running.
+type healthAwareExporter struct {
+	factory    otelexporter.Factory
+	set        otelexporter.CreateSettings
+	cfg        loadbalancingexporter.Config
+	logger     *zap.Logger
+	onShutdown func(*healthAwareExporter)
+
+	mut     sync.RWMutex
+	host    component.Host
+	running bool
+	current otelexporter.Traces
+}
+
+var _ otelexporter.Traces = (*healthAwareExporter)(nil)
+
+// create creates a load balancing exporter which sends spans to backends,
+// or to the backends of the configured resolver if backends is nil.
+func (e *healthAwareExporter) create(ctx context.Context, backends []string) (otelexporter.Traces, error) {
+	cfg := e.cfg
+	if backends != nil {
+		cfg.Resolver = loadbalancingexporter.ResolverSettings{
+			Static: &loadbalancingexporter.StaticResolver{Hostnames: backends},
+		}
+	}
+	return e.factory.CreateTracesExporter(ctx, e.set, &cfg)
+}
+
+// setBackends replaces the current exporter with one which sends spans to
+// backends. Calls to setBackends must not be concurrent.
+func (e *healthAwareExporter) setBackends(backends []string) {
+	e.mut.RLock()
+	host, running := e.host, e.running
+	e.mut.RUnlock()
+	if !running {
+		return
+	}
+
+	ctx := context.Background()
+	next, err := e.create(ctx, backends)
+	if err == nil {
+		err = next.Start(ctx, host)
+	}
+	if err != nil {
+		e.logger.Error("failed to route spans to the healthy load balancing backends", zap.Error(err))
+		return
+	}
+
+	e.mut.Lock()
+	prev := e.current
+	if e.running {
+		e.current = next
+	} else {
+		// The exporter was shut down while starting the next one.
+		prev = next
+	}
+	e.mut.Unlock()
+
+	// Requests in flight with the previous exporter are done once the write
+	// lock was acquired.
+	if err := prev.Shutdown(ctx); err != nil {
+		e.logger.Warn("failed to shut down the load balancing exporter of the previous backends", zap.Error(err))
+	}
+}
+
+// Start implements component.Component.
+func (e *healthAwareExporter) Start(ctx context.Context, host component.Host) error {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	if err := e.current.Start(ctx, host); err != nil {
+		return err
+	}
+	e.host, e.running = host, true
+	return nil
+}
+
+// Shutdown implements component.Component.
+func (e *healthAwareExporter) Shutdown(ctx context.Context) error {
+	e.onShutdown(e)
+
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	e.running = false
+	return e.current.Shutdown(ctx)
+}
+
+// Capabilities implements consumer.Traces.
+func (e *healthAwareExporter) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+// ConsumeTraces implements consumer.Traces.
+func (e *healthAwareExporter) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	e.mut.RLock()
+	defer e.mut.RUnlock()
+	return e.current.ConsumeTraces(ctx, td)
+}
+
+func probeTCP(ctx context.Context, backend string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", backend)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func probeGRPC(ctx context.Context, backend string, creds credentials.TransportCredentials) error {
+	conn, err := grpc.DialContext(ctx, backend, grpc.WithTransportCredentials(creds), grpc.WithBlock())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		// The backend is reachable but doesn't expose the gRPC health service,
+		// which is the case for the agent's own OTLP receiver.
+		return nil
+	case err != nil:
+		return err
+	case resp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING:
+		return fmt.Errorf("backend is %s", resp.GetStatus())
+	}
+	return nil
+}
+
+func resolveDNSBackends(ctx context.Context, hostname, port string) ([]string, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	backends := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		backends = append(backends, net.JoinHostPort(addr.IP.String(), port))
+	}
+	sort.Strings(backends)
+	return backends, nil
+}
+
+func withDefaultPort(backend string) string {
+	if _, _, err := net.SplitHostPort(backend); err == nil {
+		return backend
+	}
+	return net.JoinHostPort(backend, defaultBackendPort)
+}
+
+// remarshalYAML decodes a generic YAML value into out.
+func remarshalYAML(in interface{}, out interface{}) error {
+	bb, err := yaml.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(bb, out)
+}
@@ -0,0 +1,257 @@
+package traces
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/loadbalancingexporter"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	otelexporter "go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+func TestLoadBalancingHealthCheck_ExporterConfig(t *testing.T) {
+	cfgText := `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+load_balancing:
+  exporter:
+    insecure: true
+  resolver:
+    dns:
+      hostname: agent
+      port: 8282
+      interval: 12m
+  health_check:
+    protocol: grpc
+    interval: 30s
+`
+
+	var cfg InstanceConfig
+	require.NoError(t, yaml.Unmarshal([]byte(cfgText), &cfg))
+	require.Equal(t, loadBalancingHealthCheckConfig{
+		Protocol: healthCheckProtocolGRPC,
+		Interval: 30 * time.Second,
+		Timeout:  defaultLoadBalancingHealthCheckConfig.Timeout,
+	}, *cfg.LoadBalancing.HealthCheck)
+
+	// The configured resolver is kept: failing backends are ejected by the
+	// exporter wrapper.
+	exporter, err := cfg.loadBalancingExporter()
+	require.NoError(t, err)
+	require.Equal(t, cfg.LoadBalancing.Resolver[dnsTagName], exporter["resolver"].(map[string]interface{})[dnsTagName])
+}
+
+// fakeLoadBalancingExporter records the config it was created with.
+type fakeLoadBalancingExporter struct {
+	cfg      *loadbalancingexporter.Config
+	sink     consumertest.TracesSink
+	started  atomic.Bool
+	shutdown atomic.Bool
+}
+
+func (e *fakeLoadBalancingExporter) Start(context.Context, component.Host) error {
+	e.started.Store(true)
+	return nil
+}
+
+func (e *fakeLoadBalancingExporter) Shutdown(context.Context) error {
+	e.shutdown.Store(true)
+	return nil
+}
+
+func (e *fakeLoadBalancingExporter) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{}
+}
+
+func (e *fakeLoadBalancingExporter) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	return e.sink.ConsumeTraces(ctx, td)
+}
+
+func TestBackendHealthChecker_ExporterFactory(t *testing.T) {
+	var created []*fakeLoadBalancingExporter
+	f := otelexporter.NewFactory("loadbalancing", loadbalancingexporter.NewFactory().CreateDefaultConfig,
+		otelexporter.WithTraces(func(_ context.Context, _ otelexporter.CreateSettings, cfg component.Config) (otelexporter.Traces, error) {
+			e := &fakeLoadBalancingExporter{cfg: cfg.(*loadbalancingexporter.Config)}
+			created = append(created, e)
+			return e, nil
+		}, component.StabilityLevelUndefined))
+
+	lb := &loadBalancingConfig{
+		Resolver: map[string]interface{}{
+			staticTagName: map[interface{}]interface{}{
+				"hostnames": []interface{}{"agent-1", "agent-2"},
+			},
+		},
+		HealthCheck: &defaultLoadBalancingHealthCheckConfig,
+	}
+	hc, err := newBackendHealthChecker(zap.NewNop(), lb)
+	require.NoError(t, err)
+
+	cfg := &loadbalancingexporter.Config{
+		Resolver: loadbalancingexporter.ResolverSettings{
+			Static: &loadbalancingexporter.StaticResolver{Hostnames: []string{"agent-1", "agent-2"}},
+		},
+	}
+	exp, err := hc.exporterFactory(f).CreateTracesExporter(context.Background(), exportertest.NewNopCreateSettings(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+	require.Len(t, created, 1)
+	require.Equal(t, cfg, created[0].cfg)
+
+	// A failing backend is ejected by replacing the exporter, without
+	// restarting the one wrapping it.
+	hc.setHealthy([]string{"agent-2"})
+	require.Len(t, created, 2)
+	require.Equal(t, []string{"agent-2"}, created[1].cfg.Resolver.Static.Hostnames)
+	require.True(t, created[1].started.Load())
+	require.True(t, created[0].shutdown.Load())
+
+	require.NoError(t, exp.ConsumeTraces(context.Background(), ptrace.NewTraces()))
+	require.Len(t, created[1].sink.AllTraces(), 1)
+
+	// Once every backend is healthy again, the configured resolver is used.
+	hc.setHealthy(nil)
+	require.Len(t, created, 3)
+	require.Equal(t, cfg, created[2].cfg)
+
+	// Exporters which are shut down don't follow the health checks anymore.
+	require.NoError(t, exp.Shutdown(context.Background()))
+	require.True(t, created[2].shutdown.Load())
+	hc.setHealthy([]string{"agent-1"})
+	require.Len(t, created, 3)
+}
+
+func TestLoadBalancingHealthCheck_Validate(t *testing.T) {
+	tt := []struct {
+		name        string
+		resolver    string
+		healthCheck string
+		expectedErr string
+	}{
+		{
+			name:        "defaults",
+			healthCheck: `{}`,
+		},
+		{
+			name:        "zero interval",
+			healthCheck: `{interval: 0s}`,
+			expectedErr: "health_check interval must be greater than 0",
+		},
+		{
+			name:        "negative timeout",
+			healthCheck: `{timeout: -1s}`,
+			expectedErr: "health_check timeout must be greater than 0",
+		},
+		{
+			name:        "timeout greater than interval",
+			healthCheck: `{interval: 1s, timeout: 5s}`,
+			expectedErr: "health_check timeout (5s) must not be greater than interval (1s)",
+		},
+		{
+			name:        "unknown protocol",
+			healthCheck: `{protocol: http}`,
+			expectedErr: "unsupported health_check protocol 'http', expected 'tcp' or 'grpc'",
+		},
+		{
+			name:        "kubernetes resolver",
+			resolver:    `{kubernetes: {service: lb-svc.lb-ns}}`,
+			healthCheck: `{}`,
+			expectedErr: "health_check is not supported with the kubernetes resolver",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := tc.resolver
+			if resolver == "" {
+				resolver = `{static: {hostnames: [agent-1, agent-2]}}`
+			}
+
+			cfgText := `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+load_balancing:
+  resolver: ` + resolver + `
+  health_check: ` + tc.healthCheck + `
+`
+			var cfg InstanceConfig
+			require.NoError(t, yaml.Unmarshal([]byte(cfgText), &cfg))
+
+			_, err := cfg.otelConfig()
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestBackendHealthChecker(t *testing.T) {
+	healthy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer healthy.Close()
+	go func() {
+		for {
+			conn, err := healthy.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// Grab a free port and close it again so nothing is listening on it.
+	unhealthy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, unhealthy.Close())
+
+	lb := &loadBalancingConfig{
+		Resolver: map[string]interface{}{
+			staticTagName: map[interface{}]interface{}{
+				"hostnames": []interface{}{healthy.Addr().String(), unhealthy.Addr().String()},
+			},
+		},
+		HealthCheck: &loadBalancingHealthCheckConfig{
+			Protocol: healthCheckProtocolTCP,
+			Interval: 50 * time.Millisecond,
+			Timeout:  50 * time.Millisecond,
+		},
+	}
+
+	hc, err := newBackendHealthChecker(zap.NewNop(), lb)
+	require.NoError(t, err)
+
+	changes := make(chan []string, 1)
+	hc.onChange = func(healthy []string) { changes <- healthy }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hc.run(ctx)
+
+	select {
+	case backends := <-changes:
+		require.Equal(t, []string{healthy.Addr().String()}, backends)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "health checker did not report healthy backends")
+	}
+}
@@ -32,6 +32,9 @@ func (f *Factory) CreateDefaultConfig() component.Config {
 type Factory struct {
 	otelreceiver.Factory
 	Consumer consumer.Traces
+
+	// Metrics, when set before the receiver is created, instruments Consumer.
+	Metrics *Metrics
 }
 
 // MetricsReceiverStability implements component.ReceiverFactory.
@@ -59,6 +62,9 @@ func (f *Factory) CreateTracesReceiver(
 
 	r, err := newPushReceiver()
 	f.Consumer = c
+	if f.Metrics != nil {
+		f.Consumer = &instrumentedConsumer{next: c, metrics: f.Metrics}
+	}
 
 	return r, err
 }
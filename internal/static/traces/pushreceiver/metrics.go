@@ -0,0 +1,96 @@
+package pushreceiver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// Metrics instruments the spans pushed through push receivers. Metrics are
+// kept by the traces instance so that they survive rebuilding its pipeline.
+type Metrics struct {
+	spansPerPush   prometheus.Histogram
+	consumeLatency prometheus.Histogram
+
+	mut       sync.Mutex
+	lastError error
+}
+
+var _ prometheus.Collector = (*Metrics)(nil)
+
+// NewMetrics creates metrics for push receivers. They must be registered to
+// be exposed.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		spansPerPush: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "traces_push_receiver_spans_per_push",
+			Help:    "Number of spans in each batch pushed through the push receiver.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+		}),
+		consumeLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "traces_push_receiver_consume_duration_seconds",
+			Help:    "Time spent by the pipeline consuming batches pushed through the push receiver.",
+			Buckets: prometheus.DefBuckets,
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.spansPerPush.Describe(ch)
+	m.consumeLatency.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.spansPerPush.Collect(ch)
+	m.consumeLatency.Collect(ch)
+}
+
+// LastError returns the last error returned by the pipeline when consuming
+// pushed spans, or nil if no batch was ever rejected.
+func (m *Metrics) LastError() error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return m.lastError
+}
+
+func (m *Metrics) observe(spans int, start time.Time, err error) {
+	m.spansPerPush.Observe(float64(spans))
+	m.consumeLatency.Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.lastError = err
+}
+
+// instrumentedConsumer records the spans pushed to the next consumer.
+type instrumentedConsumer struct {
+	next    consumer.Traces
+	metrics *Metrics
+}
+
+var _ consumer.Traces = (*instrumentedConsumer)(nil)
+
+// Capabilities implements consumer.Traces.
+func (c *instrumentedConsumer) Capabilities() consumer.Capabilities {
+	return c.next.Capabilities()
+}
+
+// ConsumeTraces implements consumer.Traces.
+func (c *instrumentedConsumer) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	// Count spans before consuming them, since the next consumer may mutate
+	// td.
+	spans := td.SpanCount()
+	start := time.Now()
+	err := c.next.ConsumeTraces(ctx, td)
+	c.metrics.observe(spans, start, err)
+	return err
+}
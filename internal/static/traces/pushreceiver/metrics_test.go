@@ -0,0 +1,95 @@
+package pushreceiver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/receiver/receivertest"
+)
+
+func TestFactory_Metrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics := NewMetrics()
+	require.NoError(t, reg.Register(metrics))
+
+	// The next consumer rejects batches once it was asked to.
+	var reject error
+	sink := new(consumertest.TracesSink)
+	next := consumerFunc(func(ctx context.Context, td ptrace.Traces) error {
+		if reject != nil {
+			return reject
+		}
+		return sink.ConsumeTraces(ctx, td)
+	})
+
+	f := NewFactory().(*Factory)
+	f.Metrics = metrics
+	_, err := f.CreateTracesReceiver(context.Background(), receivertest.NewNopCreateSettings(), f.CreateDefaultConfig(), next)
+	require.NoError(t, err)
+
+	require.NoError(t, f.Consumer.ConsumeTraces(context.Background(), newTraces(3)))
+	require.NoError(t, f.Consumer.ConsumeTraces(context.Background(), newTraces(5)))
+	require.Equal(t, 8, sink.SpanCount())
+	require.NoError(t, metrics.LastError())
+
+	reject = errors.New("pipeline is full")
+	require.ErrorIs(t, f.Consumer.ConsumeTraces(context.Background(), newTraces(2)), reject)
+	require.ErrorIs(t, metrics.LastError(), reject)
+
+	count, sum := gatherHistogram(t, reg, "traces_push_receiver_spans_per_push")
+	require.Equal(t, uint64(3), count)
+	require.Equal(t, float64(10), sum)
+
+	count, _ = gatherHistogram(t, reg, "traces_push_receiver_consume_duration_seconds")
+	require.Equal(t, uint64(3), count)
+}
+
+func TestFactory_NoMetrics(t *testing.T) {
+	sink := new(consumertest.TracesSink)
+	f := NewFactory().(*Factory)
+	_, err := f.CreateTracesReceiver(context.Background(), receivertest.NewNopCreateSettings(), f.CreateDefaultConfig(), sink)
+	require.NoError(t, err)
+	require.Same(t, sink, f.Consumer)
+}
+
+type consumerFunc func(ctx context.Context, td ptrace.Traces) error
+
+func (f consumerFunc) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	return f(ctx, td)
+}
+
+func (f consumerFunc) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{}
+}
+
+func gatherHistogram(t *testing.T, reg *prometheus.Registry, name string) (count uint64, sum float64) {
+	t.Helper()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		require.Len(t, family.GetMetric(), 1)
+		h := family.GetMetric()[0].GetHistogram()
+		return h.GetSampleCount(), h.GetSampleSum()
+	}
+	require.FailNow(t, "metric not found", name)
+	return 0, 0
+}
+
+func newTraces(spans int) ptrace.Traces {
+	traces := ptrace.NewTraces()
+	ss := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty()
+	for i := 0; i < spans; i++ {
+		ss.Spans().AppendEmpty().SetName("test")
+	}
+	return traces
+}
@@ -0,0 +1,200 @@
+// Package receiverratelimit limits the rate of spans accepted by trace
+// receivers, so that a single misbehaving client can't starve the agent.
+//
+// The limit is applied by wrapping the consumer receivers push spans to,
+// before any processor of the pipeline sees them.
+package receiverratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/receiver"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// OverflowPolicyReject rejects requests exceeding the rate limit with a
+	// RESOURCE_EXHAUSTED error, so that clients can retry them later.
+	OverflowPolicyReject = "reject"
+	// OverflowPolicyDrop accepts requests exceeding the rate limit, but drops
+	// their spans.
+	OverflowPolicyDrop = "drop"
+
+	meterName         = "receiver_rate_limit"
+	limitedSpansName  = "receiver_rate_limited_spans"
+	receiverAttribute = "receiver"
+	overflowAttribute = "overflow_policy"
+)
+
+// Config limits the rate of spans accepted by receivers.
+type Config struct {
+	// SpansPerSecond is the rate of spans accepted.
+	SpansPerSecond float64 `yaml:"spans_per_second"`
+	// Burst is the number of spans accepted at once. Requests with more spans
+	// than Burst are never accepted. Zero means SpansPerSecond.
+	Burst int `yaml:"burst,omitempty"`
+	// PerReceiver applies the limit to each receiver separately, instead of
+	// to all the receivers together.
+	PerReceiver bool `yaml:"per_receiver,omitempty"`
+	// OverflowPolicy is either OverflowPolicyReject or OverflowPolicyDrop.
+	// Empty means OverflowPolicyReject.
+	OverflowPolicy string `yaml:"overflow_policy,omitempty"`
+}
+
+// Validate returns an error if the config is invalid.
+func (c *Config) Validate() error {
+	if c.SpansPerSecond <= 0 {
+		return fmt.Errorf("receiver_rate_limit: spans_per_second must be greater than 0")
+	}
+	if c.Burst < 0 {
+		return fmt.Errorf("receiver_rate_limit: burst must not be negative")
+	}
+	switch c.OverflowPolicy {
+	case "", OverflowPolicyReject, OverflowPolicyDrop:
+	default:
+		return fmt.Errorf("receiver_rate_limit: unsupported overflow_policy %q, must be one of %q or %q", c.OverflowPolicy, OverflowPolicyReject, OverflowPolicyDrop)
+	}
+	return nil
+}
+
+func (c *Config) burst() int {
+	if c.Burst != 0 {
+		return c.Burst
+	}
+	return int(math.Max(math.Ceil(c.SpansPerSecond), 1))
+}
+
+func (c *Config) overflowPolicy() string {
+	if c.OverflowPolicy == "" {
+		return OverflowPolicyReject
+	}
+	return c.OverflowPolicy
+}
+
+// Limiter holds the rate limiters of the receivers of a pipeline.
+type Limiter struct {
+	cfg      Config
+	excluded map[string]struct{}
+
+	mut      sync.Mutex
+	shared   *rate.Limiter
+	limiters map[component.ID]*rate.Limiter
+}
+
+// New creates a Limiter applying cfg to every receiver except the ones with
+// the excluded IDs.
+func New(cfg Config, excluded ...string) *Limiter {
+	l := &Limiter{
+		cfg:      cfg,
+		excluded: make(map[string]struct{}, len(excluded)),
+		shared:   rate.NewLimiter(rate.Limit(cfg.SpansPerSecond), cfg.burst()),
+		limiters: make(map[component.ID]*rate.Limiter),
+	}
+	for _, id := range excluded {
+		l.excluded[id] = struct{}{}
+	}
+	return l
+}
+
+// limiterFor returns the rate limiter of the receiver with the given ID.
+func (l *Limiter) limiterFor(id component.ID) *rate.Limiter {
+	if !l.cfg.PerReceiver {
+		return l.shared
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	limiter, ok := l.limiters[id]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(l.cfg.SpansPerSecond), l.cfg.burst())
+		l.limiters[id] = limiter
+	}
+	return limiter
+}
+
+// Consumer wraps next, the consumer the receiver created with set pushes
+// spans to, so that it only accepts spans within the rate limit.
+func (l *Limiter) Consumer(set receiver.CreateSettings, next consumer.Traces) (consumer.Traces, error) {
+	if _, ok := l.excluded[set.ID.String()]; ok {
+		return next, nil
+	}
+
+	limitedSpans, err := set.MeterProvider.Meter(meterName).Int64Counter(
+		limitedSpansName,
+		metric.WithDescription("Total count of spans refused or dropped by the receiver rate limit"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register receiver rate limit metrics: %w", err)
+	}
+
+	return &limitedConsumer{
+		next:     next,
+		receiver: set.ID.String(),
+		policy:   l.cfg.overflowPolicy(),
+		limiter:  l.limiterFor(set.ID),
+		limited:  limitedSpans,
+	}, nil
+}
+
+type limitedConsumer struct {
+	next     consumer.Traces
+	receiver string
+	policy   string
+	limiter  *rate.Limiter
+	limited  metric.Int64Counter
+}
+
+var _ consumer.Traces = (*limitedConsumer)(nil)
+
+// Capabilities implements consumer.Traces.
+func (c *limitedConsumer) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+// ConsumeTraces implements consumer.Traces.
+func (c *limitedConsumer) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	spans := td.SpanCount()
+	if c.limiter.AllowN(time.Now(), spans) {
+		return c.next.ConsumeTraces(ctx, td)
+	}
+
+	c.limited.Add(ctx, int64(spans), metric.WithAttributes(
+		attribute.String(receiverAttribute, c.receiver),
+		attribute.String(overflowAttribute, c.policy),
+	))
+	if c.policy == OverflowPolicyDrop {
+		return nil
+	}
+	return status.Errorf(codes.ResourceExhausted, "receiver %s exceeded its rate limit, %d spans rejected", c.receiver, spans)
+}
+
+// NewFactory wraps f so that the trace receivers it creates only accept spans
+// within the rate limit of l.
+func NewFactory(f receiver.Factory, l *Limiter) receiver.Factory {
+	return &factory{Factory: f, limiter: l}
+}
+
+type factory struct {
+	receiver.Factory
+	limiter *Limiter
+}
+
+// CreateTracesReceiver implements receiver.Factory.
+func (f *factory) CreateTracesReceiver(ctx context.Context, set receiver.CreateSettings, cfg component.Config, next consumer.Traces) (receiver.Traces, error) {
+	limited, err := f.limiter.Consumer(set, next)
+	if err != nil {
+		return nil, err
+	}
+	return f.Factory.CreateTracesReceiver(ctx, set, cfg, limited)
+}
@@ -0,0 +1,232 @@
+package receiverratelimit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/grafana/agent/internal/static/traces/traceutils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/receiver"
+	"go.opentelemetry.io/collector/receiver/receivertest"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConsumer(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		pushes []int
+
+		expectErrs  []bool
+		expectSpans int
+		expected    string
+	}{
+		{
+			name:        "within the limit",
+			cfg:         Config{SpansPerSecond: 1, Burst: 10},
+			pushes:      []int{4, 6},
+			expectErrs:  []bool{false, false},
+			expectSpans: 10,
+		},
+		{
+			name:        "rejected",
+			cfg:         Config{SpansPerSecond: 1, Burst: 10},
+			pushes:      []int{8, 5, 2},
+			expectErrs:  []bool{false, true, false},
+			expectSpans: 10,
+			expected: `
+				# HELP traces_receiver_rate_limited_spans_total Total count of spans refused or dropped by the receiver rate limit
+				# TYPE traces_receiver_rate_limited_spans_total counter
+				traces_receiver_rate_limited_spans_total{overflow_policy="reject",receiver="otlp"} 5
+			`,
+		},
+		{
+			name:        "more spans than the burst",
+			cfg:         Config{SpansPerSecond: 1, Burst: 10, OverflowPolicy: OverflowPolicyReject},
+			pushes:      []int{11},
+			expectErrs:  []bool{true},
+			expectSpans: 0,
+			expected: `
+				# HELP traces_receiver_rate_limited_spans_total Total count of spans refused or dropped by the receiver rate limit
+				# TYPE traces_receiver_rate_limited_spans_total counter
+				traces_receiver_rate_limited_spans_total{overflow_policy="reject",receiver="otlp"} 11
+			`,
+		},
+		{
+			name:        "dropped",
+			cfg:         Config{SpansPerSecond: 1, Burst: 10, OverflowPolicy: OverflowPolicyDrop},
+			pushes:      []int{8, 5},
+			expectErrs:  []bool{false, false},
+			expectSpans: 8,
+			expected: `
+				# HELP traces_receiver_rate_limited_spans_total Total count of spans refused or dropped by the receiver rate limit
+				# TYPE traces_receiver_rate_limited_spans_total counter
+				traces_receiver_rate_limited_spans_total{overflow_policy="drop",receiver="otlp"} 5
+			`,
+		},
+		{
+			name:        "default burst",
+			cfg:         Config{SpansPerSecond: 5},
+			pushes:      []int{5, 1},
+			expectErrs:  []bool{false, true},
+			expectSpans: 5,
+			expected: `
+				# HELP traces_receiver_rate_limited_spans_total Total count of spans refused or dropped by the receiver rate limit
+				# TYPE traces_receiver_rate_limited_spans_total counter
+				traces_receiver_rate_limited_spans_total{overflow_policy="reject",receiver="otlp"} 1
+			`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			set := newCreateSettings(t, reg, "otlp")
+
+			sink := new(consumertest.TracesSink)
+			c, err := New(tc.cfg).Consumer(set, sink)
+			require.NoError(t, err)
+
+			for i, spans := range tc.pushes {
+				err := c.ConsumeTraces(context.Background(), newTraces(spans))
+				if !tc.expectErrs[i] {
+					require.NoError(t, err)
+					continue
+				}
+				require.Error(t, err)
+				require.Equal(t, codes.ResourceExhausted, status.Code(err))
+			}
+
+			require.Equal(t, tc.expectSpans, sink.SpanCount())
+			require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(tc.expected)))
+		})
+	}
+}
+
+func TestLimiter_PerReceiver(t *testing.T) {
+	for _, perReceiver := range []bool{false, true} {
+		l := New(Config{SpansPerSecond: 1, Burst: 10, PerReceiver: perReceiver})
+
+		sink := new(consumertest.TracesSink)
+		otlp, err := l.Consumer(newCreateSettings(t, prometheus.NewRegistry(), "otlp"), sink)
+		require.NoError(t, err)
+		jaeger, err := l.Consumer(newCreateSettings(t, prometheus.NewRegistry(), "jaeger"), sink)
+		require.NoError(t, err)
+
+		require.NoError(t, otlp.ConsumeTraces(context.Background(), newTraces(10)))
+		err = jaeger.ConsumeTraces(context.Background(), newTraces(10))
+		if perReceiver {
+			// Each receiver has its own limit.
+			require.NoError(t, err)
+		} else {
+			// The limit is shared by all the receivers.
+			require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		}
+	}
+}
+
+func TestLimiter_Excluded(t *testing.T) {
+	l := New(Config{SpansPerSecond: 1, Burst: 1}, "otlp/lb")
+
+	sink := new(consumertest.TracesSink)
+	c, err := l.Consumer(newCreateSettings(t, prometheus.NewRegistry(), "otlp/lb"), sink)
+	require.NoError(t, err)
+	require.NoError(t, c.ConsumeTraces(context.Background(), newTraces(100)))
+	require.Equal(t, 100, sink.SpanCount())
+}
+
+func TestNewFactory(t *testing.T) {
+	var next consumer.Traces
+	f := receiver.NewFactory("fake", func() component.Config { return &struct{}{} },
+		receiver.WithTraces(func(_ context.Context, _ receiver.CreateSettings, _ component.Config, c consumer.Traces) (receiver.Traces, error) {
+			next = c
+			return struct {
+				component.StartFunc
+				component.ShutdownFunc
+			}{}, nil
+		}, component.StabilityLevelUndefined))
+
+	sink := new(consumertest.TracesSink)
+	wrapped := NewFactory(f, New(Config{SpansPerSecond: 1, Burst: 5}))
+	require.Equal(t, f.Type(), wrapped.Type())
+
+	set := newCreateSettings(t, prometheus.NewRegistry(), "fake")
+	_, err := wrapped.CreateTracesReceiver(context.Background(), set, wrapped.CreateDefaultConfig(), sink)
+	require.NoError(t, err)
+
+	// Spans pushed by the receiver are rate limited.
+	require.NoError(t, next.ConsumeTraces(context.Background(), newTraces(5)))
+	require.Equal(t, codes.ResourceExhausted, status.Code(next.ConsumeTraces(context.Background(), newTraces(1))))
+	require.Equal(t, 5, sink.SpanCount())
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		expectErr string
+	}{
+		{
+			name: "valid",
+			cfg:  Config{SpansPerSecond: 100, Burst: 200, OverflowPolicy: OverflowPolicyDrop},
+		},
+		{
+			name:      "missing rate",
+			cfg:       Config{Burst: 200},
+			expectErr: "spans_per_second must be greater than 0",
+		},
+		{
+			name:      "negative burst",
+			cfg:       Config{SpansPerSecond: 100, Burst: -1},
+			expectErr: "burst must not be negative",
+		},
+		{
+			name:      "unknown overflow policy",
+			cfg:       Config{SpansPerSecond: 100, OverflowPolicy: "block"},
+			expectErr: `unsupported overflow_policy "block"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.expectErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+}
+
+func newCreateSettings(t *testing.T, reg prometheus.Registerer, id string) receiver.CreateSettings {
+	t.Helper()
+
+	promExporter, err := traceutils.PrometheusExporter(reg)
+	require.NoError(t, err)
+
+	set := receivertest.NewNopCreateSettings()
+	set.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(promExporter))
+
+	typ, name, _ := strings.Cut(id, "/")
+	set.ID = component.NewIDWithName(component.Type(typ), name)
+	return set
+}
+
+func newTraces(spans int) ptrace.Traces {
+	traces := ptrace.NewTraces()
+	ss := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty()
+	for i := 0; i < spans; i++ {
+		ss.Spans().AppendEmpty().SetName("test")
+	}
+	return traces
+}
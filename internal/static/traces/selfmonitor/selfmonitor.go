@@ -0,0 +1,375 @@
+// Package selfmonitor measures the latency of a traces pipeline by
+// periodically pushing a synthetic trace through it, and measuring the time
+// until each exporter sent it.
+//
+// The spans of synthetic traces carry MarkerAttribute. Exporters created by
+// the factories wrapped with NewFactory remove them from the requests they
+// send, so that they never reach a backend, and record the latency once the
+// rest of the request was acknowledged. Processors created by the factories
+// wrapped with NewProcessorFactory don't process them.
+package selfmonitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/processor"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	// MarkerAttribute is the span attribute set on the spans of synthetic
+	// traces.
+	MarkerAttribute = "grafana_agent.self_monitoring"
+	// ServiceName is the service name of synthetic traces.
+	ServiceName = "grafana-agent-self-monitoring"
+	// DefaultInterval is the interval between synthetic traces when none is
+	// configured.
+	DefaultInterval = time.Minute
+
+	meterName         = "self_monitoring"
+	latencyName       = "self_monitoring_latency_seconds"
+	exporterAttribute = "exporter"
+)
+
+// Config configures the self monitoring of a pipeline.
+type Config struct {
+	// Enabled pushes synthetic traces through the pipeline.
+	Enabled bool `yaml:"enabled"`
+	// Interval between synthetic traces. Zero means DefaultInterval.
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// Validate returns an error if the config is invalid.
+func (c *Config) Validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("self_monitoring: interval must not be negative")
+	}
+	return nil
+}
+
+func (c *Config) interval() time.Duration {
+	if c.Interval == 0 {
+		return DefaultInterval
+	}
+	return c.Interval
+}
+
+// OtelMetricViews returns the views of the latency histogram, whose default
+// buckets are meant for milliseconds.
+func OtelMetricViews() []sdkmetric.View {
+	return []sdkmetric.View{
+		sdkmetric.NewView(
+			sdkmetric.Instrument{Name: latencyName},
+			sdkmetric.Stream{Aggregation: sdkmetric.AggregationExplicitBucketHistogram{
+				Boundaries: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+			}},
+		),
+	}
+}
+
+// NewTraces returns a synthetic trace made of a single span started at now.
+func NewTraces(now time.Time) ptrace.Traces {
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", ServiceName)
+
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID(newTraceID(now))
+	span.SetSpanID(pcommon.SpanID([8]byte{1}))
+	span.SetName("self-monitoring")
+	span.SetKind(ptrace.SpanKindInternal)
+	span.SetStartTimestamp(pcommon.NewTimestampFromTime(now))
+	span.SetEndTimestamp(pcommon.NewTimestampFromTime(now))
+	span.Attributes().PutBool(MarkerAttribute, true)
+	return td
+}
+
+// newTraceID returns a distinct trace ID for each synthetic trace, so that
+// processors grouping spans by trace don't merge them.
+func newTraceID(now time.Time) pcommon.TraceID {
+	var id [16]byte
+	nanos := now.UnixNano()
+	for i := 0; i < 8; i++ {
+		id[15-i] = byte(nanos >> (8 * i))
+	}
+	return id
+}
+
+// Run pushes a synthetic trace to the consumer returned by next every
+// interval of cfg, until ctx is done. Nothing is pushed while next returns
+// nil.
+func Run(ctx context.Context, cfg Config, next func() consumer.Traces, logger *zap.Logger) {
+	ticker := time.NewTicker(cfg.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c := next()
+			if c == nil {
+				continue
+			}
+			if err := c.ConsumeTraces(ctx, NewTraces(time.Now())); err != nil {
+				logger.Debug("failed to push self monitoring trace", zap.Error(err))
+			}
+		}
+	}
+}
+
+// NewFactory wraps f so that the trace exporters it creates remove synthetic
+// spans from the requests they send, and record their latency once the
+// requests are acknowledged by the backend.
+//
+// Exporters send requests from the consumers of their sending queue, after
+// ConsumeTraces returned. Acknowledged requests are detected by the end of
+// the span the exporter helper starts around each attempt to send a request
+// with the tracer provider of the exporter, which is wrapped to measure the
+// requests carrying synthetic spans.
+func NewFactory(f exporter.Factory) exporter.Factory {
+	return &factory{Factory: f}
+}
+
+type factory struct {
+	exporter.Factory
+}
+
+// CreateTracesExporter implements exporter.Factory.
+func (f *factory) CreateTracesExporter(ctx context.Context, set exporter.CreateSettings, cfg component.Config) (exporter.Traces, error) {
+	latency, err := set.MeterProvider.Meter(meterName).Float64Histogram(
+		latencyName,
+		metric.WithDescription("Time from pushing a synthetic trace to the pipeline until the request of the exporter which contained it was acknowledged"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register self monitoring metrics: %w", err)
+	}
+
+	set.TracerProvider = &ackTracerProvider{
+		TracerProvider: set.TracerProvider,
+		// Name of the span started by the exporter helper around each
+		// attempt to send a request.
+		spanName: "exporter/" + set.ID.String() + "/traces",
+		latency:  latency,
+		attrs:    metric.WithAttributes(attribute.String(exporterAttribute, set.ID.String())),
+	}
+	exp, err := f.Factory.CreateTracesExporter(ctx, set, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &measuringExporter{Traces: exp}, nil
+}
+
+type measuringExporter struct {
+	exporter.Traces
+}
+
+// Capabilities implements consumer.Traces. Synthetic spans are removed from
+// the traces consumed.
+func (e *measuringExporter) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: true}
+}
+
+// ConsumeTraces implements consumer.Traces. The start times of the synthetic
+// spans are carried by the context of the request, which is kept by the
+// sending queue, until it's acknowledged.
+func (e *measuringExporter) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	started := removeSynthetic(td)
+	if len(started) == 0 {
+		return e.Traces.ConsumeTraces(ctx, td)
+	}
+	if td.SpanCount() == 0 {
+		// Requests made only of synthetic spans aren't sent, so they're never
+		// acknowledged.
+		return nil
+	}
+	return e.Traces.ConsumeTraces(context.WithValue(ctx, pendingKey{}, &pending{started: started}), td)
+}
+
+type pendingKey struct{}
+
+// pending holds the start times of the synthetic spans removed from a request
+// until it's acknowledged.
+type pending struct {
+	started []time.Time
+	once    sync.Once
+}
+
+// ackTracerProvider records the latency of the synthetic spans of a request
+// when the span of an attempt to send it ends without error.
+type ackTracerProvider struct {
+	trace.TracerProvider
+	spanName string
+	latency  metric.Float64Histogram
+	attrs    metric.MeasurementOption
+}
+
+// Tracer implements trace.TracerProvider.
+func (p *ackTracerProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return &ackTracer{Tracer: p.TracerProvider.Tracer(name, opts...), provider: p}
+}
+
+type ackTracer struct {
+	trace.Tracer
+	provider *ackTracerProvider
+}
+
+// Start implements trace.Tracer.
+func (t *ackTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := t.Tracer.Start(ctx, name, opts...)
+	p, ok := ctx.Value(pendingKey{}).(*pending)
+	if !ok || name != t.provider.spanName {
+		return ctx, span
+	}
+
+	s := &ackSpan{Span: span, provider: t.provider, pending: p}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type ackSpan struct {
+	trace.Span
+	provider *ackTracerProvider
+	pending  *pending
+	failed   atomic.Bool
+}
+
+// IsRecording implements trace.Span. The span is always recording, so that
+// the exporter helper sets its status.
+func (s *ackSpan) IsRecording() bool { return true }
+
+// SetStatus implements trace.Span.
+func (s *ackSpan) SetStatus(code codes.Code, description string) {
+	if code == codes.Error {
+		s.failed.Store(true)
+	}
+	s.Span.SetStatus(code, description)
+}
+
+// End implements trace.Span.
+func (s *ackSpan) End(options ...trace.SpanEndOption) {
+	s.Span.End(options...)
+	if s.failed.Load() {
+		return
+	}
+
+	s.pending.once.Do(func() {
+		now := time.Now()
+		for _, start := range s.pending.started {
+			s.provider.latency.Record(context.Background(), now.Sub(start).Seconds(), s.provider.attrs)
+		}
+	})
+}
+
+// NewProcessorFactory wraps f so that the synthetic spans bypass the trace
+// processors it creates and are passed to the next consumer directly, for
+// processors which would otherwise generate metrics or logs from them.
+func NewProcessorFactory(f processor.Factory) processor.Factory {
+	return &processorFactory{Factory: f}
+}
+
+type processorFactory struct {
+	processor.Factory
+}
+
+// CreateTracesProcessor implements processor.Factory.
+func (f *processorFactory) CreateTracesProcessor(ctx context.Context, set processor.CreateSettings, cfg component.Config, next consumer.Traces) (processor.Traces, error) {
+	p, err := f.Factory.CreateTracesProcessor(ctx, set, cfg, next)
+	if err != nil {
+		return nil, err
+	}
+	return &bypassProcessor{Traces: p, next: next}, nil
+}
+
+type bypassProcessor struct {
+	processor.Traces
+	next consumer.Traces
+}
+
+// Capabilities implements consumer.Traces. Synthetic spans are removed from
+// the traces consumed.
+func (p *bypassProcessor) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: true}
+}
+
+// ConsumeTraces implements consumer.Traces.
+func (p *bypassProcessor) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	synthetic := splitSynthetic(td)
+	if synthetic.SpanCount() == 0 {
+		return p.Traces.ConsumeTraces(ctx, td)
+	}
+
+	if td.SpanCount() > 0 {
+		if err := p.Traces.ConsumeTraces(ctx, td); err != nil {
+			return err
+		}
+	}
+	return p.next.ConsumeTraces(ctx, synthetic)
+}
+
+// splitSynthetic moves the spans of synthetic traces from td to the traces
+// it returns.
+func splitSynthetic(td ptrace.Traces) ptrace.Traces {
+	synthetic := ptrace.NewTraces()
+	td.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		var syntheticRS *ptrace.ResourceSpans
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			var syntheticSS *ptrace.ScopeSpans
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				if _, ok := span.Attributes().Get(MarkerAttribute); !ok {
+					return false
+				}
+				if syntheticRS == nil {
+					newRS := synthetic.ResourceSpans().AppendEmpty()
+					rs.Resource().CopyTo(newRS.Resource())
+					newRS.SetSchemaUrl(rs.SchemaUrl())
+					syntheticRS = &newRS
+				}
+				if syntheticSS == nil {
+					newSS := syntheticRS.ScopeSpans().AppendEmpty()
+					ss.Scope().CopyTo(newSS.Scope())
+					newSS.SetSchemaUrl(ss.SchemaUrl())
+					syntheticSS = &newSS
+				}
+				span.CopyTo(syntheticSS.Spans().AppendEmpty())
+				return true
+			})
+			return ss.Spans().Len() == 0
+		})
+		return rs.ScopeSpans().Len() == 0
+	})
+	return synthetic
+}
+
+// removeSynthetic removes the spans of synthetic traces from td and returns
+// their start time.
+func removeSynthetic(td ptrace.Traces) []time.Time {
+	var started []time.Time
+	td.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				if _, ok := span.Attributes().Get(MarkerAttribute); !ok {
+					return false
+				}
+				started = append(started, span.StartTimestamp().AsTime())
+				return true
+			})
+			return ss.Spans().Len() == 0
+		})
+		return rs.ScopeSpans().Len() == 0
+	})
+	return started
+}
@@ -0,0 +1,181 @@
+package selfmonitor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/agent/internal/static/traces/traceutils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/processor"
+	"go.opentelemetry.io/collector/processor/processortest"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestMeasuringExporter(t *testing.T) {
+	sink := new(consumertest.TracesSink)
+	fake := &fakeExporter{Traces: sink}
+	f := exporter.NewFactory("fake", func() component.Config { return &struct{}{} },
+		exporter.WithTraces(func(_ context.Context, set exporter.CreateSettings, _ component.Config) (exporter.Traces, error) {
+			fake.tracer = set.TracerProvider.Tracer("fake")
+			return fake, nil
+		}, component.StabilityLevelUndefined))
+
+	reg := prometheus.NewRegistry()
+	exp, err := NewFactory(f).CreateTracesExporter(context.Background(), newCreateSettings(t, reg, "fake"), f.CreateDefaultConfig())
+	require.NoError(t, err)
+	require.True(t, exp.Capabilities().MutatesData)
+
+	// Requests made only of synthetic spans aren't sent, nor measured.
+	require.NoError(t, exp.ConsumeTraces(context.Background(), NewTraces(time.Now().Add(-time.Second))))
+	require.Zero(t, sink.SpanCount())
+	require.Zero(t, latencyCount(t, reg))
+
+	// Synthetic spans are removed from the other requests, and measured once
+	// they're acknowledged.
+	require.NoError(t, exp.ConsumeTraces(context.Background(), withRealSpan(NewTraces(time.Now()))))
+	require.Equal(t, 1, sink.SpanCount())
+	require.Equal(t, "real", sink.AllTraces()[0].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Name())
+	require.Equal(t, uint64(1), latencyCount(t, reg))
+
+	// Requests which fail aren't measured.
+	fake.err = errors.New("backend unavailable")
+	require.Error(t, exp.ConsumeTraces(context.Background(), withRealSpan(NewTraces(time.Now()))))
+	require.Equal(t, uint64(1), latencyCount(t, reg))
+	fake.err = nil
+
+	// Requests without synthetic spans aren't measured.
+	require.NoError(t, exp.ConsumeTraces(context.Background(), withRealSpan(ptrace.NewTraces())))
+	require.Equal(t, uint64(1), latencyCount(t, reg))
+}
+
+func TestProcessorFactory(t *testing.T) {
+	processed := new(consumertest.TracesSink)
+	f := processor.NewFactory("fake", func() component.Config { return &struct{}{} },
+		processor.WithTraces(func(_ context.Context, _ processor.CreateSettings, _ component.Config, next consumer.Traces) (processor.Traces, error) {
+			return &fakeProcessor{processed: processed, next: next}, nil
+		}, component.StabilityLevelUndefined))
+
+	next := new(consumertest.TracesSink)
+	p, err := NewProcessorFactory(f).CreateTracesProcessor(context.Background(), processortest.NewNopCreateSettings(), f.CreateDefaultConfig(), next)
+	require.NoError(t, err)
+
+	// Synthetic spans bypass the processor, other spans are processed.
+	require.NoError(t, p.ConsumeTraces(context.Background(), NewTraces(time.Now())))
+	require.NoError(t, p.ConsumeTraces(context.Background(), withRealSpan(NewTraces(time.Now()))))
+	require.Equal(t, 1, processed.SpanCount())
+	require.Equal(t, "real", processed.AllTraces()[0].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Name())
+	require.Equal(t, 3, next.SpanCount())
+}
+
+func TestRun(t *testing.T) {
+	sink := new(consumertest.TracesSink)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(ctx, Config{Enabled: true, Interval: 10 * time.Millisecond}, func() consumer.Traces { return sink }, zap.NewNop())
+	}()
+
+	require.Eventually(t, func() bool { return sink.SpanCount() >= 2 }, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	span := sink.AllTraces()[0].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	_, ok := span.Attributes().Get(MarkerAttribute)
+	require.True(t, ok)
+	require.NotEqual(t, span.TraceID(), sink.AllTraces()[1].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).TraceID())
+}
+
+func TestConfig_Validate(t *testing.T) {
+	require.NoError(t, (&Config{Enabled: true}).Validate())
+	require.EqualError(t, (&Config{Enabled: true, Interval: -time.Second}).Validate(), "self_monitoring: interval must not be negative")
+	require.Equal(t, DefaultInterval, (&Config{}).interval())
+}
+
+func latencyCount(t *testing.T, reg *prometheus.Registry) uint64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range families {
+		if mf.GetName() != "traces_"+latencyName {
+			continue
+		}
+		require.Len(t, mf.GetMetric(), 1)
+		return mf.GetMetric()[0].GetHistogram().GetSampleCount()
+	}
+	return 0
+}
+
+func newCreateSettings(t *testing.T, reg prometheus.Registerer, id string) exporter.CreateSettings {
+	t.Helper()
+
+	promExporter, err := traceutils.PrometheusExporter(reg)
+	require.NoError(t, err)
+
+	set := exportertest.NewNopCreateSettings()
+	set.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(promExporter), sdkmetric.WithView(OtelMetricViews()...))
+
+	typ, name, _ := strings.Cut(id, "/")
+	set.ID = component.NewIDWithName(component.Type(typ), name)
+	return set
+}
+
+// withRealSpan adds a span which isn't synthetic to td.
+func withRealSpan(td ptrace.Traces) ptrace.Traces {
+	span := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("real")
+	return td
+}
+
+// fakeExporter starts a span around sending each request, like the exporter
+// helper does.
+type fakeExporter struct {
+	component.StartFunc
+	component.ShutdownFunc
+	consumer.Traces
+	tracer trace.Tracer
+	err    error
+}
+
+func (e *fakeExporter) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	ctx, span := e.tracer.Start(ctx, "exporter/fake/traces")
+	defer span.End()
+
+	if e.err != nil {
+		span.SetStatus(codes.Error, e.err.Error())
+		return e.err
+	}
+	return e.Traces.ConsumeTraces(ctx, td)
+}
+
+type fakeProcessor struct {
+	component.StartFunc
+	component.ShutdownFunc
+	processed *consumertest.TracesSink
+	next      consumer.Traces
+}
+
+func (p *fakeProcessor) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+func (p *fakeProcessor) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	if err := p.processed.ConsumeTraces(ctx, td); err != nil {
+		return err
+	}
+	return p.next.ConsumeTraces(ctx, td)
+}
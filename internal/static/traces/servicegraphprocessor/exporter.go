@@ -0,0 +1,124 @@
+package servicegraphprocessor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// getMetricsExporter returns the metrics exporter of host with the given ID.
+func getMetricsExporter(host component.Host, id string) (consumer.Metrics, error) {
+	for expID, exp := range host.GetExporters()[component.DataTypeMetrics] {
+		if expID.String() != id {
+			continue
+		}
+		metricsExp, ok := exp.(consumer.Metrics)
+		if !ok {
+			return nil, fmt.Errorf("exporter %q can't export metrics", id)
+		}
+		return metricsExp, nil
+	}
+	return nil, fmt.Errorf("metrics exporter %q not found, it must be part of a metrics pipeline", id)
+}
+
+// flushLoop pushes the metrics to exporter every metricsFlushInterval, and a
+// last time once the processor shuts down.
+func (p *processor) flushLoop(exporter consumer.Metrics) {
+	defer close(p.flushDone)
+
+	ticker := time.NewTicker(p.metricsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.flush(exporter)
+		case <-p.closeCh:
+			p.flush(exporter)
+			return
+		}
+	}
+}
+
+func (p *processor) flush(exporter consumer.Metrics) {
+	ctx := context.Background()
+
+	var rm metricdata.ResourceMetrics
+	if err := p.reader.Collect(ctx, &rm); err != nil {
+		level.Error(p.logger).Log("msg", "failed to collect service graph metrics", "err", err)
+		return
+	}
+	md := toMetrics(&rm)
+	if md.DataPointCount() == 0 {
+		return
+	}
+	if err := exporter.ConsumeMetrics(ctx, md); err != nil {
+		level.Error(p.logger).Log("msg", "failed to export service graph metrics", "exporter", p.metricsExporter, "err", err)
+	}
+}
+
+// toMetrics converts the metrics collected from the instruments of the
+// processor. Counters are cumulative sums, named with a _total suffix like
+// the metrics exposed with the metrics of the agent.
+func toMetrics(rm *metricdata.ResourceMetrics) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	metrics := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics()
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[float64]:
+				metric := metrics.AppendEmpty()
+				metric.SetName(m.Name)
+				if data.IsMonotonic {
+					metric.SetName(m.Name + "_total")
+				}
+				metric.SetDescription(m.Description)
+				sum := metric.SetEmptySum()
+				sum.SetIsMonotonic(data.IsMonotonic)
+				sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+				for _, dp := range data.DataPoints {
+					point := sum.DataPoints().AppendEmpty()
+					putAttributes(point.Attributes(), dp.Attributes)
+					point.SetStartTimestamp(pcommon.NewTimestampFromTime(dp.StartTime))
+					point.SetTimestamp(pcommon.NewTimestampFromTime(dp.Time))
+					point.SetDoubleValue(dp.Value)
+				}
+
+			case metricdata.Histogram[float64]:
+				metric := metrics.AppendEmpty()
+				metric.SetName(m.Name)
+				metric.SetDescription(m.Description)
+				histogram := metric.SetEmptyHistogram()
+				histogram.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+				for _, dp := range data.DataPoints {
+					point := histogram.DataPoints().AppendEmpty()
+					putAttributes(point.Attributes(), dp.Attributes)
+					point.SetStartTimestamp(pcommon.NewTimestampFromTime(dp.StartTime))
+					point.SetTimestamp(pcommon.NewTimestampFromTime(dp.Time))
+					point.SetCount(dp.Count)
+					point.SetSum(dp.Sum)
+					point.ExplicitBounds().FromRaw(dp.Bounds)
+					point.BucketCounts().FromRaw(dp.BucketCounts)
+				}
+			}
+		}
+	}
+	return md
+}
+
+func putAttributes(dst pcommon.Map, attrs attribute.Set) {
+	iter := attrs.Iter()
+	for iter.Next() {
+		kv := iter.Attribute()
+		dst.PutStr(string(kv.Key), kv.Value.Emit())
+	}
+}
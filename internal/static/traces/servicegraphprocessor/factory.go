@@ -19,6 +19,9 @@ const (
 	DefaultMaxItems = 10_000
 	// DefaultWorkers is the default amount of workers that will be used to process the edges
 	DefaultWorkers = 10
+	// DefaultMetricsFlushInterval is the default interval at which metrics are
+	// pushed to the metrics exporter.
+	DefaultMetricsFlushInterval = time.Second * 15
 )
 
 // Config holds the configuration for the Prometheus service graph processor.
@@ -29,6 +32,13 @@ type Config struct {
 	Workers int `mapstructure:"workers"`
 
 	SuccessCodes *successCodes `mapstructure:"success_codes"`
+
+	// MetricsExporter is the ID of the metrics exporter the metrics are pushed
+	// to. When empty, the metrics are exposed with the metrics of the agent.
+	MetricsExporter string `mapstructure:"metrics_exporter"`
+	// MetricsFlushInterval is the interval at which metrics are pushed to
+	// MetricsExporter.
+	MetricsFlushInterval time.Duration `mapstructure:"metrics_flush_interval"`
 }
 
 type successCodes struct {
@@ -93,6 +93,15 @@ type processor struct {
 	httpSuccessCodeMap map[int]struct{}
 	grpcSuccessCodeMap map[int]struct{}
 
+	// metricsExporter is the ID of the exporter the metrics are pushed to. When
+	// set, the metrics are read from reader instead of being exposed with the
+	// metrics of the agent.
+	metricsExporter      string
+	metricsFlushInterval time.Duration
+	meterProvider        *sdkmetric.MeterProvider
+	reader               *sdkmetric.ManualReader
+	flushDone            chan struct{}
+
 	logger  log.Logger
 	closeCh chan struct{}
 }
@@ -109,6 +118,9 @@ func newProcessor(nextConsumer consumer.Traces, cfg *Config, set otelprocessor.C
 	if cfg.Workers == 0 {
 		cfg.Workers = DefaultWorkers
 	}
+	if cfg.MetricsFlushInterval == 0 {
+		cfg.MetricsFlushInterval = DefaultMetricsFlushInterval
+	}
 
 	var (
 		httpSuccessCodeMap = make(map[int]struct{})
@@ -134,6 +146,10 @@ func newProcessor(nextConsumer consumer.Traces, cfg *Config, set otelprocessor.C
 
 		collectCh: make(chan string, cfg.Workers),
 
+		metricsExporter:      cfg.MetricsExporter,
+		metricsFlushInterval: cfg.MetricsFlushInterval,
+		flushDone:            make(chan struct{}),
+
 		closeCh: make(chan struct{}, 1),
 	}
 
@@ -151,7 +167,17 @@ func newProcessor(nextConsumer consumer.Traces, cfg *Config, set otelprocessor.C
 		}()
 	}
 
-	err := p.registerMetrics(set.MeterProvider, set.ID.String())
+	var mp metric.MeterProvider = set.MeterProvider
+	if p.metricsExporter != "" {
+		p.reader = sdkmetric.NewManualReader()
+		p.meterProvider = sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(p.reader),
+			sdkmetric.WithView(OtelMetricViews()...),
+		)
+		mp = p.meterProvider
+	}
+
+	err := p.registerMetrics(mp, set.ID.String())
 	if err != nil {
 		return nil, fmt.Errorf("failed to register service graph metrics: %w", err)
 	}
@@ -159,10 +185,21 @@ func newProcessor(nextConsumer consumer.Traces, cfg *Config, set otelprocessor.C
 	return p, nil
 }
 
-func (p *processor) Start(_ context.Context, _ component.Host) error {
+func (p *processor) Start(_ context.Context, host component.Host) error {
 	// initialize store
 	p.store = newStore(p.wait, p.maxItems, p.collectEdge)
 
+	if p.metricsExporter == "" {
+		close(p.flushDone)
+		return nil
+	}
+	exporter, err := getMetricsExporter(host, p.metricsExporter)
+	if err != nil {
+		close(p.flushDone)
+		return err
+	}
+	go p.flushLoop(exporter)
+
 	return nil
 }
 
@@ -238,9 +275,19 @@ func OtelMetricViews() []sdkmetric.View {
 	}
 }
 
-func (p *processor) Shutdown(context.Context) error {
+func (p *processor) Shutdown(ctx context.Context) error {
 	close(p.closeCh)
-	return nil
+
+	if p.meterProvider == nil {
+		return nil
+	}
+	// Wait for the last flush, exporters are shut down after processors.
+	select {
+	case <-p.flushDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.meterProvider.Shutdown(ctx)
 }
 
 func (p *processor) Capabilities() consumer.Capabilities {
@@ -14,7 +14,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component"
 	otelcomponent "go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
 	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	otelprocessor "go.opentelemetry.io/collector/processor"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
@@ -113,6 +116,82 @@ func TestConsumeMetrics(t *testing.T) {
 	}
 }
 
+func TestMetricsExporter(t *testing.T) {
+	sink := new(consumertest.MetricsSink)
+	host := &exporterHost{
+		Host: componenttest.NewNopHost(),
+		exporters: map[component.DataType]map[component.ID]component.Component{
+			component.DataTypeMetrics: {
+				component.NewIDWithName("remote_write", "servicegraphs"): &sinkExporter{MetricsSink: sink},
+			},
+		},
+	}
+
+	processorSettings := otelprocessor.CreateSettings{
+		ID:                component.NewID("FakeID"),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+	}
+	p, err := newProcessor(&mockConsumer{}, &Config{
+		Wait:            time.Hour,
+		MetricsExporter: "remote_write/servicegraphs",
+	}, processorSettings)
+	require.NoError(t, err)
+	require.NoError(t, p.Start(context.Background(), host))
+
+	require.NoError(t, p.ConsumeTraces(context.Background(), traceSamples(t, traceSamplePath)))
+	collectMetrics(p)
+
+	// The metrics are pushed a last time on shutdown.
+	require.NoError(t, p.Shutdown(context.Background()))
+	require.NotEmpty(t, sink.AllMetrics())
+
+	requests := make(map[string]float64)
+	md := sink.AllMetrics()[len(sink.AllMetrics())-1]
+	metrics := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	for i := 0; i < metrics.Len(); i++ {
+		m := metrics.At(i)
+		if m.Name() != "service_graph_request_total" {
+			continue
+		}
+		require.Equal(t, pmetric.AggregationTemporalityCumulative, m.Sum().AggregationTemporality())
+		for j := 0; j < m.Sum().DataPoints().Len(); j++ {
+			dp := m.Sum().DataPoints().At(j)
+			client, _ := dp.Attributes().Get("client")
+			server, _ := dp.Attributes().Get("server")
+			requests[client.Str()+"->"+server.Str()] = dp.DoubleValue()
+		}
+	}
+	require.Equal(t, map[string]float64{"app->db": 3, "lb->app": 3}, requests)
+}
+
+func TestMetricsExporter_NotFound(t *testing.T) {
+	processorSettings := otelprocessor.CreateSettings{
+		ID:                component.NewID("FakeID"),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+	}
+	p, err := newProcessor(&mockConsumer{}, &Config{MetricsExporter: "remote_write/servicegraphs"}, processorSettings)
+	require.NoError(t, err)
+
+	err = p.Start(context.Background(), componenttest.NewNopHost())
+	require.EqualError(t, err, `metrics exporter "remote_write/servicegraphs" not found, it must be part of a metrics pipeline`)
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+type exporterHost struct {
+	component.Host
+	exporters map[component.DataType]map[component.ID]component.Component
+}
+
+func (h *exporterHost) GetExporters() map[component.DataType]map[component.ID]component.Component {
+	return h.exporters
+}
+
+type sinkExporter struct {
+	component.StartFunc
+	component.ShutdownFunc
+	*consumertest.MetricsSink
+}
+
 func getTestMeterProvider(t *testing.T, reg prometheus.Registerer) *sdkmetric.MeterProvider {
 	promExporter, err := traceutils.PrometheusExporter(reg)
 	require.NoError(t, err)
@@ -0,0 +1,156 @@
+// Package tailsamplingmetrics exposes the metrics of the tail sampling
+// processor through a Prometheus registry.
+//
+// The tail sampling processor records its metrics, such as the number of
+// traces sampled by each policy or the number of traces held in memory, as
+// OpenCensus views which are otherwise never exported by the agent.
+package tailsamplingmetrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opencensus.io/stats/view"
+)
+
+const (
+	namespace = "traces"
+	subsystem = "tail_sampling"
+
+	// viewPrefix is the prefix of the names of the views of the tail sampling
+	// processor.
+	viewPrefix = "processor/tail_sampling/"
+)
+
+// bridgedView is a view of the tail sampling processor exposed as a metric.
+type bridgedView struct {
+	view      string // Name of the view, without viewPrefix.
+	name      string // Name of the metric, without namespace and subsystem.
+	help      string
+	labels    []string             // Tags of the view.
+	valueType prometheus.ValueType // Ignored for distributions, exposed as histograms.
+}
+
+func (bv bridgedView) desc() *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, bv.name), bv.help, bv.labels, nil)
+}
+
+var bridgedViews = []bridgedView{
+	{
+		view:      "count_traces_sampled",
+		name:      "count_traces_sampled_total",
+		help:      "Number of traces sampled or not, by policy.",
+		labels:    []string{"policy", "sampled"},
+		valueType: prometheus.CounterValue,
+	},
+	{
+		view:      "global_count_traces_sampled",
+		name:      "global_count_traces_sampled_total",
+		help:      "Number of traces sampled or not by at least one policy.",
+		labels:    []string{"sampled"},
+		valueType: prometheus.CounterValue,
+	},
+	{
+		view:      "sampling_policy_evaluation_error",
+		name:      "policy_evaluation_errors_total",
+		help:      "Number of errors evaluating sampling policies.",
+		valueType: prometheus.CounterValue,
+	},
+	{
+		view:      "sampling_decision_latency",
+		name:      "decision_latency_microseconds",
+		help:      "Latency of the sampling decisions of each policy, in microseconds.",
+		labels:    []string{"policy"},
+		valueType: prometheus.UntypedValue,
+	},
+	{
+		view:      "sampling_trace_dropped_too_early",
+		name:      "traces_dropped_too_early_total",
+		help:      "Number of traces dropped from memory before a sampling decision was made, because num_traces was reached.",
+		valueType: prometheus.CounterValue,
+	},
+	{
+		view:      "new_trace_id_received",
+		name:      "new_traces_received_total",
+		help:      "Number of new traces received.",
+		valueType: prometheus.CounterValue,
+	},
+	{
+		view:      "sampling_traces_on_memory",
+		name:      "traces_on_memory",
+		help:      "Number of traces currently held in memory.",
+		valueType: prometheus.GaugeValue,
+	},
+}
+
+type collector struct{}
+
+// NewCollector returns a collector exposing the metrics recorded by the tail
+// sampling processors of the process. The views of the processor are
+// registered when its factory is created; metrics of views which aren't
+// registered are omitted.
+func NewCollector() prometheus.Collector {
+	return collector{}
+}
+
+// Describe implements prometheus.Collector.
+func (collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, bv := range bridgedViews {
+		ch <- bv.desc()
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (collector) Collect(ch chan<- prometheus.Metric) {
+	for _, bv := range bridgedViews {
+		v := view.Find(viewPrefix + bv.view)
+		if v == nil {
+			continue
+		}
+		rows, err := view.RetrieveData(v.Name)
+		if err != nil {
+			continue
+		}
+		for _, row := range rows {
+			if m := bv.metric(v, row); m != nil {
+				ch <- m
+			}
+		}
+	}
+}
+
+// metric returns row as a metric, or nil if its aggregation isn't supported.
+func (bv bridgedView) metric(v *view.View, row *view.Row) prometheus.Metric {
+	values := make([]string, len(bv.labels))
+	for _, t := range row.Tags {
+		for i, name := range bv.labels {
+			if t.Key.Name() == name {
+				values[i] = t.Value
+			}
+		}
+	}
+
+	desc := bv.desc()
+	switch data := row.Data.(type) {
+	case *view.CountData:
+		return prometheus.MustNewConstMetric(desc, bv.valueType, float64(data.Value), values...)
+	case *view.SumData:
+		return prometheus.MustNewConstMetric(desc, bv.valueType, data.Value, values...)
+	case *view.LastValueData:
+		return prometheus.MustNewConstMetric(desc, bv.valueType, data.Value, values...)
+	case *view.DistributionData:
+		var (
+			bounds  = v.Aggregation.Buckets
+			buckets = make(map[float64]uint64, len(bounds))
+			count   uint64
+		)
+		for i, bound := range bounds {
+			if i >= len(data.CountPerBucket) {
+				break
+			}
+			count += uint64(data.CountPerBucket[i])
+			buckets[bound] = count
+		}
+		return prometheus.MustNewConstHistogram(desc, uint64(data.Count), data.Sum(), buckets, values...)
+	default:
+		return nil
+	}
+}
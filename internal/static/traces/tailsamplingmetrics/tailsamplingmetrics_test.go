@@ -0,0 +1,74 @@
+package tailsamplingmetrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func TestCollector(t *testing.T) {
+	var (
+		policyKey  = tag.MustNewKey("policy")
+		sampledKey = tag.MustNewKey("sampled")
+
+		countSampled = stats.Int64("test_count_traces_sampled", "", stats.UnitDimensionless)
+		onMemory     = stats.Int64("test_sampling_traces_on_memory", "", stats.UnitDimensionless)
+		latency      = stats.Int64("test_sampling_decision_latency", "", "µs")
+	)
+	views := []*view.View{
+		{
+			Name:        viewPrefix + "count_traces_sampled",
+			Measure:     countSampled,
+			TagKeys:     []tag.Key{policyKey, sampledKey},
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        viewPrefix + "sampling_traces_on_memory",
+			Measure:     onMemory,
+			Aggregation: view.LastValue(),
+		},
+		{
+			Name:        viewPrefix + "sampling_decision_latency",
+			Measure:     latency,
+			TagKeys:     []tag.Key{policyKey},
+			Aggregation: view.Distribution(10, 100),
+		},
+	}
+	require.NoError(t, view.Register(views...))
+	t.Cleanup(func() { view.Unregister(views...) })
+
+	record := func(policy, sampled string, ms ...stats.Measurement) {
+		ctx, err := tag.New(context.Background(), tag.Upsert(policyKey, policy), tag.Upsert(sampledKey, sampled))
+		require.NoError(t, err)
+		stats.Record(ctx, ms...)
+	}
+	record("slow", "true", countSampled.M(2), latency.M(5))
+	record("slow", "false", countSampled.M(1), latency.M(50))
+	record("errors", "true", countSampled.M(3))
+	stats.Record(context.Background(), onMemory.M(42))
+
+	expect := `
+# HELP traces_tail_sampling_count_traces_sampled_total Number of traces sampled or not, by policy.
+# TYPE traces_tail_sampling_count_traces_sampled_total counter
+traces_tail_sampling_count_traces_sampled_total{policy="errors",sampled="true"} 3
+traces_tail_sampling_count_traces_sampled_total{policy="slow",sampled="false"} 1
+traces_tail_sampling_count_traces_sampled_total{policy="slow",sampled="true"} 2
+# HELP traces_tail_sampling_decision_latency_microseconds Latency of the sampling decisions of each policy, in microseconds.
+# TYPE traces_tail_sampling_decision_latency_microseconds histogram
+traces_tail_sampling_decision_latency_microseconds_bucket{policy="slow",le="10"} 1
+traces_tail_sampling_decision_latency_microseconds_bucket{policy="slow",le="100"} 2
+traces_tail_sampling_decision_latency_microseconds_bucket{policy="slow",le="+Inf"} 2
+traces_tail_sampling_decision_latency_microseconds_sum{policy="slow"} 55
+traces_tail_sampling_decision_latency_microseconds_count{policy="slow"} 2
+# HELP traces_tail_sampling_traces_on_memory Number of traces currently held in memory.
+# TYPE traces_tail_sampling_traces_on_memory gauge
+traces_tail_sampling_traces_on_memory 42
+`
+	require.NoError(t, testutil.CollectAndCompare(NewCollector(), strings.NewReader(expect)))
+}
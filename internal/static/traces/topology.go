@@ -0,0 +1,125 @@
+package traces
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/otelcol"
+	"go.uber.org/zap"
+)
+
+// Topology summarizes the pipelines run by a traces instance, as generated
+// from its config: processors are listed in the order they run in, and load
+// balancing shows up as separate pipelines.
+type Topology struct {
+	Receivers  []string           `json:"receivers" yaml:"receivers"`
+	Pipelines  []PipelineTopology `json:"pipelines" yaml:"pipelines"`
+	Exporters  []ExporterTopology `json:"exporters" yaml:"exporters"`
+	Extensions []string           `json:"extensions,omitempty" yaml:"extensions,omitempty"`
+}
+
+// PipelineTopology is a pipeline of a Topology.
+type PipelineTopology struct {
+	Name       string   `json:"name" yaml:"name"`
+	Receivers  []string `json:"receivers" yaml:"receivers"`
+	Processors []string `json:"processors" yaml:"processors"`
+	Exporters  []string `json:"exporters" yaml:"exporters"`
+}
+
+// String formats the pipeline as its receivers, processors and exporters.
+func (p PipelineTopology) String() string {
+	return fmt.Sprintf("%s: [%s] -> [%s] -> [%s]", p.Name,
+		strings.Join(p.Receivers, ","), strings.Join(p.Processors, ","), strings.Join(p.Exporters, ","))
+}
+
+// ExporterTopology is an exporter of a Topology. Format and Protocol are
+// empty for exporters which don't send spans to a tracing backend.
+type ExporterTopology struct {
+	Name     string `json:"name" yaml:"name"`
+	Format   string `json:"format,omitempty" yaml:"format,omitempty"`
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+}
+
+// String formats the exporter as its name, followed by its format and
+// protocol if known.
+func (e ExporterTopology) String() string {
+	if e.Format == "" {
+		return e.Name
+	}
+	return fmt.Sprintf("%s(%s/%s)", e.Name, e.Format, e.Protocol)
+}
+
+// exporterFormats are the format and the protocol of the exporters generated
+// from remote_write and load_balancing, by exporter type.
+var exporterFormats = map[component.Type]ExporterTopology{
+	"otlp":     {Format: formatOtlp, Protocol: protocolGRPC},
+	"otlphttp": {Format: formatOtlp, Protocol: protocolHTTP},
+	"jaeger":   {Format: formatJaeger, Protocol: protocolGRPC},
+	// The load balancing exporter always forwards spans to the other agents
+	// with OTLP over gRPC.
+	"loadbalancing": {Format: formatOtlp, Protocol: protocolGRPC},
+}
+
+// newTopology returns the topology of the collector config cfg.
+func newTopology(cfg *otelcol.Config) Topology {
+	var t Topology
+	for id := range cfg.Receivers {
+		t.Receivers = append(t.Receivers, id.String())
+	}
+	sort.Strings(t.Receivers)
+
+	for id := range cfg.Exporters {
+		e := exporterFormats[id.Type()]
+		e.Name = id.String()
+		t.Exporters = append(t.Exporters, e)
+	}
+	sort.Slice(t.Exporters, func(i, j int) bool { return t.Exporters[i].Name < t.Exporters[j].Name })
+
+	for _, id := range cfg.Service.Extensions {
+		t.Extensions = append(t.Extensions, id.String())
+	}
+
+	for id, p := range cfg.Service.Pipelines {
+		pipeline := PipelineTopology{
+			Name:       id.String(),
+			Receivers:  idStrings(p.Receivers),
+			Processors: idStrings(p.Processors),
+			Exporters:  idStrings(p.Exporters),
+		}
+		// Only the order of the processors matters.
+		sort.Strings(pipeline.Receivers)
+		sort.Strings(pipeline.Exporters)
+		t.Pipelines = append(t.Pipelines, pipeline)
+	}
+	sort.Slice(t.Pipelines, func(i, j int) bool { return t.Pipelines[i].Name < t.Pipelines[j].Name })
+
+	return t
+}
+
+func idStrings(ids []component.ID) []string {
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, id.String())
+	}
+	return res
+}
+
+// fields returns the topology as the fields of a log line.
+func (t Topology) fields() []zap.Field {
+	pipelines := make([]string, 0, len(t.Pipelines))
+	for _, p := range t.Pipelines {
+		pipelines = append(pipelines, p.String())
+	}
+	exporters := make([]string, 0, len(t.Exporters))
+	for _, e := range t.Exporters {
+		exporters = append(exporters, e.String())
+	}
+	return []zap.Field{
+		zap.Strings("receivers", t.Receivers),
+		zap.Strings("pipelines", pipelines),
+		zap.Strings("exporters", exporters),
+		zap.Strings("extensions", t.Extensions),
+	}
+}
@@ -0,0 +1,80 @@
+package traces
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestTopology(t *testing.T) {
+	cfgText := `
+receivers:
+  jaeger:
+    protocols:
+      grpc:
+remote_write:
+  - endpoint: example.com:12345
+    protocol: http
+batch:
+  timeout: 5s
+tail_sampling:
+  policies:
+    - type: always_sample
+attributes:
+  actions:
+  - key: montgomery
+    value: forever
+    action: update
+load_balancing:
+  receiver_port: 8181
+  exporter:
+    insecure: true
+  resolver:
+    static:
+      hostnames:
+        - agent-1:4317
+`
+	var cfg InstanceConfig
+	require.NoError(t, yaml.Unmarshal([]byte(cfgText), &cfg))
+	otelConfig, err := cfg.otelConfig()
+	require.NoError(t, err)
+
+	// The processors are split around load balancing, and ordered in each
+	// pipeline rather than in the order of the config.
+	expected := Topology{
+		Receivers: []string{"jaeger", "otlp/lb", "push_receiver"},
+		Pipelines: []PipelineTopology{
+			{
+				Name:       "traces/0",
+				Receivers:  []string{"jaeger", "push_receiver"},
+				Processors: []string{"attributes"},
+				Exporters:  []string{"loadbalancing"},
+			},
+			{
+				Name:       "traces/1",
+				Receivers:  []string{"otlp/lb"},
+				Processors: []string{"tail_sampling", "batch"},
+				Exporters:  []string{"otlphttp/0"},
+			},
+		},
+		Exporters: []ExporterTopology{
+			{Name: "loadbalancing", Format: "otlp", Protocol: "grpc"},
+			{Name: "otlphttp/0", Format: "otlp", Protocol: "http"},
+		},
+	}
+	require.Equal(t, expected, newTopology(otelConfig))
+}
+
+func TestPipelineTopology_String(t *testing.T) {
+	p := PipelineTopology{
+		Name:       "traces/1",
+		Receivers:  []string{"otlp/lb"},
+		Processors: []string{"tail_sampling", "batch"},
+		Exporters:  []string{"otlp/0", "otlphttp/1"},
+	}
+	require.Equal(t, "traces/1: [otlp/lb] -> [tail_sampling,batch] -> [otlp/0,otlphttp/1]", p.String())
+
+	require.Equal(t, "otlp/0(otlp/grpc)", ExporterTopology{Name: "otlp/0", Format: "otlp", Protocol: "grpc"}.String())
+	require.Equal(t, "remote_write", ExporterTopology{Name: "remote_write"}.String())
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/grafana/agent/internal/static/logs"
 	"github.com/grafana/agent/internal/static/metrics/instance"
+	"github.com/grafana/agent/internal/static/traces/tailsamplingmetrics"
 	"github.com/grafana/agent/internal/util/zapadapter"
 	prom_client "github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
@@ -20,6 +21,10 @@ type Traces struct {
 	logger *zap.Logger
 	reg    prom_client.Registerer
 
+	// tailSampling exposes the metrics of the tail sampling processors, which
+	// are shared by all the instances.
+	tailSampling prom_client.Collector
+
 	promInstanceManager instance.Manager
 }
 
@@ -30,8 +35,13 @@ func New(logsSubsystem *logs.Logs, promInstanceManager instance.Manager, reg pro
 		logger:              newLogger(l),
 		reg:                 reg,
 		promInstanceManager: promInstanceManager,
+		tailSampling:        tailsamplingmetrics.NewCollector(),
+	}
+	if err := reg.Register(traces.tailSampling); err != nil {
+		return nil, fmt.Errorf("failed to register tail sampling metrics: %w", err)
 	}
 	if err := traces.ApplyConfig(logsSubsystem, promInstanceManager, cfg); err != nil {
+		reg.Unregister(traces.tailSampling)
 		return nil, err
 	}
 	return traces, nil
@@ -53,6 +63,7 @@ func (t *Traces) ApplyConfig(logsSubsystem *logs.Logs, promInstanceManager insta
 	newInstances := make(map[string]*Instance, len(cfg.Configs))
 
 	for _, c := range cfg.Configs {
+		c.listenAddresses = cfg.ListenAddresses
 		var (
 			instReg = prom_client.WrapRegistererWith(prom_client.Labels{"traces_config": c.Name}, t.reg)
 		)
@@ -100,6 +111,7 @@ func (t *Traces) Stop() {
 	for _, i := range t.instances {
 		i.Stop()
 	}
+	t.reg.Unregister(t.tailSampling)
 }
 
 func newLogger(l log.Logger) *zap.Logger {
@@ -1,6 +1,7 @@
 package traces
 
 import (
+	"encoding/base64"
 	"fmt"
 	"strings"
 	"testing"
@@ -15,6 +16,8 @@ import (
 	"github.com/stretchr/testify/require"
 	jaegercfg "github.com/uber/jaeger-client-go/config"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 	"gopkg.in/yaml.v2"
 )
 
@@ -169,11 +172,169 @@ configs:
 	}
 }
 
+func TestTraces_SelfMonitoring(t *testing.T) {
+	tracesCh := make(chan ptrace.Traces, 1000)
+	tracesAddr := traceutils.NewTestServer(t, func(t ptrace.Traces) {
+		tracesCh <- t
+	})
+
+	tracesCfgText := util.Untab(fmt.Sprintf(`
+configs:
+- name: default
+  receivers:
+    jaeger:
+      protocols:
+        thrift_compact:
+  remote_write:
+  	- endpoint: %s
+  	  insecure: true
+  batch:
+    timeout: 100ms
+  self_monitoring:
+    enabled: true
+    interval: 50ms
+	`, tracesAddr))
+
+	var cfg Config
+	dec := yaml.NewDecoder(strings.NewReader(tracesCfgText))
+	dec.SetStrict(true)
+	require.NoError(t, dec.Decode(&cfg))
+
+	reg := prometheus.NewRegistry()
+	traces, err := New(nil, nil, reg, cfg, &server.HookLogger{})
+	require.NoError(t, err)
+	t.Cleanup(traces.Stop)
+
+	// The latency of the synthetic traces is measured by the exporter once
+	// the requests which contain them are acknowledged, so other spans must
+	// be batched with them.
+	tr := testJaegerTracer(t)
+	require.Eventually(t, func() bool {
+		span := tr.StartSpan("test-span")
+		span.Finish()
+
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		for _, mf := range families {
+			if mf.GetName() != "traces_self_monitoring_latency_seconds" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				if m.GetHistogram().GetSampleCount() > 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}, 30*time.Second, 50*time.Millisecond)
+
+	// Synthetic traces never reach the backend, while other traces still do.
+	require.NotEmpty(t, tracesCh)
+	for len(tracesCh) > 0 {
+		tr := <-tracesCh
+		for i := 0; i < tr.ResourceSpans().Len(); i++ {
+			for j := 0; j < tr.ResourceSpans().At(i).ScopeSpans().Len(); j++ {
+				spans := tr.ResourceSpans().At(i).ScopeSpans().At(j).Spans()
+				for k := 0; k < spans.Len(); k++ {
+					require.Equal(t, "test-span", spans.At(k).Name())
+				}
+			}
+		}
+	}
+}
+
+func TestTraces_TailSamplingMetrics(t *testing.T) {
+	tracesCh := make(chan ptrace.Traces, 10)
+	tracesAddr := traceutils.NewTestServer(t, func(t ptrace.Traces) {
+		tracesCh <- t
+	})
+
+	tracesCfgText := util.Untab(fmt.Sprintf(`
+configs:
+- name: default
+  receivers:
+    jaeger:
+      protocols:
+        thrift_compact:
+  remote_write:
+  	- endpoint: %s
+  	  insecure: true
+  batch:
+    timeout: 100ms
+    send_batch_size: 1
+  tail_sampling:
+    decision_wait: 1s
+    policies:
+      - name: slow
+        type: latency
+        latency:
+          threshold_ms: 1
+	`, tracesAddr))
+
+	var cfg Config
+	dec := yaml.NewDecoder(strings.NewReader(tracesCfgText))
+	dec.SetStrict(true)
+	require.NoError(t, dec.Decode(&cfg))
+
+	reg := prometheus.NewRegistry()
+	traces, err := New(nil, nil, reg, cfg, &server.HookLogger{})
+	require.NoError(t, err)
+
+	tr := testJaegerTracer(t)
+	span := tr.StartSpan("slow-span")
+	time.Sleep(10 * time.Millisecond)
+	span.Finish()
+
+	select {
+	case <-time.After(30 * time.Second):
+		require.Fail(t, "failed to receive a span after 30 seconds")
+	case tr := <-tracesCh:
+		require.Equal(t, "slow-span", tr.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).Name())
+	}
+
+	// The decisions of the policy are reported by policy name.
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	var sampled, onMemory bool
+	for _, mf := range families {
+		switch mf.GetName() {
+		case "traces_tail_sampling_count_traces_sampled_total":
+			for _, m := range mf.GetMetric() {
+				labels := make(map[string]string)
+				for _, lp := range m.GetLabel() {
+					labels[lp.GetName()] = lp.GetValue()
+				}
+				if labels["policy"] == "slow" && labels["sampled"] == "true" && m.GetCounter().GetValue() > 0 {
+					sampled = true
+				}
+			}
+		case "traces_tail_sampling_traces_on_memory":
+			onMemory = true
+		}
+	}
+	require.True(t, sampled, "missing sampled traces of the slow policy")
+	require.True(t, onMemory, "missing traces on memory")
+
+	// The metrics are unregistered once the traces subsystem stops.
+	traces.Stop()
+	families, err = reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range families {
+		require.NotContains(t, mf.GetName(), "traces_tail_sampling_")
+	}
+}
+
 func testJaegerTracer(t *testing.T) opentracing.Tracer {
 	t.Helper()
+	return testJaegerTracerWithService(t, "TestTraces")
+}
+
+func testJaegerTracerWithService(t *testing.T, service string) opentracing.Tracer {
+	t.Helper()
 
 	jaegerConfig := jaegercfg.Configuration{
-		ServiceName: "TestTraces",
+		ServiceName: service,
 		Sampler: &jaegercfg.SamplerConfig{
 			Type:  "const",
 			Param: 1,
@@ -191,3 +352,156 @@ func testJaegerTracer(t *testing.T) opentracing.Tracer {
 
 	return tr
 }
+
+func TestTraces_GeneratedConfigs(t *testing.T) {
+	tracesCfgText := func(endpoint string) string {
+		return util.Untab(fmt.Sprintf(`
+configs:
+- name: default
+  receivers:
+    otlp:
+      protocols:
+        grpc:
+          endpoint: 127.0.0.1:0
+  remote_write:
+  	- endpoint: %s
+  	  basic_auth:
+  	    username: test
+  	    password: supersecret
+	`, endpoint))
+	}
+
+	var cfg Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(tracesCfgText("example.com:12345")), &cfg))
+
+	traces, err := New(nil, nil, prometheus.NewRegistry(), cfg, &server.HookLogger{})
+	require.NoError(t, err)
+	defer traces.Stop()
+
+	exporterEndpoint := func() interface{} {
+		generated := traces.GeneratedConfigs()
+		require.Contains(t, generated, "default")
+		out, err := yaml.Marshal(generated)
+		require.NoError(t, err)
+		require.NotContains(t, string(out), "supersecret")
+		require.NotContains(t, string(out), base64.StdEncoding.EncodeToString([]byte("test:supersecret")))
+
+		exporters := generated["default"].(map[string]interface{})["exporters"].(map[string]interface{})
+		return exporters["otlp/0"].(map[string]interface{})["endpoint"]
+	}
+	require.Equal(t, "example.com:12345", exporterEndpoint())
+
+	// The generated config is refreshed on reload.
+	cfg = Config{}
+	require.NoError(t, yaml.UnmarshalStrict([]byte(tracesCfgText("example.com:54321")), &cfg))
+	require.NoError(t, traces.ApplyConfig(nil, nil, cfg))
+	require.Equal(t, "example.com:54321", exporterEndpoint())
+}
+
+func TestTraces_DebugFilterReload(t *testing.T) {
+	tracesCh := make(chan ptrace.Traces, 10)
+	tracesAddr := traceutils.NewTestServer(t, func(t ptrace.Traces) {
+		tracesCh <- t
+	})
+
+	tracesCfgText := func(debugFilter string) string {
+		return util.Untab(fmt.Sprintf(`
+configs:
+- name: default
+  receivers:
+    jaeger:
+      protocols:
+        thrift_compact:
+  remote_write:
+  	- endpoint: %s
+  	  insecure: true
+  batch:
+    timeout: 100ms
+    send_batch_size: 1
+%s`, tracesAddr, debugFilter))
+	}
+
+	var cfg Config
+	require.NoError(t, yaml.UnmarshalStrict([]byte(tracesCfgText("")), &cfg))
+
+	traces, err := New(nil, nil, prometheus.NewRegistry(), cfg, &server.HookLogger{})
+	require.NoError(t, err)
+	t.Cleanup(traces.Stop)
+	service := traces.Instance("default").service
+
+	cfg = Config{}
+	require.NoError(t, yaml.UnmarshalStrict([]byte(tracesCfgText(`
+  debug_filter:
+    rules:
+    - action: deny
+      resource_attributes:
+        service.name: Dropped
+`)), &cfg))
+	require.NoError(t, traces.ApplyConfig(nil, nil, cfg))
+
+	// Only the rules changed, so the pipeline keeps running.
+	require.Same(t, service, traces.Instance("default").service)
+
+	testJaegerTracerWithService(t, "Dropped").StartSpan("dropped-span").Finish()
+	testJaegerTracerWithService(t, "Kept").StartSpan("kept-span").Finish()
+
+	for {
+		select {
+		case <-time.After(30 * time.Second):
+			require.Fail(t, "failed to receive a span after 30 seconds")
+		case tr := <-tracesCh:
+			kept := false
+			for i := 0; i < tr.ResourceSpans().Len(); i++ {
+				name, _ := tr.ResourceSpans().At(i).Resource().Attributes().Get("service.name")
+				require.NotEqual(t, "Dropped", name.Str())
+				kept = kept || name.Str() == "Kept"
+			}
+			if kept {
+				return
+			}
+		}
+	}
+}
+
+func TestInstance_LogBatchHints(t *testing.T) {
+	t.Run("absent", func(t *testing.T) {
+		core, logs := observer.New(zap.DebugLevel)
+		inst := &Instance{logger: zap.New(core)}
+
+		// The hint should only be logged once, even across reloads.
+		inst.logBatchHints(InstanceConfig{})
+		inst.logBatchHints(InstanceConfig{})
+
+		entries := logs.FilterMessageSnippet("No batch block configured").All()
+		require.Len(t, entries, 1)
+		require.Equal(t, zap.InfoLevel, entries[0].Level)
+	})
+
+	t.Run("explicitly disabled", func(t *testing.T) {
+		core, logs := observer.New(zap.DebugLevel)
+		inst := &Instance{logger: zap.New(core)}
+
+		inst.logBatchHints(InstanceConfig{Batch: map[string]interface{}{"disabled": true}})
+
+		entries := logs.FilterMessageSnippet("batch processor is explicitly disabled").All()
+		require.Len(t, entries, 1)
+		require.Equal(t, zap.WarnLevel, entries[0].Level)
+		require.Zero(t, logs.FilterMessageSnippet("No batch block configured").Len())
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		core, logs := observer.New(zap.DebugLevel)
+		inst := &Instance{logger: zap.New(core)}
+
+		inst.logBatchHints(InstanceConfig{Batch: map[string]interface{}{"timeout": "5s"}})
+		require.Zero(t, logs.Len())
+	})
+
+	t.Run("configured by throughput_profile", func(t *testing.T) {
+		core, logs := observer.New(zap.DebugLevel)
+		inst := &Instance{logger: zap.New(core)}
+
+		inst.logBatchHints(InstanceConfig{ThroughputProfile: &throughputProfile{name: throughputProfileLow}})
+		require.Zero(t, logs.Len())
+	})
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/grafana/agent/internal/component"
+	"github.com/grafana/agent/internal/flow"
 	"github.com/grafana/agent/internal/service"
 	"github.com/grafana/agent/internal/service/cluster"
 	"github.com/prometheus/prometheus/util/httputil"
@@ -36,6 +37,8 @@ func (f *FlowAPI) RegisterRoutes(urlPrefix string, r *mux.Router) {
 	r.Handle(path.Join(urlPrefix, "/components"), httputil.CompressionHandler{Handler: f.listComponentsHandler()})
 	r.Handle(path.Join(urlPrefix, "/components/{id:.+}"), httputil.CompressionHandler{Handler: f.getComponentHandler()})
 	r.Handle(path.Join(urlPrefix, "/peers"), httputil.CompressionHandler{Handler: f.getClusteringPeersHandler()})
+	r.Handle(path.Join(urlPrefix, "/config/status"), httputil.CompressionHandler{Handler: f.getConfigStatusHandler()})
+	r.Handle(path.Join(urlPrefix, "/schemas"), httputil.CompressionHandler{Handler: f.listComponentSchemasHandler()})
 }
 
 func (f *FlowAPI) listComponentsHandler() http.HandlerFunc {
@@ -107,3 +110,45 @@ func (f *FlowAPI) getClusteringPeersHandler() http.HandlerFunc {
 		_, _ = w.Write(bb)
 	}
 }
+
+// configStatusProvider is implemented by the root Flow controller.
+type configStatusProvider interface {
+	ConfigStatus() flow.ConfigStatus
+}
+
+func (f *FlowAPI) getConfigStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		provider, ok := f.flow.(configStatusProvider)
+		if !ok {
+			http.Error(w, "config status not available", http.StatusNotFound)
+			return
+		}
+		bb, err := json.Marshal(provider.ConfigStatus())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(bb)
+	}
+}
+
+// componentSchemaProvider is implemented by the root Flow controller.
+type componentSchemaProvider interface {
+	ComponentSchemas() []flow.ComponentSchema
+}
+
+func (f *FlowAPI) listComponentSchemasHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		provider, ok := f.flow.(componentSchemaProvider)
+		if !ok {
+			http.Error(w, "component schemas not available", http.StatusNotFound)
+			return
+		}
+		bb, err := json.Marshal(provider.ComponentSchemas())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(bb)
+	}
+}